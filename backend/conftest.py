@@ -0,0 +1,61 @@
+"""
+测试共用夹具：生成测试用PDF，临时上传目录和临时文件目录
+"""
+
+from pathlib import Path
+from typing import Iterable, Optional
+
+import fitz
+import pytest
+
+from src.core.config import settings
+
+
+def _new_pdf(texts: Iterable[str], toc: Optional[list] = None) -> fitz.Document:
+    """每段文字一页，可附带书签"""
+    doc = fitz.open()
+    for text in texts:
+        doc.new_page().insert_text((72, 72), text)
+    if toc:
+        doc.set_toc(toc)
+    return doc
+
+
+@pytest.fixture
+def make_pdf():
+    """在指定路径生成PDF，第i页的文字为 "{label} {i}"，可附带书签"""
+    def make(path: Path, pages: int = 1, label: str = "Page", toc: Optional[list] = None) -> Path:
+        doc = _new_pdf((f"{label} {i + 1}" for i in range(pages)), toc)
+        doc.save(str(path))
+        doc.close()
+        return path
+    return make
+
+
+@pytest.fixture
+def pdf_bytes():
+    """生成PDF数据，每个参数一页；不传文字时生成pages页，第i页的文字为 "Page {i}" """
+    def build(*texts: str, pages: int = 1) -> bytes:
+        doc = _new_pdf(texts or [f"Page {i + 1}" for i in range(pages)])
+        data = doc.tobytes()
+        doc.close()
+        return data
+    return build
+
+
+@pytest.fixture
+def tmp_upload_dir(tmp_path, monkeypatch):
+    """把UPLOAD_DIR指向空的临时目录，测试结束后恢复"""
+    path = tmp_path / "uploads"
+    path.mkdir()
+    monkeypatch.setattr(settings, "UPLOAD_DIR", str(path))
+    return path
+
+
+@pytest.fixture
+def tmp_temp_dir(tmp_path, monkeypatch):
+    """把TEMP_DIR指向空的临时目录，测试结束后恢复"""
+    path = tmp_path / "temp"
+    path.mkdir()
+    monkeypatch.setattr(settings, "TEMP_DIR", str(path))
+    return path
@@ -7,13 +7,39 @@ import os
 import logging
 from contextlib import asynccontextmanager
 
-from fastapi import FastAPI
+from fastapi import FastAPI, Request
+from fastapi.encoders import jsonable_encoder
+from fastapi.exceptions import RequestValidationError
+from fastapi.responses import JSONResponse
 from fastapi.middleware.cors import CORSMiddleware
-from fastapi.staticfiles import StaticFiles
+from starlette.exceptions import HTTPException as StarletteHTTPException
 from loguru import logger
 
-from src.api.routes import router
+from src import __version__
+from src.api.routes import router, task_service
+from src.api.graphql import graphql_router
+from src.api.mcp import router as mcp_router
+from src.api.middleware import (
+    AccessLogMiddleware,
+    BodySizeLimitMiddleware,
+    ClientDisconnectMiddleware,
+    CompressionMiddleware,
+    TenantMiddleware,
+    RBACMiddleware,
+    RequestTimeoutMiddleware,
+    UploadConcurrencyMiddleware
+)
 from src.core.config import settings
+from src.core.metrics import metrics
+from src.core.document_cache import document_cache
+from src.core.errors import DomainError, code_for_status, error_payload
+from src.core.memory import memory_budget
+from src.core.scratch import sweep_orphaned_scratch
+from src.core.store import get_store, close_store
+from src.core.tenancy import migrate_legacy_storage
+from src.models.schemas import ErrorCode
+from src.core.leader import leader_election
+from src.services.webhook_service import webhook_service
 
 
 # 配置日志
@@ -32,20 +58,50 @@ async def lifespan(app: FastAPI):
     os.makedirs(settings.UPLOAD_DIR, exist_ok=True)
     os.makedirs(settings.TEMP_DIR, exist_ok=True)
     
+    # 清理上次崩溃时未删除的任务临时目录
+    sweep_orphaned_scratch()
+    
+    # 旧版本的默认租户数据在上传目录根下，移到默认租户自己的目录
+    migrate_legacy_storage()
+    
+    # 打开元数据存储，配置错误时启动失败
+    get_store()
+    
+    # 参与主节点选举，延迟任务派发、Webhook重试和过期任务清理只在主节点执行
+    await leader_election.start()
+    
+    # 恢复未完成的Webhook投递
+    await webhook_service.start()
+    
+    # 加载任务记录，重新排队待处理的任务并把上次中断的处理中任务标记为失败
+    await task_service.start()
+    
     yield
     
     # 关闭时执行
     logger.info("PDF章节拆分器后端服务关闭中...")
+    await webhook_service.stop()
+    await leader_election.stop()
+    close_store()
 
 
 # 创建FastAPI应用
 app = FastAPI(
     title="PDF章节拆分器 - 后端服务",
     description="基于FastAPI的PDF章节拆分完整后端服务",
-    version="1.0.0",
+    version=__version__,
     lifespan=lifespan
 )
 
+# 限制同时进行的上传数（需位于租户中间件之内，按调用方计数）
+app.add_middleware(UploadConcurrencyMiddleware)
+
+# 按角色控制访问（需位于租户中间件之内）
+app.add_middleware(RBACMiddleware)
+
+# 多租户识别、调用方识别和限流（位于CORS之内，拒绝响应也带跨域头）
+app.add_middleware(TenantMiddleware)
+
 # CORS配置 - WSL环境适配
 app.add_middleware(
     CORSMiddleware,
@@ -67,12 +123,53 @@ app.add_middleware(
     allow_headers=["*"],
 )
 
-# 静态文件服务（用于文件下载）
-if os.path.exists(settings.UPLOAD_DIR):
-    app.mount("/files", StaticFiles(directory=settings.UPLOAD_DIR), name="files")
+# 按路由限制请求体大小，超限的请求在读到超出部分时即被拒绝
+app.add_middleware(BodySizeLimitMiddleware)
+
+# 压缩JSON响应，下载等其他响应原样透传
+app.add_middleware(CompressionMiddleware)
+
+# 按路由限制处理时间和客户端空闲时间（位于访问日志之内，超时响应也被记录）
+app.add_middleware(RequestTimeoutMiddleware)
+
+# 客户端断开时取消请求处理（位于超时之外、访问日志之内，断开的请求记录为499）
+app.add_middleware(ClientDisconnectMiddleware)
+
+# 结构化访问日志（替代uvicorn默认访问日志）
+app.add_middleware(AccessLogMiddleware)
+
+# 上传目录中还有元数据存储（任务、API Key哈希、分享链接、Webhook请求头），不作为静态文件开放，
+# 文件只通过经过鉴权和归属检查的下载接口提供
 
 # 注册API路由
 app.include_router(router, prefix="/api")
+app.include_router(graphql_router, prefix="/api")
+app.include_router(mcp_router, prefix="/api")
+
+
+@app.exception_handler(DomainError)
+async def domain_error_handler(request: Request, exc: DomainError):
+    """领域错误按错误类型映射为状态码和错误代码"""
+    return JSONResponse(status_code=exc.status_code, content=error_payload(exc.message, exc.code))
+
+
+@app.exception_handler(StarletteHTTPException)
+async def http_error_handler(request: Request, exc: StarletteHTTPException):
+    """直接抛出的HTTP错误按状态码补充错误代码"""
+    return JSONResponse(
+        status_code=exc.status_code,
+        content=error_payload(exc.detail, code_for_status(exc.status_code)),
+        headers=getattr(exc, "headers", None)
+    )
+
+
+@app.exception_handler(RequestValidationError)
+async def validation_error_handler(request: Request, exc: RequestValidationError):
+    """参数校验失败"""
+    return JSONResponse(
+        status_code=422,
+        content=error_payload(jsonable_encoder(exc.errors()), ErrorCode.INVALID_REQUEST)
+    )
 
 
 @app.get("/")
@@ -80,7 +177,7 @@ async def root():
     """根路径健康检查"""
     return {
         "service": "PDF章节拆分器 - 后端服务",
-        "version": "1.0.0",
+        "version": __version__,
         "status": "healthy",
         "description": "统一的FastAPI后端服务，提供文件管理、章节识别、PDF拆分等功能"
     }
@@ -92,10 +189,61 @@ async def health_check():
     return {
         "status": "healthy",
         "service": "pdf-chapter-splitter-backend",
-        "version": "1.0.0",
+        "version": __version__,
         "upload_dir": settings.UPLOAD_DIR,
         "temp_dir": settings.TEMP_DIR,
-        "max_file_size": settings.MAX_FILE_SIZE
+        "max_file_size": settings.MAX_FILE_SIZE,
+        "leader": leader_election.status()
+    }
+
+
+@app.get("/health/ready")
+async def readiness_check():
+    """
+    就绪检查端点，包含存储连通性、队列积压和工作线程占用，
+    存储或任务队列不可用、排队任务超过READY_MAX_QUEUE_LENGTH时返回503
+    """
+    checks = {}
+    ready = True
+    
+    try:
+        await get_store().aget("leases", leader_election.name)
+        checks["store"] = "ok"
+    except Exception as e:
+        checks["store"] = f"error: {str(e)}"
+        ready = False
+    
+    try:
+        queue = await task_service.get_saturation()
+    except Exception as e:
+        queue = None
+        checks["queue"] = f"error: {str(e)}"
+        ready = False
+    else:
+        if settings.READY_MAX_QUEUE_LENGTH and queue["queue_length"] > settings.READY_MAX_QUEUE_LENGTH:
+            checks["queue"] = "saturated"
+            ready = False
+        else:
+            checks["queue"] = "ok"
+    
+    return JSONResponse(
+        status_code=200 if ready else 503,
+        content={
+            "status": "ready" if ready else "not_ready",
+            "checks": checks,
+            "queue": queue,
+            "leader": leader_election.status()
+        }
+    )
+
+
+@app.get("/metrics")
+async def get_metrics():
+    """请求指标端点"""
+    return {
+        **metrics.snapshot(),
+        "document_cache": document_cache.stats(),
+        "memory_budget": memory_budget.stats()
     }
 
 
@@ -107,5 +255,7 @@ if __name__ == "__main__":
         host=settings.HOST,
         port=settings.PORT,
         reload=settings.DEBUG,
-        log_level="info"
+        log_level="info",
+        access_log=False,
+        timeout_keep_alive=settings.KEEPALIVE_TIMEOUT
     )
\ No newline at end of file
@@ -1 +1,3 @@
-# PDF章节拆分器后端服务
\ No newline at end of file
+# PDF章节拆分器后端服务
+
+__version__ = "1.0.0"
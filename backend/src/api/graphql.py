@@ -0,0 +1,366 @@
+"""
+GraphQL接口
+在 /api/graphql 提供文件、章节和任务的查询，分析和拆分变更，以及任务进度订阅（WebSocket），
+变更操作复用REST路由的实现，权限和租户隔离与REST接口一致
+"""
+
+import asyncio
+from datetime import datetime
+from typing import AsyncGenerator, List, Optional
+
+import strawberry
+from fastapi import HTTPException
+from graphql import GraphQLError
+from pydantic import ValidationError
+from strawberry.fastapi import GraphQLRouter
+
+from ..models.schemas import (
+    AnalyzeRequest,
+    ChapterInfo,
+    ErrorCode,
+    FileInfo,
+    FileStatus,
+    ManifestEntry,
+    PageNumbering,
+    Role,
+    SectionType,
+    SplitRequest,
+    SplitTask,
+    TaskEvent,
+    TaskPriority,
+    TaskStatus,
+    TaskType,
+)
+from ..core.auth import get_current_principal, has_role
+from ..core.config import settings
+from ..core.errors import DomainError, code_for_status
+from ..services.document_title import display_name
+from ..services.task_state import FINISHED_STATUSES
+from . import routes
+from .routes import file_service, task_service
+
+
+FileStatusEnum = strawberry.enum(FileStatus)
+TaskStatusEnum = strawberry.enum(TaskStatus)
+TaskTypeEnum = strawberry.enum(TaskType)
+TaskPriorityEnum = strawberry.enum(TaskPriority)
+SectionTypeEnum = strawberry.enum(SectionType)
+PageNumberingEnum = strawberry.enum(PageNumbering)
+
+@strawberry.type(description="章节")
+class Chapter:
+    id: Optional[str]
+    title: str
+    start_page: int
+    end_page: int
+    page_count: int
+    start_label: Optional[str]
+    end_label: Optional[str]
+    section_type: SectionTypeEnum
+
+    @staticmethod
+    def from_model(chapter: ChapterInfo) -> "Chapter":
+        return Chapter(
+            id=chapter.id,
+            title=chapter.title,
+            start_page=chapter.start_page,
+            end_page=chapter.end_page,
+            page_count=chapter.page_count,
+            start_label=chapter.start_label,
+            end_label=chapter.end_label,
+            section_type=chapter.section_type
+        )
+
+
+@strawberry.type(description="章节输出文件")
+class OutputFile:
+    filename: str
+    title: str
+    start_page: int
+    end_page: int
+    pages: int
+    size: int
+    sha256: str
+
+    @staticmethod
+    def from_model(entry: ManifestEntry) -> "OutputFile":
+        return OutputFile(**entry.model_dump(include={"filename", "title", "start_page", "end_page", "pages", "size", "sha256"}))
+
+
+@strawberry.type(description="任务事件")
+class TaskEventItem:
+    event: str
+    message: str
+    timestamp: datetime
+    progress: Optional[int]
+
+    @staticmethod
+    def from_model(event: TaskEvent) -> "TaskEventItem":
+        return TaskEventItem(event=event.event, message=event.message, timestamp=event.timestamp, progress=event.progress)
+
+
+@strawberry.type(description="拆分或分析任务")
+class Task:
+    task_id: strawberry.ID
+    file_id: strawberry.ID
+    task_type: TaskTypeEnum
+    status: TaskStatusEnum
+    progress: int
+    priority: TaskPriorityEnum
+    created_at: datetime
+    completed_at: Optional[datetime]
+    run_at: Optional[datetime]
+    download_links: List[str]
+    error_message: Optional[str]
+    chapters: List[Chapter]
+
+    @strawberry.field(description="事件时间线")
+    async def events(self) -> List[TaskEventItem]:
+        events = await task_service.get_task_events(str(self.task_id)) or []
+        return [TaskEventItem.from_model(event) for event in events]
+
+    @staticmethod
+    def from_model(task: SplitTask) -> "Task":
+        return Task(
+            task_id=strawberry.ID(task.task_id),
+            file_id=strawberry.ID(task.file_id),
+            task_type=task.task_type,
+            status=task.status,
+            progress=task.progress,
+            priority=task.priority,
+            created_at=task.created_at,
+            completed_at=task.completed_at,
+            run_at=task.run_at,
+            download_links=list(task.download_links),
+            error_message=task.error_message,
+            chapters=[Chapter.from_model(chapter) for chapter in task.chapters]
+        )
+
+
+@strawberry.type(description="上传的文件")
+class File:
+    file_id: strawberry.ID
+    filename: str
+    display_name: str
+    title: Optional[str]
+    author: Optional[str]
+    file_size: int
+    upload_time: datetime
+    status: FileStatusEnum
+    page_offset: Optional[int]
+    download_count: int
+    last_accessed: Optional[datetime]
+    original_expires_at: Optional[datetime]
+    outputs_expires_at: Optional[datetime]
+    collection: Optional[str]
+    tags: List[str]
+
+    @strawberry.field(description="已生成的章节文件")
+    async def outputs(self) -> List[OutputFile]:
+        manifest = await file_service.get_manifest(str(self.file_id))
+        return [OutputFile.from_model(entry) for entry in manifest.files] if manifest else []
+
+    @strawberry.field(description="该文件的任务")
+    async def tasks(self) -> List[Task]:
+        return [Task.from_model(task) for task in await task_service.list_tasks(str(self.file_id))]
+
+    @staticmethod
+    def from_model(info: FileInfo) -> "File":
+        return File(
+            file_id=strawberry.ID(info.file_id),
+            filename=info.filename,
+            display_name=display_name(info),
+            title=info.title,
+            author=info.author,
+            file_size=info.file_size,
+            upload_time=info.upload_time,
+            status=info.status,
+            page_offset=info.page_offset,
+            download_count=info.download_count,
+            last_accessed=info.last_accessed,
+            original_expires_at=info.original_expires_at,
+            outputs_expires_at=info.outputs_expires_at,
+            collection=info.collection,
+            tags=info.tags
+        )
+
+
+@strawberry.type(description="章节分析结果")
+class AnalyzeResult:
+    chapters: List[Chapter]
+    total_pages: int
+    message: Optional[str]
+    page_labels: Optional[List[str]]
+    cached: bool
+
+
+@strawberry.type(description="拆分任务创建结果")
+class SplitResult:
+    task: Task
+    message: str
+
+
+@strawberry.input(description="章节分析参数")
+class AnalyzeInput:
+    file_id: strawberry.ID
+    min_pages_per_chapter: int = 1
+    normalize_titles: bool = False
+    force_refresh: bool = False
+
+
+@strawberry.input(description="章节范围")
+class ChapterInput:
+    title: str
+    start_page: int
+    end_page: int
+    start_label: Optional[str] = None
+    end_label: Optional[str] = None
+    section_type: SectionTypeEnum = SectionType.CHAPTER
+
+
+@strawberry.input(description="拆分参数")
+class SplitInput:
+    file_id: strawberry.ID
+    chapters: List[ChapterInput]
+    numbering: PageNumberingEnum = PageNumbering.PHYSICAL
+    auto_fix: bool = False
+    min_pages_per_chapter: int = 1
+    priority: TaskPriorityEnum = TaskPriority.NORMAL
+    run_at: Optional[datetime] = None
+
+
+def _require_editor() -> None:
+    """变更操作需要editor角色"""
+    if not has_role(get_current_principal(), Role.EDITOR):
+        raise GraphQLError(f"权限不足，需要{Role.EDITOR.value}角色", extensions={"status": 403})
+
+
+def _graphql_error(e: Exception) -> GraphQLError:
+    """把REST层的异常转换为GraphQL错误，保留HTTP状态码和错误代码"""
+    if isinstance(e, DomainError):
+        return GraphQLError(e.message, extensions={"status": e.status_code, "code": e.code.value})
+    if isinstance(e, HTTPException):
+        return GraphQLError(str(e.detail), extensions={"status": e.status_code, "code": code_for_status(e.status_code).value})
+    if isinstance(e, (ValidationError, ValueError)):
+        return GraphQLError(str(e), extensions={"status": 400, "code": ErrorCode.INVALID_REQUEST.value})
+    return GraphQLError(str(e), extensions={"status": 500, "code": ErrorCode.INTERNAL.value})
+
+
+@strawberry.type
+class Query:
+    @strawberry.field(description="当前租户的文件，可按标签和目录筛选")
+    async def files(self, tag: Optional[str] = None, collection: Optional[str] = None) -> List[File]:
+        return [File.from_model(info) for info in await file_service.list_files(tag=tag, collection=collection)]
+
+    @strawberry.field(description="按ID获取文件")
+    async def file(self, file_id: strawberry.ID) -> Optional[File]:
+        info = await file_service.get_file_info(str(file_id))
+        return File.from_model(info) if info else None
+
+    @strawberry.field(description="任务列表")
+    async def tasks(self, file_id: Optional[strawberry.ID] = None) -> List[Task]:
+        tasks = await task_service.list_tasks(str(file_id) if file_id else None)
+        return [Task.from_model(task) for task in tasks]
+
+    @strawberry.field(description="按ID获取任务")
+    async def task(self, task_id: strawberry.ID) -> Optional[Task]:
+        task = await task_service.get_task_status(str(task_id))
+        return Task.from_model(task) if task else None
+
+
+@strawberry.type
+class Mutation:
+    @strawberry.mutation(description="分析章节结构")
+    async def analyze(self, input: AnalyzeInput) -> AnalyzeResult:
+        _require_editor()
+        try:
+            request = AnalyzeRequest(
+                file_id=str(input.file_id),
+                min_pages_per_chapter=input.min_pages_per_chapter,
+                normalize_titles=input.normalize_titles,
+                force_refresh=input.force_refresh
+            )
+            response = await routes.analyze_chapters(request)
+        except Exception as e:
+            raise _graphql_error(e)
+
+        return AnalyzeResult(
+            chapters=[Chapter.from_model(chapter) for chapter in response.chapters],
+            total_pages=response.total_pages,
+            message=response.message,
+            page_labels=response.page_labels,
+            cached=response.cached
+        )
+
+    @strawberry.mutation(description="创建拆分任务")
+    async def split(self, input: SplitInput) -> SplitResult:
+        _require_editor()
+        try:
+            request = SplitRequest(
+                file_id=str(input.file_id),
+                chapters=[
+                    ChapterInfo(
+                        title=chapter.title,
+                        start_page=chapter.start_page,
+                        end_page=chapter.end_page,
+                        page_count=max(chapter.end_page - chapter.start_page + 1, 1),
+                        start_label=chapter.start_label,
+                        end_label=chapter.end_label,
+                        section_type=chapter.section_type
+                    )
+                    for chapter in input.chapters
+                ],
+                numbering=input.numbering,
+                auto_fix=input.auto_fix,
+                min_pages_per_chapter=input.min_pages_per_chapter,
+                priority=input.priority,
+                run_at=input.run_at
+            )
+            response = await routes.split_pdf(request)
+            task = await task_service.get_task_status(response.task_id)
+        except Exception as e:
+            raise _graphql_error(e)
+
+        return SplitResult(task=Task.from_model(task), message=response.message)
+
+    @strawberry.mutation(description="取消任务")
+    async def cancel_task(self, task_id: strawberry.ID) -> bool:
+        _require_editor()
+        return await task_service.cancel_task(str(task_id))
+
+    @strawberry.mutation(description="重试失败或已取消的拆分任务，已完成的章节从检查点恢复")
+    async def retry_task(self, task_id: strawberry.ID) -> Task:
+        _require_editor()
+        try:
+            task = await task_service.retry_task(str(task_id))
+        except Exception as e:
+            raise _graphql_error(e)
+        if not task:
+            raise GraphQLError("任务不存在", extensions={"status": 404})
+        return Task.from_model(task)
+
+
+@strawberry.type
+class Subscription:
+    @strawberry.subscription(description="任务进度，状态或进度变化时推送，任务结束后关闭")
+    async def task_progress(self, task_id: strawberry.ID) -> AsyncGenerator[Task, None]:
+        last_state = None
+        while True:
+            task = await task_service.get_task_status(str(task_id))
+            if not task:
+                raise GraphQLError("任务不存在", extensions={"status": 404})
+
+            state = (task.status, task.progress)
+            if state != last_state:
+                yield Task.from_model(task)
+                last_state = state
+
+            if task.status in FINISHED_STATUSES:
+                return
+
+            await asyncio.sleep(settings.SSE_POLL_INTERVAL)
+
+
+schema = strawberry.Schema(query=Query, mutation=Mutation, subscription=Subscription)
+
+graphql_router = GraphQLRouter(schema, path="/graphql")
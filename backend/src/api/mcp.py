@@ -0,0 +1,271 @@
+"""
+面向AI Agent的工具调用接口
+以MCP（Model Context Protocol）的JSON-RPC over HTTP方式暴露分析、拆分和下载操作，
+同时在 /api/tools 提供纯JSON的工具清单，供不支持MCP的框架直接读取
+"""
+
+import json
+from typing import Any, Awaitable, Callable, Dict, List, Optional
+from urllib.parse import quote
+
+from fastapi import APIRouter, HTTPException, Request
+from fastapi.responses import JSONResponse, Response
+from loguru import logger
+from pydantic import BaseModel, Field, ValidationError
+
+from .. import __version__
+from ..models.schemas import TASK_PRIVATE_FIELDS, AnalyzeRequest, Role, SplitRequest
+from ..core.auth import get_current_principal, has_role
+from ..core.errors import DomainError
+from . import routes
+from .routes import file_service, task_service
+
+
+MCP_PROTOCOL_VERSION = "2024-11-05"
+SERVER_INFO = {"name": "pdf-chapter-splitter", "version": __version__}
+
+# JSON-RPC错误码
+PARSE_ERROR = -32700
+INVALID_REQUEST = -32600
+METHOD_NOT_FOUND = -32601
+INVALID_PARAMS = -32602
+
+
+class FileIdInput(BaseModel):
+    """按文件操作的工具参数"""
+    file_id: str = Field(..., description="文件唯一标识")
+
+
+class TaskIdInput(BaseModel):
+    """按任务操作的工具参数"""
+    task_id: str = Field(..., description="任务唯一标识")
+
+
+class ListTasksInput(BaseModel):
+    """列出任务的工具参数"""
+    file_id: Optional[str] = Field(None, description="只列出该文件的任务")
+
+
+class ListFilesInput(BaseModel):
+    """列出文件的工具参数"""
+    tag: Optional[str] = Field(None, description="只列出带有该标签的文件")
+    collection: Optional[str] = Field(None, description="只列出该目录及其子目录中的文件")
+
+
+class Tool:
+    """工具定义：参数模型、所需角色和处理函数"""
+
+    def __init__(
+        self,
+        name: str,
+        description: str,
+        input_model: type,
+        handler: Callable[[BaseModel], Awaitable[Any]],
+        role: Role = Role.VIEWER
+    ):
+        self.name = name
+        self.description = description
+        self.input_model = input_model
+        self.handler = handler
+        self.role = role
+
+    def describe(self) -> Dict[str, Any]:
+        """MCP工具描述"""
+        return {
+            "name": self.name,
+            "description": self.description,
+            "inputSchema": self.input_model.model_json_schema(),
+        }
+
+
+async def _list_files(params: ListFilesInput) -> Any:
+    files = await file_service.list_files(tag=params.tag, collection=params.collection)
+    return [
+        routes._file_summary(info).model_dump(
+            mode="json", include={"file_id", "filename", "display_name", "file_size", "upload_time", "status", "collection", "tags"}
+        )
+        for info in files
+    ]
+
+
+async def _analyze(request: AnalyzeRequest) -> Any:
+    response = await routes.analyze_chapters(request)
+    return response.model_dump(mode="json", exclude={"suggestions"})
+
+
+async def _split(request: SplitRequest) -> Any:
+    response = await routes.split_pdf(request)
+    return response.model_dump(mode="json")
+
+
+async def _get_task(params: TaskIdInput) -> Any:
+    task = await routes.get_task_status(params.task_id)
+    return task.model_dump(mode="json", exclude=TASK_PRIVATE_FIELDS)
+
+
+async def _list_tasks(params: ListTasksInput) -> Any:
+    tasks = await task_service.list_tasks(params.file_id)
+    return [
+        task.model_dump(mode="json", include={"task_id", "file_id", "task_type", "status", "progress", "created_at", "error_message"})
+        for task in tasks
+    ]
+
+
+async def _download_links(params: FileIdInput) -> Any:
+    manifest = await routes.download_manifest(params.file_id)
+    base = f"/api/download/{quote(params.file_id)}"
+    return {
+        "archive_url": f"{base}/archive",
+        "files": [
+            {**entry.model_dump(mode="json"), "url": f"{base}?filename={quote(entry.filename)}"}
+            for entry in manifest.files
+        ],
+    }
+
+
+TOOLS: Dict[str, Tool] = {tool.name: tool for tool in [
+    Tool("list_files", "列出已上传的PDF文件，可按标签和目录筛选", ListFilesInput, _list_files),
+    Tool(
+        "analyze_pdf",
+        "识别PDF的章节结构，返回章节标题和页码范围。拆分前应先调用此工具获取章节",
+        AnalyzeRequest, _analyze, Role.EDITOR
+    ),
+    Tool(
+        "split_pdf",
+        "按章节列表创建异步拆分任务，返回task_id；用get_task查询进度，完成后用get_download_links获取下载地址",
+        SplitRequest, _split, Role.EDITOR
+    ),
+    Tool("get_task", "查询任务状态、进度和错误信息", TaskIdInput, _get_task),
+    Tool("list_tasks", "列出任务", ListTasksInput, _list_tasks),
+    Tool("get_download_links", "获取拆分后各章节文件和打包文件的下载地址（相对路径，需携带相同的认证头）", FileIdInput, _download_links),
+]}
+
+
+async def call_tool(name: str, arguments: Dict[str, Any]) -> Dict[str, Any]:
+    """
+    执行工具，业务错误以isError结果返回，便于Agent据此调整参数重试
+
+    Args:
+        name: 工具名
+        arguments: 工具参数
+
+    Returns:
+        MCP工具调用结果
+    """
+    tool = TOOLS[name]
+    if not has_role(get_current_principal(), tool.role):
+        return _tool_result(f"权限不足，需要{tool.role.value}角色", is_error=True)
+
+    try:
+        result = await tool.handler(tool.input_model(**(arguments or {})))
+        return _tool_result(json.dumps(result, ensure_ascii=False))
+    except ValidationError as e:
+        return _tool_result(f"参数错误: {e}", is_error=True)
+    except HTTPException as e:
+        return _tool_result(str(e.detail), is_error=True)
+    except DomainError as e:
+        return _tool_result(e.message, is_error=True)
+    except Exception as e:
+        logger.error(f"工具调用失败: {name} - {str(e)}")
+        return _tool_result(f"工具调用失败: {str(e)}", is_error=True)
+
+
+def _tool_result(text: str, is_error: bool = False) -> Dict[str, Any]:
+    return {"content": [{"type": "text", "text": text}], "isError": is_error}
+
+
+class JsonRpcError(Exception):
+    """JSON-RPC协议错误"""
+
+    def __init__(self, code: int, message: str):
+        super().__init__(message)
+        self.code = code
+        self.message = message
+
+
+async def _dispatch(method: str, params: Dict[str, Any]) -> Any:
+    if method == "initialize":
+        return {
+            "protocolVersion": params.get("protocolVersion") or MCP_PROTOCOL_VERSION,
+            "capabilities": {"tools": {"listChanged": False}},
+            "serverInfo": SERVER_INFO,
+        }
+    if method == "ping":
+        return {}
+    if method == "tools/list":
+        return {"tools": [tool.describe() for tool in TOOLS.values()]}
+    if method == "tools/call":
+        name = params.get("name")
+        if name not in TOOLS:
+            raise JsonRpcError(INVALID_PARAMS, f"未知工具: {name}")
+        return await call_tool(name, params.get("arguments") or {})
+    raise JsonRpcError(METHOD_NOT_FOUND, f"不支持的方法: {method}")
+
+
+async def _handle_message(message: Any) -> Optional[Dict[str, Any]]:
+    """处理单条JSON-RPC消息，通知（无id）不返回响应"""
+    if not isinstance(message, dict) or message.get("jsonrpc") != "2.0" or not isinstance(message.get("method"), str):
+        return {"jsonrpc": "2.0", "id": None, "error": {"code": INVALID_REQUEST, "message": "无效的JSON-RPC请求"}}
+
+    is_notification = "id" not in message
+    try:
+        result = await _dispatch(message["method"], message.get("params") or {})
+        response = {"jsonrpc": "2.0", "id": message.get("id"), "result": result}
+    except JsonRpcError as e:
+        response = {"jsonrpc": "2.0", "id": message.get("id"), "error": {"code": e.code, "message": e.message}}
+    return None if is_notification else response
+
+
+router = APIRouter()
+
+
+@router.post("/mcp")
+async def mcp_endpoint(request: Request):
+    """
+    MCP JSON-RPC入口，支持initialize、tools/list、tools/call和批量请求
+
+    Args:
+        request: JSON-RPC请求体
+
+    Returns:
+        JSON-RPC响应，仅包含通知时返回202
+    """
+    try:
+        payload = await request.json()
+    except Exception:
+        return JSONResponse({"jsonrpc": "2.0", "id": None, "error": {"code": PARSE_ERROR, "message": "请求体不是有效的JSON"}})
+
+    if isinstance(payload, list):
+        responses = [item for item in [await _handle_message(message) for message in payload] if item]
+        return JSONResponse(responses) if responses else Response(status_code=202)
+
+    response = await _handle_message(payload)
+    return JSONResponse(response) if response else Response(status_code=202)
+
+
+@router.get("/tools")
+async def list_tools() -> List[Dict[str, Any]]:
+    """
+    工具清单（名称、描述和JSON Schema参数），可直接转换为各家大模型的function calling定义
+
+    Returns:
+        工具列表
+    """
+    return [tool.describe() for tool in TOOLS.values()]
+
+
+@router.post("/tools/{name}")
+async def invoke_tool(name: str, arguments: Dict[str, Any]):
+    """
+    以普通HTTP方式调用工具
+
+    Args:
+        name: 工具名
+        arguments: 工具参数
+
+    Returns:
+        MCP工具调用结果
+    """
+    if name not in TOOLS:
+        raise HTTPException(status_code=404, detail=f"未知工具: {name}")
+    return await call_tool(name, arguments)
@@ -0,0 +1,813 @@
+"""
+HTTP中间件
+"""
+
+import asyncio
+import json
+import time
+import re
+import zlib
+from typing import Dict, List, Optional, Pattern, Set, Tuple
+from uuid import uuid4
+
+from loguru import logger
+
+from ..core.config import settings
+from ..core.errors import UnavailableError, code_for_status, error_payload
+from ..core.metrics import metrics
+from ..core.tenancy import (
+    TENANT_ID_PATTERN,
+    is_known_tenant,
+    use_tenant
+)
+from ..core.auth import Principal, authenticate, effective_rate_limit, has_role, use_principal
+from ..core.oidc import oidc_provider
+from ..models.schemas import Role
+from ..services.audit_service import audit_service
+
+
+class AccessLogMiddleware:
+    """
+    结构化访问日志中间件
+
+    记录每个请求的方法、路径、状态码、耗时、收发字节数、调用方和请求ID，
+    同一份字段同时写入指标注册表
+    """
+
+    def __init__(self, app):
+        self.app = app
+        self.min_level = logger.level(settings.ACCESS_LOG_LEVEL.upper()).no
+        self.skip_paths = set(settings.ACCESS_LOG_SKIP_PATHS)
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        headers = {k.decode("latin-1").lower(): v.decode("latin-1") for k, v in scope.get("headers", [])}
+        request_id = headers.get("x-request-id") or str(uuid4())
+        scope.setdefault("state", {})["request_id"] = request_id
+
+        start_time = time.perf_counter()
+        counters = {"bytes_in": 0, "bytes_out": 0, "status": 500, "started": False}
+
+        async def receive_wrapper():
+            message = await receive()
+            if message["type"] == "http.request":
+                counters["bytes_in"] += len(message.get("body", b""))
+            return message
+
+        async def send_wrapper(message):
+            if message["type"] == "http.response.start":
+                counters["status"] = message["status"]
+                counters["started"] = True
+                message.setdefault("headers", [])
+                message["headers"] = list(message["headers"]) + [(b"x-request-id", request_id.encode("latin-1"))]
+            elif message["type"] == "http.response.body":
+                counters["bytes_out"] += len(message.get("body", b""))
+            await send(message)
+
+        try:
+            await self.app(scope, receive_wrapper, send_wrapper)
+        finally:
+            if not counters["started"] and scope["state"].get("client_disconnected"):
+                counters["status"] = CLIENT_CLOSED_REQUEST
+            latency_ms = (time.perf_counter() - start_time) * 1000
+            self._record(scope, headers, request_id, counters, latency_ms)
+
+    def _record(self, scope, headers: dict, request_id: str, counters: dict, latency_ms: float) -> None:
+        """写入访问日志和指标"""
+        method = scope.get("method", "")
+        path = scope.get("path", "")
+        route = self._route_template(scope)
+        status = counters["status"]
+
+        metrics.observe_request(
+            method,
+            route,
+            status,
+            latency_ms,
+            counters["bytes_in"],
+            counters["bytes_out"]
+        )
+
+        if path in self.skip_paths:
+            return
+
+        if status >= 500:
+            level = "ERROR"
+        elif status >= 400:
+            level = "WARNING"
+        else:
+            level = "INFO"
+
+        if logger.level(level).no < self.min_level:
+            return
+
+        client = scope.get("client")
+        logger.bind(
+            access=True,
+            request_id=request_id,
+            method=method,
+            path=path,
+            route=route,
+            status=status,
+            latency_ms=round(latency_ms, 2),
+            bytes_in=counters["bytes_in"],
+            bytes_out=counters["bytes_out"],
+            client=client[0] if client else None,
+            tenant=(scope.get("state") or {}).get("tenant"),
+            user=self._caller(scope, headers)
+        ).log(
+            level,
+            f"{method} {path} {status} {latency_ms:.1f}ms "
+            f"in={counters['bytes_in']} out={counters['bytes_out']} rid={request_id}"
+        )
+
+    @staticmethod
+    def _route_template(scope) -> str:
+        """匹配到的路由模板，避免指标按ID无限膨胀；未匹配任何路由（404、扫描请求）时归为同一标签"""
+        route = scope.get("route")
+        template = getattr(route, "path_format", None) or getattr(route, "path", None)
+        return template or UNMATCHED_ROUTE
+
+    @staticmethod
+    def _caller(scope, headers: dict) -> str:
+        """识别调用方：优先使用认证后的用户，其次是API Key前缀"""
+        state = scope.get("state") or {}
+        user = state.get("user")
+        if user:
+            return str(user)
+
+        api_key = headers.get("x-api-key")
+        if api_key:
+            return f"key:{api_key[:6]}***"
+
+        return "anonymous"
+
+
+class BodyTooLarge(Exception):
+    """请求体超过限制"""
+
+
+class BodySizeLimitMiddleware:
+    """
+    按路由限制请求体大小
+
+    上传接口使用文件大小上限，其余JSON接口使用较小的上限；
+    先检查Content-Length，再在读取过程中累计字节数，超限时返回413
+    """
+
+    # multipart边界和表单字段的额外开销
+    MULTIPART_OVERHEAD = 64 * 1024
+
+    def __init__(self, app):
+        self.app = app
+        self.route_limits = {
+            # 可一次上传多个文件，总大小与压缩包批量上传相同，单个文件仍按MAX_FILE_SIZE限制
+            "/api/upload": max(settings.MAX_FILE_SIZE, settings.MAX_ARCHIVE_SIZE) + self.MULTIPART_OVERHEAD,
+            "/api/upload/batch": settings.MAX_ARCHIVE_SIZE + self.MULTIPART_OVERHEAD,
+            "/api/admin/state/import": settings.MAX_ARCHIVE_SIZE + self.MULTIPART_OVERHEAD,
+        }
+        # 路径中带ID的上传接口
+        self.pattern_limits = [
+            (re.compile(r"^/api/upload/sessions/[^/]+$"), settings.MAX_FILE_SIZE + self.MULTIPART_OVERHEAD),
+        ]
+        self.default_limit = settings.MAX_JSON_BODY_SIZE
+
+    def limit_for(self, path: str) -> int:
+        """获取路径对应的请求体上限"""
+        path = path.rstrip("/") or "/"
+        if path in self.route_limits:
+            return self.route_limits[path]
+        for pattern, limit in self.pattern_limits:
+            if pattern.match(path):
+                return limit
+        return self.default_limit
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http" or scope.get("method") in ("GET", "HEAD", "OPTIONS"):
+            await self.app(scope, receive, send)
+            return
+
+        limit = self.limit_for(scope.get("path", ""))
+
+        for key, value in scope.get("headers", []):
+            if key.lower() == b"content-length":
+                try:
+                    content_length = int(value)
+                except ValueError:
+                    await self._reject(send, 400, "Content-Length无效")
+                    return
+                if content_length > limit:
+                    await self._reject(send, 413, f"请求体超过限制 ({limit} 字节)")
+                    return
+                break
+
+        state = {"received": 0, "exceeded": False, "started": False}
+
+        async def receive_wrapper():
+            message = await receive()
+            if message["type"] == "http.request":
+                state["received"] += len(message.get("body", b""))
+                if state["received"] > limit:
+                    state["exceeded"] = True
+                    raise BodyTooLarge()
+            return message
+
+        async def send_wrapper(message):
+            # 超限后应用可能把读取异常转成其他响应，统一替换为413
+            if state["exceeded"]:
+                return
+            if message["type"] == "http.response.start":
+                state["started"] = True
+            await send(message)
+
+        try:
+            await self.app(scope, receive_wrapper, send_wrapper)
+        except BodyTooLarge:
+            pass
+        finally:
+            if state["exceeded"] and not state["started"]:
+                logger.warning(f"请求体超过限制: {scope.get('path')} - {state['received']} > {limit}")
+                await self._reject(send, 413, f"请求体超过限制 ({limit} 字节)")
+
+    @staticmethod
+    async def _reject(send, status: int, detail: str) -> None:
+        await _send_json(send, status, error_payload(detail, code_for_status(status)))
+
+
+class CompressionMiddleware:
+    """
+    JSON响应压缩
+
+    按Accept-Encoding协商gzip或deflate，只压缩JSON响应且超过最小大小时才压缩，
+    PDF下载、压缩包和进度推送等其他类型的响应原样透传
+    """
+
+    # 支持的编码，按优先级排列
+    ENCODINGS = ("gzip", "deflate")
+
+    def __init__(self, app):
+        self.app = app
+
+    @classmethod
+    def negotiate(cls, accept_encoding: str) -> Optional[str]:
+        """
+        根据Accept-Encoding选择编码
+
+        Args:
+            accept_encoding: 请求头的值
+
+        Returns:
+            选中的编码，都不可接受时返回None
+        """
+        weights: Dict[str, float] = {}
+        for item in accept_encoding.split(","):
+            name, _, params = item.strip().partition(";")
+            name = name.strip().lower()
+            if not name:
+                continue
+            weight = 1.0
+            params = params.strip().lower()
+            if params.startswith("q="):
+                try:
+                    weight = float(params[2:])
+                except ValueError:
+                    weight = 0.0
+            weights[name] = weight
+
+        best = None
+        for encoding in cls.ENCODINGS:
+            weight = weights.get(encoding, weights.get("*", 0.0))
+            if weight > 0 and (best is None or weight > best[1]):
+                best = (encoding, weight)
+        return best[0] if best else None
+
+    @staticmethod
+    def compress(body: bytes, encoding: str) -> bytes:
+        """gzip使用gzip封装，deflate按HTTP规范使用zlib封装"""
+        wbits = 31 if encoding == "gzip" else 15
+        compressor = zlib.compressobj(settings.COMPRESS_LEVEL, zlib.DEFLATED, wbits)
+        return compressor.compress(body) + compressor.flush()
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http" or not settings.COMPRESS_RESPONSES or scope.get("method") == "HEAD":
+            await self.app(scope, receive, send)
+            return
+
+        accept_encoding = ""
+        for key, value in scope.get("headers", []):
+            if key.lower() == b"accept-encoding":
+                accept_encoding = value.decode("latin-1")
+                break
+        encoding = self.negotiate(accept_encoding)
+        if not encoding:
+            await self.app(scope, receive, send)
+            return
+
+        state = {"start": None, "buffering": False, "chunks": []}
+
+        async def send_wrapper(message):
+            if message["type"] == "http.response.start":
+                if self._compressible(message):
+                    # JSON响应体有限，缓存完整响应后一次压缩
+                    state["start"] = message
+                    state["buffering"] = True
+                    return
+                await send(message)
+                return
+
+            if message["type"] != "http.response.body" or not state["buffering"]:
+                await send(message)
+                return
+
+            state["chunks"].append(message.get("body", b""))
+            if message.get("more_body", False):
+                return
+
+            state["buffering"] = False
+            start = state["start"]
+            body = b"".join(state["chunks"])
+            headers = [(k, v) for k, v in start.get("headers", []) if k.lower() != b"content-length"]
+            if len(body) >= settings.COMPRESS_MIN_SIZE:
+                body = self.compress(body, encoding)
+                headers.append((b"content-encoding", encoding.encode("latin-1")))
+            headers.append((b"content-length", str(len(body)).encode("latin-1")))
+            headers.append((b"vary", b"Accept-Encoding"))
+            await send({**start, "headers": headers})
+            await send({"type": "http.response.body", "body": body})
+
+        await self.app(scope, receive, send_wrapper)
+
+    @staticmethod
+    def _compressible(message) -> bool:
+        """未编码的JSON响应才压缩"""
+        if message.get("status") in (204, 304):
+            return False
+        content_type = ""
+        for key, value in message.get("headers", []):
+            name = key.lower()
+            if name == b"content-encoding":
+                return False
+            if name == b"content-type":
+                content_type = value.decode("latin-1").split(";")[0].strip().lower()
+        return content_type == "application/json" or content_type.endswith("+json")
+
+
+class ClientIdleTimeout(Exception):
+    """客户端读写无响应超时"""
+
+
+class RequestTimeoutMiddleware:
+    """
+    按路由限制请求处理时间
+
+    JSON接口使用较短的超时，同步处理、上传和下载接口使用各自的超时（默认不限制）；
+    另外在读取请求体和写出响应时限制客户端的空闲时间，避免挂起的客户端一直占用连接。
+    处理超时返回504，读取请求体超时返回408，响应已开始后超时直接断开
+    """
+
+    # 非默认超时的接口：(方法, 路径正则, 超时配置项)
+    ROUTE_TIMEOUTS = [
+        ("POST", re.compile(r"^/api/upload(/batch)?/?$"), "UPLOAD_REQUEST_TIMEOUT"),
+        ("PUT", re.compile(r"^/api/upload/sessions/[^/]+/?$"), "UPLOAD_REQUEST_TIMEOUT"),
+        ("GET", re.compile(r"^/api/download/"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("POST", re.compile(r"^/api/download/batch/?$"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("GET", re.compile(r"^/api/shared/[^/]+/download/?$"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("GET", re.compile(r"^/api/admin/state/export/?$"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("POST", re.compile(r"^/api/admin/state/import/?$"), "UPLOAD_REQUEST_TIMEOUT"),
+        ("GET", re.compile(r"^/api/task/[^/]+/stream/?$"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("GET", re.compile(r"^/api/files/[^/]+/(attachments/download|chapters/\d+/images)/?$"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("GET", re.compile(r"^/files/"), "DOWNLOAD_REQUEST_TIMEOUT"),
+        ("POST", re.compile(r"^/api/(analyze|compare|coursepack|knowledge-graph|knowledge-points)/?$"), "PROCESSING_REQUEST_TIMEOUT"),
+        ("POST", re.compile(r"^/api/files/[^/]+/(calibrate|repair)/?$"), "PROCESSING_REQUEST_TIMEOUT"),
+        ("PUT", re.compile(r"^/api/files/[^/]+/outline/?$"), "PROCESSING_REQUEST_TIMEOUT"),
+        ("POST", re.compile(r"^/api/connectors/[^/]+/import/?$"), "PROCESSING_REQUEST_TIMEOUT"),
+        ("POST", re.compile(r"^/api/admin/(benchmark|samples)/?$"), "PROCESSING_REQUEST_TIMEOUT"),
+    ]
+
+    def __init__(self, app):
+        self.app = app
+
+    def timeout_for(self, method: str, path: str) -> int:
+        """获取接口的处理超时（秒），0表示不限制"""
+        for route_method, pattern, setting in self.ROUTE_TIMEOUTS:
+            if method == route_method and pattern.match(path):
+                return getattr(settings, setting)
+        return settings.REQUEST_TIMEOUT
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        path = scope.get("path", "")
+        timeout = self.timeout_for(scope.get("method", ""), path)
+        idle = settings.CLIENT_IDLE_TIMEOUT or None
+        state = {"body_done": False, "idle": False, "started": False}
+
+        async def receive_wrapper():
+            # 请求体读完后应用等待的是断开通知，不受空闲时间限制
+            if state["body_done"] or not idle:
+                return await receive()
+            try:
+                message = await asyncio.wait_for(receive(), idle)
+            except asyncio.TimeoutError:
+                state["idle"] = True
+                raise ClientIdleTimeout()
+            if message["type"] != "http.request" or not message.get("more_body", False):
+                state["body_done"] = True
+            return message
+
+        async def send_wrapper(message):
+            # 读取超时后应用可能把读取异常转成其他响应，统一替换为408
+            if state["idle"] and not state["started"]:
+                return
+            if message["type"] == "http.response.start":
+                state["started"] = True
+            try:
+                await asyncio.wait_for(send(message), idle)
+            except asyncio.TimeoutError:
+                state["idle"] = True
+                raise ClientIdleTimeout()
+
+        try:
+            if timeout:
+                await asyncio.wait_for(self.app(scope, receive_wrapper, send_wrapper), timeout)
+            else:
+                await self.app(scope, receive_wrapper, send_wrapper)
+        except asyncio.TimeoutError:
+            logger.warning(f"请求处理超时: {scope.get('method')} {path} - {timeout} 秒")
+            if not state["started"]:
+                await _reject(scope, send, 504, f"请求处理超时 ({timeout} 秒)")
+            return
+        except ClientIdleTimeout:
+            pass
+
+        if state["idle"]:
+            logger.warning(f"客户端无响应超时: {scope.get('method')} {path} - {idle} 秒")
+            if not state["started"]:
+                await _reject(scope, send, 408, f"读取请求体超时 ({idle} 秒无数据)")
+
+
+# 客户端在响应之前断开时访问日志记录的状态码（沿用nginx的约定）
+CLIENT_CLOSED_REQUEST = 499
+
+# 未匹配任何路由的请求在指标中的路由标签
+UNMATCHED_ROUTE = "unmatched"
+
+
+class ClientDisconnectMiddleware:
+    """
+    客户端断开时取消请求处理
+
+    在后台读取请求消息：请求体按应用的读取速度逐块转交（保持背压），读完后继续等待断开通知，
+    收到时取消处理协程，使同步处理接口中的大模型调用、OCR和Ghostscript子进程、逐章拆分等随之停止，
+    而不是在无人接收结果的情况下继续运行。响应已完整发送后的断开不做处理
+    """
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        # 容量为1，应用读取前不会预先读入更多请求体
+        messages: asyncio.Queue = asyncio.Queue(maxsize=1)
+        state = {"completed": False, "disconnected": False}
+
+        async def send_wrapper(message):
+            await send(message)
+            if message["type"] == "http.response.body" and not message.get("more_body", False):
+                state["completed"] = True
+
+        handler = asyncio.create_task(self.app(scope, messages.get, send_wrapper))
+
+        async def pump():
+            while True:
+                try:
+                    message = await receive()
+                except Exception:
+                    message = {"type": "http.disconnect"}
+                if message["type"] == "http.disconnect":
+                    state["disconnected"] = True
+                    if not state["completed"] and not handler.done():
+                        handler.cancel()
+                await messages.put(message)
+                if message["type"] == "http.disconnect":
+                    return
+
+        reader = asyncio.create_task(pump())
+        try:
+            await handler
+        except asyncio.CancelledError:
+            # 本协程被取消（如服务关闭）时处理协程随之取消，照常向上传递
+            if not state["disconnected"]:
+                raise
+            scope.setdefault("state", {})["client_disconnected"] = True
+            logger.info(f"客户端已断开，取消请求处理: {scope.get('method')} {scope.get('path', '')}")
+        finally:
+            reader.cancel()
+
+
+class UploadConcurrencyMiddleware:
+    """
+    限制同时进行的上传数
+
+    按调用方（API Key或认证用户，匿名时为客户端IP）和全局分别计数，超出时直接返回429，
+    在读取请求体之前拒绝，避免单个脚本占满磁盘I/O；需在TenantMiddleware之内注册以便识别调用方
+    """
+
+    # 上传数据的接口：(方法, 路径正则)
+    UPLOAD_ROUTES = [
+        ("POST", re.compile(r"^/api/upload(/batch)?/?$")),
+        ("PUT", re.compile(r"^/api/upload/sessions/[^/]+/?$")),
+    ]
+
+    def __init__(self, app):
+        self.app = app
+        self._active: Dict[str, int] = {}
+        self._total = 0
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] != "http" or not self._is_upload(scope.get("method", ""), scope.get("path", "")):
+            await self.app(scope, receive, send)
+            return
+
+        client = self._client(scope)
+        reason = self._acquire(client)
+        if reason:
+            logger.warning(f"并发上传超过限制: {client} - {reason}")
+            await _reject(scope, send, 429, reason, extra_headers=[(b"retry-after", b"5")])
+            return
+
+        try:
+            await self.app(scope, receive, send)
+        finally:
+            self._release(client)
+
+    def _is_upload(self, method: str, path: str) -> bool:
+        return any(method == route_method and pattern.match(path) for route_method, pattern in self.UPLOAD_ROUTES)
+
+    @staticmethod
+    def _client(scope) -> str:
+        """有凭据时按调用方计数，否则按客户端IP"""
+        state = scope.get("state") or {}
+        principal: Optional[Principal] = state.get("principal")
+        if principal and principal.key_id:
+            return f"key:{principal.tenant_id}/{principal.key_id}"
+        if principal and principal.user != "anonymous":
+            return f"user:{principal.tenant_id}/{principal.user}"
+        client = scope.get("client")
+        return f"ip:{client[0]}" if client else "ip:unknown"
+
+    def _acquire(self, client: str) -> Optional[str]:
+        """
+        占用上传名额
+
+        Returns:
+            超出限制时返回原因，否则为None
+        """
+        if settings.MAX_CONCURRENT_UPLOADS > 0 and self._total >= settings.MAX_CONCURRENT_UPLOADS:
+            return f"服务器同时进行的上传已达上限 ({settings.MAX_CONCURRENT_UPLOADS} 个)，请稍后重试"
+        active = self._active.get(client, 0)
+        limit = settings.MAX_CONCURRENT_UPLOADS_PER_CLIENT
+        if limit > 0 and active >= limit:
+            return f"同时进行的上传已达上限 ({limit} 个)，请等待之前的上传完成"
+
+        self._active[client] = active + 1
+        self._total += 1
+        return None
+
+    def _release(self, client: str) -> None:
+        self._total -= 1
+        remaining = self._active.get(client, 1) - 1
+        if remaining > 0:
+            self._active[client] = remaining
+        else:
+            self._active.pop(client, None)
+
+
+class TenantMiddleware:
+    """
+    多租户中间件
+
+    按请求头（默认X-Tenant-ID）或子域名识别租户，根据API Key或OIDC令牌识别调用方并按租户限流，
+    识别结果写入上下文，后续的存储路径、配额和任务都按租户隔离
+    """
+
+    def __init__(self, app):
+        self.app = app
+        self.header = settings.TENANT_HEADER.lower()
+        self.subdomain_base = settings.TENANT_SUBDOMAIN_BASE.lower().strip(".")
+        # 固定窗口计数：tenant 或 tenant/key_id -> (窗口起始分钟, 请求数)
+        self._windows: Dict[str, Tuple[int, int]] = {}
+
+    async def __call__(self, scope, receive, send):
+        # WebSocket（GraphQL订阅）与HTTP请求使用相同的租户识别和认证
+        if scope["type"] not in ("http", "websocket"):
+            await self.app(scope, receive, send)
+            return
+
+        headers = {k.decode("latin-1").lower(): v.decode("latin-1") for k, v in scope.get("headers", [])}
+        tenant_id = self._resolve(headers)
+
+        if not TENANT_ID_PATTERN.match(tenant_id) or not is_known_tenant(tenant_id):
+            await _reject(scope, send, 404, f"租户不存在: {tenant_id}")
+            return
+
+        # 凭据无效时调用方为空，由RBACMiddleware按路由决定是否拒绝
+        authorization = headers.get("authorization", "")
+        if oidc_provider.enabled and authorization.lower().startswith("bearer "):
+            principal = await oidc_provider.authenticate(tenant_id, authorization[7:].strip())
+        else:
+            try:
+                principal = await authenticate(tenant_id, headers.get("x-api-key", ""))
+            except UnavailableError as e:
+                # 无法确认身份时拒绝需要认证的请求，公开路由（健康检查等）按未认证继续
+                if required_role(scope.get("method", "GET"), scope.get("path", "")) is not None:
+                    await _reject(scope, send, 503, e.message)
+                    return
+                principal = None
+        state = scope.setdefault("state", {})
+        state["tenant"] = tenant_id
+        state["principal"] = principal
+        if principal:
+            state["user"] = principal.user
+
+        # 只对业务接口限流，健康检查、文档和跨域预检保持开放
+        if scope.get("path", "").startswith("/api") and scope.get("method") != "OPTIONS":
+            retry_after = self._check_rate_limit(tenant_id, principal)
+            if retry_after:
+                await _reject(
+                    scope, send, 429, "请求过于频繁，请稍后重试",
+                    extra_headers=[(b"retry-after", str(retry_after).encode("latin-1"))]
+                )
+                return
+
+        with use_tenant(tenant_id):
+            if principal:
+                with use_principal(principal):
+                    await self.app(scope, receive, send)
+            else:
+                await self.app(scope, receive, send)
+
+    def _resolve(self, headers: dict) -> str:
+        """请求头优先，其次是子域名，都没有时使用默认租户"""
+        tenant_id = headers.get(self.header, "").strip().lower()
+        if tenant_id:
+            return tenant_id
+
+        if self.subdomain_base:
+            host = headers.get("host", "").split(":")[0].lower()
+            suffix = "." + self.subdomain_base
+            if host.endswith(suffix):
+                subdomain = host[:-len(suffix)]
+                if subdomain and "." not in subdomain:
+                    return subdomain
+
+        return settings.DEFAULT_TENANT
+
+    def _check_rate_limit(self, tenant_id: str, principal: Optional[Principal] = None) -> int:
+        """
+        固定窗口限流，单独设置了限额的Key使用自己的窗口，其余请求共享租户窗口
+
+        Returns:
+            超限时返回需等待的秒数，未超限返回0
+        """
+        limit = effective_rate_limit(principal, tenant_id)
+        if limit <= 0:
+            return 0
+
+        bucket = tenant_id
+        if principal and principal.key_id and principal.rate_limit_per_minute is not None:
+            bucket = f"{tenant_id}/{principal.key_id}"
+
+        now = time.time()
+        window = int(now // 60)
+        start, count = self._windows.get(bucket, (window, 0))
+        if start != window:
+            start, count = window, 0
+
+        if count >= limit:
+            return max(1, int((window + 1) * 60 - now))
+
+        self._windows[bucket] = (start, count + 1)
+        return 0
+
+
+# 访问规则：(方法集合，为空表示任意方法; 路径正则; 所需角色，为空表示公开)，按顺序匹配第一条
+ACCESS_RULES: List[Tuple[Optional[Set[str]], Pattern, Optional[Role]]] = [
+    # 全局配置、指标和基准测试涉及所有租户和整个副本，只对运维开放
+    (None, re.compile(r"^/metrics$"), Role.OPERATOR),
+    (None, re.compile(r"^/api/admin/(config|benchmark)/?$"), Role.OPERATOR),
+    (None, re.compile(r"^/api/admin(/|$)"), Role.ADMIN),
+    # OAuth回调由浏览器跳转发起，不带API Key，依靠state校验
+    ({"GET"}, re.compile(r"^/api/connectors/[^/]+/callback$"), None),
+    # SSO登录入口和回调发生在取得令牌之前
+    ({"GET"}, re.compile(r"^/api/auth/oidc/(login|callback)$"), None),
+    # 分享链接以令牌授权，接收方不持有API Key
+    ({"GET"}, re.compile(r"^/api/shared/[^/]+(/download)?$"), None),
+    ({"POST"}, re.compile(r"^/api/download/batch$"), Role.VIEWER),
+    # GraphQL查询对viewer开放，变更操作在解析器中要求editor
+    (None, re.compile(r"^/api/graphql$"), Role.VIEWER),
+    # Agent工具调用按工具在处理函数中校验角色
+    ({"POST"}, re.compile(r"^/api/(mcp|tools/[^/]+)$"), Role.VIEWER),
+    ({"GET", "HEAD"}, re.compile(r"^/(api|files)/"), Role.VIEWER),
+    (None, re.compile(r"^/(api|files)/"), Role.EDITOR),
+]
+
+
+def required_role(method: str, path: str) -> Optional[Role]:
+    """
+    获取访问路径所需的角色
+
+    Args:
+        method: 请求方法
+        path: 请求路径
+
+    Returns:
+        所需角色，公开路径返回None
+    """
+    if method == "OPTIONS":
+        return None
+    for methods, pattern, role in ACCESS_RULES:
+        if (methods is None or method in methods) and pattern.match(path):
+            return role
+    return None
+
+
+class RBACMiddleware:
+    """
+    基于角色的访问控制中间件
+
+    viewer只能查看和下载，editor可上传、分析和拆分，admin可访问本租户的统计、策略、审计记录等管理接口，
+    operator另可访问全局配置、指标和基准测试；修改操作（包括被拒绝的）写入审计记录；
+    需在TenantMiddleware之内注册，以便读取已识别的调用方
+    """
+
+    def __init__(self, app):
+        self.app = app
+
+    async def __call__(self, scope, receive, send):
+        if scope["type"] not in ("http", "websocket"):
+            await self.app(scope, receive, send)
+            return
+
+        method = scope.get("method", "GET")
+        path = scope.get("path", "")
+        if scope["type"] != "http" or not audit_service.should_record(method, path):
+            await self._authorize(scope, receive, send)
+            return
+
+        result = {"status": 500}
+
+        async def send_wrapper(message):
+            if message["type"] == "http.response.start":
+                result["status"] = message["status"]
+            await send(message)
+
+        try:
+            await self._authorize(scope, receive, send_wrapper)
+        finally:
+            state = scope.get("state") or {}
+            await audit_service.record(method, path, result["status"], state.get("principal"), state.get("request_id"))
+
+    async def _authorize(self, scope, receive, send):
+        # WebSocket握手没有请求方法，按GET处理
+        role = required_role(scope.get("method", "GET"), scope.get("path", ""))
+        if role is not None:
+            principal = (scope.get("state") or {}).get("principal")
+            if principal is None:
+                await _reject(scope, send, 401, "未认证或凭据无效")
+                return
+            if not has_role(principal, role):
+                await _reject(scope, send, 403, f"权限不足，需要{role.value}角色")
+                return
+
+        await self.app(scope, receive, send)
+
+
+async def _reject(scope, send, status: int, detail: str, extra_headers: Optional[list] = None) -> None:
+    """拒绝请求：HTTP返回JSON错误，WebSocket在握手阶段直接关闭连接"""
+    if scope["type"] == "websocket":
+        await send({"type": "websocket.close", "code": 1008, "reason": detail})
+        return
+    await _send_json(send, status, error_payload(detail, code_for_status(status)), extra_headers)
+
+
+async def _send_json(send, status: int, payload: dict, extra_headers: Optional[list] = None) -> None:
+    """直接在中间件中返回JSON响应"""
+    body = json.dumps(payload, ensure_ascii=False).encode("utf-8")
+    await send({
+        "type": "http.response.start",
+        "status": status,
+        "headers": [
+            (b"content-type", b"application/json"),
+            (b"content-length", str(len(body)).encode("latin-1")),
+        ] + (extra_headers or []),
+    })
+    await send({"type": "http.response.body", "body": body})
@@ -3,12 +3,22 @@ API路由定义
 """
 
 import os
-from typing import List
-from fastapi import APIRouter, HTTPException, UploadFile, File, Depends
-from fastapi.responses import FileResponse
+import re
+import json
+import asyncio
+import mimetypes
+from datetime import datetime
+from email.utils import formatdate, parsedate_to_datetime
+from pathlib import Path
+from urllib.parse import quote
+from typing import List, Optional, Tuple, Union
+from fastapi import APIRouter, HTTPException, UploadFile, File, Form, Header, Depends, Request
+from fastapi.responses import FileResponse, RedirectResponse, Response, StreamingResponse
 from loguru import logger
+from starlette.background import BackgroundTask
 
 from ..models.schemas import (
+    TASK_PRIVATE_FIELDS,
     UploadResponse, 
     AnalyzeRequest, 
     AnalyzeResponse,
@@ -19,50 +29,230 @@ from ..models.schemas import (
     KnowledgePointRequest,
     KnowledgePointResponse,
     GraphNodeResponse,
-    GraphEdgeResponse
+    GraphEdgeResponse,
+    SplitRequest,
+    SplitStrategy,
+    SplitResponse,
+    SplitTask,
+    TaskStatus,
+    TaskEventsResponse,
+    PageNumbering,
+    CalibrationRequest,
+    CalibrationResponse,
+    AsyncAnalyzeResponse,
+    BatchUploadResponse,
+    FileSummary,
+    TagsRequest,
+    TagCount,
+    UploadResult,
+    BatchUploadError,
+    OutputManifest,
+    ArchiveFormat,
+    BenchmarkRequest,
+    BenchmarkResponse,
+    ReportFormat,
+    BatchDownloadRequest,
+    ConnectorProvider,
+    ConnectorStatus,
+    ConnectorAuthorizeResponse,
+    ConnectorFile,
+    ConnectorImportRequest,
+    ApiKeyCreateRequest,
+    ApiKeyInfo,
+    ApiKeySecretResponse,
+    AuditLogResponse,
+    OIDCLoginResponse,
+    OIDCTokenResponse,
+    CurrentUserResponse,
+    WebhookDeliveriesResponse,
+    WebhookDelivery,
+    WebhookDeliveryStatus,
+    SplitPreset,
+    SplitPresetRequest,
+    ProcessingPolicy,
+    SaveChaptersRequest,
+    SavedChapters,
+    Outline,
+    OutlineUpdateRequest,
+    OutlineUpdateResponse,
+    ChapterDiffRequest,
+    ChapterDiffResponse,
+    CompareRequest,
+    CoursePackRequest,
+    SamplePdfRequest,
+    SamplePdfResponse,
+    CompareResponse,
+    AttachmentInfo,
+    RepairResponse,
+    SignatureHandling,
+    SigningMode,
+    FileInfo,
+    TaskType,
+    CompletedSplit,
+    DuplicateUpload,
+    UploadSession,
+    UploadSessionRequest,
+    UploadSessionStatus,
+    UploadFinalizeRequest,
+    StateImportResponse,
+    ResponseWarning,
+    WarningCode,
+    ShareLink,
+    ShareLinkRequest,
+    ShareLinkSecretResponse,
+    SharedFilesResponse,
+    FileStatus
 )
-from ..services.file_service import FileService
+from ..services.file_service import FileService, UploadPart
+from ..services.document_title import citation, display_name
 from ..services.pdf_analyzer import PDFAnalyzer
 from ..services.knowledge_graph_service import KnowledgeGraphService
+from ..services.task_service import TaskService
+from ..services.notification_service import notification_service
+from ..services.webhook_service import webhook_service
+from ..services.audit_service import audit_service
+from ..services.analysis_cache import analysis_cache
+from ..core.document_cache import document_cache
+from ..core.errors import DomainError, QuotaExceededError, code_for_exception, code_for_status
+from ..services.analysis_service import AnalysisService
+from ..services.archive_service import archive_service, ARCHIVE_MEDIA_TYPES
+from ..services.delivery_service import delivery_service
+from ..services.connector_service import connector_service
+from ..services.output_store import output_store
+from ..services.preset_service import preset_service
+from ..services.policy_service import policy_service
+from ..services.pdf_splitter import MANIFEST_FILENAME, excluded_page_numbers, validate_filename_template
+from ..services.chapter_diff import compare_editions, diff_chapters
+from ..services.image_extractor import image_extractor
+from ..services.attachment_service import attachment_service
+from ..services.redaction import validate_redactions
+from ..services.stamping import validate_page_number_format
+from ..services.pdfa import pdfa_converter
+from ..services.ghostscript import ghostscript_available
+from ..services.tesseract import tesseract_available
+from ..services.signatures import signature_warnings
+from ..services.signing_service import signing_service
+from ..services.upload_session_service import upload_session_service
+from ..services.state_service import state_service
+from ..services.share_link_service import share_link_service
+from ..services.outline_service import OUTLINE_FILENAME_PREFIX, outline_service
+from ..services.coursepack_service import CoursePackPart, coursepack_service
+from ..services.sample_service import sample_service
+from ..services.task_report import task_report_service
+from ..services.task_state import is_finished
+from ..services.benchmark import benchmark_service
 from ..core.config import settings
+from ..core.form_stream import parse_multipart
+from ..core.tenancy import file_storage_dir, get_current_tenant, get_tenant_quota_bytes, is_ephemeral_file, use_tenant
+from ..core.auth import effective_quota_bytes, get_current_principal, has_role
+from ..core.oidc import oidc_provider, OIDCError
+from ..core.api_keys import api_key_store
+from ..core.memory import memory_budget
 
 
 router = APIRouter()
 
+# 客户端提供的SHA-256校验和格式
+SHA256_PATTERN = re.compile(r"^[0-9a-f]{64}$")
+
 # 服务实例
 file_service = FileService()
 pdf_analyzer = PDFAnalyzer()
 knowledge_graph_service = KnowledgeGraphService()
+task_service = TaskService()
+analysis_service = AnalysisService()
+
+
+# 上传接口自行流式解析请求体，表单结构在此声明供OpenAPI文档使用
+UPLOAD_FORM_SCHEMA = {
+    "requestBody": {
+        "required": True,
+        "content": {
+            "multipart/form-data": {
+                "schema": {
+                    "type": "object",
+                    "properties": {
+                        "file": {"type": "string", "format": "binary", "description": "PDF文件"},
+                        "files": {
+                            "type": "array",
+                            "items": {"type": "string", "format": "binary"},
+                            "description": "一次上传多个PDF文件，不能与file同时使用"
+                        },
+                        "sha256": {"type": "string", "description": "客户端计算的SHA-256（仅用于file）"},
+                        "ephemeral": {"type": "boolean", "default": False, "description": "隐私模式"}
+                    }
+                }
+            }
+        }
+    }
+}
 
 
-@router.post("/upload", response_model=UploadResponse)
-async def upload_file(file: UploadFile = File(...)):
+@router.post("/upload", response_model=Union[UploadResponse, List[UploadResult]], openapi_extra=UPLOAD_FORM_SCHEMA)
+async def upload_file(
+    request: Request,
+    x_content_sha256: Optional[str] = Header(None, alias="X-Content-SHA256")
+):
     """
-    上传PDF文件
+    上传PDF文件，请求体边接收边写入最终位置并计算哈希
     
-    Args:
+    表单字段：
         file: 上传的PDF文件
+        files: 一次上传多个PDF文件（重复该字段，不能与file同时使用），返回每个文件的结果列表，
+            单个文件失败不影响其他文件
+        sha256: 客户端计算的SHA-256，与请求头X-Content-SHA256二选一，仅用于file字段
+        ephemeral: 隐私模式，文件只保存在临时目录、不进入文件列表，打包下载一次或超时后删除
+    
+    Args:
+        request: 请求
+        x_content_sha256: 客户端计算的SHA-256（请求头）
         
     Returns:
-        上传结果
+        上传结果；使用files字段时为每个文件的结果列表
     """
+    upload = None
+    parts: List[UploadPart] = []
     try:
-        logger.info(f"接收文件上传请求: {file.filename}")
+        # 请求体大小包含表单开销，略大于文件本身
+        await _enforce_storage_quota(int(request.headers.get("content-length") or 0))
+        
+        def open_file(name: str, filename: str, fields: dict):
+            nonlocal upload
+            if name == "files" and upload is None:
+                logger.info(f"接收多文件上传请求: {filename}")
+                parts.append(UploadPart(file_service, filename, _form_bool(fields.get("ephemeral"), "ephemeral")))
+                return parts[-1]
+            if name != "file" or parts:
+                raise HTTPException(status_code=400, detail=f"文件应通过file字段上传，或通过多个files字段一次上传多个文件，收到 {name}")
+            if upload is not None:
+                raise HTTPException(status_code=400, detail="file字段只能上传一个文件，多个文件请使用files字段")
+            logger.info(f"接收文件上传请求: {filename}")
+            # 隐私模式字段通常在文件之前，之后才出现时由finish_upload移动到对应位置
+            upload = file_service.begin_upload(filename, _form_bool(fields.get("ephemeral"), "ephemeral"))
+            return upload.writer
+        
+        fields = await parse_multipart(request, open_file, max_files=settings.MAX_UPLOAD_FILES)
+        if parts:
+            if fields.get("sha256") or x_content_sha256:
+                raise HTTPException(status_code=400, detail="一次上传多个文件时不支持sha256校验")
+            return await _finish_upload_parts(parts, _form_bool(fields.get("ephemeral"), "ephemeral"))
+        if upload is None:
+            raise HTTPException(status_code=400, detail="缺少上传文件")
+        expected_sha256 = _expected_checksum(fields.get("sha256"), x_content_sha256)
         
         # 保存文件
-        file_info = await file_service.save_uploaded_file(file)
-        
-        response = UploadResponse(
-            file_id=file_info.file_id,
-            filename=file_info.filename,
-            file_size=file_info.file_size,
-            message="文件上传成功"
+        pending, upload = upload, None
+        file_info = await file_service.finish_upload(
+            pending, expected_sha256, _form_bool(fields.get("ephemeral"), "ephemeral")
         )
         
+        response = await _upload_response(file_info, "文件上传成功")
+        
         logger.info(f"文件上传成功: {file_info.file_id}")
+        await _check_storage_quota()
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"文件上传失败: {str(e)}")
@@ -70,188 +260,2335 @@ async def upload_file(file: UploadFile = File(...)):
             status_code=500,
             detail=f"文件上传失败: {str(e)}"
         )
+    finally:
+        # 出错或客户端断开（请求被取消）时删除已写入的数据，已完成的上传不受影响
+        file_service.abort_upload(upload)
+        for part in parts:
+            part.abort()
 
 
-@router.post("/analyze", response_model=AnalyzeResponse)
-async def analyze_chapters(request: AnalyzeRequest):
+async def _finish_upload_parts(parts: List[UploadPart], ephemeral: bool) -> List[UploadResult]:
+    """逐个完成多文件上传，单个文件失败时记录原因并继续"""
+    results = []
+    for part in parts:
+        error = part.error
+        if error is None:
+            pending, part.upload = part.upload, None
+            try:
+                file_info = await file_service.finish_upload(pending, None, ephemeral)
+                results.append(UploadResult(
+                    filename=part.filename,
+                    success=True,
+                    file=await _upload_response(file_info, "文件上传成功")
+                ))
+                continue
+            except (HTTPException, DomainError) as e:
+                error = e
+            except Exception as e:
+                logger.error(f"文件上传失败: {part.filename} - {str(e)}")
+                error = e
+        
+        if isinstance(error, HTTPException):
+            detail, code = str(error.detail), code_for_status(error.status_code)
+        else:
+            detail, code = str(error), code_for_exception(error)
+        results.append(UploadResult(filename=part.filename, success=False, error=detail, code=code))
+    
+    succeeded = sum(1 for result in results if result.success)
+    logger.info(f"多文件上传完成: 成功 {succeeded} 个，失败 {len(results) - succeeded} 个")
+    if succeeded:
+        await _check_storage_quota()
+    return results
+
+
+@router.post("/upload/batch", response_model=BatchUploadResponse)
+async def upload_batch(file: UploadFile = File(...)):
     """
-    分析PDF章节结构
+    批量上传ZIP压缩包中的PDF文件
     
     Args:
-        request: 分析请求
+        file: 包含PDF文件的ZIP压缩包
         
     Returns:
-        章节分析结果
+        批量上传结果
     """
     try:
-        logger.info(f"接收章节分析请求: {request.file_id}")
+        logger.info(f"接收批量上传请求: {file.filename}")
         
-        # 获取文件路径
-        file_path = await file_service.get_file_path(request.file_id)
-        if not file_path:
-            raise HTTPException(
-                status_code=404,
-                detail="文件不存在"
-            )
+        remaining = await _enforce_storage_quota(file.size or 0)
+        saved, failed = await file_service.save_uploaded_archive(file, remaining)
+        
+        response = BatchUploadResponse(
+            files=[await _upload_response(file_info, "文件上传成功") for file_info in saved],
+            failed=[BatchUploadError(entry=entry, error=error) for entry, error in failed],
+            message=f"成功上传 {len(saved)} 个文件，失败 {len(failed)} 个"
+        )
+        
+        await _check_storage_quota()
+        return response
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"批量上传失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"批量上传失败: {str(e)}"
+        )
+
+
+@router.post("/upload/sessions", response_model=UploadSession)
+async def create_upload_session(request: UploadSessionRequest):
+    """
+    创建分段上传会话
+    
+    Args:
+        request: 文件名和可选的文件大小
         
-        # 执行章节分析
-        chapters, pdf_metadata = await pdf_analyzer.analyze_pdf(file_path, request.file_id)
+    Returns:
+        上传会话，数据通过 PUT /upload/sessions/{session_id} 上传
+    """
+    try:
+        await _enforce_storage_quota(request.size or 0)
+        return await upload_session_service.create(request.filename, request.size)
         
-        # 更新文件状态
-        await file_service.update_file_status(request.file_id, "analyzed")
+    except DomainError:
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"创建上传会话失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"创建上传会话失败: {str(e)}"
+        )
+
+
+@router.get("/upload/sessions/{session_id}", response_model=UploadSession)
+async def get_upload_session(session_id: str):
+    """
+    查询上传会话状态
+    
+    Args:
+        session_id: 会话ID
         
-        # 生成备选建议（如果需要）
-        suggestions = None
-        if len(chapters) == 0:
-            suggestions = pdf_analyzer._generate_default_chapters(pdf_metadata.total_pages)
+    Returns:
+        上传会话
+    """
+    session = await upload_session_service.get(session_id)
+    if not session:
+        raise HTTPException(status_code=404, detail="上传会话不存在或已过期")
+    return session
+
+
+@router.put("/upload/sessions/{session_id}", response_model=UploadSession)
+async def upload_session_data(session_id: str, request: Request, offset: int = 0):
+    """
+    上传会话数据，请求体直接写入会话的临时文件；offset为0时覆盖之前的数据，
+    等于已接收的字节数时追加，大文件可分多次上传，中断后从已接收的位置继续
+    
+    Args:
+        session_id: 会话ID
+        request: 请求体为文件数据
+        offset: 写入位置
         
-        response = AnalyzeResponse(
-            success=True,
-            chapters=chapters,
-            total_pages=pdf_metadata.total_pages,
-            message=f"成功识别 {len(chapters)} 个章节",
-            suggestions=suggestions
+    Returns:
+        更新后的会话（含已接收的字节数和服务端计算的SHA-256）
+    """
+    try:
+        session = await upload_session_service.write(session_id, request.stream(), offset)
+        if not session:
+            raise HTTPException(status_code=404, detail="上传会话不存在或已过期")
+        return session
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"上传会话数据失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"上传会话数据失败: {str(e)}"
+        )
+
+
+@router.post("/upload/sessions/{session_id}/finalize", response_model=UploadResponse)
+async def finalize_upload_session(session_id: str, request: UploadFinalizeRequest):
+    """
+    校验校验和并完成上传，临时文件原地移动为正式文件，之后才可用于分析和拆分；重复请求返回同一文件
+    
+    Args:
+        session_id: 会话ID
+        request: 客户端计算的SHA-256
+        
+    Returns:
+        上传结果
+    """
+    try:
+        session = await upload_session_service.get(session_id)
+        if not session:
+            raise HTTPException(status_code=404, detail="上传会话不存在或已过期")
+        
+        if session.status == UploadSessionStatus.FINALIZED:
+            file_info = await file_service.get_file_info(session.file_id)
+            if not file_info:
+                raise HTTPException(status_code=404, detail="文件不存在")
+            return await _upload_response(file_info, "文件上传已完成")
+        
+        try:
+            part_path = await upload_session_service.verify(session, request.sha256)
+        except ValueError as e:
+            raise HTTPException(status_code=400, detail=str(e))
+        
+        await _enforce_storage_quota(session.received_bytes)
+        file_info = await file_service.adopt_pdf(
+            part_path, session.filename, session.received_bytes, session.sha256
         )
+        await upload_session_service.complete(session, file_info.file_id)
         
-        logger.info(f"章节分析完成: {request.file_id} - {len(chapters)} 个章节")
+        response = await _upload_response(file_info, "文件上传成功")
+        await _check_storage_quota()
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
-        logger.error(f"章节分析失败: {str(e)}")
+        logger.error(f"完成上传会话失败: {str(e)}")
         raise HTTPException(
             status_code=500,
-            detail=f"章节分析失败: {str(e)}"
+            detail=f"完成上传会话失败: {str(e)}"
         )
 
 
+def _form_bool(value: Optional[str], name: str) -> bool:
+    """解析表单中的布尔字段，缺省为False"""
+    if value is None:
+        return False
+    value = value.strip().lower()
+    if value in ("1", "true", "yes", "on"):
+        return True
+    if value in ("", "0", "false", "no", "off"):
+        return False
+    raise HTTPException(status_code=400, detail=f"表单字段{name}应为布尔值")
+
+
+def _expected_checksum(field: Optional[str], header: Optional[str]) -> Optional[str]:
+    """校验并合并客户端通过表单字段或请求头提供的SHA-256"""
+    values = {value.strip().lower() for value in (field, header) if value and value.strip()}
+    if not values:
+        return None
+    if len(values) > 1:
+        raise HTTPException(status_code=400, detail="表单字段sha256与请求头X-Content-SHA256不一致")
+    
+    checksum = values.pop()
+    if not SHA256_PATTERN.match(checksum):
+        raise HTTPException(status_code=400, detail="SHA-256校验和格式无效，应为64位十六进制")
+    return checksum
+
+
+async def _enforce_storage_quota(incoming_bytes: int = 0) -> Optional[int]:
+    """
+    写入新文件前检查存储配额，已用尽或加上即将写入的大小后超出时拒绝
+    
+    Args:
+        incoming_bytes: 即将写入的字节数，未知时为0，只在配额已用尽时拒绝
+        
+    Returns:
+        剩余配额（字节），未设置配额时为None
+        
+    Raises:
+        QuotaExceededError: 配额不足
+    """
+    remaining = None
+    for scope, quota_bytes, used in await _storage_quotas():
+        if used >= quota_bytes or used + incoming_bytes > quota_bytes:
+            raise QuotaExceededError(
+                f"存储配额不足：{scope}已使用 {used}/{quota_bytes} 字节"
+                + (f"，本次需要 {incoming_bytes} 字节" if incoming_bytes else "")
+            )
+        remaining = quota_bytes - used if remaining is None else min(remaining, quota_bytes - used)
+    return remaining
 
 
+async def _storage_quotas() -> List[Tuple[str, int, int]]:
+    """
+    当前调用方适用的存储配额
+    
+    Returns:
+        (范围, 配额, 已用字节数)列表：租户配额按租户用量统计，Key单独设置的配额按该Key上传的文件统计
+    """
+    quotas = []
+    tenant_quota = get_tenant_quota_bytes()
+    if tenant_quota > 0:
+        quotas.append(("租户", tenant_quota, await file_service.get_storage_usage()))
+    principal = get_current_principal()
+    if principal.key_id and principal.quota_bytes:
+        quotas.append(("API Key", effective_quota_bytes(principal), await file_service.get_storage_usage(principal.key_id)))
+    return quotas
 
 
+async def _check_storage_quota() -> None:
+    """当前租户或调用方Key的存储用量超过预警阈值时发送配额预警"""
+    try:
+        tenant_id = get_current_tenant()
+        for scope, quota_bytes, used in await _storage_quotas():
+            ratio = used / quota_bytes
+            if ratio >= settings.QUOTA_WARNING_RATIO:
+                await notification_service.notify_quota_warning(
+                    f"租户 {tenant_id} 的{scope}存储已使用 {ratio:.0%}（{used}/{quota_bytes} 字节）",
+                    used_bytes=used,
+                    quota_bytes=quota_bytes,
+                    tenant_id=tenant_id
+                )
+                break
+    except Exception as e:
+        logger.error(f"检查存储配额失败: {str(e)}")
 
 
+async def _upload_response(file_info: FileInfo, message: str) -> UploadResponse:
+    """构造上传响应，内容与已有文件相同时附带已有文件的分析结果和拆分任务"""
+    response = UploadResponse(
+        file_id=file_info.file_id,
+        filename=file_info.filename,
+        display_name=display_name(file_info),
+        file_size=file_info.file_size,
+        message=message,
+        warnings=signature_warnings(file_info.signature_count),
+        collection=file_info.collection
+    )
+    if file_info.repaired:
+        response.warnings.append(ResponseWarning(
+            code=WarningCode.FILE_REPAIRED,
+            message="文件已损坏，分析和拆分将使用修复后的副本",
+            details={"file_id": file_info.file_id}
+        ))
+    if is_ephemeral_file(file_info.file_id):
+        response.ephemeral = True
+        response.expires_at = file_info.original_expires_at
+    if file_info.deduplicated:
+        response.message = "文件已存在，返回已有文件及其处理结果"
+        response.duplicate = await _duplicate_upload(file_info)
+    return response
 
 
+async def _duplicate_upload(file_info: FileInfo) -> DuplicateUpload:
+    """汇总已有文件的最近分析结果、已完成的拆分任务和打包下载地址"""
+    analysis = None
+    cached = analysis_cache.latest(file_info.file_id)
+    if cached:
+        try:
+            analysis = AnalyzeResponse(**cached)
+        except Exception as e:
+            logger.warning(f"读取已有分析结果失败: {file_info.file_id} - {str(e)}")
+    
+    tasks = [
+        task for task in await task_service.list_tasks(file_info.file_id)
+        if task.task_type == TaskType.SPLIT and task.status == TaskStatus.COMPLETED
+    ]
+    tasks.sort(key=lambda task: task.completed_at or task.created_at, reverse=True)
+    
+    return DuplicateUpload(
+        uploaded_at=file_info.upload_time,
+        analysis=analysis,
+        completed_tasks=[
+            CompletedSplit(task_id=task.task_id, completed_at=task.completed_at, download_links=task.download_links)
+            for task in tasks
+        ],
+        archive_url=f"/api/download/{quote(file_info.file_id)}/archive" if tasks else None
+    )
 
 
+async def _apply_preset(request) -> None:
+    """按preset_id合并预设选项，预设不存在时返回404"""
+    if not request.preset_id:
+        return
+    preset = await preset_service.get(request.preset_id)
+    if not preset:
+        raise HTTPException(status_code=404, detail="预设不存在")
+    preset_service.apply(preset, request)
 
 
-@router.post("/validate-chapters")
-async def validate_chapters(chapters: List[dict], total_pages: int):
+@router.post("/analyze", response_model=AnalyzeResponse)
+async def analyze_chapters(request: AnalyzeRequest):
     """
-    验证章节信息
+    分析PDF章节结构
     
     Args:
-        chapters: 章节列表
-        total_pages: 总页数
+        request: 分析请求
         
     Returns:
-        验证结果
+        章节分析结果
     """
     try:
-        # 转换为ChapterInfo对象
-        chapter_infos = [ChapterInfo(**chapter) for chapter in chapters]
+        logger.info(f"接收章节分析请求: {request.file_id}")
+        await _apply_preset(request)
         
-        # 执行验证
-        result = pdf_analyzer.validate_chapters_detailed(chapter_infos, total_pages)
+        # 获取文件路径
+        file_path = await file_service.get_file_path(request.file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
         
-        return result
+        response = await analysis_service.analyze(request, file_path)
+        
+        return response
         
+    except (HTTPException, DomainError):
+        raise
     except Exception as e:
-        logger.error(f"章节验证失败: {str(e)}")
+        logger.error(f"章节分析失败: {str(e)}")
         raise HTTPException(
             status_code=500,
-            detail=f"章节验证失败: {str(e)}"
+            detail=f"章节分析失败: {str(e)}"
         )
 
 
-@router.get("/pdf-info/{file_id}")
-async def get_pdf_info(file_id: str):
+@router.post("/analyze/async", response_model=AsyncAnalyzeResponse)
+async def analyze_chapters_async(request: AnalyzeRequest):
     """
-    获取PDF文件信息
+    异步分析PDF章节结构（适用于超大文档或需要OCR的文档）
     
     Args:
-        file_id: 文件ID
+        request: 分析请求
         
     Returns:
-        PDF文件信息
+        分析任务信息，结果通过 /api/task/{task_id} 获取
     """
     try:
-        file_path = await file_service.get_file_path(file_id)
+        logger.info(f"接收异步章节分析请求: {request.file_id}")
+        await _apply_preset(request)
         
+        file_path = await file_service.get_file_path(request.file_id)
         if not file_path:
             raise HTTPException(
                 status_code=404,
                 detail="文件不存在"
             )
         
-        # 获取文件信息
-        file_info = await file_service.get_file_info(file_id)
+        task = await task_service.create_analysis_task(request)
         
-        return {
-            "file_id": file_id,
-            "filename": file_info.filename if file_info else "unknown.pdf",
-            "file_size": file_info.file_size if file_info else 0,
-            "upload_time": file_info.upload_time if file_info else None,
-            "status": file_info.status if file_info else "unknown"
-        }
+        return AsyncAnalyzeResponse(
+            task_id=task.task_id,
+            status=task.status,
+            message="分析任务已创建"
+        )
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
-        logger.error(f"获取PDF信息失败: {str(e)}")
+        logger.error(f"创建分析任务失败: {str(e)}")
         raise HTTPException(
             status_code=500,
-            detail=f"获取PDF信息失败: {str(e)}"
+            detail=f"创建分析任务失败: {str(e)}"
         )
 
 
-@router.delete("/files/{file_id}")
-async def delete_file(file_id: str):
+async def _prepare_split_chapters(request: SplitRequest, file_path: str):
     """
-    删除文件
+    将拆分请求中的章节换算为可直接拆分的物理页范围
+    
+    依次完成章节来源选择（请求中的章节或书签）、页码体系换算、输出章节选择、边界自动修正、章节分组、非正文区域处理、短章节合并和边界校验，
+    最后去掉未选择输出或所有页面都被排除的章节
     
     Args:
-        file_id: 文件ID
+        request: 拆分请求
+        file_path: PDF文件路径
         
     Returns:
-        删除结果
+        (章节列表, 自动修正记录, 短章节合并记录)
+        
+    Raises:
+        HTTPException: 章节无法拆分时返回400
     """
+    chapters = request.chapters
+    adjustments = []
+    total_pages = pdf_analyzer.get_total_pages(file_path)
+    
+    if request.strategy == SplitStrategy.BOOKMARKS:
+        # 书签直接指向物理页，不做页码体系换算
+        chapters = pdf_analyzer.chapters_from_bookmarks(file_path, request.max_depth)
+        if not chapters:
+            raise HTTPException(status_code=400, detail="文件没有可用于拆分的书签")
+    elif not chapters:
+        raise HTTPException(status_code=400, detail="章节列表不能为空")
+    elif request.numbering == PageNumbering.LOGICAL:
+        try:
+            chapters = pdf_analyzer.resolve_logical_pages(file_path, chapters)
+        except ValueError as e:
+            raise HTTPException(status_code=400, detail=str(e))
+    elif request.numbering == PageNumbering.PRINTED:
+        file_info = await file_service.get_file_info(request.file_id)
+        if not file_info or file_info.page_offset is None:
+            raise HTTPException(
+                status_code=400,
+                detail="文件尚未校准印刷页码，请先调用 /api/files/{file_id}/calibrate"
+            )
+        try:
+            chapters = pdf_analyzer.apply_page_offset(chapters, file_info.page_offset, total_pages)
+        except ValueError as e:
+            raise HTTPException(status_code=400, detail=str(e))
+    
     try:
-        success = await file_service.delete_file(file_id)
+        chapters = pdf_analyzer.mark_included(chapters, request.include)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    # 开启auto_fix时自动修正小的重叠和间隙
+    if request.auto_fix:
+        chapters, adjustments = pdf_analyzer.auto_fix_boundaries(
+            chapters,
+            total_pages,
+            max_gap=settings.AUTO_FIX_MAX_GAP,
+            max_overlap=settings.AUTO_FIX_MAX_OVERLAP
+        )
+    
+    try:
+        chapters = pdf_analyzer.group_chapters(chapters, request.groups)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    
+    chapters = pdf_analyzer.apply_section_handling(
+        chapters,
+        request.section_handling,
+        request.section_handling_overrides
+    )
+    chapters, merges = pdf_analyzer.merge_small_chapters(chapters, request.min_pages_per_chapter)
+    if not chapters:
+        raise HTTPException(
+            status_code=400,
+            detail="排除非正文区域后没有可拆分的章节"
+        )
+    
+    issues = pdf_analyzer.find_boundary_issues(chapters, total_pages)
+    if issues:
+        raise HTTPException(
+            status_code=400,
+            detail=f"章节边界无效: {'; '.join(issues)}"
+        )
+    
+    # 未选择的章节只参与以上的修正和合并，不生成文件；所有页面都被排除的章节同样跳过
+    excluded = excluded_page_numbers(request.exclude_pages, total_pages)
+    chapters = [
+        chapter for chapter in chapters
+        if chapter.extract and not excluded.issuperset(range(chapter.start_page, chapter.end_page + 1))
+    ]
+    if not chapters:
+        raise HTTPException(
+            status_code=400,
+            detail="没有需要输出的章节（未选择或所有页面都被排除）"
+        )
+    
+    return chapters, adjustments, merges
+
+
+def _split_message(task: SplitTask) -> str:
+    """拆分任务创建结果的提示"""
+    if task.status == TaskStatus.SCHEDULED:
+        return "拆分任务已计划执行"
+    if task.cache_hit and task.status == TaskStatus.COMPLETED:
+        return "相同文件、章节和选项已拆分过，直接复用已有输出"
+    return "拆分任务已创建"
+
+
+@router.post("/split", response_model=SplitResponse)
+async def split_pdf(request: SplitRequest):
+    """
+    创建PDF拆分任务
+    
+    Args:
+        request: 拆分请求
         
-        if not success:
+    Returns:
+        任务创建结果
+    """
+    try:
+        logger.info(f"接收拆分请求: {request.file_id} - {len(request.chapters)} 个章节")
+        await _apply_preset(request)
+        try:
+            await policy_service.apply(request)
+        except PermissionError as e:
+            raise HTTPException(status_code=403, detail=str(e))
+        
+        file_path = await file_service.get_file_path(request.file_id)
+        if not file_path:
             raise HTTPException(
                 status_code=404,
                 detail="文件不存在"
             )
         
-        return {
-            "message": "文件删除成功",
-            "file_id": file_id
-        }
+        try:
+            validate_filename_template(request.filename_template)
+            validate_redactions(request.redactions)
+            if request.page_numbers:
+                validate_page_number_format(request.page_numbers.format)
+            if request.pdfa and not pdfa_converter.available:
+                raise ValueError("服务器未安装Ghostscript或缺少sRGB ICC配置文件，无法转换PDF/A")
+            if request.grayscale and not ghostscript_available():
+                raise ValueError("服务器未安装Ghostscript，无法转换灰度")
+            if (request.deskew or request.ocr_text_layer) and not tesseract_available():
+                raise ValueError("服务器未安装Tesseract，无法纠正扫描页方向或生成OCR文字层")
+            if request.sign != SigningMode.NONE and not signing_service.configured:
+                raise ValueError("服务器未配置签名证书，无法签名章节输出")
+            if request.delivery:
+                delivery_service.validate(request.delivery)
+            notification_service.validate(request.notifications)
+        except ValueError as e:
+            raise HTTPException(status_code=400, detail=str(e))
+        
+        if request.signatures == SignatureHandling.REFUSE:
+            file_info = await file_service.get_file_info(request.file_id)
+            if file_info and file_info.signature_count:
+                raise HTTPException(
+                    status_code=409,
+                    detail=f"文件包含 {file_info.signature_count} 个数字签名，拆分会使签名失效"
+                )
+        
+        chapters, adjustments, merges = await _prepare_split_chapters(request, file_path)
+        file_info = await file_service.get_file_info(request.file_id)
+        
+        task = await task_service.create_split_task(
+            request.file_id,
+            chapters,
+            notifications=request.notifications,
+            run_at=request.run_at,
+            priority=request.priority,
+            delivery=request.delivery,
+            export=request.export,
+            filename_template=request.filename_template,
+            optimize=request.optimize,
+            preset_id=request.preset_id,
+            strip_metadata=request.strip_metadata,
+            watermark_text=request.watermark_text,
+            max_output_bytes=request.max_output_bytes,
+            attachments=request.attachments,
+            redactions=request.redactions,
+            bates=request.bates,
+            page_numbers=request.page_numbers,
+            pdfa=request.pdfa,
+            grayscale=request.grayscale,
+            strip_backgrounds=request.strip_backgrounds,
+            deskew=request.deskew,
+            ocr_text_layer=request.ocr_text_layer,
+            best_effort=request.best_effort,
+            unreadable_pages=request.unreadable_pages,
+            bookmarked_copy=request.bookmarked_copy,
+            exclude_pages=request.exclude_pages,
+            group_dividers=request.group_dividers,
+            bundle=request.bundle,
+            signatures=request.signatures,
+            sign=request.sign,
+            bypass_cache=request.bypass_cache
+        )
         
-    except HTTPException:
+        return SplitResponse(
+            task_id=task.task_id,
+            status=task.status,
+            message=_split_message(task),
+            run_at=task.run_at,
+            adjustments=adjustments,
+            merges=merges,
+            warnings=signature_warnings(file_info.signature_count if file_info else 0)
+        )
+        
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
-        logger.error(f"删除文件失败: {str(e)}")
+        logger.error(f"创建拆分任务失败: {str(e)}")
         raise HTTPException(
             status_code=500,
-            detail=f"删除文件失败: {str(e)}"
+            detail=f"创建拆分任务失败: {str(e)}"
         )
 
 
+@router.post("/presets", response_model=SplitPreset)
+async def create_preset(request: SplitPresetRequest):
+    """
+    创建拆分预设
+    
+    Args:
+        request: 预设名称、识别策略和拆分选项
+        
+    Returns:
+        创建的预设
+    """
+    try:
+        return await preset_service.create(request)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"创建预设失败: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"创建预设失败: {str(e)}")
+
+
+@router.get("/presets", response_model=List[SplitPreset])
+async def list_presets():
+    """
+    列出当前租户的拆分预设
+    
+    Returns:
+        预设列表
+    """
+    return await preset_service.list()
+
+
+@router.get("/presets/{preset_id}", response_model=SplitPreset)
+async def get_preset(preset_id: str):
+    """
+    获取拆分预设
+    
+    Args:
+        preset_id: 预设ID
+        
+    Returns:
+        预设
+    """
+    preset = await preset_service.get(preset_id)
+    if not preset:
+        raise HTTPException(status_code=404, detail="预设不存在")
+    return preset
+
+
+@router.put("/presets/{preset_id}", response_model=SplitPreset)
+async def update_preset(preset_id: str, request: SplitPresetRequest):
+    """
+    更新拆分预设（整体替换）
+    
+    Args:
+        preset_id: 预设ID
+        request: 新的预设内容
+        
+    Returns:
+        更新后的预设
+    """
+    try:
+        preset = await preset_service.update(preset_id, request)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"更新预设失败: {str(e)}")
+        raise HTTPException(status_code=500, detail=f"更新预设失败: {str(e)}")
+    
+    if not preset:
+        raise HTTPException(status_code=404, detail="预设不存在")
+    return preset
 
 
+@router.delete("/presets/{preset_id}")
+async def delete_preset(preset_id: str):
+    """
+    删除拆分预设
+    
+    Args:
+        preset_id: 预设ID
+        
+    Returns:
+        删除结果
+    """
+    if not await preset_service.delete(preset_id):
+        raise HTTPException(status_code=404, detail="预设不存在")
+    return {
+        "message": "预设删除成功",
+        "preset_id": preset_id
+    }
 
 
+@router.get("/tasks", response_model=List[SplitTask], response_model_exclude=TASK_PRIVATE_FIELDS)
+async def list_tasks(file_id: str = None):
+    """
+    列出拆分任务
+    
+    Args:
+        file_id: 文件ID过滤（可选）
+        
+    Returns:
+        任务列表
+    """
+    return await task_service.list_tasks(file_id)
 
 
-# ------------------------
-# 知识图谱相关API
-# ------------------------
+@router.get("/task/{task_id}", response_model=SplitTask, response_model_exclude=TASK_PRIVATE_FIELDS)
+async def get_task_status(task_id: str):
+    """
+    获取拆分任务状态
+    
+    Args:
+        task_id: 任务ID
+        
+    Returns:
+        任务信息
+    """
+    task = await task_service.get_task_status(task_id)
+    
+    if not task:
+        raise HTTPException(
+            status_code=404,
+            detail="任务不存在"
+        )
+    
+    return task
+
+
+@router.post("/task/{task_id}/retry", response_model=SplitResponse)
+async def retry_task(task_id: str):
+    """
+    重试失败或已取消的拆分任务：以相同的文件、章节和选项创建新任务，
+    中断前已完成的章节从检查点恢复，从第一个未完成的章节继续
+    
+    Args:
+        task_id: 原任务ID
+        
+    Returns:
+        新任务信息
+    """
+    try:
+        task = await task_service.retry_task(task_id)
+        if not task:
+            raise HTTPException(
+                status_code=404,
+                detail="任务不存在"
+            )
+        
+        return SplitResponse(
+            task_id=task.task_id,
+            status=task.status,
+            message=_split_message(task),
+            run_at=task.run_at
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"重试任务失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"重试任务失败: {str(e)}"
+        )
+
+
+@router.get("/task/{task_id}/events", response_model=TaskEventsResponse)
+async def get_task_events(task_id: str):
+    """
+    获取任务事件时间线
+    
+    Args:
+        task_id: 任务ID
+        
+    Returns:
+        按时间排序的任务事件
+    """
+    events = await task_service.get_task_events(task_id)
+    
+    if events is None:
+        raise HTTPException(
+            status_code=404,
+            detail="任务不存在"
+        )
+    
+    return TaskEventsResponse(
+        task_id=task_id,
+        events=events,
+        total=len(events)
+    )
+
+
+@router.get("/task/{task_id}/report")
+async def get_task_report(task_id: str, report_format: ReportFormat = ReportFormat.HTML):
+    """
+    下载拆分任务报告（输入、选项、生成的章节及校验和、警告和耗时），用于存档
+    
+    Args:
+        task_id: 任务ID
+        report_format: 报告格式（html 或 pdf）
+        
+    Returns:
+        HTML页面或PDF文件
+    """
+    task = await task_service.get_task_status(task_id)
+    
+    if not task:
+        raise HTTPException(
+            status_code=404,
+            detail="任务不存在"
+        )
+    
+    if task.task_type != TaskType.SPLIT or task.status != TaskStatus.COMPLETED:
+        raise HTTPException(
+            status_code=409,
+            detail="只有已完成的拆分任务才有报告"
+        )
+    
+    report = await task_report_service.get(task_id)
+    if not report:
+        raise HTTPException(
+            status_code=404,
+            detail="该任务没有报告"
+        )
+    
+    if report_format == ReportFormat.PDF:
+        content = await asyncio.to_thread(task_report_service.render_pdf, report)
+        return Response(
+            content=content,
+            media_type="application/pdf",
+            headers={"Content-Disposition": f"attachment; filename*=UTF-8''{quote(f'report_{task_id}.pdf')}"}
+        )
+    
+    return Response(content=task_report_service.render_html(report), media_type="text/html; charset=utf-8")
+
+
+@router.get("/task/{task_id}/webhooks", response_model=WebhookDeliveriesResponse)
+async def get_task_webhooks(task_id: str):
+    """
+    获取任务的Webhook投递记录（含每次发送的状态码和错误）
+    
+    Args:
+        task_id: 任务ID
+        
+    Returns:
+        投递记录
+    """
+    task = await task_service.get_task_status(task_id)
+    
+    if not task:
+        raise HTTPException(
+            status_code=404,
+            detail="任务不存在"
+        )
+    
+    deliveries = await webhook_service.list_deliveries(task_id=task_id)
+    return WebhookDeliveriesResponse(deliveries=deliveries, total=len(deliveries))
+
+
+@router.get("/task/{task_id}/stream")
+async def stream_task_progress(task_id: str):
+    """
+    以Server-Sent Events推送任务进度和事件
+    
+    Args:
+        task_id: 任务ID
+        
+    Returns:
+        text/event-stream 响应，任务结束后关闭
+    """
+    task = await task_service.get_task_status(task_id)
+    if not task:
+        raise HTTPException(
+            status_code=404,
+            detail="任务不存在"
+        )
+    
+    async def event_stream():
+        last_state = None
+        sent_events = 0
+        
+        while True:
+            task = await task_service.get_task_status(task_id)
+            if not task:
+                break
+            
+            events = await task_service.get_task_events(task_id) or []
+            for event in events[sent_events:]:
+                yield f"event: task_event\ndata: {event.model_dump_json()}\n\n"
+            sent_events = len(events)
+            
+            state = (task.status, task.progress)
+            if state != last_state:
+                payload = json.dumps({"task_id": task_id, "status": task.status.value, "progress": task.progress})
+                yield f"event: progress\ndata: {payload}\n\n"
+                last_state = state
+            
+            if is_finished(task.status):
+                yield f"event: done\ndata: {task.model_dump_json(include={'task_id', 'status', 'error_message'})}\n\n"
+                break
+            
+            await asyncio.sleep(settings.SSE_POLL_INTERVAL)
+    
+    return StreamingResponse(
+        event_stream(),
+        media_type="text/event-stream",
+        headers={"Cache-Control": "no-cache", "X-Accel-Buffering": "no"}
+    )
+
+
+
+@router.post("/validate-chapters")
+async def validate_chapters(chapters: List[dict], total_pages: int):
+    """
+    验证章节信息
+    
+    Args:
+        chapters: 章节列表
+        total_pages: 总页数
+        
+    Returns:
+        验证结果
+    """
+    try:
+        # 转换为ChapterInfo对象
+        chapter_infos = [ChapterInfo(**chapter) for chapter in chapters]
+        
+        # 执行验证
+        result = pdf_analyzer.validate_chapters_detailed(chapter_infos, total_pages)
+        
+        return result
+        
+    except Exception as e:
+        logger.error(f"章节验证失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"章节验证失败: {str(e)}"
+        )
+
+
+@router.get("/pdf-info/{file_id}")
+async def get_pdf_info(file_id: str):
+    """
+    获取PDF文件信息
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        PDF文件信息
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        # 获取文件信息
+        file_info = await file_service.get_file_info(file_id)
+        
+        return {
+            "file_id": file_id,
+            "filename": file_info.filename if file_info else "unknown.pdf",
+            "file_size": file_info.file_size if file_info else 0,
+            "upload_time": file_info.upload_time if file_info else None,
+            "status": file_info.status if file_info else "unknown",
+            "page_offset": file_info.page_offset if file_info else None,
+            "download_count": file_info.download_count if file_info else 0,
+            "last_accessed": file_info.last_accessed if file_info else None,
+            "downloads": file_info.downloads if file_info else {},
+            "original_expires_at": file_info.original_expires_at if file_info else None,
+            "outputs_expires_at": file_info.outputs_expires_at if file_info else None
+        }
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"获取PDF信息失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取PDF信息失败: {str(e)}"
+        )
+
+
+@router.get("/download/{file_id}")
+async def download_file(
+    file_id: str,
+    filename: Optional[str] = None,
+    download: bool = True,
+    if_none_match: Optional[str] = Header(None, alias="If-None-Match"),
+    if_modified_since: Optional[str] = Header(None, alias="If-Modified-Since")
+):
+    """
+    下载原始文件或章节文件
+    
+    生成后的文件不再变化，响应带有ETag、Last-Modified和长期缓存的Cache-Control，
+    条件请求命中时返回304
+    
+    Args:
+        file_id: 文件ID
+        filename: 章节文件名，为空时下载原始文件
+        download: 是否以附件形式下载（否则内联预览）
+        if_none_match: 客户端缓存的ETag
+        if_modified_since: 客户端缓存的修改时间
+        
+    Returns:
+        PDF文件
+    """
+    return await _serve_download(file_id, filename, download, if_none_match, if_modified_since)
+
+
+async def _serve_download(
+    file_id: str,
+    filename: Optional[str],
+    download: bool,
+    if_none_match: Optional[str],
+    if_modified_since: Optional[str]
+) -> Response:
+    """提供原文件或章节文件，记录下载统计，供普通下载和分享链接下载共用"""
+    file_path = await file_service.get_download_path(file_id, filename)
+    if not file_path and filename and output_store.enabled:
+        response = await _shared_download(file_id, filename, download)
+        await file_service.record_download(file_id, [filename])
+        return response
+    if not file_path:
+        raise HTTPException(status_code=404, detail="文件不存在")
+    
+    # 统计按存储的文件名记录，原文件为 original.pdf
+    stored_name = filename or "original.pdf"
+    sha256 = None
+    if filename:
+        manifest = await file_service.get_manifest(file_id)
+        entry = next((f for f in manifest.files if f.filename == filename), None) if manifest else None
+        sha256 = entry.sha256 if entry else None
+    else:
+        file_info = await file_service.get_file_info(file_id)
+        filename = file_info.filename if file_info else "original.pdf"
+        sha256 = file_info.file_hash if file_info else None
+    
+    stat = os.stat(file_path)
+    etag = f'"{sha256}"' if sha256 else f'"{stat.st_size:x}-{stat.st_mtime_ns:x}"'
+    headers = _cache_headers(etag, stat.st_mtime)
+    if _not_modified(etag, stat.st_mtime, if_none_match, if_modified_since):
+        return Response(status_code=304, headers=headers)
+    
+    await file_service.record_download(file_id, [stored_name])
+    # 隐私模式的文件在TEMP_DIR中，不在反向代理映射的UPLOAD_DIR下，由应用发送
+    if settings.DOWNLOAD_OFFLOAD and not is_ephemeral_file(file_id):
+        return _offloaded_download(file_path, filename, download, headers)
+    
+    return FileResponse(
+        file_path,
+        media_type="application/pdf",
+        filename=filename,
+        headers=headers,
+        content_disposition_type="attachment" if download else "inline"
+    )
+
+
+@router.post("/files/{file_id}/share-links", response_model=ShareLinkSecretResponse)
+async def create_share_link(file_id: str, request: ShareLinkRequest):
+    """
+    为文件的章节输出生成分享链接，可只授权部分章节并设置有效期和下载次数上限
+    
+    Args:
+        file_id: 文件ID
+        request: 授权章节、有效时长和下载次数上限
+        
+    Returns:
+        分享令牌（只返回这一次）和链接信息
+    """
+    try:
+        if is_ephemeral_file(file_id):
+            raise HTTPException(status_code=400, detail="隐私模式上传的文件不支持分享")
+        
+        manifest = await file_service.get_manifest(file_id)
+        if not manifest:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在或尚未拆分"
+            )
+        
+        link, token = await share_link_service.create(file_id, request, manifest)
+        return ShareLinkSecretResponse(token=token, url=f"/api/shared/{token}", link=link)
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"创建分享链接失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"创建分享链接失败: {str(e)}"
+        )
+
+
+@router.get("/files/{file_id}/share-links", response_model=List[ShareLink])
+async def list_share_links(file_id: str):
+    """
+    列出文件的分享链接（不含令牌明文）
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        分享链接列表
+    """
+    return await share_link_service.list(file_id)
+
+
+@router.delete("/files/{file_id}/share-links/{link_id}", response_model=ShareLink)
+async def revoke_share_link(file_id: str, link_id: str):
+    """
+    吊销分享链接，立即失效
+    
+    Args:
+        file_id: 文件ID
+        link_id: 链接ID
+        
+    Returns:
+        吊销后的链接信息
+    """
+    link = await share_link_service.revoke(file_id, link_id)
+    if not link:
+        raise HTTPException(status_code=404, detail="分享链接不存在")
+    return link
+
+
+@router.get("/shared/{token}", response_model=SharedFilesResponse)
+async def get_shared_files(token: str):
+    """
+    查看分享链接可下载的章节，无需API Key
+    
+    Args:
+        token: 分享令牌
+        
+    Returns:
+        授权的章节文件列表
+    """
+    link = await share_link_service.resolve(token)
+    if not link:
+        raise HTTPException(status_code=404, detail="分享链接不存在或已失效")
+    
+    with use_tenant(link.tenant_id):
+        file_info = await file_service.get_file_info(link.file_id)
+        manifest = await file_service.get_manifest(link.file_id)
+    if not file_info or not manifest:
+        raise HTTPException(status_code=404, detail="分享的文件不存在")
+    
+    return SharedFilesResponse(
+        file_id=link.file_id,
+        filename=file_info.filename,
+        files=[entry for entry in manifest.files if share_link_service.allows(link, entry.filename, manifest)],
+        expires_at=link.expires_at,
+        remaining_downloads=link.max_downloads - link.download_count if link.max_downloads else None
+    )
+
+
+@router.get("/shared/{token}/download")
+async def download_shared_file(
+    token: str,
+    filename: str = "",
+    download: bool = True,
+    if_none_match: Optional[str] = Header(None, alias="If-None-Match"),
+    if_modified_since: Optional[str] = Header(None, alias="If-Modified-Since")
+):
+    """
+    通过分享链接下载章节文件，无需API Key
+    
+    只能下载链接授权、且在章节输出清单中的章节，不能下载原文件；发送文件前先占用一次下载次数，
+    下载失败或中断也计数，只有304响应归还；响应不允许共享缓存，避免绕过有效期和下载次数限制
+    
+    Args:
+        token: 分享令牌
+        filename: 章节文件名
+        download: 是否以附件形式下载（否则内联预览）
+        if_none_match: 客户端缓存的ETag
+        if_modified_since: 客户端缓存的修改时间
+        
+    Returns:
+        PDF文件
+    """
+    # 文件名为空时普通下载返回原文件，分享链接只能下载章节
+    if not filename:
+        raise HTTPException(status_code=400, detail="缺少章节文件名")
+    link = await share_link_service.resolve(token)
+    if not link:
+        raise HTTPException(status_code=404, detail="分享链接不存在或已失效")
+    
+    with use_tenant(link.tenant_id):
+        manifest = await file_service.get_manifest(link.file_id)
+    if not share_link_service.allows(link, filename, manifest):
+        raise HTTPException(status_code=403, detail="分享链接未授权该章节")
+    
+    # 发送前占用下载次数，并发下载时以原子计数为准，超过上限的请求不返回文件
+    if not await share_link_service.consume(token):
+        raise HTTPException(status_code=410, detail="分享链接已失效")
+    with use_tenant(link.tenant_id):
+        response = await _serve_download(link.file_id, filename, download, if_none_match, if_modified_since)
+    if response.status_code == 304:
+        await share_link_service.release(token)
+    response.headers["Cache-Control"] = "private, no-cache"
+    return response
+
+
+def _offloaded_download(file_path: str, filename: str, download: bool, headers: dict) -> Response:
+    """
+    交给反向代理发送文件，应用只返回内部重定向响应头
+    
+    nginx使用X-Accel-Redirect指向映射到UPLOAD_DIR的internal location，
+    Apache/lighttpd使用X-Sendfile指向文件的绝对路径
+    
+    Args:
+        file_path: 文件路径
+        filename: 下载文件名
+        download: 是否以附件形式下载
+        headers: 缓存响应头
+        
+    Returns:
+        空响应体的内部重定向响应
+    """
+    path = Path(file_path).resolve()
+    if settings.DOWNLOAD_OFFLOAD == "nginx":
+        relative = path.relative_to(Path(settings.UPLOAD_DIR).resolve()).as_posix()
+        redirect = ("X-Accel-Redirect", f"{settings.DOWNLOAD_OFFLOAD_PREFIX.rstrip('/')}/{quote(relative)}")
+    else:
+        redirect = ("X-Sendfile", str(path))
+    
+    disposition = "attachment" if download else "inline"
+    return Response(
+        media_type="application/pdf",
+        headers={
+            **headers,
+            "Content-Disposition": f"{disposition}; filename*=UTF-8''{quote(filename)}",
+            redirect[0]: redirect[1]
+        }
+    )
+
+
+def _cache_headers(etag: str, mtime: float) -> dict:
+    """不可变输出的缓存响应头"""
+    return {
+        "ETag": etag,
+        "Last-Modified": formatdate(mtime, usegmt=True),
+        "Cache-Control": settings.DOWNLOAD_CACHE_CONTROL
+    }
+
+
+def _not_modified(etag: str, mtime: float, if_none_match: Optional[str], if_modified_since: Optional[str]) -> bool:
+    """
+    判断条件请求是否命中客户端缓存，If-None-Match存在时优先于If-Modified-Since
+    
+    Args:
+        etag: 文件的ETag
+        mtime: 文件修改时间
+        if_none_match: 请求头If-None-Match
+        if_modified_since: 请求头If-Modified-Since
+        
+    Returns:
+        是否可以返回304
+    """
+    if if_none_match:
+        tags = [tag.strip() for tag in if_none_match.split(",")]
+        return "*" in tags or etag in tags or f"W/{etag}" in tags
+    if if_modified_since:
+        try:
+            since = parsedate_to_datetime(if_modified_since)
+        except (TypeError, ValueError):
+            return False
+        # HTTP日期只精确到秒
+        return since is not None and int(mtime) <= since.timestamp()
+    return False
+
+
+async def _shared_download(file_id: str, filename: str, download: bool):
+    """从共享存储提供其他副本生成的章节文件"""
+    if Path(filename).name != filename or not await file_service.get_file_info(file_id):
+        raise HTTPException(status_code=404, detail="文件不存在")
+    
+    tenant_id = get_current_tenant()
+    try:
+        if output_store.redirect:
+            url = await output_store.signed_url(tenant_id, file_id, filename, download)
+            if not url:
+                raise HTTPException(status_code=404, detail="文件不存在")
+            return RedirectResponse(url, status_code=307)
+        
+        opened = await output_store.open(tenant_id, file_id, filename)
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"从共享存储下载失败: {file_id}/{filename} - {str(e)}")
+        raise HTTPException(status_code=502, detail=f"从共享存储下载失败: {str(e)}")
+    
+    if not opened:
+        raise HTTPException(status_code=404, detail="文件不存在")
+    
+    chunks, size = opened
+    disposition = "attachment" if download else "inline"
+    return StreamingResponse(
+        chunks,
+        media_type="application/pdf",
+        headers={
+            "Content-Disposition": f"{disposition}; filename*=UTF-8''{quote(filename)}",
+            "Content-Length": str(size),
+            "Cache-Control": settings.DOWNLOAD_CACHE_CONTROL
+        }
+    )
+
+
+@router.get("/download/{file_id}/manifest", response_model=OutputManifest)
+async def download_manifest(file_id: str):
+    """
+    获取章节输出校验清单
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        各章节文件的页码范围、大小和SHA-256
+    """
+    manifest = await file_service.get_manifest(file_id)
+    if not manifest:
+        raise HTTPException(status_code=404, detail="校验清单不存在，请先完成拆分")
+    return manifest
+
+
+@router.get("/download/{file_id}/archive")
+async def download_archive(file_id: str, archive_format: ArchiveFormat = ArchiveFormat.ZIP):
+    """
+    打包下载全部章节文件（包含manifest.json）
+    
+    Args:
+        file_id: 文件ID
+        archive_format: 打包格式（zip 或 tar.gz）
+        
+    Returns:
+        拆分时已逐章写好的ZIP（开启bundle时），否则为流式生成的压缩包
+    """
+    members = await file_service.list_archive_members(file_id)
+    if not members:
+        raise HTTPException(status_code=404, detail="没有可下载的章节文件")
+    
+    await file_service.record_download(file_id, _downloaded_names(members))
+    bundle_path = await file_service.get_bundle_path(file_id) if archive_format == ArchiveFormat.ZIP else None
+    if bundle_path:
+        return FileResponse(
+            bundle_path,
+            media_type=ARCHIVE_MEDIA_TYPES[archive_format],
+            filename=archive_service.filename(f"{file_id}_chapters", archive_format),
+            background=_ephemeral_purge([file_id])
+        )
+    return _archive_response(members, archive_format, f"{file_id}_chapters", _ephemeral_purge([file_id]))
+
+
+@router.post("/download/batch")
+async def download_batch(request: BatchDownloadRequest):
+    """
+    将多个文件的拆分结果打包下载，每个文件一个目录；preserve_folders时按批量导入的目录层级放置
+    
+    Args:
+        request: 批量打包请求
+        
+    Returns:
+        流式生成的压缩包
+    """
+    members = []
+    downloaded = []
+    used_prefixes = set()
+    for file_id in dict.fromkeys(request.file_ids):
+        prefix = f"{file_id}/"
+        if request.preserve_folders:
+            prefix = await _folder_prefix(file_id, used_prefixes)
+        file_members = await file_service.list_archive_members(file_id, prefix=prefix)
+        if file_members:
+            await file_service.record_download(file_id, _downloaded_names(file_members))
+            downloaded.append(file_id)
+        members.extend(file_members)
+    
+    if not members:
+        raise HTTPException(status_code=404, detail="没有可下载的章节文件")
+    
+    return _archive_response(members, request.archive_format, "batch_chapters", _ephemeral_purge(downloaded))
+
+
+async def _folder_prefix(file_id: str, used: set) -> str:
+    """按文件的collection和文件名生成包内目录，同一目录下重名时追加文件ID"""
+    file_info = await file_service.get_file_info(file_id)
+    if file_info is None:
+        return f"{file_id}/"
+    
+    folder = f"{file_info.collection}/" if file_info.collection else ""
+    prefix = f"{folder}{Path(file_info.filename).stem}/"
+    if prefix in used:
+        prefix = f"{folder}{Path(file_info.filename).stem}_{file_id}/"
+    used.add(prefix)
+    return prefix
+
+
+def _downloaded_names(members) -> List[str]:
+    """打包下载的章节文件名，不含manifest.json"""
+    return [path.name for path, _ in members if path.name != MANIFEST_FILENAME]
+
+
+def _archive_response(
+    members,
+    archive_format: ArchiveFormat,
+    name: str,
+    background: Optional[BackgroundTask] = None
+) -> StreamingResponse:
+    """构造流式打包下载响应，background在压缩包发送完毕后执行"""
+    filename = archive_service.filename(name, archive_format)
+    return StreamingResponse(
+        archive_service.stream(members, archive_format),
+        media_type=ARCHIVE_MEDIA_TYPES[archive_format],
+        headers={"Content-Disposition": f'attachment; filename="{filename}"'},
+        background=background
+    )
+
+
+def _ephemeral_purge(file_ids: List[str]) -> Optional[BackgroundTask]:
+    """打包下载包含隐私模式文件时，发送完毕后删除这些文件"""
+    ephemeral_ids = [file_id for file_id in file_ids if is_ephemeral_file(file_id)]
+    return BackgroundTask(_purge_ephemeral_files, ephemeral_ids) if ephemeral_ids else None
+
+
+async def _purge_ephemeral_files(file_ids: List[str]) -> None:
+    """删除隐私模式文件及其缓存和任务记录"""
+    for file_id in file_ids:
+        file_info = await file_service.get_file_info(file_id)
+        if file_info:
+            document_cache.evict(file_info.file_hash)
+        analysis_cache.invalidate(file_id)
+        await file_service.delete_file(file_id)
+        logger.info(f"隐私模式文件已下载，立即删除: {file_id}")
+    await task_service.purge_file_tasks(file_ids)
+
+
+@router.get("/files", response_model=List[FileSummary])
+async def list_files(tag: Optional[str] = None, collection: Optional[str] = None):
+    """
+    列出当前租户的文件，按上传时间倒序
+    
+    Args:
+        tag: 只列出带有该标签的文件（忽略大小写）
+        collection: 只列出该目录及其子目录中的文件
+        
+    Returns:
+        文件列表
+    """
+    try:
+        return [_file_summary(info) for info in await file_service.list_files(tag=tag, collection=collection)]
+        
+    except Exception as e:
+        logger.error(f"获取文件列表失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取文件列表失败: {str(e)}"
+        )
+
+
+@router.get("/tags", response_model=List[TagCount])
+async def list_tags():
+    """
+    当前租户使用的标签及文件数，按文件数倒序
+    
+    Returns:
+        标签列表
+    """
+    try:
+        return [TagCount(tag=tag, files=count) for tag, count in (await file_service.list_tags()).items()]
+        
+    except Exception as e:
+        logger.error(f"获取标签列表失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取标签列表失败: {str(e)}"
+        )
+
+
+@router.post("/files/{file_id}/tags", response_model=FileSummary)
+async def add_file_tags(file_id: str, request: TagsRequest):
+    """
+    为文件添加标签，已有的标签（忽略大小写）忽略
+    
+    Args:
+        file_id: 文件ID
+        request: 要添加的标签
+        
+    Returns:
+        更新后的文件
+    """
+    try:
+        file_info = await file_service.add_tags(file_id, request.tags)
+        if not file_info:
+            raise HTTPException(status_code=404, detail="文件不存在")
+        return _file_summary(file_info)
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"添加文件标签失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"添加文件标签失败: {str(e)}"
+        )
+
+
+@router.delete("/files/{file_id}/tags/{tag}", response_model=FileSummary)
+async def remove_file_tag(file_id: str, tag: str):
+    """
+    删除文件的标签（忽略大小写），没有该标签时不做修改
+    
+    Args:
+        file_id: 文件ID
+        tag: 标签
+        
+    Returns:
+        更新后的文件
+    """
+    try:
+        file_info = await file_service.remove_tag(file_id, tag)
+        if not file_info:
+            raise HTTPException(status_code=404, detail="文件不存在")
+        return _file_summary(file_info)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"删除文件标签失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"删除文件标签失败: {str(e)}"
+        )
+
+
+def _file_summary(file_info: FileInfo) -> FileSummary:
+    """文件列表中的字段，不含存储路径等内部信息"""
+    fields = file_info.model_dump(include=set(FileSummary.model_fields))
+    return FileSummary(**{**fields, "display_name": display_name(file_info)})
+
+
+@router.delete("/files/{file_id}")
+async def delete_file(file_id: str):
+    """
+    删除文件
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        删除结果
+    """
+    try:
+        file_info = await file_service.get_file_info(file_id)
+        if file_info:
+            document_cache.evict(file_info.file_hash)
+        analysis_cache.invalidate(file_id)
+        success = await file_service.delete_file(file_id)
+        
+        if not success:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        return {
+            "message": "文件删除成功",
+            "file_id": file_id
+        }
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"删除文件失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"删除文件失败: {str(e)}"
+        )
+
+
+
+
+
+
+
+
+@router.post("/files/{file_id}/calibrate", response_model=CalibrationResponse)
+async def calibrate_page_offset(file_id: str, request: CalibrationRequest):
+    """
+    校准印刷页码与物理页码的偏移量
+    
+    Args:
+        file_id: 文件ID
+        request: 校准请求（印刷页码与对应的物理页码）
+        
+    Returns:
+        校准结果
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        total_pages = pdf_analyzer.get_total_pages(file_path)
+        if request.physical_page > total_pages:
+            raise HTTPException(
+                status_code=400,
+                detail=f"物理页码超出总页数 {total_pages}"
+            )
+        
+        page_offset = request.physical_page - request.printed_page
+        await file_service.set_page_offset(file_id, page_offset)
+        
+        return CalibrationResponse(
+            file_id=file_id,
+            page_offset=page_offset,
+            message=f"已校准: 印刷页 {request.printed_page} = 物理页 {request.physical_page}"
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"校准页码失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"校准页码失败: {str(e)}"
+        )
+
+
+@router.post("/files/{file_id}/repair", response_model=RepairResponse)
+async def repair_file(file_id: str):
+    """
+    修复损坏的PDF（重建交叉引用表、恢复可读对象），之后的分析和拆分使用修复后的副本
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        修复结果
+    """
+    try:
+        file_info = await file_service.get_file_info(file_id)
+        if not file_info:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        previous_hash = file_info.file_hash
+        try:
+            file_info, report = await file_service.repair_file(file_id)
+        except ValueError as e:
+            raise HTTPException(status_code=400, detail=str(e))
+        if previous_hash:
+            document_cache.evict(previous_hash)
+        
+        return RepairResponse(
+            file_id=file_id,
+            message="已修复损坏的文件" if report.damaged else "文件未损坏，已生成重新整理的副本",
+            **report.model_dump()
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"修复文件失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"修复文件失败: {str(e)}"
+        )
+
+
+@router.put("/files/{file_id}/chapters", response_model=SavedChapters)
+async def save_chapter_edits(file_id: str, request: SaveChaptersRequest):
+    """
+    保存人工编辑的章节，之后重新分析时可与新建议对比
+    
+    Args:
+        file_id: 文件ID
+        request: 人工确认后的章节列表
+        
+    Returns:
+        保存的编辑
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        total_pages = pdf_analyzer.get_total_pages(file_path)
+        for index, chapter in enumerate(request.chapters, start=1):
+            if chapter.end_page > total_pages:
+                raise HTTPException(
+                    status_code=400,
+                    detail=f"第 {index} 个章节的结束页超出总页数 {total_pages}"
+                )
+        
+        return await file_service.save_chapter_edits(file_id, request.chapters)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"保存章节编辑失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"保存章节编辑失败: {str(e)}"
+        )
+
+
+@router.get("/files/{file_id}/chapters", response_model=SavedChapters)
+async def get_chapter_edits(file_id: str):
+    """
+    获取已保存的人工章节编辑
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        保存的编辑
+    """
+    try:
+        edits = await file_service.get_chapter_edits(file_id)
+        if not edits:
+            raise HTTPException(
+                status_code=404,
+                detail="未保存章节编辑"
+            )
+        return edits
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"获取章节编辑失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取章节编辑失败: {str(e)}"
+        )
+
+
+@router.get("/files/{file_id}/outline", response_model=Outline)
+async def get_outline(file_id: str, filename: Optional[str] = None):
+    """
+    读取文件的书签树
+    
+    Args:
+        file_id: 文件ID
+        filename: 编辑书签后生成的副本文件名，为空时读取原文件
+        
+    Returns:
+        书签树
+    """
+    try:
+        if filename and not filename.startswith(OUTLINE_FILENAME_PREFIX):
+            raise HTTPException(status_code=400, detail="只能读取编辑书签生成的副本")
+        file_path = await (file_service.get_download_path(file_id, filename) if filename else file_service.get_file_path(file_id))
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        items, page_count = await asyncio.to_thread(outline_service.read, Path(file_path))
+        return Outline(file_id=file_id, filename=filename, page_count=page_count, items=items)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"读取书签失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"读取书签失败: {str(e)}"
+        )
+
+
+@router.put("/files/{file_id}/outline", response_model=OutlineUpdateResponse)
+async def update_outline(file_id: str, request: OutlineUpdateRequest):
+    """
+    以编辑后的书签树替换原有书签，生成可下载的新副本（原文件不变）
+    
+    Args:
+        file_id: 文件ID
+        request: 新的书签树
+        
+    Returns:
+        副本文件名和书签数
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        filename, bookmarks = await asyncio.to_thread(
+            outline_service.write,
+            Path(file_path),
+            file_storage_dir(file_id) / "chapters",
+            request.items
+        )
+        return OutlineUpdateResponse(
+            file_id=file_id,
+            filename=filename,
+            bookmarks=bookmarks,
+            message=f"已生成包含 {bookmarks} 个书签的副本"
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"写入书签失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"写入书签失败: {str(e)}"
+        )
+
+
+@router.post("/files/{file_id}/chapters/diff", response_model=ChapterDiffResponse)
+async def diff_chapter_suggestions(file_id: str, request: ChapterDiffRequest):
+    """
+    对比新的章节建议与已保存的人工编辑，返回新增、移动、删除和改名
+    
+    Args:
+        file_id: 文件ID
+        request: 待对比的建议，或重新分析的选项
+        
+    Returns:
+        章节差异
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        edits = await file_service.get_chapter_edits(file_id)
+        if not edits:
+            raise HTTPException(
+                status_code=404,
+                detail="未保存章节编辑"
+            )
+        
+        suggestions = request.suggestions
+        if suggestions is None:
+            # 只传递显式提供的选项，预设才能填充其余字段
+            analyze_request = AnalyzeRequest(
+                file_id=file_id,
+                **request.model_dump(exclude={"suggestions"}, exclude_unset=True)
+            )
+            await _apply_preset(analyze_request)
+            suggestions = (await analysis_service.analyze(analyze_request, file_path)).chapters
+        
+        return diff_chapters(edits, suggestions)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"对比章节建议失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"对比章节建议失败: {str(e)}"
+        )
+
+
+@router.get("/files/{file_id}/chapters/{index}/images")
+async def download_chapter_images(file_id: str, index: int):
+    """
+    打包下载章节中的嵌入图片（按内容去重，images.json记录每张图片出现的页码）
+    
+    章节按已保存的人工编辑确定，未保存时使用自动分析结果
+    
+    Args:
+        file_id: 文件ID
+        index: 章节序号（从1开始）
+        
+    Returns:
+        流式生成的ZIP压缩包
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        edits = await file_service.get_chapter_edits(file_id)
+        if edits:
+            chapters = edits.chapters
+        else:
+            chapters = (await analysis_service.analyze(AnalyzeRequest(file_id=file_id), file_path)).chapters
+        if not 1 <= index <= len(chapters):
+            raise HTTPException(
+                status_code=404,
+                detail=f"章节不存在，共 {len(chapters)} 个章节"
+            )
+        
+        file_hash = await file_service.get_file_hash(file_id)
+        images, entries = image_extractor.extract(file_path, chapters[index - 1], doc_key=file_hash)
+        if not images:
+            raise HTTPException(
+                status_code=404,
+                detail="该章节没有可提取的图片"
+            )
+        
+        filename = f"{file_id}_chapter{index:02d}_images.zip"
+        return StreamingResponse(
+            archive_service.stream_entries(entries),
+            media_type=ARCHIVE_MEDIA_TYPES[ArchiveFormat.ZIP],
+            headers={"Content-Disposition": f'attachment; filename="{filename}"'}
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"提取章节图片失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"提取章节图片失败: {str(e)}"
+        )
+
+
+@router.get("/files/{file_id}/attachments", response_model=List[AttachmentInfo])
+async def list_attachments(file_id: str):
+    """
+    列出PDF中的嵌入附件（文档级附件和页面上的附件注释）
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        附件列表
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        file_hash = await file_service.get_file_hash(file_id)
+        return attachment_service.list(file_path, doc_key=file_hash)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"获取附件列表失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取附件列表失败: {str(e)}"
+        )
+
+
+@router.get("/files/{file_id}/attachments/download")
+async def download_attachment(file_id: str, name: str):
+    """
+    下载嵌入附件
+    
+    Args:
+        file_id: 文件ID
+        name: 附件标识（附件列表中的name）
+        
+    Returns:
+        附件内容
+    """
+    try:
+        file_path = await file_service.get_file_path(file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail="文件不存在"
+            )
+        
+        file_hash = await file_service.get_file_hash(file_id)
+        found = attachment_service.get(file_path, name, doc_key=file_hash)
+        if not found:
+            raise HTTPException(
+                status_code=404,
+                detail="附件不存在"
+            )
+        
+        info, content = found
+        return Response(
+            content,
+            media_type=mimetypes.guess_type(info.filename)[0] or "application/octet-stream",
+            headers={"Content-Disposition": f"attachment; filename*=UTF-8''{quote(info.filename)}"}
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"下载附件失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"下载附件失败: {str(e)}"
+        )
+
+
+async def _edition_chapters(file_id: str, request: CompareRequest) -> List[ChapterInfo]:
+    """获取参与版本对比的章节：优先人工编辑，否则自动分析"""
+    file_path = await file_service.get_file_path(file_id)
+    if not file_path:
+        raise HTTPException(
+            status_code=404,
+            detail=f"文件不存在: {file_id}"
+        )
+    
+    if request.use_saved_edits:
+        edits = await file_service.get_chapter_edits(file_id)
+        if edits:
+            return edits.chapters
+    
+    analyze_request = AnalyzeRequest(
+        file_id=file_id,
+        **request.model_dump(include={"normalize_titles", "min_pages_per_chapter", "preset_id"}, exclude_unset=True)
+    )
+    await _apply_preset(analyze_request)
+    return (await analysis_service.analyze(analyze_request, file_path)).chapters
+
+
+@router.post("/compare", response_model=CompareResponse)
+async def compare_files(request: CompareRequest):
+    """
+    对比两个版本PDF的章节结构（如同一本书的新旧版本）
+    
+    Args:
+        request: 旧版本和新版本的文件ID及分析选项
+        
+    Returns:
+        一致、改名、新增和删除的章节及页数变化
+    """
+    try:
+        logger.info(f"接收版本对比请求: {request.base_file_id} -> {request.target_file_id}")
+        
+        base = await _edition_chapters(request.base_file_id, request)
+        target = await _edition_chapters(request.target_file_id, request)
+        
+        return compare_editions(
+            request.base_file_id,
+            base,
+            request.target_file_id,
+            target,
+            similarity_threshold=request.similarity_threshold
+        )
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"版本对比失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"版本对比失败: {str(e)}"
+        )
+
+
+async def _coursepack_parts(request: CoursePackRequest) -> List[CoursePackPart]:
+    """把读本内容解析为源文件的页范围，按章节选取时优先取人工编辑的章节，否则自动分析"""
+    parts = []
+    chapters_by_file = {}
+    for item in request.items:
+        file_path = await file_service.get_file_path(item.file_id)
+        if not file_path:
+            raise HTTPException(
+                status_code=404,
+                detail=f"文件不存在: {item.file_id}"
+            )
+        file_info = await file_service.get_file_info(item.file_id)
+        source = citation(file_info)
+        
+        if item.chapter:
+            if item.file_id not in chapters_by_file:
+                edits = await file_service.get_chapter_edits(item.file_id)
+                chapters_by_file[item.file_id] = edits.chapters if edits else (
+                    await analysis_service.analyze(AnalyzeRequest(file_id=item.file_id), file_path)
+                ).chapters
+            chapters = chapters_by_file[item.file_id]
+            if item.chapter > len(chapters):
+                raise HTTPException(
+                    status_code=400,
+                    detail=f"文件 {item.file_id} 只有 {len(chapters)} 个章节"
+                )
+            chapter = chapters[item.chapter - 1]
+            parts.append(CoursePackPart(
+                path=file_path,
+                title=item.title or chapter.title,
+                start_page=chapter.start_page,
+                end_page=chapter.end_page,
+                sections=chapter.sections,
+                source=source
+            ))
+            continue
+        
+        start_page = item.start_page or 1
+        end_page = item.end_page or pdf_analyzer.get_total_pages(file_path)
+        title = item.title or Path(file_info.filename).stem
+        if start_page > end_page:
+            raise HTTPException(
+                status_code=400,
+                detail=f"“{title}”的起始页 {start_page} 大于结束页 {end_page}"
+            )
+        parts.append(CoursePackPart(path=file_path, title=title, start_page=start_page, end_page=end_page, source=source))
+    return parts
+
+
+@router.post("/coursepack", response_model=UploadResponse)
+async def create_coursepack(request: CoursePackRequest):
+    """
+    生成课程读本：把多个上传文件中的章节按指定顺序合并为一个带书签的PDF，可选封面、目录页和分隔页
+    
+    读本保存为新文件，可通过 /api/download/{file_id} 下载，也可继续分析和拆分
+    
+    Args:
+        request: 读本内容和选项
+        
+    Returns:
+        新文件的上传结果
+    """
+    try:
+        logger.info(f"接收课程读本请求: {request.title} - {len(request.items)} 项内容")
+        parts = await _coursepack_parts(request)
+        await _enforce_storage_quota()
+        
+        file_info, pages = await coursepack_service.create(parts, request, file_service)
+        await _check_storage_quota()
+        
+        return await _upload_response(file_info, f"课程读本已生成，共 {pages} 页")
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"生成课程读本失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"生成课程读本失败: {str(e)}"
+        )
+
+
+# ------------------------
+# 知识图谱相关API
+# ------------------------
+
+
+@router.get("/connectors", response_model=List[ConnectorStatus])
+async def list_connectors():
+    """
+    列出云盘连接状态
+    
+    Returns:
+        各云盘的连接状态
+    """
+    return await connector_service.list_status()
+
+
+@router.get("/connectors/{provider}/authorize", response_model=ConnectorAuthorizeResponse)
+async def authorize_connector(provider: ConnectorProvider):
+    """
+    获取云盘OAuth授权地址
+    
+    Args:
+        provider: 云盘类型
+        
+    Returns:
+        授权地址
+    """
+    try:
+        return ConnectorAuthorizeResponse(
+            provider=provider,
+            authorization_url=await connector_service.authorization_url(provider)
+        )
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+
+
+@router.get("/connectors/{provider}/callback", response_model=ConnectorStatus)
+async def connector_callback(provider: ConnectorProvider, code: str, state: str):
+    """
+    云盘OAuth回调，保存加密后的刷新令牌
+    
+    Args:
+        provider: 云盘类型
+        code: 授权码
+        state: 授权请求标识
+        
+    Returns:
+        连接状态
+    """
+    try:
+        return await connector_service.complete_authorization(provider, code, state)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"云盘授权失败: {provider.value} - {str(e)}")
+        raise HTTPException(
+            status_code=502,
+            detail=f"云盘授权失败: {str(e)}"
+        )
+
+
+@router.delete("/connectors/{provider}")
+async def disconnect_connector(provider: ConnectorProvider):
+    """
+    断开云盘连接
+    
+    Args:
+        provider: 云盘类型
+        
+    Returns:
+        断开结果
+    """
+    if not await connector_service.disconnect(provider):
+        raise HTTPException(status_code=404, detail="云盘未连接")
+    return {"message": "云盘连接已断开", "provider": provider}
+
+
+@router.get("/connectors/{provider}/files", response_model=List[ConnectorFile])
+async def list_connector_files(provider: ConnectorProvider, folder: str = ""):
+    """
+    列出云盘文件夹中的PDF文件
+    
+    Args:
+        provider: 云盘类型
+        folder: 文件夹（Drive为文件夹ID，Dropbox为路径）
+        
+    Returns:
+        PDF文件列表
+    """
+    try:
+        return await connector_service.list_files(provider, folder)
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"获取云盘文件列表失败: {provider.value} - {str(e)}")
+        raise HTTPException(
+            status_code=502,
+            detail=f"获取云盘文件列表失败: {str(e)}"
+        )
+
+
+@router.post("/connectors/{provider}/import", response_model=UploadResponse)
+async def import_from_connector(provider: ConnectorProvider, request: ConnectorImportRequest):
+    """
+    从云盘导入PDF文件
+    
+    Args:
+        provider: 云盘类型
+        request: 导入请求
+        
+    Returns:
+        上传结果
+    """
+    try:
+        await _enforce_storage_quota()
+        file_info = await connector_service.import_file(provider, request.file_ref, file_service, request.filename)
+        await _check_storage_quota()
+        
+        return await _upload_response(file_info, "文件导入成功")
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"云盘文件导入失败: {provider.value} - {str(e)}")
+        raise HTTPException(
+            status_code=502,
+            detail=f"云盘文件导入失败: {str(e)}"
+        )
 
 
 @router.post("/knowledge-graph", response_model=KnowledgeGraphResponse)
@@ -291,7 +2628,7 @@ async def build_knowledge_graph(request: KnowledgeGraphRequest):
         logger.info(f"知识图谱构建完成: {request.file_id}")
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"构建知识图谱失败: {str(e)}")
@@ -326,7 +2663,7 @@ async def get_knowledge_graph(file_id: str):
         
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"获取知识图谱失败: {str(e)}")
@@ -361,7 +2698,7 @@ async def get_graph_nodes(file_id: str, node_type: str = None):
         
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"获取知识图谱节点失败: {str(e)}")
@@ -396,7 +2733,7 @@ async def get_graph_edges(file_id: str, relation_type: str = None):
         
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"获取知识图谱边失败: {str(e)}")
@@ -440,7 +2777,7 @@ async def visualize_knowledge_graph(file_id: str):
         logger.info(f"知识图谱可视化数据生成完成: {file_id}")
         return visualize_data
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"生成知识图谱可视化数据失败: {str(e)}")
@@ -475,7 +2812,7 @@ async def manage_knowledge_points(request: KnowledgePointRequest):
         
         return response
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"管理知识点失败: {str(e)}")
@@ -524,11 +2861,488 @@ async def search_knowledge_points(file_id: str, keyword: str):
             "count": len(matched_points)
         }
         
-    except HTTPException:
+    except (HTTPException, DomainError):
         raise
     except Exception as e:
         logger.error(f"搜索知识点失败: {str(e)}")
         raise HTTPException(
             status_code=500,
             detail=f"搜索知识点失败: {str(e)}"
-        )
\ No newline at end of file
+        )
+
+@router.get("/admin/stats")
+async def admin_stats():
+    """
+    管理员统计信息：任务队列、当前租户存储用量、下载统计和缓存状态
+    
+    Returns:
+        统计信息
+    """
+    try:
+        return {
+            "tenant_id": get_current_tenant(),
+            "queue": await task_service.get_queue_status(),
+            "storage": {
+                "used_bytes": await file_service.get_storage_usage(),
+                "quota_bytes": get_tenant_quota_bytes()
+            },
+            "downloads": await file_service.get_download_summary(),
+            "document_cache": document_cache.stats(),
+            "memory_budget": memory_budget.stats()
+        }
+        
+    except Exception as e:
+        logger.error(f"获取统计信息失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取统计信息失败: {str(e)}"
+        )
+
+
+@router.get("/admin/config")
+async def admin_config():
+    """
+    查看当前生效的配置（敏感项已脱敏）
+    
+    Returns:
+        配置项
+    """
+    return settings.public_dump()
+
+
+@router.post("/admin/benchmark", response_model=BenchmarkResponse, include_in_schema=False)
+async def run_benchmark(request: BenchmarkRequest):
+    """
+    用内置样本运行拆分基准测试，对比引擎或流程改动前后的性能；运行期间会占用CPU，不宜在高峰期执行
+    
+    Args:
+        request: 样本、计时次数、拆分选项和基线
+        
+    Returns:
+        各样本的每秒页数、内存峰值和分配统计
+    """
+    try:
+        return await asyncio.to_thread(benchmark_service.run, request)
+        
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except RuntimeError as e:
+        raise HTTPException(status_code=409, detail=str(e))
+    except Exception as e:
+        logger.error(f"基准测试失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"基准测试失败: {str(e)}"
+        )
+
+
+@router.post("/admin/samples", response_model=SamplePdfResponse)
+async def create_sample_pdf(request: SamplePdfRequest):
+    """
+    生成指定页数和章节结构的示例文件（带书签和章节标题），供端到端测试和演示使用
+    
+    示例文件保存为新文件，可直接分析和拆分；响应中的章节结构可作为识别结果的标准答案
+    
+    Args:
+        request: 页数、章节结构、语言和是否写入书签
+        
+    Returns:
+        新文件的上传结果和生成的章节结构
+    """
+    try:
+        await _enforce_storage_quota()
+        file_info, chapters, pages = await sample_service.create(request, file_service)
+        await _check_storage_quota()
+        
+        response = await _upload_response(file_info, f"示例文件已生成，共 {pages} 页，{len(chapters)} 章")
+        return SamplePdfResponse(**response.model_dump(), pages=pages, chapters=chapters)
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"生成示例文件失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"生成示例文件失败: {str(e)}"
+        )
+
+
+@router.get("/admin/state/export")
+async def export_state(include_files: bool = False):
+    """
+    导出当前租户的服务状态（文件记录、人工章节编辑、预设、处理策略和已结束的任务）
+    
+    Args:
+        include_files: 是否同时打包原文件和章节输出，迁移到新部署时使用
+        
+    Returns:
+        流式生成的状态包（ZIP）
+    """
+    try:
+        entries, members = await asyncio.to_thread(state_service.export_archive, include_files)
+        filename = f"state_{get_current_tenant()}_{datetime.now().strftime('%Y%m%d%H%M%S')}.zip"
+        return StreamingResponse(
+            archive_service.stream_entries(entries, members),
+            media_type=ARCHIVE_MEDIA_TYPES[ArchiveFormat.ZIP],
+            headers={"Content-Disposition": f'attachment; filename="{filename}"'}
+        )
+        
+    except Exception as e:
+        logger.error(f"导出服务状态失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"导出服务状态失败: {str(e)}"
+        )
+
+
+@router.post("/admin/state/import", response_model=StateImportResponse)
+async def import_state(file: UploadFile = File(...), overwrite: bool = Form(False)):
+    """
+    导入其他实例导出的状态包到当前租户
+    
+    Args:
+        file: 状态包（ZIP）
+        overwrite: 是否覆盖已存在的同ID记录，默认跳过
+        
+    Returns:
+        各类记录的导入数量
+    """
+    try:
+        remaining = await _enforce_storage_quota(file.size or 0)
+        result, tasks = await asyncio.to_thread(state_service.import_archive, file.file, overwrite, remaining)
+        task_service.add_imported_tasks(tasks)
+        return result
+        
+    except (HTTPException, DomainError):
+        raise
+    except ValueError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"导入服务状态失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"导入服务状态失败: {str(e)}"
+        )
+
+
+@router.get("/admin/policy", response_model=ProcessingPolicy)
+async def get_processing_policy():
+    """
+    查看当前租户的组织级处理策略
+    
+    Returns:
+        处理策略
+    """
+    try:
+        return await policy_service.get()
+    except Exception as e:
+        logger.error(f"获取处理策略失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取处理策略失败: {str(e)}"
+        )
+
+
+@router.put("/admin/policy", response_model=ProcessingPolicy)
+async def update_processing_policy(policy: ProcessingPolicy):
+    """
+    设置当前租户的组织级处理策略，之后创建的拆分任务生效
+    
+    Args:
+        policy: 处理策略
+        
+    Returns:
+        保存后的策略
+    """
+    try:
+        return await policy_service.set(policy)
+    except Exception as e:
+        logger.error(f"更新处理策略失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"更新处理策略失败: {str(e)}"
+        )
+
+
+@router.get("/admin/webhooks", response_model=WebhookDeliveriesResponse)
+async def list_webhook_deliveries(status: Optional[WebhookDeliveryStatus] = None):
+    """
+    列出当前租户的Webhook投递记录
+    
+    Args:
+        status: 按状态过滤（pending/delivered/failed）
+        
+    Returns:
+        投递记录
+    """
+    deliveries = await webhook_service.list_deliveries(status=status)
+    return WebhookDeliveriesResponse(deliveries=deliveries, total=len(deliveries))
+
+
+@router.post("/admin/webhooks/{delivery_id}/redeliver", response_model=WebhookDelivery)
+async def redeliver_webhook(delivery_id: str):
+    """
+    重新投递Webhook，使用原事件数据和新的签名
+    
+    Args:
+        delivery_id: 投递标识
+        
+    Returns:
+        更新后的投递记录
+    """
+    try:
+        delivery = await webhook_service.redeliver(delivery_id)
+        if delivery is None:
+            raise HTTPException(status_code=404, detail="投递记录不存在")
+        return delivery
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"重新投递Webhook失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"重新投递Webhook失败: {str(e)}"
+        )
+
+
+@router.get("/admin/quarantine", response_model=List[FileSummary])
+async def list_quarantined_files():
+    """
+    列出当前租户因多次导致处理引擎崩溃而被隔离的文件
+    
+    Returns:
+        被隔离的文件
+    """
+    try:
+        files = await file_service.list_files()
+        return [_file_summary(info) for info in files if info.status == FileStatus.QUARANTINED]
+        
+    except Exception as e:
+        logger.error(f"获取隔离文件列表失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"获取隔离文件列表失败: {str(e)}"
+        )
+
+
+@router.post("/admin/quarantine/{file_id}/release", response_model=FileSummary)
+async def release_quarantined_file(file_id: str):
+    """
+    解除文件隔离，之后可以重新拆分（连续崩溃次数清零）
+    
+    Args:
+        file_id: 文件ID
+        
+    Returns:
+        更新后的文件
+    """
+    try:
+        file_info = await file_service.release_quarantine(file_id)
+        if file_info is None:
+            raise HTTPException(status_code=404, detail="文件不存在")
+        return _file_summary(file_info)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"解除文件隔离失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"解除文件隔离失败: {str(e)}"
+        )
+
+
+@router.post("/admin/api-keys", response_model=ApiKeySecretResponse)
+async def create_api_key(request: ApiKeyCreateRequest):
+    """
+    为当前租户签发API Key，明文只在响应中返回一次
+    
+    Args:
+        request: Key名称、角色及限额覆盖
+        
+    Returns:
+        明文Key和Key信息
+    """
+    try:
+        # 不能借签发Key提升角色，如租户管理员签发运维Key
+        if not has_role(get_current_principal(), request.role):
+            raise HTTPException(status_code=403, detail=f"不能签发高于自身角色的API Key: {request.role.value}")
+        
+        info, api_key = await api_key_store.create(
+            get_current_tenant(),
+            name=request.name,
+            role=request.role,
+            rate_limit_per_minute=request.rate_limit_per_minute,
+            quota_bytes=request.quota_bytes
+        )
+        return ApiKeySecretResponse(key=api_key, info=info)
+        
+    except HTTPException:
+        raise
+    except Exception as e:
+        logger.error(f"签发API Key失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"签发API Key失败: {str(e)}"
+        )
+
+
+@router.get("/admin/api-keys", response_model=List[ApiKeyInfo])
+async def list_api_keys():
+    """
+    列出当前租户签发的API Key（不含明文）
+    
+    Returns:
+        Key信息列表
+    """
+    return await api_key_store.list(get_current_tenant())
+
+
+async def _manageable_api_key(key_id: str, action: str) -> ApiKeyInfo:
+    """
+    读取当前调用方可以管理的Key，与签发相同，不能吊销或轮换高于自身角色的Key
+    
+    Raises:
+        HTTPException: Key不存在（404）或角色高于调用方（403）
+    """
+    info = await api_key_store.get(get_current_tenant(), key_id)
+    if info is None:
+        raise HTTPException(status_code=404, detail="API Key不存在")
+    if not has_role(get_current_principal(), info.role):
+        raise HTTPException(status_code=403, detail=f"不能{action}高于自身角色的API Key: {info.role.value}")
+    return info
+
+
+@router.delete("/admin/api-keys/{key_id}", response_model=ApiKeyInfo)
+async def revoke_api_key(key_id: str):
+    """
+    吊销API Key，立即失效
+    
+    Args:
+        key_id: Key唯一标识
+        
+    Returns:
+        吊销后的Key信息
+    """
+    await _manageable_api_key(key_id, "吊销")
+    info = await api_key_store.revoke(get_current_tenant(), key_id)
+    if info is None:
+        raise HTTPException(status_code=404, detail="API Key不存在")
+    return info
+
+
+@router.post("/admin/api-keys/{key_id}/rotate", response_model=ApiKeySecretResponse)
+async def rotate_api_key(key_id: str):
+    """
+    轮换API Key：生成新明文，旧Key立即失效
+    
+    Args:
+        key_id: Key唯一标识
+        
+    Returns:
+        新的明文Key和Key信息
+    """
+    try:
+        await _manageable_api_key(key_id, "轮换")
+        result = await api_key_store.rotate(get_current_tenant(), key_id)
+        if result is None:
+            raise HTTPException(status_code=404, detail="API Key不存在或已吊销")
+        info, api_key = result
+        return ApiKeySecretResponse(key=api_key, info=info)
+        
+    except (HTTPException, DomainError):
+        raise
+    except Exception as e:
+        logger.error(f"轮换API Key失败: {str(e)}")
+        raise HTTPException(
+            status_code=500,
+            detail=f"轮换API Key失败: {str(e)}"
+        )
+
+
+@router.get("/admin/audit", response_model=AuditLogResponse)
+async def list_audit_entries(user: Optional[str] = None, limit: int = 100):
+    """
+    查看当前租户的审计记录（上传、拆分、删除、签发Key、修改策略等修改操作，包括被拒绝的请求）
+    
+    Args:
+        user: 只列出该调用方的记录（签发的API Key为key_id）
+        limit: 最多返回的记录数
+        
+    Returns:
+        审计记录，最新的在前
+    """
+    entries = await audit_service.list(user=user, limit=limit)
+    return AuditLogResponse(entries=entries, total=len(entries))
+
+
+@router.get("/auth/oidc/login", response_model=OIDCLoginResponse)
+async def oidc_login():
+    """
+    获取企业SSO登录地址
+    
+    Returns:
+        登录地址
+    """
+    if not oidc_provider.enabled:
+        raise HTTPException(status_code=404, detail="未启用OIDC登录")
+    
+    try:
+        return OIDCLoginResponse(authorization_url=await oidc_provider.authorization_url())
+    except Exception as e:
+        logger.error(f"获取SSO登录地址失败: {str(e)}")
+        raise HTTPException(
+            status_code=502,
+            detail=f"获取SSO登录地址失败: {str(e)}"
+        )
+
+
+@router.get("/auth/oidc/callback", response_model=OIDCTokenResponse)
+async def oidc_callback(code: str, state: str):
+    """
+    SSO登录回调，用授权码换取令牌
+    
+    Args:
+        code: 授权码
+        state: 登录请求标识
+        
+    Returns:
+        令牌和映射后的调用方
+    """
+    if not oidc_provider.enabled:
+        raise HTTPException(status_code=404, detail="未启用OIDC登录")
+    
+    try:
+        tokens, principal = await oidc_provider.exchange_code(code, state)
+        return OIDCTokenResponse(
+            id_token=tokens["id_token"],
+            access_token=tokens.get("access_token"),
+            refresh_token=tokens.get("refresh_token"),
+            expires_in=tokens.get("expires_in"),
+            user=principal.user,
+            role=principal.role,
+            tenant_id=principal.tenant_id
+        )
+    except OIDCError as e:
+        raise HTTPException(status_code=400, detail=str(e))
+    except Exception as e:
+        logger.error(f"SSO登录失败: {str(e)}")
+        raise HTTPException(
+            status_code=502,
+            detail=f"SSO登录失败: {str(e)}"
+        )
+
+
+@router.get("/auth/me", response_model=CurrentUserResponse)
+async def current_user():
+    """
+    查看当前调用方及其角色
+    
+    Returns:
+        当前调用方
+    """
+    principal = get_current_principal()
+    return CurrentUserResponse(user=principal.user, role=principal.role, tenant_id=principal.tenant_id)
@@ -0,0 +1,224 @@
+"""
+API Key管理
+管理员通过接口签发的Key只保存SHA-256哈希，按租户保存在元数据存储中
+"""
+
+import hashlib
+import hmac
+import secrets
+import time
+import uuid
+from datetime import datetime
+from typing import Dict, List, Optional, Tuple
+
+from loguru import logger
+
+from ..models.schemas import ApiKeyInfo, Role
+from .config import settings
+from .errors import UnavailableError
+from .store import get_store
+
+
+KEY_PREFIX = "pcs_"
+API_KEYS_BUCKET = "api_keys"
+
+
+class StoredApiKey(ApiKeyInfo):
+    """落盘的Key记录"""
+    key_hash: str
+
+
+def hash_api_key(api_key: str) -> str:
+    """计算Key的哈希，Key本身是高熵随机串，无需加盐"""
+    return hashlib.sha256(api_key.encode("utf-8")).hexdigest()
+
+
+class ApiKeyStore:
+    """
+    按租户保存签发的API Key
+
+    认证时读取的Key列表在本副本缓存API_KEY_CACHE_SECONDS秒，多副本部署时其他副本签发、吊销或轮换的Key
+    最迟在缓存过期后生效；本副本的修改立即生效
+    """
+
+    def __init__(self):
+        # 租户ID -> (加载时间, Key列表)
+        self._keys: Dict[str, Tuple[float, List[StoredApiKey]]] = {}
+
+    async def create(
+        self,
+        tenant_id: str,
+        name: str,
+        role: Role,
+        rate_limit_per_minute: Optional[int] = None,
+        quota_bytes: Optional[int] = None
+    ) -> Tuple[ApiKeyInfo, str]:
+        """
+        签发新Key
+
+        Args:
+            tenant_id: 租户ID
+            name: Key名称
+            role: 角色
+            rate_limit_per_minute: 每分钟请求数上限覆盖
+            quota_bytes: 存储配额覆盖
+
+        Returns:
+            (Key信息, 明文Key)
+        """
+        api_key = self._generate()
+        record = StoredApiKey(
+            key_id=str(uuid.uuid4()),
+            name=name,
+            role=role,
+            prefix=api_key[:len(KEY_PREFIX) + 6],
+            rate_limit_per_minute=rate_limit_per_minute,
+            quota_bytes=quota_bytes,
+            created_at=datetime.now(),
+            key_hash=hash_api_key(api_key)
+        )
+        await get_store().aput(API_KEYS_BUCKET, record.key_id, record.model_dump(mode="json"), tenant_id)
+        self._keys.pop(tenant_id, None)
+
+        logger.info(f"签发API Key: {tenant_id}/{record.key_id} ({name}, {role.value})")
+        return self._info(record), api_key
+
+    async def list(self, tenant_id: str) -> List[ApiKeyInfo]:
+        """列出租户的全部Key（含已吊销），直接从存储读取"""
+        return [self._info(record) for record in await self._read(tenant_id)]
+
+    async def get(self, tenant_id: str, key_id: str) -> Optional[ApiKeyInfo]:
+        """
+        读取单个Key，直接从存储读取
+
+        Returns:
+            Key信息，Key不存在时返回None
+        """
+        if not self._is_key_id(key_id):
+            return None
+        data = await get_store().aget(API_KEYS_BUCKET, key_id, tenant_id)
+        return self._info(StoredApiKey(**data)) if data else None
+
+    async def revoke(self, tenant_id: str, key_id: str) -> Optional[ApiKeyInfo]:
+        """
+        吊销Key
+
+        Returns:
+            吊销后的Key信息，Key不存在时返回None
+        """
+        if not self._is_key_id(key_id):
+            return None
+        revoked = []
+
+        def mutate(current):
+            if current is None:
+                return None
+            record = StoredApiKey(**current)
+            if record.revoked_at is None:
+                record.revoked_at = datetime.now()
+                revoked.append(record.key_id)
+            return record.model_dump(mode="json")
+
+        data = await get_store().aupdate(API_KEYS_BUCKET, key_id, mutate, tenant_id)
+        if data is None:
+            return None
+        self._keys.pop(tenant_id, None)
+        if revoked:
+            logger.info(f"吊销API Key: {tenant_id}/{key_id}")
+        return self._info(StoredApiKey(**data))
+
+    async def rotate(self, tenant_id: str, key_id: str) -> Optional[Tuple[ApiKeyInfo, str]]:
+        """
+        轮换Key：生成新的明文并立即使旧Key失效，名称、角色和限额保持不变
+
+        Returns:
+            (Key信息, 新的明文Key)，Key不存在或已吊销时返回None
+        """
+        if not self._is_key_id(key_id):
+            return None
+        api_key = self._generate()
+
+        def mutate(current):
+            if current is None:
+                return None
+            record = StoredApiKey(**current)
+            if record.revoked_at is not None:
+                return None
+            record.key_hash = hash_api_key(api_key)
+            record.prefix = api_key[:len(KEY_PREFIX) + 6]
+            record.rotated_at = datetime.now()
+            return record.model_dump(mode="json")
+
+        data = await get_store().aupdate(API_KEYS_BUCKET, key_id, mutate, tenant_id)
+        if data is None:
+            return None
+        self._keys.pop(tenant_id, None)
+
+        logger.info(f"轮换API Key: {tenant_id}/{key_id}")
+        return self._info(StoredApiKey(**data)), api_key
+
+    async def find(self, tenant_id: str, api_key: str) -> Optional[ApiKeyInfo]:
+        """
+        按明文查找有效的Key
+
+        Returns:
+            Key信息，未找到或已吊销时返回None
+        """
+        if not api_key:
+            return None
+        key_hash = hash_api_key(api_key)
+        for record in await self._load(tenant_id):
+            if record.revoked_at is None and hmac.compare_digest(key_hash, record.key_hash):
+                return self._info(record)
+        return None
+
+    async def has_active_keys(self, tenant_id: str) -> bool:
+        """租户是否存在未吊销的Key"""
+        return any(record.revoked_at is None for record in await self._load(tenant_id))
+
+    @staticmethod
+    def _generate() -> str:
+        return KEY_PREFIX + secrets.token_urlsafe(32)
+
+    @staticmethod
+    def _is_key_id(key_id: str) -> bool:
+        """key_id为签发时生成的UUID，其他值不用作存储键"""
+        try:
+            return str(uuid.UUID(key_id)) == key_id
+        except ValueError:
+            return False
+
+    @staticmethod
+    def _info(record: StoredApiKey) -> ApiKeyInfo:
+        return ApiKeyInfo(**record.model_dump(exclude={"key_hash"}))
+
+    async def _load(self, tenant_id: str) -> List[StoredApiKey]:
+        """
+        认证使用的Key列表，缓存未过期时不访问存储
+
+        Raises:
+            UnavailableError: 存储不可用
+        """
+        cached = self._keys.get(tenant_id)
+        if cached and time.monotonic() - cached[0] < settings.API_KEY_CACHE_SECONDS:
+            return cached[1]
+
+        try:
+            keys = await self._read(tenant_id)
+        except Exception as e:
+            logger.error(f"读取API Key失败: {tenant_id} - {str(e)}")
+            # 读不到Key不能当作没有Key，否则会放行匿名访问
+            raise UnavailableError("暂时无法读取API Key，请稍后重试") from e
+
+        self._keys[tenant_id] = (time.monotonic(), keys)
+        return keys
+
+    @staticmethod
+    async def _read(tenant_id: str) -> List[StoredApiKey]:
+        keys = [StoredApiKey(**item) for item in await get_store().avalues(API_KEYS_BUCKET, tenant_id)]
+        keys.sort(key=lambda record: record.created_at)
+        return keys
+
+
+# 创建全局API Key存储实例
+api_key_store = ApiKeyStore()
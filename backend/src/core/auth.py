@@ -0,0 +1,155 @@
+"""
+身份认证与访问控制
+根据租户API Key识别调用方及其角色，并提供按角色判断权限的工具
+"""
+
+import hmac
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Iterator, List, Optional
+
+from pydantic import BaseModel, Field
+
+from ..models.schemas import Role
+from .config import settings
+from .api_keys import api_key_store
+from .tenancy import (
+    ApiKeyEntry,
+    get_current_tenant,
+    get_tenant_quota_bytes,
+    get_tenant_rate_limit,
+    get_tenant_settings,
+)
+
+
+# 初始管理员Key对应的用户标识
+BOOTSTRAP_ADMIN_USER = "bootstrap-admin"
+
+# 角色等级，高等级拥有低等级的全部权限
+ROLE_RANK = {
+    Role.VIEWER: 0,
+    Role.EDITOR: 1,
+    Role.ADMIN: 2,
+    Role.OPERATOR: 3,
+}
+
+
+class Principal(BaseModel):
+    """当前调用方"""
+    user: str = Field(..., description="用户标识")
+    role: Role = Field(..., description="角色")
+    tenant_id: str = Field(..., description="所属租户")
+    key_id: Optional[str] = Field(None, description="签发的API Key标识，配置文件中的Key为空")
+    rate_limit_per_minute: Optional[int] = Field(None, description="Key级每分钟请求数上限覆盖")
+    quota_bytes: Optional[int] = Field(None, description="Key级存储配额，同时受租户配额限制")
+
+
+_current_principal: ContextVar[Optional[Principal]] = ContextVar("current_principal", default=None)
+
+
+def anonymous_principal(tenant_id: Optional[str] = None) -> Principal:
+    """未配置API Key时的匿名调用方"""
+    return Principal(
+        user="anonymous",
+        role=Role(settings.ANONYMOUS_ROLE),
+        tenant_id=tenant_id or get_current_tenant()
+    )
+
+
+def get_current_principal() -> Principal:
+    """当前请求的调用方，后台任务等无请求上下文时视为匿名"""
+    return _current_principal.get() or anonymous_principal()
+
+
+@contextmanager
+def use_principal(principal: Principal) -> Iterator[None]:
+    """
+    在上下文中设置当前调用方
+
+    Args:
+        principal: 调用方
+    """
+    token = _current_principal.set(principal)
+    try:
+        yield
+    finally:
+        _current_principal.reset(token)
+
+
+def configured_api_keys(tenant_id: str) -> List[ApiKeyEntry]:
+    """租户配置文件中的API Key，默认租户还包括初始管理员Key"""
+    entries = list(get_tenant_settings(tenant_id).api_keys)
+    if tenant_id == settings.DEFAULT_TENANT and settings.BOOTSTRAP_ADMIN_KEY:
+        entries.append(ApiKeyEntry(key=settings.BOOTSTRAP_ADMIN_KEY, user=BOOTSTRAP_ADMIN_USER, role=Role.ADMIN))
+    return entries
+
+
+async def authenticate(tenant_id: str, api_key: str) -> Optional[Principal]:
+    """
+    根据API Key识别调用方
+
+    Args:
+        tenant_id: 租户ID
+        api_key: 请求携带的API Key
+
+    Returns:
+        调用方；租户既未配置也未签发API Key且未启用OIDC时返回匿名调用方，Key无效时返回None
+
+    Raises:
+        UnavailableError: 无法读取签发的API Key，不能判断是否允许匿名访问
+    """
+    entries = configured_api_keys(tenant_id)
+    for entry in entries:
+        if api_key and hmac.compare_digest(api_key, entry.key):
+            return Principal(user=entry.user or f"key:{entry.key[:6]}", role=entry.role, tenant_id=tenant_id)
+
+    issued = await api_key_store.find(tenant_id, api_key)
+    if issued:
+        # 以key_id作为用户标识，同名的Key不能互相查看任务
+        return Principal(
+            user=issued.key_id,
+            role=issued.role,
+            tenant_id=tenant_id,
+            key_id=issued.key_id,
+            rate_limit_per_minute=issued.rate_limit_per_minute,
+            quota_bytes=issued.quota_bytes
+        )
+
+    # 启用OIDC后所有请求都需要认证
+    if not entries and not settings.OIDC_ISSUER and not await api_key_store.has_active_keys(tenant_id):
+        return anonymous_principal(tenant_id)
+
+    return None
+
+
+def effective_rate_limit(principal: Optional[Principal], tenant_id: str) -> int:
+    """调用方的每分钟请求数上限，Key未单独设置时使用租户限制"""
+    if principal and principal.rate_limit_per_minute is not None:
+        return principal.rate_limit_per_minute
+    return get_tenant_rate_limit(tenant_id)
+
+
+def effective_quota_bytes(principal: Optional[Principal] = None) -> int:
+    """
+    调用方的存储配额：Key单独设置的配额不能超过租户配额
+
+    Returns:
+        Key配额和租户配额中较小的一个（0表示不限制）
+    """
+    principal = principal or get_current_principal()
+    tenant_quota = get_tenant_quota_bytes(principal.tenant_id)
+    if not principal.quota_bytes:
+        return tenant_quota
+    if tenant_quota <= 0:
+        return principal.quota_bytes
+    return min(principal.quota_bytes, tenant_quota)
+
+
+def has_role(principal: Principal, required: Role) -> bool:
+    """调用方是否具备所需角色"""
+    return ROLE_RANK[principal.role] >= ROLE_RANK[required]
+
+
+def is_admin(principal: Optional[Principal] = None) -> bool:
+    """调用方是否为管理员"""
+    return has_role(principal or get_current_principal(), Role.ADMIN)
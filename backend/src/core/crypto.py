@@ -0,0 +1,43 @@
+"""
+敏感数据加密
+使用SECRET_ENCRYPTION_KEY（Fernet密钥）加密需要落盘的令牌等凭据
+"""
+
+from cryptography.fernet import Fernet, InvalidToken
+
+from .config import settings
+
+
+def _fernet() -> Fernet:
+    if not settings.SECRET_ENCRYPTION_KEY:
+        raise RuntimeError("未配置SECRET_ENCRYPTION_KEY，无法保存加密凭据")
+    return Fernet(settings.SECRET_ENCRYPTION_KEY.encode("ascii"))
+
+
+def encrypt_secret(value: str) -> str:
+    """
+    加密字符串
+
+    Args:
+        value: 明文
+
+    Returns:
+        密文（URL安全的Base64）
+    """
+    return _fernet().encrypt(value.encode("utf-8")).decode("ascii")
+
+
+def decrypt_secret(token: str) -> str:
+    """
+    解密字符串
+
+    Args:
+        token: encrypt_secret生成的密文
+
+    Returns:
+        明文
+    """
+    try:
+        return _fernet().decrypt(token.encode("ascii")).decode("utf-8")
+    except InvalidToken:
+        raise RuntimeError("凭据解密失败，SECRET_ENCRYPTION_KEY可能已变更")
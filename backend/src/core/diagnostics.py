@@ -0,0 +1,43 @@
+"""
+响应警告收集
+分析和拆分过程中遇到的非致命问题通过上下文收集，由调用方放入响应的warnings，而不只是写日志
+"""
+
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Iterator, List, Optional
+
+from ..models.schemas import ResponseWarning, WarningCode
+
+
+_current_warnings: ContextVar[Optional[List[ResponseWarning]]] = ContextVar("current_warnings", default=None)
+
+
+@contextmanager
+def collect_warnings() -> Iterator[List[ResponseWarning]]:
+    """
+    在上下文中收集警告
+
+    Yields:
+        收集到的警告列表，上下文结束后仍可读取
+    """
+    warnings: List[ResponseWarning] = []
+    token = _current_warnings.set(warnings)
+    try:
+        yield warnings
+    finally:
+        _current_warnings.reset(token)
+
+
+def add_warning(code: WarningCode, message: str, **details) -> None:
+    """
+    记录一条警告，不在收集上下文中时忽略
+
+    Args:
+        code: 警告代码
+        message: 警告描述
+        **details: 警告详情
+    """
+    warnings = _current_warnings.get()
+    if warnings is not None:
+        warnings.append(ResponseWarning(code=code, message=message, details=details))
@@ -0,0 +1,156 @@
+"""
+已解析PDF文档缓存
+分析和拆分共用同一份已打开的文档，避免大文件被重复解析
+"""
+
+import threading
+from collections import OrderedDict
+from contextlib import contextmanager
+from typing import Dict, Iterator, Optional
+
+import fitz  # PyMuPDF
+from loguru import logger
+
+from .config import settings
+from .errors import EncryptedError
+from .memory import estimate_document_bytes
+
+
+def _open(file_path: str) -> fitz.Document:
+    """
+    打开PDF
+
+    Raises:
+        EncryptedError: 文件需要密码才能读取
+    """
+    doc = fitz.open(file_path)
+    if doc.needs_pass:
+        doc.close()
+        raise EncryptedError("文件已加密，请上传未加密的PDF")
+    return doc
+
+
+class _CacheEntry:
+    """缓存条目"""
+
+    def __init__(self, doc: fitz.Document, size: int):
+        self.doc = doc
+        self.size = size
+        self.refs = 0
+        self.evicted = False
+
+
+class DocumentCache:
+    """按文件哈希缓存已打开文档的LRU缓存，按估算内存占用限制容量"""
+
+    def __init__(self, max_bytes: int):
+        self.max_bytes = max_bytes
+        self._entries: "OrderedDict[str, _CacheEntry]" = OrderedDict()
+        self._lock = threading.Lock()
+        self._total_bytes = 0
+
+    @contextmanager
+    def open(self, file_path: str, key: Optional[str] = None) -> Iterator[fitz.Document]:
+        """
+        获取已解析的文档，使用期间不会被淘汰
+
+        Args:
+            file_path: PDF文件路径
+            key: 缓存键（文件内容哈希），为空时不使用缓存
+
+        Yields:
+            PDF文档对象，调用方不应自行关闭
+        """
+        if not key or self.max_bytes <= 0:
+            doc = _open(file_path)
+            try:
+                yield doc
+            finally:
+                doc.close()
+            return
+
+        entry = self._acquire(file_path, key)
+        try:
+            yield entry.doc
+        finally:
+            self._release(entry)
+
+    def _acquire(self, file_path: str, key: str) -> _CacheEntry:
+        with self._lock:
+            entry = self._entries.get(key)
+            if entry:
+                self._entries.move_to_end(key)
+                entry.refs += 1
+                return entry
+
+        # 解析在锁外进行，避免阻塞其他文档的读取
+        doc = _open(file_path)
+        # 以文件大小估算解析后的内存占用
+        size = estimate_document_bytes(file_path)
+
+        with self._lock:
+            existing = self._entries.get(key)
+            if existing:
+                doc.close()
+                existing.refs += 1
+                self._entries.move_to_end(key)
+                return existing
+
+            entry = _CacheEntry(doc, size)
+            entry.refs = 1
+            self._entries[key] = entry
+            self._total_bytes += size
+            self._evict_locked()
+            logger.debug(f"文档缓存加载: {key[:12]} - 当前占用 {self._total_bytes} 字节")
+            return entry
+
+    def _release(self, entry: _CacheEntry) -> None:
+        with self._lock:
+            entry.refs -= 1
+            if entry.evicted and entry.refs == 0:
+                entry.doc.close()
+            self._evict_locked()
+
+    def _evict_locked(self) -> None:
+        """淘汰最久未使用且空闲的文档，直到占用低于上限"""
+        for key in list(self._entries.keys()):
+            if self._total_bytes <= self.max_bytes:
+                break
+            entry = self._entries[key]
+            if entry.refs > 0:
+                continue
+            self._remove_locked(key)
+
+    def _remove_locked(self, key: str) -> None:
+        entry = self._entries.pop(key)
+        self._total_bytes -= entry.size
+        entry.evicted = True
+        if entry.refs == 0:
+            entry.doc.close()
+        logger.debug(f"文档缓存淘汰: {key[:12]}")
+
+    def evict(self, key: Optional[str]) -> None:
+        """
+        主动淘汰指定文档（如文件被删除）
+
+        Args:
+            key: 缓存键
+        """
+        if not key:
+            return
+        with self._lock:
+            if key in self._entries:
+                self._remove_locked(key)
+
+    def stats(self) -> Dict[str, int]:
+        """缓存统计"""
+        with self._lock:
+            return {
+                "documents": len(self._entries),
+                "estimated_bytes": self._total_bytes,
+                "max_bytes": self.max_bytes
+            }
+
+
+# 创建全局文档缓存实例
+document_cache = DocumentCache(settings.DOCUMENT_CACHE_MAX_BYTES)
@@ -0,0 +1,145 @@
+"""
+领域错误
+服务层按错误类型抛出，由应用统一映射为HTTP状态码和错误代码，接口不再按错误信息猜测404还是500。
+页码超出范围和文件已加密同时是ValueError，按ValueError处理的调用方不受影响
+"""
+
+from typing import Any, Dict, Optional
+
+from ..models.schemas import ErrorCode
+
+
+# 错误代码对应的HTTP状态码
+ERROR_STATUS: Dict[ErrorCode, int] = {
+    ErrorCode.INVALID_REQUEST: 400,
+    ErrorCode.INVALID_RANGE: 400,
+    ErrorCode.UNAUTHORIZED: 401,
+    ErrorCode.FORBIDDEN: 403,
+    ErrorCode.NOT_FOUND: 404,
+    ErrorCode.CONFLICT: 409,
+    ErrorCode.TOO_LARGE: 413,
+    ErrorCode.QUOTA_EXCEEDED: 507,
+    ErrorCode.ENCRYPTED: 422,
+    ErrorCode.CORRUPT: 422,
+    ErrorCode.UNSUPPORTED: 422,
+    ErrorCode.RATE_LIMITED: 429,
+    ErrorCode.INTERNAL: 500,
+    ErrorCode.UNAVAILABLE: 503,
+    ErrorCode.TIMEOUT: 504,
+}
+
+# 直接以状态码返回的错误（HTTPException、中间件拒绝）使用的错误代码
+STATUS_CODES: Dict[int, ErrorCode] = {
+    400: ErrorCode.INVALID_REQUEST,
+    401: ErrorCode.UNAUTHORIZED,
+    403: ErrorCode.FORBIDDEN,
+    404: ErrorCode.NOT_FOUND,
+    408: ErrorCode.TIMEOUT,
+    409: ErrorCode.CONFLICT,
+    413: ErrorCode.TOO_LARGE,
+    422: ErrorCode.INVALID_REQUEST,
+    429: ErrorCode.RATE_LIMITED,
+    503: ErrorCode.UNAVAILABLE,
+    504: ErrorCode.TIMEOUT,
+    507: ErrorCode.QUOTA_EXCEEDED,
+}
+
+
+class DomainError(Exception):
+    """领域错误基类"""
+    code = ErrorCode.INTERNAL
+
+    def __init__(self, message: str):
+        super().__init__(message)
+        self.message = message
+
+    @property
+    def status_code(self) -> int:
+        """对应的HTTP状态码"""
+        return ERROR_STATUS[self.code]
+
+
+class NotFoundError(DomainError):
+    """资源不存在"""
+    code = ErrorCode.NOT_FOUND
+
+
+class InvalidRangeError(DomainError, ValueError):
+    """页码或章节序号超出范围"""
+    code = ErrorCode.INVALID_RANGE
+
+
+class EncryptedError(DomainError, ValueError):
+    """文件已加密，需要密码才能读取"""
+    code = ErrorCode.ENCRYPTED
+
+
+class ConflictError(DomainError):
+    """与资源当前状态冲突"""
+    code = ErrorCode.CONFLICT
+
+
+class ResourceLimitError(DomainError):
+    """超出单个任务的CPU或内存限制"""
+    code = ErrorCode.TOO_LARGE
+
+
+class QuotaExceededError(DomainError):
+    """写入后将超出租户或API Key的存储配额"""
+    code = ErrorCode.QUOTA_EXCEEDED
+
+
+class UnavailableError(DomainError):
+    """依赖的服务（如元数据存储）暂时不可用"""
+    code = ErrorCode.UNAVAILABLE
+
+
+class EngineError(DomainError, RuntimeError):
+    """外部引擎（Ghostscript、Tesseract）执行失败，错误代码按引擎输出归类，保留退出码和输出摘录供排查"""
+
+    def __init__(self, message: str, code: ErrorCode, engine: str, returncode: Optional[int], output: str):
+        super().__init__(message)
+        self.code = code
+        self.engine = engine
+        self.returncode = returncode
+        self.output = output
+
+    @property
+    def details(self) -> Dict[str, Any]:
+        """诊断信息"""
+        return {"engine": self.engine, "exit_code": self.returncode, "output": self.output}
+
+
+def code_for_status(status: int) -> ErrorCode:
+    """直接以状态码返回的错误对应的错误代码"""
+    if status in STATUS_CODES:
+        return STATUS_CODES[status]
+    return ErrorCode.INTERNAL if status >= 500 else ErrorCode.INVALID_REQUEST
+
+
+def code_for_exception(exc: Exception) -> ErrorCode:
+    """任务失败等非HTTP场景下异常对应的错误代码"""
+    if isinstance(exc, DomainError):
+        return exc.code
+    if isinstance(exc, ValueError):
+        return ErrorCode.INVALID_REQUEST
+    return ErrorCode.INTERNAL
+
+
+def details_for_exception(exc: Exception) -> Optional[Dict[str, Any]]:
+    """任务失败时随错误代码保存的诊断信息，外部引擎以外的错误没有"""
+    if isinstance(exc, EngineError):
+        return exc.details
+    return None
+
+
+def is_engine_crash(exc: Exception) -> bool:
+    """外部引擎因超出资源限制被终止或异常退出（不能归类为文件加密、损坏等），同一文件反复出现时隔离"""
+    if isinstance(exc, ResourceLimitError):
+        return True
+    return isinstance(exc, EngineError) and exc.code == ErrorCode.INTERNAL
+
+
+def error_payload(detail: Any, code: ErrorCode) -> dict:
+    """错误响应体，与 ErrorResponse 一致"""
+    return {"detail": detail, "code": code.value}
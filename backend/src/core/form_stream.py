@@ -0,0 +1,151 @@
+"""
+流式multipart解析
+直接从请求体解析multipart/form-data，文件部分边接收边交给写入器，
+不经过框架的临时文件（大文件只落盘一次）；普通字段收集到字典中
+"""
+
+import asyncio
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from fastapi import HTTPException, Request
+from multipart.multipart import MultipartParser, parse_options_header
+
+
+# 普通表单字段的大小上限（字节）
+MAX_FIELD_SIZE = 64 * 1024
+
+# 普通表单字段的数量上限
+MAX_FIELDS = 32
+
+# 每个部分的头部总大小上限（字节）
+MAX_PART_HEADER_SIZE = 8 * 1024
+
+
+async def parse_multipart(
+    request: Request,
+    open_file: Callable[[str, str, Dict[str, str]], Any],
+    max_field_size: int = MAX_FIELD_SIZE,
+    max_files: int = 1,
+    max_fields: int = MAX_FIELDS,
+    max_header_size: int = MAX_PART_HEADER_SIZE
+) -> Dict[str, str]:
+    """
+    流式解析请求体
+
+    Args:
+        request: 请求
+        open_file: 遇到文件部分时调用，参数为(字段名, 文件名, 已解析的字段)，返回带write方法的写入器；
+            write在线程池中调用，可直接写磁盘，同一文件的数据按顺序写入
+        max_field_size: 普通字段的大小上限
+        max_files: 文件部分的数量上限
+        max_fields: 普通字段的数量上限
+        max_header_size: 每个部分的头部总大小上限
+
+    Returns:
+        普通字段
+
+    Raises:
+        HTTPException: 请求不是multipart、格式不完整、字段或头部过大、字段数或文件数超过上限（400）
+    """
+    content_type, params = parse_options_header(request.headers.get("content-type", ""))
+    if content_type != b"multipart/form-data" or not params.get(b"boundary"):
+        raise HTTPException(status_code=400, detail="请求必须是multipart/form-data")
+
+    fields: Dict[str, str] = {}
+    headers: Dict[bytes, bytes] = {}
+    header_field = bytearray()
+    header_value = bytearray()
+    part: Dict[str, Any] = {}
+    sink: Optional[Any] = None
+    files = 0
+    field_count = 0
+    header_size = 0
+    pending: List[Tuple[Any, bytes]] = []
+    finished = False
+
+    def on_part_begin():
+        nonlocal header_size
+        headers.clear()
+        part.clear()
+        header_size = 0
+
+    def count_header(size: int) -> None:
+        # 解析器不限制头部长度，避免大量或超长的头部占用内存
+        nonlocal header_size
+        header_size += size
+        if header_size > max_header_size:
+            raise HTTPException(status_code=400, detail=f"表单部分的头部超过 {max_header_size} 字节")
+
+    def on_header_field(data, start, end):
+        count_header(end - start)
+        header_field.extend(data[start:end])
+
+    def on_header_value(data, start, end):
+        count_header(end - start)
+        header_value.extend(data[start:end])
+
+    def on_header_end():
+        headers[bytes(header_field).lower()] = bytes(header_value)
+        header_field.clear()
+        header_value.clear()
+
+    def on_headers_finished():
+        nonlocal sink, files, field_count
+        _, options = parse_options_header(headers.get(b"content-disposition", b""))
+        name = options.get(b"name", b"").decode("utf-8", "replace")
+        filename = options.get(b"filename")
+        if filename is None:
+            field_count += 1
+            if field_count > max_fields:
+                raise HTTPException(status_code=400, detail=f"表单字段数量超过 {max_fields} 个")
+            part.update(name=name, value=bytearray())
+            return
+        if files >= max_files:
+            detail = "每个请求只能上传一个文件" if max_files == 1 else f"每个请求最多上传 {max_files} 个文件"
+            raise HTTPException(status_code=400, detail=detail)
+        files += 1
+        sink = open_file(name, filename.decode("utf-8", "replace"), fields)
+        part.update(name=name, file=True)
+
+    def on_part_data(data, start, end):
+        if part.get("file"):
+            pending.append((sink, bytes(data[start:end])))
+            return
+        value = part["value"]
+        value.extend(data[start:end])
+        if len(value) > max_field_size:
+            raise HTTPException(status_code=400, detail=f"表单字段 {part['name']} 超过 {max_field_size} 字节")
+
+    def on_part_end():
+        if not part.get("file"):
+            fields[part["name"]] = part["value"].decode("utf-8", "replace")
+
+    def on_end():
+        nonlocal finished
+        finished = True
+
+    parser = MultipartParser(params[b"boundary"], {
+        "on_part_begin": on_part_begin,
+        "on_header_field": on_header_field,
+        "on_header_value": on_header_value,
+        "on_header_end": on_header_end,
+        "on_headers_finished": on_headers_finished,
+        "on_part_data": on_part_data,
+        "on_part_end": on_part_end,
+        "on_end": on_end,
+    })
+
+    async for chunk in request.stream():
+        parser.write(chunk)
+        # 每收到一块就写出，写盘和哈希在线程池中进行，不阻塞事件循环；一块中可能包含前后两个文件的数据
+        while pending:
+            target = pending[0][0]
+            data = []
+            while pending and pending[0][0] is target:
+                data.append(pending.pop(0)[1])
+            await asyncio.to_thread(target.write, b"".join(data))
+    parser.finalize()
+
+    if not finished:
+        raise HTTPException(status_code=400, detail="请求体不完整")
+    return fields
@@ -0,0 +1,138 @@
+"""
+主节点选举
+多副本共享存储时，延迟任务派发、Webhook重试和过期任务清理只应由一个副本执行。
+各副本定期在元数据存储中争抢同一条租约记录，持有未过期租约的副本为主节点；
+各副本同时续写自己的心跳记录，用于判断处理中的任务所在副本是否仍然存活
+"""
+
+import asyncio
+import socket
+import time
+import uuid
+from typing import Any, Dict, Optional
+
+from loguru import logger
+
+from .config import settings
+from .store import get_store
+
+
+LEASES_BUCKET = "leases"
+
+# 副本心跳记录键的前缀
+NODE_KEY_PREFIX = "node:"
+
+
+class LeaderElection:
+    """基于存储租约的主节点选举"""
+
+    def __init__(self, name: str = "background-jobs"):
+        self.name = name
+        self.node_id = settings.NODE_ID or f"{socket.gethostname()}-{uuid.uuid4().hex[:8]}"
+        self._is_leader = False
+        self._task: Optional[asyncio.Task] = None
+
+    @property
+    def is_leader(self) -> bool:
+        """当前副本是否为主节点"""
+        return self._is_leader
+
+    async def start(self) -> None:
+        """立即写入心跳、参与一次选举并启动续约循环"""
+        await self.heartbeat()
+        await self.try_acquire()
+        if self._task is None:
+            self._task = asyncio.create_task(self._renew_loop())
+
+    async def stop(self) -> None:
+        """停止续约并主动释放租约，其他副本无需等待过期即可接管"""
+        if self._task:
+            self._task.cancel()
+            self._task = None
+        try:
+            await get_store().adelete(LEASES_BUCKET, f"{NODE_KEY_PREFIX}{self.node_id}")
+        except Exception as e:
+            logger.error(f"删除副本心跳失败: {str(e)}")
+        if self._is_leader:
+            try:
+                await get_store().aupdate(LEASES_BUCKET, self.name, self._release)
+            except Exception as e:
+                logger.error(f"释放主节点租约失败: {str(e)}")
+            self._is_leader = False
+
+    async def try_acquire(self) -> bool:
+        """
+        获取或续约租约
+
+        Returns:
+            当前副本是否为主节点
+        """
+        now = time.time()
+
+        def acquire(current: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+            if current and current.get("holder") != self.node_id and current.get("expires_at", 0) > now:
+                return None
+            return {"holder": self.node_id, "expires_at": now + settings.LEADER_LEASE_TTL}
+
+        try:
+            acquired = await get_store().aupdate(LEASES_BUCKET, self.name, acquire) is not None
+        except Exception as e:
+            # 无法确认租约时放弃主节点身份，宁可暂停后台任务也不重复执行
+            logger.error(f"主节点选举失败: {str(e)}")
+            acquired = False
+
+        if acquired != self._is_leader:
+            logger.info(f"{'成为' if acquired else '不再是'}主节点: {self.node_id}")
+        self._is_leader = acquired
+        return acquired
+
+    async def heartbeat(self) -> None:
+        """续写当前副本的心跳记录"""
+        try:
+            await get_store().aput(
+                LEASES_BUCKET,
+                f"{NODE_KEY_PREFIX}{self.node_id}",
+                {"node_id": self.node_id, "expires_at": time.time() + settings.LEADER_LEASE_TTL}
+            )
+        except Exception as e:
+            logger.error(f"写入副本心跳失败: {str(e)}")
+
+    async def is_node_alive(self, node_id: str) -> bool:
+        """
+        副本是否仍然存活
+
+        Args:
+            node_id: 副本节点ID
+
+        Returns:
+            是当前副本或心跳未过期时为True，无法读取心跳时按存活处理，避免误判其他副本的任务
+        """
+        if node_id == self.node_id:
+            return True
+        try:
+            record = await get_store().aget(LEASES_BUCKET, f"{NODE_KEY_PREFIX}{node_id}")
+        except Exception as e:
+            logger.error(f"读取副本心跳失败: {str(e)}")
+            return True
+        return bool(record) and record.get("expires_at", 0) > time.time()
+
+    def status(self) -> Dict[str, Any]:
+        """选举状态，用于健康检查"""
+        return {"node_id": self.node_id, "is_leader": self._is_leader}
+
+    def _release(self, current: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+        if not current or current.get("holder") != self.node_id:
+            return None
+        return {"holder": None, "expires_at": 0}
+
+    async def _renew_loop(self) -> None:
+        # 在租约过期前多次续约，容忍偶发的存储故障
+        interval = max(settings.LEADER_LEASE_TTL / 3, 1)
+        while True:
+            await asyncio.sleep(interval)
+            await self.heartbeat()
+            await self.try_acquire()
+
+
+# 创建全局主节点选举实例
+leader_election = LeaderElection()
@@ -0,0 +1,193 @@
+"""
+引擎子进程资源限制
+Ghostscript、Tesseract等子进程启动时设置CPU时间和地址空间上限（rlimit），配置了 TASK_CGROUP_ROOT
+（委派给本服务的cgroup v2目录）时每个子进程再放入单独的cgroup，限制内存和可用CPU核数，
+单个异常PDF不会耗尽整台机器的CPU和内存而拖慢其他用户的任务。
+限制由exec包装进程设置（服务进程有多个线程，fork后不再执行Python代码），cgroup由父进程在子进程启动后写入，
+包装进程等父进程写入后才exec引擎命令；只有父进程确认加入了cgroup时才不设地址空间上限，加入失败时仍按rlimit限制内存
+"""
+
+import os
+import signal
+import sys
+import uuid
+from contextlib import contextmanager
+from pathlib import Path
+from typing import Iterator, List, Optional, Sequence, Tuple
+
+from loguru import logger
+
+from .config import settings
+
+
+# cpu.max 的调度周期（微秒）
+CGROUP_CPU_PERIOD = 100000
+
+# 收到SIGXCPU后到硬上限（SIGKILL）之间留出的秒数
+CPU_HARD_LIMIT_GRACE = 5
+
+# 父进程放行时写入的字节：已加入cgroup（由cgroup限制内存）或加入失败（保留地址空间上限）
+GATE_ATTACHED = b"1"
+GATE_DETACHED = b"0"
+
+# exec包装：参数依次为CPU秒数、地址空间字节数、等待父进程放行的管道（-1表示不等待）和引擎命令
+EXEC_WRAPPER = f"""\
+import os, resource, sys
+cpu, memory, gate = (int(value) for value in sys.argv[1:4])
+if cpu:
+    resource.setrlimit(resource.RLIMIT_CPU, (cpu, cpu + {CPU_HARD_LIMIT_GRACE}))
+attached = False
+if gate >= 0:
+    attached = os.read(gate, 1) == {GATE_ATTACHED!r}
+    os.close(gate)
+if memory and not attached:
+    resource.setrlimit(resource.RLIMIT_AS, (memory, memory))
+os.execvp(sys.argv[4], sys.argv[4:])
+"""
+
+
+class EngineLimits:
+    """一个引擎子进程的资源限制"""
+
+    def __init__(self, cgroup: Optional[Path] = None):
+        self.cgroup = cgroup
+        self.cpu_seconds = settings.TASK_PROCESS_CPU_SECONDS
+        self.memory_bytes = settings.TASK_PROCESS_MEMORY_BYTES
+        # 子进程是否已确认加入cgroup
+        self.attached = False
+        # 父进程把子进程加入cgroup后写入一个字节放行
+        self._gate: Optional[Tuple[int, int]] = os.pipe() if cgroup else None
+
+    @property
+    def enabled(self) -> bool:
+        """是否配置了任何限制"""
+        return bool(self.cpu_seconds or self.memory_bytes or self.cgroup)
+
+    @property
+    def pass_fds(self) -> Tuple[int, ...]:
+        """需要传给子进程的文件描述符（等待放行的管道）"""
+        return (self._gate[0],) if self._gate else ()
+
+    def command(self, argv: Sequence[str]) -> List[str]:
+        """
+        加上exec包装的完整命令
+
+        Args:
+            argv: 引擎命令（可已带沙箱前缀）
+
+        Returns:
+            没有配置任何限制时为原命令
+        """
+        if not self.enabled:
+            return list(argv)
+        # 父进程确认加入cgroup时由cgroup按实际使用的内存限制，否则包装进程限制地址空间
+        gate = self._gate[0] if self._gate else -1
+        return [
+            sys.executable, "-I", "-S", "-c", EXEC_WRAPPER,
+            str(self.cpu_seconds), str(self.memory_bytes), str(gate),
+            *argv,
+        ]
+
+    def attach(self, pid: int) -> None:
+        """
+        子进程启动后把它加入cgroup并放行；写入失败时记录日志，子进程保留地址空间上限
+
+        Args:
+            pid: 子进程ID
+        """
+        if self.cgroup:
+            try:
+                (self.cgroup / "cgroup.procs").write_text(str(pid))
+                self.attached = True
+            except OSError as e:
+                logger.warning(f"子进程加入cgroup失败，改用地址空间上限: {self.cgroup} - {str(e)}")
+        self.close()
+
+    def close(self) -> None:
+        """放行子进程并关闭管道；子进程未启动或已放行时无操作"""
+        if not self._gate:
+            return
+        read_fd, write_fd = self._gate
+        self._gate = None
+        os.close(read_fd)
+        try:
+            os.write(write_fd, GATE_ATTACHED if self.attached else GATE_DETACHED)
+        except OSError:
+            pass
+        finally:
+            os.close(write_fd)
+
+    def exceeded(self, returncode: Optional[int]) -> Optional[str]:
+        """
+        子进程是否因超出资源限制被终止
+
+        Args:
+            returncode: 子进程退出码
+
+        Returns:
+            超出的限制说明，不是因资源限制退出时为None
+        """
+        if self.attached and self._oom_killed():
+            return f"超出内存上限（{self.memory_bytes} 字节）"
+        # 超过软上限时收到SIGXCPU，仍不退出时在硬上限被SIGKILL；在bubblewrap中运行时以128+信号值退出
+        killed = (signal.SIGXCPU, signal.SIGKILL)
+        if self.cpu_seconds and returncode is not None and (-returncode in killed or returncode - 128 in killed):
+            return f"超出CPU时间上限（{self.cpu_seconds}秒）"
+        return None
+
+    def _oom_killed(self) -> bool:
+        """cgroup中是否有进程因内存超限被终止"""
+        try:
+            for line in (self.cgroup / "memory.events").read_text().splitlines():
+                name, _, value = line.partition(" ")
+                if name == "oom_kill" and int(value) > 0:
+                    return True
+        except (OSError, ValueError):
+            pass
+        return False
+
+
+@contextmanager
+def engine_limits() -> Iterator[EngineLimits]:
+    """
+    为一个引擎子进程准备资源限制，子进程结束后退出时删除其cgroup
+
+    cgroup创建失败（目录未委派、没有写权限）时只记录日志，仍使用rlimit
+
+    Yields:
+        资源限制，启动子进程时使用其command和pass_fds，启动后调用attach
+    """
+    cgroup = _create_cgroup() if settings.TASK_CGROUP_ROOT else None
+    limits = EngineLimits(cgroup)
+    try:
+        yield limits
+    finally:
+        limits.close()
+        if cgroup:
+            try:
+                cgroup.rmdir()
+            except OSError as e:
+                logger.warning(f"删除子进程cgroup失败: {cgroup} - {str(e)}")
+
+
+def _create_cgroup() -> Optional[Path]:
+    """在TASK_CGROUP_ROOT下创建子进程的cgroup并写入内存和CPU上限"""
+    cgroup = Path(settings.TASK_CGROUP_ROOT) / f"engine-{uuid.uuid4().hex[:12]}"
+    try:
+        cgroup.mkdir()
+        if settings.TASK_PROCESS_MEMORY_BYTES:
+            (cgroup / "memory.max").write_text(str(settings.TASK_PROCESS_MEMORY_BYTES))
+            swap = cgroup / "memory.swap.max"
+            if swap.exists():
+                swap.write_text("0")
+        if settings.TASK_PROCESS_CPU_CORES:
+            quota = max(int(settings.TASK_PROCESS_CPU_CORES * CGROUP_CPU_PERIOD), 1000)
+            (cgroup / "cpu.max").write_text(f"{quota} {CGROUP_CPU_PERIOD}")
+    except OSError as e:
+        logger.warning(f"创建子进程cgroup失败，只使用rlimit: {cgroup} - {str(e)}")
+        try:
+            cgroup.rmdir()
+        except OSError:
+            pass
+        return None
+    return cgroup
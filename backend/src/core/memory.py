@@ -0,0 +1,122 @@
+"""
+内存控制
+提供可复用的拷贝缓冲区池，以及限制同时处理大文档数量的全局内存预算
+"""
+
+import os
+import asyncio
+import threading
+from contextlib import asynccontextmanager, contextmanager
+from typing import AsyncIterator, Dict, Iterator, List
+
+from loguru import logger
+
+from .config import settings
+from .errors import ResourceLimitError
+
+
+def estimate_document_bytes(file_path: str) -> int:
+    """
+    估算PDF解析后的内存占用
+
+    Args:
+        file_path: PDF文件路径
+
+    Returns:
+        估算字节数
+    """
+    return os.path.getsize(file_path) * settings.DOCUMENT_CACHE_SIZE_FACTOR
+
+
+class BufferPool:
+    """固定大小字节缓冲区池，避免拷贝大文件时反复分配内存"""
+
+    def __init__(self, buffer_size: int, max_buffers: int):
+        self.buffer_size = buffer_size
+        self.max_buffers = max_buffers
+        self._buffers: List[bytearray] = []
+        self._lock = threading.Lock()
+
+    @contextmanager
+    def buffer(self) -> Iterator[bytearray]:
+        """
+        借出一个缓冲区，使用完毕后自动归还
+
+        Yields:
+            长度为buffer_size的bytearray
+        """
+        with self._lock:
+            buf = self._buffers.pop() if self._buffers else None
+        if buf is None:
+            buf = bytearray(self.buffer_size)
+
+        try:
+            yield buf
+        finally:
+            with self._lock:
+                # 池满时直接丢弃，交给垃圾回收
+                if len(self._buffers) < self.max_buffers:
+                    self._buffers.append(buf)
+
+
+class MemoryBudget:
+    """全局内存预算，超出预算的文档处理需等待其他任务释放"""
+
+    def __init__(self, max_bytes: int, per_task_bytes: int = 0):
+        self.max_bytes = max_bytes
+        self.per_task_bytes = per_task_bytes
+        self._used = 0
+        self._waiting = 0
+        self._condition = asyncio.Condition()
+
+    @asynccontextmanager
+    async def reserve(self, nbytes: int, label: str = "") -> AsyncIterator[None]:
+        """
+        预留内存，预算不足时等待
+
+        Args:
+            nbytes: 预计占用的字节数，超过总预算时按总预算计（独占执行）
+            label: 日志中显示的标识
+
+        Raises:
+            ResourceLimitError: 超过单个任务的内存上限
+        """
+        if self.per_task_bytes > 0 and nbytes > self.per_task_bytes:
+            raise ResourceLimitError(f"文档预计占用 {nbytes} 字节内存，超出单个任务上限（{self.per_task_bytes} 字节）")
+
+        if self.max_bytes <= 0:
+            yield
+            return
+
+        nbytes = min(max(nbytes, 0), self.max_bytes)
+
+        async with self._condition:
+            if self._used + nbytes > self.max_bytes:
+                logger.info(f"内存预算不足，等待执行: {label} - 需要 {nbytes} 字节，已占用 {self._used} 字节")
+                self._waiting += 1
+                try:
+                    await self._condition.wait_for(lambda: self._used + nbytes <= self.max_bytes)
+                finally:
+                    self._waiting -= 1
+            self._used += nbytes
+
+        try:
+            yield
+        finally:
+            async with self._condition:
+                self._used -= nbytes
+                self._condition.notify_all()
+
+    def stats(self) -> Dict[str, int]:
+        """内存预算统计"""
+        return {
+            "used_bytes": self._used,
+            "max_bytes": self.max_bytes,
+            "per_task_bytes": self.per_task_bytes,
+            "waiting": self._waiting
+        }
+
+
+# 创建全局实例
+buffer_pool = BufferPool(settings.COPY_BUFFER_SIZE, settings.COPY_BUFFER_POOL_SIZE)
+memory_budget = MemoryBudget(settings.MEMORY_BUDGET_BYTES, settings.TASK_MEMORY_LIMIT_BYTES)
@@ -0,0 +1,84 @@
+"""
+运行指标收集模块
+在进程内汇总请求计数、延迟和流量，供监控接口读取
+"""
+
+import threading
+from collections import defaultdict
+from typing import Dict, Any
+
+
+class MetricsRegistry:
+    """进程内指标注册表"""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+        self._requests: Dict[str, Dict[str, Any]] = defaultdict(self._new_route_stats)
+        self._status_counts: Dict[str, int] = defaultdict(int)
+
+    @staticmethod
+    def _new_route_stats() -> Dict[str, Any]:
+        return {
+            "count": 0,
+            "errors": 0,
+            "latency_ms_sum": 0.0,
+            "latency_ms_max": 0.0,
+            "bytes_in": 0,
+            "bytes_out": 0
+        }
+
+    def observe_request(
+        self,
+        method: str,
+        route: str,
+        status: int,
+        latency_ms: float,
+        bytes_in: int,
+        bytes_out: int
+    ) -> None:
+        """
+        记录一次HTTP请求
+
+        Args:
+            method: 请求方法
+            route: 路由模板（避免按具体ID展开）
+            status: 响应状态码
+            latency_ms: 处理耗时（毫秒）
+            bytes_in: 请求体字节数
+            bytes_out: 响应体字节数
+        """
+        key = f"{method} {route}"
+        with self._lock:
+            stats = self._requests[key]
+            stats["count"] += 1
+            if status >= 500:
+                stats["errors"] += 1
+            stats["latency_ms_sum"] += latency_ms
+            stats["latency_ms_max"] = max(stats["latency_ms_max"], latency_ms)
+            stats["bytes_in"] += bytes_in
+            stats["bytes_out"] += bytes_out
+            self._status_counts[f"{status // 100}xx"] += 1
+
+    def snapshot(self) -> Dict[str, Any]:
+        """
+        获取当前指标快照
+
+        Returns:
+            指标字典
+        """
+        with self._lock:
+            routes = {}
+            for key, stats in self._requests.items():
+                item = dict(stats)
+                item["latency_ms_avg"] = round(stats["latency_ms_sum"] / stats["count"], 2) if stats["count"] else 0.0
+                routes[key] = item
+
+            return {
+                "requests": routes,
+                "status_counts": dict(self._status_counts),
+                "total_requests": sum(s["count"] for s in self._requests.values())
+            }
+
+
+# 创建全局指标实例
+metrics = MetricsRegistry()
@@ -0,0 +1,9 @@
+-- 元数据记录：按bucket分组，namespace为租户ID（全局数据为空串）
+CREATE TABLE IF NOT EXISTS records (
+    bucket     TEXT        NOT NULL,
+    namespace  TEXT        NOT NULL DEFAULT '',
+    key        TEXT        NOT NULL,
+    value      JSONB       NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (bucket, namespace, key)
+);
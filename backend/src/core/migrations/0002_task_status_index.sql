@@ -0,0 +1,4 @@
+-- 按状态查找待处理任务
+CREATE INDEX IF NOT EXISTS records_task_status_idx
+    ON records ((value->>'status'))
+    WHERE bucket = 'tasks';
@@ -0,0 +1,306 @@
+"""
+OIDC单点登录
+通过issuer的发现文档获取签名公钥，校验企业SSO签发的令牌，并把声明映射为调用方和角色。
+登录的state和nonce保存在元数据存储中，多副本部署时回调可以落在任意副本
+"""
+
+import hmac
+import re
+import secrets
+import time
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import urlencode
+
+import httpx
+import jwt
+from loguru import logger
+
+from ..models.schemas import Role
+from .auth import ROLE_RANK, Principal
+from .config import settings
+from .store import get_store
+from .tenancy import get_current_tenant
+
+# 登录state有效期（秒）
+STATE_TTL = 600
+
+# 登录state的存储bucket
+OIDC_STATES_BUCKET = "oidc_states"
+
+# state的格式（secrets.token_urlsafe），其他值不查询存储
+STATE_PATTERN = re.compile(r"[A-Za-z0-9_-]{16,64}")
+
+# 遇到未知kid时两次拉取公钥的最小间隔（秒），避免伪造令牌反复触发拉取
+JWKS_MIN_REFRESH_INTERVAL = 60
+
+# 允许的非对称签名算法
+ALLOWED_ALGORITHMS = ["RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256"]
+
+# 使用客户端密钥校验的算法，需要OIDC_ALLOW_HS256显式开启（客户端密钥泄露即可伪造任意令牌）
+HMAC_ALGORITHM = "HS256"
+
+
+class OIDCError(Exception):
+    """OIDC令牌或登录流程无效"""
+
+
+class OIDCProvider:
+    """OIDC身份提供方"""
+
+    def __init__(self):
+        self._discovery: Optional[Dict[str, Any]] = None
+        # kid -> 公钥
+        self._keys: Dict[str, Any] = {}
+        self._keys_loaded_at = 0.0
+
+    @property
+    def enabled(self) -> bool:
+        return bool(settings.OIDC_ISSUER)
+
+    @property
+    def audience(self) -> str:
+        return settings.OIDC_AUDIENCE or settings.OIDC_CLIENT_ID
+
+    async def authenticate(self, tenant_id: str, token: str) -> Optional[Principal]:
+        """
+        校验Bearer令牌并映射为调用方
+
+        Args:
+            tenant_id: 请求所属租户
+            token: 令牌（ID Token或JWT格式的Access Token）
+
+        Returns:
+            调用方，令牌无效时返回None
+        """
+        try:
+            claims = await self.verify(token)
+            return self.principal_from_claims(tenant_id, claims)
+        except OIDCError as e:
+            logger.warning(f"OIDC令牌无效: {str(e)}")
+        except Exception as e:
+            logger.error(f"OIDC令牌校验失败: {str(e)}")
+        return None
+
+    async def verify(self, token: str) -> Dict[str, Any]:
+        """
+        校验令牌签名、签发方、受众和有效期
+
+        Args:
+            token: JWT
+
+        Returns:
+            令牌声明
+        """
+        try:
+            header = jwt.get_unverified_header(token)
+        except jwt.PyJWTError as e:
+            raise OIDCError(f"令牌格式错误: {str(e)}")
+
+        algorithm = header.get("alg", "")
+        hmac_allowed = settings.OIDC_ALLOW_HS256 and algorithm == HMAC_ALGORITHM
+        if algorithm not in ALLOWED_ALGORITHMS and not hmac_allowed:
+            raise OIDCError(f"不支持的签名算法: {algorithm}")
+
+        if hmac_allowed:
+            if not settings.OIDC_CLIENT_SECRET:
+                raise OIDCError("未配置OIDC_CLIENT_SECRET，无法校验HS签名")
+            key = settings.OIDC_CLIENT_SECRET
+        else:
+            key = await self._signing_key(header.get("kid"))
+
+        try:
+            return jwt.decode(
+                token,
+                key,
+                algorithms=[algorithm],
+                audience=self.audience or None,
+                issuer=settings.OIDC_ISSUER.rstrip("/"),
+                options={"verify_aud": bool(self.audience), "require": ["exp", "iss", "sub"]},
+                leeway=30
+            )
+        except jwt.PyJWTError as e:
+            raise OIDCError(str(e))
+
+    def principal_from_claims(self, tenant_id: str, claims: Dict[str, Any]) -> Principal:
+        """
+        按配置把令牌声明映射为调用方
+
+        Args:
+            tenant_id: 请求所属租户
+            claims: 令牌声明
+
+        Returns:
+            调用方
+        """
+        if settings.OIDC_TENANT_CLAIM:
+            claimed = _claim(claims, settings.OIDC_TENANT_CLAIM)
+            tenants = claimed if isinstance(claimed, list) else [claimed]
+            if tenant_id not in tenants:
+                raise OIDCError(f"令牌不属于租户 {tenant_id}")
+
+        roles = [
+            Role(settings.OIDC_ROLE_MAPPING[value])
+            for value in _as_list(_claim(claims, settings.OIDC_ROLES_CLAIM))
+            if value in settings.OIDC_ROLE_MAPPING
+        ]
+        if roles:
+            role = max(roles, key=lambda item: ROLE_RANK[item])
+        elif settings.OIDC_DEFAULT_ROLE:
+            role = Role(settings.OIDC_DEFAULT_ROLE)
+        else:
+            raise OIDCError("令牌中没有可映射的角色")
+
+        user = _claim(claims, settings.OIDC_USER_CLAIM) or claims["sub"]
+        return Principal(user=str(user), role=role, tenant_id=tenant_id)
+
+    async def authorization_url(self) -> str:
+        """
+        生成SSO登录地址（授权码模式），state用于回调时防止CSRF，nonce用于防止ID Token被重放
+
+        Returns:
+            登录地址
+        """
+        discovery = await self._get_discovery()
+        store = get_store()
+        now = time.time()
+        for record in await store.avalues(OIDC_STATES_BUCKET):
+            if record.get("expires_at", 0) <= now:
+                await store.adelete(OIDC_STATES_BUCKET, record["state"])
+
+        state = secrets.token_urlsafe(24)
+        nonce = secrets.token_urlsafe(24)
+        await store.aput(OIDC_STATES_BUCKET, state, {
+            "state": state,
+            "tenant_id": get_current_tenant(),
+            "nonce": nonce,
+            "expires_at": now + STATE_TTL,
+        })
+        params = {
+            "response_type": "code",
+            "client_id": settings.OIDC_CLIENT_ID,
+            "redirect_uri": settings.OIDC_REDIRECT_URI,
+            "scope": settings.OIDC_SCOPES,
+            "state": state,
+            "nonce": nonce,
+        }
+        return f"{discovery['authorization_endpoint']}?{urlencode(params)}"
+
+    async def exchange_code(self, code: str, state: str) -> Tuple[Dict[str, Any], Principal]:
+        """
+        用授权码换取令牌，并校验返回的ID Token及其nonce
+
+        Args:
+            code: 授权码
+            state: 登录地址中的state
+
+        Returns:
+            (令牌响应, 调用方)
+        """
+        expected = await self._consume_state(state)
+        if not expected or expected.get("expires_at", 0) < time.time():
+            raise OIDCError("登录请求无效或已过期，请重新登录")
+
+        discovery = await self._get_discovery()
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.post(
+                discovery["token_endpoint"],
+                data={
+                    "grant_type": "authorization_code",
+                    "code": code,
+                    "redirect_uri": settings.OIDC_REDIRECT_URI,
+                },
+                auth=(settings.OIDC_CLIENT_ID, settings.OIDC_CLIENT_SECRET)
+            )
+            response.raise_for_status()
+            tokens = response.json()
+
+        if not tokens.get("id_token"):
+            raise OIDCError("令牌响应中没有ID Token")
+
+        claims = await self.verify(tokens["id_token"])
+        if not hmac.compare_digest(str(claims.get("nonce", "")), expected["nonce"]):
+            raise OIDCError("ID Token的nonce与登录请求不一致")
+        return tokens, self.principal_from_claims(expected["tenant_id"], claims)
+
+    async def _consume_state(self, state: str) -> Optional[Dict[str, Any]]:
+        """原子地取出并作废登录state，同一state只能使用一次"""
+        if not state or not STATE_PATTERN.fullmatch(state):
+            return None
+        consumed: Dict[str, Any] = {}
+
+        def mark_used(current: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+            if not current or current.get("used"):
+                return None
+            consumed.update(current)
+            return {**current, "used": True}
+
+        store = get_store()
+        if await store.aupdate(OIDC_STATES_BUCKET, state, mark_used) is None:
+            return None
+        await store.adelete(OIDC_STATES_BUCKET, state)
+        return consumed
+
+    async def _get_discovery(self) -> Dict[str, Any]:
+        if self._discovery is None:
+            url = settings.OIDC_ISSUER.rstrip("/") + "/.well-known/openid-configuration"
+            async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+                response = await client.get(url)
+                response.raise_for_status()
+                self._discovery = response.json()
+        return self._discovery
+
+    async def _signing_key(self, kid: Optional[str]) -> Any:
+        """获取签名公钥，缓存过期或遇到未知kid（密钥轮换）时重新拉取"""
+        age = time.time() - self._keys_loaded_at
+        if age > settings.OIDC_JWKS_CACHE_TTL or (kid not in self._keys and age > JWKS_MIN_REFRESH_INTERVAL):
+            await self._load_keys()
+
+        if kid in self._keys:
+            return self._keys[kid]
+        # 只有一把密钥时令牌可能不带kid
+        if kid is None and len(self._keys) == 1:
+            return next(iter(self._keys.values()))
+        raise OIDCError(f"未找到签名公钥: {kid}")
+
+    async def _load_keys(self) -> None:
+        discovery = await self._get_discovery()
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.get(discovery["jwks_uri"])
+            response.raise_for_status()
+            jwks = response.json()
+
+        keys = {}
+        for item in jwks.get("keys", []):
+            if item.get("use", "sig") != "sig":
+                continue
+            try:
+                keys[item.get("kid")] = jwt.PyJWK(item).key
+            except jwt.PyJWTError as e:
+                logger.warning(f"跳过无法解析的公钥 {item.get('kid')}: {str(e)}")
+
+        self._keys = keys
+        self._keys_loaded_at = time.time()
+        logger.info(f"已加载OIDC签名公钥 {len(keys)} 个")
+
+
+def _claim(claims: Dict[str, Any], path: str) -> Any:
+    """按点号路径读取嵌套声明"""
+    value: Any = claims
+    for part in path.split("."):
+        if not isinstance(value, dict):
+            return None
+        value = value.get(part)
+    return value
+
+
+def _as_list(value: Any) -> List[str]:
+    if value is None:
+        return []
+    if isinstance(value, str):
+        # 部分身份提供方把多个值放在一个空格分隔的字符串里
+        return value.split()
+    return [str(item) for item in value]
+
+
+# 创建全局OIDC实例
+oidc_provider = OIDCProvider()
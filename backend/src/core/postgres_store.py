@@ -0,0 +1,184 @@
+"""
+PostgreSQL元数据存储
+供多副本部署共享任务、文件元数据和API Key，表结构通过 migrations 目录下按版本号命名的SQL文件维护
+
+手动执行迁移::
+
+    python -m src.core.postgres_store
+"""
+
+import re
+from pathlib import Path
+from typing import Any, Callable, Iterable, List, Optional, Tuple
+
+from loguru import logger
+
+from .config import settings
+from .store import Store
+
+
+MIGRATIONS_DIR = Path(__file__).parent / "migrations"
+
+# 迁移文件名格式：0001_create_records.sql
+MIGRATION_PATTERN = re.compile(r"^(\d+)_(\w+)\.sql$")
+
+# 多个副本同时启动时用咨询锁串行执行迁移
+MIGRATION_LOCK_ID = 7_318_465_001
+
+
+def load_migrations(directory: Path = MIGRATIONS_DIR) -> List[Tuple[int, str, str]]:
+    """
+    读取迁移文件
+
+    Args:
+        directory: 迁移目录
+
+    Returns:
+        按版本号排序的(版本号, 名称, SQL)列表
+    """
+    migrations = []
+    for path in directory.glob("*.sql"):
+        match = MIGRATION_PATTERN.match(path.name)
+        if not match:
+            raise ValueError(f"迁移文件名无效: {path.name}")
+        migrations.append((int(match.group(1)), match.group(2), path.read_text(encoding="utf-8")))
+
+    migrations.sort(key=lambda item: item[0])
+    versions = [version for version, _, _ in migrations]
+    if len(set(versions)) != len(versions):
+        raise ValueError("迁移版本号重复")
+    return migrations
+
+
+def migrate(pool) -> List[int]:
+    """
+    执行尚未应用的迁移，每个迁移在独立事务中执行，失败时回滚且不记录版本
+
+    Args:
+        pool: 数据库连接池
+
+    Returns:
+        本次应用的版本号
+    """
+    applied: List[int] = []
+    with pool.connection() as conn:
+        conn.execute(
+            "CREATE TABLE IF NOT EXISTS schema_migrations ("
+            "version BIGINT PRIMARY KEY, name TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())"
+        )
+        conn.commit()
+
+        for version, name, sql in load_migrations():
+            with conn.transaction():
+                conn.execute("SELECT pg_advisory_xact_lock(%s)", (MIGRATION_LOCK_ID,))
+                exists = conn.execute("SELECT 1 FROM schema_migrations WHERE version = %s", (version,)).fetchone()
+                if exists:
+                    continue
+                conn.execute(sql)
+                conn.execute("INSERT INTO schema_migrations (version, name) VALUES (%s, %s)", (version, name))
+                applied.append(version)
+                logger.info(f"数据库迁移已应用: {version:04d}_{name}")
+
+    return applied
+
+
+class PostgresStore(Store):
+    """基于连接池的PostgreSQL存储，状态切换通过行锁保证多副本间的一致性"""
+
+    def __init__(self, dsn: str):
+        from psycopg_pool import ConnectionPool
+
+        if not dsn:
+            raise ValueError("使用postgres存储时必须配置DATABASE_URL")
+
+        self._pool = ConnectionPool(
+            dsn,
+            min_size=settings.DATABASE_POOL_MIN_SIZE,
+            max_size=settings.DATABASE_POOL_MAX_SIZE,
+            timeout=settings.DATABASE_POOL_TIMEOUT,
+            open=True
+        )
+        if settings.DATABASE_AUTO_MIGRATE:
+            migrate(self._pool)
+        logger.info("使用PostgreSQL存储")
+
+    def get(self, bucket: str, key: str, namespace: str = "") -> Optional[Any]:
+        with self._pool.connection() as conn:
+            row = conn.execute(
+                "SELECT value FROM records WHERE bucket = %s AND namespace = %s AND key = %s",
+                (bucket, namespace, key)
+            ).fetchone()
+        return row[0] if row else None
+
+    def put(self, bucket: str, key: str, value: Any, namespace: str = "") -> None:
+        with self._pool.connection() as conn:
+            self._upsert(conn, bucket, key, value, namespace)
+
+    def delete(self, bucket: str, key: str, namespace: str = "") -> bool:
+        with self._pool.connection() as conn:
+            cursor = conn.execute(
+                "DELETE FROM records WHERE bucket = %s AND namespace = %s AND key = %s",
+                (bucket, namespace, key)
+            )
+            return cursor.rowcount > 0
+
+    def values(self, bucket: str, namespace: str = "", statuses: Optional[Iterable[str]] = None) -> List[Any]:
+        with self._pool.connection() as conn:
+            if statuses is None:
+                rows = conn.execute(
+                    "SELECT value FROM records WHERE bucket = %s AND namespace = %s ORDER BY key",
+                    (bucket, namespace)
+                ).fetchall()
+            else:
+                # 按status过滤可使用任务状态索引，不必扫描全部历史任务
+                rows = conn.execute(
+                    "SELECT value FROM records WHERE bucket = %s AND namespace = %s "
+                    "AND value->>'status' = ANY(%s) ORDER BY key",
+                    (bucket, namespace, list(statuses))
+                ).fetchall()
+        return [row[0] for row in rows]
+
+    def update(
+        self,
+        bucket: str,
+        key: str,
+        mutate: Callable[[Optional[Any]], Optional[Any]],
+        namespace: str = ""
+    ) -> Optional[Any]:
+        with self._pool.connection() as conn:
+            with conn.transaction():
+                # 行锁无法锁住尚不存在的记录，先按键取事务级咨询锁，使首次创建同样串行
+                conn.execute(
+                    "SELECT pg_advisory_xact_lock(hashtextextended(%s, 0))",
+                    (f"{bucket}\x1f{namespace}\x1f{key}",)
+                )
+                # 行锁保证同一条记录的读-改-写在各副本间串行
+                row = conn.execute(
+                    "SELECT value FROM records WHERE bucket = %s AND namespace = %s AND key = %s FOR UPDATE",
+                    (bucket, namespace, key)
+                ).fetchone()
+                value = mutate(row[0] if row else None)
+                if value is not None:
+                    self._upsert(conn, bucket, key, value, namespace)
+                return value
+
+    def close(self) -> None:
+        self._pool.close()
+
+    @staticmethod
+    def _upsert(conn, bucket: str, key: str, value: Any, namespace: str) -> None:
+        from psycopg.types.json import Jsonb
+
+        conn.execute(
+            "INSERT INTO records (bucket, namespace, key, value) VALUES (%s, %s, %s, %s) "
+            "ON CONFLICT (bucket, namespace, key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()",
+            (bucket, namespace, key, Jsonb(value))
+        )
+
+
+if __name__ == "__main__":
+    from psycopg_pool import ConnectionPool
+
+    with ConnectionPool(settings.DATABASE_URL, min_size=1, max_size=1) as migration_pool:
+        versions = migrate(migration_pool)
+    print(f"已应用 {len(versions)} 个迁移" if versions else "数据库已是最新版本")
@@ -0,0 +1,176 @@
+"""
+引擎子进程沙箱
+PDF是不可信输入。Ghostscript、Tesseract等子进程只继承精简的环境变量，HOME和TMPDIR指向单独的临时目录，输出也写在其中；
+ENGINE_SANDBOX=bwrap 时再用bubblewrap运行：断开网络，只读挂载运行引擎所需的系统目录（/usr、/lib、字体和语言数据），
+/home、/root、/var、/etc中的其他文件以及上传目录和其他临时目录均不可见，
+只读挂载本次的输入文件，并可加载seccomp过滤器；配置了AppArmor配置时通过aa-exec切换
+"""
+
+import os
+import shutil
+from contextlib import contextmanager
+from pathlib import Path
+from typing import Iterator, List, Optional, Sequence, Tuple
+from uuid import uuid4
+
+from .config import settings
+from .scratch import scratch_dir
+
+
+# 传给子进程的环境变量，其余（凭据、代理等）全部丢弃
+ENV_PASSTHROUGH = (
+    "PATH",
+    "LANG",
+    "LC_ALL",
+    "LC_CTYPE",
+    "TZ",
+    "TESSDATA_PREFIX",
+    "GS_LIB",
+    "GS_FONTPATH",
+    "FONTCONFIG_PATH",
+)
+
+# 切换AppArmor配置使用的命令
+APPARMOR_EXEC = "aa-exec"
+
+# bubblewrap中只读挂载的系统路径，不存在的跳过；/usr合并的系统上/bin、/lib等是符号链接，在沙箱中重建为链接
+SANDBOX_SYSTEM_PATHS = (
+    "/usr",
+    "/bin",
+    "/sbin",
+    "/lib",
+    "/lib32",
+    "/lib64",
+    "/etc/alternatives",
+    "/etc/fonts",
+    "/etc/ld.so.cache",
+    "/etc/ld.so.conf",
+    "/etc/ld.so.conf.d",
+    "/etc/localtime",
+)
+
+# 指向字体和语言数据目录的环境变量（可为冒号分隔的多个目录），目录在系统路径之外时一并只读挂载
+SANDBOX_DATA_ENV = ("TESSDATA_PREFIX", "GS_LIB", "GS_FONTPATH", "FONTCONFIG_PATH")
+
+
+def sandbox_available() -> bool:
+    """配置的沙箱是否可用，不可用时不运行引擎子进程"""
+    if settings.ENGINE_SANDBOX == "bwrap" and shutil.which(settings.ENGINE_SANDBOX_PATH) is None:
+        return False
+    if settings.ENGINE_APPARMOR_PROFILE and shutil.which(APPARMOR_EXEC) is None:
+        return False
+    return True
+
+
+class EngineSandbox:
+    """一个引擎子进程的运行环境"""
+
+    def __init__(self, workdir: Path, inputs: Sequence[Path] = ()):
+        self.workdir = workdir
+        self.inputs = [Path(path).resolve() for path in inputs]
+        self._seccomp: Optional[int] = None
+
+    @property
+    def env(self) -> dict:
+        """子进程的环境变量"""
+        env = {name: os.environ[name] for name in ENV_PASSTHROUGH if name in os.environ}
+        for name in ("HOME", "TMPDIR", "TMP", "TEMP"):
+            env[name] = str(self.workdir)
+        return env
+
+    @property
+    def pass_fds(self) -> Tuple[int, ...]:
+        """需要传给子进程的文件描述符（seccomp过滤器）"""
+        return (self._seccomp,) if self._seccomp is not None else ()
+
+    def command(self, argv: Sequence[str]) -> List[str]:
+        """
+        在沙箱中运行的完整命令
+
+        Args:
+            argv: 引擎命令
+
+        Returns:
+            加上bubblewrap和aa-exec前缀的命令
+        """
+        command = list(argv)
+        if settings.ENGINE_SANDBOX == "bwrap":
+            command = [*self._bwrap_args(), "--", *command]
+        if settings.ENGINE_APPARMOR_PROFILE:
+            command = [APPARMOR_EXEC, "-p", settings.ENGINE_APPARMOR_PROFILE, "--", *command]
+        return command
+
+    def _bwrap_args(self) -> List[str]:
+        """bubblewrap参数：后面的挂载覆盖前面的，先隐藏数据目录再挂载输入文件和工作目录"""
+        args = [
+            settings.ENGINE_SANDBOX_PATH,
+            "--unshare-all",
+            "--die-with-parent",
+            "--new-session",
+        ]
+        for path in _system_paths():
+            if os.path.islink(path):
+                args += ["--symlink", os.readlink(path), path]
+            else:
+                args += ["--ro-bind-try", path, path]
+        args += [
+            "--dev", "/dev",
+            "--proc", "/proc",
+            "--tmpfs", "/tmp",
+        ]
+        for directory in (settings.UPLOAD_DIR, settings.TEMP_DIR):
+            path = Path(directory).resolve()
+            if path.is_dir():
+                args += ["--tmpfs", str(path)]
+        for path in self.inputs:
+            args += ["--ro-bind", str(path), str(path)]
+        workdir = str(self.workdir.resolve())
+        args += ["--bind", workdir, workdir, "--chdir", workdir]
+        if settings.ENGINE_SECCOMP_FILTER:
+            if self._seccomp is None:
+                self._seccomp = os.open(settings.ENGINE_SECCOMP_FILTER, os.O_RDONLY)
+            args += ["--seccomp", str(self._seccomp)]
+        return args
+
+    def close(self) -> None:
+        """关闭seccomp过滤器文件"""
+        if self._seccomp is not None:
+            os.close(self._seccomp)
+            self._seccomp = None
+
+
+def _system_paths() -> List[str]:
+    """bubblewrap中只读挂载的系统路径、字体和语言数据目录以及配置的额外路径"""
+    paths = list(SANDBOX_SYSTEM_PATHS)
+    for name in SANDBOX_DATA_ENV:
+        paths += [path for path in os.environ.get(name, "").split(os.pathsep) if path]
+    paths += settings.ENGINE_SANDBOX_BINDS
+    # 系统路径之下的目录已随父目录挂载
+    return list(dict.fromkeys(
+        path for path in paths
+        if os.path.isabs(path) and not any(
+            path != parent and path.startswith(parent.rstrip("/") + "/") for parent in SANDBOX_SYSTEM_PATHS
+        )
+    ))
+
+
+@contextmanager
+def engine_sandbox(inputs: Sequence[Path] = ()) -> Iterator[EngineSandbox]:
+    """
+    为一个引擎子进程准备沙箱，退出时删除其临时目录
+
+    Args:
+        inputs: 子进程需要读取的文件（在bubblewrap中只读挂载）
+
+    Yields:
+        沙箱，启动子进程时使用其command、env和pass_fds
+    """
+    if settings.ENGINE_SECCOMP_FILTER and settings.ENGINE_SANDBOX != "bwrap":
+        raise RuntimeError("ENGINE_SECCOMP_FILTER 需要 ENGINE_SANDBOX=bwrap")
+
+    with scratch_dir(f"engine-{uuid4().hex[:12]}") as workdir:
+        sandbox = EngineSandbox(workdir, inputs)
+        try:
+            yield sandbox
+        finally:
+            sandbox.close()
@@ -0,0 +1,127 @@
+"""
+任务临时目录
+拆分等任务的中间输出写入 TEMP_DIR/tasks/{作用域}，成功后逐个原子替换到最终位置，结束时整个目录删除。
+目录持有一个文件锁，进程退出（包括崩溃）时锁自动释放，启动时据此清理崩溃遗留的目录而不影响其他进程
+"""
+
+import errno
+import fcntl
+import os
+import shutil
+import time
+from contextlib import contextmanager
+from pathlib import Path
+from typing import Iterable, Iterator, Optional
+from uuid import uuid4
+
+from loguru import logger
+
+from .config import settings
+
+
+# 任务临时目录所在的子目录
+SCRATCH_DIRNAME = "tasks"
+
+# 临时目录中的锁文件，提交输出时不移动
+LOCK_FILENAME = ".lock"
+
+# 没有锁文件的目录可能刚刚创建，超过该时长（秒）才视为遗留
+UNLOCKED_GRACE_SECONDS = 60
+
+
+def scratch_root() -> Path:
+    """任务临时目录的根目录"""
+    return Path(settings.TEMP_DIR) / SCRATCH_DIRNAME
+
+
+@contextmanager
+def scratch_dir(scope: Optional[str] = None) -> Iterator[Path]:
+    """
+    创建任务临时目录，退出时无论成功与否都删除
+
+    Args:
+        scope: 作用域（通常为任务ID），为空时随机生成
+
+    Yields:
+        临时目录路径
+    """
+    path = scratch_root() / (scope or uuid4().hex)
+    # 同一任务重试时先清掉上次的残留
+    shutil.rmtree(path, ignore_errors=True)
+    path.mkdir(parents=True)
+    lock = open(path / LOCK_FILENAME, "w")
+    try:
+        fcntl.flock(lock, fcntl.LOCK_EX | fcntl.LOCK_NB)
+        yield path
+    finally:
+        shutil.rmtree(path, ignore_errors=True)
+        lock.close()
+
+
+def replace_file(source: Path, target: Path) -> None:
+    """原子替换目标文件，跨文件系统时先复制到目标目录再替换"""
+    try:
+        os.replace(source, target)
+    except OSError as e:
+        if e.errno != errno.EXDEV:
+            raise
+        partial = target.with_name(f".{target.name}.part")
+        try:
+            shutil.copy2(source, partial)
+            os.replace(partial, target)
+        finally:
+            partial.unlink(missing_ok=True)
+
+
+def commit_outputs(source_dir: Path, target_dir: Path, last: Iterable[str] = ()) -> int:
+    """
+    把临时目录中的文件逐个原子替换到最终目录，读取方只会看到旧文件或完整的新文件
+
+    Args:
+        source_dir: 临时目录
+        target_dir: 最终目录
+        last: 最后提交的文件名（如校验清单），出现即表示其他文件已就位
+
+    Returns:
+        提交的文件数量
+    """
+    target_dir.mkdir(parents=True, exist_ok=True)
+    last = list(last)
+    files = [path for path in source_dir.iterdir() if path.is_file() and path.name != LOCK_FILENAME]
+    files.sort(key=lambda path: last.index(path.name) if path.name in last else -1)
+    for path in files:
+        replace_file(path, target_dir / path.name)
+    return len(files)
+
+
+def sweep_orphaned_scratch() -> int:
+    """
+    删除崩溃遗留的任务临时目录，仍被其他进程持有锁的目录保留
+
+    Returns:
+        删除的目录数量
+    """
+    root = scratch_root()
+    if not root.exists():
+        return 0
+
+    removed = 0
+    for path in root.iterdir():
+        if not path.is_dir():
+            continue
+        lock_path = path / LOCK_FILENAME
+        if not lock_path.exists():
+            if time.time() - path.stat().st_mtime < UNLOCKED_GRACE_SECONDS:
+                continue
+        else:
+            with open(lock_path, "a") as lock:
+                try:
+                    fcntl.flock(lock, fcntl.LOCK_EX | fcntl.LOCK_NB)
+                except BlockingIOError:
+                    continue
+        shutil.rmtree(path, ignore_errors=True)
+        removed += 1
+
+    if removed:
+        logger.info(f"清理崩溃遗留的任务临时目录: {removed} 个")
+    return removed
@@ -0,0 +1,302 @@
+"""
+元数据存储
+任务、文件元数据、API Key、Webhook投递和审计记录通过统一的键值接口读写，按STORE_BACKEND选择实现：
+file（默认）沿用上传目录下的JSON文件；lmdb（或bolt）使用单个嵌入式数据库文件，适合无外部依赖的单机部署；
+postgres 供多副本的生产部署使用
+"""
+
+import asyncio
+import json
+import threading
+from abc import ABC, abstractmethod
+from pathlib import Path
+from typing import Any, Callable, Dict, Iterable, List, Optional
+
+from loguru import logger
+
+from .config import settings
+from .tenancy import tenant_storage_dir
+
+
+class Store(ABC):
+    """
+    键值存储接口
+
+    数据按bucket分组，namespace为租户ID，为空表示全局数据；值为可JSON序列化的对象
+    """
+
+    @abstractmethod
+    def get(self, bucket: str, key: str, namespace: str = "") -> Optional[Any]:
+        """读取，不存在时返回None"""
+
+    @abstractmethod
+    def put(self, bucket: str, key: str, value: Any, namespace: str = "") -> None:
+        """写入（覆盖）"""
+
+    @abstractmethod
+    def delete(self, bucket: str, key: str, namespace: str = "") -> bool:
+        """删除，返回是否存在"""
+
+    @abstractmethod
+    def values(self, bucket: str, namespace: str = "", statuses: Optional[Iterable[str]] = None) -> List[Any]:
+        """列出bucket中的全部值，指定statuses时只返回status字段为其中之一的记录"""
+
+    @abstractmethod
+    def update(
+        self,
+        bucket: str,
+        key: str,
+        mutate: Callable[[Optional[Any]], Optional[Any]],
+        namespace: str = ""
+    ) -> Optional[Any]:
+        """
+        原子地读取-修改-写入一条记录，用于需要防止并发覆盖的状态切换
+
+        Args:
+            bucket: bucket名
+            key: 键
+            mutate: 接收当前值（不存在时为None），返回新值；返回None表示放弃修改
+            namespace: 租户ID
+
+        Returns:
+            写入的新值，放弃修改时返回None
+        """
+
+    def close(self) -> None:
+        """释放资源"""
+
+    # 异步版本在线程池中执行，避免数据库或磁盘IO阻塞事件循环
+
+    async def aget(self, bucket: str, key: str, namespace: str = "") -> Optional[Any]:
+        return await asyncio.to_thread(self.get, bucket, key, namespace)
+
+    async def aput(self, bucket: str, key: str, value: Any, namespace: str = "") -> None:
+        await asyncio.to_thread(self.put, bucket, key, value, namespace)
+
+    async def adelete(self, bucket: str, key: str, namespace: str = "") -> bool:
+        return await asyncio.to_thread(self.delete, bucket, key, namespace)
+
+    async def avalues(self, bucket: str, namespace: str = "", statuses: Optional[Iterable[str]] = None) -> List[Any]:
+        return await asyncio.to_thread(self.values, bucket, namespace, statuses)
+
+    async def aupdate(
+        self,
+        bucket: str,
+        key: str,
+        mutate: Callable[[Optional[Any]], Optional[Any]],
+        namespace: str = ""
+    ) -> Optional[Any]:
+        return await asyncio.to_thread(self.update, bucket, key, mutate, namespace)
+
+
+def _status_filter(statuses: Optional[Iterable[str]]) -> Callable[[Any], bool]:
+    """按status字段过滤记录，未指定时全部保留"""
+    if statuses is None:
+        return lambda value: True
+    allowed = set(statuses)
+    return lambda value: isinstance(value, dict) and value.get("status") in allowed
+
+
+# 各bucket在文件存储中的路径（相对于租户存储目录或上传目录），与引入存储接口前的目录结构一致
+FILE_LAYOUT: Dict[str, str] = {
+    "files": "{key}/metadata.json",
+    "chapter_edits": "{key}/chapters.json",
+    "tasks": "tasks/{key}.json",
+    "task_events": "tasks/events/{key}.json",
+    "api_keys": "api_keys/{key}.json",
+    "webhooks": "webhooks/{key}.json",
+}
+
+
+# LMDB命名数据库（每个bucket一个）的数量上限，需大于各服务使用的bucket总数（目前18个），超出后打开新bucket时报错
+LMDB_MAX_BUCKETS = 64
+
+
+class FileStore(Store):
+    """每条记录一个JSON文件，仅适用于单进程"""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+
+    def _root(self, namespace: str) -> Path:
+        return tenant_storage_dir(namespace) if namespace else Path(settings.UPLOAD_DIR)
+
+    def _path(self, bucket: str, key: str, namespace: str) -> Path:
+        # 键来自uuid或经过校验的ID，仍然拒绝路径分隔符以防穿越
+        if not key or "/" in key or "\\" in key or key in (".", ".."):
+            raise ValueError(f"无效的存储键: {key}")
+        layout = FILE_LAYOUT.get(bucket, bucket + "/{key}.json")
+        return self._root(namespace) / layout.format(key=key)
+
+    def get(self, bucket: str, key: str, namespace: str = "") -> Optional[Any]:
+        path = self._path(bucket, key, namespace)
+        if not path.exists():
+            return None
+        with open(path, "r", encoding="utf-8") as f:
+            return json.load(f)
+
+    def put(self, bucket: str, key: str, value: Any, namespace: str = "") -> None:
+        path = self._path(bucket, key, namespace)
+        path.parent.mkdir(parents=True, exist_ok=True)
+        # 先写临时文件再替换，避免进程中断留下半个文件
+        tmp_path = path.with_name(path.name + ".tmp")
+        with open(tmp_path, "w", encoding="utf-8") as f:
+            json.dump(value, f, ensure_ascii=False, indent=2)
+        tmp_path.replace(path)
+
+    def delete(self, bucket: str, key: str, namespace: str = "") -> bool:
+        path = self._path(bucket, key, namespace)
+        if not path.exists():
+            return False
+        path.unlink()
+        return True
+
+    def values(self, bucket: str, namespace: str = "", statuses: Optional[Iterable[str]] = None) -> List[Any]:
+        layout = FILE_LAYOUT.get(bucket, bucket + "/{key}.json")
+        matches = _status_filter(statuses)
+        result = []
+        for path in self._root(namespace).glob(layout.format(key="*")):
+            try:
+                with open(path, "r", encoding="utf-8") as f:
+                    value = json.load(f)
+            except Exception as e:
+                logger.error(f"读取存储记录失败: {path} - {str(e)}")
+                continue
+            if matches(value):
+                result.append(value)
+        return result
+
+    def update(
+        self,
+        bucket: str,
+        key: str,
+        mutate: Callable[[Optional[Any]], Optional[Any]],
+        namespace: str = ""
+    ) -> Optional[Any]:
+        with self._lock:
+            value = mutate(self.get(bucket, key, namespace))
+            if value is not None:
+                self.put(bucket, key, value, namespace)
+            return value
+
+
+class LmdbStore(Store):
+    """
+    LMDB嵌入式存储
+
+    每个bucket一个命名数据库，键为 "{namespace}\\x00{key}"，写事务串行、读事务无锁
+    """
+
+    def __init__(self, path: str, map_size: int, max_buckets: int = LMDB_MAX_BUCKETS):
+        import lmdb
+
+        Path(path).mkdir(parents=True, exist_ok=True)
+        self._env = lmdb.open(path, map_size=map_size, max_dbs=max_buckets)
+        self._max_buckets = max_buckets
+        self._dbs: Dict[str, Any] = {}
+        self._lock = threading.Lock()
+        logger.info(f"使用LMDB存储: {path}")
+
+    def _db(self, bucket: str):
+        import lmdb
+
+        with self._lock:
+            if bucket not in self._dbs:
+                try:
+                    self._dbs[bucket] = self._env.open_db(bucket.encode("utf-8"))
+                except lmdb.DbsFullError:
+                    raise RuntimeError(
+                        f"LMDB存储的bucket数量已达上限（{self._max_buckets}），无法打开 {bucket}，"
+                        f"新增bucket后需同步调大 LMDB_MAX_BUCKETS"
+                    ) from None
+            return self._dbs[bucket]
+
+    @staticmethod
+    def _key(key: str, namespace: str) -> bytes:
+        return f"{namespace}\x00{key}".encode("utf-8")
+
+    def get(self, bucket: str, key: str, namespace: str = "") -> Optional[Any]:
+        with self._env.begin(db=self._db(bucket)) as txn:
+            raw = txn.get(self._key(key, namespace))
+        return json.loads(raw) if raw is not None else None
+
+    def put(self, bucket: str, key: str, value: Any, namespace: str = "") -> None:
+        raw = json.dumps(value, ensure_ascii=False).encode("utf-8")
+        with self._env.begin(db=self._db(bucket), write=True) as txn:
+            txn.put(self._key(key, namespace), raw)
+
+    def delete(self, bucket: str, key: str, namespace: str = "") -> bool:
+        with self._env.begin(db=self._db(bucket), write=True) as txn:
+            return txn.delete(self._key(key, namespace))
+
+    def values(self, bucket: str, namespace: str = "", statuses: Optional[Iterable[str]] = None) -> List[Any]:
+        prefix = f"{namespace}\x00".encode("utf-8")
+        matches = _status_filter(statuses)
+        result = []
+        with self._env.begin(db=self._db(bucket)) as txn:
+            cursor = txn.cursor()
+            if cursor.set_range(prefix):
+                for raw_key, raw in cursor:
+                    if not raw_key.startswith(prefix):
+                        break
+                    value = json.loads(raw)
+                    if matches(value):
+                        result.append(value)
+        return result
+
+    def update(
+        self,
+        bucket: str,
+        key: str,
+        mutate: Callable[[Optional[Any]], Optional[Any]],
+        namespace: str = ""
+    ) -> Optional[Any]:
+        # 读和写在同一个写事务中完成，LMDB同时只允许一个写事务
+        with self._env.begin(db=self._db(bucket), write=True) as txn:
+            raw = txn.get(self._key(key, namespace))
+            value = mutate(json.loads(raw) if raw is not None else None)
+            if value is not None:
+                txn.put(self._key(key, namespace), json.dumps(value, ensure_ascii=False).encode("utf-8"))
+            return value
+
+    def close(self) -> None:
+        self._env.close()
+
+
+_store: Optional[Store] = None
+_store_lock = threading.Lock()
+
+
+def get_store() -> Store:
+    """
+    获取全局存储实例，首次调用时按STORE_BACKEND创建
+
+    Returns:
+        存储实例
+    """
+    global _store
+    with _store_lock:
+        if _store is None:
+            backend = settings.STORE_BACKEND.lower()
+            # bolt为兼容写法，同样使用嵌入式存储
+            if backend in ("lmdb", "bolt"):
+                path = settings.STORE_PATH or str(Path(settings.UPLOAD_DIR) / "store.lmdb")
+                _store = LmdbStore(path, settings.STORE_MAP_SIZE)
+            elif backend == "postgres":
+                from .postgres_store import PostgresStore
+
+                _store = PostgresStore(settings.DATABASE_URL)
+            elif backend == "file":
+                _store = FileStore()
+            else:
+                raise ValueError(f"不支持的存储后端: {settings.STORE_BACKEND}")
+        return _store
+
+
+def close_store() -> None:
+    """关闭全局存储实例"""
+    global _store
+    with _store_lock:
+        if _store is not None:
+            _store.close()
+            _store = None
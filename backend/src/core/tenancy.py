@@ -0,0 +1,209 @@
+"""
+多租户支持
+按请求头或子域名识别租户，每个租户拥有独立的存储目录、配额、限流和API Key
+"""
+
+import re
+import shutil
+from contextlib import contextmanager
+from contextvars import ContextVar
+from pathlib import Path
+from typing import Iterator, List, Optional
+
+from loguru import logger
+from pydantic import BaseModel, Field, field_validator
+
+from ..models.schemas import Role
+from .config import settings
+from .errors import NotFoundError
+
+
+# 租户ID只允许小写字母、数字、下划线和短横线，避免被用于路径穿越
+TENANT_ID_PATTERN = re.compile(r"^[a-z0-9][a-z0-9_-]{0,62}$")
+
+# 隐私模式临时文件的ID前缀和所在目录
+EPHEMERAL_PREFIX = "tmp-"
+EPHEMERAL_DIRNAME = "ephemeral"
+
+# 文件ID为上传时生成的UUID，隐私模式的文件带tmp-前缀
+FILE_ID_PATTERN = re.compile(r"^(tmp-)?[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$")
+
+# 租户存储目录所在的子目录
+TENANTS_DIRNAME = "tenants"
+
+# 旧版本中默认租户直接存放在上传目录根下的数据目录（文件目录之外），启动时迁移到默认租户的目录
+LEGACY_TENANT_DIRNAMES = ("api_keys", "presets", "policies", "engine_failures", "connectors", "upload_parts")
+
+_current_tenant: ContextVar[str] = ContextVar("current_tenant", default=settings.DEFAULT_TENANT)
+
+
+class ApiKeyEntry(BaseModel):
+    """租户API Key及其对应的用户和角色"""
+    key: str = Field(..., min_length=1, description="API Key")
+    user: Optional[str] = Field(None, description="用户标识，为空时使用Key前缀")
+    role: Role = Field(default=Role.EDITOR, description="角色")
+
+
+class TenantSettings(BaseModel):
+    """租户级配置，未设置的项使用全局配置"""
+    quota_bytes: Optional[int] = Field(None, description="存储配额（字节），0表示不限制")
+    rate_limit_per_minute: Optional[int] = Field(None, description="每分钟请求数上限，0表示不限制")
+    api_keys: List[ApiKeyEntry] = Field(default_factory=list, description="允许访问该租户的API Key，为空时不校验")
+    original_retention_hours: Optional[int] = Field(None, description="原文件在上传后的保留时长（小时），0表示不清理")
+    output_retention_hours: Optional[int] = Field(None, description="章节输出在最后一次下载后的保留时长（小时）")
+    undownloaded_output_retention_hours: Optional[int] = Field(None, description="从未下载的章节输出在生成后的保留时长（小时）")
+    task_retention_hours: Optional[int] = Field(None, description="已完成任务的保留时长（小时）")
+    failed_task_retention_hours: Optional[int] = Field(None, description="失败任务及其残留输出的保留时长（小时）")
+    webhook_secret: Optional[str] = Field(None, description="该租户请求级Webhook的签名密钥，为空时不签名")
+
+    @field_validator("api_keys", mode="before")
+    @classmethod
+    def _parse_api_keys(cls, value):
+        """兼容只写Key字符串的简写形式"""
+        return [{"key": item} if isinstance(item, str) else item for item in value or []]
+
+
+def get_current_tenant() -> str:
+    """当前请求（或任务）所属的租户"""
+    return _current_tenant.get()
+
+
+@contextmanager
+def use_tenant(tenant_id: str) -> Iterator[None]:
+    """
+    在上下文中切换当前租户，用于中间件和后台任务
+
+    Args:
+        tenant_id: 租户ID
+    """
+    token = _current_tenant.set(tenant_id)
+    try:
+        yield
+    finally:
+        _current_tenant.reset(token)
+
+
+def is_known_tenant(tenant_id: str) -> bool:
+    """租户是否已配置（默认租户始终存在）"""
+    return tenant_id == settings.DEFAULT_TENANT or tenant_id in settings.TENANTS
+
+
+def get_tenant_settings(tenant_id: Optional[str] = None) -> TenantSettings:
+    """
+    获取租户配置
+
+    Args:
+        tenant_id: 租户ID，为空时使用当前租户
+
+    Returns:
+        租户配置
+    """
+    tenant_id = tenant_id or get_current_tenant()
+    return TenantSettings(**settings.TENANTS.get(tenant_id, {}))
+
+
+def get_tenant_quota_bytes(tenant_id: Optional[str] = None) -> int:
+    """租户的存储配额，未单独配置时使用全局配额"""
+    quota = get_tenant_settings(tenant_id).quota_bytes
+    return settings.STORAGE_QUOTA_BYTES if quota is None else quota
+
+
+def get_tenant_rate_limit(tenant_id: Optional[str] = None) -> int:
+    """租户的每分钟请求数上限，未单独配置时使用全局限制"""
+    limit = get_tenant_settings(tenant_id).rate_limit_per_minute
+    return settings.RATE_LIMIT_PER_MINUTE if limit is None else limit
+
+
+def get_tenant_retention_hours(name: str, tenant_id: Optional[str] = None) -> int:
+    """
+    租户的保留时长，未单独配置时使用同名的全局配置
+
+    Args:
+        name: 保留策略名称，如 original_retention_hours
+        tenant_id: 租户ID，为空时使用当前租户
+
+    Returns:
+        保留时长（小时），0表示不清理
+    """
+    hours = getattr(get_tenant_settings(tenant_id), name)
+    return getattr(settings, name.upper()) if hours is None else hours
+
+
+def tenant_storage_dir(tenant_id: Optional[str] = None) -> Path:
+    """
+    租户的存储根目录
+
+    所有租户（包括默认租户）都位于 UPLOAD_DIR/tenants/{tenant_id}，上传目录根下只保留全局数据，
+    删除一个租户的文件不会波及其他租户或元数据存储
+
+    Args:
+        tenant_id: 租户ID，为空时使用当前租户
+
+    Returns:
+        存储目录
+    """
+    tenant_id = tenant_id or get_current_tenant()
+    return Path(settings.UPLOAD_DIR) / TENANTS_DIRNAME / tenant_id
+
+
+def migrate_legacy_storage() -> int:
+    """
+    把旧版本存放在上传目录根下的默认租户数据移到默认租户的目录
+
+    Returns:
+        迁移的条目数
+    """
+    base = Path(settings.UPLOAD_DIR)
+    if not base.is_dir():
+        return 0
+
+    target = tenant_storage_dir(settings.DEFAULT_TENANT)
+    moved = 0
+    for path in base.iterdir():
+        if not path.is_dir() or not (is_valid_file_id(path.name) or path.name in LEGACY_TENANT_DIRNAMES):
+            continue
+        destination = target / path.name
+        if destination.exists():
+            logger.warning(f"默认租户目录中已存在同名条目，跳过迁移: {path.name}")
+            continue
+        target.mkdir(parents=True, exist_ok=True)
+        shutil.move(str(path), str(destination))
+        moved += 1
+
+    if moved:
+        logger.info(f"已将 {moved} 个默认租户的数据目录迁移到: {target}")
+    return moved
+
+
+def is_valid_file_id(file_id: str) -> bool:
+    """是否为上传时生成的文件ID格式"""
+    return bool(FILE_ID_PATTERN.match(file_id or ""))
+
+
+def is_ephemeral_file(file_id: str) -> bool:
+    """是否为隐私模式上传的临时文件"""
+    return file_id.startswith(EPHEMERAL_PREFIX)
+
+
+def file_storage_dir(file_id: str, tenant_id: Optional[str] = None) -> Path:
+    """
+    文件的存储目录
+
+    隐私模式的临时文件位于 TEMP_DIR/ephemeral/{tenant_id}/{file_id}，不进入租户存储目录
+
+    Args:
+        file_id: 文件ID
+        tenant_id: 租户ID，为空时使用当前租户
+
+    Returns:
+        存储目录
+
+    Raises:
+        NotFoundError: 文件ID格式不正确，在访问文件系统之前拒绝
+    """
+    if not is_valid_file_id(file_id):
+        raise NotFoundError(f"文件不存在: {file_id}")
+    tenant_id = tenant_id or get_current_tenant()
+    if is_ephemeral_file(file_id):
+        return Path(settings.TEMP_DIR) / EPHEMERAL_DIRNAME / tenant_id / file_id
+    return tenant_storage_dir(tenant_id) / file_id
@@ -2,7 +2,7 @@
 数据模型和模式定义
 """
 
-from typing import List, Optional
+from typing import Any, List, Optional, Dict
 from datetime import datetime
 from pydantic import BaseModel, Field
 from enum import Enum
@@ -13,6 +13,240 @@ class FileStatus(str, Enum):
     UPLOADED = "uploaded"
     ANALYZED = "analyzed"
     ERROR = "error"
+    QUARANTINED = "quarantined"  # 多次导致处理引擎崩溃，已隔离，管理员解除前不再拆分
+
+
+class TaskStatus(str, Enum):
+    """任务状态枚举"""
+    SCHEDULED = "scheduled"
+    PENDING = "pending"
+    QUEUED = "queued"
+    PROCESSING = "processing"
+    COMPLETED = "completed"
+    FAILED = "failed"
+    CANCELLED = "cancelled"
+
+
+class TaskType(str, Enum):
+    """任务类型枚举"""
+    SPLIT = "split"
+    ANALYZE = "analyze"
+
+
+class TaskPriority(str, Enum):
+    """任务优先级枚举"""
+    LOW = "low"
+    NORMAL = "normal"
+    HIGH = "high"
+
+
+class ArchiveFormat(str, Enum):
+    """打包下载格式枚举"""
+    ZIP = "zip"
+    TAR_GZ = "tar.gz"
+
+
+class ReportFormat(str, Enum):
+    """任务报告格式枚举"""
+    HTML = "html"
+    PDF = "pdf"
+
+
+class AttachmentMode(str, Enum):
+    """章节输出携带嵌入附件的方式枚举"""
+    NONE = "none"
+    ALL = "all"
+    REFERENCED = "referenced"  # 仅携带文件名在章节正文中出现的附件
+
+
+class SignatureHandling(str, Enum):
+    """已签名文件的拆分方式枚举"""
+    REFUSE = "refuse"  # 拒绝拆分
+    STRIP = "strip"  # 删除章节中的签名字段后拆分
+    INCLUDE_ORIGINAL = "include_original"  # 删除签名字段并附带未修改的签名原件
+
+
+class UnreadablePageHandling(str, Enum):
+    """尽力拆分模式下无法读取页面的处理方式枚举"""
+    SKIP = "skip"  # 从章节中省略该页
+    PLACEHOLDER = "placeholder"  # 替换为说明该页无法读取的占位页
+
+
+class WarningCode(str, Enum):
+    """响应警告代码，值保持稳定，客户端可按代码展示或忽略"""
+    SIGNATURES_INVALIDATED = "signatures_invalidated"  # 拆分会使原文件的数字签名失效
+    FILE_REPAIRED = "file_repaired"  # 文件已损坏，使用修复后的副本
+    OUTLINE_INCONSISTENT = "outline_page_refs_inconsistent"  # 书签指向的页码无效或顺序错乱，已忽略
+    PAGE_UNREADABLE = "page_unreadable"  # 页面无法读取，已跳过或替换为占位页
+    NO_STRUCTURE_DETECTED = "no_structure_detected"  # 未识别到书签或章节标题，按页数生成默认分割
+    LLM_ENHANCEMENT_FAILED = "llm_enhancement_failed"  # 大模型增强分析失败，返回基础识别结果
+    CHAPTER_FAILED = "chapter_failed"  # 单个章节拆分失败，其余章节已生成
+    PDFA_CONVERSION_ISSUES = "pdfa_conversion_issues"  # PDF/A转换时移除或无法转换部分特性
+
+
+class ErrorCode(str, Enum):
+    """错误代码，随错误响应的 code 和失败任务的 error_code 返回，值保持稳定，客户端按代码处理而不是解析错误信息"""
+    INVALID_REQUEST = "invalid_request"  # 参数无效
+    INVALID_RANGE = "invalid_range"  # 页码或章节序号超出范围
+    ENCRYPTED = "encrypted"  # 文件已加密，需要密码才能读取
+    CORRUPT = "corrupt"  # 文件已损坏，外部引擎无法解析
+    UNSUPPORTED = "unsupported"  # 文件使用了不支持的特性
+    UNAUTHORIZED = "unauthorized"  # 未认证
+    FORBIDDEN = "forbidden"  # 无权访问
+    NOT_FOUND = "not_found"  # 资源不存在
+    CONFLICT = "conflict"  # 与资源当前状态冲突
+    TOO_LARGE = "too_large"  # 请求体或文件超过大小上限
+    QUOTA_EXCEEDED = "quota_exceeded"  # 存储配额不足
+    RATE_LIMITED = "rate_limited"  # 请求过于频繁
+    TIMEOUT = "timeout"  # 处理或读取超时
+    UNAVAILABLE = "unavailable"  # 服务暂时不可用或缺少依赖
+    INTERNAL = "internal"  # 服务端错误
+
+
+class SigningMode(str, Enum):
+    """章节输出数字签名方式枚举"""
+    NONE = "none"
+    INVISIBLE = "invisible"
+    VISIBLE = "visible"  # 在最后一页右下角显示签名框
+
+
+class StampPosition(str, Enum):
+    """页面盖印文字（Bates编号、页码）位置枚举"""
+    BOTTOM_RIGHT = "bottom-right"
+    BOTTOM_CENTER = "bottom-center"
+    BOTTOM_LEFT = "bottom-left"
+    TOP_RIGHT = "top-right"
+    TOP_CENTER = "top-center"
+    TOP_LEFT = "top-left"
+
+
+class PageNumbering(str, Enum):
+    """页码体系枚举"""
+    PHYSICAL = "physical"  # 物理页序号（从1开始）
+    LOGICAL = "logical"    # PDF页码标签（如 i、ii、1、2）
+    PRINTED = "printed"    # 印刷页码，按文件校准的偏移量换算
+
+
+class SplitStrategy(str, Enum):
+    """拆分章节来源枚举"""
+    MANUAL = "manual"        # 使用请求中的章节列表
+    BOOKMARKS = "bookmarks"  # 在不超过max_depth层的每个书签处拆分
+
+
+class SectionType(str, Enum):
+    """文档区域类型枚举"""
+    COVER = "cover"
+    FRONT_MATTER = "front_matter"
+    PREFACE = "preface"
+    TOC = "toc"
+    CHAPTER = "chapter"
+    APPENDIX = "appendix"
+    BIBLIOGRAPHY = "bibliography"
+    INDEX = "index"
+
+
+class SectionHandling(str, Enum):
+    """非正文区域的拆分处理方式"""
+    INCLUDE = "include"  # 单独输出
+    EXCLUDE = "exclude"  # 不输出
+    MERGE = "merge"      # 并入相邻章节（前置内容并入后一章，后置内容并入前一章）
+
+
+class Role(str, Enum):
+    """访问角色枚举"""
+    VIEWER = "viewer"  # 只能查看和下载
+    EDITOR = "editor"  # 可上传、分析、拆分
+    ADMIN = "admin"    # 可访问本租户的统计、策略和其他用户的任务
+    OPERATOR = "operator"  # 部署运维，另可查看全局配置、指标和运行基准测试
+
+
+class NotificationChannelType(str, Enum):
+    """通知渠道类型枚举"""
+    SLACK = "slack"
+    WEBHOOK = "webhook"
+    EMAIL = "email"
+
+
+class NotificationConfig(BaseModel):
+    """请求级通知配置"""
+    type: NotificationChannelType = Field(..., description="渠道类型")
+    url: Optional[str] = Field(None, description="Slack/Webhook地址")
+    headers: dict = Field(default_factory=dict, description="Webhook附加请求头")
+    recipients: List[str] = Field(default_factory=list, description="邮件收件人")
+    events: List[str] = Field(default_factory=list, description="订阅的事件，为空时使用全局默认")
+    
+    def model_post_init(self, __context) -> None:
+        """模型初始化后验证"""
+        if self.type in (NotificationChannelType.SLACK, NotificationChannelType.WEBHOOK) and not self.url:
+            raise ValueError("Slack/Webhook通知必须提供url")
+        if self.type == NotificationChannelType.EMAIL and not self.recipients:
+            raise ValueError("邮件通知必须提供收件人")
+
+
+class WebhookDeliveryStatus(str, Enum):
+    """Webhook投递状态枚举"""
+    PENDING = "pending"      # 等待首次发送或重试
+    DELIVERED = "delivered"
+    FAILED = "failed"        # 重试次数用尽
+
+
+class WebhookAttempt(BaseModel):
+    """单次Webhook发送记录"""
+    attempt: int = Field(..., ge=1, description="第几次发送")
+    timestamp: datetime = Field(default_factory=datetime.now, description="发送时间")
+    status_code: Optional[int] = Field(None, description="响应状态码")
+    error: Optional[str] = Field(None, description="错误信息")
+    duration_ms: int = Field(default=0, ge=0, description="耗时（毫秒）")
+
+
+class WebhookDelivery(BaseModel):
+    """持久化的Webhook投递记录"""
+    delivery_id: str = Field(..., description="投递唯一标识，作为X-Webhook-Id请求头发送")
+    tenant_id: str = Field(default="default", description="所属租户")
+    task_id: Optional[str] = Field(None, description="关联的任务")
+    event: str = Field(..., description="事件类型")
+    url: str = Field(..., description="Webhook地址")
+    headers: Dict[str, str] = Field(default_factory=dict, description="附加请求头")
+    payload: dict = Field(default_factory=dict, description="事件数据")
+    global_channel: bool = Field(default=False, description="是否为全局通知渠道的投递，使用全局签名密钥，否则使用所属租户的密钥")
+    status: WebhookDeliveryStatus = Field(default=WebhookDeliveryStatus.PENDING, description="投递状态")
+    attempts: List[WebhookAttempt] = Field(default_factory=list, description="发送记录")
+    next_attempt_at: Optional[datetime] = Field(None, description="下次重试时间")
+    created_at: datetime = Field(default_factory=datetime.now, description="创建时间")
+    delivered_at: Optional[datetime] = Field(None, description="投递成功时间")
+
+
+class DeliveryType(str, Enum):
+    """输出投递目标类型枚举"""
+    S3 = "s3"
+    SFTP = "sftp"
+    WEBDAV = "webdav"
+
+
+class DeliveryConfig(BaseModel):
+    """拆分结果投递配置，凭据只通过引用名从服务端配置中读取"""
+    type: DeliveryType = Field(..., description="目标类型: s3/sftp/webdav")
+    target: str = Field(..., min_length=1, description="S3存储桶名、SFTP主机（host[:port]）或WebDAV地址")
+    path: str = Field(default="", description="目标目录或对象键前缀")
+    credentials_ref: str = Field(..., min_length=1, description="服务端DELIVERY_CREDENTIALS中的凭据名称")
+    key_template: Optional[str] = Field(
+        None,
+        max_length=300,
+        description="章节文件的对象键模板（仅S3，相对于path），如 books/{title_slug}/{chapter_index:02d}_{chapter_slug}.pdf，"
+                    "清单等其他文件放在第一个章节所在的目录；为空时按文件名平铺"
+    )
+
+
+class ConnectorProvider(str, Enum):
+    """云盘连接器类型枚举"""
+    GOOGLE_DRIVE = "google_drive"
+    DROPBOX = "dropbox"
+
+
+class ConnectorExport(BaseModel):
+    """拆分结果写回云盘的配置"""
+    provider: ConnectorProvider = Field(..., description="云盘类型")
+    folder: str = Field(default="", description="目标文件夹（Drive为文件夹ID，Dropbox为路径）")
 
 
 class SectionInfo(BaseModel):
@@ -58,9 +292,21 @@ class ChapterInfo(BaseModel):
     """章节信息模型"""
     id: Optional[str] = Field(None, description="章节唯一标识")
     title: str = Field(..., description="章节标题")
+    raw_title: Optional[str] = Field(None, description="规范化前的原始标题")
     start_page: int = Field(..., ge=1, description="起始页码")
     end_page: int = Field(..., ge=1, description="结束页码")
     page_count: int = Field(..., ge=1, description="页面数量")
+    start_label: Optional[str] = Field(None, description="起始页的逻辑页码标签")
+    end_label: Optional[str] = Field(None, description="结束页的逻辑页码标签")
+    section_type: SectionType = Field(default=SectionType.CHAPTER, description="区域类型")
+    language: Optional[str] = Field(None, description="章节语言（ISO 639-1代码，如 zh、en），文字过少时沿用文档语言")
+    word_count: Optional[int] = Field(None, ge=0, description="字数（中文和日文按字计，其他语言按单词计），分析时统计")
+    character_count: Optional[int] = Field(None, ge=0, description="不含空白的字符数，分析时统计")
+    reading_minutes: Optional[int] = Field(None, ge=0, description="按章节语言的平均阅读速度估算的阅读时间（分钟）")
+    image_count: Optional[int] = Field(None, ge=0, description="图片数（重复出现的同一图片只计一次），分析时统计")
+    table_count: Optional[int] = Field(None, ge=0, description="检测到的表格数，分析时统计")
+    extract: bool = Field(default=True, description="拆分时是否输出该章节，为false时不生成文件（仍参与边界修正和短章节合并）")
+    members: List["ChapterInfo"] = Field(default_factory=list, description="按分组合并输出时的成员章节，在输出文件中生成为下级书签")
     sections: List[SectionInfo] = Field(default_factory=list, description="节列表")
     
     def model_post_init(self, __context) -> None:
@@ -73,6 +319,12 @@ class ChapterInfo(BaseModel):
             self.page_count = expected_count
 
 
+class DownloadStats(BaseModel):
+    """单个文件的下载统计"""
+    count: int = Field(default=0, ge=0, description="下载次数")
+    last_accessed: Optional[datetime] = Field(None, description="最后下载时间")
+
+
 class FileInfo(BaseModel):
     """文件信息模型"""
     file_id: str = Field(..., description="文件唯一标识")
@@ -80,7 +332,248 @@ class FileInfo(BaseModel):
     file_size: int = Field(..., ge=0, description="文件大小（字节）")
     file_path: str = Field(..., description="文件存储路径")
     upload_time: datetime = Field(..., description="上传时间")
+    file_hash: Optional[str] = Field(None, description="文件内容SHA-256")
     status: FileStatus = Field(default=FileStatus.UPLOADED, description="文件状态")
+    page_offset: Optional[int] = Field(None, description="印刷页码偏移量（物理页 = 印刷页 + 偏移量）")
+    repaired: bool = Field(default=False, description="是否使用修复后的副本")
+    signature_count: int = Field(default=0, ge=0, description="原文件中已签名的数字签名数")
+    original_hash: Optional[str] = Field(None, description="上传内容的SHA-256（修复后file_hash为副本的哈希）")
+    download_count: int = Field(default=0, ge=0, description="原文件和全部输出文件的下载总次数")
+    last_accessed: Optional[datetime] = Field(None, description="最后一次下载时间")
+    downloads: Dict[str, DownloadStats] = Field(default_factory=dict, description="按文件名统计的下载次数，原文件记为 original.pdf")
+    original_expires_at: Optional[datetime] = Field(None, description="原文件按保留策略的删除时间，不清理或已删除时为空")
+    outputs_expires_at: Optional[datetime] = Field(None, description="章节输出按保留策略的删除时间，不清理或没有输出时为空")
+    collection: Optional[str] = Field(None, description="批量导入时文件在压缩包中所在的目录（如 数学/代数），按目录打包下载时还原层级")
+    tags: List[str] = Field(default_factory=list, description="标签，用于在文件列表中筛选")
+    title: Optional[str] = Field(None, description="文档标题（PDF元数据或首页文字）")
+    author: Optional[str] = Field(None, description="文档作者（PDF元数据或首页文字）")
+    display_name: Optional[str] = Field(None, description="文件列表中显示的名称，如 \"Deep Learning – Goodfellow\"")
+    edition: Optional[str] = Field(None, description="版次（外部书目元数据）")
+    isbn: Optional[str] = Field(None, description="文档前几页中识别到的ISBN")
+    doi: Optional[str] = Field(None, description="文档前几页中识别到的DOI")
+    engine_failures: int = Field(default=0, ge=0, description="相同内容的文件连续导致处理引擎崩溃的任务数，成功拆分后清零")
+    status_before_quarantine: Optional[FileStatus] = Field(None, description="被隔离前的文件状态，解除隔离时恢复")
+    quarantined_at: Optional[datetime] = Field(None, description="被隔离的时间")
+    quarantine_reason: Optional[str] = Field(None, description="隔离前最后一次引擎崩溃的原因")
+    api_key_id: Optional[str] = Field(None, description="上传文件使用的签发API Key，用于统计Key级存储用量")
+    deduplicated: bool = Field(default=False, exclude=True, description="本次上传与已有文件内容相同，返回的是已有文件（不持久化）")
+
+
+class FileSummary(BaseModel):
+    """文件列表中的文件"""
+    file_id: str = Field(..., description="文件唯一标识")
+    filename: str = Field(..., description="原始文件名")
+    display_name: str = Field(..., description="显示名称：标题 – 作者，无法识别标题时为文件名")
+    title: Optional[str] = Field(None, description="文档标题")
+    author: Optional[str] = Field(None, description="文档作者")
+    edition: Optional[str] = Field(None, description="版次")
+    isbn: Optional[str] = Field(None, description="ISBN")
+    doi: Optional[str] = Field(None, description="DOI")
+    file_size: int = Field(..., description="文件大小（字节）")
+    upload_time: datetime = Field(..., description="上传时间")
+    status: FileStatus = Field(..., description="文件状态")
+    quarantine_reason: Optional[str] = Field(None, description="文件被隔离的原因")
+    collection: Optional[str] = Field(None, description="文件所属的目录")
+    tags: List[str] = Field(default_factory=list, description="标签")
+    download_count: int = Field(default=0, description="下载总次数")
+    original_expires_at: Optional[datetime] = Field(None, description="原文件按保留策略的删除时间")
+    outputs_expires_at: Optional[datetime] = Field(None, description="章节输出按保留策略的删除时间")
+
+
+class TagsRequest(BaseModel):
+    """添加标签请求"""
+    tags: List[str] = Field(..., min_length=1, max_length=50, description="要添加的标签，已有的标签忽略")
+
+
+class TagCount(BaseModel):
+    """标签及使用该标签的文件数"""
+    tag: str = Field(..., description="标签")
+    files: int = Field(..., description="文件数")
+
+
+class ErrorResponse(BaseModel):
+    """错误响应"""
+    detail: Any = Field(..., description="错误描述，参数校验失败时为各字段的错误列表")
+    code: ErrorCode = Field(..., description="错误代码")
+
+
+class ResponseWarning(BaseModel):
+    """不影响结果的问题，随上传、分析、拆分和任务响应返回"""
+    code: WarningCode = Field(..., description="警告代码")
+    message: str = Field(..., description="警告描述")
+    details: dict = Field(default_factory=dict, description="警告详情，如页码、章节序号")
+
+
+class TaskEvent(BaseModel):
+    """任务事件模型"""
+    event: str = Field(..., description="事件类型: scheduled/due/queued/started/chapter_done/retried/completed/failed/cancelled")
+    message: str = Field(default="", description="事件描述")
+    timestamp: datetime = Field(default_factory=datetime.now, description="发生时间")
+    progress: Optional[int] = Field(None, ge=0, le=100, description="事件发生时的进度")
+    details: dict = Field(default_factory=dict, description="事件详情")
+
+
+class BatesConfig(BaseModel):
+    """跨章节连续的Bates编号"""
+    prefix: str = Field(default="", max_length=50, description="编号前缀，如 ACME-")
+    start: int = Field(default=1, ge=0, description="起始编号")
+    digits: int = Field(default=6, ge=1, le=12, description="编号位数，不足补零")
+    position: StampPosition = Field(default=StampPosition.BOTTOM_RIGHT, description="编号位置")
+    font_size: float = Field(default=9, ge=4, le=36, description="字号")
+
+
+class PageNumberStamp(BaseModel):
+    """章节输出的页码，每个章节从起始页码重新编号"""
+    format: str = Field(default="{page}", max_length=100, description="页码格式，可用占位符 {page}、{total}，如 \"第 {page} 页 / 共 {total} 页\"")
+    start: int = Field(default=1, ge=0, description="每个章节的起始页码")
+    position: StampPosition = Field(default=StampPosition.BOTTOM_CENTER, description="页码位置")
+    font_size: float = Field(default=9, ge=4, le=36, description="字号")
+
+
+class RedactionSpec(BaseModel):
+    """拆分前的涂黑规则，真正删除区域内的文字和图片；只指定page时整页清空"""
+    page: Optional[int] = Field(None, ge=1, description="物理页码，为空时作用于所有页")
+    rect: Optional[List[float]] = Field(None, description="区域 [x0, y0, x1, y1]（PDF坐标，单位pt，原点在左上角）")
+    pattern: Optional[str] = Field(None, max_length=500, description="正则表达式，涂黑匹配的文字")
+
+
+class PageRange(BaseModel):
+    """原文件的物理页范围（包含两端）"""
+    start: int = Field(..., ge=1, description="起始页码")
+    end: Optional[int] = Field(None, ge=1, description="结束页码，为空时只包含起始页")
+    
+    def model_post_init(self, __context) -> None:
+        """模型初始化后验证"""
+        if self.end is not None and self.end < self.start:
+            raise ValueError("结束页码不能小于起始页码")
+
+
+# 任务中只供服务端使用的字段，接口返回任务时排除：通知地址和请求头、投递和导出目标可能携带凭据
+TASK_PRIVATE_FIELDS = {"notifications", "delivery", "export"}
+
+
+class SplitTask(BaseModel):
+    """拆分任务模型（异步分析任务共用）"""
+    task_id: str = Field(..., description="任务唯一标识")
+    file_id: str = Field(..., description="文件唯一标识")
+    task_type: TaskType = Field(default=TaskType.SPLIT, description="任务类型")
+    chapters: List[ChapterInfo] = Field(default_factory=list, description="待拆分章节列表")
+    status: TaskStatus = Field(default=TaskStatus.PENDING, description="任务状态")
+    progress: int = Field(default=0, ge=0, le=100, description="任务进度")
+    created_at: datetime = Field(default_factory=datetime.now, description="创建时间")
+    completed_at: Optional[datetime] = Field(None, description="完成时间")
+    download_links: List[str] = Field(default_factory=list, description="生成的章节文件名")
+    error_message: Optional[str] = Field(None, description="错误信息")
+    error_code: Optional[ErrorCode] = Field(None, description="失败任务的错误代码")
+    error_details: Optional[dict] = Field(None, description="失败原因的诊断信息，如外部引擎的退出码和输出摘录")
+    notifications: List[NotificationConfig] = Field(default_factory=list, description="请求级通知配置")
+    run_at: Optional[datetime] = Field(None, description="计划执行时间（延迟任务）")
+    priority: TaskPriority = Field(default=TaskPriority.NORMAL, description="任务优先级")
+    analysis_request: Optional["AnalyzeRequest"] = Field(None, description="异步分析任务的请求参数")
+    analysis_result: Optional["AnalyzeResponse"] = Field(None, description="异步分析任务的结果")
+    delivery: Optional[DeliveryConfig] = Field(None, description="完成后推送章节文件的目标")
+    export: Optional[ConnectorExport] = Field(None, description="完成后写回的云盘文件夹")
+    filename_template: str = Field(default="{index:02d}_{title}", description="章节文件名模板")
+    optimize: bool = Field(default=False, description="是否压缩输出文件")
+    strip_metadata: bool = Field(default=False, description="是否清除输出文件的元数据")
+    watermark_text: Optional[str] = Field(None, description="输出文件的水印文字")
+    max_output_bytes: Optional[int] = Field(None, description="单个章节文件大小上限")
+    attachments: AttachmentMode = Field(default=AttachmentMode.NONE, description="章节输出携带的文档级嵌入附件")
+    redactions: List[RedactionSpec] = Field(default_factory=list, description="拆分前的涂黑规则")
+    bates: Optional[BatesConfig] = Field(None, description="跨章节连续的Bates编号")
+    page_numbers: Optional[PageNumberStamp] = Field(None, description="每个章节重新编号的页码")
+    pdfa: bool = Field(default=False, description="是否转换为PDF/A-2b")
+    grayscale: bool = Field(default=False, description="是否转换为灰度")
+    strip_backgrounds: bool = Field(default=False, description="是否删除背景图片")
+    deskew: bool = Field(default=False, description="是否纠正扫描页的方向和倾斜")
+    ocr_text_layer: bool = Field(default=False, description="是否为扫描页写入不可见的OCR文字层")
+    best_effort: bool = Field(default=False, description="是否跳过无法读取的页面而不使章节失败")
+    unreadable_pages: UnreadablePageHandling = Field(default=UnreadablePageHandling.PLACEHOLDER, description="尽力拆分模式下无法读取页面的处理方式")
+    damaged_pages: List[int] = Field(default_factory=list, description="尽力拆分模式下无法读取而跳过或替换为占位页的原文件页码")
+    bookmarked_copy: bool = Field(default=False, description="是否额外输出按章节结构重建书签的原文件副本")
+    exclude_pages: List[PageRange] = Field(default_factory=list, description="从所有章节输出中删除的原文件页")
+    group_dividers: bool = Field(default=False, description="是否在分组输出的每个成员章节前插入分隔页")
+    bundle: bool = Field(default=False, description="是否在拆分时逐章写入打包文件")
+    signatures: SignatureHandling = Field(default=SignatureHandling.STRIP, description="已签名文件的拆分方式")
+    sign: SigningMode = Field(default=SigningMode.NONE, description="章节输出的数字签名方式")
+    bypass_cache: bool = Field(default=False, description="是否忽略已有输出强制重新拆分")
+    cache_key: Optional[str] = Field(None, description="输出缓存键（文件哈希、章节和输出选项）")
+    cache_hit: bool = Field(default=False, description="是否复用了已有输出")
+    preset_id: Optional[str] = Field(None, description="创建任务时应用的预设")
+    tenant_id: str = Field(default="default", description="所属租户")
+    owner: Optional[str] = Field(None, description="创建任务的用户")
+    worker_node: Optional[str] = Field(None, description="任务所在队列或正在处理任务的副本节点")
+    expires_at: Optional[datetime] = Field(None, description="任务记录按保留策略的删除时间，未结束或不清理时为空")
+    warnings: List[ResponseWarning] = Field(default_factory=list, description="处理过程中的警告")
+
+
+class ManifestEntry(BaseModel):
+    """输出清单条目"""
+    filename: str = Field(..., description="章节文件名")
+    title: str = Field(..., description="章节标题")
+    start_page: int = Field(..., description="起始页码")
+    end_page: int = Field(..., description="结束页码")
+    pages: int = Field(..., description="页数")
+    size: int = Field(..., description="文件大小（字节）")
+    sha256: str = Field(..., description="文件SHA-256")
+    bates_start: Optional[str] = Field(None, description="首页Bates编号")
+    bates_end: Optional[str] = Field(None, description="末页Bates编号")
+    conformance: Optional[str] = Field(None, description="归档格式，如 PDF/A-2b")
+    conversion_issues: List[str] = Field(default_factory=list, description="转换时移除或无法转换的特性")
+    signed_by: Optional[str] = Field(None, description="签名证书主体")
+    damaged_pages: List[int] = Field(default_factory=list, description="无法读取而跳过或替换为占位页的原文件页码")
+    corrected_pages: List[int] = Field(default_factory=list, description="纠正了方向或倾斜的章节内页码")
+    ocr_pages: List[int] = Field(default_factory=list, description="写入了OCR文字层的章节内页码")
+    excluded_pages: List[int] = Field(default_factory=list, description="按exclude_pages从该章节删除的原文件页码")
+
+
+class OutputManifest(BaseModel):
+    """章节输出校验清单"""
+    generated_at: datetime = Field(default_factory=datetime.now, description="生成时间")
+    files: List[ManifestEntry] = Field(default_factory=list, description="章节文件列表")
+    cache_key: Optional[str] = Field(None, description="生成这些输出的缓存键，仅在全部章节成功时记录")
+
+
+class TaskReport(BaseModel):
+    """拆分任务完成时生成的报告快照，之后同一文件重新拆分不影响已有报告"""
+    task_id: str = Field(..., description="任务唯一标识")
+    file_id: str = Field(..., description="文件唯一标识")
+    filename: Optional[str] = Field(None, description="原文件名")
+    file_hash: Optional[str] = Field(None, description="拆分所用文件的SHA-256")
+    generated_at: datetime = Field(default_factory=datetime.now, description="报告生成时间")
+    created_at: datetime = Field(..., description="任务创建时间")
+    started_at: Optional[datetime] = Field(None, description="开始处理时间")
+    completed_at: Optional[datetime] = Field(None, description="完成时间")
+    queued_seconds: Optional[float] = Field(None, description="排队耗时（秒）")
+    processing_seconds: Optional[float] = Field(None, description="处理耗时（秒）")
+    owner: Optional[str] = Field(None, description="创建任务的用户")
+    preset_id: Optional[str] = Field(None, description="创建任务时应用的预设")
+    options: dict = Field(default_factory=dict, description="影响输出的拆分选项")
+    chapters_requested: int = Field(default=0, ge=0, description="请求拆分的章节数")
+    files: List[ManifestEntry] = Field(default_factory=list, description="生成的章节文件（含校验和）")
+    chapter_seconds: Dict[str, float] = Field(default_factory=dict, description="按文件名统计的章节处理耗时（秒）")
+    failed_chapters: List[str] = Field(default_factory=list, description="拆分失败的章节及原因")
+    warnings: List[ResponseWarning] = Field(default_factory=list, description="处理过程中的警告")
+    cache_hit: bool = Field(default=False, description="是否复用了已有输出")
+
+
+class AttachmentInfo(BaseModel):
+    """PDF中的嵌入附件"""
+    name: str = Field(..., description="附件标识，用于下载")
+    filename: str = Field(..., description="附件文件名")
+    description: Optional[str] = Field(None, description="附件描述")
+    size: int = Field(..., ge=0, description="附件大小（字节）")
+    page: Optional[int] = Field(None, description="附件注释所在的物理页码，文档级附件为空")
+
+
+class ExtractedImage(BaseModel):
+    """从章节中提取的图片"""
+    filename: str = Field(..., description="压缩包内的文件名")
+    pages: List[int] = Field(default_factory=list, description="出现该图片的物理页码")
+    width: int = Field(..., description="宽度（像素）")
+    height: int = Field(..., description="高度（像素）")
+    size: int = Field(..., description="文件大小（字节）")
+    sha256: str = Field(..., description="图片内容SHA-256，用于去重")
 
 
 class BookInfo(BaseModel):
@@ -132,16 +625,93 @@ class PDFMetadata(BaseModel):
     status: FileStatus = Field(default=FileStatus.UPLOADED, description="处理状态")
     has_bookmarks: bool = Field(default=False, description="是否包含书签")
     has_text: bool = Field(default=False, description="是否包含可提取文本")
+    has_page_labels: bool = Field(default=False, description="是否定义了页码标签")
+    language: Optional[str] = Field(None, description="文档主要语言（ISO 639-1代码），无法判断时为空")
 
 
 # API请求和响应模型
 
+class UploadSessionStatus(str, Enum):
+    """分段上传会话状态枚举"""
+    CREATED = "created"
+    UPLOADED = "uploaded"
+    FINALIZED = "finalized"
+
+
+class UploadSessionRequest(BaseModel):
+    """创建上传会话请求"""
+    filename: str = Field(..., min_length=1, max_length=255, description="文件名（.pdf）")
+    size: Optional[int] = Field(None, ge=1, description="文件大小，提供时上传的数据必须一致")
+
+
+class UploadSession(BaseModel):
+    """分段上传会话：创建 → 上传数据 → 携带校验和完成，未完成的会话过期后回收"""
+    session_id: str = Field(..., description="会话唯一标识")
+    filename: str = Field(..., description="文件名")
+    size: Optional[int] = Field(None, description="声明的文件大小")
+    status: UploadSessionStatus = Field(default=UploadSessionStatus.CREATED, description="会话状态")
+    received_bytes: int = Field(default=0, ge=0, description="已接收字节数")
+    sha256: Optional[str] = Field(None, description="已接收数据的SHA-256")
+    file_id: Optional[str] = Field(None, description="完成后生成的文件ID")
+    created_at: datetime = Field(default_factory=datetime.now, description="创建时间")
+    expires_at: datetime = Field(..., description="过期时间，过期后会话和已上传的数据被删除")
+    tenant_id: str = Field(default="default", description="所属租户")
+
+
+class UploadFinalizeRequest(BaseModel):
+    """完成上传会话请求"""
+    sha256: str = Field(..., pattern=r"^[0-9a-fA-F]{64}$", description="客户端计算的文件SHA-256")
+
+
+class CompletedSplit(BaseModel):
+    """已完成的拆分任务摘要"""
+    task_id: str = Field(..., description="任务唯一标识")
+    completed_at: Optional[datetime] = Field(None, description="完成时间")
+    download_links: List[str] = Field(default_factory=list, description="生成的章节文件名")
+
+
+class DuplicateUpload(BaseModel):
+    """重复上传时已有文件的处理结果，客户端可直接跳转到下载"""
+    uploaded_at: datetime = Field(..., description="已有文件的上传时间")
+    analysis: Optional["AnalyzeResponse"] = Field(None, description="最近一次章节分析结果")
+    completed_tasks: List[CompletedSplit] = Field(default_factory=list, description="已完成的拆分任务（按完成时间倒序，章节目录保存最近一次的输出）")
+    archive_url: Optional[str] = Field(None, description="已有章节输出的打包下载地址")
+
+
 class UploadResponse(BaseModel):
     """文件上传响应"""
     file_id: str = Field(..., description="文件唯一标识")
     filename: str = Field(..., description="文件名")
+    display_name: Optional[str] = Field(None, description="显示名称：标题 – 作者，无法识别标题时为文件名")
     file_size: int = Field(..., description="文件大小")
     message: str = Field(..., description="响应消息")
+    warnings: List[ResponseWarning] = Field(default_factory=list, description="警告（如数字签名将在拆分后失效）")
+    duplicate: Optional[DuplicateUpload] = Field(None, description="内容与已有文件相同时返回已有文件的处理结果")
+    ephemeral: bool = Field(default=False, description="是否为隐私模式上传（打包下载一次后删除）")
+    expires_at: Optional[datetime] = Field(None, description="隐私模式文件的最迟删除时间")
+    collection: Optional[str] = Field(None, description="文件所属的目录（批量导入时为压缩包中的目录）")
+
+
+class UploadResult(BaseModel):
+    """一次上传多个文件时单个文件的结果"""
+    filename: str = Field(..., description="文件名")
+    success: bool = Field(..., description="是否上传成功")
+    file: Optional[UploadResponse] = Field(None, description="上传成功时的文件信息")
+    error: Optional[str] = Field(None, description="失败原因")
+    code: Optional[ErrorCode] = Field(None, description="失败时的错误代码")
+
+
+class BatchUploadError(BaseModel):
+    """批量上传失败条目"""
+    entry: str = Field(..., description="压缩包内条目名")
+    error: str = Field(..., description="失败原因")
+
+
+class BatchUploadResponse(BaseModel):
+    """批量上传响应"""
+    files: List[UploadResponse] = Field(default_factory=list, description="成功上传的文件")
+    failed: List[BatchUploadError] = Field(default_factory=list, description="未通过校验的条目")
+    message: str = Field(..., description="响应消息")
 
 
 class AnalyzeRequest(BaseModel):
@@ -149,6 +719,10 @@ class AnalyzeRequest(BaseModel):
     file_id: str = Field(..., description="文件唯一标识")
     auto_detect: bool = Field(default=True, description="是否自动检测章节")
     min_pages_per_chapter: int = Field(default=1, ge=1, description="每章最少页数")
+    normalize_titles: bool = Field(default=False, description="是否规范化章节标题（去除引导符、页码和OCR错误）")
+    normalize_titles_llm: bool = Field(default=False, description="规则清洗后是否再用大模型规范化标题")
+    force_refresh: bool = Field(default=False, description="忽略缓存重新分析")
+    preset_id: Optional[str] = Field(None, description="应用预设中的识别策略，请求中显式提供的字段优先")
 
 
 class AnalyzeResponse(BaseModel):
@@ -156,8 +730,559 @@ class AnalyzeResponse(BaseModel):
     success: bool = Field(..., description="分析是否成功")
     chapters: List[ChapterInfo] = Field(default_factory=list, description="章节列表")
     total_pages: int = Field(..., ge=0, description="总页数")
+    language: Optional[str] = Field(None, description="文档主要语言（ISO 639-1代码），无法判断时为空")
     message: Optional[str] = Field(None, description="响应消息")
     suggestions: Optional[List[ChapterInfo]] = Field(None, description="备选建议")
+    page_labels: Optional[List[str]] = Field(None, description="按物理页顺序排列的逻辑页码标签（PDF定义了页码标签时返回）")
+    merges: List[ChapterMerge] = Field(default_factory=list, description="按min_pages_per_chapter合并的短章节")
+    warnings: List[ResponseWarning] = Field(default_factory=list, description="识别过程中的警告")
+    cached: bool = Field(default=False, description="结果是否来自缓存")
+
+
+class BoundaryAdjustment(BaseModel):
+    """章节边界自动修正记录"""
+    chapter_index: int = Field(..., ge=1, description="章节序号（从1开始）")
+    title: str = Field(..., description="章节标题")
+    field: str = Field(..., description="被修改的字段: start_page/end_page")
+    old_value: int = Field(..., description="原值")
+    new_value: int = Field(..., description="新值")
+    reason: str = Field(..., description="修正原因")
+
+
+class ChapterMerge(BaseModel):
+    """短章节合并记录"""
+    title: str = Field(..., description="被合并的章节标题")
+    start_page: int = Field(..., ge=1, description="被合并章节的起始页")
+    end_page: int = Field(..., ge=1, description="被合并章节的结束页")
+    merged_into: str = Field(..., description="合并目标章节标题")
+
+
+class ChapterGroup(BaseModel):
+    """合并输出到一个文件的连续章节"""
+    title: str = Field(..., min_length=1, max_length=500, description="分组标题，作为输出文件的章节标题，如“第一部分”")
+    first: int = Field(..., ge=1, description="第一个章节的序号（从1开始）")
+    last: int = Field(..., ge=1, description="最后一个章节的序号（包含）")
+
+
+class SplitRequest(BaseModel):
+    """PDF拆分请求"""
+    file_id: str = Field(..., description="文件唯一标识")
+    chapters: List[ChapterInfo] = Field(default_factory=list, description="章节列表，strategy为bookmarks时忽略")
+    strategy: SplitStrategy = Field(default=SplitStrategy.MANUAL, description="章节来源：manual使用chapters，bookmarks在文件书签处拆分")
+    max_depth: int = Field(default=1, ge=1, le=10, description="strategy为bookmarks时参与拆分的最深书签层级，如2表示在部分和节两级书签处拆分")
+    include: Optional[List[int]] = Field(None, min_length=1, description="只输出这些序号的章节（从1开始，按chapters或书签顺序），为空时按各章节的extract输出")
+    groups: List[ChapterGroup] = Field(default_factory=list, description="把连续的章节合并输出到一个文件，成员章节及其节保留为文件内的书签树")
+    group_dividers: bool = Field(default=False, description="在分组输出的每个成员章节前插入印有章节标题的分隔页（如制作课程读本），成员章节的书签指向分隔页")
+    bundle: bool = Field(default=False, description="每完成一章即追加到ZIP打包文件，拆分结束时打包即已完成，ZIP打包下载直接发送该文件（带Content-Length），不必每次下载时重新压缩")
+    notifications: List[NotificationConfig] = Field(default_factory=list, description="任务完成/失败时的通知渠道")
+    delivery: Optional[DeliveryConfig] = Field(None, description="拆分完成后将章节文件推送到S3/SFTP/WebDAV")
+    export: Optional[ConnectorExport] = Field(None, description="拆分完成后将章节文件写回Google Drive/Dropbox")
+    run_at: Optional[datetime] = Field(None, description="计划执行时间，为空或已过期时立即执行")
+    priority: TaskPriority = Field(default=TaskPriority.NORMAL, description="任务优先级: low/normal/high")
+    auto_fix: bool = Field(default=False, description="是否自动修正章节间的小重叠和间隙")
+    min_pages_per_chapter: int = Field(default=1, ge=1, description="少于该页数的章节并入前一章")
+    section_handling: SectionHandling = Field(
+        default=SectionHandling.INCLUDE,
+        description="非正文区域（封面、前言、目录、附录、参考文献、索引）的默认处理方式"
+    )
+    section_handling_overrides: Dict[SectionType, SectionHandling] = Field(
+        default_factory=dict,
+        description="按区域类型覆盖处理方式，如 {\"index\": \"exclude\"}"
+    )
+    numbering: PageNumbering = Field(
+        default=PageNumbering.PHYSICAL,
+        description="章节页码体系，logical时按start_label/end_label（缺省取start_page/end_page的文本）解析，printed时按文件校准偏移量换算"
+    )
+    filename_template: str = Field(
+        default="{index:02d}_{title}",
+        description="章节文件名模板（不含扩展名），可用 {index}、{title}、{start_page}、{end_page}"
+    )
+    optimize: bool = Field(default=False, description="是否压缩输出文件（清理未引用对象并压缩数据流）")
+    strip_metadata: Optional[bool] = Field(None, description="是否清除输出文件的元数据，为空时按组织策略")
+    watermark_text: Optional[str] = Field(None, max_length=100, description="水印文字，为空时按组织策略，空字符串表示不加水印")
+    max_output_bytes: Optional[int] = Field(None, ge=1, description="单个章节文件大小上限，为空时按组织策略")
+    attachments: AttachmentMode = Field(default=AttachmentMode.NONE, description="章节输出携带的文档级嵌入附件：none/all/referenced（文件名在章节正文中出现），页面上的附件注释始终随页面保留")
+    redactions: List[RedactionSpec] = Field(default_factory=list, description="拆分前的涂黑规则（页码、区域或正则），在章节输出中真正删除对应内容")
+    bates: Optional[BatesConfig] = Field(None, description="按章节顺序在每页加盖连续的Bates编号，起止编号记录在manifest中")
+    page_numbers: Optional[PageNumberStamp] = Field(None, description="在每个章节输出上重新加盖从start开始的页码")
+    pdfa: bool = Field(default=False, description="将章节输出转换为PDF/A-2b（嵌入字体、转换色彩空间），无法保留的特性记录在manifest中")
+    grayscale: bool = Field(default=False, description="将章节输出转换为灰度，减小文件并降低打印成本")
+    strip_backgrounds: bool = Field(default=False, description="删除覆盖大部分页面的背景图片（仅处理含可见文字的页面，扫描页不受影响）")
+    deskew: bool = Field(default=False, description="用OCR引擎检测扫描页的方向和倾斜，在章节输出中把旋转或歪斜的页面摆正（仅处理扫描页，需要服务器安装Tesseract）")
+    ocr_text_layer: bool = Field(default=False, description="对没有文字的扫描页运行OCR，把识别出的文字作为不可见文字层写入章节输出，使其可搜索、可选中（需要服务器安装Tesseract）")
+    best_effort: bool = Field(default=False, description="尽力拆分：无法读取的页面不再使整个章节失败，按unreadable_pages处理并列在任务的damaged_pages中")
+    unreadable_pages: UnreadablePageHandling = Field(
+        default=UnreadablePageHandling.PLACEHOLDER,
+        description="尽力拆分时无法读取页面的处理方式：skip从章节中省略、placeholder替换为占位页（保持章节页数不变）"
+    )
+    bookmarked_copy: bool = Field(default=False, description="除章节文件外，额外输出一份原文件副本（bookmarked.pdf），书签替换为与章节结构（包括人工编辑）一致的书签树")
+    exclude_pages: List[PageRange] = Field(default_factory=list, description="从所有章节输出中删除的原文件页（如广告、空白页、答案），删除的页码记录在manifest中")
+    signatures: SignatureHandling = Field(
+        default=SignatureHandling.STRIP,
+        description="原文件已数字签名时的处理方式：refuse拒绝拆分、strip删除章节中失效的签名、include_original同时附带未修改的签名原件"
+    )
+    sign: SigningMode = Field(default=SigningMode.NONE, description="用服务端配置的组织证书签名每个章节输出：invisible/visible（最后一页右下角显示签名框）")
+    bypass_cache: bool = Field(default=False, description="忽略相同文件、章节和选项的已有输出，强制重新拆分")
+    preset_id: Optional[str] = Field(None, description="应用预设中的拆分选项，请求中显式提供的字段优先")
+    
+    def model_post_init(self, __context) -> None:
+        """统一转换为本地时间，与任务时间戳保持一致"""
+        if self.run_at and self.run_at.tzinfo is not None:
+            self.run_at = self.run_at.astimezone().replace(tzinfo=None)
+
+
+class PresetAnalyzeOptions(BaseModel):
+    """预设中的章节识别策略，为空的字段不覆盖请求默认值"""
+    auto_detect: Optional[bool] = Field(None, description="是否自动检测章节")
+    min_pages_per_chapter: Optional[int] = Field(None, ge=1, description="每章最少页数")
+    normalize_titles: Optional[bool] = Field(None, description="是否规范化章节标题")
+    normalize_titles_llm: Optional[bool] = Field(None, description="是否用大模型规范化标题")
+
+
+class PresetSplitOptions(BaseModel):
+    """预设中的拆分选项，为空的字段不覆盖请求默认值"""
+    filename_template: Optional[str] = Field(None, description="章节文件名模板")
+    strategy: Optional[SplitStrategy] = Field(None, description="章节来源")
+    max_depth: Optional[int] = Field(None, ge=1, le=10, description="在书签处拆分时的最深书签层级")
+    optimize: Optional[bool] = Field(None, description="是否压缩输出文件")
+    auto_fix: Optional[bool] = Field(None, description="是否自动修正章节间的小重叠和间隙")
+    min_pages_per_chapter: Optional[int] = Field(None, ge=1, description="少于该页数的章节并入前一章")
+    section_handling: Optional[SectionHandling] = Field(None, description="非正文区域的默认处理方式")
+    section_handling_overrides: Optional[Dict[SectionType, SectionHandling]] = Field(None, description="按区域类型覆盖处理方式")
+    numbering: Optional[PageNumbering] = Field(None, description="章节页码体系")
+    priority: Optional[TaskPriority] = Field(None, description="任务优先级")
+    notifications: Optional[List[NotificationConfig]] = Field(None, description="通知渠道")
+    delivery: Optional[DeliveryConfig] = Field(None, description="投递目标")
+    export: Optional[ConnectorExport] = Field(None, description="写回的云盘文件夹")
+
+
+class SplitPresetRequest(BaseModel):
+    """创建或更新预设的请求"""
+    name: str = Field(..., min_length=1, max_length=100, description="预设名称，如“教材”")
+    description: Optional[str] = Field(None, max_length=500, description="说明")
+    analyze: PresetAnalyzeOptions = Field(default_factory=PresetAnalyzeOptions, description="章节识别策略")
+    split: PresetSplitOptions = Field(default_factory=PresetSplitOptions, description="拆分选项")
+
+
+class SplitPreset(SplitPresetRequest):
+    """命名的分析和拆分预设"""
+    preset_id: str = Field(..., description="预设唯一标识")
+    created_at: datetime = Field(default_factory=datetime.now, description="创建时间")
+    updated_at: datetime = Field(default_factory=datetime.now, description="更新时间")
+    created_by: Optional[str] = Field(None, description="创建者")
+
+
+class BenchmarkResult(BaseModel):
+    """单个样本的基准测试结果"""
+    sample: str = Field(..., description="样本名称")
+    pages: int = Field(..., description="样本页数")
+    chapters: int = Field(..., description="拆分的章节数")
+    iterations: int = Field(..., description="计时的拆分次数")
+    seconds: List[float] = Field(default_factory=list, description="每次拆分的耗时（秒）")
+    median_seconds: float = Field(..., description="耗时中位数（秒）")
+    pages_per_second: float = Field(..., description="按耗时中位数计算的每秒处理页数")
+    output_bytes: int = Field(..., description="一次拆分的输出文件总大小（字节）")
+    peak_rss_bytes: Optional[int] = Field(None, description="拆分期间进程常驻内存峰值（字节）")
+    peak_allocated_bytes: int = Field(..., description="一次拆分中Python对象分配的峰值（字节，不含MuPDF内部分配）")
+    retained_bytes: int = Field(..., description="一次拆分结束后仍未释放的Python对象（字节）")
+
+
+class BenchmarkRequest(BaseModel):
+    """基准测试请求"""
+    samples: List[str] = Field(default_factory=list, description="内置样本名称，为空时运行全部样本")
+    iterations: int = Field(default=3, ge=1, le=20, description="每个样本计时的拆分次数")
+    optimize: bool = Field(default=False, description="是否压缩输出文件")
+    grayscale: bool = Field(default=False, description="是否转换为灰度")
+    strip_backgrounds: bool = Field(default=False, description="是否删除背景图片")
+    watermark_text: Optional[str] = Field(None, max_length=100, description="水印文字")
+    baseline: List[BenchmarkResult] = Field(default_factory=list, description="用于对比的历史结果，按样本名称匹配")
+    tolerance: float = Field(default=0.2, ge=0, le=1, description="每秒页数低于基线超过该比例时记为退化")
+
+
+class BenchmarkResponse(BaseModel):
+    """基准测试结果"""
+    version: str = Field(..., description="服务版本")
+    engine: str = Field(..., description="PDF引擎及版本")
+    python: str = Field(..., description="Python版本")
+    created_at: datetime = Field(default_factory=datetime.now, description="运行时间")
+    options: dict = Field(default_factory=dict, description="拆分选项")
+    results: List[BenchmarkResult] = Field(default_factory=list, description="各样本结果")
+    regressions: List[str] = Field(default_factory=list, description="相对基线的性能退化")
+
+
+class ProcessingPolicy(BaseModel):
+    """组织级处理策略，合并到每个拆分请求"""
+    strip_metadata: bool = Field(default=False, description="始终清除输出文件的元数据")
+    watermark_text: Optional[str] = Field(None, max_length=100, description="始终添加的水印文字")
+    max_output_bytes: Optional[int] = Field(None, ge=1, description="单个章节文件大小上限，超出的章节记为失败")
+    override_role: Role = Field(default=Role.ADMIN, description="可在请求中放宽以上策略的最低角色")
+    updated_at: Optional[datetime] = Field(None, description="更新时间")
+    updated_by: Optional[str] = Field(None, description="更新者")
+
+
+class SplitResponse(BaseModel):
+    """PDF拆分响应"""
+    task_id: str = Field(..., description="任务唯一标识")
+    status: TaskStatus = Field(..., description="任务状态")
+    message: str = Field(..., description="响应消息")
+    run_at: Optional[datetime] = Field(None, description="计划执行时间")
+    adjustments: List[BoundaryAdjustment] = Field(default_factory=list, description="自动修正的边界")
+    merges: List[ChapterMerge] = Field(default_factory=list, description="合并的短章节")
+    warnings: List[ResponseWarning] = Field(default_factory=list, description="警告，拆分过程中的警告见任务的warnings")
+
+
+class WebhookDeliveriesResponse(BaseModel):
+    """Webhook投递记录响应"""
+    deliveries: List[WebhookDelivery] = Field(default_factory=list, description="投递记录，按创建时间排序")
+    total: int = Field(..., description="记录总数")
+
+
+class TaskEventsResponse(BaseModel):
+    """任务事件时间线响应"""
+    task_id: str = Field(..., description="任务唯一标识")
+    events: List[TaskEvent] = Field(default_factory=list, description="按时间排序的事件列表")
+    total: int = Field(..., description="事件总数")
+
+
+class RepairReport(BaseModel):
+    """PDF修复结果"""
+    damaged: bool = Field(..., description="原文件是否损坏（交叉引用表需要重建或无法打开）")
+    method: str = Field(..., description="修复方式: mupdf/ghostscript")
+    page_count: int = Field(..., ge=0, description="恢复的页数")
+    warnings: List[str] = Field(default_factory=list, description="修复过程中的警告")
+
+
+class StateImportResponse(BaseModel):
+    """服务状态导入结果"""
+    files: int = Field(default=0, description="导入的文件记录数")
+    chapter_edits: int = Field(default=0, description="导入的人工章节编辑数")
+    presets: int = Field(default=0, description="导入的预设数")
+    tasks: int = Field(default=0, description="导入的任务数（仅已结束的任务）")
+    policy: bool = Field(default=False, description="是否导入了处理策略")
+    file_contents: int = Field(default=0, description="写入的原文件和章节文件数")
+    skipped: int = Field(default=0, description="已存在（未指定覆盖）或未结束而跳过的记录数")
+    message: str = Field(default="", description="响应消息")
+
+
+class RepairResponse(RepairReport):
+    """PDF修复响应"""
+    file_id: str = Field(..., description="文件唯一标识")
+    message: str = Field(..., description="响应消息")
+
+
+class CalibrationRequest(BaseModel):
+    """印刷页码校准请求"""
+    printed_page: int = Field(..., description="印刷页码（如正文第1页）")
+    physical_page: int = Field(..., ge=1, description="对应的物理页码")
+
+
+class CalibrationResponse(BaseModel):
+    """印刷页码校准响应"""
+    file_id: str = Field(..., description="文件唯一标识")
+    page_offset: int = Field(..., description="偏移量（物理页 = 印刷页 + 偏移量）")
+    message: str = Field(..., description="响应消息")
+
+
+class SaveChaptersRequest(BaseModel):
+    """保存人工编辑的章节"""
+    chapters: List[ChapterInfo] = Field(..., min_length=1, description="人工确认后的章节列表")
+
+
+class OutlineItem(BaseModel):
+    """书签（可任意层级嵌套）"""
+    title: str = Field(..., min_length=1, max_length=500, description="书签标题")
+    page: Optional[int] = Field(None, ge=1, description="目标页码（物理页），为空表示没有跳转目标")
+    children: List["OutlineItem"] = Field(default_factory=list, description="子书签")
+
+
+class Outline(BaseModel):
+    """文件的书签树"""
+    file_id: str = Field(..., description="文件唯一标识")
+    filename: Optional[str] = Field(None, description="读取的编辑副本文件名，为空表示原文件")
+    page_count: int = Field(..., ge=0, description="文件页数")
+    items: List[OutlineItem] = Field(default_factory=list, description="书签树")
+
+
+class OutlineUpdateRequest(BaseModel):
+    """写入书签请求，以完整的书签树替换原有书签（增删、改名、移动均通过编辑树完成）"""
+    items: List[OutlineItem] = Field(default_factory=list, description="新的书签树，为空时删除全部书签")
+
+
+class OutlineUpdateResponse(BaseModel):
+    """写入书签响应"""
+    file_id: str = Field(..., description="文件唯一标识")
+    filename: str = Field(..., description="生成的副本文件名，通过 /api/download/{file_id}?filename= 下载")
+    bookmarks: int = Field(..., ge=0, description="书签总数（包括各层级）")
+    message: str = Field(..., description="响应消息")
+
+
+class CoursePackItem(BaseModel):
+    """课程读本中的一项内容"""
+    file_id: str = Field(..., description="已上传文件的唯一标识")
+    chapter: Optional[int] = Field(None, ge=1, description="章节序号（从1开始，优先取人工编辑的章节，否则自动分析），为空时按start_page/end_page选取")
+    start_page: Optional[int] = Field(None, ge=1, description="起始物理页码，chapter和start_page都为空时从第1页开始")
+    end_page: Optional[int] = Field(None, ge=1, description="结束物理页码，为空时到章节或文件的最后一页")
+    title: Optional[str] = Field(None, min_length=1, max_length=500, description="在目录和书签中显示的标题，为空时使用章节标题或文件名")
+
+
+class CoursePackRequest(BaseModel):
+    """课程读本生成请求"""
+    title: str = Field(..., min_length=1, max_length=200, description="读本标题，用于封面、文件名和文档标题")
+    subtitle: Optional[str] = Field(None, max_length=500, description="封面副标题，如课程名称和学期")
+    items: List[CoursePackItem] = Field(..., min_length=1, max_length=500, description="读本内容，按输出顺序排列，可来自多个文件")
+    cover: bool = Field(default=True, description="是否生成封面")
+    toc: bool = Field(default=True, description="是否在封面之后生成目录页（条目可点击跳转）")
+    dividers: bool = Field(default=False, description="是否在每项内容前插入印有标题的分隔页")
+
+
+class SampleLanguage(str, Enum):
+    """示例文件的标题和正文语言"""
+    ZH = "zh"  # 第1章 / 第1节
+    EN = "en"  # Chapter 1 / Section 1.1
+
+
+class SampleChapter(BaseModel):
+    """示例文件中的一个章节"""
+    title: Optional[str] = Field(None, max_length=200, description="章节标题（不含编号），为空时按序号生成")
+    pages: int = Field(..., ge=1, le=1000, description="章节页数")
+    sections: int = Field(default=0, ge=0, le=50, description="章节内的节数，节标题均匀分布在章节页中")
+
+
+class SamplePdfRequest(BaseModel):
+    """示例文件生成请求"""
+    title: str = Field(default="示例书籍", min_length=1, max_length=200, description="文档标题，用于封面和文件名")
+    pages: int = Field(default=100, ge=1, le=5000, description="总页数（含前置页），提供chapters时忽略")
+    chapter_count: int = Field(default=10, ge=1, le=500, description="均分的章节数，提供chapters时忽略")
+    sections_per_chapter: int = Field(default=0, ge=0, le=50, description="均分章节时每章的节数")
+    chapters: List[SampleChapter] = Field(default_factory=list, max_length=500, description="逐章指定标题、页数和节数")
+    front_matter_pages: int = Field(default=0, ge=0, le=100, description="第一章之前的前置页数（封面、前言等，不生成书签）")
+    language: SampleLanguage = Field(default=SampleLanguage.ZH, description="标题和正文语言")
+    outline: bool = Field(default=True, description="是否写入书签，关闭时只能按正文标题识别章节")
+    seed: int = Field(default=0, description="正文随机文字的种子，相同请求生成相同内容")
+
+
+class SamplePdfResponse(UploadResponse):
+    """示例文件生成响应"""
+    pages: int = Field(..., description="总页数")
+    chapters: List[ChapterInfo] = Field(default_factory=list, description="生成的章节结构，可作为识别结果的标准答案")
+
+
+class SavedChapters(BaseModel):
+    """文件已保存的人工章节编辑"""
+    file_id: str = Field(..., description="文件唯一标识")
+    chapters: List[ChapterInfo] = Field(default_factory=list, description="章节列表")
+    updated_at: datetime = Field(default_factory=datetime.now, description="保存时间")
+    updated_by: Optional[str] = Field(None, description="保存者")
+
+
+class ChapterDiffRequest(BaseModel):
+    """章节建议对比请求，未提供suggestions时按选项重新分析"""
+    suggestions: Optional[List[ChapterInfo]] = Field(None, description="待对比的章节建议，为空时重新分析文件")
+    auto_detect: bool = Field(default=True, description="是否自动检测章节")
+    min_pages_per_chapter: int = Field(default=1, ge=1, description="每章最少页数")
+    normalize_titles: bool = Field(default=False, description="是否规范化章节标题")
+    normalize_titles_llm: bool = Field(default=False, description="规则清洗后是否再用大模型规范化标题")
+    force_refresh: bool = Field(default=False, description="忽略缓存重新分析（如OCR后）")
+    preset_id: Optional[str] = Field(None, description="应用预设中的识别策略")
+
+
+class ChapterChange(BaseModel):
+    """单条章节差异"""
+    type: str = Field(..., description="差异类型: add/move/remove/rename")
+    saved_index: Optional[int] = Field(None, ge=1, description="人工编辑中的章节序号（从1开始）")
+    suggested_index: Optional[int] = Field(None, ge=1, description="新建议中的章节序号（从1开始）")
+    saved: Optional[ChapterInfo] = Field(None, description="人工编辑中的章节")
+    suggested: Optional[ChapterInfo] = Field(None, description="新建议中的章节")
+
+
+class ChapterDiffResponse(BaseModel):
+    """章节建议与人工编辑的差异"""
+    file_id: str = Field(..., description="文件唯一标识")
+    saved_at: datetime = Field(..., description="人工编辑的保存时间")
+    adds: List[ChapterChange] = Field(default_factory=list, description="新建议中新增的章节")
+    moves: List[ChapterChange] = Field(default_factory=list, description="边界发生变化的章节")
+    removes: List[ChapterChange] = Field(default_factory=list, description="新建议中不存在的章节")
+    renames: List[ChapterChange] = Field(default_factory=list, description="页码范围相同但标题不同的章节")
+    unchanged: int = Field(default=0, ge=0, description="完全一致的章节数")
+
+
+class CompareRequest(BaseModel):
+    """两个版本PDF的章节结构对比请求"""
+    base_file_id: str = Field(..., description="旧版本文件ID")
+    target_file_id: str = Field(..., description="新版本文件ID")
+    use_saved_edits: bool = Field(default=True, description="文件有已保存的人工章节编辑时优先使用")
+    normalize_titles: bool = Field(default=False, description="分析时是否规范化章节标题")
+    min_pages_per_chapter: int = Field(default=1, ge=1, description="分析时每章最少页数")
+    preset_id: Optional[str] = Field(None, description="分析时应用预设中的识别策略")
+    similarity_threshold: float = Field(default=0.6, ge=0, le=1, description="标题模糊匹配的最低相似度")
+
+
+class ChapterMatch(BaseModel):
+    """两个版本间的章节对应关系"""
+    base_index: Optional[int] = Field(None, ge=1, description="旧版本中的章节序号（从1开始）")
+    target_index: Optional[int] = Field(None, ge=1, description="新版本中的章节序号（从1开始）")
+    base: Optional[ChapterInfo] = Field(None, description="旧版本中的章节")
+    target: Optional[ChapterInfo] = Field(None, description="新版本中的章节")
+    similarity: Optional[float] = Field(None, description="标题相似度")
+    page_delta: Optional[int] = Field(None, description="页数变化（新版本 - 旧版本）")
+
+
+class CompareResponse(BaseModel):
+    """两个版本PDF的章节结构对比结果"""
+    base_file_id: str = Field(..., description="旧版本文件ID")
+    target_file_id: str = Field(..., description="新版本文件ID")
+    matched: List[ChapterMatch] = Field(default_factory=list, description="标题一致的章节")
+    renamed: List[ChapterMatch] = Field(default_factory=list, description="标题模糊匹配的章节")
+    added: List[ChapterMatch] = Field(default_factory=list, description="新版本新增的章节")
+    removed: List[ChapterMatch] = Field(default_factory=list, description="新版本删除的章节")
+
+
+class AsyncAnalyzeResponse(BaseModel):
+    """异步章节分析响应"""
+    task_id: str = Field(..., description="分析任务ID，可通过任务接口查询进度和结果")
+    status: TaskStatus = Field(..., description="任务状态")
+    message: str = Field(..., description="响应消息")
+
+
+class BatchDownloadRequest(BaseModel):
+    """批量打包下载请求"""
+    file_ids: List[str] = Field(..., min_length=1, description="文件ID列表")
+    archive_format: ArchiveFormat = Field(default=ArchiveFormat.ZIP, description="打包格式")
+    preserve_folders: bool = Field(default=False, description="是否按文件的collection还原目录层级，每个文件的输出放在 目录/文件名/ 下")
+
+
+class ConnectorStatus(BaseModel):
+    """云盘连接状态"""
+    provider: ConnectorProvider = Field(..., description="云盘类型")
+    connected: bool = Field(..., description="是否已授权")
+    connected_at: Optional[datetime] = Field(None, description="授权时间")
+
+
+class ConnectorAuthorizeResponse(BaseModel):
+    """云盘授权地址响应"""
+    provider: ConnectorProvider = Field(..., description="云盘类型")
+    authorization_url: str = Field(..., description="跳转授权的地址")
+
+
+class ConnectorFile(BaseModel):
+    """云盘文件"""
+    id: str = Field(..., description="文件标识（Drive为文件ID，Dropbox为路径或ID）")
+    name: str = Field(..., description="文件名")
+    size: Optional[int] = Field(None, description="文件大小")
+    modified_at: Optional[str] = Field(None, description="修改时间")
+
+
+class ConnectorImportRequest(BaseModel):
+    """从云盘导入PDF的请求"""
+    file_ref: str = Field(..., min_length=1, description="云盘文件标识")
+    filename: Optional[str] = Field(None, description="保存的文件名，为空时使用云盘上的文件名")
+
+
+class OIDCLoginResponse(BaseModel):
+    """SSO登录地址响应"""
+    authorization_url: str = Field(..., description="跳转登录的地址")
+
+
+class OIDCTokenResponse(BaseModel):
+    """SSO登录结果，后续请求通过 Authorization: Bearer 携带id_token"""
+    id_token: str = Field(..., description="ID Token")
+    access_token: Optional[str] = Field(None, description="Access Token")
+    refresh_token: Optional[str] = Field(None, description="刷新令牌")
+    expires_in: Optional[int] = Field(None, description="有效期（秒）")
+    user: str = Field(..., description="用户标识")
+    role: Role = Field(..., description="映射后的角色")
+    tenant_id: str = Field(..., description="所属租户")
+
+
+class CurrentUserResponse(BaseModel):
+    """当前调用方"""
+    user: str = Field(..., description="用户标识")
+    role: Role = Field(..., description="角色")
+    tenant_id: str = Field(..., description="所属租户")
+
+
+class ApiKeyCreateRequest(BaseModel):
+    """创建API Key的请求"""
+    name: str = Field(..., min_length=1, max_length=100, description="Key名称，用于辨认（调用方用户标识为Key的key_id）")
+    role: Role = Field(default=Role.EDITOR, description="角色")
+    rate_limit_per_minute: Optional[int] = Field(None, ge=0, description="每分钟请求数上限，为空时使用租户限制，0表示不限制")
+    quota_bytes: Optional[int] = Field(None, ge=0, description="该Key上传文件的存储配额（字节），同时受租户配额限制，为空或0时只受租户配额限制")
+
+
+class ApiKeyInfo(BaseModel):
+    """API Key信息（不含明文）"""
+    key_id: str = Field(..., description="Key唯一标识")
+    name: str = Field(..., description="Key名称")
+    role: Role = Field(..., description="角色")
+    prefix: str = Field(..., description="Key前缀，用于辨认")
+    rate_limit_per_minute: Optional[int] = Field(None, description="每分钟请求数上限")
+    quota_bytes: Optional[int] = Field(None, description="存储配额（字节）")
+    created_at: datetime = Field(..., description="创建时间")
+    rotated_at: Optional[datetime] = Field(None, description="最近轮换时间")
+    revoked_at: Optional[datetime] = Field(None, description="吊销时间")
+
+
+class ApiKeySecretResponse(BaseModel):
+    """创建或轮换API Key的响应，明文只返回这一次"""
+    key: str = Field(..., description="API Key明文")
+    info: ApiKeyInfo = Field(..., description="Key信息")
+
+
+class AuditEntry(BaseModel):
+    """审计记录：谁在何时对本租户做了哪些修改操作（包括被拒绝的请求）"""
+    entry_id: str = Field(..., description="记录ID，按时间排序")
+    timestamp: datetime = Field(default_factory=datetime.now, description="请求时间")
+    user: Optional[str] = Field(None, description="调用方用户标识，未认证时为空")
+    role: Optional[Role] = Field(None, description="调用方角色")
+    method: str = Field(..., description="请求方法")
+    path: str = Field(..., description="请求路径")
+    status: int = Field(..., description="响应状态码")
+    request_id: Optional[str] = Field(None, description="请求ID，与访问日志对应")
+
+
+class AuditLogResponse(BaseModel):
+    """审计记录响应"""
+    entries: List[AuditEntry] = Field(default_factory=list, description="审计记录，最新的在前")
+    total: int = Field(..., description="返回的记录数")
+
+
+class ShareLinkRequest(BaseModel):
+    """创建分享链接的请求"""
+    chapters: Optional[List[int]] = Field(
+        None, description="授权的章节序号（从1开始，按输出清单顺序），为空表示全部章节"
+    )
+    expires_in_hours: Optional[int] = Field(None, ge=1, description="有效时长（小时），为空表示不过期")
+    max_downloads: Optional[int] = Field(None, ge=1, description="下载次数上限，为空表示不限制")
+
+
+class ShareLink(BaseModel):
+    """分享链接信息（不含令牌明文）"""
+    link_id: str = Field(..., description="链接唯一标识")
+    file_id: str = Field(..., description="文件ID")
+    chapters: Optional[List[int]] = Field(None, description="授权的章节序号，为空表示全部章节")
+    filenames: Optional[List[str]] = Field(None, description="授权的章节文件名，创建时按序号确定")
+    expires_at: Optional[datetime] = Field(None, description="过期时间")
+    max_downloads: Optional[int] = Field(None, description="下载次数上限")
+    download_count: int = Field(default=0, description="已下载次数")
+    created_by: Optional[str] = Field(None, description="创建者")
+    created_at: datetime = Field(default_factory=datetime.now, description="创建时间")
+    revoked_at: Optional[datetime] = Field(None, description="吊销时间")
+
+
+class ShareLinkSecretResponse(BaseModel):
+    """创建分享链接的响应，令牌明文只返回这一次"""
+    token: str = Field(..., description="分享令牌")
+    url: str = Field(..., description="分享地址（相对路径）")
+    link: ShareLink = Field(..., description="链接信息")
+
+
+class SharedFilesResponse(BaseModel):
+    """分享链接可下载的章节"""
+    file_id: str = Field(..., description="文件ID")
+    filename: str = Field(..., description="原文件名")
+    files: List[ManifestEntry] = Field(default_factory=list, description="授权的章节文件")
+    expires_at: Optional[datetime] = Field(None, description="过期时间")
+    remaining_downloads: Optional[int] = Field(None, description="剩余下载次数，为空表示不限制")
 
 
 class ErrorResponse(BaseModel):
@@ -217,4 +1342,7 @@ class GraphEdgeResponse(BaseModel):
 
 # 更新模型引用
 SectionInfo.model_rebuild()
-KnowledgePoint.model_rebuild()
\ No newline at end of file
+ChapterInfo.model_rebuild()
+KnowledgePoint.model_rebuild()
+SplitTask.model_rebuild()
+DuplicateUpload.model_rebuild()
\ No newline at end of file
@@ -0,0 +1,132 @@
+"""
+章节分析结果缓存
+按文件内容哈希和分析选项缓存分析结果，文件删除时一并失效
+"""
+
+import json
+import hashlib
+from typing import Dict, Optional, Any
+from pathlib import Path
+
+from loguru import logger
+
+from ..core.tenancy import file_storage_dir
+
+
+class AnalysisCache:
+    """章节分析结果缓存（内存 + 文件目录持久化）"""
+
+    def __init__(self):
+        self._memory: Dict[str, Dict[str, Any]] = {}
+
+    @staticmethod
+    def build_key(file_hash: str, options: Dict[str, Any]) -> str:
+        """
+        生成缓存键
+
+        Args:
+            file_hash: 文件内容SHA-256
+            options: 影响分析结果的选项
+
+        Returns:
+            缓存键
+        """
+        raw = file_hash + json.dumps(options, sort_keys=True, ensure_ascii=False)
+        return hashlib.sha256(raw.encode("utf-8")).hexdigest()
+
+    def _cache_file(self, file_id: str, key: str) -> Path:
+        return file_storage_dir(file_id) / "analysis_cache" / f"{key}.json"
+
+    def get(self, file_id: str, key: str) -> Optional[Dict[str, Any]]:
+        """
+        读取缓存的分析结果
+
+        Args:
+            file_id: 文件ID
+            key: 缓存键
+
+        Returns:
+            分析结果字典，未命中时返回None
+        """
+        memory_key = f"{file_id}:{key}"
+        if memory_key in self._memory:
+            return self._memory[memory_key]
+
+        cache_file = self._cache_file(file_id, key)
+        if not cache_file.exists():
+            return None
+
+        try:
+            with open(cache_file, "r", encoding="utf-8") as f:
+                data = json.load(f)
+            self._memory[memory_key] = data
+            return data
+        except Exception as e:
+            logger.error(f"读取分析缓存失败: {cache_file} - {str(e)}")
+            return None
+
+    def set(self, file_id: str, key: str, data: Dict[str, Any]) -> None:
+        """
+        写入分析结果缓存
+
+        Args:
+            file_id: 文件ID
+            key: 缓存键
+            data: 可JSON序列化的分析结果
+        """
+        self._memory[f"{file_id}:{key}"] = data
+
+        try:
+            cache_file = self._cache_file(file_id, key)
+            cache_file.parent.mkdir(parents=True, exist_ok=True)
+            with open(cache_file, "w", encoding="utf-8") as f:
+                json.dump(data, f, ensure_ascii=False)
+        except Exception as e:
+            logger.error(f"写入分析缓存失败: {str(e)}")
+
+    def latest(self, file_id: str) -> Optional[Dict[str, Any]]:
+        """
+        读取文件最近一次写入的分析结果（不区分分析选项）
+
+        Args:
+            file_id: 文件ID
+
+        Returns:
+            分析结果字典，没有缓存时返回None
+        """
+        cache_dir = file_storage_dir(file_id) / "analysis_cache"
+        if not cache_dir.exists():
+            return None
+
+        cache_files = sorted(cache_dir.glob("*.json"), key=lambda path: path.stat().st_mtime)
+        return self.get(file_id, cache_files[-1].stem) if cache_files else None
+
+    def invalidate(self, file_id: str) -> int:
+        """
+        使某个文件的所有分析缓存失效
+
+        Args:
+            file_id: 文件ID
+
+        Returns:
+            清除的缓存条目数量
+        """
+        prefix = f"{file_id}:"
+        keys = [key for key in self._memory if key.startswith(prefix)]
+        for key in keys:
+            del self._memory[key]
+
+        cache_dir = file_storage_dir(file_id) / "analysis_cache"
+        removed = 0
+        if cache_dir.exists():
+            for cache_file in cache_dir.glob("*.json"):
+                cache_file.unlink()
+                removed += 1
+
+        if keys or removed:
+            logger.info(f"分析缓存已失效: {file_id}")
+        return max(len(keys), removed)
+
+
+# 创建全局缓存实例
+analysis_cache = AnalysisCache()
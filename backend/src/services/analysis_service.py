@@ -0,0 +1,112 @@
+"""
+章节分析流程服务
+组合章节识别、短章节合并、标题规范化和结果缓存，供同步接口和异步任务共用
+"""
+
+from typing import Callable, Optional
+
+from loguru import logger
+
+from ..core.diagnostics import collect_warnings
+from ..core.memory import memory_budget, estimate_document_bytes
+from ..models.schemas import AnalyzeRequest, AnalyzeResponse, FileStatus
+from .file_service import FileService
+from .pdf_analyzer import PDFAnalyzer
+from .title_normalizer import title_normalizer
+from .analysis_cache import analysis_cache
+
+
+class AnalysisService:
+    """章节分析流程服务"""
+
+    def __init__(self):
+        self.file_service = FileService()
+        self.pdf_analyzer = PDFAnalyzer()
+
+    async def analyze(
+        self,
+        request: AnalyzeRequest,
+        file_path: str,
+        progress_callback: Optional[Callable[[int], None]] = None
+    ) -> AnalyzeResponse:
+        """
+        执行章节分析，优先使用缓存
+
+        Args:
+            request: 分析请求
+            file_path: PDF文件路径
+            progress_callback: 进度回调函数
+
+        Returns:
+            章节分析结果
+        """
+        file_hash = await self.file_service.get_file_hash(request.file_id)
+        file_info = await self.file_service.get_file_info(request.file_id)
+        page_offset = file_info.page_offset if file_info else None
+        options = request.model_dump(exclude={"file_id", "force_refresh"})
+        cache_key = analysis_cache.build_key(file_hash, {**options, "page_offset": page_offset})
+
+        if not request.force_refresh:
+            cached = analysis_cache.get(request.file_id, cache_key)
+            if cached:
+                logger.info(f"章节分析命中缓存: {request.file_id}")
+                if progress_callback:
+                    progress_callback(100)
+                return AnalyzeResponse(**cached, cached=True)
+
+        response = await self._run(request, file_path, progress_callback, file_hash, page_offset)
+        analysis_cache.set(request.file_id, cache_key, response.model_dump(mode="json", exclude={"cached"}))
+
+        # 更新文件状态
+        await self.file_service.update_file_status(request.file_id, FileStatus.ANALYZED)
+
+        logger.info(f"章节分析完成: {request.file_id} - {len(response.chapters)} 个章节")
+        return response
+
+    async def _run(
+        self,
+        request: AnalyzeRequest,
+        file_path: str,
+        progress_callback: Optional[Callable[[int], None]] = None,
+        file_hash: Optional[str] = None,
+        page_offset: Optional[int] = None
+    ) -> AnalyzeResponse:
+        """执行章节分析流程"""
+        # 大文档受全局内存预算限制，避免同时解析过多；识别中的非致命问题随结果返回（包括缓存的结果）
+        with collect_warnings() as warnings:
+            async with memory_budget.reserve(estimate_document_bytes(file_path), request.file_id):
+                chapters, pdf_metadata = await self.pdf_analyzer.analyze_pdf(
+                    file_path,
+                    request.file_id,
+                    progress_callback=progress_callback,
+                    doc_key=file_hash,
+                    page_offset=page_offset
+                )
+
+        # 合并过短的章节
+        chapters, merges = self.pdf_analyzer.merge_small_chapters(chapters, request.min_pages_per_chapter)
+
+        # 规范化章节标题
+        if request.normalize_titles or request.normalize_titles_llm:
+            chapters = await title_normalizer.normalize_chapters(chapters, use_llm=request.normalize_titles_llm)
+
+        # 生成备选建议（如果需要）
+        suggestions = None
+        if len(chapters) == 0:
+            suggestions = self.pdf_analyzer._generate_default_chapters(pdf_metadata.total_pages)
+
+        page_labels = None
+        if pdf_metadata.has_page_labels:
+            page_labels = self.pdf_analyzer.get_page_labels_from_file(file_path)
+
+        return AnalyzeResponse(
+            success=True,
+            chapters=chapters,
+            total_pages=pdf_metadata.total_pages,
+            language=pdf_metadata.language,
+            message=f"成功识别 {len(chapters)} 个章节",
+            suggestions=suggestions,
+            page_labels=page_labels,
+            merges=merges,
+            warnings=warnings
+        )
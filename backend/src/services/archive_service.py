@@ -0,0 +1,151 @@
+"""
+打包下载服务
+以流式方式生成ZIP或tar.gz，边压缩边输出，不在磁盘或内存中生成完整的包；
+拆分时开启bundle的输出另由ArchiveBuilder逐章写入磁盘上的ZIP，下载时直接发送
+"""
+
+import tarfile
+import zipfile
+from pathlib import Path
+from typing import Iterator, List, Optional, Tuple
+
+from ..models.schemas import ArchiveFormat
+from ..core.memory import buffer_pool
+
+
+ARCHIVE_MEDIA_TYPES = {
+    ArchiveFormat.ZIP: "application/zip",
+    ArchiveFormat.TAR_GZ: "application/gzip",
+}
+
+
+class _StreamBuffer:
+    """只写的不可定位输出流，供zipfile/tarfile写入后分段取出"""
+
+    def __init__(self):
+        self._chunks: List[bytes] = []
+
+    def write(self, data: bytes) -> int:
+        self._chunks.append(bytes(data))
+        return len(data)
+
+    def flush(self) -> None:
+        pass
+
+    def drain(self) -> bytes:
+        """取出目前累积的数据"""
+        data = b"".join(self._chunks)
+        self._chunks.clear()
+        return data
+
+
+class ArchiveBuilder:
+    """
+    逐个追加文件的ZIP，供拆分时每完成一章就写入；先写临时文件，
+    finish后才改为正式文件名，中断的拆分不会留下看似完整的包
+    """
+
+    def __init__(self, path: Path):
+        self.path = path
+        self._partial = path.with_name(path.name + ".part")
+        self.names: List[str] = []
+        self._archive = zipfile.ZipFile(self._partial, "w", zipfile.ZIP_DEFLATED)
+
+    def add(self, file_path: Path, arcname: str) -> None:
+        """追加一个文件"""
+        self._archive.write(file_path, arcname)
+        self.names.append(arcname)
+
+    def finish(self) -> None:
+        """写入中央目录并改为正式文件名"""
+        self._archive.close()
+        self._partial.replace(self.path)
+
+    def abort(self) -> None:
+        """放弃并删除临时文件"""
+        self._archive.close()
+        self._partial.unlink(missing_ok=True)
+
+
+class ArchiveService:
+    """流式打包服务"""
+
+    def stream(self, members: List[Tuple[Path, str]], archive_format: ArchiveFormat) -> Iterator[bytes]:
+        """
+        流式生成压缩包
+
+        Args:
+            members: (文件路径, 包内路径)列表
+            archive_format: 打包格式
+
+        Yields:
+            压缩包数据块
+        """
+        if archive_format == ArchiveFormat.TAR_GZ:
+            return self._stream_tar_gz(members)
+        return self._stream_zip(members)
+
+    @staticmethod
+    def filename(name: str, archive_format: ArchiveFormat) -> str:
+        """生成带扩展名的下载文件名"""
+        return f"{name}.{archive_format.value}"
+
+    def _stream_zip(self, members: List[Tuple[Path, str]]) -> Iterator[bytes]:
+        output = _StreamBuffer()
+        # 输出流不可定位时zipfile改用数据描述符记录大小和CRC
+        with zipfile.ZipFile(output, "w", zipfile.ZIP_DEFLATED) as archive:
+            for path, arcname in members:
+                with buffer_pool.buffer() as buf, open(path, "rb") as src, archive.open(arcname, "w") as dest:
+                    view = memoryview(buf)
+                    while n := src.readinto(view):
+                        dest.write(view[:n])
+                        chunk = output.drain()
+                        if chunk:
+                            yield chunk
+        yield output.drain()
+
+    def stream_entries(
+        self,
+        entries: List[Tuple[str, bytes]],
+        members: Optional[List[Tuple[Path, str]]] = None
+    ) -> Iterator[bytes]:
+        """
+        把内存中的数据流式打包为ZIP
+
+        Args:
+            entries: (包内路径, 内容)列表
+            members: 附加在其后的(文件路径, 包内路径)列表
+
+        Yields:
+            压缩包数据块
+        """
+        output = _StreamBuffer()
+        with zipfile.ZipFile(output, "w", zipfile.ZIP_DEFLATED) as archive:
+            for arcname, data in entries:
+                archive.writestr(arcname, data)
+                chunk = output.drain()
+                if chunk:
+                    yield chunk
+            for path, arcname in members or []:
+                with buffer_pool.buffer() as buf, open(path, "rb") as src, archive.open(arcname, "w") as dest:
+                    view = memoryview(buf)
+                    while n := src.readinto(view):
+                        dest.write(view[:n])
+                        chunk = output.drain()
+                        if chunk:
+                            yield chunk
+        yield output.drain()
+
+    def _stream_tar_gz(self, members: List[Tuple[Path, str]]) -> Iterator[bytes]:
+        output = _StreamBuffer()
+        with tarfile.open(fileobj=output, mode="w|gz") as archive:
+            for path, arcname in members:
+                archive.add(str(path), arcname=arcname, recursive=False)
+                chunk = output.drain()
+                if chunk:
+                    yield chunk
+        yield output.drain()
+
+
+# 创建全局服务实例
+archive_service = ArchiveService()
@@ -0,0 +1,158 @@
+"""
+嵌入附件服务
+列出和读取PDF中的嵌入文件（文档级附件和页面上的附件注释），拆分时按需复制到章节输出
+"""
+
+from typing import List, Optional, Tuple
+
+import fitz
+from loguru import logger
+
+from ..models.schemas import AttachmentInfo, AttachmentMode, ChapterInfo
+from ..core.document_cache import document_cache
+
+
+# 页面附件注释的标识前缀，完整标识为 "page{页码}/{注释xref}"
+ANNOT_NAME_PREFIX = "page"
+
+
+class AttachmentService:
+    """嵌入附件服务"""
+
+    def list(self, file_path: str, doc_key: Optional[str] = None) -> List[AttachmentInfo]:
+        """
+        列出PDF中的嵌入附件
+
+        Args:
+            file_path: PDF文件路径
+            doc_key: 文档缓存键（文件内容哈希），为空时不使用缓存
+
+        Returns:
+            附件列表，文档级附件在前，页面附件注释按页码排序
+        """
+        with document_cache.open(file_path, doc_key) as doc:
+            attachments = [self._embedded_info(doc, name) for name in doc.embfile_names()]
+            for page in doc:
+                for annot in page.annots(types=[fitz.PDF_ANNOT_FILE_ATTACHMENT]):
+                    info = annot.file_info
+                    attachments.append(AttachmentInfo(
+                        name=f"{ANNOT_NAME_PREFIX}{page.number + 1}/{annot.xref}",
+                        filename=info.get("filename") or f"attachment_{annot.xref}",
+                        description=info.get("description") or None,
+                        size=info.get("length") or info.get("size") or 0,
+                        page=page.number + 1
+                    ))
+            return attachments
+
+    def get(
+        self,
+        file_path: str,
+        name: str,
+        doc_key: Optional[str] = None
+    ) -> Optional[Tuple[AttachmentInfo, bytes]]:
+        """
+        读取附件内容
+
+        Args:
+            file_path: PDF文件路径
+            name: 附件标识（list返回的name）
+            doc_key: 文档缓存键
+
+        Returns:
+            (附件信息, 内容)，不存在时返回None
+        """
+        with document_cache.open(file_path, doc_key) as doc:
+            if name in doc.embfile_names():
+                return self._embedded_info(doc, name), doc.embfile_get(name)
+
+            annot = self._find_annot(doc, name)
+            if annot is None:
+                return None
+            info = annot.file_info
+            content = annot.get_file()
+            return AttachmentInfo(
+                name=name,
+                filename=info.get("filename") or f"attachment_{annot.xref}",
+                description=info.get("description") or None,
+                size=len(content),
+                page=annot.parent.number + 1
+            ), content
+
+    def copy_to_chapter(
+        self,
+        doc: fitz.Document,
+        new_doc: fitz.Document,
+        chapter: ChapterInfo,
+        mode: AttachmentMode
+    ) -> int:
+        """
+        把文档级附件复制到章节文档；页面上的附件注释随页面一起复制，无需处理
+
+        Args:
+            doc: 原文档
+            new_doc: 章节文档
+            chapter: 章节
+            mode: 携带方式
+
+        Returns:
+            复制的附件数量
+        """
+        names = doc.embfile_names() if mode != AttachmentMode.NONE else []
+        if not names:
+            return 0
+
+        text = ""
+        if mode == AttachmentMode.REFERENCED:
+            text = "".join(
+                doc[page_num].get_text()
+                for page_num in range(chapter.start_page - 1, min(chapter.end_page, len(doc)))
+            ).casefold()
+
+        copied = 0
+        for name in names:
+            info = doc.embfile_info(name)
+            filename = info.get("filename") or name
+            if mode == AttachmentMode.REFERENCED and filename.casefold() not in text:
+                continue
+            new_doc.embfile_add(
+                name,
+                doc.embfile_get(name),
+                filename=filename,
+                ufilename=info.get("ufilename") or filename,
+                desc=info.get("description") or ""
+            )
+            copied += 1
+
+        if copied:
+            logger.debug(f"章节携带附件: {chapter.title} - {copied} 个")
+        return copied
+
+    @staticmethod
+    def _embedded_info(doc: fitz.Document, name: str) -> AttachmentInfo:
+        info = doc.embfile_info(name)
+        return AttachmentInfo(
+            name=name,
+            filename=info.get("filename") or name,
+            description=info.get("description") or None,
+            size=info.get("length") or info.get("size") or 0
+        )
+
+    @staticmethod
+    def _find_annot(doc: fitz.Document, name: str):
+        """按 "page{页码}/{xref}" 查找附件注释"""
+        if not name.startswith(ANNOT_NAME_PREFIX):
+            return None
+        try:
+            page_no, xref = (int(part) for part in name[len(ANNOT_NAME_PREFIX):].split("/", 1))
+        except ValueError:
+            return None
+        if not 1 <= page_no <= len(doc):
+            return None
+        for annot in doc[page_no - 1].annots(types=[fitz.PDF_ANNOT_FILE_ATTACHMENT]):
+            if annot.xref == xref:
+                return annot
+        return None
+
+
+# 创建全局附件服务实例
+attachment_service = AttachmentService()
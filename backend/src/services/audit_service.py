@@ -0,0 +1,120 @@
+"""
+审计记录
+记录各租户的修改操作（上传、拆分、删除、签发Key、修改策略等）及其调用方和结果，
+被拒绝的请求同样记录；管理员可按用户查询，过期记录由主节点清理
+"""
+
+import uuid
+from datetime import datetime, timedelta
+from typing import List, Optional
+
+from loguru import logger
+
+from ..core.auth import Principal
+from ..core.config import settings
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant
+from ..models.schemas import AuditEntry
+
+
+# 存储bucket（按租户分开）
+AUDIT_BUCKET = "audit"
+
+# 只读请求不记录
+READ_METHODS = {"GET", "HEAD", "OPTIONS"}
+
+# 记录ID的时间前缀格式，使记录ID按时间排序
+ENTRY_ID_TIME_FORMAT = "%Y%m%d%H%M%S%f"
+
+
+class AuditService:
+    """按租户保存的审计记录"""
+
+    @staticmethod
+    def should_record(method: str, path: str) -> bool:
+        """是否为需要审计的修改操作"""
+        return method not in READ_METHODS and path.startswith("/api/")
+
+    async def record(
+        self,
+        method: str,
+        path: str,
+        status: int,
+        principal: Optional[Principal] = None,
+        request_id: Optional[str] = None
+    ) -> None:
+        """
+        写入一条当前租户的审计记录，写入失败只记录日志，不影响请求
+
+        Args:
+            method: 请求方法
+            path: 请求路径
+            status: 响应状态码
+            principal: 调用方，未认证时为空
+            request_id: 请求ID
+        """
+        now = datetime.now()
+        entry = AuditEntry(
+            entry_id=f"{now.strftime(ENTRY_ID_TIME_FORMAT)}-{uuid.uuid4().hex[:8]}",
+            timestamp=now,
+            user=principal.user if principal else None,
+            role=principal.role if principal else None,
+            method=method,
+            path=path,
+            status=status,
+            request_id=request_id
+        )
+        try:
+            await get_store().aput(AUDIT_BUCKET, entry.entry_id, entry.model_dump(mode="json"), get_current_tenant())
+        except Exception as e:
+            logger.error(f"写入审计记录失败: {method} {path} - {str(e)}")
+
+    async def list(self, user: Optional[str] = None, limit: int = 100) -> List[AuditEntry]:
+        """
+        列出当前租户的审计记录
+
+        Args:
+            user: 只列出该调用方的记录
+            limit: 最多返回的记录数
+
+        Returns:
+            最新的在前
+        """
+        entries = []
+        for data in await get_store().avalues(AUDIT_BUCKET, get_current_tenant()):
+            try:
+                entry = AuditEntry(**data)
+            except Exception as e:
+                logger.error(f"读取审计记录失败: {data.get('entry_id')} - {str(e)}")
+                continue
+            if user is None or entry.user == user:
+                entries.append(entry)
+        entries.sort(key=lambda entry: entry.entry_id, reverse=True)
+        return entries[:max(limit, 0)]
+
+    async def cleanup_expired(self, tenant_id: str) -> int:
+        """
+        删除租户超过AUDIT_RETENTION_DAYS的审计记录
+
+        Returns:
+            删除的记录数
+        """
+        if settings.AUDIT_RETENTION_DAYS <= 0:
+            return 0
+
+        store = get_store()
+        cutoff = (datetime.now() - timedelta(days=settings.AUDIT_RETENTION_DAYS)).strftime(ENTRY_ID_TIME_FORMAT)
+        removed = 0
+        for data in await store.avalues(AUDIT_BUCKET, tenant_id):
+            entry_id = data.get("entry_id", "")
+            if entry_id and entry_id < cutoff:
+                await store.adelete(AUDIT_BUCKET, entry_id, tenant_id)
+                removed += 1
+
+        if removed:
+            logger.info(f"清理过期审计记录: {tenant_id} - {removed} 条")
+        return removed
+
+
+# 创建全局审计服务实例
+audit_service = AuditService()
@@ -0,0 +1,299 @@
+"""
+基准测试
+用内置样本（首次运行时按固定种子生成）执行标准拆分，统计每秒页数、常驻内存峰值和Python对象分配，
+引擎或拆分流程改动前后各运行一次，与保存的基线对比即可发现性能退化
+
+命令行运行::
+
+    python -m src.services.benchmark --iterations 5 --output baseline.json
+    python -m src.services.benchmark --baseline baseline.json --tolerance 0.1
+"""
+
+import argparse
+import asyncio
+import platform
+import random
+import resource
+import statistics
+import sys
+import threading
+import time
+import tracemalloc
+from contextlib import contextmanager
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Dict, Iterator, List, Optional
+
+import fitz
+from loguru import logger
+
+from .. import __version__
+from ..core.config import settings
+from ..core.scratch import scratch_dir
+from ..models.schemas import BenchmarkRequest, BenchmarkResponse, BenchmarkResult, ChapterInfo
+from .pdf_splitter import PDFSplitter
+
+
+# 常驻内存的采样间隔（秒）
+RSS_SAMPLE_INTERVAL = 0.01
+
+
+@dataclass(frozen=True)
+class BenchmarkSample:
+    """内置样本：页数、章节数和每页内容"""
+    pages: int
+    chapters: int
+    images: bool = False
+
+
+# 内置样本，修改后旧基线不再可比，应改用新名称
+BENCHMARK_SAMPLES: Dict[str, BenchmarkSample] = {
+    "text": BenchmarkSample(pages=200, chapters=10),
+    "images": BenchmarkSample(pages=60, chapters=6, images=True),
+    "large": BenchmarkSample(pages=1000, chapters=50),
+}
+
+
+def _rss_bytes() -> Optional[int]:
+    """当前进程的常驻内存，无法读取/proc时为None"""
+    try:
+        with open("/proc/self/statm", "r") as f:
+            return int(f.read().split()[1]) * resource.getpagesize()
+    except (OSError, IndexError, ValueError):
+        return None
+
+
+@contextmanager
+def _rss_peak() -> Iterator[dict]:
+    """在后台线程采样常驻内存，退出时把峰值写入结果的peak"""
+    result = {"peak": _rss_bytes()}
+    stop = threading.Event()
+
+    def sample():
+        while not stop.wait(RSS_SAMPLE_INTERVAL):
+            current = _rss_bytes()
+            if current is not None:
+                result["peak"] = max(result["peak"] or 0, current)
+
+    thread = threading.Thread(target=sample, daemon=True)
+    thread.start()
+    try:
+        yield result
+    finally:
+        stop.set()
+        thread.join()
+        if result["peak"] is None:
+            # 没有/proc时退回进程启动以来的峰值（Linux单位为KB）
+            result["peak"] = resource.getrusage(resource.RUSAGE_SELF).ru_maxrss * 1024
+
+
+class BenchmarkService:
+    """基准测试服务"""
+
+    def __init__(self):
+        self._lock = threading.Lock()
+
+    @property
+    def running(self) -> bool:
+        """是否有基准测试正在运行"""
+        return self._lock.locked()
+
+    def run(self, request: BenchmarkRequest) -> BenchmarkResponse:
+        """
+        依次运行请求的样本，同一时间只运行一个基准测试以免结果互相干扰
+
+        Args:
+            request: 样本、计时次数、拆分选项和基线
+
+        Returns:
+            各样本结果和相对基线的退化
+
+        Raises:
+            ValueError: 样本名称未知
+            RuntimeError: 已有基准测试正在运行
+        """
+        names = request.samples or list(BENCHMARK_SAMPLES)
+        unknown = [name for name in names if name not in BENCHMARK_SAMPLES]
+        if unknown:
+            raise ValueError(f"未知的样本: {unknown}，可用样本: {list(BENCHMARK_SAMPLES)}")
+
+        if not self._lock.acquire(blocking=False):
+            raise RuntimeError("已有基准测试正在运行")
+        try:
+            options = request.model_dump(include={"optimize", "grayscale", "strip_backgrounds", "watermark_text"})
+            results = [self._run_sample(name, request.iterations, options) for name in names]
+        finally:
+            self._lock.release()
+
+        response = BenchmarkResponse(
+            version=__version__,
+            engine=f"PyMuPDF {fitz.VersionBind} (MuPDF {fitz.VersionFitz})",
+            python=platform.python_version(),
+            options=options,
+            results=results,
+            regressions=self.compare(results, request.baseline, request.tolerance)
+        )
+        logger.info(f"基准测试完成: {', '.join(f'{r.sample} {r.pages_per_second} 页/秒' for r in results)}")
+        return response
+
+    def _run_sample(self, name: str, iterations: int, options: dict) -> BenchmarkResult:
+        """计时运行一个样本，再单独运行一次统计Python对象分配（开启跟踪会拖慢计时）"""
+        sample = BENCHMARK_SAMPLES[name]
+        path = self.sample_path(name)
+        chapters = self._chapters(sample)
+        splitter = PDFSplitter()
+
+        def split(output_dir: Path) -> List[str]:
+            # 不传doc_key，每次都重新打开文档，避免命中文档缓存
+            return asyncio.run(splitter.split_pdf(str(path), chapters, str(output_dir), **options))
+
+        seconds = []
+        with _rss_peak() as rss:
+            for _ in range(iterations):
+                with scratch_dir() as output_dir:
+                    started = time.perf_counter()
+                    split(output_dir)
+                    seconds.append(round(time.perf_counter() - started, 4))
+
+        with scratch_dir() as output_dir:
+            tracemalloc.start()
+            try:
+                links = split(output_dir)
+                retained, peak = tracemalloc.get_traced_memory()
+            finally:
+                tracemalloc.stop()
+            output_bytes = sum((output_dir / link).stat().st_size for link in links)
+
+        median = statistics.median(seconds)
+        return BenchmarkResult(
+            sample=name,
+            pages=sample.pages,
+            chapters=len(chapters),
+            iterations=iterations,
+            seconds=seconds,
+            median_seconds=round(median, 4),
+            pages_per_second=round(sample.pages / median, 2) if median else 0,
+            output_bytes=output_bytes,
+            peak_rss_bytes=rss["peak"],
+            peak_allocated_bytes=peak,
+            retained_bytes=retained
+        )
+
+    @staticmethod
+    def compare(results: List[BenchmarkResult], baseline: List[BenchmarkResult], tolerance: float) -> List[str]:
+        """
+        与基线对比每秒页数
+
+        Args:
+            results: 本次结果
+            baseline: 历史结果，按样本名称匹配，没有对应样本的结果不参与对比
+            tolerance: 允许的下降比例
+
+        Returns:
+            退化描述
+        """
+        previous = {result.sample: result for result in baseline}
+        regressions = []
+        for result in results:
+            base = previous.get(result.sample)
+            if not base or not base.pages_per_second:
+                continue
+            change = result.pages_per_second / base.pages_per_second - 1
+            if change < -tolerance:
+                regressions.append(
+                    f"{result.sample}: {result.pages_per_second} 页/秒，低于基线 {base.pages_per_second} 页/秒 {-change:.0%}"
+                )
+        return regressions
+
+    @staticmethod
+    def _chapters(sample: BenchmarkSample) -> List[ChapterInfo]:
+        """把样本均分为章节"""
+        size = sample.pages // sample.chapters
+        chapters = []
+        for index in range(sample.chapters):
+            start = index * size + 1
+            end = sample.pages if index == sample.chapters - 1 else start + size - 1
+            chapters.append(ChapterInfo(title=f"Chapter {index + 1}", start_page=start, end_page=end, page_count=end - start + 1))
+        return chapters
+
+    @staticmethod
+    def sample_path(name: str) -> Path:
+        """
+        样本文件路径，不存在时按固定种子生成，同一版本生成的内容完全相同
+
+        Args:
+            name: 样本名称
+
+        Returns:
+            样本PDF路径
+        """
+        sample = BENCHMARK_SAMPLES[name]
+        path = Path(settings.TEMP_DIR) / "benchmark" / f"{name}.pdf"
+        if path.exists():
+            return path
+
+        path.parent.mkdir(parents=True, exist_ok=True)
+        rng = random.Random(name)
+        words = ["chapter", "section", "analysis", "result", "method", "figure", "table", "data", "model", "theory"]
+        doc = fitz.open()
+        try:
+            for number in range(1, sample.pages + 1):
+                page = doc.new_page()
+                text = " ".join(rng.choice(words) for _ in range(400))
+                page.insert_textbox(fitz.Rect(72, 72, page.rect.width - 72, page.rect.height - 72), f"Page {number}\n{text}", fontsize=10)
+                if sample.images:
+                    # 随机像素几乎无法压缩，接近扫描页的数据量
+                    pixmap = fitz.Pixmap(fitz.csRGB, 400, 300, rng.randbytes(400 * 300 * 3), False)
+                    page.insert_image(fitz.Rect(72, 400, 472, 700), pixmap=pixmap)
+            doc.save(str(path) + ".tmp", garbage=3, deflate=True)
+        finally:
+            doc.close()
+        Path(str(path) + ".tmp").replace(path)
+        return path
+
+
+# 创建全局基准测试服务实例
+benchmark_service = BenchmarkService()
+
+
+def main(argv: Optional[List[str]] = None) -> int:
+    """命令行入口，有退化时返回1，便于在CI中使用"""
+    parser = argparse.ArgumentParser(description="运行内置样本的拆分基准测试")
+    parser.add_argument("--samples", nargs="*", default=[], help=f"样本名称，可选 {', '.join(BENCHMARK_SAMPLES)}")
+    parser.add_argument("--iterations", type=int, default=3, help="每个样本计时的拆分次数")
+    parser.add_argument("--optimize", action="store_true", help="压缩输出文件")
+    parser.add_argument("--grayscale", action="store_true", help="转换为灰度")
+    parser.add_argument("--baseline", help="对比的历史结果JSON文件")
+    parser.add_argument("--tolerance", type=float, default=0.2, help="允许的每秒页数下降比例")
+    parser.add_argument("--output", help="结果写入的JSON文件，可作为之后的基线")
+    args = parser.parse_args(argv)
+
+    baseline = []
+    if args.baseline:
+        baseline = BenchmarkResponse.model_validate_json(Path(args.baseline).read_text(encoding="utf-8")).results
+
+    Path(settings.TEMP_DIR).mkdir(parents=True, exist_ok=True)
+    response = benchmark_service.run(BenchmarkRequest(
+        samples=args.samples,
+        iterations=args.iterations,
+        optimize=args.optimize,
+        grayscale=args.grayscale,
+        baseline=baseline,
+        tolerance=args.tolerance
+    ))
+
+    print(f"{response.engine}, Python {response.python}")
+    print(f"{'样本':<8}{'页数':>6}{'中位耗时(s)':>12}{'页/秒':>10}{'RSS峰值(MB)':>12}{'分配峰值(MB)':>13}")
+    for r in response.results:
+        rss = f"{r.peak_rss_bytes / 2**20:.1f}" if r.peak_rss_bytes else "-"
+        print(f"{r.sample:<8}{r.pages:>6}{r.median_seconds:>12.3f}{r.pages_per_second:>10.1f}{rss:>12}{r.peak_allocated_bytes / 2**20:>13.1f}")
+    for regression in response.regressions:
+        print(f"性能退化: {regression}")
+
+    if args.output:
+        Path(args.output).write_text(response.model_dump_json(indent=2), encoding="utf-8")
+    return 1 if response.regressions else 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -0,0 +1,172 @@
+"""
+章节结构对比
+- 重新分析（如OCR后）得到的章节建议与已保存的人工编辑逐章比对，
+  列出新增、边界移动、删除和改名，由用户决定是否采纳，避免人工修改被直接覆盖
+- 同一本书的两个版本按标题模糊匹配章节，列出页数变化，用于更新已拆分的资料库
+"""
+
+import unicodedata
+from difflib import SequenceMatcher
+from typing import Dict, List, Optional, Tuple
+
+from ..models.schemas import (
+    ChapterChange,
+    ChapterDiffResponse,
+    ChapterInfo,
+    ChapterMatch,
+    CompareResponse,
+    SavedChapters,
+)
+
+
+def _title_key(title: str) -> str:
+    """比较用的标题：全半角统一、忽略大小写和空白"""
+    return "".join(unicodedata.normalize("NFKC", title).casefold().split())
+
+
+def _pair(
+    saved: Dict[int, ChapterInfo],
+    suggested: Dict[int, ChapterInfo],
+    key
+) -> List[Tuple[int, int]]:
+    """按键值依次配对两侧尚未匹配的章节，配对的章节从两侧移除"""
+    candidates: Dict[object, List[int]] = {}
+    for index, chapter in suggested.items():
+        candidates.setdefault(key(chapter), []).append(index)
+
+    pairs = []
+    for saved_index, chapter in list(saved.items()):
+        indexes = candidates.get(key(chapter))
+        if indexes:
+            suggested_index = indexes.pop(0)
+            pairs.append((saved_index, suggested_index))
+            del saved[saved_index]
+            del suggested[suggested_index]
+    return pairs
+
+
+def _change(
+    type: str,
+    saved_index: Optional[int],
+    suggested_index: Optional[int],
+    saved: List[ChapterInfo],
+    suggested: List[ChapterInfo]
+) -> ChapterChange:
+    return ChapterChange(
+        type=type,
+        saved_index=saved_index,
+        suggested_index=suggested_index,
+        saved=saved[saved_index - 1] if saved_index else None,
+        suggested=suggested[suggested_index - 1] if suggested_index else None
+    )
+
+
+def diff_chapters(edits: SavedChapters, suggestions: List[ChapterInfo]) -> ChapterDiffResponse:
+    """
+    对比人工编辑与新的章节建议
+
+    依次按页码范围、标题和起始页配对：范围相同标题不同为改名，
+    按标题或起始页配对但范围不同为移动，其余分别为删除和新增
+
+    Args:
+        edits: 已保存的人工编辑
+        suggestions: 新的章节建议
+
+    Returns:
+        差异结果，各列表按序号排序
+    """
+    saved_chapters = edits.chapters
+    saved = {i + 1: chapter for i, chapter in enumerate(saved_chapters)}
+    suggested = {i + 1: chapter for i, chapter in enumerate(suggestions)}
+    response = ChapterDiffResponse(file_id=edits.file_id, saved_at=edits.updated_at)
+
+    for saved_index, suggested_index in _pair(saved, suggested, lambda c: (c.start_page, c.end_page)):
+        if _title_key(saved_chapters[saved_index - 1].title) == _title_key(suggestions[suggested_index - 1].title):
+            response.unchanged += 1
+        else:
+            response.renames.append(_change("rename", saved_index, suggested_index, saved_chapters, suggestions))
+
+    moved = _pair(saved, suggested, lambda c: _title_key(c.title))
+    moved += _pair(saved, suggested, lambda c: c.start_page)
+    for saved_index, suggested_index in sorted(moved):
+        response.moves.append(_change("move", saved_index, suggested_index, saved_chapters, suggestions))
+
+    for saved_index in sorted(saved):
+        response.removes.append(_change("remove", saved_index, None, saved_chapters, suggestions))
+    for suggested_index in sorted(suggested):
+        response.adds.append(_change("add", None, suggested_index, saved_chapters, suggestions))
+
+    response.renames.sort(key=lambda change: change.saved_index)
+    return response
+
+
+def _match(
+    base: List[ChapterInfo],
+    target: List[ChapterInfo],
+    base_index: Optional[int],
+    target_index: Optional[int],
+    similarity: Optional[float] = None
+) -> ChapterMatch:
+    base_chapter = base[base_index - 1] if base_index else None
+    target_chapter = target[target_index - 1] if target_index else None
+    return ChapterMatch(
+        base_index=base_index,
+        target_index=target_index,
+        base=base_chapter,
+        target=target_chapter,
+        similarity=round(similarity, 3) if similarity is not None else None,
+        page_delta=target_chapter.page_count - base_chapter.page_count if base_chapter and target_chapter else None
+    )
+
+
+def compare_editions(
+    base_file_id: str,
+    base: List[ChapterInfo],
+    target_file_id: str,
+    target: List[ChapterInfo],
+    similarity_threshold: float = 0.6
+) -> CompareResponse:
+    """
+    对比两个版本的章节结构
+
+    先配对标题一致的章节，其余按标题相似度从高到低贪心配对，
+    相似度不低于阈值的视为改名，剩余的分别为删除和新增
+
+    Args:
+        base_file_id: 旧版本文件ID
+        base: 旧版本章节
+        target_file_id: 新版本文件ID
+        target: 新版本章节
+        similarity_threshold: 模糊匹配的最低相似度
+
+    Returns:
+        对比结果，各列表按序号排序
+    """
+    remaining_base = {i + 1: chapter for i, chapter in enumerate(base)}
+    remaining_target = {i + 1: chapter for i, chapter in enumerate(target)}
+    response = CompareResponse(base_file_id=base_file_id, target_file_id=target_file_id)
+
+    for base_index, target_index in _pair(remaining_base, remaining_target, lambda c: _title_key(c.title)):
+        response.matched.append(_match(base, target, base_index, target_index, 1.0))
+
+    scores = sorted(
+        (
+            (SequenceMatcher(None, _title_key(b.title), _title_key(t.title)).ratio(), base_index, target_index)
+            for base_index, b in remaining_base.items()
+            for target_index, t in remaining_target.items()
+        ),
+        key=lambda item: (-item[0], item[1], item[2])
+    )
+    for score, base_index, target_index in scores:
+        if score < similarity_threshold:
+            break
+        if base_index in remaining_base and target_index in remaining_target:
+            del remaining_base[base_index]
+            del remaining_target[target_index]
+            response.renamed.append(_match(base, target, base_index, target_index, score))
+
+    response.removed = [_match(base, target, index, None) for index in sorted(remaining_base)]
+    response.added = [_match(base, target, None, index) for index in sorted(remaining_target)]
+    response.matched.sort(key=lambda match: match.base_index)
+    response.renamed.sort(key=lambda match: match.base_index)
+    return response
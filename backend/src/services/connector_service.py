@@ -0,0 +1,515 @@
+"""
+云盘连接器服务
+通过OAuth授权连接Google Drive和Dropbox，支持导入PDF和将拆分结果写回指定文件夹，
+授权state、加密后的刷新令牌和访问令牌保存在元数据存储中，多副本部署时共享
+"""
+
+import asyncio
+import json
+import re
+import secrets
+import time
+from datetime import datetime
+from pathlib import Path
+from typing import Any, AsyncIterator, Dict, List, Optional, Tuple
+from urllib.parse import urlencode
+
+import httpx
+from loguru import logger
+
+from ..models.schemas import ConnectorProvider, ConnectorStatus, ConnectorFile, FileInfo
+from ..core.config import settings
+from ..core.crypto import encrypt_secret, decrypt_secret
+from ..core.scratch import scratch_dir
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant
+from .file_service import FileService
+
+# OAuth state有效期（秒）
+STATE_TTL = 600
+
+# 授权中的state（全局，回调不一定携带租户标识）
+CONNECTOR_STATES_BUCKET = "connector_states"
+
+# 各租户加密后的刷新令牌，键为云盘类型
+CONNECTORS_BUCKET = "connectors"
+
+# 各租户加密后的访问令牌缓存，键为云盘类型
+CONNECTOR_TOKENS_BUCKET = "connector_tokens"
+
+# state的格式（secrets.token_urlsafe），其他值不查询存储
+STATE_PATTERN = re.compile(r"[A-Za-z0-9_-]{16,64}")
+
+# 上传时每次读取的字节数
+READ_CHUNK_SIZE = 1024 * 1024
+
+
+class Connector:
+    """云盘连接器基类"""
+
+    provider: ConnectorProvider
+    authorize_endpoint: str
+    token_endpoint: str
+
+    @property
+    def redirect_uri(self) -> str:
+        return f"{settings.CONNECTOR_REDIRECT_BASE_URL.rstrip('/')}/{self.provider.value}/callback"
+
+    def client_credentials(self) -> Tuple[str, str]:
+        """应用的客户端ID和密钥"""
+        raise NotImplementedError
+
+    def authorization_params(self) -> Dict[str, str]:
+        """授权地址的附加参数"""
+        return {}
+
+    def authorization_url(self, state: str) -> str:
+        """生成授权地址"""
+        client_id, _ = self.client_credentials()
+        params = {
+            "client_id": client_id,
+            "redirect_uri": self.redirect_uri,
+            "response_type": "code",
+            "state": state,
+            **self.authorization_params()
+        }
+        return f"{self.authorize_endpoint}?{urlencode(params)}"
+
+    async def exchange_code(self, code: str) -> Dict[str, str]:
+        """用授权码换取令牌"""
+        return await self._token_request({
+            "grant_type": "authorization_code",
+            "code": code,
+            "redirect_uri": self.redirect_uri
+        })
+
+    async def refresh(self, refresh_token: str) -> Dict[str, str]:
+        """用刷新令牌换取访问令牌"""
+        return await self._token_request({
+            "grant_type": "refresh_token",
+            "refresh_token": refresh_token
+        })
+
+    async def _token_request(self, data: Dict[str, str]) -> Dict[str, str]:
+        client_id, client_secret = self.client_credentials()
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.post(
+                self.token_endpoint,
+                data={**data, "client_id": client_id, "client_secret": client_secret}
+            )
+            response.raise_for_status()
+            return response.json()
+
+    async def list_files(self, access_token: str, folder: str) -> List[ConnectorFile]:
+        """列出文件夹中的PDF文件"""
+        raise NotImplementedError
+
+    async def download(self, access_token: str, file_ref: str, target: Path) -> str:
+        """下载文件到本地，返回云盘上的文件名"""
+        raise NotImplementedError
+
+    async def upload(self, access_token: str, folder: str, file_path: Path) -> None:
+        """上传文件到文件夹"""
+        raise NotImplementedError
+
+    @staticmethod
+    async def _read_file(file_path: Path, offset: int = 0, length: Optional[int] = None) -> AsyncIterator[bytes]:
+        """从offset开始分块读取文件，length为空时读到文件末尾，避免一次性读入内存"""
+        remaining = file_path.stat().st_size - offset if length is None else length
+        with open(file_path, "rb") as f:
+            f.seek(offset)
+            while remaining > 0:
+                chunk = await asyncio.to_thread(f.read, min(READ_CHUNK_SIZE, remaining))
+                if not chunk:
+                    break
+                remaining -= len(chunk)
+                yield chunk
+
+    @staticmethod
+    async def _stream_to_file(response: httpx.Response, target: Path) -> None:
+        """将下载内容分块写入文件，超过上传大小限制时中止"""
+        size = 0
+        with open(target, "wb") as f:
+            async for chunk in response.aiter_bytes():
+                size += len(chunk)
+                if size > settings.MAX_FILE_SIZE:
+                    raise ValueError(f"文件大小超过限制 ({settings.MAX_FILE_SIZE} 字节)")
+                f.write(chunk)
+
+
+class GoogleDriveConnector(Connector):
+    """Google Drive连接器"""
+
+    provider = ConnectorProvider.GOOGLE_DRIVE
+    authorize_endpoint = "https://accounts.google.com/o/oauth2/v2/auth"
+    token_endpoint = "https://oauth2.googleapis.com/token"
+    api_base = "https://www.googleapis.com/drive/v3"
+    upload_base = "https://www.googleapis.com/upload/drive/v3"
+    # 可续传上传每次发送的字节数，必须是256KB的整数倍
+    upload_chunk_size = 8 * 1024 * 1024
+
+    def client_credentials(self) -> Tuple[str, str]:
+        if not settings.GOOGLE_CLIENT_ID:
+            raise ValueError("未配置Google Drive应用（GOOGLE_CLIENT_ID）")
+        return settings.GOOGLE_CLIENT_ID, settings.GOOGLE_CLIENT_SECRET
+
+    def authorization_params(self) -> Dict[str, str]:
+        # offline + consent 才会返回刷新令牌
+        return {
+            "scope": "https://www.googleapis.com/auth/drive",
+            "access_type": "offline",
+            "prompt": "consent"
+        }
+
+    async def list_files(self, access_token: str, folder: str) -> List[ConnectorFile]:
+        query = "mimeType='application/pdf' and trashed=false"
+        if folder:
+            escaped = folder.replace("\\", "\\\\").replace("'", "\\'")
+            query += f" and '{escaped}' in parents"
+
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.get(
+                f"{self.api_base}/files",
+                params={"q": query, "fields": "files(id,name,size,modifiedTime)", "pageSize": 100},
+                headers={"Authorization": f"Bearer {access_token}"}
+            )
+            response.raise_for_status()
+
+        return [
+            ConnectorFile(
+                id=item["id"],
+                name=item["name"],
+                size=int(item["size"]) if item.get("size") else None,
+                modified_at=item.get("modifiedTime")
+            )
+            for item in response.json().get("files", [])
+        ]
+
+    async def download(self, access_token: str, file_ref: str, target: Path) -> str:
+        headers = {"Authorization": f"Bearer {access_token}"}
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            meta = await client.get(f"{self.api_base}/files/{file_ref}", params={"fields": "name"}, headers=headers)
+            meta.raise_for_status()
+
+            async with client.stream("GET", f"{self.api_base}/files/{file_ref}", params={"alt": "media"}, headers=headers) as response:
+                response.raise_for_status()
+                await self._stream_to_file(response, target)
+
+        return meta.json()["name"]
+
+    async def upload(self, access_token: str, folder: str, file_path: Path) -> None:
+        """使用可续传上传分块发送文件，每块失败后从服务端已确认的位置继续"""
+        metadata = {"name": file_path.name}
+        if folder:
+            metadata["parents"] = [folder]
+
+        size = file_path.stat().st_size
+        headers = {"Authorization": f"Bearer {access_token}"}
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.post(
+                f"{self.upload_base}/files",
+                params={"uploadType": "resumable"},
+                json=metadata,
+                headers={
+                    **headers,
+                    "X-Upload-Content-Type": "application/pdf",
+                    "X-Upload-Content-Length": str(size)
+                }
+            )
+            response.raise_for_status()
+            session_url = response.headers["Location"]
+
+            offset = 0
+            while True:
+                length = min(self.upload_chunk_size, size - offset)
+                content_range = f"bytes {offset}-{offset + length - 1}/{size}" if length else f"bytes */{size}"
+                response = await client.put(
+                    session_url,
+                    content=self._read_file(file_path, offset, length),
+                    headers={**headers, "Content-Length": str(length), "Content-Range": content_range}
+                )
+                if response.status_code != 308:
+                    response.raise_for_status()
+                    return
+
+                # 308表示上传未完成，Range为服务端已保存的范围（bytes=0-N），从其后继续
+                received = response.headers.get("Range")
+                next_offset = int(received.rsplit("-", 1)[1]) + 1 if received else 0
+                if next_offset <= offset and length:
+                    raise RuntimeError(f"Google Drive上传没有进展: {file_path.name} ({offset}/{size})")
+                offset = next_offset
+
+
+class DropboxConnector(Connector):
+    """Dropbox连接器"""
+
+    provider = ConnectorProvider.DROPBOX
+    authorize_endpoint = "https://www.dropbox.com/oauth2/authorize"
+    token_endpoint = "https://api.dropboxapi.com/oauth2/token"
+    api_base = "https://api.dropboxapi.com/2"
+    content_base = "https://content.dropboxapi.com/2"
+
+    def client_credentials(self) -> Tuple[str, str]:
+        if not settings.DROPBOX_APP_KEY:
+            raise ValueError("未配置Dropbox应用（DROPBOX_APP_KEY）")
+        return settings.DROPBOX_APP_KEY, settings.DROPBOX_APP_SECRET
+
+    def authorization_params(self) -> Dict[str, str]:
+        return {"token_access_type": "offline"}
+
+    async def list_files(self, access_token: str, folder: str) -> List[ConnectorFile]:
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.post(
+                f"{self.api_base}/files/list_folder",
+                json={"path": self._normalize_path(folder)},
+                headers={"Authorization": f"Bearer {access_token}"}
+            )
+            response.raise_for_status()
+
+        return [
+            ConnectorFile(
+                id=item["id"],
+                name=item["name"],
+                size=item.get("size"),
+                modified_at=item.get("server_modified")
+            )
+            for item in response.json().get("entries", [])
+            if item.get(".tag") == "file" and item["name"].lower().endswith(".pdf")
+        ]
+
+    async def download(self, access_token: str, file_ref: str, target: Path) -> str:
+        headers = {
+            "Authorization": f"Bearer {access_token}",
+            "Dropbox-API-Arg": json.dumps({"path": file_ref})
+        }
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            async with client.stream("POST", f"{self.content_base}/files/download", headers=headers) as response:
+                response.raise_for_status()
+                result = json.loads(response.headers.get("Dropbox-API-Result", "{}"))
+                await self._stream_to_file(response, target)
+
+        return result.get("name") or Path(file_ref).name
+
+    async def upload(self, access_token: str, folder: str, file_path: Path) -> None:
+        path = f"{self._normalize_path(folder)}/{file_path.name}"
+        async with httpx.AsyncClient(timeout=settings.DELIVERY_TIMEOUT) as client:
+            response = await client.post(
+                f"{self.content_base}/files/upload",
+                content=self._read_file(file_path),
+                headers={
+                    "Authorization": f"Bearer {access_token}",
+                    "Content-Type": "application/octet-stream",
+                    "Content-Length": str(file_path.stat().st_size),
+                    # Dropbox-API-Arg头只允许ASCII，非ASCII字符需转义
+                    "Dropbox-API-Arg": json.dumps({"path": path, "mode": "overwrite"})
+                }
+            )
+            response.raise_for_status()
+
+    @staticmethod
+    def _normalize_path(folder: str) -> str:
+        """Dropbox根目录为空字符串，其余路径以/开头且不以/结尾"""
+        folder = folder.strip("/")
+        return f"/{folder}" if folder else ""
+
+
+class ConnectorService:
+    """云盘连接器服务"""
+
+    def __init__(self):
+        self.connectors: Dict[ConnectorProvider, Connector] = {
+            ConnectorProvider.GOOGLE_DRIVE: GoogleDriveConnector(),
+            ConnectorProvider.DROPBOX: DropboxConnector(),
+        }
+
+    async def authorization_url(self, provider: ConnectorProvider) -> str:
+        """
+        生成授权地址，state用于回调时防止CSRF
+
+        Args:
+            provider: 云盘类型
+
+        Returns:
+            授权地址
+        """
+        store = get_store()
+        now = time.time()
+        for record in await store.avalues(CONNECTOR_STATES_BUCKET):
+            if record.get("expires_at", 0) <= now:
+                await store.adelete(CONNECTOR_STATES_BUCKET, record["state"])
+
+        state = secrets.token_urlsafe(24)
+        await store.aput(CONNECTOR_STATES_BUCKET, state, {
+            "state": state,
+            "provider": provider.value,
+            "tenant_id": get_current_tenant(),
+            "expires_at": now + STATE_TTL,
+        })
+        return self.connectors[provider].authorization_url(state)
+
+    async def complete_authorization(self, provider: ConnectorProvider, code: str, state: str) -> ConnectorStatus:
+        """
+        处理OAuth回调，加密保存刷新令牌
+
+        Args:
+            provider: 云盘类型
+            code: 授权码
+            state: 授权地址中的state
+
+        Returns:
+            连接状态
+        """
+        expected = await self._consume_state(state)
+        if not expected or expected["provider"] != provider.value or expected["expires_at"] < time.time():
+            raise ValueError("授权请求无效或已过期，请重新发起授权")
+
+        tokens = await self.connectors[provider].exchange_code(code)
+        if not tokens.get("refresh_token"):
+            raise ValueError("授权结果中没有刷新令牌")
+
+        # 浏览器回调不一定携带租户标识，以发起授权时的租户为准
+        tenant_id = expected["tenant_id"]
+        connected_at = datetime.now()
+        await get_store().aput(CONNECTORS_BUCKET, provider.value, {
+            "provider": provider.value,
+            "refresh_token": encrypt_secret(tokens["refresh_token"]),
+            "connected_at": connected_at.isoformat()
+        }, tenant_id)
+        await self._cache_access_token(provider, tokens, tenant_id)
+
+        logger.info(f"云盘已连接: {provider.value}")
+        return ConnectorStatus(provider=provider, connected=True, connected_at=connected_at)
+
+    async def list_status(self) -> List[ConnectorStatus]:
+        """列出各云盘的连接状态（不返回令牌）"""
+        result = []
+        for provider in self.connectors:
+            record = await self._load_record(provider)
+            result.append(ConnectorStatus(
+                provider=provider,
+                connected=record is not None,
+                connected_at=datetime.fromisoformat(record["connected_at"]) if record else None
+            ))
+        return result
+
+    async def disconnect(self, provider: ConnectorProvider) -> bool:
+        """
+        断开云盘连接，删除保存的令牌
+
+        Args:
+            provider: 云盘类型
+
+        Returns:
+            是否存在连接
+        """
+        store = get_store()
+        tenant_id = get_current_tenant()
+        await store.adelete(CONNECTOR_TOKENS_BUCKET, provider.value, tenant_id)
+        if not await store.adelete(CONNECTORS_BUCKET, provider.value, tenant_id):
+            return False
+        logger.info(f"云盘已断开: {provider.value}")
+        return True
+
+    async def list_files(self, provider: ConnectorProvider, folder: str = "") -> List[ConnectorFile]:
+        """列出云盘文件夹中的PDF文件"""
+        access_token = await self._access_token(provider)
+        return await self.connectors[provider].list_files(access_token, folder)
+
+    async def import_file(
+        self,
+        provider: ConnectorProvider,
+        file_ref: str,
+        file_service: FileService,
+        filename: Optional[str] = None
+    ) -> FileInfo:
+        """
+        从云盘下载PDF并按上传规则保存
+
+        Args:
+            provider: 云盘类型
+            file_ref: 云盘文件标识
+            file_service: 文件服务
+            filename: 保存的文件名
+
+        Returns:
+            文件信息
+        """
+        access_token = await self._access_token(provider)
+
+        with scratch_dir() as temp_dir:
+            target = temp_dir / "download.pdf"
+            remote_name = await self.connectors[provider].download(access_token, file_ref, target)
+            with open(target, "rb") as stream:
+                return await file_service.save_pdf_stream(stream, filename or remote_name)
+
+    async def export_files(self, provider: ConnectorProvider, folder: str, files: List[Path]) -> int:
+        """
+        将章节文件写回云盘文件夹
+
+        Args:
+            provider: 云盘类型
+            folder: 目标文件夹
+            files: 待上传的文件
+
+        Returns:
+            上传的文件数量
+        """
+        connector = self.connectors[provider]
+        access_token = await self._access_token(provider)
+        for file_path in files:
+            await connector.upload(access_token, folder, file_path)
+
+        logger.info(f"章节文件已写回云盘: {provider.value}:{folder or '/'} - {len(files)} 个文件")
+        return len(files)
+
+    async def _consume_state(self, state: str) -> Optional[Dict[str, Any]]:
+        """原子地取出并作废授权state，同一state只能使用一次"""
+        if not state or not STATE_PATTERN.fullmatch(state):
+            return None
+        consumed: Dict[str, Any] = {}
+
+        def mark_used(current: Optional[Dict[str, Any]]) -> Optional[Dict[str, Any]]:
+            if not current or current.get("used"):
+                return None
+            consumed.update(current)
+            return {**current, "used": True}
+
+        store = get_store()
+        if await store.aupdate(CONNECTOR_STATES_BUCKET, state, mark_used) is None:
+            return None
+        await store.adelete(CONNECTOR_STATES_BUCKET, state)
+        return consumed
+
+    async def _access_token(self, provider: ConnectorProvider) -> str:
+        """获取有效的访问令牌，过期时用刷新令牌续期"""
+        tenant_id = get_current_tenant()
+        cached = await get_store().aget(CONNECTOR_TOKENS_BUCKET, provider.value, tenant_id)
+        if cached and cached["expires_at"] > time.time():
+            return decrypt_secret(cached["access_token"])
+
+        record = await self._load_record(provider)
+        if not record:
+            raise ValueError(f"尚未连接 {provider.value}，请先完成授权")
+
+        tokens = await self.connectors[provider].refresh(decrypt_secret(record["refresh_token"]))
+        return await self._cache_access_token(provider, tokens, tenant_id)
+
+    async def _cache_access_token(self, provider: ConnectorProvider, tokens: Dict[str, str], tenant_id: str) -> str:
+        # 提前一分钟视为过期
+        expires_at = time.time() + int(tokens.get("expires_in", 3600)) - 60
+        await get_store().aput(CONNECTOR_TOKENS_BUCKET, provider.value, {
+            "access_token": encrypt_secret(tokens["access_token"]),
+            "expires_at": expires_at
+        }, tenant_id)
+        return tokens["access_token"]
+
+    async def _load_record(self, provider: ConnectorProvider) -> Optional[Dict[str, str]]:
+        try:
+            return await get_store().aget(CONNECTORS_BUCKET, provider.value, get_current_tenant())
+        except Exception as e:
+            logger.error(f"读取云盘连接信息失败: {provider.value} - {str(e)}")
+            return None
+
+
+# 创建全局连接器服务实例
+connector_service = ConnectorService()
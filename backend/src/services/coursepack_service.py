@@ -0,0 +1,191 @@
+"""
+课程读本
+把多个上传文件中的章节按指定顺序合并为一个PDF，可选封面、目录页和分隔页，
+每项内容生成一级书签、其中的节生成二级书签，结果作为新文件保存
+"""
+
+import asyncio
+import math
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import List, Optional, Tuple
+
+import fitz
+from loguru import logger
+
+from ..core.errors import InvalidRangeError
+from ..core.scratch import scratch_dir
+from ..models.schemas import CoursePackRequest, FileInfo, SectionInfo
+from .pdf_splitter import insert_divider_page
+
+
+# 目录页每页的条目数
+TOC_ENTRIES_PER_PAGE = 30
+
+# 目录条目的行高（pt）
+TOC_LINE_HEIGHT = 20
+
+# 目录页、封面与页面边缘的距离（pt）
+PAGE_MARGIN = 72
+
+
+@dataclass
+class CoursePackPart:
+    """读本中的一项内容：源文件的物理页范围"""
+    path: str
+    title: str
+    start_page: int
+    end_page: int
+    sections: List[SectionInfo] = field(default_factory=list)
+    source: Optional[str] = None  # 来源著作的引用名称，没有副标题时列在封面上
+
+
+class CoursePackService:
+    """课程读本生成服务"""
+
+    async def create(self, parts: List[CoursePackPart], request: CoursePackRequest, file_service) -> Tuple[FileInfo, int]:
+        """
+        生成课程读本并保存为新文件
+
+        Args:
+            parts: 按输出顺序的内容
+            request: 生成请求（标题和封面、目录、分隔页选项）
+            file_service: 文件服务
+
+        Returns:
+            (新文件信息, 总页数)
+
+        Raises:
+            InvalidRangeError: 页范围超出源文件页数
+        """
+        with scratch_dir() as temp_dir:
+            target = temp_dir / "coursepack.pdf"
+            pages = await asyncio.to_thread(self.build, parts, target, request)
+            with open(target, "rb") as stream:
+                file_info = await file_service.save_pdf_stream(stream, f"{request.title}.pdf")
+
+        logger.info(f"课程读本已生成: {file_info.file_id} - {len(parts)} 项内容，{pages} 页")
+        return file_info, pages
+
+    def build(self, parts: List[CoursePackPart], output_path: Path, request: CoursePackRequest) -> int:
+        """
+        合并内容并写入output_path
+
+        Returns:
+            总页数
+        """
+        pack = fitz.open()
+        try:
+            # 先合并内容，记录每项内容（有分隔页时为分隔页）和每个节在内容中的页序号
+            entries = []
+            for part in parts:
+                with fitz.open(part.path) as source:
+                    if part.end_page > source.page_count:
+                        raise InvalidRangeError(f"“{part.title}”的结束页 {part.end_page} 超出文件页数 {source.page_count}")
+                    heading = len(pack)
+                    if request.dividers:
+                        insert_divider_page(pack, heading, part.title, source[part.start_page - 1].rect)
+                    first = len(pack)
+                    pack.insert_pdf(source, from_page=part.start_page - 1, to_page=part.end_page - 1)
+                sections = [
+                    (section.title, first + section.start_page - part.start_page)
+                    for section in part.sections
+                    if part.start_page <= section.start_page <= part.end_page
+                ]
+                entries.append((part.title, heading, sections))
+
+            # 再在开头插入封面和目录页，内容的页序号整体后移
+            rect = pack[0].rect
+            front = 0
+            if request.cover:
+                self._insert_cover(pack, request.title, request.subtitle or self._sources_line(parts), rect)
+                front += 1
+            toc_pages = math.ceil(len(entries) / TOC_ENTRIES_PER_PAGE) if request.toc else 0
+            front += toc_pages
+            if toc_pages:
+                self._insert_toc(pack, entries, front - toc_pages, front, rect)
+
+            toc = []
+            for title, heading, sections in entries:
+                toc.append([1, title, heading + front + 1])
+                toc.extend([2, section_title, index + front + 1] for section_title, index in sections)
+            pack.set_toc(toc)
+            pack.set_metadata({"title": request.title})
+            pack.save(str(output_path), garbage=3, deflate=True)
+            return pack.page_count
+        finally:
+            pack.close()
+
+    @staticmethod
+    def _sources_line(parts: List[CoursePackPart]) -> Optional[str]:
+        """封面上列出的来源著作，按首次出现的顺序去重"""
+        sources = list(dict.fromkeys(part.source for part in parts if part.source))
+        return f"选自：{'；'.join(sources)}" if sources else None
+
+    @staticmethod
+    def _insert_cover(pack: fitz.Document, title: str, subtitle: Optional[str], rect: fitz.Rect) -> None:
+        """在第1页插入封面"""
+        page = pack.new_page(0, width=rect.width, height=rect.height)
+        page.insert_textbox(
+            fitz.Rect(PAGE_MARGIN, rect.height / 3, rect.width - PAGE_MARGIN, rect.height / 2),
+            title,
+            fontsize=28,
+            fontname="china-s",
+            align=fitz.TEXT_ALIGN_CENTER
+        )
+        if subtitle:
+            page.insert_textbox(
+                fitz.Rect(PAGE_MARGIN, rect.height / 2, rect.width - PAGE_MARGIN, rect.height * 2 / 3),
+                subtitle,
+                fontsize=16,
+                fontname="china-s",
+                color=(0.3, 0.3, 0.3),
+                align=fitz.TEXT_ALIGN_CENTER
+            )
+
+    def _insert_toc(self, pack: fitz.Document, entries: List[tuple], index: int, front: int, rect: fitz.Rect) -> None:
+        """
+        从index处插入目录页，每个条目链接到对应内容
+
+        Args:
+            pack: 读本文档
+            entries: (标题, 内容中的页序号, 节列表)
+            index: 第一个目录页的位置
+            front: 内容之前的页数（封面和目录页）
+            rect: 页面尺寸
+        """
+        font = fitz.Font("china-s")
+        pages = []
+        for offset in range(math.ceil(len(entries) / TOC_ENTRIES_PER_PAGE)):
+            page = pack.new_page(index + offset, width=rect.width, height=rect.height)
+            if offset == 0:
+                page.insert_text((PAGE_MARGIN, PAGE_MARGIN), "目录", fontsize=20, fontname="china-s")
+            pages.append(page.number)
+
+        # 所有目录页都插入后再添加链接，目标页序号不再变化
+        for i, (title, heading, _) in enumerate(entries):
+            page = pack[pages[i // TOC_ENTRIES_PER_PAGE]]
+            y = PAGE_MARGIN + TOC_LINE_HEIGHT * (i % TOC_ENTRIES_PER_PAGE + 2)
+            number = str(heading + front + 1)
+            number_x = rect.width - PAGE_MARGIN - font.text_length(number, fontsize=11)
+            page.insert_text((PAGE_MARGIN, y), self._fit(font, title, number_x - PAGE_MARGIN - 12), fontsize=11, fontname="china-s")
+            page.insert_text((number_x, y), number, fontsize=11, fontname="china-s")
+            page.insert_link({
+                "kind": fitz.LINK_GOTO,
+                "from": fitz.Rect(PAGE_MARGIN, y - TOC_LINE_HEIGHT + 6, rect.width - PAGE_MARGIN, y + 6),
+                "page": heading + front,
+                "to": fitz.Point(0, 0)
+            })
+
+    @staticmethod
+    def _fit(font: fitz.Font, text: str, width: float) -> str:
+        """截断超出宽度的标题"""
+        if font.text_length(text, fontsize=11) <= width:
+            return text
+        while text and font.text_length(text + "…", fontsize=11) > width:
+            text = text[:-1]
+        return text + "…"
+
+
+# 创建全局课程读本服务实例
+coursepack_service = CoursePackService()
@@ -0,0 +1,348 @@
+"""
+输出投递服务
+拆分完成后将章节文件推送到S3存储桶、SFTP服务器或WebDAV共享目录
+"""
+
+import asyncio
+import posixpath
+import re
+from pathlib import Path
+from typing import Any, Dict, List, Optional
+
+import httpx
+from loguru import logger
+
+from ..models.schemas import DeliveryConfig, DeliveryType, FileInfo, OutputManifest
+from ..core.config import settings
+from ..core.tenancy import get_current_tenant
+
+
+# 对象键模板中的占位符示例值，用于校验模板
+KEY_TEMPLATE_SAMPLE = {
+    "title_slug": "book",
+    "author_slug": "author",
+    "chapter_index": 1,
+    "chapter_slug": "chapter",
+    "filename": "01_chapter.pdf",
+    "file_id": "file",
+}
+
+
+def slugify(value: str, fallback: str = "untitled") -> str:
+    """
+    转换为对象键中的路径片段：小写，字母、数字（含中文）以外的字符合并为连字符
+
+    Args:
+        value: 原始文字
+        fallback: 结果为空时的值
+
+    Returns:
+        路径片段
+    """
+    slug = re.sub(r"[\W_]+", "-", value.lower()).strip("-")
+    return slug[:80].rstrip("-") or fallback
+
+
+def render_object_key(template: str, **fields) -> str:
+    """
+    按模板生成对象键，结果必须是不含 . 和 .. 片段的相对路径
+
+    Raises:
+        ValueError: 模板包含未知占位符、格式错误或生成的键无效
+    """
+    try:
+        key = template.format(**fields)
+    except (KeyError, IndexError, ValueError) as e:
+        raise ValueError(
+            f"对象键模板无效，可用占位符为 {{title_slug}}、{{author_slug}}、{{chapter_index}}、{{chapter_slug}}、{{filename}}、{{file_id}}: {e}"
+        )
+    parts = key.split("/")
+    if key.startswith("/") or not parts[-1] or any(part in ("", ".", "..") for part in parts):
+        raise ValueError(f"对象键模板生成的键无效: {key}")
+    return key
+
+
+def sftp_address(target: str) -> tuple:
+    """SFTP目标的(主机, 端口)，端口默认22"""
+    host, _, port = target.strip().rpartition(":") if ":" in target else (target.strip(), "", "")
+    return host.lower(), int(port or 22)
+
+
+def known_hosts_path(credentials: Dict[str, Any]) -> str:
+    """
+    校验SFTP服务器公钥的known_hosts文件
+
+    Raises:
+        ValueError: 未配置
+    """
+    path = credentials.get("known_hosts") or settings.DELIVERY_KNOWN_HOSTS
+    if not path:
+        raise ValueError("SFTP投递需要配置服务器公钥（凭据的known_hosts或DELIVERY_KNOWN_HOSTS）")
+    return path
+
+
+def target_allowed(config: DeliveryConfig, bound: str) -> bool:
+    """
+    投递目标是否为凭据绑定的目标：S3存储桶相同、SFTP主机和端口相同，
+    WebDAV地址的协议、主机和端口相同且路径在绑定的前缀之下
+
+    Args:
+        config: 投递配置
+        bound: 凭据绑定的目标
+
+    Returns:
+        是否允许
+    """
+    if config.type == DeliveryType.S3:
+        return config.target.strip() == bound.strip()
+    if config.type == DeliveryType.SFTP:
+        return sftp_address(config.target) == sftp_address(bound)
+    try:
+        url, allowed = httpx.URL(config.target), httpx.URL(bound)
+    except Exception:
+        return False
+    if (url.scheme, url.host, url.port) != (allowed.scheme, allowed.host, allowed.port):
+        return False
+    prefix = allowed.path.rstrip("/") + "/"
+    return (url.path.rstrip("/") + "/").startswith(prefix)
+
+
+class DeliveryTarget:
+    """投递目标基类"""
+
+    def __init__(self, config: DeliveryConfig, credentials: Dict[str, Any], keys: Optional[Dict[str, str]] = None):
+        self.config = config
+        self.credentials = credentials
+        self.keys = keys or {}
+
+    async def upload(self, files: List[Path]) -> None:
+        """上传文件"""
+        raise NotImplementedError
+
+    def _remote_path(self, filename: str) -> str:
+        """拼接目标路径（相对于存储桶或共享根目录），按对象键模板生成的键优先"""
+        return posixpath.join(self.config.path.strip("/"), self.keys.get(filename, filename))
+
+
+class S3Target(DeliveryTarget):
+    """S3（及兼容S3协议的对象存储）"""
+
+    async def upload(self, files: List[Path]) -> None:
+        # boto3为阻塞调用，放入线程池执行
+        await asyncio.get_running_loop().run_in_executor(None, self._upload, files)
+
+    def _upload(self, files: List[Path]) -> None:
+        try:
+            import boto3
+        except ImportError:
+            raise RuntimeError("S3投递需要安装boto3")
+
+        client = boto3.client(
+            "s3",
+            aws_access_key_id=self.credentials.get("access_key_id"),
+            aws_secret_access_key=self.credentials.get("secret_access_key"),
+            region_name=self.credentials.get("region") or None,
+            endpoint_url=self.credentials.get("endpoint_url") or None
+        )
+        for file_path in files:
+            client.upload_file(str(file_path), self.config.target, self._remote_path(file_path.name))
+
+
+class SFTPTarget(DeliveryTarget):
+    """SFTP服务器"""
+
+    async def upload(self, files: List[Path]) -> None:
+        # paramiko为阻塞调用，放入线程池执行
+        await asyncio.get_running_loop().run_in_executor(None, self._upload, files)
+
+    def _upload(self, files: List[Path]) -> None:
+        try:
+            import paramiko
+        except ImportError:
+            raise RuntimeError("SFTP投递需要安装paramiko")
+
+        host, port = sftp_address(self.config.target)
+        client = paramiko.SSHClient()
+        # 只连接known_hosts中公钥一致的服务器，防止凭据被发送到冒充的主机
+        client.load_host_keys(known_hosts_path(self.credentials))
+        client.set_missing_host_key_policy(paramiko.RejectPolicy())
+        try:
+            pkey = None
+            if self.credentials.get("private_key_path"):
+                pkey = paramiko.RSAKey.from_private_key_file(self.credentials["private_key_path"])
+            client.connect(
+                host,
+                port=port,
+                username=self.credentials.get("username"),
+                password=self.credentials.get("password"),
+                pkey=pkey,
+                timeout=settings.DELIVERY_TIMEOUT,
+                banner_timeout=settings.DELIVERY_TIMEOUT,
+                allow_agent=False,
+                look_for_keys=False
+            )
+            sftp = client.open_sftp()
+            self._ensure_dir(sftp, self.config.path)
+            for file_path in files:
+                sftp.put(str(file_path), self._remote_path(file_path.name))
+        finally:
+            client.close()
+
+    def _remote_path(self, filename: str) -> str:
+        """SFTP保留绝对路径，相对路径基于登录用户的主目录"""
+        return posixpath.join(self.config.path, filename)
+
+    @staticmethod
+    def _ensure_dir(sftp, path: str) -> None:
+        """逐级创建远程目录"""
+        current = "/" if path.startswith("/") else ""
+        for part in [p for p in path.split("/") if p]:
+            current = posixpath.join(current, part)
+            try:
+                sftp.stat(current)
+            except IOError:
+                sftp.mkdir(current)
+
+
+class WebDAVTarget(DeliveryTarget):
+    """WebDAV共享目录"""
+
+    async def upload(self, files: List[Path]) -> None:
+        auth = None
+        if self.credentials.get("username"):
+            auth = (self.credentials["username"], self.credentials.get("password", ""))
+
+        base_url = self.config.target.rstrip("/")
+        async with httpx.AsyncClient(auth=auth, timeout=settings.DELIVERY_TIMEOUT) as client:
+            await self._ensure_dir(client, base_url)
+            for file_path in files:
+                response = await client.put(
+                    f"{base_url}/{self._remote_path(file_path.name)}",
+                    content=self._iter_file(file_path)
+                )
+                response.raise_for_status()
+
+    @staticmethod
+    async def _iter_file(file_path: Path):
+        """分块读取文件，避免整文件读入内存"""
+        with open(file_path, "rb") as f:
+            while chunk := f.read(settings.COPY_BUFFER_SIZE):
+                yield chunk
+
+    async def _ensure_dir(self, client: httpx.AsyncClient, base_url: str) -> None:
+        """逐级创建集合（目录），已存在时服务器返回405"""
+        current = base_url
+        for part in [p for p in self.config.path.split("/") if p]:
+            current = f"{current}/{part}"
+            response = await client.request("MKCOL", current + "/")
+            if response.status_code not in (201, 405):
+                response.raise_for_status()
+
+
+class DeliveryService:
+    """输出投递服务"""
+
+    TARGETS = {
+        DeliveryType.S3: S3Target,
+        DeliveryType.SFTP: SFTPTarget,
+        DeliveryType.WEBDAV: WebDAVTarget,
+    }
+
+    def validate(self, config: DeliveryConfig) -> None:
+        """
+        校验投递配置：凭据存在、当前租户可以使用，且目标是凭据绑定的目标，
+        服务端凭据不会被发送到调用方指定的其他主机
+
+        Args:
+            config: 投递配置
+
+        Raises:
+            ValueError: 凭据不存在或不可用、目标与凭据不符、路径无效，或对象键模板无效
+        """
+        credentials = settings.DELIVERY_CREDENTIALS.get(config.credentials_ref)
+        if credentials is None:
+            raise ValueError(f"未配置投递凭据: {config.credentials_ref}")
+        tenants = credentials.get("tenants") or [settings.DEFAULT_TENANT]
+        if get_current_tenant() not in tenants:
+            raise ValueError(f"未配置投递凭据: {config.credentials_ref}")
+        bound = credentials.get("target")
+        if not bound:
+            raise ValueError(f"投递凭据 {config.credentials_ref} 未绑定投递目标（target），不能使用")
+        if not target_allowed(config, bound):
+            raise ValueError(f"投递凭据 {config.credentials_ref} 只能用于 {bound}")
+        if ".." in config.path.split("/"):
+            raise ValueError("投递路径不能包含 ..")
+        if config.key_template:
+            if config.type != DeliveryType.S3:
+                raise ValueError("key_template 只适用于S3投递")
+            render_object_key(config.key_template, **KEY_TEMPLATE_SAMPLE)
+        if config.type == DeliveryType.SFTP:
+            known_hosts_path(credentials)
+
+    def object_keys(
+        self,
+        config: DeliveryConfig,
+        filenames: List[str],
+        manifest: OutputManifest,
+        file_info: FileInfo
+    ) -> Dict[str, str]:
+        """
+        按对象键模板生成每个待投递文件的键（相对于path）
+
+        章节文件按清单顺序编号，清单、打包等其他文件放在第一个章节所在的目录
+
+        Args:
+            config: 投递配置
+            filenames: 待投递的文件名
+            manifest: 章节输出校验清单
+            file_info: 源文件信息，书名没有识别到时使用文件名
+
+        Returns:
+            文件名 -> 对象键，没有模板时为空
+        """
+        if not config.key_template:
+            return {}
+
+        book = file_info.title or Path(file_info.filename).stem
+        keys = {}
+        for index, entry in enumerate(manifest.files, 1):
+            key = render_object_key(
+                config.key_template,
+                title_slug=slugify(book),
+                author_slug=slugify(file_info.author or "", fallback="unknown"),
+                chapter_index=index,
+                chapter_slug=slugify(entry.title, fallback=f"chapter-{index}"),
+                filename=entry.filename,
+                file_id=file_info.file_id
+            )
+            # 标题相同的章节生成相同的键时追加序号，避免互相覆盖
+            if key in keys.values():
+                stem, ext = posixpath.splitext(key)
+                key = f"{stem}-{index}{ext}"
+            keys[entry.filename] = key
+        folder = posixpath.dirname(next(iter(keys.values()), ""))
+        return {name: keys.get(name) or posixpath.join(folder, name) for name in filenames}
+
+    async def deliver(self, config: DeliveryConfig, files: List[Path], keys: Optional[Dict[str, str]] = None) -> int:
+        """
+        推送章节文件到投递目标
+
+        Args:
+            config: 投递配置
+            files: 待推送的文件
+            keys: object_keys生成的对象键，为空时按文件名平铺
+
+        Returns:
+            推送的文件数量
+        """
+        self.validate(config)
+        target = self.TARGETS[config.type](config, settings.DELIVERY_CREDENTIALS[config.credentials_ref], keys)
+
+        await target.upload(files)
+
+        logger.info(f"章节文件已投递: {config.type.value}://{config.target}/{config.path.strip('/')} - {len(files)} 个文件")
+        return len(files)
+
+
+# 创建全局投递服务实例
+delivery_service = DeliveryService()
@@ -0,0 +1,171 @@
+"""
+文档标题和作者
+上传时从PDF元数据读取标题和作者，元数据缺失或明显无效（如 "Microsoft Word - doc1.docx"、"untitled"）时
+按前几页中字号最大的文字推断标题、按 "by ..."、"作者：..." 等行推断作者，生成文件列表中显示的名称
+"""
+
+import re
+from pathlib import Path
+from typing import Dict, List, Optional, Tuple
+
+import fitz
+from loguru import logger
+
+from ..models.schemas import FileInfo
+
+
+# 推断标题时检查的页数（跳过空白封面页）
+TITLE_SCAN_PAGES = 3
+
+# 标题的长度范围
+MIN_TITLE_LENGTH = 3
+MAX_TITLE_LENGTH = 200
+
+# 与最大字号相差在该比例内的文字视为标题的一部分（多行标题）
+TITLE_SIZE_TOLERANCE = 0.95
+
+# 生成工具写入的无效标题和作者
+JUNK_VALUES = {"untitled", "unknown", "anonymous", "none", "null", "title", "author", "administrator", "admin", "user", "owner"}
+
+# 办公软件转换时加在标题前的程序名，如 "Microsoft Word - 讲义.docx"
+PRODUCER_PREFIX_PATTERN = re.compile(r"^(?:microsoft\s+\w+|powerpoint|word)\s+-\s+", re.IGNORECASE)
+# 标题末尾的源文件扩展名
+SOURCE_EXTENSION_PATTERN = re.compile(r"\.(?:docx?|pptx?|xlsx?|pdf|tex|dvi|ps|odt|rtf|txt|indd)$", re.IGNORECASE)
+
+# 首页中标明作者的行
+AUTHOR_LINE_PATTERNS = [
+    re.compile(r"^by\s+(.{2,100})$", re.IGNORECASE),
+    re.compile(r"^(?:作者|著者|编者)\s*[:：]\s*(.{2,100})$"),
+    re.compile(r"^(.{2,40}?)\s*(?:编著|主编|著|编)$"),
+]
+
+
+def extract_title_author(file_path: str) -> Tuple[Optional[str], Optional[str]]:
+    """
+    读取文档的标题和作者
+
+    Args:
+        file_path: PDF文件路径
+
+    Returns:
+        (标题, 作者)，无法确定时为None；文件无法打开时均为None
+    """
+    try:
+        with fitz.open(file_path) as doc:
+            if doc.needs_pass:
+                return None, None
+            metadata = doc.metadata or {}
+            title = clean_title(metadata.get("title"))
+            author = clean_author(metadata.get("author"))
+            if title and author:
+                return title, author
+
+            lines = _first_page_lines(doc)
+    except Exception as e:
+        logger.warning(f"读取文档标题失败: {file_path} - {str(e)}")
+        return None, None
+
+    return title or _title_from_lines(lines), author or _author_from_lines(lines)
+
+
+def suggest_display_name(title: Optional[str], author: Optional[str], filename: str) -> str:
+    """
+    文件列表中显示的名称：标题 – 作者，没有标题时为不含扩展名的文件名
+
+    Args:
+        title: 标题
+        author: 作者
+        filename: 原始文件名
+
+    Returns:
+        显示名称
+    """
+    if not title:
+        return Path(filename).stem or filename
+    return f"{title} – {author}" if author else title
+
+
+def display_name(file_info: FileInfo) -> str:
+    """文件的显示名称，早于标题识别上传的文件按文件名生成"""
+    return file_info.display_name or suggest_display_name(file_info.title, file_info.author, file_info.filename)
+
+
+def citation(file_info: FileInfo) -> Optional[str]:
+    """识别到标题的文档的引用名称，如 "Deep Learning – Goodfellow (2nd ed.)"，没有标题时为None"""
+    if not file_info.title:
+        return None
+    name = suggest_display_name(file_info.title, file_info.author, file_info.filename)
+    return f"{name} ({file_info.edition})" if file_info.edition else name
+
+
+def filename_fields(file_info: FileInfo) -> Dict[str, str]:
+    """章节文件名模板中的文档级占位符：{book}（无标题时为文件名）、{author}、{edition}"""
+    return {
+        "book": file_info.title or Path(file_info.filename).stem,
+        "author": file_info.author or "",
+        "edition": file_info.edition or "",
+    }
+
+
+def clean_title(value: Optional[str]) -> Optional[str]:
+    """清理元数据中的标题，无效时返回None"""
+    value = _squash(value)
+    value = PRODUCER_PREFIX_PATTERN.sub("", value)
+    value = SOURCE_EXTENSION_PATTERN.sub("", value).strip()
+    if not MIN_TITLE_LENGTH <= len(value) <= MAX_TITLE_LENGTH or value.lower() in JUNK_VALUES:
+        return None
+    if not any(char.isalpha() for char in value):
+        return None
+    return value
+
+
+def clean_author(value: Optional[str]) -> Optional[str]:
+    """清理元数据中的作者，无效时返回None"""
+    value = _squash(value)
+    if not 2 <= len(value) <= 100 or value.lower() in JUNK_VALUES:
+        return None
+    return value
+
+
+def _squash(value: Optional[str]) -> str:
+    """合并连续空白"""
+    return " ".join((value or "").split())
+
+
+def _first_page_lines(doc: fitz.Document) -> List[Tuple[str, float]]:
+    """第一个有文字的页面（最多检查TITLE_SCAN_PAGES页）中的文本行及其最大字号"""
+    for page in list(doc)[:TITLE_SCAN_PAGES]:
+        lines = []
+        for block in page.get_text("dict").get("blocks", []):
+            for line in block.get("lines", []):
+                spans = [span for span in line.get("spans", []) if span.get("text", "").strip()]
+                if spans:
+                    text = _squash("".join(span["text"] for span in spans))
+                    lines.append((text, max(span["size"] for span in spans)))
+        if lines:
+            return lines
+    return []
+
+
+def _title_from_lines(lines: List[Tuple[str, float]]) -> Optional[str]:
+    """字号最大的连续几行作为标题"""
+    if not lines:
+        return None
+    largest = max(size for _, size in lines)
+    title_lines = []
+    for text, size in lines:
+        if size >= largest * TITLE_SIZE_TOLERANCE:
+            title_lines.append(text)
+        elif title_lines:
+            break
+    return clean_title(" ".join(title_lines))
+
+
+def _author_from_lines(lines: List[Tuple[str, float]]) -> Optional[str]:
+    """首页中 "by ..."、"作者：..."、"张三 著" 形式的行"""
+    for text, _ in lines:
+        for pattern in AUTHOR_LINE_PATTERNS:
+            match = pattern.match(text)
+            if match:
+                return clean_author(match.group(1))
+    return None
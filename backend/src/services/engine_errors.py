@@ -0,0 +1,92 @@
+"""
+外部引擎错误归类
+按Ghostscript、Tesseract的输出把失败归为用户可处理的错误代码（文件已加密、已损坏、使用了不支持的特性），
+原始输出的末尾摘录随错误保留，写入任务的错误详情供排查
+"""
+
+from typing import Dict, List, Optional, Tuple
+
+from ..core.errors import EngineError
+from ..models.schemas import ErrorCode
+
+
+# 保留的引擎输出摘录上限（字符，取末尾）
+OUTPUT_EXCERPT_CHARS = 2000
+
+# 各引擎输出中的特征（小写匹配），按顺序取第一个匹配的错误代码
+ENGINE_PATTERNS: Dict[str, List[Tuple[str, ErrorCode]]] = {
+    "Ghostscript": [
+        ("requires a password", ErrorCode.ENCRYPTED),
+        ("password did not work", ErrorCode.ENCRYPTED),
+        ("encrypted", ErrorCode.ENCRYPTED),
+        ("couldn't find trailer", ErrorCode.CORRUPT),
+        ("xref", ErrorCode.CORRUPT),
+        ("damaged", ErrorCode.CORRUPT),
+        ("/syntaxerror", ErrorCode.CORRUPT),
+        ("/ioerror", ErrorCode.CORRUPT),
+        ("/undefinedresource", ErrorCode.UNSUPPORTED),
+        ("not supported", ErrorCode.UNSUPPORTED),
+        ("unsupported", ErrorCode.UNSUPPORTED),
+    ],
+    "Tesseract": [
+        ("failed loading language", ErrorCode.UNAVAILABLE),
+        ("tessdata_prefix", ErrorCode.UNAVAILABLE),
+        ("pixreadmem", ErrorCode.CORRUPT),
+        ("unsupported image", ErrorCode.UNSUPPORTED),
+    ],
+}
+
+# 归类后的错误说明
+CODE_REASONS: Dict[ErrorCode, str] = {
+    ErrorCode.ENCRYPTED: "文件已加密",
+    ErrorCode.CORRUPT: "文件已损坏",
+    ErrorCode.UNSUPPORTED: "文件使用了不支持的特性",
+    ErrorCode.UNAVAILABLE: "服务器缺少引擎所需的数据",
+}
+
+
+def classify_engine_output(engine: str, output: str) -> ErrorCode:
+    """
+    按引擎输出归类错误
+
+    Args:
+        engine: 引擎名称
+        output: 引擎的标准错误（或合并的）输出
+
+    Returns:
+        错误代码，无法归类时为INTERNAL
+    """
+    text = output.lower()
+    for pattern, code in ENGINE_PATTERNS.get(engine, []):
+        if pattern in text:
+            return code
+    return ErrorCode.INTERNAL
+
+
+def output_excerpt(output: str) -> str:
+    """引擎输出末尾的摘录，去掉空行"""
+    lines = [line.rstrip() for line in output.strip().splitlines() if line.strip()]
+    excerpt = "\n".join(lines)
+    if len(excerpt) > OUTPUT_EXCERPT_CHARS:
+        excerpt = "…" + excerpt[-OUTPUT_EXCERPT_CHARS:]
+    return excerpt
+
+
+def engine_error(engine: str, returncode: Optional[int], output: str) -> EngineError:
+    """
+    由引擎的退出码和输出生成错误
+
+    Args:
+        engine: 引擎名称
+        returncode: 退出码
+        output: 引擎输出
+
+    Returns:
+        已归类的引擎错误
+    """
+    code = classify_engine_output(engine, output)
+    excerpt = output_excerpt(output)
+    tail = " ".join(excerpt.splitlines()[-3:])
+    reason = CODE_REASONS.get(code)
+    message = f"{engine}处理失败（{reason}）: {tail}" if reason else f"{engine}处理失败: {tail}"
+    return EngineError(message, code, engine, returncode, excerpt)
@@ -0,0 +1,160 @@
+"""
+模拟拆分引擎
+SPLIT_ENGINE=fake 时使用：不读取原文件，按章节页数生成内容确定的合成PDF，每章按配置耗时，
+并按任务ID和章节序号确定哪些章节或任务失败。前端联调和集成测试可以用很小的文件覆盖进度、
+部分失败、任务失败和取消等路径，相同任务ID和种子每次结果相同
+"""
+
+import asyncio
+import hashlib
+import fitz  # PyMuPDF
+from typing import List, Callable, Optional
+from pathlib import Path
+
+from loguru import logger
+
+from ..models.schemas import ChapterInfo, ManifestEntry, OutputManifest, WarningCode
+from ..core.config import settings
+from ..core.diagnostics import add_warning
+from .archive_service import ArchiveBuilder
+from .pdf_splitter import PDFSplitter, BUNDLE_FILENAME, DEFAULT_FILENAME_TEMPLATE, MANIFEST_FILENAME
+
+
+class FakeSplitter(PDFSplitter):
+    """模拟拆分引擎，输出格式（章节文件、清单、打包）与真实引擎一致"""
+
+    async def split_pdf(
+        self,
+        input_path: str,
+        chapters: List[ChapterInfo],
+        output_dir: str,
+        progress_callback: Optional[Callable[[int], None]] = None,
+        chapter_callback: Optional[Callable[[int, ChapterInfo, Optional[str], Optional[str]], None]] = None,
+        filename_template: str = DEFAULT_FILENAME_TEMPLATE,
+        bundle: bool = False,
+        task_id: Optional[str] = None,
+        cache_key: Optional[str] = None,
+        **options
+    ) -> List[str]:
+        """
+        生成模拟的章节输出，不支持的处理选项被忽略
+
+        Args:
+            input_path: 输入PDF文件路径，只用于日志和确定失败
+            chapters: 章节列表
+            output_dir: 输出目录
+            progress_callback: 进度回调函数
+            chapter_callback: 单章完成回调，参数为(序号, 章节, 文件名, 错误信息)
+            filename_template: 章节文件名模板
+            bundle: 是否同时生成chapters.zip
+            task_id: 拆分任务ID，与FAKE_ENGINE_SEED一起决定失败的章节和任务
+            cache_key: 输出缓存键，全部章节成功时记入清单
+
+        Returns:
+            生成的文件路径列表
+
+        Raises:
+            RuntimeError: 任务被选中整体失败时，在拆分到一半时抛出
+        """
+        archive = None
+        try:
+            logger.warning(f"使用模拟拆分引擎: {input_path}")
+
+            output_path = Path(output_dir)
+            output_path.mkdir(parents=True, exist_ok=True)
+            (output_path / BUNDLE_FILENAME).unlink(missing_ok=True)
+            archive = ArchiveBuilder(output_path / BUNDLE_FILENAME) if bundle else None
+
+            run_key = task_id or input_path
+            fail_task = self._roll(run_key, "task", settings.FAKE_ENGINE_TASK_FAILURE_RATE)
+            download_links = []
+            manifest = OutputManifest()
+            total_chapters = len(chapters)
+            failed = 0
+
+            for i, chapter in enumerate(chapters):
+                # 模拟处理耗时，取消时在此停止
+                await asyncio.sleep(settings.FAKE_ENGINE_CHAPTER_DELAY)
+                if fail_task and i >= total_chapters // 2:
+                    raise RuntimeError(f"模拟引擎按配置使任务失败（第 {i + 1} 章）")
+                try:
+                    if i + 1 in settings.FAKE_ENGINE_FAIL_CHAPTERS or self._roll(
+                        run_key, str(i + 1), settings.FAKE_ENGINE_CHAPTER_FAILURE_RATE
+                    ):
+                        raise RuntimeError("模拟引擎按配置使章节失败")
+
+                    filename = self._render_filename(filename_template, i + 1, chapter)
+                    if filename in download_links:
+                        filename = f"{filename[:-4]}_{i+1}.pdf"
+                    file_path = output_path / filename
+                    page_count = self._write_chapter(file_path, i + 1, chapter)
+
+                    if archive:
+                        archive.add(file_path, filename)
+                    download_links.append(filename)
+                    manifest.files.append(ManifestEntry(
+                        filename=filename,
+                        title=chapter.title,
+                        start_page=chapter.start_page,
+                        end_page=chapter.end_page,
+                        pages=page_count,
+                        size=file_path.stat().st_size,
+                        sha256=self._file_sha256(file_path)
+                    ))
+
+                    if progress_callback:
+                        progress_callback(int((i + 1) / total_chapters * 100))
+                    if chapter_callback:
+                        chapter_callback(i + 1, chapter, filename, None)
+
+                except Exception as e:
+                    logger.error(f"拆分章节失败: {chapter.title} - {str(e)}")
+                    add_warning(
+                        WarningCode.CHAPTER_FAILED,
+                        f"章节“{chapter.title}”拆分失败，已跳过: {str(e)}",
+                        chapter=i + 1,
+                        title=chapter.title,
+                        error=str(e)
+                    )
+                    if chapter_callback:
+                        chapter_callback(i + 1, chapter, None, str(e))
+                    failed += 1
+
+            if not failed:
+                manifest.cache_key = cache_key
+            self._write_manifest(output_path, manifest)
+
+            if archive:
+                archive.add(output_path / MANIFEST_FILENAME, MANIFEST_FILENAME)
+                archive.finish()
+
+            logger.info(f"模拟拆分完成: 生成 {len(download_links)} 个文件")
+            return download_links
+
+        except Exception as e:
+            logger.error(f"PDF拆分失败: {str(e)}")
+            if archive:
+                archive.abort()
+            raise
+
+    @staticmethod
+    def _roll(run_key: str, item: str, rate: float) -> bool:
+        """按种子、任务和项目确定是否命中失败比例，相同输入结果相同"""
+        if rate <= 0:
+            return False
+        digest = hashlib.sha256(f"{settings.FAKE_ENGINE_SEED}:{run_key}:{item}".encode()).digest()
+        return int.from_bytes(digest[:8], "big") / 2 ** 64 < rate
+
+    @staticmethod
+    def _write_chapter(file_path: Path, index: int, chapter: ChapterInfo) -> int:
+        """写入每页印有章节标题和原页码的合成PDF，不写入时间和随机ID，相同章节内容相同"""
+        doc = fitz.open()
+        for page_num in range(chapter.start_page, chapter.end_page + 1):
+            page = doc.new_page()
+            page.insert_text((72, 72), f"Chapter {index}", fontsize=18)
+            page.insert_text((72, 108), f"Page {page_num}", fontsize=12)
+        doc.set_metadata({"title": chapter.title})
+        doc.save(str(file_path), garbage=4, no_new_id=True)
+        page_count = len(doc)
+        doc.close()
+        return page_count
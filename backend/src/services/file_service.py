@@ -3,37 +3,254 @@
 """
 
 import os
+import asyncio
+import errno
 import json
 import shutil
-from typing import Optional, List
+import hashlib
+import zipfile
+from dataclasses import dataclass
+from typing import BinaryIO, Dict, Optional, List, Tuple, Union
 from datetime import datetime
 from uuid import uuid4
-from pathlib import Path
+from pathlib import Path, PurePosixPath
 
 from fastapi import UploadFile, HTTPException
 from loguru import logger
 
-from ..models.schemas import FileInfo, FileStatus
+from ..models.schemas import ChapterInfo, DownloadStats, FileInfo, FileStatus, OutputManifest, RepairReport, SavedChapters
+from ..core.auth import get_current_principal
 from ..core.config import settings
+from ..core.errors import ConflictError, QuotaExceededError
+from ..core.memory import buffer_pool
+from ..core.tenancy import (
+    EPHEMERAL_DIRNAME,
+    EPHEMERAL_PREFIX,
+    file_storage_dir,
+    get_current_tenant,
+    is_ephemeral_file,
+    is_valid_file_id,
+    tenant_storage_dir
+)
+from ..core.store import get_store
+from .pdf_splitter import BUNDLE_FILENAME, MANIFEST_FILENAME
+from .output_store import output_store
+from .repair_service import repair_service
+from .retention import ephemeral_expires_at, original_expires_at, outputs_downloaded, outputs_expires_at
+from .document_title import extract_title_author, suggest_display_name
+from .metadata_service import detect_identifiers, metadata_service
+from .signatures import count_signatures
+
+
+# 文件元数据的存储bucket
+FILES_BUCKET = "files"
+# 人工编辑章节的存储bucket
+CHAPTER_EDITS_BUCKET = "chapter_edits"
+# 连续引擎崩溃次数的存储bucket，按文件内容哈希计数，重新上传同一文件不会清零
+ENGINE_FAILURES_BUCKET = "engine_failures"
+# 修复后的副本文件名，存在时代替原文件参与分析和拆分
+REPAIRED_FILENAME = "repaired.pdf"
+# 读取时按保留策略计算、不持久化的字段
+COMPUTED_FIELDS = {"original_expires_at", "outputs_expires_at"}
+# 隐私模式的文件不写入元数据存储，记录保存在文件目录中的JSON文件，按bucket命名
+EPHEMERAL_RECORD_SUFFIX = ".json"
+# 单个标签的最大长度和每个文件的标签数上限
+MAX_TAG_LENGTH = 50
+MAX_TAGS_PER_FILE = 50
+
+
+def normalize_tags(tags: List[str]) -> List[str]:
+    """
+    去除首尾和重复的空白，忽略大小写去重，保持原顺序
+    
+    Raises:
+        ValueError: 标签为空或过长
+    """
+    result = []
+    for tag in tags:
+        tag = " ".join(tag.split())
+        if not tag:
+            raise ValueError("标签不能为空")
+        if len(tag) > MAX_TAG_LENGTH:
+            raise ValueError(f"标签超过 {MAX_TAG_LENGTH} 个字符: {tag}")
+        if not any(existing.casefold() == tag.casefold() for existing in result):
+            result.append(tag)
+    return result
+
+
+def _matches(info: FileInfo, tag: Optional[str], collection: Optional[str]) -> bool:
+    """文件是否带有标签（忽略大小写）且位于目录或其子目录中"""
+    if tag and not any(existing.casefold() == tag.strip().casefold() for existing in info.tags):
+        return False
+    if collection:
+        folder = collection.strip("/")
+        return info.collection is not None and (info.collection == folder or info.collection.startswith(f"{folder}/"))
+    return True
+
+
+def source_pdf_path(file_dir: Path) -> Path:
+    """分析和拆分使用的PDF：有修复副本时使用副本，否则为原文件"""
+    repaired = file_dir / REPAIRED_FILENAME
+    return repaired if repaired.exists() else file_dir / "original.pdf"
+
+
+class UploadWriter:
+    """分块写入上传数据，写入时校验PDF文件头和大小并计算SHA-256，数据只落盘一次"""
+    
+    def __init__(self, file_path: Path):
+        self.file_path = file_path
+        self.size = 0
+        self._header = b""
+        self._digest = hashlib.sha256()
+        self._out = open(file_path, "wb")
+    
+    def write(self, data) -> None:
+        """
+        写入一块数据
+        
+        Raises:
+            HTTPException: 文件头不是PDF（400）或超过大小上限（413）
+        """
+        # 文件头可能被拆在多个块中
+        if len(self._header) < 4:
+            self._header += bytes(data[:4 - len(self._header)])
+            if not b"%PDF".startswith(self._header):
+                raise HTTPException(
+                    status_code=400,
+                    detail="文件格式无效，请上传有效的PDF文件"
+                )
+        
+        self.size += len(data)
+        if self.size > settings.MAX_FILE_SIZE:
+            raise HTTPException(
+                status_code=413,
+                detail=f"文件大小超过限制 ({settings.MAX_FILE_SIZE} 字节)"
+            )
+        
+        self._digest.update(data)
+        self._out.write(data)
+    
+    def finish(self) -> Tuple[int, str]:
+        """
+        关闭文件
+        
+        Returns:
+            文件大小和SHA-256的元组
+        """
+        self.close()
+        if self._header != b"%PDF":
+            raise HTTPException(
+                status_code=400,
+                detail="文件格式无效，请上传有效的PDF文件"
+            )
+        return self.size, self._digest.hexdigest()
+    
+    def close(self) -> None:
+        """关闭文件，可重复调用"""
+        self._out.close()
+
+
+class PlacedData:
+    """已完整写入磁盘的数据（如分段上传会话的临时文件），在原位置校验，接口与UploadWriter一致"""
+    
+    def __init__(self, file_path: Path, size: int, sha256: str):
+        self.file_path = file_path
+        self.size = size
+        self._sha256 = sha256
+    
+    def finish(self) -> Tuple[int, str]:
+        """
+        校验文件头和大小
+        
+        Returns:
+            文件大小和SHA-256的元组
+        """
+        with open(self.file_path, "rb") as f:
+            header = f.read(4)
+        if header != b"%PDF":
+            raise HTTPException(
+                status_code=400,
+                detail="文件格式无效，请上传有效的PDF文件"
+            )
+        if self.size > settings.MAX_FILE_SIZE:
+            raise HTTPException(
+                status_code=413,
+                detail=f"文件大小超过限制 ({settings.MAX_FILE_SIZE} 字节)"
+            )
+        return self.size, self._sha256
+    
+    def close(self) -> None:
+        """没有打开的文件"""
+
+
+@dataclass
+class PendingUpload:
+    """已分配文件ID、正在写入的上传"""
+    file_id: str
+    file_dir: Path
+    filename: str
+    writer: Union[UploadWriter, PlacedData]
+
+
+class UploadPart:
+    """一次上传多个文件时的单个文件，开始或写入失败时记录错误并丢弃之后的数据，不影响同一请求中的其他文件"""
+    
+    def __init__(self, service: "FileService", filename: str, ephemeral: bool = False):
+        self.filename = filename
+        self.upload: Optional[PendingUpload] = None
+        self.error: Optional[HTTPException] = None
+        self._service = service
+        try:
+            self.upload = service.begin_upload(filename, ephemeral)
+        except HTTPException as e:
+            self.error = e
+    
+    def write(self, data) -> None:
+        """写入一块数据，已失败时丢弃"""
+        if self.upload is None:
+            return
+        try:
+            self.upload.writer.write(data)
+        except HTTPException as e:
+            self.error = e
+            self.abort()
+    
+    def abort(self) -> None:
+        """放弃尚未完成的上传"""
+        self._service.abort_upload(self.upload)
+        self.upload = None
 
 
 class FileService:
     """文件管理服务"""
     
     def __init__(self):
-        self.upload_dir = Path(settings.UPLOAD_DIR)
         self.temp_dir = Path(settings.TEMP_DIR)
         
         # 确保目录存在
-        self.upload_dir.mkdir(parents=True, exist_ok=True)
+        Path(settings.UPLOAD_DIR).mkdir(parents=True, exist_ok=True)
         self.temp_dir.mkdir(parents=True, exist_ok=True)
     
-    async def save_uploaded_file(self, file: UploadFile) -> FileInfo:
+    @property
+    def upload_dir(self) -> Path:
+        """当前租户的存储目录"""
+        upload_dir = tenant_storage_dir()
+        upload_dir.mkdir(parents=True, exist_ok=True)
+        return upload_dir
+    
+    async def save_uploaded_file(
+        self,
+        file: UploadFile,
+        expected_sha256: Optional[str] = None,
+        ephemeral: bool = False
+    ) -> FileInfo:
         """
         保存上传的文件
         
         Args:
             file: 上传的文件
+            expected_sha256: 客户端提供的SHA-256，与写入的数据不一致时拒绝
+            ephemeral: 是否按隐私模式保存（全局开启EPHEMERAL_MODE时始终为隐私模式）
             
         Returns:
             文件信息
@@ -46,57 +263,421 @@ class FileService:
                     detail="仅支持PDF文件格式"
                 )
             
-            # 读取文件内容
-            content = await file.read()
+            file_info = await self._save_pdf_stream(file.file, file.filename, expected_sha256, ephemeral)
             
-            # 验证文件大小
-            if len(content) > settings.MAX_FILE_SIZE:
-                raise HTTPException(
-                    status_code=413,
-                    detail=f"文件大小超过限制 ({settings.MAX_FILE_SIZE} 字节)"
-                )
+            logger.info(f"文件上传成功: {file_info.file_id} - {file.filename}")
+            return file_info
             
-            # 验证PDF文件头
-            if not content.startswith(b'%PDF'):
-                raise HTTPException(
-                    status_code=400,
-                    detail="文件格式无效，请上传有效的PDF文件"
-                )
+        except HTTPException:
+            raise
+        except Exception as e:
+            logger.error(f"文件上传失败: {str(e)}")
+            raise HTTPException(
+                status_code=500,
+                detail=f"文件上传失败: {str(e)}"
+            )
+    
+    async def save_pdf_stream(self, stream: BinaryIO, filename: str) -> FileInfo:
+        """
+        保存来自其他来源（如云盘导入）的PDF数据流，校验规则与上传一致
+        
+        Args:
+            stream: PDF数据流
+            filename: 文件名
             
-            # 生成文件ID和目录
-            file_id = str(uuid4())
-            file_dir = self.upload_dir / file_id
-            file_dir.mkdir(parents=True, exist_ok=True)
+        Returns:
+            文件信息
+        """
+        if not filename.lower().endswith('.pdf'):
+            raise HTTPException(
+                status_code=400,
+                detail="仅支持PDF文件格式"
+            )
+        
+        file_info = await self._save_pdf_stream(stream, filename)
+        logger.info(f"文件导入成功: {file_info.file_id} - {filename}")
+        return file_info
+    
+    async def save_uploaded_archive(
+        self,
+        file: UploadFile,
+        max_total_bytes: Optional[int] = None
+    ) -> Tuple[List[FileInfo], List[Tuple[str, str]]]:
+        """
+        保存批量上传的ZIP压缩包，逐个条目按单文件上传的规则校验，条目所在目录记为文件的collection
+        
+        Args:
+            file: 上传的ZIP文件
+            max_total_bytes: 剩余存储配额，解压后总大小超过时整体拒绝，为空表示不限制
             
-            # 保存原始文件
-            file_path = file_dir / "original.pdf"
-            with open(file_path, "wb") as f:
-                f.write(content)
-            
-            # 创建文件信息
-            file_info = FileInfo(
-                file_id=file_id,
-                filename=file.filename,
-                file_size=len(content),
-                file_path=str(file_path),
-                upload_time=datetime.now(),
-                status=FileStatus.UPLOADED
+        Returns:
+            成功保存的文件信息列表，以及失败条目的(条目名, 原因)列表
+            
+        Raises:
+            QuotaExceededError: 解压后总大小超过剩余配额
+        """
+        if not file.filename.lower().endswith('.zip'):
+            raise HTTPException(
+                status_code=400,
+                detail="批量上传仅支持ZIP压缩包"
             )
+        
+        archive_path = self.temp_dir / f"{uuid4()}.zip"
+        try:
+            self.copy_with_limit(file.file, archive_path, settings.MAX_ARCHIVE_SIZE)
             
-            # 保存元数据
-            await self._save_file_metadata(file_info)
+            try:
+                archive = zipfile.ZipFile(archive_path)
+            except zipfile.BadZipFile:
+                raise HTTPException(status_code=400, detail="压缩包格式无效")
             
-            logger.info(f"文件上传成功: {file_id} - {file.filename}")
-            return file_info
+            with archive:
+                entries = self.validate_archive(archive)
+                total_size = sum(entry.file_size for entry, _ in entries)
+                if max_total_bytes is not None and total_size > max_total_bytes:
+                    raise QuotaExceededError(f"压缩包解压后 {total_size} 字节，超出剩余存储配额 {max_total_bytes} 字节")
+                
+                saved: List[FileInfo] = []
+                failed: List[Tuple[str, str]] = []
+                for entry, filename in entries:
+                    try:
+                        if not filename.lower().endswith('.pdf'):
+                            raise HTTPException(status_code=400, detail="仅支持PDF文件格式")
+                        
+                        # ZipExtFile最多输出条目声明的大小，并在结束时校验CRC，
+                        # 声明大小已通过压缩比和总量检查，伪造的头信息无法绕过限制
+                        with archive.open(entry) as stream:
+                            saved.append(await self._save_pdf_stream(
+                                stream, filename, collection=self._entry_folder(entry.filename)
+                            ))
+                    except HTTPException as e:
+                        failed.append((entry.filename, e.detail))
+                    except Exception as e:
+                        failed.append((entry.filename, str(e)))
             
-        except HTTPException:
+            logger.info(f"批量上传完成: {file.filename} - 成功 {len(saved)} 个，失败 {len(failed)} 个")
+            return saved, failed
+            
+        except (HTTPException, QuotaExceededError):
             raise
         except Exception as e:
-            logger.error(f"文件上传失败: {str(e)}")
+            logger.error(f"批量上传失败: {str(e)}")
             raise HTTPException(
                 status_code=500,
-                detail=f"文件上传失败: {str(e)}"
+                detail=f"批量上传失败: {str(e)}"
             )
+        finally:
+            archive_path.unlink(missing_ok=True)
+    
+    @classmethod
+    def validate_archive(cls, archive: zipfile.ZipFile) -> List[Tuple[zipfile.ZipInfo, str]]:
+        """
+        检查压缩包的条目数量、路径、压缩比和解压总量
+        
+        Args:
+            archive: 已打开的压缩包
+            
+        Returns:
+            (条目, 安全文件名)列表，目录条目已排除
+        """
+        entries = [info for info in archive.infolist() if not info.is_dir()]
+        if not entries:
+            raise HTTPException(status_code=400, detail="压缩包中没有文件")
+        if len(entries) > settings.MAX_ARCHIVE_ENTRIES:
+            raise HTTPException(
+                status_code=400,
+                detail=f"压缩包文件数量超过限制 ({settings.MAX_ARCHIVE_ENTRIES} 个)"
+            )
+        
+        result = []
+        total_size = 0
+        for info in entries:
+            filename = cls._safe_entry_name(info.filename)
+            
+            if info.flag_bits & 0x1:
+                raise HTTPException(status_code=400, detail=f"不支持加密的压缩条目: {info.filename}")
+            
+            # 压缩比异常高的条目视为压缩炸弹
+            if info.file_size > 0 and info.file_size / max(info.compress_size, 1) > settings.MAX_COMPRESSION_RATIO:
+                raise HTTPException(status_code=400, detail=f"压缩比异常，疑似压缩炸弹: {info.filename}")
+            
+            total_size += info.file_size
+            if total_size > settings.MAX_ARCHIVE_TOTAL_SIZE:
+                raise HTTPException(
+                    status_code=413,
+                    detail=f"压缩包解压后大小超过限制 ({settings.MAX_ARCHIVE_TOTAL_SIZE} 字节)"
+                )
+            
+            result.append((info, filename))
+        
+        return result
+    
+    @staticmethod
+    def _safe_entry_name(name: str) -> str:
+        """
+        校验压缩条目路径，拒绝绝对路径和目录穿越
+        
+        Args:
+            name: 条目名
+            
+        Returns:
+            条目的文件名部分
+        """
+        normalized = name.replace("\\", "/")
+        parts = PurePosixPath(normalized).parts
+        if (
+            "\0" in normalized
+            or normalized.startswith("/")
+            or (parts and ":" in parts[0])
+            or ".." in parts
+        ):
+            raise HTTPException(status_code=400, detail=f"压缩条目路径非法: {name}")
+        
+        return parts[-1] if parts else name
+    
+    @staticmethod
+    def _entry_folder(name: str) -> Optional[str]:
+        """压缩条目所在的目录（已通过_safe_entry_name校验），位于根目录时为None"""
+        folder = PurePosixPath(name.replace("\\", "/")).parent
+        return None if folder == PurePosixPath(".") else folder.as_posix()
+    
+    @staticmethod
+    def copy_with_limit(stream: BinaryIO, target: Path, max_size: int) -> int:
+        """
+        分块拷贝数据流到文件，超过大小上限时中止
+        
+        Args:
+            stream: 数据流
+            target: 目标路径
+            max_size: 最大字节数
+            
+        Returns:
+            拷贝的字节数
+        """
+        size = 0
+        with buffer_pool.buffer() as buf, open(target, "wb") as out:
+            view = memoryview(buf)
+            while n := stream.readinto(view):
+                size += n
+                if size > max_size:
+                    raise HTTPException(
+                        status_code=413,
+                        detail=f"文件大小超过限制 ({max_size} 字节)"
+                    )
+                out.write(view[:n])
+        return size
+    
+    async def _save_pdf_stream(
+        self,
+        stream: BinaryIO,
+        filename: str,
+        expected_sha256: Optional[str] = None,
+        ephemeral: bool = False,
+        collection: Optional[str] = None
+    ) -> FileInfo:
+        """
+        校验并保存PDF数据流，生成文件ID和元数据
+        
+        Args:
+            stream: PDF数据流
+            filename: 原始文件名
+            expected_sha256: 客户端提供的SHA-256，与写入的数据不一致时拒绝
+            ephemeral: 是否按隐私模式保存在TEMP_DIR，不写入元数据存储
+            collection: 文件所属的目录（批量导入时为压缩包中的目录）
+            
+        Returns:
+            文件信息
+        """
+        upload = self.begin_upload(filename, ephemeral)
+        try:
+            self._stream_to_disk(stream, upload.writer)
+        except Exception:
+            self.abort_upload(upload)
+            raise
+        return await self.finish_upload(upload, expected_sha256, collection=collection)
+    
+    async def adopt_pdf(self, path: Path, filename: str, size: int, sha256: str) -> FileInfo:
+        """
+        把已完整写入磁盘的PDF移动为正式文件，不再复制数据；校验失败时数据被删除
+        
+        Args:
+            path: 数据文件，需与上传目录在同一文件系统
+            filename: 原始文件名
+            size: 文件大小
+            sha256: 写入时计算的SHA-256
+            
+        Returns:
+            文件信息
+        """
+        if not filename.lower().endswith('.pdf'):
+            raise HTTPException(
+                status_code=400,
+                detail="仅支持PDF文件格式"
+            )
+        
+        file_id, file_dir = self._new_upload_dir(False)
+        target = file_dir / "original.pdf.part"
+        try:
+            try:
+                os.replace(path, target)
+            except OSError as e:
+                # 全局隐私模式下正式文件位于TEMP_DIR，可能在其他文件系统
+                if e.errno != errno.EXDEV:
+                    raise
+                shutil.move(str(path), str(target))
+        except Exception:
+            shutil.rmtree(file_dir, ignore_errors=True)
+            raise
+        upload = PendingUpload(file_id, file_dir, filename, PlacedData(target, size, sha256))
+        return await self.finish_upload(upload)
+    
+    def begin_upload(self, filename: str, ephemeral: bool = False) -> "PendingUpload":
+        """
+        生成文件ID和目录，打开写入器；数据写完后调用finish_upload，失败时调用abort_upload
+        
+        Args:
+            filename: 原始文件名
+            ephemeral: 是否按隐私模式保存（全局开启EPHEMERAL_MODE时始终为隐私模式）
+            
+        Returns:
+            待写入的上传
+        """
+        if not filename.lower().endswith('.pdf'):
+            raise HTTPException(
+                status_code=400,
+                detail="仅支持PDF文件格式"
+            )
+        
+        # 先写临时文件再改名，中断的上传不会留下看似完整的original.pdf
+        file_id, file_dir = self._new_upload_dir(ephemeral)
+        return PendingUpload(file_id, file_dir, filename, UploadWriter(file_dir / "original.pdf.part"))
+    
+    @staticmethod
+    def _new_upload_dir(ephemeral: bool) -> Tuple[str, Path]:
+        """生成文件ID并创建目录，隐私模式的ID带前缀，存储位置由ID决定"""
+        ephemeral = ephemeral or settings.EPHEMERAL_MODE
+        file_id = f"{EPHEMERAL_PREFIX}{uuid4()}" if ephemeral else str(uuid4())
+        file_dir = file_storage_dir(file_id)
+        file_dir.mkdir(parents=True, exist_ok=True)
+        return file_id, file_dir
+    
+    def abort_upload(self, upload: Optional["PendingUpload"]) -> None:
+        """放弃未完成的上传并删除已写入的数据"""
+        if upload is None:
+            return
+        upload.writer.close()
+        shutil.rmtree(upload.file_dir, ignore_errors=True)
+    
+    async def finish_upload(
+        self,
+        upload: "PendingUpload",
+        expected_sha256: Optional[str] = None,
+        ephemeral: Optional[bool] = None,
+        collection: Optional[str] = None
+    ) -> FileInfo:
+        """
+        完成写入，校验后生成元数据；失败时删除已写入的数据
+        
+        Args:
+            upload: begin_upload返回的上传
+            expected_sha256: 客户端提供的SHA-256，与写入的数据不一致时拒绝
+            ephemeral: 写入开始后才确定的隐私模式（表单字段在文件之后），与开始时不同则移动到对应位置
+            collection: 文件所属的目录，内容相同的已有文件还没有目录时同样记录
+            
+        Returns:
+            文件信息
+        """
+        try:
+            file_size, file_hash = upload.writer.finish()
+            if expected_sha256 and expected_sha256.lower() != file_hash:
+                raise HTTPException(
+                    status_code=400,
+                    detail=f"文件校验和不一致（收到 {file_hash}），传输可能已损坏，请重新上传"
+                )
+            
+            partial_path = upload.writer.file_path
+            if ephemeral is not None and (ephemeral or settings.EPHEMERAL_MODE) != is_ephemeral_file(upload.file_id):
+                file_id, file_dir = self._new_upload_dir(ephemeral)
+                shutil.move(str(partial_path), str(file_dir / partial_path.name))
+                shutil.rmtree(upload.file_dir, ignore_errors=True)
+                partial_path = file_dir / partial_path.name
+                upload = PendingUpload(file_id, file_dir, upload.filename, upload.writer)
+            
+            file_dir = upload.file_dir
+            file_path = file_dir / "original.pdf"
+            partial_path.replace(file_path)
+        except Exception:
+            self.abort_upload(upload)
+            raise
+        
+        # 内容相同的文件已存在时直接返回，分析结果和拆分输出都可复用；隐私模式不参与去重
+        file_id = upload.file_id
+        if settings.DEDUP_UPLOADS and not is_ephemeral_file(file_id):
+            existing = await self.find_by_hash(file_hash)
+            if existing:
+                shutil.rmtree(file_dir, ignore_errors=True)
+                if collection and not existing.collection:
+                    existing.collection = collection
+                    await self._save_file_metadata(existing)
+                existing.deduplicated = True
+                logger.info(f"上传内容与已有文件相同: {existing.file_id} - {upload.filename}")
+                return existing
+        
+        # 创建文件信息；读取书名、标识符和签名需要解析整个文件，在线程中进行以免阻塞事件循环
+        (title, author), (isbn, doi), signature_count = await asyncio.to_thread(
+            lambda: (
+                extract_title_author(str(file_path)),
+                detect_identifiers(str(file_path)),
+                count_signatures(file_path)
+            )
+        )
+        canonical = await metadata_service.lookup(isbn, doi)
+        if canonical:
+            title, author = canonical.title, canonical.author or author
+        file_info = FileInfo(
+            file_id=file_id,
+            filename=upload.filename,
+            file_size=file_size,
+            file_path=str(file_path),
+            upload_time=datetime.now(),
+            file_hash=file_hash,
+            original_hash=file_hash,
+            status=FileStatus.UPLOADED,
+            signature_count=signature_count,
+            collection=collection,
+            title=title,
+            author=author,
+            display_name=suggest_display_name(title, author, upload.filename),
+            edition=canonical.edition if canonical else None,
+            isbn=isbn,
+            doi=doi,
+            api_key_id=get_current_principal().key_id
+        )
+        if file_info.signature_count:
+            logger.info(f"上传文件包含数字签名: {file_id} - {file_info.signature_count} 个")
+        
+        # 保存元数据
+        await self._save_file_metadata(file_info)
+        
+        if settings.REPAIR_ON_UPLOAD and await asyncio.to_thread(repair_service.needs_repair, file_path):
+            try:
+                file_info, _ = await self.repair_file(file_id)
+            except ValueError as e:
+                logger.warning(f"上传文件自动修复失败: {file_id} - {str(e)}")
+        return file_info
+    
+    def _stream_to_disk(self, stream: BinaryIO, writer: "UploadWriter") -> None:
+        """
+        将数据流分块交给写入器，使用池化缓冲区避免整文件读入内存
+        
+        Args:
+            stream: 数据流
+            writer: 上传写入器
+        """
+        with buffer_pool.buffer() as buf:
+            view = memoryview(buf)
+            while n := stream.readinto(view):
+                writer.write(view[:n])
     
     async def get_file_info(self, file_id: str) -> Optional[FileInfo]:
         """
@@ -109,19 +690,54 @@ class FileService:
             文件信息或None
         """
         try:
-            metadata_path = self.upload_dir / file_id / "metadata.json"
-            
-            if not metadata_path.exists():
-                return None
-            
-            with open(metadata_path, "r", encoding="utf-8") as f:
-                data = json.load(f)
-                return FileInfo(**data)
+            data = await self._get_record(FILES_BUCKET, file_id)
+            return self._with_expiry(FileInfo(**data)) if data else None
                 
         except Exception as e:
             logger.error(f"获取文件信息失败: {str(e)}")
             return None
     
+    async def list_files(self, tag: Optional[str] = None, collection: Optional[str] = None) -> List[FileInfo]:
+        """
+        列出当前租户的文件
+        
+        Args:
+            tag: 只列出带有该标签的文件（忽略大小写）
+            collection: 只列出该目录及其子目录中的文件
+        
+        Returns:
+            按上传时间倒序排列的文件信息
+        """
+        files = []
+        for data in await get_store().avalues(FILES_BUCKET, get_current_tenant()):
+            try:
+                info = FileInfo(**data)
+            except Exception as e:
+                logger.error(f"读取文件信息失败: {data.get('file_id')} - {str(e)}")
+                continue
+            if _matches(info, tag, collection):
+                files.append(self._with_expiry(info))
+        
+        return sorted(files, key=lambda info: info.upload_time, reverse=True)
+    
+    async def find_by_hash(self, file_hash: str) -> Optional[FileInfo]:
+        """
+        按上传内容的SHA-256查找当前租户的文件
+        
+        Args:
+            file_hash: 十六进制哈希
+            
+        Returns:
+            最早上传的相同文件或None
+        """
+        # 原文件已按保留策略删除的记录不再作为重复文件返回
+        matches = [
+            info for info in await self.list_files()
+            if (info.original_hash or info.file_hash) == file_hash
+            and (file_storage_dir(info.file_id) / "original.pdf").exists()
+        ]
+        return matches[-1] if matches else None
+    
     async def get_file_path(self, file_id: str) -> Optional[str]:
         """
         获取文件路径
@@ -132,13 +748,77 @@ class FileService:
         Returns:
             文件路径或None
         """
-        file_path = self.upload_dir / file_id / "original.pdf"
+        if not is_valid_file_id(file_id):
+            return None
+        
+        file_path = source_pdf_path(file_storage_dir(file_id))
         
         if file_path.exists():
             return str(file_path)
         
         return None
     
+    async def get_file_hash(self, file_id: str) -> Optional[str]:
+        """
+        获取文件内容SHA-256，旧文件缺失时计算并回写元数据
+        
+        Args:
+            file_id: 文件ID
+            
+        Returns:
+            十六进制哈希或None
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return None
+        
+        if not file_info.file_hash:
+            file_info.file_hash = self._hash_file(Path(await self.get_file_path(file_id)))
+            await self._save_file_metadata(file_info)
+        
+        return file_info.file_hash
+    
+    @staticmethod
+    def _hash_file(file_path: Path) -> str:
+        """计算文件SHA-256"""
+        digest = hashlib.sha256()
+        with buffer_pool.buffer() as buf, open(file_path, "rb") as f:
+            view = memoryview(buf)
+            while n := f.readinto(view):
+                digest.update(view[:n])
+        return digest.hexdigest()
+    
+    async def repair_file(self, file_id: str) -> Optional[Tuple[FileInfo, RepairReport]]:
+        """
+        从原文件生成修复后的副本，之后的分析和拆分使用副本
+        
+        文件哈希更新为副本的哈希，已缓存的解析结果和分析结果随之失效
+        
+        Args:
+            file_id: 文件ID
+            
+        Returns:
+            (更新后的文件信息, 修复报告)，文件不存在时返回None
+            
+        Raises:
+            ValueError: 文件无法修复
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return None
+        
+        file_dir = file_storage_dir(file_id)
+        tmp_path = file_dir / f".{REPAIRED_FILENAME}.tmp"
+        report = await repair_service.repair(file_dir / "original.pdf", tmp_path)
+        tmp_path.replace(file_dir / REPAIRED_FILENAME)
+        
+        file_info.repaired = True
+        file_info.file_hash = self._hash_file(file_dir / REPAIRED_FILENAME)
+        await self._save_file_metadata(file_info)
+        
+        logger.info(f"生成修复副本: {file_id} - {report.method}，{report.page_count} 页")
+        return file_info, report
+    
     async def get_download_path(self, file_id: str, chapter_name: Optional[str] = None) -> Optional[str]:
         """
         获取下载文件路径
@@ -151,14 +831,24 @@ class FileService:
             下载文件路径或None
         """
         if chapter_name:
-            # 返回特定章节文件
-            chapter_path = self.upload_dir / file_id / "chapters" / chapter_name
-            if chapter_path.exists():
+            # 只接受纯文件名，防止路径穿越
+            if chapter_name in (".", "..") or Path(chapter_name).name != chapter_name:
+                return None
+            
+            # 返回特定章节文件，解析符号链接后必须仍在章节目录中
+            chapters_dir = file_storage_dir(file_id) / "chapters"
+            chapter_path = chapters_dir / chapter_name
+            try:
+                if chapter_path.resolve().parent != chapters_dir.resolve():
+                    return None
+            except OSError:
+                return None
+            if chapter_path.is_file():
                 return str(chapter_path)
         else:
             # 返回原始文件
-            original_path = self.upload_dir / file_id / "original.pdf"
-            if original_path.exists():
+            original_path = file_storage_dir(file_id) / "original.pdf"
+            if original_path.is_file():
                 return str(original_path)
         
         return None
@@ -173,7 +863,8 @@ class FileService:
         Returns:
             章节文件名列表
         """
-        chapters_dir = self.upload_dir / file_id / "chapters"
+        chapters_dir = file_storage_dir(file_id) / "chapters"
+        await self._ensure_outputs(file_id)
         
         if not chapters_dir.exists():
             return []
@@ -190,6 +881,114 @@ class FileService:
             logger.error(f"列出章节文件失败: {str(e)}")
             return []
     
+    async def get_manifest(self, file_id: str) -> Optional[OutputManifest]:
+        """
+        读取章节输出校验清单
+        
+        Args:
+            file_id: 文件ID
+            
+        Returns:
+            校验清单或None
+        """
+        manifest_path = file_storage_dir(file_id) / "chapters" / MANIFEST_FILENAME
+        await self._ensure_outputs(file_id)
+        if not manifest_path.exists():
+            return None
+        
+        try:
+            with open(manifest_path, "r", encoding="utf-8") as f:
+                return OutputManifest(**json.load(f))
+        except Exception as e:
+            logger.error(f"读取校验清单失败: {str(e)}")
+            return None
+    
+    async def _ensure_outputs(self, file_id: str) -> None:
+        """
+        水平扩展模式下本地没有章节输出、或本地副本与共享存储中的版本不一致时，从共享存储拉取到本地；
+        共享存储中的输出已删除时删除本地副本
+        """
+        chapters_dir = file_storage_dir(file_id) / "chapters"
+        if not output_store.enabled or is_ephemeral_file(file_id):
+            return
+        if Path(file_id).name != file_id or not await self.get_file_info(file_id):
+            return
+        
+        has_manifest = (chapters_dir / MANIFEST_FILENAME).exists()
+        local_version = output_store.local_version(chapters_dir)
+        # 本副本刚生成、尚未上传的输出
+        if has_manifest and local_version is None:
+            return
+        
+        try:
+            version = await output_store.manifest_version(get_current_tenant(), file_id)
+            if version is None:
+                if local_version:
+                    shutil.rmtree(chapters_dir, ignore_errors=True)
+                    logger.info(f"共享存储中的章节输出已删除，删除本地副本: {file_id}")
+                return
+            if has_manifest and version == local_version:
+                return
+            await output_store.fetch(get_current_tenant(), file_id, chapters_dir)
+        except Exception as e:
+            logger.error(f"从共享存储拉取章节输出失败: {file_id} - {str(e)}")
+    
+    async def _delete_shared_outputs(self, file_id: str) -> None:
+        """删除共享存储中的章节输出，失败只记录日志"""
+        if not output_store.enabled or is_ephemeral_file(file_id):
+            return
+        try:
+            await output_store.delete(get_current_tenant(), file_id)
+        except Exception as e:
+            logger.error(f"删除共享存储中的章节输出失败: {file_id} - {str(e)}")
+    
+    async def list_archive_members(self, file_id: str, prefix: str = "") -> List[Tuple[Path, str]]:
+        """
+        列出打包下载时包含的章节文件和校验清单
+        
+        Args:
+            file_id: 文件ID
+            prefix: 包内路径前缀（批量打包时按文件分目录）
+            
+        Returns:
+            (文件路径, 包内路径)列表，没有章节文件时为空
+        """
+        chapters_dir = file_storage_dir(file_id) / "chapters"
+        manifest = await self.get_manifest(file_id)
+        if manifest:
+            filenames = [entry.filename for entry in manifest.files]
+        else:
+            filenames = await self.list_chapter_files(file_id)
+        
+        members = [
+            (chapters_dir / name, prefix + name)
+            for name in filenames
+            if (chapters_dir / name).exists()
+        ]
+        if members and manifest:
+            members.append((chapters_dir / MANIFEST_FILENAME, prefix + MANIFEST_FILENAME))
+        
+        return members
+    
+    async def get_bundle_path(self, file_id: str) -> Optional[Path]:
+        """
+        拆分时逐章写入的ZIP打包文件，晚于校验清单写入时才与当前输出一致
+        
+        Args:
+            file_id: 文件ID
+            
+        Returns:
+            打包文件路径，不存在或已过时为None
+        """
+        chapters_dir = file_storage_dir(file_id) / "chapters"
+        bundle_path = chapters_dir / BUNDLE_FILENAME
+        manifest_path = chapters_dir / MANIFEST_FILENAME
+        if not bundle_path.is_file() or not manifest_path.is_file():
+            return None
+        if bundle_path.stat().st_mtime < manifest_path.stat().st_mtime:
+            return None
+        return bundle_path
+    
     async def update_file_status(self, file_id: str, status: FileStatus) -> bool:
         """
         更新文件状态
@@ -215,6 +1014,232 @@ class FileService:
             logger.error(f"更新文件状态失败: {str(e)}")
             return False
     
+    @staticmethod
+    def _engine_failure_key(file_info: FileInfo) -> str:
+        """连续崩溃次数的记录键：文件内容哈希，旧记录没有哈希时使用文件ID"""
+        return file_info.original_hash or file_info.file_hash or file_info.file_id
+    
+    async def record_engine_failure(self, file_id: str, reason: str) -> bool:
+        """
+        记录一次由该文件导致的引擎崩溃，相同内容的连续次数达到QUARANTINE_AFTER_FAILURES时隔离文件
+        
+        计数按文件内容哈希在存储中原子递增，多个副本同时失败时不会丢失
+        
+        Args:
+            file_id: 文件ID
+            reason: 崩溃原因
+            
+        Returns:
+            文件是否因本次崩溃被隔离
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return False
+        
+        def increment(current: Optional[dict]) -> dict:
+            return {"failures": (current or {}).get("failures", 0) + 1, "reason": reason}
+        
+        record = await get_store().aupdate(
+            ENGINE_FAILURES_BUCKET, self._engine_failure_key(file_info), increment, get_current_tenant()
+        )
+        file_info.engine_failures = record["failures"]
+        threshold = settings.QUARANTINE_AFTER_FAILURES
+        quarantined = (
+            threshold > 0
+            and file_info.engine_failures >= threshold
+            and file_info.status != FileStatus.QUARANTINED
+        )
+        if quarantined:
+            self._quarantine(file_info, reason)
+        await self._save_file_metadata(file_info)
+        return quarantined
+    
+    async def check_quarantine(self, file_id: str) -> bool:
+        """
+        文件是否已被隔离；相同内容的文件已达到崩溃上限时（如删除后重新上传）同样隔离该文件
+        
+        Args:
+            file_id: 文件ID
+            
+        Returns:
+            是否已被隔离
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return False
+        if file_info.status == FileStatus.QUARANTINED:
+            return True
+        threshold = settings.QUARANTINE_AFTER_FAILURES
+        if threshold <= 0:
+            return False
+        record = await get_store().aget(ENGINE_FAILURES_BUCKET, self._engine_failure_key(file_info), get_current_tenant())
+        if not record or record.get("failures", 0) < threshold:
+            return False
+        file_info.engine_failures = record["failures"]
+        self._quarantine(file_info, record.get("reason") or "相同内容的文件多次导致处理引擎崩溃")
+        await self._save_file_metadata(file_info)
+        return True
+    
+    @staticmethod
+    def _quarantine(file_info: FileInfo, reason: str) -> None:
+        """把文件标记为隔离，记录隔离前的状态"""
+        file_info.status_before_quarantine = file_info.status
+        file_info.status = FileStatus.QUARANTINED
+        file_info.quarantined_at = datetime.now()
+        file_info.quarantine_reason = reason
+        logger.warning(f"文件连续 {file_info.engine_failures} 次导致引擎崩溃，已隔离: {file_info.file_id} - {reason}")
+    
+    async def clear_engine_failures(self, file_id: str) -> None:
+        """
+        成功拆分后清零连续崩溃次数
+        
+        Args:
+            file_id: 文件ID
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return
+        await get_store().adelete(ENGINE_FAILURES_BUCKET, self._engine_failure_key(file_info), get_current_tenant())
+        if file_info.engine_failures:
+            file_info.engine_failures = 0
+            await self._save_file_metadata(file_info)
+    
+    async def release_quarantine(self, file_id: str) -> Optional[FileInfo]:
+        """
+        解除文件隔离，恢复隔离前的状态，相同内容的连续崩溃次数清零
+        
+        Args:
+            file_id: 文件ID
+            
+        Returns:
+            更新后的文件信息，文件不存在时为None
+            
+        Raises:
+            ConflictError: 文件未被隔离
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return None
+        if file_info.status != FileStatus.QUARANTINED:
+            raise ConflictError("文件未被隔离")
+        
+        await get_store().adelete(ENGINE_FAILURES_BUCKET, self._engine_failure_key(file_info), get_current_tenant())
+        file_info.status = file_info.status_before_quarantine or FileStatus.UPLOADED
+        file_info.status_before_quarantine = None
+        file_info.engine_failures = 0
+        file_info.quarantined_at = None
+        file_info.quarantine_reason = None
+        await self._save_file_metadata(file_info)
+        logger.info(f"已解除文件隔离: {file_id}")
+        return file_info
+    
+    async def set_page_offset(self, file_id: str, page_offset: int) -> Optional[FileInfo]:
+        """
+        保存印刷页码偏移量
+        
+        Args:
+            file_id: 文件ID
+            page_offset: 偏移量（物理页 = 印刷页 + 偏移量）
+            
+        Returns:
+            更新后的文件信息，文件不存在时返回None
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return None
+        
+        file_info.page_offset = page_offset
+        await self._save_file_metadata(file_info)
+        
+        logger.info(f"更新印刷页码偏移量: {file_id} - {page_offset}")
+        return file_info
+    
+    async def add_tags(self, file_id: str, tags: List[str]) -> Optional[FileInfo]:
+        """
+        为文件添加标签，已有的标签（忽略大小写）忽略
+        
+        Args:
+            file_id: 文件ID
+            tags: 标签
+            
+        Returns:
+            更新后的文件信息，文件不存在时返回None
+            
+        Raises:
+            ValueError: 标签为空、过长或超过数量上限
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return None
+        
+        merged = normalize_tags(file_info.tags + tags)
+        if len(merged) > MAX_TAGS_PER_FILE:
+            raise ValueError(f"每个文件最多 {MAX_TAGS_PER_FILE} 个标签")
+        file_info.tags = merged
+        await self._save_file_metadata(file_info)
+        
+        logger.info(f"添加文件标签: {file_id} - {tags}")
+        return file_info
+    
+    async def remove_tag(self, file_id: str, tag: str) -> Optional[FileInfo]:
+        """
+        删除文件的标签（忽略大小写），没有该标签时不做修改
+        
+        Args:
+            file_id: 文件ID
+            tag: 标签
+            
+        Returns:
+            更新后的文件信息，文件不存在时返回None
+        """
+        file_info = await self.get_file_info(file_id)
+        if not file_info:
+            return None
+        
+        remaining = [existing for existing in file_info.tags if existing.casefold() != tag.strip().casefold()]
+        if len(remaining) != len(file_info.tags):
+            file_info.tags = remaining
+            await self._save_file_metadata(file_info)
+            logger.info(f"删除文件标签: {file_id} - {tag}")
+        return file_info
+    
+    async def list_tags(self) -> Dict[str, int]:
+        """
+        当前租户使用的标签及文件数，大小写不同的标签合并，按首次出现的写法返回
+        
+        Returns:
+            标签到文件数的映射，按文件数倒序
+        """
+        counts: Dict[str, int] = {}
+        names: Dict[str, str] = {}
+        for info in await self.list_files():
+            for tag in info.tags:
+                key = names.setdefault(tag.casefold(), tag)
+                counts[key] = counts.get(key, 0) + 1
+        return dict(sorted(counts.items(), key=lambda item: (-item[1], item[0])))
+    
+    async def save_chapter_edits(self, file_id: str, chapters: List[ChapterInfo]) -> SavedChapters:
+        """
+        保存人工编辑的章节，覆盖之前的编辑
+        
+        Args:
+            file_id: 文件ID
+            chapters: 章节列表
+            
+        Returns:
+            保存的编辑
+        """
+        edits = SavedChapters(file_id=file_id, chapters=chapters, updated_by=get_current_principal().user)
+        await self._put_record(CHAPTER_EDITS_BUCKET, file_id, edits.model_dump(mode="json"))
+        
+        logger.info(f"保存人工章节编辑: {file_id} - {len(chapters)} 个章节")
+        return edits
+    
+    async def get_chapter_edits(self, file_id: str) -> Optional[SavedChapters]:
+        """获取已保存的人工章节编辑，未保存时返回None"""
+        data = await self._get_record(CHAPTER_EDITS_BUCKET, file_id)
+        return SavedChapters(**data) if data else None
+    
     async def cleanup_temp_files(self, max_age_hours: int = 24) -> int:
         """
         清理临时文件
@@ -243,6 +1268,198 @@ class FileService:
             logger.error(f"清理临时文件失败: {str(e)}")
             return 0
     
+    async def record_download(self, file_id: str, filenames: List[str]) -> None:
+        """
+        记录文件被下载，统计失败不影响下载
+        
+        Args:
+            file_id: 文件ID
+            filenames: 下载的文件名，原文件为 original.pdf，打包下载时为全部成员
+        """
+        try:
+            file_info = await self.get_file_info(file_id)
+            if not file_info or not filenames:
+                return
+            
+            now = datetime.now()
+            for filename in filenames:
+                stats = file_info.downloads.setdefault(filename, DownloadStats())
+                stats.count += 1
+                stats.last_accessed = now
+            file_info.download_count += len(filenames)
+            file_info.last_accessed = now
+            await self._save_file_metadata(file_info)
+            
+        except Exception as e:
+            logger.error(f"记录下载统计失败: {file_id} - {str(e)}")
+    
+    async def get_download_summary(self) -> dict:
+        """
+        汇总当前租户的下载统计
+        
+        Returns:
+            下载总次数、有下载记录的文件数、已拆分但输出从未被下载的文件数和最后下载时间
+        """
+        files = await self.list_files()
+        never_downloaded = sum(
+            1 for info in files
+            if self._outputs_generated_at(info.file_id) and not outputs_downloaded(info)
+        )
+        
+        accessed = [info.last_accessed for info in files if info.last_accessed]
+        return {
+            "total_downloads": sum(info.download_count for info in files),
+            "downloaded_files": sum(1 for info in files if info.download_count),
+            "never_downloaded_outputs": never_downloaded,
+            "last_accessed": max(accessed) if accessed else None
+        }
+    
+    def _outputs_generated_at(self, file_id: str) -> Optional[datetime]:
+        """章节输出的生成时间（校验清单的修改时间），没有输出时为None"""
+        manifest_path = file_storage_dir(file_id) / "chapters" / MANIFEST_FILENAME
+        if not manifest_path.exists():
+            return None
+        return datetime.fromtimestamp(manifest_path.stat().st_mtime)
+    
+    def _with_expiry(self, file_info: FileInfo) -> FileInfo:
+        """按当前租户的保留策略填写到期时间"""
+        if is_ephemeral_file(file_info.file_id):
+            file_info.original_expires_at = file_info.outputs_expires_at = ephemeral_expires_at(file_info)
+            return file_info
+        original_exists = (file_storage_dir(file_info.file_id) / "original.pdf").exists()
+        file_info.original_expires_at = original_expires_at(file_info) if original_exists else None
+        file_info.outputs_expires_at = outputs_expires_at(file_info, self._outputs_generated_at(file_info.file_id))
+        return file_info
+    
+    async def cleanup_outputs(self) -> int:
+        """
+        按当前租户的保留策略清理章节输出，原文件保留时可重新拆分
+        
+        从未被下载的输出优先清理
+        
+        Returns:
+            清理的文件数
+        """
+        now = datetime.now()
+        expired = [
+            info for info in await self.list_files()
+            if info.outputs_expires_at and info.outputs_expires_at <= now
+        ]
+        expired.sort(key=lambda info: (outputs_downloaded(info), info.outputs_expires_at))
+        
+        cleaned_count = 0
+        for info in expired:
+            try:
+                shutil.rmtree(file_storage_dir(info.file_id) / "chapters")
+                await self._delete_shared_outputs(info.file_id)
+                cleaned_count += 1
+                logger.info(f"清理过期章节输出: {info.file_id}（{'已下载' if outputs_downloaded(info) else '从未下载'}）")
+            except Exception as e:
+                logger.error(f"清理章节输出失败: {info.file_id} - {str(e)}")
+            
+            # 原文件已删除时，输出清理后不再保留文件记录
+            if not (file_storage_dir(info.file_id) / "original.pdf").exists():
+                await self.delete_file(info.file_id)
+        
+        return cleaned_count
+    
+    async def cleanup_originals(self) -> int:
+        """
+        按当前租户的保留策略删除原文件和修复副本，章节输出按各自的保留时长保留
+        
+        Returns:
+            删除的原文件数
+        """
+        now = datetime.now()
+        cleaned_count = 0
+        for info in await self.list_files():
+            if not info.original_expires_at or info.original_expires_at > now:
+                continue
+            
+            file_dir = file_storage_dir(info.file_id)
+            try:
+                # 水平扩展模式下输出可能只在共享存储中，仍在保留期内时不能随原文件删除
+                has_outputs = (file_dir / "chapters").exists()
+                if not has_outputs and output_store.enabled and not is_ephemeral_file(info.file_id):
+                    has_outputs = await output_store.manifest_version(get_current_tenant(), info.file_id) is not None
+                if not has_outputs:
+                    await self.delete_file(info.file_id)
+                else:
+                    (file_dir / "original.pdf").unlink(missing_ok=True)
+                    (file_dir / REPAIRED_FILENAME).unlink(missing_ok=True)
+                cleaned_count += 1
+                logger.info(f"清理过期原文件: {info.file_id}")
+            except Exception as e:
+                logger.error(f"清理原文件失败: {info.file_id} - {str(e)}")
+        
+        return cleaned_count
+    
+    async def purge_expired_ephemeral(self) -> List[str]:
+        """
+        删除超过EPHEMERAL_TTL_MINUTES仍未被打包下载的隐私模式文件（全部租户）
+        
+        Returns:
+            删除的文件ID列表，用于同时清理对应的任务记录
+        """
+        purged = []
+        root = Path(settings.TEMP_DIR) / EPHEMERAL_DIRNAME
+        if not root.exists():
+            return purged
+        
+        cutoff = datetime.now().timestamp() - settings.EPHEMERAL_TTL_MINUTES * 60
+        for file_dir in root.glob("*/*"):
+            if not file_dir.is_dir():
+                continue
+            # 以上传时间为准，上传中断没有元数据记录时按目录时间
+            record_path = file_dir / f"{FILES_BUCKET}{EPHEMERAL_RECORD_SUFFIX}"
+            try:
+                with open(record_path, "r", encoding="utf-8") as f:
+                    started = datetime.fromisoformat(json.load(f)["upload_time"]).timestamp()
+            except Exception:
+                started = file_dir.stat().st_mtime
+            if started >= cutoff:
+                continue
+            
+            try:
+                shutil.rmtree(file_dir)
+                purged.append(file_dir.name)
+                logger.info(f"清理过期的隐私模式文件: {file_dir.parent.name}/{file_dir.name}")
+            except Exception as e:
+                logger.error(f"清理隐私模式文件失败: {file_dir.name} - {str(e)}")
+        
+        return purged
+    
+    async def get_storage_usage(self, api_key_id: Optional[str] = None) -> int:
+        """
+        统计当前租户存储目录占用的字节数
+        
+        Args:
+            api_key_id: 只统计该签发Key上传的文件（含其章节输出）
+            
+        Returns:
+            已用字节数
+        """
+        if api_key_id:
+            file_ids = [
+                data["file_id"] for data in await get_store().avalues(FILES_BUCKET, get_current_tenant())
+                if data.get("api_key_id") == api_key_id
+            ]
+            dirs = [file_storage_dir(file_id) for file_id in file_ids]
+            sizes = await asyncio.to_thread(lambda: [self._directory_size(path) for path in dirs if path.is_dir()])
+            return sum(sizes)
+        
+        # 遍历目录耗时与文件数成正比，放到线程中执行
+        return await asyncio.to_thread(self._directory_size, self.upload_dir)
+    
+    @staticmethod
+    def _directory_size(upload_dir: Path) -> int:
+        """统计目录下文件的总大小"""
+        total = 0
+        for path in upload_dir.rglob("*"):
+            if path.is_file():
+                total += path.stat().st_size
+        return total
+    
     async def delete_file(self, file_id: str) -> bool:
         """
         删除文件及其相关数据
@@ -253,15 +1470,25 @@ class FileService:
         Returns:
             是否成功
         """
+        # 只删除有元数据记录的文件目录，其他ID（包括存储目录名）在访问文件系统之前拒绝
+        if not is_valid_file_id(file_id):
+            return False
+        
         try:
-            file_dir = self.upload_dir / file_id
+            if await self._get_record(FILES_BUCKET, file_id) is None:
+                return False
+            
+            file_dir = file_storage_dir(file_id)
+            
+            # 其他副本可能只有共享存储中的输出，本地没有文件目录时同样删除
+            await self._delete_shared_outputs(file_id)
             
             if file_dir.exists():
                 shutil.rmtree(file_dir)
-                logger.info(f"删除文件: {file_id}")
-                return True
-            
-            return False
+            await get_store().adelete(FILES_BUCKET, file_id, get_current_tenant())
+            await get_store().adelete(CHAPTER_EDITS_BUCKET, file_id, get_current_tenant())
+            logger.info(f"删除文件: {file_id}")
+            return True
             
         except Exception as e:
             logger.error(f"删除文件失败: {str(e)}")
@@ -270,16 +1497,42 @@ class FileService:
     async def _save_file_metadata(self, file_info: FileInfo) -> None:
         """保存文件元数据"""
         try:
-            file_dir = self.upload_dir / file_info.file_id
-            metadata_path = file_dir / "metadata.json"
-            
             # 转换为字典并处理datetime序列化
-            data = file_info.model_dump()
-            data['upload_time'] = file_info.upload_time.isoformat()
+            data = file_info.model_dump(mode="json", exclude=COMPUTED_FIELDS)
             
-            with open(metadata_path, "w", encoding="utf-8") as f:
-                json.dump(data, f, ensure_ascii=False, indent=2)
+            await self._put_record(FILES_BUCKET, file_info.file_id, data)
                 
         except Exception as e:
             logger.error(f"保存文件元数据失败: {str(e)}")
-            raise
\ No newline at end of file
+            raise
+    
+    async def _get_record(self, bucket: str, file_id: str) -> Optional[dict]:
+        """读取文件的元数据记录，隐私模式的文件从文件目录读取"""
+        if not is_valid_file_id(file_id):
+            return None
+        if not is_ephemeral_file(file_id):
+            return await get_store().aget(bucket, file_id, get_current_tenant())
+        
+        record_path = file_storage_dir(file_id) / f"{bucket}{EPHEMERAL_RECORD_SUFFIX}"
+        
+        def read() -> Optional[dict]:
+            if not record_path.exists():
+                return None
+            with open(record_path, "r", encoding="utf-8") as f:
+                return json.load(f)
+        
+        return await asyncio.to_thread(read)
+    
+    async def _put_record(self, bucket: str, file_id: str, data: dict) -> None:
+        """写入文件的元数据记录，隐私模式的文件只写到文件目录，随目录一起删除"""
+        if not is_ephemeral_file(file_id):
+            await get_store().aput(bucket, file_id, data, get_current_tenant())
+            return
+        
+        record_path = file_storage_dir(file_id) / f"{bucket}{EPHEMERAL_RECORD_SUFFIX}"
+        
+        def write() -> None:
+            with open(record_path, "w", encoding="utf-8") as f:
+                json.dump(data, f, ensure_ascii=False)
+        
+        await asyncio.to_thread(write)
@@ -0,0 +1,85 @@
+"""
+Ghostscript调用
+用pdfwrite设备原地重写章节文件，供PDF/A转换和灰度输出使用
+"""
+
+import asyncio
+import shutil
+from pathlib import Path
+from typing import List, Sequence
+
+from ..core.config import settings
+from ..core.errors import ResourceLimitError
+from ..core.limits import engine_limits
+from ..core.sandbox import engine_sandbox, sandbox_available
+from ..core.scratch import replace_file
+from .engine_errors import engine_error
+
+
+def ghostscript_available() -> bool:
+    """是否安装了Ghostscript（且配置的沙箱可用）"""
+    return shutil.which(settings.GHOSTSCRIPT_PATH) is not None and sandbox_available()
+
+
+async def rewrite_pdf(path: Path, options: List[str], prologue: Sequence[str] = ()) -> str:
+    """
+    用Ghostscript重写PDF并替换原文件
+
+    Args:
+        path: 待重写的PDF
+        options: pdfwrite选项
+        prologue: 在PDF之前执行的PostScript文件（如PDF/A输出意图定义）
+
+    Returns:
+        Ghostscript输出
+
+    Raises:
+        RuntimeError: 未安装（或沙箱不可用）或超时
+        EngineError: 执行失败，按输出归类为文件已加密、已损坏等
+        ResourceLimitError: 超出子进程的CPU或内存限制
+    """
+    if not ghostscript_available():
+        raise RuntimeError("服务器未安装Ghostscript或引擎沙箱不可用")
+
+    with engine_sandbox([path, *map(Path, prologue)]) as sandbox, engine_limits() as limits:
+        # 输出写在沙箱目录中，成功后再替换原文件
+        output = sandbox.workdir / "output.pdf"
+        process = await asyncio.create_subprocess_exec(
+            *limits.command(sandbox.command([
+                settings.GHOSTSCRIPT_PATH,
+                "-dSAFER",
+                "-dBATCH",
+                "-dNOPAUSE",
+                "-sDEVICE=pdfwrite",
+                *options,
+                f"-sOutputFile={output}",
+                *prologue,
+                str(path),
+            ])),
+            stdout=asyncio.subprocess.PIPE,
+            stderr=asyncio.subprocess.STDOUT,
+            env=sandbox.env,
+            pass_fds=(*sandbox.pass_fds, *limits.pass_fds)
+        )
+        limits.attach(process.pid)
+        try:
+            stdout, _ = await asyncio.wait_for(process.communicate(), timeout=settings.GHOSTSCRIPT_TIMEOUT)
+        except asyncio.TimeoutError:
+            process.kill()
+            await process.wait()
+            raise RuntimeError(f"Ghostscript处理超时（{settings.GHOSTSCRIPT_TIMEOUT}秒）")
+        except asyncio.CancelledError:
+            # 请求或任务被取消时不留下继续运行的子进程
+            process.kill()
+            await process.wait()
+            raise
+
+        log = stdout.decode("utf-8", errors="replace")
+        if process.returncode != 0 or not output.exists():
+            exceeded = limits.exceeded(process.returncode)
+            if exceeded:
+                raise ResourceLimitError(f"Ghostscript{exceeded}")
+            raise engine_error("Ghostscript", process.returncode, log)
+
+        replace_file(output, path)
+    return log
@@ -0,0 +1,99 @@
+"""
+章节图片提取
+从章节页面中提取嵌入图片，按内容去重并记录出现的页码，便于用插图制作幻灯片
+"""
+
+import hashlib
+import json
+from typing import Dict, List, Optional, Tuple
+
+from loguru import logger
+
+from ..models.schemas import ChapterInfo, ExtractedImage
+from ..core.config import settings
+from ..core.document_cache import document_cache
+
+
+# 压缩包内的图片索引文件名
+IMAGES_INDEX_FILENAME = "images.json"
+
+
+class ImageExtractor:
+    """章节图片提取器"""
+
+    def extract(
+        self,
+        file_path: str,
+        chapter: ChapterInfo,
+        doc_key: Optional[str] = None
+    ) -> Tuple[List[ExtractedImage], List[Tuple[str, bytes]]]:
+        """
+        提取章节页面中的图片
+
+        Args:
+            file_path: PDF文件路径
+            chapter: 章节
+            doc_key: 文档缓存键（文件内容哈希），为空时不使用缓存
+
+        Returns:
+            (图片列表, 压缩包条目列表)，条目包含图片文件和images.json索引
+        """
+        images: Dict[str, ExtractedImage] = {}
+        entries: List[Tuple[str, bytes]] = []
+        seen_xrefs: Dict[int, Optional[str]] = {}
+        min_size = settings.IMAGE_EXTRACT_MIN_SIZE
+
+        with document_cache.open(file_path, doc_key) as doc:
+            for page_num in range(chapter.start_page - 1, min(chapter.end_page, len(doc))):
+                page_no = page_num + 1
+                for image_info in doc[page_num].get_images(full=True):
+                    xref = image_info[0]
+                    if xref not in seen_xrefs:
+                        seen_xrefs[xref] = self._extract_one(doc, xref, page_no, min_size, images, entries)
+                    digest = seen_xrefs[xref]
+                    if digest and page_no not in images[digest].pages:
+                        images[digest].pages.append(page_no)
+
+        result = list(images.values())
+        index = json.dumps([image.model_dump() for image in result], ensure_ascii=False, indent=2)
+        entries.append((IMAGES_INDEX_FILENAME, index.encode("utf-8")))
+
+        logger.info(f"提取章节图片: {chapter.title} - {len(result)} 张")
+        return result, entries
+
+    @staticmethod
+    def _extract_one(
+        doc,
+        xref: int,
+        page_no: int,
+        min_size: int,
+        images: Dict[str, ExtractedImage],
+        entries: List[Tuple[str, bytes]]
+    ) -> Optional[str]:
+        """提取单个图片对象，返回内容哈希；过小或无法解码时返回None"""
+        try:
+            data = doc.extract_image(xref)
+        except Exception as e:
+            logger.warning(f"提取图片失败: xref={xref} - {str(e)}")
+            return None
+        if not data or data["width"] < min_size or data["height"] < min_size:
+            return None
+
+        content = data["image"]
+        digest = hashlib.sha256(content).hexdigest()
+        if digest not in images:
+            filename = f"p{page_no:04d}_{len(images) + 1:03d}.{data['ext']}"
+            images[digest] = ExtractedImage(
+                filename=filename,
+                pages=[],
+                width=data["width"],
+                height=data["height"],
+                size=len(content),
+                sha256=digest
+            )
+            entries.append((filename, content))
+        return digest
+
+
+# 创建全局图片提取器实例
+image_extractor = ImageExtractor()
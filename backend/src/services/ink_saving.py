@@ -0,0 +1,63 @@
+"""
+省墨输出
+- 灰度：保存后用Ghostscript把文字、矢量图形和图片统一转换为灰度
+- 去除背景图：删除覆盖大部分页面的图片（底纹、水印底图），只处理含可见文字的页面，扫描页不受影响
+"""
+
+from pathlib import Path
+
+import fitz
+from loguru import logger
+
+from .ghostscript import rewrite_pdf
+
+
+# 图片覆盖页面面积达到该比例时视为背景
+BACKGROUND_COVERAGE = 0.5
+
+# 不可见文字（OCR文字层）的渲染模式
+INVISIBLE_TEXT = 3
+
+
+def strip_background_images(doc: fitz.Document) -> int:
+    """
+    删除章节文档中的背景图片
+
+    Args:
+        doc: 章节文档
+
+    Returns:
+        删除的图片数
+    """
+    removed = set()
+    for page in doc:
+        if not has_visible_text(page):
+            continue
+        page_area = abs(page.rect)
+        for image in page.get_images(full=True):
+            xref = image[0]
+            if xref in removed:
+                continue
+            covered = sum(abs(rect & page.rect) for rect in page.get_image_rects(xref))
+            if page_area and covered / page_area >= BACKGROUND_COVERAGE:
+                page.delete_image(xref)
+                removed.add(xref)
+
+    if removed:
+        logger.debug(f"删除背景图片: {len(removed)} 张")
+    return len(removed)
+
+
+async def convert_to_grayscale(path: Path) -> None:
+    """
+    把已保存的PDF原地转换为灰度
+
+    Raises:
+        RuntimeError: Ghostscript不可用或转换失败
+    """
+    await rewrite_pdf(path, ["-sColorConversionStrategy=Gray", "-dProcessColorModel=/DeviceGray"])
+
+
+def has_visible_text(page: fitz.Page) -> bool:
+    """页面是否含可见文字（不计OCR文字层）"""
+    return any(span["type"] != INVISIBLE_TEXT and span["chars"] for span in page.get_texttrace())
@@ -0,0 +1,86 @@
+"""
+语言识别
+根据文字所属的书写系统判断语言，拉丁字母文本再按常见虚词区分具体语言，
+返回ISO 639-1代码，供区域关键词匹配和大模型选择使用，不依赖外部模型
+"""
+
+import re
+from collections import Counter
+from typing import Optional
+
+
+# 字母数少于该值时不判断语言
+MIN_LETTERS = 20
+
+# 假名占全部字母的比例达到该值时判为日文（日文同时使用汉字）
+KANA_RATIO = 0.1
+
+LATIN = "latin"
+
+# 书写系统的Unicode范围及对应语言
+SCRIPT_RANGES = [
+    ("ja", [(0x3040, 0x30FF)]),  # 平假名、片假名
+    ("ko", [(0xAC00, 0xD7AF), (0x1100, 0x11FF)]),
+    ("zh", [(0x4E00, 0x9FFF), (0x3400, 0x4DBF)]),
+    ("ru", [(0x0400, 0x04FF)]),
+    ("el", [(0x0370, 0x03FF)]),
+    ("he", [(0x0590, 0x05FF)]),
+    ("ar", [(0x0600, 0x06FF)]),
+    ("hi", [(0x0900, 0x097F)]),
+    ("th", [(0x0E00, 0x0E7F)]),
+]
+
+# 拉丁字母语言的常见虚词
+STOPWORDS = {
+    "en": {"the", "and", "of", "to", "in", "is", "that", "for", "with", "as", "are", "this", "be", "by", "on", "it", "from"},
+    "de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "von", "zu", "ein", "eine", "auf", "sich", "für", "dem", "des"},
+    "fr": {"le", "la", "les", "et", "des", "est", "une", "dans", "que", "pour", "qui", "pas", "sur", "du", "au", "avec", "en"},
+    "es": {"el", "la", "los", "las", "y", "que", "de", "en", "es", "por", "una", "con", "para", "del", "se", "no", "su"},
+    "it": {"il", "la", "di", "che", "e", "è", "per", "una", "non", "con", "sono", "del", "della", "gli", "le", "da", "si"},
+    "pt": {"o", "a", "os", "as", "que", "de", "em", "um", "uma", "para", "com", "não", "do", "da", "é", "se", "por"},
+    "nl": {"de", "het", "een", "en", "van", "is", "dat", "op", "te", "zijn", "niet", "met", "voor", "ook", "die", "aan"},
+}
+
+WORD_PATTERN = re.compile(r"[^\W\d_]+")
+
+
+def detect_language(text: str) -> Optional[str]:
+    """
+    识别文本语言
+
+    Args:
+        text: 待识别的文本
+
+    Returns:
+        ISO 639-1语言代码，文字过少或无法判断时为None
+    """
+    scripts = Counter(_script(char) for char in text if char.isalpha())
+    total = sum(scripts.values())
+    if total < MIN_LETTERS:
+        return None
+    if scripts["ja"] >= total * KANA_RATIO:
+        return "ja"
+
+    script = scripts.most_common(1)[0][0]
+    if script == LATIN:
+        return _latin_language(text)
+    return script if script in dict(SCRIPT_RANGES) else None
+
+
+def _script(char: str) -> str:
+    """字符所属的书写系统（以语言代码表示，拉丁字母为LATIN）"""
+    code = ord(char)
+    if code < 0x0250:
+        return LATIN
+    for language, ranges in SCRIPT_RANGES:
+        if any(start <= code <= end for start, end in ranges):
+            return language
+    return "other"
+
+
+def _latin_language(text: str) -> Optional[str]:
+    """按常见虚词出现次数区分拉丁字母语言"""
+    words = Counter(word.lower() for word in WORD_PATTERN.findall(text))
+    scores = {language: sum(words[word] for word in stopwords) for language, stopwords in STOPWORDS.items()}
+    language, score = max(scores.items(), key=lambda item: item[1])
+    return language if score else None
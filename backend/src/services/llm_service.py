@@ -26,12 +26,13 @@ class LLMServices:
         self.timeout = settings.LLM_TIMEOUT
         
     @retry(Exception, tries=3, delay=1, backoff=2, jitter=0.5)
-    async def _call_llm_api(self, messages: List[Dict[str, str]]) -> Optional[Dict[str, Any]]:
+    async def _call_llm_api(self, messages: List[Dict[str, str]], model: Optional[str] = None) -> Optional[Dict[str, Any]]:
         """
         调用大模型API，带重试机制
         
         Args:
             messages: 消息列表
+            model: 使用的模型，为空时使用默认模型
             
         Returns:
             API响应结果
@@ -42,7 +43,7 @@ class LLMServices:
         }
         
         payload = {
-            "model": self.model_name,
+            "model": model or self.model_name,
             "messages": messages,
             "temperature": self.temperature,
             "max_tokens": self.max_tokens,
@@ -248,13 +249,23 @@ class LLMServices:
         
         return []
     
-    async def analyze_pdf_content(self, content: str, context: Optional[str] = None) -> Dict[str, Any]:
+    def model_for(self, language: Optional[str]) -> str:
+        """按语言选择模型，未配置的语言使用默认模型"""
+        return settings.LLM_LANGUAGE_MODELS.get(language or "", self.model_name)
+    
+    async def analyze_pdf_content(
+        self,
+        content: str,
+        context: Optional[str] = None,
+        language: Optional[str] = None
+    ) -> Dict[str, Any]:
         """
         综合分析PDF内容，提取层级结构和知识点
         
         Args:
             content: PDF内容
             context: 上下文信息
+            language: 内容语言（ISO 639-1代码），用于选择模型并要求按原文语言输出
             
         Returns:
             分析结果，包含章节、节和知识点
@@ -273,9 +284,11 @@ class LLMServices:
                     "content": f"分析以下PDF内容，提取层级结构和知识点，上下文：{context}\n\n内容：{content[:5000]}..."  # 限制文本长度
                 }
             ]
+            if language:
+                messages[0]["content"] += f"内容语言为 {language}，节和知识点使用原文语言。"
             
-            # 调用大模型API
-            response = await self._call_llm_api(messages)
+            # 调用大模型API（按内容语言选择模型）
+            response = await self._call_llm_api(messages, model=self.model_for(language))
             
             if not response or "choices" not in response:
                 logger.error("大模型API响应格式错误")
@@ -387,6 +400,72 @@ class LLMServices:
         
         return graph_data
 
+    
+    async def normalize_titles(self, titles: List[str]) -> List[str]:
+        """
+        使用大模型规范化章节标题（修正OCR错误、统一大小写）
+        
+        Args:
+            titles: 经过规则清洗的标题列表
+            
+        Returns:
+            规范化后的标题列表，失败或数量不一致时返回原列表
+        """
+        if not titles:
+            return titles
+        
+        try:
+            logger.info(f"开始规范化章节标题，数量: {len(titles)}")
+            
+            # 构建提示词
+            messages = [
+                {
+                    "role": "system",
+                    "content": "你是一个专业的书籍编辑助手，请规范化给定的章节标题：修正明显的OCR识别错误（如把数字1识别成字母l），统一大小写风格，去除多余的符号和页码，但不要改写标题的含义。输出格式为JSON数组，与输入数量和顺序完全一致，不要添加任何解释性文字。"
+                },
+                {
+                    "role": "user",
+                    "content": f"规范化以下章节标题：\n\n{json.dumps(titles, ensure_ascii=False)}"
+                }
+            ]
+            
+            # 调用大模型API
+            response = await self._call_llm_api(messages)
+            
+            if not response or "choices" not in response:
+                logger.error("大模型API响应格式错误")
+                return titles
+            
+            # 解析响应
+            llm_output = response["choices"][0]["message"]["content"]
+            logger.debug(f"大模型输出: {llm_output}")
+            
+            # 提取JSON数组部分
+            json_start = llm_output.find("[")
+            json_end = llm_output.rfind("]") + 1
+            
+            if json_start == -1 or json_end == 0:
+                logger.error("无法从大模型输出中提取JSON格式")
+                return titles
+            
+            json_str = llm_output[json_start:json_end]
+            normalized = json.loads(json_str)
+            
+            if not isinstance(normalized, list) or len(normalized) != len(titles):
+                logger.error("大模型返回的标题数量与输入不一致")
+                return titles
+            
+            logger.info("章节标题规范化完成")
+            return [str(title).strip() or original for title, original in zip(normalized, titles)]
+            
+        except json.JSONDecodeError as e:
+            logger.error(f"JSON解析失败: {str(e)}")
+            logger.error(f"JSON字符串: {json_str if 'json_str' in locals() else '未提取到'}")
+        except Exception as e:
+            logger.error(f"章节标题规范化失败: {str(e)}")
+        
+        return titles
+
 
 # 创建全局服务实例
 llm_service = LLMServices()
\ No newline at end of file
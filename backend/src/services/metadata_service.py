@@ -0,0 +1,176 @@
+"""
+书目元数据
+识别文档前几页（版权页）中的ISBN和DOI，启用METADATA_LOOKUP_ENABLED时从外部服务
+（默认Open Library和Crossref）查询规范的标题、作者和版次，用于显示名称、章节文件名模板和课程读本封面
+"""
+
+import re
+from dataclasses import dataclass
+from typing import Any, Dict, Optional, Tuple
+from urllib.parse import quote
+
+import fitz
+import httpx
+from loguru import logger
+
+from ..core.config import settings
+
+
+# 查找ISBN和DOI的页数（版权页通常在前几页）
+IDENTIFIER_SCAN_PAGES = 5
+
+# "ISBN 978-7-111-12345-6"、"ISBN-10: 0-262-03561-8"，以及没有前缀的978/979开头的13位号码
+ISBN_PATTERN = re.compile(r"ISBN(?:-1[03])?\s*[:：]?\s*((?:[0-9][\s-]?){9}[0-9Xx](?:[\s-]?[0-9]){0,3})", re.IGNORECASE)
+BARE_ISBN_PATTERN = re.compile(r"\b(97[89](?:[\s-]?[0-9]){10})\b")
+DOI_PATTERN = re.compile(r"\b(10\.\d{4,9}/[^\s\"<>]+)", re.IGNORECASE)
+
+
+@dataclass
+class BookMetadata:
+    """外部服务返回的规范书目信息"""
+    title: Optional[str] = None
+    author: Optional[str] = None
+    edition: Optional[str] = None
+
+
+def normalize_isbn(value: str) -> Optional[str]:
+    """
+    去除分隔符并校验ISBN-10/ISBN-13的校验位
+
+    Args:
+        value: 原始号码
+
+    Returns:
+        只含数字（ISBN-10末位可为X）的号码，校验失败时为None
+    """
+    digits = re.sub(r"[\s-]", "", value).upper()
+    if len(digits) == 13 and digits.isdigit():
+        total = sum(int(d) * (1 if i % 2 == 0 else 3) for i, d in enumerate(digits[:12]))
+        return digits if (10 - total % 10) % 10 == int(digits[12]) else None
+    if len(digits) == 10 and digits[:9].isdigit() and (digits[9].isdigit() or digits[9] == "X"):
+        total = sum(int(d) * (10 - i) for i, d in enumerate(digits[:9]))
+        check = 10 if digits[9] == "X" else int(digits[9])
+        return digits if (total + check) % 11 == 0 else None
+    return None
+
+
+def find_identifiers(text: str) -> Tuple[Optional[str], Optional[str]]:
+    """
+    在文字中查找第一个有效的ISBN和DOI
+
+    Args:
+        text: 文档文字
+
+    Returns:
+        (ISBN, DOI)，未找到时为None
+    """
+    isbn = None
+    for pattern in (ISBN_PATTERN, BARE_ISBN_PATTERN):
+        for match in pattern.finditer(text):
+            # ISBN-10后紧跟的数字可能被当作号码的一部分，再按前10位校验
+            isbn = normalize_isbn(match.group(1)) or normalize_isbn(re.sub(r"[\s-]", "", match.group(1))[:10])
+            if isbn:
+                break
+        if isbn:
+            break
+
+    match = DOI_PATTERN.search(text)
+    doi = match.group(1).rstrip(".,;:)]}") if match else None
+    return isbn, doi
+
+
+def detect_identifiers(file_path: str) -> Tuple[Optional[str], Optional[str]]:
+    """
+    读取文档前IDENTIFIER_SCAN_PAGES页中的ISBN和DOI
+
+    Args:
+        file_path: PDF文件路径
+
+    Returns:
+        (ISBN, DOI)，未找到或文件无法打开时为None
+    """
+    try:
+        with fitz.open(file_path) as doc:
+            if doc.needs_pass:
+                return None, None
+            text = "\n".join(page.get_text() for page in list(doc)[:IDENTIFIER_SCAN_PAGES])
+    except Exception as e:
+        logger.warning(f"读取文档标识符失败: {file_path} - {str(e)}")
+        return None, None
+    return find_identifiers(text)
+
+
+class MetadataService:
+    """书目元数据查询服务"""
+
+    async def lookup(self, isbn: Optional[str], doi: Optional[str]) -> Optional[BookMetadata]:
+        """
+        按ISBN（优先）或DOI查询规范书目信息，未启用、没有标识符或查询失败时返回None
+
+        Args:
+            isbn: ISBN
+            doi: DOI
+
+        Returns:
+            书目信息
+        """
+        if not settings.METADATA_LOOKUP_ENABLED:
+            return None
+
+        queries = []
+        if isbn and settings.METADATA_ISBN_URL:
+            queries.append((settings.METADATA_ISBN_URL.format(isbn=isbn), self._parse_isbn_response))
+        if doi and settings.METADATA_DOI_URL:
+            queries.append((settings.METADATA_DOI_URL.format(doi=quote(doi, safe="/")), self._parse_doi_response))
+
+        for url, parse in queries:
+            try:
+                async with httpx.AsyncClient(timeout=settings.METADATA_LOOKUP_TIMEOUT) as client:
+                    response = await client.get(url, headers={"Accept": "application/json"})
+                response.raise_for_status()
+                metadata = parse(response.json())
+            except Exception as e:
+                logger.warning(f"查询书目元数据失败: {url} - {str(e)}")
+                continue
+            if metadata and metadata.title:
+                return metadata
+        return None
+
+    @staticmethod
+    def _parse_isbn_response(data: Dict[str, Any]) -> Optional[BookMetadata]:
+        """Open Library Books API（jscmd=data 或 jscmd=details）"""
+        entry = next(iter(data.values()), None) if isinstance(data, dict) else None
+        if not isinstance(entry, dict):
+            return None
+        book = entry.get("details", entry)
+        title = book.get("title")
+        if title and book.get("subtitle"):
+            title = f"{title}: {book['subtitle']}"
+        authors = [author.get("name") for author in book.get("authors", []) if author.get("name")]
+        return BookMetadata(
+            title=title,
+            author=", ".join(authors) or None,
+            edition=book.get("edition_name")
+        )
+
+    @staticmethod
+    def _parse_doi_response(data: Dict[str, Any]) -> Optional[BookMetadata]:
+        """Crossref Works API"""
+        work = data.get("message") if isinstance(data, dict) else None
+        if not isinstance(work, dict):
+            return None
+        titles = work.get("title") or []
+        authors = [
+            " ".join(part for part in (author.get("given"), author.get("family")) if part)
+            for author in work.get("author", [])
+        ]
+        edition = work.get("edition-number")
+        return BookMetadata(
+            title=titles[0] if titles else None,
+            author=", ".join(name for name in authors if name) or None,
+            edition=str(edition) if edition else None
+        )
+
+
+# 全局书目元数据服务实例
+metadata_service = MetadataService()
@@ -0,0 +1,284 @@
+"""
+通知服务
+支持Slack、通用JSON Webhook和邮件等可插拔通知渠道
+"""
+
+import asyncio
+import smtplib
+import time
+from email.message import EmailMessage
+from typing import List, Dict, Any, Optional
+
+from loguru import logger
+
+from ..models.schemas import NotificationConfig, NotificationChannelType, WebhookDeliveryStatus
+from ..core.config import settings
+from .webhook_service import post_notification, validate_notification_url, webhook_service
+
+
+# 通知事件类型
+EVENT_TASK_COMPLETED = "task.completed"
+EVENT_TASK_FAILED = "task.failed"
+EVENT_QUOTA_WARNING = "quota.warning"
+EVENT_FILE_QUARANTINED = "file.quarantined"
+
+
+def validate_email_recipients(recipients: List[str]) -> None:
+    """
+    校验请求级邮件收件人，只允许NOTIFY_EMAIL_ALLOWLIST中的地址或域名，防止调用方借通知向任意地址发信
+
+    Args:
+        recipients: 收件人地址
+
+    Raises:
+        ValueError: 未配置允许的收件人，或收件人不在允许范围内
+    """
+    allowed = {entry.strip().lower().lstrip("@") for entry in settings.NOTIFY_EMAIL_ALLOWLIST if entry.strip()}
+    if not allowed:
+        raise ValueError("服务器未配置允许的邮件收件人，不能在请求中指定邮件通知")
+
+    for recipient in recipients:
+        address = recipient.strip().lower()
+        local, _, domain = address.rpartition("@")
+        # 一个收件人只能是单个地址，不能借逗号或换行附带其他收件人和邮件头
+        if not local or not domain or any(c in address for c in ",;<>\r\n \t"):
+            raise ValueError(f"邮件收件人地址无效: {recipient}")
+        if address not in allowed and domain not in allowed:
+            raise ValueError(f"邮件收件人不在允许范围内: {recipient}")
+
+
+class NotificationChannel:
+    """通知渠道基类"""
+
+    def __init__(self, events: Optional[List[str]] = None):
+        self.events = events or list(settings.NOTIFY_EVENTS)
+
+    def accepts(self, event: str) -> bool:
+        """是否订阅该事件"""
+        return event in self.events
+
+    async def send(self, event: str, payload: Dict[str, Any]) -> None:
+        """发送通知"""
+        raise NotImplementedError
+
+    @staticmethod
+    def _summary(event: str, payload: Dict[str, Any]) -> str:
+        """生成通知摘要文本"""
+        if event == EVENT_TASK_COMPLETED:
+            return f"✅ 拆分任务 {payload.get('task_id')} 已完成，生成 {payload.get('files', 0)} 个文件"
+        if event == EVENT_TASK_FAILED:
+            return f"❌ 拆分任务 {payload.get('task_id')} 失败: {payload.get('error', '未知错误')}"
+        if event == EVENT_QUOTA_WARNING:
+            return f"⚠️ 配额预警: {payload.get('message', '')}"
+        if event == EVENT_FILE_QUARANTINED:
+            return (
+                f"🚫 文件 {payload.get('file_id')} 连续 {payload.get('failures')} 次导致处理引擎崩溃，已隔离: "
+                f"{payload.get('reason', '未知原因')}"
+            )
+        return f"{event}: {payload}"
+
+
+class SlackChannel(NotificationChannel):
+    """Slack Incoming Webhook 渠道"""
+
+    def __init__(self, webhook_url: str, events: Optional[List[str]] = None, global_channel: bool = False):
+        super().__init__(events)
+        self.webhook_url = webhook_url
+        self.global_channel = global_channel
+
+    async def send(self, event: str, payload: Dict[str, Any]) -> None:
+        # 请求级地址在发送时重新校验并连接校验过的IP
+        response = await post_notification(
+            self.webhook_url,
+            pinned=not self.global_channel,
+            json={"text": self._summary(event, payload)},
+            timeout=settings.NOTIFY_TIMEOUT
+        )
+        response.raise_for_status()
+
+
+class WebhookChannel(NotificationChannel):
+    """通用JSON Webhook 渠道（签名、持久化和重试见 webhook_service）"""
+
+    def __init__(
+        self,
+        url: str,
+        headers: Optional[Dict[str, str]] = None,
+        events: Optional[List[str]] = None,
+        global_channel: bool = False
+    ):
+        super().__init__(events)
+        self.url = url
+        self.headers = headers or {}
+        self.global_channel = global_channel
+
+    async def send(self, event: str, payload: Dict[str, Any]) -> None:
+        # 投递记录持久化，首次失败后由投递服务按退避策略重试
+        delivery = await webhook_service.deliver(event, self.url, payload, self.headers, self.global_channel)
+        if delivery.status == WebhookDeliveryStatus.PENDING:
+            raise RuntimeError(f"{delivery.attempts[-1].error}（已加入重试队列: {delivery.delivery_id}）")
+        if delivery.status == WebhookDeliveryStatus.FAILED:
+            raise RuntimeError(delivery.attempts[-1].error)
+
+
+class EmailChannel(NotificationChannel):
+    """SMTP 邮件渠道"""
+
+    def __init__(self, recipients: List[str], events: Optional[List[str]] = None):
+        super().__init__(events)
+        self.recipients = recipients
+
+    async def send(self, event: str, payload: Dict[str, Any]) -> None:
+        if not settings.SMTP_HOST:
+            raise ValueError("未配置SMTP服务器")
+
+        message = EmailMessage()
+        message["Subject"] = f"[PDF章节拆分器] {event}"
+        message["From"] = settings.SMTP_FROM
+        message["To"] = ", ".join(self.recipients)
+        message.set_content(self._summary(event, payload))
+
+        # smtplib为阻塞调用，放入线程池执行
+        await asyncio.get_running_loop().run_in_executor(None, self._deliver, message)
+
+    @staticmethod
+    def _deliver(message: EmailMessage) -> None:
+        with smtplib.SMTP(settings.SMTP_HOST, settings.SMTP_PORT, timeout=settings.NOTIFY_TIMEOUT) as smtp:
+            if settings.SMTP_USE_TLS:
+                smtp.starttls()
+            if settings.SMTP_USER:
+                smtp.login(settings.SMTP_USER, settings.SMTP_PASSWORD)
+            smtp.send_message(message)
+
+
+class NotificationService:
+    """通知服务"""
+
+    def __init__(self):
+        self.global_channels = self._build_global_channels()
+        # 各租户上次发送配额预警的时间，上传频繁时避免每次请求都发送
+        self._quota_warned: Dict[str, float] = {}
+
+    def _build_global_channels(self) -> List[NotificationChannel]:
+        """根据全局配置创建通知渠道"""
+        channels: List[NotificationChannel] = []
+
+        if settings.NOTIFY_SLACK_WEBHOOK_URL:
+            channels.append(SlackChannel(settings.NOTIFY_SLACK_WEBHOOK_URL, global_channel=True))
+        if settings.NOTIFY_WEBHOOK_URL:
+            channels.append(WebhookChannel(settings.NOTIFY_WEBHOOK_URL, global_channel=True))
+        if settings.NOTIFY_EMAIL_TO:
+            channels.append(EmailChannel(settings.NOTIFY_EMAIL_TO))
+
+        if channels:
+            logger.info(f"已配置 {len(channels)} 个全局通知渠道")
+        return channels
+
+    @staticmethod
+    def validate(configs: List[NotificationConfig]) -> None:
+        """
+        创建任务或预设时校验请求级通知配置
+
+        Args:
+            configs: 通知配置
+
+        Raises:
+            ValueError: 通知地址无效或邮件收件人不在允许范围内
+        """
+        for config in configs:
+            if config.type in (NotificationChannelType.SLACK, NotificationChannelType.WEBHOOK):
+                validate_notification_url(config.url)
+            elif config.type == NotificationChannelType.EMAIL:
+                validate_email_recipients(config.recipients)
+
+    @staticmethod
+    def build_channel(config: NotificationConfig) -> NotificationChannel:
+        """
+        根据请求级配置创建通知渠道，发送前重新校验地址，避免创建任务后域名改为解析到内网，
+        邮件收件人按当前的NOTIFY_EMAIL_ALLOWLIST重新校验
+
+        Args:
+            config: 通知配置
+
+        Returns:
+            通知渠道
+        """
+        events = config.events or None
+        if config.type in (NotificationChannelType.SLACK, NotificationChannelType.WEBHOOK):
+            validate_notification_url(config.url)
+
+        if config.type == NotificationChannelType.SLACK:
+            return SlackChannel(config.url, events)
+        if config.type == NotificationChannelType.WEBHOOK:
+            return WebhookChannel(config.url, config.headers, events)
+        if config.type == NotificationChannelType.EMAIL:
+            validate_email_recipients(config.recipients)
+            return EmailChannel(config.recipients, events)
+
+        raise ValueError(f"不支持的通知渠道: {config.type}")
+
+    async def notify(
+        self,
+        event: str,
+        payload: Dict[str, Any],
+        configs: Optional[List[NotificationConfig]] = None
+    ) -> int:
+        """
+        向全局渠道和请求级渠道发送通知
+
+        Args:
+            event: 事件类型
+            payload: 事件数据
+            configs: 请求级通知配置
+
+        Returns:
+            发送成功的渠道数量
+        """
+        channels = list(self.global_channels)
+        for config in configs or []:
+            try:
+                channels.append(self.build_channel(config))
+            except Exception as e:
+                logger.warning(f"忽略无效的通知配置: {str(e)}")
+
+        targets = [channel for channel in channels if channel.accepts(event)]
+        if not targets:
+            return 0
+
+        results = await asyncio.gather(
+            *(channel.send(event, payload) for channel in targets),
+            return_exceptions=True
+        )
+
+        delivered = 0
+        for channel, result in zip(targets, results):
+            if isinstance(result, Exception):
+                logger.error(f"通知发送失败: {type(channel).__name__} - {event} - {str(result)}")
+            else:
+                delivered += 1
+
+        logger.info(f"通知已发送: {event} - {delivered}/{len(targets)} 个渠道")
+        return delivered
+
+    async def notify_quota_warning(self, message: str, tenant_id: str, **details) -> int:
+        """
+        发送配额预警，同一租户在QUOTA_WARNING_INTERVAL内只发送一次
+
+        Args:
+            message: 预警内容
+            tenant_id: 租户ID
+            **details: 附加数据
+
+        Returns:
+            发送成功的渠道数量，间隔内重复的预警返回0
+        """
+        now = time.monotonic()
+        last = self._quota_warned.get(tenant_id)
+        if last is not None and now - last < settings.QUOTA_WARNING_INTERVAL:
+            return 0
+        self._quota_warned[tenant_id] = now
+        return await self.notify(EVENT_QUOTA_WARNING, {"message": message, "tenant_id": tenant_id, **details})
+
+
+# 创建全局通知服务实例
+notification_service = NotificationService()
@@ -0,0 +1,51 @@
+"""
+OCR文字层
+对没有文字的扫描页运行Tesseract，只生成不可见的文字（textonly_pdf）并叠加到页面上，
+章节输出因此可搜索、可选中文字，页面外观不变
+"""
+
+from typing import List
+
+import fitz
+from loguru import logger
+
+from ..core.config import settings
+from .orientation import is_scanned_page, render_page
+from .tesseract import run_tesseract, tesseract_available
+
+
+async def add_text_layer(doc: fitz.Document) -> List[int]:
+    """
+    为章节文档中的扫描页写入不可见文字层
+
+    Args:
+        doc: 章节文档
+
+    Returns:
+        写入了文字层的章节内页码（从1开始）
+
+    Raises:
+        RuntimeError: 未安装Tesseract或识别超时
+    """
+    if not tesseract_available():
+        raise RuntimeError("服务器未安装Tesseract")
+
+    pages = []
+    for page_num in range(len(doc)):
+        page = doc[page_num]
+        # 已有文字（包括此前OCR的文字层）的页面不重复识别
+        if page.get_text().strip() or not is_scanned_page(page):
+            continue
+
+        data = await run_tesseract(render_page(page), ["-l", settings.OCR_LANGUAGES, "-c", "textonly_pdf=1", "pdf"])
+        if not data:
+            continue
+        with fitz.open(stream=data, filetype="pdf") as layer:
+            if not layer.page_count or not layer[0].get_text().strip():
+                continue
+            page.show_pdf_page(page.rect, layer, 0, keep_proportion=False, overlay=True)
+        pages.append(page_num + 1)
+
+    if pages:
+        logger.debug(f"写入OCR文字层: {len(pages)} 页")
+    return pages
@@ -0,0 +1,135 @@
+"""
+扫描页方向和倾斜纠正
+- 方向：用Tesseract的方向检测（OSD）识别旋转了90/180/270度的页面，通过页面旋转属性纠正（无损）
+- 倾斜：用Tesseract版面分析得到的文本行基线斜率估计倾斜角，按该角度重新绘制页面内容
+只处理没有可见文字、由整页图片构成的扫描页
+"""
+
+import math
+import re
+from dataclasses import dataclass
+from statistics import median
+from typing import List
+
+import fitz
+from loguru import logger
+
+from ..core.config import settings
+from .ink_saving import BACKGROUND_COVERAGE, has_visible_text
+from .tesseract import OCR_DPI, run_tesseract, tesseract_available
+
+
+# 超过该角度的倾斜视为误检，不纠正
+MAX_SKEW_ANGLE = 10.0
+
+# 至少需要的文本行数，行数太少时倾斜估计不可靠
+MIN_SKEW_LINES = 3
+
+OSD_ORIENTATION_PATTERN = re.compile(r"Orientation in degrees:\s*(\d+)")
+OSD_CONFIDENCE_PATTERN = re.compile(r"Orientation confidence:\s*([\d.]+)")
+HOCR_BASELINE_PATTERN = re.compile(r"class=['\"]ocr_(?:line|caption|textfloat|header)['\"][^>]*?baseline (-?[\d.]+) -?[\d.]+")
+
+
+@dataclass
+class PageCorrection:
+    """单页的纠正结果"""
+    page: int  # 章节内页码（从1开始）
+    rotation: int  # 顺时针旋转的角度（0/90/180/270）
+    skew: float  # 纠正的倾斜角度（度）
+
+
+async def correct_orientation(doc: fitz.Document) -> List[PageCorrection]:
+    """
+    检测并纠正章节文档中扫描页的方向和倾斜
+
+    Args:
+        doc: 章节文档
+
+    Returns:
+        发生纠正的页面
+
+    Raises:
+        RuntimeError: 未安装Tesseract或检测失败
+    """
+    if not tesseract_available():
+        raise RuntimeError("服务器未安装Tesseract")
+
+    corrections = []
+    for page_num in range(len(doc)):
+        page = doc[page_num]
+        if not is_scanned_page(page):
+            continue
+
+        rotation = await _detect_rotation(page)
+        skew = await _detect_skew(page, rotation)
+        if abs(skew) < settings.DESKEW_MIN_ANGLE:
+            skew = 0.0
+        if not rotation and not skew:
+            continue
+
+        if skew:
+            page = _redraw_rotated(doc, page_num, skew)
+        if rotation:
+            page.set_rotation((page.rotation + rotation) % 360)
+        corrections.append(PageCorrection(page=page_num + 1, rotation=rotation, skew=round(skew, 2)))
+
+    if corrections:
+        logger.debug(f"纠正扫描页方向和倾斜: {len(corrections)} 页")
+    return corrections
+
+
+def is_scanned_page(page: fitz.Page) -> bool:
+    """没有可见文字且主要由图片构成的页面视为扫描页"""
+    if has_visible_text(page):
+        return False
+    page_area = abs(page.rect)
+    for image in page.get_images(full=True):
+        covered = sum(abs(rect & page.rect) for rect in page.get_image_rects(image[0]))
+        if page_area and covered / page_area >= BACKGROUND_COVERAGE:
+            return True
+    return False
+
+
+async def _detect_rotation(page: fitz.Page) -> int:
+    """检测页面需要顺时针旋转的角度，置信度不足时返回0"""
+    output = (await run_tesseract(render_page(page), ["--psm", "0"])).decode("utf-8", errors="replace")
+    orientation = OSD_ORIENTATION_PATTERN.search(output)
+    confidence = OSD_CONFIDENCE_PATTERN.search(output)
+    if not orientation or not confidence or float(confidence.group(1)) < settings.ORIENTATION_MIN_CONFIDENCE:
+        return 0
+    return int(orientation.group(1)) % 360
+
+
+async def _detect_skew(page: fitz.Page, rotation: int) -> float:
+    """在方向纠正后的图像上估计倾斜角（度，正值表示内容顺时针倾斜）"""
+    output = (await run_tesseract(render_page(page, rotation), ["--psm", "1", "hocr"])).decode("utf-8", errors="replace")
+    slopes = [float(slope) for slope in HOCR_BASELINE_PATTERN.findall(output)]
+    if len(slopes) < MIN_SKEW_LINES:
+        return 0.0
+    skew = math.degrees(math.atan(median(slopes)))
+    return skew if abs(skew) <= MAX_SKEW_ANGLE else 0.0
+
+
+def render_page(page: fitz.Page, rotation: int = 0) -> bytes:
+    """把页面渲染为灰度PNG（记录分辨率，识别结果的尺寸与页面一致）"""
+    zoom = OCR_DPI / 72
+    pixmap = page.get_pixmap(matrix=fitz.Matrix(zoom, zoom).prerotate(rotation), colorspace=fitz.csGRAY)
+    pixmap.set_dpi(OCR_DPI, OCR_DPI)
+    return pixmap.tobytes("png")
+
+
+def _redraw_rotated(doc: fitz.Document, page_num: int, skew: float) -> fitz.Page:
+    """用反向旋转后的原页面内容替换该页，返回新页面（尺寸和原旋转属性不变）"""
+    original = doc[page_num]
+    rotation = original.rotation
+    source = fitz.open()
+    source.insert_pdf(doc, from_page=page_num, to_page=page_num)
+    source[0].set_rotation(0)
+
+    mediabox = original.mediabox
+    doc.delete_page(page_num)
+    page = doc.new_page(page_num, width=mediabox.width, height=mediabox.height)
+    page.show_pdf_page(page.rect, source, 0, rotate=skew)
+    page.set_rotation(rotation)
+    source.close()
+    return page
@@ -0,0 +1,117 @@
+"""
+书签编辑
+读取上传文件的书签树，按编辑后的书签树生成新的可下载副本；
+能增量保存时只追加更新（页面内容和已有签名的字节不变），否则完整重写
+"""
+
+import hashlib
+import shutil
+from pathlib import Path
+from typing import List, Optional, Tuple
+
+import fitz
+from loguru import logger
+
+from ..core.errors import InvalidRangeError
+from ..models.schemas import OutlineItem
+
+
+# 编辑后副本的文件名前缀，完整文件名附带内容哈希，每次编辑生成新的文件名
+OUTLINE_FILENAME_PREFIX = "outline_"
+
+
+class OutlineService:
+    """书签编辑服务"""
+
+    def read(self, path: Path) -> Tuple[List[OutlineItem], int]:
+        """
+        读取书签树
+
+        Args:
+            path: PDF文件
+
+        Returns:
+            书签树和文件页数
+        """
+        with fitz.open(str(path)) as doc:
+            return self._to_tree(doc.get_toc(simple=True)), doc.page_count
+
+    def write(self, source: Path, output_dir: Path, items: List[OutlineItem]) -> Tuple[str, int]:
+        """
+        生成书签替换为items的副本，并删除之前编辑生成的副本
+
+        Args:
+            source: 原文件
+            output_dir: 输出目录
+            items: 新的书签树，为空时删除全部书签
+
+        Returns:
+            副本文件名和书签总数
+
+        Raises:
+            InvalidRangeError: 书签指向的页码超出文件页数
+        """
+        toc = self._to_toc(items)
+        output_dir.mkdir(parents=True, exist_ok=True)
+        working = output_dir / f".{OUTLINE_FILENAME_PREFIX}editing.pdf"
+        rewritten: Optional[Path] = None
+        shutil.copyfile(source, working)
+        try:
+            with fitz.open(str(working)) as doc:
+                for _, title, page in toc:
+                    if page > doc.page_count:
+                        raise InvalidRangeError(f"书签“{title}”指向第 {page} 页，超出总页数 {doc.page_count}")
+                doc.set_toc(toc)
+                if doc.can_save_incrementally():
+                    doc.saveIncr()
+                else:
+                    rewritten = working.with_name(f".{OUTLINE_FILENAME_PREFIX}rewritten.pdf")
+                    doc.save(str(rewritten), garbage=1)
+            if rewritten:
+                rewritten.replace(working)
+
+            filename = f"{OUTLINE_FILENAME_PREFIX}{self._sha256(working)[:12]}.pdf"
+            for previous in output_dir.glob(f"{OUTLINE_FILENAME_PREFIX}*.pdf"):
+                if previous.name != filename:
+                    previous.unlink(missing_ok=True)
+            working.replace(output_dir / filename)
+        finally:
+            working.unlink(missing_ok=True)
+            if rewritten:
+                rewritten.unlink(missing_ok=True)
+
+        logger.info(f"已生成编辑书签后的副本: {output_dir / filename}，书签 {len(toc)} 个")
+        return filename, len(toc)
+
+    @staticmethod
+    def _to_tree(toc: List[list]) -> List[OutlineItem]:
+        """把 [层级, 标题, 页码] 列表转换为书签树，没有目标页的书签页码为空"""
+        roots: List[OutlineItem] = []
+        stack: List[OutlineItem] = []
+        for level, title, page in toc:
+            item = OutlineItem(title=title, page=page if page > 0 else None)
+            del stack[level - 1:]
+            (stack[-1].children if stack else roots).append(item)
+            stack.append(item)
+        return roots
+
+    @staticmethod
+    def _to_toc(items: List[OutlineItem], level: int = 1) -> List[list]:
+        """把书签树展开为 [层级, 标题, 页码] 列表"""
+        toc = []
+        for item in items:
+            toc.append([level, item.title, item.page or -1])
+            toc.extend(OutlineService._to_toc(item.children, level + 1))
+        return toc
+
+    @staticmethod
+    def _sha256(path: Path) -> str:
+        digest = hashlib.sha256()
+        with open(path, "rb") as f:
+            while chunk := f.read(1024 * 1024):
+                digest.update(chunk)
+        return digest.hexdigest()
+
+
+# 创建全局书签编辑服务实例
+outline_service = OutlineService()
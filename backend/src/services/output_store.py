@@ -0,0 +1,287 @@
+"""
+章节输出共享存储
+水平扩展模式下拆分完成的章节文件和校验清单上传到S3兼容的对象存储，
+任何副本都可以通过流式转发或签名URL重定向提供下载，不再要求由执行拆分的副本提供。
+本地副本记录对应的校验清单版本（ETag），共享存储中的输出被重新拆分或删除后，本地副本随之更新或删除
+"""
+
+import asyncio
+import posixpath
+from pathlib import Path
+from typing import AsyncIterator, List, Optional, Tuple
+from urllib.parse import quote
+
+from loguru import logger
+
+from ..models.schemas import OutputManifest
+from ..core.config import settings
+from .pdf_splitter import MANIFEST_FILENAME
+
+
+# 本地章节目录中记录校验清单版本的文件
+VERSION_FILENAME = ".manifest.etag"
+
+
+def _is_not_found(error: Exception) -> bool:
+    """botocore的ClientError是否表示对象不存在"""
+    code = getattr(error, "response", {}).get("Error", {}).get("Code")
+    return code in ("NoSuchKey", "404", "NotFound")
+
+
+class OutputStore:
+    """章节输出的共享对象存储"""
+
+    def __init__(self):
+        self._s3 = None
+
+    @property
+    def enabled(self) -> bool:
+        """是否启用共享存储（OUTPUT_STORE=s3）"""
+        return settings.OUTPUT_STORE.lower() == "s3"
+
+    @property
+    def redirect(self) -> bool:
+        """下载时是否重定向到签名URL（否则由当前副本流式转发）"""
+        return settings.DOWNLOAD_MODE.lower() == "redirect"
+
+    async def publish(self, tenant_id: str, file_id: str, output_dir: Path, filenames: List[str]) -> int:
+        """
+        上传章节文件和校验清单，校验清单最后上传，其他副本据此判断输出是否完整
+
+        Args:
+            tenant_id: 租户ID
+            file_id: 文件ID
+            output_dir: 本地章节目录
+            filenames: 章节文件名
+
+        Returns:
+            上传的文件数量
+        """
+        names = [name for name in filenames if (output_dir / name).exists()]
+        if (output_dir / MANIFEST_FILENAME).exists():
+            names.append(MANIFEST_FILENAME)
+
+        def upload():
+            client = self._client()
+            for name in names:
+                client.upload_file(str(output_dir / name), settings.OUTPUT_S3_BUCKET, self._key(tenant_id, file_id, name))
+            # 执行拆分的副本本地的输出即为当前版本
+            version = self._head_version(client, tenant_id, file_id)
+            if version:
+                (output_dir / VERSION_FILENAME).write_text(version, encoding="utf-8")
+
+        await asyncio.get_running_loop().run_in_executor(None, upload)
+        logger.info(f"章节输出已上传到共享存储: {tenant_id}/{file_id} ({len(names)} 个文件)")
+        return len(names)
+
+    async def manifest_version(self, tenant_id: str, file_id: str) -> Optional[str]:
+        """
+        共享存储中校验清单的版本
+
+        Args:
+            tenant_id: 租户ID
+            file_id: 文件ID
+
+        Returns:
+            校验清单的ETag，输出不存在时返回None
+        """
+        return await asyncio.get_running_loop().run_in_executor(
+            None, lambda: self._head_version(self._client(), tenant_id, file_id)
+        )
+
+    @staticmethod
+    def local_version(output_dir: Path) -> Optional[str]:
+        """本地章节目录对应的校验清单版本，不是从共享存储拉取或上传的输出时为None"""
+        try:
+            return (output_dir / VERSION_FILENAME).read_text(encoding="utf-8").strip() or None
+        except FileNotFoundError:
+            return None
+
+    async def delete(self, tenant_id: str, file_id: str) -> int:
+        """
+        删除共享存储中该文件的全部章节输出，校验清单最先删除，其他副本随即不再信任本地副本
+
+        Args:
+            tenant_id: 租户ID
+            file_id: 文件ID
+
+        Returns:
+            删除的对象数量
+        """
+        prefix = self._key(tenant_id, file_id, "")
+
+        def remove() -> int:
+            client = self._client()
+            client.delete_object(Bucket=settings.OUTPUT_S3_BUCKET, Key=self._key(tenant_id, file_id, MANIFEST_FILENAME))
+            keys = []
+            for page in client.get_paginator("list_objects_v2").paginate(Bucket=settings.OUTPUT_S3_BUCKET, Prefix=prefix):
+                keys += [{"Key": item["Key"]} for item in page.get("Contents", [])]
+            # DeleteObjects每次最多1000个键
+            for start in range(0, len(keys), 1000):
+                client.delete_objects(Bucket=settings.OUTPUT_S3_BUCKET, Delete={"Objects": keys[start:start + 1000], "Quiet": True})
+            return len(keys)
+
+        removed = await asyncio.get_running_loop().run_in_executor(None, remove)
+        logger.info(f"已删除共享存储中的章节输出: {tenant_id}/{file_id} ({removed} 个对象)")
+        return removed
+
+    async def open(self, tenant_id: str, file_id: str, filename: str) -> Optional[Tuple[AsyncIterator[bytes], int]]:
+        """
+        打开共享存储中的文件用于流式转发
+
+        Args:
+            tenant_id: 租户ID
+            file_id: 文件ID
+            filename: 文件名
+
+        Returns:
+            (数据块迭代器, 文件大小)，文件不存在时返回None
+        """
+        loop = asyncio.get_running_loop()
+        key = self._key(tenant_id, file_id, filename)
+        try:
+            response = await loop.run_in_executor(
+                None, lambda: self._client().get_object(Bucket=settings.OUTPUT_S3_BUCKET, Key=key)
+            )
+        except Exception as e:
+            if _is_not_found(e):
+                return None
+            raise
+
+        body = response["Body"]
+
+        async def iterate() -> AsyncIterator[bytes]:
+            try:
+                while chunk := await loop.run_in_executor(None, body.read, settings.COPY_BUFFER_SIZE):
+                    yield chunk
+            finally:
+                body.close()
+
+        return iterate(), response.get("ContentLength", 0)
+
+    async def signed_url(
+        self,
+        tenant_id: str,
+        file_id: str,
+        filename: str,
+        download: bool = True
+    ) -> Optional[str]:
+        """
+        生成有时效的下载地址
+
+        Args:
+            tenant_id: 租户ID
+            file_id: 文件ID
+            filename: 文件名
+            download: 是否以附件形式下载
+
+        Returns:
+            签名URL，文件不存在时返回None
+        """
+        key = self._key(tenant_id, file_id, filename)
+        disposition = "attachment" if download else "inline"
+
+        def sign():
+            client = self._client()
+            try:
+                client.head_object(Bucket=settings.OUTPUT_S3_BUCKET, Key=key)
+            except Exception as e:
+                if _is_not_found(e):
+                    return None
+                raise
+            return client.generate_presigned_url(
+                "get_object",
+                Params={
+                    "Bucket": settings.OUTPUT_S3_BUCKET,
+                    "Key": key,
+                    "ResponseContentType": "application/pdf",
+                    "ResponseContentDisposition": f"{disposition}; filename*=UTF-8''{quote(filename)}",
+                },
+                ExpiresIn=settings.DOWNLOAD_URL_TTL
+            )
+
+        return await asyncio.get_running_loop().run_in_executor(None, sign)
+
+    async def fetch(self, tenant_id: str, file_id: str, output_dir: Path) -> bool:
+        """
+        把共享存储中的章节输出下载到本地目录，用于清单查询和打包下载；本地副本的版本与共享存储不一致时重新下载全部章节
+
+        Args:
+            tenant_id: 租户ID
+            file_id: 文件ID
+            output_dir: 本地章节目录
+
+        Returns:
+            共享存储中是否存在该文件的输出
+        """
+        def download() -> bool:
+            client = self._client()
+            manifest_path = output_dir / MANIFEST_FILENAME
+            output_dir.mkdir(parents=True, exist_ok=True)
+            tmp_manifest = manifest_path.with_name(MANIFEST_FILENAME + ".tmp")
+            version = self._head_version(client, tenant_id, file_id)
+            if version is None:
+                return False
+            try:
+                client.download_file(settings.OUTPUT_S3_BUCKET, self._key(tenant_id, file_id, MANIFEST_FILENAME), str(tmp_manifest))
+            except Exception as e:
+                if _is_not_found(e):
+                    return False
+                raise
+
+            # 版本一致时只补齐缺失的章节，否则（重新拆分后）全部覆盖
+            current = self.local_version(output_dir) == version and manifest_path.exists()
+            manifest_path.unlink(missing_ok=True)
+            manifest = OutputManifest.model_validate_json(tmp_manifest.read_text(encoding="utf-8"))
+            for entry in manifest.files:
+                if Path(entry.filename).name != entry.filename:
+                    continue
+                target = output_dir / entry.filename
+                if current and target.exists():
+                    continue
+                partial = target.with_name(f".{entry.filename}.part")
+                client.download_file(settings.OUTPUT_S3_BUCKET, self._key(tenant_id, file_id, entry.filename), str(partial))
+                partial.replace(target)
+
+            # 清单最后落盘，避免并发请求看到不完整的本地副本
+            (output_dir / VERSION_FILENAME).write_text(version, encoding="utf-8")
+            tmp_manifest.replace(manifest_path)
+            return True
+
+        fetched = await asyncio.get_running_loop().run_in_executor(None, download)
+        if fetched:
+            logger.info(f"已从共享存储拉取章节输出: {tenant_id}/{file_id}")
+        return fetched
+
+    def _head_version(self, client, tenant_id: str, file_id: str) -> Optional[str]:
+        """读取校验清单的ETag，不存在时返回None"""
+        try:
+            response = client.head_object(Bucket=settings.OUTPUT_S3_BUCKET, Key=self._key(tenant_id, file_id, MANIFEST_FILENAME))
+        except Exception as e:
+            if _is_not_found(e):
+                return None
+            raise
+        return str(response.get("ETag", "")).strip('"') or None
+
+    def _key(self, tenant_id: str, file_id: str, filename: str) -> str:
+        return posixpath.join(settings.OUTPUT_S3_PREFIX.strip("/"), tenant_id, file_id, filename)
+
+    def _client(self):
+        if self._s3 is None:
+            try:
+                import boto3
+            except ImportError:
+                raise RuntimeError("共享输出存储需要安装boto3")
+
+            self._s3 = boto3.client(
+                "s3",
+                aws_access_key_id=settings.OUTPUT_S3_ACCESS_KEY_ID or None,
+                aws_secret_access_key=settings.OUTPUT_S3_SECRET_ACCESS_KEY or None,
+                region_name=settings.OUTPUT_S3_REGION or None,
+                endpoint_url=settings.OUTPUT_S3_ENDPOINT_URL or None
+            )
+        return self._s3
+
+
+# 创建全局输出存储实例
+output_store = OutputStore()
@@ -7,24 +7,97 @@ import re
 import fitz  # PyMuPDF
 import os
 import uuid
-from typing import List, Tuple, Optional, Dict, Any
+from typing import List, Tuple, Optional, Dict, Any, Callable
 from loguru import logger
 
-from ..models.schemas import ChapterInfo, PDFMetadata, ValidationResult, SectionInfo, KnowledgePoint
+from ..models.schemas import (
+    ChapterInfo,
+    PDFMetadata,
+    ValidationResult,
+    SectionInfo,
+    KnowledgePoint,
+    BoundaryAdjustment,
+    ChapterMerge,
+    ChapterGroup,
+    SectionType,
+    SectionHandling,
+    WarningCode
+)
 from ..core.config import settings
+from ..core.diagnostics import add_warning
+from ..core.document_cache import document_cache
+from .language_detector import detect_language
+from .text_stats import count_characters, count_words, reading_minutes
 from .llm_service import llm_service
 
 
+# 区域类型关键词，按语言分组（组内按优先级匹配标题或页面文本）
+SECTION_KEYWORDS = {
+    "zh": [
+        (SectionType.TOC, ["目录"]),
+        (SectionType.PREFACE, ["前言", "序言", "引言", "致谢"]),
+        (SectionType.APPENDIX, ["附录"]),
+        (SectionType.BIBLIOGRAPHY, ["参考文献"]),
+        (SectionType.INDEX, ["索引"]),
+    ],
+    "en": [
+        (SectionType.TOC, ["contents", "table of contents"]),
+        (SectionType.PREFACE, ["preface", "foreword", "acknowledgments", "acknowledgements"]),
+        (SectionType.APPENDIX, ["appendix"]),
+        (SectionType.BIBLIOGRAPHY, ["bibliography", "references", "works cited"]),
+        (SectionType.INDEX, ["index"]),
+    ],
+    "de": [
+        (SectionType.TOC, ["inhaltsverzeichnis", "inhalt"]),
+        (SectionType.PREFACE, ["vorwort", "geleitwort", "danksagung"]),
+        (SectionType.APPENDIX, ["anhang"]),
+        (SectionType.BIBLIOGRAPHY, ["literaturverzeichnis", "literatur", "quellenverzeichnis"]),
+        (SectionType.INDEX, ["stichwortverzeichnis", "register", "index"]),
+    ],
+    "fr": [
+        (SectionType.TOC, ["table des matières", "sommaire"]),
+        (SectionType.PREFACE, ["préface", "avant-propos", "remerciements"]),
+        (SectionType.APPENDIX, ["annexe"]),
+        (SectionType.BIBLIOGRAPHY, ["bibliographie", "références"]),
+        (SectionType.INDEX, ["index"]),
+    ],
+}
+
+# 识别语言时最多取样的页数（在页面范围内均匀分布）
+LANGUAGE_SAMPLE_PAGES = 5
+
+# 前置区域类型（合并时并入后一章）
+FRONT_SECTION_TYPES = {SectionType.COVER, SectionType.FRONT_MATTER, SectionType.PREFACE, SectionType.TOC}
+
+# 查找印刷目录页时扫描的开头页数
+TOC_SCAN_PAGES = 20
+
+# 印刷目录条目：标题、引导符（点线或连续空白）和印刷页码
+TOC_ENTRY_PATTERN = re.compile(r"^(?P<title>.+?)\s*(?:\.{2,}|…+|·{2,}|\s{2,})\s*(?P<page>\d{1,4})$")
+
+
 class PDFAnalyzer:
     """PDF章节分析器"""
     
-    def __init__(self):
+    def __init__(self, chapter_patterns: Optional[List[str]] = None):
+        """
+        Args:
+            chapter_patterns: 章节标题正则，为空时使用配置中的CHAPTER_PATTERNS
+        """
         self.chapter_patterns = [
             re.compile(pattern, re.IGNORECASE) 
-            for pattern in settings.CHAPTER_PATTERNS
+            for pattern in (chapter_patterns or settings.CHAPTER_PATTERNS)
         ]
     
-    async def analyze_pdf(self, file_path: str, file_id: str, use_llm: bool = True) -> Tuple[List[ChapterInfo], PDFMetadata]:
+    async def analyze_pdf(
+        self,
+        file_path: str,
+        file_id: str,
+        use_llm: bool = True,
+        progress_callback: Optional[Callable[[int], None]] = None,
+        doc_key: Optional[str] = None,
+        page_offset: Optional[int] = None
+    ) -> Tuple[List[ChapterInfo], PDFMetadata]:
         """
         分析PDF文件，提取章节信息
         
@@ -32,40 +105,70 @@ class PDFAnalyzer:
             file_path: PDF文件路径
             file_id: 文件唯一标识
             use_llm: 是否使用大模型增强分析
+            progress_callback: 进度回调函数
+            doc_key: 文档缓存键（文件内容哈希），为空时不使用缓存
+            page_offset: 已校准的印刷页码偏移量，设置后没有书签时按印刷目录页中的页码定位章节
             
         Returns:
             章节列表和PDF元数据的元组
         """
         try:
-            # 打开PDF文件
-            doc = fitz.open(file_path)
-            
-            # 获取PDF基本信息
-            pdf_metadata = self._get_pdf_metadata(doc, file_path, file_id)
-            
-            # 尝试从书签提取章节
-            chapters = self._extract_from_bookmarks(doc)
-            
-            # 如果书签提取失败，尝试文本模式识别
-            if not chapters:
-                chapters = self._extract_from_text_patterns(doc)
-            
-            # 如果仍然没有章节，生成默认分割建议
-            if not chapters:
-                chapters = self._generate_default_chapters(pdf_metadata.total_pages)
-            
-            # 验证和修正章节信息
-            chapters = self._validate_chapters(chapters, pdf_metadata.total_pages)
-            
-            # 如果启用大模型分析，提取节和知识点
-            if use_llm and chapters:
-                chapters = await self._enhance_with_llm(doc, chapters)
-            
-            # 更新PDF元数据
-            pdf_metadata.chapters = chapters
-            pdf_metadata.status = "analyzed"
+            # 打开PDF文件（与拆分共用已解析的文档）
+            with document_cache.open(file_path, doc_key) as doc:
+                
+                # 获取PDF基本信息
+                pdf_metadata = self._get_pdf_metadata(doc, file_path, file_id)
+                pdf_metadata.language = self._detect_language(doc, 1, pdf_metadata.total_pages)
+                
+                # 尝试从书签提取章节
+                chapters = self._extract_from_bookmarks(doc)
+                
+                # 没有书签但已校准印刷页码时，按印刷目录中的页码定位章节
+                if not chapters and page_offset is not None:
+                    chapters = self._extract_from_toc_pages(doc, page_offset)
+                
+                # 如果书签提取失败，尝试文本模式识别
+                if not chapters:
+                    chapters = self._extract_from_text_patterns(doc)
+                
+                # 如果仍然没有章节，生成默认分割建议
+                if not chapters:
+                    chapters = self._generate_default_chapters(pdf_metadata.total_pages)
+                    add_warning(
+                        WarningCode.NO_STRUCTURE_DETECTED,
+                        "未识别到书签或章节标题，已按页数生成默认分割，请人工确认",
+                        chapters=len(chapters)
+                    )
+                
+                # 标注区域类型，并识别第一章之前的前置内容
+                chapters = self._classify_sections(chapters, pdf_metadata.language)
+                if chapters and chapters[0].start_page > 1:
+                    chapters = self._detect_front_matter(doc, chapters[0].start_page, pdf_metadata.language) + chapters
+                
+                # 验证和修正章节信息
+                chapters = self._validate_chapters(chapters, pdf_metadata.total_pages)
+                
+                # 识别各章节语言（文字过少的章节如封面沿用文档语言），统计字数、阅读时间、图片和表格数
+                chapters = [self._annotate_chapter(doc, chapter, pdf_metadata.language) for chapter in chapters]
+                
+                if progress_callback:
+                    progress_callback(30 if use_llm else 90)
+                
+                # 如果启用大模型分析，提取节和知识点
+                if use_llm and chapters:
+                    chapters = await self._enhance_with_llm(doc, chapters, progress_callback)
+                
+                # 标注逻辑页码
+                if pdf_metadata.has_page_labels:
+                    chapters = self._annotate_page_labels(chapters, self.get_page_labels(doc))
+                
+                # 更新PDF元数据
+                pdf_metadata.chapters = chapters
+                pdf_metadata.status = "analyzed"
+                
             
-            doc.close()
+            if progress_callback:
+                progress_callback(100)
             
             logger.info(f"PDF分析完成: {len(chapters)}个章节, 总页数: {pdf_metadata.total_pages}")
             return chapters, pdf_metadata
@@ -74,13 +177,19 @@ class PDFAnalyzer:
             logger.error(f"PDF分析失败: {str(e)}")
             raise
     
-    async def _enhance_with_llm(self, doc: fitz.Document, chapters: List[ChapterInfo]) -> List[ChapterInfo]:
+    async def _enhance_with_llm(
+        self,
+        doc: fitz.Document,
+        chapters: List[ChapterInfo],
+        progress_callback: Optional[Callable[[int], None]] = None
+    ) -> List[ChapterInfo]:
         """
         使用大模型增强章节分析，提取节和知识点
         
         Args:
             doc: PDF文档对象
             chapters: 章节列表
+            progress_callback: 进度回调函数（30%-90%区间）
             
         Returns:
             增强后的章节列表
@@ -95,7 +204,11 @@ class PDFAnalyzer:
                 chapter_text = self._extract_text_from_pages(doc, chapter.start_page, chapter.end_page)
                 
                 # 使用大模型分析章节内容
-                analysis_result = await llm_service.analyze_pdf_content(chapter_text, context=chapter.title)
+                analysis_result = await llm_service.analyze_pdf_content(
+                    chapter_text,
+                    context=chapter.title,
+                    language=chapter.language
+                )
                 
                 # 生成章节ID
                 chapter_id = str(uuid.uuid4())
@@ -107,6 +220,13 @@ class PDFAnalyzer:
                     start_page=chapter.start_page,
                     end_page=chapter.end_page,
                     page_count=chapter.page_count,
+                    section_type=chapter.section_type,
+                    language=chapter.language,
+                    word_count=chapter.word_count,
+                    character_count=chapter.character_count,
+                    reading_minutes=chapter.reading_minutes,
+                    image_count=chapter.image_count,
+                    table_count=chapter.table_count,
                     sections=[]
                 )
                 
@@ -153,12 +273,16 @@ class PDFAnalyzer:
                                 enhanced_chapter.sections.append(section)
                 
                 enhanced_chapters.append(enhanced_chapter)
+                
+                if progress_callback:
+                    progress_callback(30 + int(len(enhanced_chapters) / len(chapters) * 60))
             
             logger.info(f"大模型增强分析完成")
             return enhanced_chapters
             
         except Exception as e:
             logger.error(f"大模型增强分析失败: {str(e)}")
+            add_warning(WarningCode.LLM_ENHANCEMENT_FAILED, f"大模型增强分析失败，返回基础识别结果: {str(e)}")
             return chapters
     
     def _extract_text_from_pages(self, doc: fitz.Document, start_page: int, end_page: int) -> str:
@@ -180,11 +304,95 @@ class PDFAnalyzer:
         end_idx = min(len(doc) - 1, end_page - 1)
         
         for page_num in range(start_idx, end_idx + 1):
-            page = doc[page_num]
-            text += page.get_text() + "\n"
+            try:
+                text += doc[page_num].get_text() + "\n"
+            except Exception as e:
+                self._page_unreadable(page_num + 1, e)
+        
+        return text
+    
+    def _detect_language(self, doc: fitz.Document, start_page: int, end_page: int) -> Optional[str]:
+        """
+        取样页面范围内均匀分布的若干页识别语言
+        
+        Args:
+            doc: PDF文档对象
+            start_page: 起始页码（从1开始）
+            end_page: 结束页码
+            
+        Returns:
+            ISO 639-1语言代码，无法判断时为None
+        """
+        pages = list(range(max(1, start_page), min(len(doc), end_page) + 1))
+        step = max(1, len(pages) // LANGUAGE_SAMPLE_PAGES)
+        return detect_language(self._pages_text(doc, pages[::step][:LANGUAGE_SAMPLE_PAGES]))
+    
+    def _annotate_chapter(self, doc: fitz.Document, chapter: ChapterInfo, document_language: Optional[str]) -> ChapterInfo:
+        """标注章节语言、字数、字符数、估算阅读时间以及图片和表格数"""
+        language = self._detect_language(doc, chapter.start_page, chapter.end_page) or document_language
+        pages = range(chapter.start_page, min(len(doc), chapter.end_page) + 1)
+        text = self._pages_text(doc, pages)
+        words = count_words(text)
+        image_count, table_count = self._count_figures(doc, pages)
+        return chapter.model_copy(update={
+            "language": language,
+            "word_count": words,
+            "character_count": count_characters(text),
+            "reading_minutes": reading_minutes(words, language),
+            "image_count": image_count,
+            "table_count": table_count
+        })
+    
+    @staticmethod
+    def _count_figures(doc: fitz.Document, pages) -> Tuple[int, int]:
+        """
+        统计页面中的图片和表格数
         
+        Args:
+            doc: PDF文档对象
+            pages: 页码（从1开始）
+            
+        Returns:
+            (图片数, 表格数)，同一图片在多页重复出现（如页眉标志）只计一次
+        """
+        images = set()
+        tables = 0
+        for page_num in pages:
+            try:
+                page = doc[page_num - 1]
+                images.update(image[0] for image in page.get_images())
+                tables += len(page.find_tables().tables)
+            except Exception:
+                continue
+        return len(images), tables
+    
+    @staticmethod
+    def _pages_text(doc: fitz.Document, pages) -> str:
+        """拼接指定页面（从1开始）的文本，无法读取的页面已在章节识别时记录警告，这里直接跳过"""
+        text = ""
+        for page_num in pages:
+            try:
+                text += doc[page_num - 1].get_text() + "\n"
+            except Exception:
+                continue
         return text
     
+    def get_total_pages(self, file_path: str) -> int:
+        """
+        获取PDF总页数
+        
+        Args:
+            file_path: PDF文件路径
+            
+        Returns:
+            总页数
+        """
+        doc = fitz.open(file_path)
+        try:
+            return len(doc)
+        finally:
+            doc.close()
+    
     def _get_pdf_metadata(self, doc: fitz.Document, file_path: str, file_id: str) -> PDFMetadata:
         """获取PDF基本信息"""
         total_pages = len(doc)
@@ -194,6 +402,9 @@ class PDFAnalyzer:
         # 检查是否有书签
         has_bookmarks = len(doc.get_toc()) > 0
         
+        # 检查是否定义了页码标签
+        has_page_labels = len(doc.get_page_labels()) > 0
+        
         # 检查是否有可提取的文本
         has_text = False
         if total_pages > 0:
@@ -207,11 +418,474 @@ class PDFAnalyzer:
             total_pages=total_pages,
             file_size=file_size,
             has_bookmarks=has_bookmarks,
-            has_text=has_text
+            has_text=has_text,
+            has_page_labels=has_page_labels
         )
     
-    def _extract_from_bookmarks(self, doc: fitz.Document) -> List[ChapterInfo]:
-        """从PDF书签提取章节信息"""
+    def get_page_labels(self, doc: fitz.Document) -> List[str]:
+        """
+        获取每个物理页的逻辑页码标签
+        
+        Args:
+            doc: PDF文档对象
+            
+        Returns:
+            按物理页顺序的标签列表，未定义页码标签时返回空列表
+        """
+        if not doc.get_page_labels():
+            return []
+        
+        return [page.get_label() or str(page.number + 1) for page in doc]
+    
+    def get_page_labels_from_file(self, file_path: str) -> List[str]:
+        """
+        读取PDF文件的逻辑页码标签
+        
+        Args:
+            file_path: PDF文件路径
+            
+        Returns:
+            按物理页顺序的标签列表
+        """
+        doc = fitz.open(file_path)
+        try:
+            return self.get_page_labels(doc)
+        finally:
+            doc.close()
+    
+    def _annotate_page_labels(self, chapters: List[ChapterInfo], labels: List[str]) -> List[ChapterInfo]:
+        """为章节补充起止页的逻辑页码"""
+        if not labels:
+            return chapters
+        
+        return [
+            chapter.model_copy(update={
+                "start_label": labels[chapter.start_page - 1],
+                "end_label": labels[chapter.end_page - 1]
+            })
+            for chapter in chapters
+        ]
+    
+    def resolve_logical_pages(self, file_path: str, chapters: List[ChapterInfo]) -> List[ChapterInfo]:
+        """
+        将逻辑页码（页码标签）转换为物理页码
+        
+        标签可能在文档中重复出现（如每部分重新从1开始），
+        起始页取第一次出现的位置，结束页取起始页之后第一次出现的位置
+        
+        Args:
+            file_path: PDF文件路径
+            chapters: 使用逻辑页码的章节列表
+            
+        Returns:
+            使用物理页码的章节列表
+            
+        Raises:
+            ValueError: 页码标签在文档中不存在
+        """
+        doc = fitz.open(file_path)
+        try:
+            labels = self.get_page_labels(doc) or [str(i + 1) for i in range(len(doc))]
+        finally:
+            doc.close()
+        
+        positions: Dict[str, List[int]] = {}
+        for index, label in enumerate(labels):
+            positions.setdefault(label, []).append(index + 1)
+        
+        resolved = []
+        for chapter in chapters:
+            start_label = chapter.start_label or str(chapter.start_page)
+            end_label = chapter.end_label or str(chapter.end_page)
+            
+            if start_label not in positions:
+                raise ValueError(f"页码标签不存在: {start_label}（章节: {chapter.title}）")
+            start_page = positions[start_label][0]
+            
+            end_candidates = [page for page in positions.get(end_label, []) if page >= start_page]
+            if not end_candidates:
+                raise ValueError(f"页码标签不存在或位于起始页之前: {end_label}（章节: {chapter.title}）")
+            end_page = end_candidates[0]
+            
+            resolved.append(chapter.model_copy(update={
+                "start_page": start_page,
+                "end_page": end_page,
+                "page_count": end_page - start_page + 1,
+                "start_label": start_label,
+                "end_label": end_label
+            }))
+        
+        return resolved
+    
+    def apply_page_offset(self, chapters: List[ChapterInfo], page_offset: int, total_pages: int) -> List[ChapterInfo]:
+        """
+        将印刷页码换算为物理页码
+        
+        Args:
+            chapters: 使用印刷页码的章节列表
+            page_offset: 偏移量（物理页 = 印刷页 + 偏移量）
+            total_pages: 文档总页数
+            
+        Returns:
+            使用物理页码的章节列表
+            
+        Raises:
+            ValueError: 换算后的页码超出文档范围
+        """
+        resolved = []
+        for chapter in chapters:
+            start_page = chapter.start_page + page_offset
+            end_page = chapter.end_page + page_offset
+            if start_page < 1:
+                raise ValueError(f"印刷页码 {chapter.start_page} 换算后超出文档范围（章节: {chapter.title}）")
+            if end_page > total_pages:
+                raise ValueError(
+                    f"印刷页码 {chapter.end_page} 换算后为第 {end_page} 页，超出总页数 {total_pages}（章节: {chapter.title}）"
+                )
+            
+            resolved.append(chapter.model_copy(update={
+                "start_page": start_page,
+                "end_page": end_page,
+                "page_count": end_page - start_page + 1
+            }))
+        
+        return resolved
+    
+    def _match_section_type(self, text: str, language: Optional[str] = None) -> Optional[SectionType]:
+        """
+        根据标题开头的关键词匹配区域类型
+        
+        Args:
+            text: 标题或页面首行
+            language: 文档语言，已知时只使用该语言和英文的关键词（英文标题在各语言文档中都很常见），否则使用全部语言
+            
+        Returns:
+            匹配到的区域类型，未匹配时为None
+        """
+        normalized = text.strip().lower()
+        if language in SECTION_KEYWORDS:
+            groups = [SECTION_KEYWORDS[language]] + ([SECTION_KEYWORDS["en"]] if language != "en" else [])
+        else:
+            groups = list(SECTION_KEYWORDS.values())
+        for section_type, keywords in (entry for group in groups for entry in group):
+            for keyword in keywords:
+                if not normalized.startswith(keyword):
+                    continue
+                # 英文关键词需要完整单词匹配，避免 "indexing" 误判为索引
+                if keyword.isascii() and normalized[len(keyword):len(keyword) + 1].isalpha():
+                    continue
+                return section_type
+        return None
+    
+    def _classify_sections(self, chapters: List[ChapterInfo], language: Optional[str] = None) -> List[ChapterInfo]:
+        """
+        根据标题标注章节的区域类型
+        
+        Args:
+            chapters: 章节列表
+            language: 文档语言
+            
+        Returns:
+            标注了section_type的章节列表
+        """
+        classified = []
+        for chapter in chapters:
+            section_type = self._match_section_type(chapter.title, language) or SectionType.CHAPTER
+            classified.append(chapter.model_copy(update={"section_type": section_type}))
+        return classified
+    
+    def _detect_front_matter(self, doc: fitz.Document, first_chapter_page: int, language: Optional[str] = None) -> List[ChapterInfo]:
+        """
+        识别第一章之前的前置内容（封面、前言、目录等）
+        
+        Args:
+            doc: PDF文档对象
+            first_chapter_page: 第一章的起始页码
+            language: 文档语言
+            
+        Returns:
+            前置区域列表，相邻同类页面合并为一个区域
+        """
+        titles = {
+            SectionType.COVER: "封面",
+            SectionType.PREFACE: "前言",
+            SectionType.TOC: "目录",
+            SectionType.FRONT_MATTER: "前置内容",
+        }
+        
+        page_types = []
+        for page_num in range(1, first_chapter_page):
+            text = doc[page_num - 1].get_text().strip()
+            first_line = text.split("\n", 1)[0] if text else ""
+            
+            if page_num == 1 and len(text) < 200:
+                page_type = SectionType.COVER
+            else:
+                page_type = self._match_section_type(first_line, language)
+                if page_type not in FRONT_SECTION_TYPES:
+                    page_type = None
+                # 目录页通常延续多页，没有标题时沿用上一页的类型
+                if page_type is None and page_types and page_types[-1] == SectionType.TOC and re.search(r"\.{4,}|…{2,}", text):
+                    page_type = SectionType.TOC
+                page_type = page_type or SectionType.FRONT_MATTER
+            
+            page_types.append(page_type)
+        
+        regions: List[ChapterInfo] = []
+        for index, page_type in enumerate(page_types):
+            page_num = index + 1
+            if regions and regions[-1].section_type == page_type:
+                last = regions[-1]
+                regions[-1] = last.model_copy(update={"end_page": page_num, "page_count": page_num - last.start_page + 1})
+            else:
+                regions.append(ChapterInfo(
+                    title=titles[page_type],
+                    start_page=page_num,
+                    end_page=page_num,
+                    page_count=1,
+                    section_type=page_type
+                ))
+        
+        if regions:
+            logger.info(f"识别到 {len(regions)} 个前置区域")
+        return regions
+    
+    def merge_small_chapters(
+        self,
+        chapters: List[ChapterInfo],
+        min_pages: int
+    ) -> Tuple[List[ChapterInfo], List[ChapterMerge]]:
+        """
+        将少于min_pages页的章节并入前一章（第一章过短时并入后一章）
+        
+        常见于题记、插页等只有一两页的书签
+        
+        Args:
+            chapters: 章节列表
+            min_pages: 每章最少页数
+            
+        Returns:
+            合并后的章节列表和合并记录
+        """
+        if min_pages <= 1 or len(chapters) <= 1:
+            return chapters, []
+        
+        result: List[ChapterInfo] = []
+        merges: List[ChapterMerge] = []
+        carry: Optional[ChapterInfo] = None
+        
+        for chapter in sorted(chapters, key=lambda ch: ch.start_page):
+            if carry:
+                merges.append(ChapterMerge(
+                    title=carry.title,
+                    start_page=carry.start_page,
+                    end_page=carry.end_page,
+                    merged_into=chapter.title
+                ))
+                chapter = chapter.model_copy(update={
+                    "start_page": carry.start_page,
+                    "page_count": chapter.end_page - carry.start_page + 1,
+                    "extract": carry.extract or chapter.extract,
+                    **self._merged_stats(carry, chapter)
+                })
+                carry = None
+            
+            # 按页码范围计算页数，不信任客户端提交的page_count
+            if chapter.end_page - chapter.start_page + 1 >= min_pages:
+                result.append(chapter)
+            elif result:
+                previous = result[-1]
+                merges.append(ChapterMerge(
+                    title=chapter.title,
+                    start_page=chapter.start_page,
+                    end_page=chapter.end_page,
+                    merged_into=previous.title
+                ))
+                result[-1] = previous.model_copy(update={
+                    "end_page": max(previous.end_page, chapter.end_page),
+                    "page_count": max(previous.end_page, chapter.end_page) - previous.start_page + 1,
+                    "extract": previous.extract or chapter.extract,
+                    **self._merged_stats(previous, chapter)
+                })
+            else:
+                carry = chapter
+        
+        # 所有章节都过短时保留最后累积的部分
+        if carry:
+            result.append(carry)
+        
+        if merges:
+            logger.info(f"合并了 {len(merges)} 个少于 {min_pages} 页的章节")
+        return result, merges
+    
+    @staticmethod
+    def _merged_stats(target: ChapterInfo, merged: ChapterInfo) -> Dict[str, Any]:
+        """合并章节时累加字数、字符数、图片和表格数，并按目标章节的语言重新估算阅读时间；任一章节缺少统计时不更新"""
+        if target.word_count is None or merged.word_count is None:
+            return {}
+        words = target.word_count + merged.word_count
+        return {
+            "word_count": words,
+            "character_count": (target.character_count or 0) + (merged.character_count or 0),
+            "reading_minutes": reading_minutes(words, target.language),
+            "image_count": (target.image_count or 0) + (merged.image_count or 0),
+            "table_count": (target.table_count or 0) + (merged.table_count or 0)
+        }
+    
+    def apply_section_handling(
+        self,
+        chapters: List[ChapterInfo],
+        default: SectionHandling,
+        overrides: Optional[Dict[SectionType, SectionHandling]] = None
+    ) -> List[ChapterInfo]:
+        """
+        按区域类型处理非正文区域：单独输出、排除或并入相邻章节
+        
+        Args:
+            chapters: 章节列表
+            default: 非正文区域的默认处理方式
+            overrides: 按区域类型覆盖的处理方式
+            
+        Returns:
+            处理后的章节列表
+        """
+        overrides = overrides or {}
+        ordered = sorted(chapters, key=lambda ch: ch.start_page)
+        result: List[ChapterInfo] = []
+        pending_front: List[ChapterInfo] = []
+        
+        for chapter in ordered:
+            if chapter.section_type == SectionType.CHAPTER:
+                mode = SectionHandling.INCLUDE
+            else:
+                mode = overrides.get(chapter.section_type, default)
+            
+            if mode == SectionHandling.EXCLUDE:
+                continue
+            
+            if mode == SectionHandling.MERGE:
+                if chapter.section_type in FRONT_SECTION_TYPES:
+                    pending_front.append(chapter)
+                    continue
+                if result:
+                    previous = result[-1]
+                    result[-1] = previous.model_copy(update={
+                        "end_page": chapter.end_page,
+                        "page_count": chapter.end_page - previous.start_page + 1,
+                        "extract": previous.extract or chapter.extract
+                    })
+                    continue
+            
+            if pending_front:
+                start_page = pending_front[0].start_page
+                chapter = chapter.model_copy(update={
+                    "start_page": start_page,
+                    "page_count": chapter.end_page - start_page + 1,
+                    "extract": chapter.extract or any(front.extract for front in pending_front)
+                })
+                pending_front = []
+            
+            result.append(chapter)
+        
+        # 没有后续章节可并入时保留为独立区域
+        result.extend(pending_front)
+        return result
+    
+    def mark_included(self, chapters: List[ChapterInfo], include: Optional[List[int]]) -> List[ChapterInfo]:
+        """
+        按章节序号标记要输出的章节，其余章节的extract设为False
+        
+        Args:
+            chapters: 章节列表（按提交顺序）
+            include: 要输出的章节序号（从1开始），为空时保持各章节原有的extract
+            
+        Returns:
+            标记后的章节列表
+            
+        Raises:
+            ValueError: 序号超出章节数
+        """
+        if not include:
+            return chapters
+        
+        invalid = sorted(index for index in set(include) if not 1 <= index <= len(chapters))
+        if invalid:
+            raise ValueError(f"章节序号 {', '.join(map(str, invalid))} 超出章节数 {len(chapters)}")
+        
+        selected = set(include)
+        return [
+            chapter.model_copy(update={"extract": i + 1 in selected})
+            for i, chapter in enumerate(chapters)
+        ]
+    
+    def group_chapters(self, chapters: List[ChapterInfo], groups: List[ChapterGroup]) -> List[ChapterInfo]:
+        """
+        把每个分组的连续章节合并为一个章节，成员章节保留在members中
+        
+        Args:
+            chapters: 章节列表（按提交顺序）
+            groups: 分组，按章节序号（从1开始）指定范围
+            
+        Returns:
+            合并后的章节列表，未分组的章节保持不变
+            
+        Raises:
+            ValueError: 分组范围无效、超出章节数或相互重叠
+        """
+        if not groups:
+            return chapters
+        
+        owners: Dict[int, ChapterGroup] = {}
+        for group in groups:
+            if group.first > group.last or group.last > len(chapters):
+                raise ValueError(f"分组“{group.title}”的章节范围 {group.first}-{group.last} 无效，共 {len(chapters)} 个章节")
+            for index in range(group.first, group.last + 1):
+                if index in owners:
+                    raise ValueError(f"分组“{group.title}”与“{owners[index].title}”包含相同的章节 {index}")
+                owners[index] = group
+        
+        result = []
+        for i, chapter in enumerate(chapters, start=1):
+            group = owners.get(i)
+            if not group:
+                result.append(chapter)
+            elif i == group.first:
+                members = chapters[group.first - 1:group.last]
+                start_page = min(member.start_page for member in members)
+                end_page = max(member.end_page for member in members)
+                result.append(ChapterInfo(
+                    title=group.title,
+                    start_page=start_page,
+                    end_page=end_page,
+                    page_count=end_page - start_page + 1,
+                    start_label=members[0].start_label,
+                    end_label=members[-1].end_label,
+                    extract=any(member.extract for member in members),
+                    members=members
+                ))
+        
+        logger.info(f"按 {len(groups)} 个分组合并章节，剩余 {len(result)} 个输出")
+        return result
+    
+    def chapters_from_bookmarks(self, file_path: str, max_depth: int) -> List[ChapterInfo]:
+        """
+        在不超过max_depth层的每个书签处拆分，得到章节列表
+        
+        Args:
+            file_path: PDF文件路径
+            max_depth: 参与拆分的最深书签层级（1为仅顶级书签）
+            
+        Returns:
+            按书签顺序的章节列表，文件没有书签时为空
+        """
+        doc = fitz.open(file_path)
+        try:
+            return self._validate_chapters(self._extract_from_bookmarks(doc, max_depth), len(doc))
+        finally:
+            doc.close()
+    
+    def _extract_from_bookmarks(self, doc: fitz.Document, max_depth: int = 1) -> List[ChapterInfo]:
+        """从PDF书签提取章节信息，max_depth为参与拆分的最深书签层级"""
         chapters = []
         toc = doc.get_toc()
         
@@ -220,8 +894,8 @@ class PDFAnalyzer:
         
         logger.info(f"发现 {len(toc)} 个书签")
         
-        # 过滤顶级章节（level 1）
-        chapter_bookmarks = [item for item in toc if item[0] == 1]
+        # 过滤不超过max_depth层的书签（默认只取顶级章节）
+        chapter_bookmarks = [item for item in toc if item[0] <= max_depth]
         
         for i, bookmark in enumerate(chapter_bookmarks):
             level, title, page_num = bookmark
@@ -242,10 +916,94 @@ class PDFAnalyzer:
                     page_count=end_page - start_page + 1
                 )
                 chapters.append(chapter)
+            elif (
+                i + 1 < len(chapter_bookmarks)
+                and chapter_bookmarks[i + 1][0] > level
+                and chapter_bookmarks[i + 1][2] == start_page
+            ):
+                # 上级书签与其第一个下级书签从同一页开始，没有单独的页面，由下级书签拆分
+                continue
+            else:
+                add_warning(
+                    WarningCode.OUTLINE_INCONSISTENT,
+                    f"书签“{title.strip()}”指向的页码 {page_num} 无效或与后续书签顺序不一致，已忽略",
+                    title=title.strip(),
+                    page=page_num
+                )
         
         logger.info(f"从书签提取到 {len(chapters)} 个章节")
         return chapters
     
+    @staticmethod
+    def _page_unreadable(page: int, error: Exception) -> None:
+        """页面无法读取时跳过并记录警告"""
+        logger.warning(f"读取第 {page} 页失败: {str(error)}")
+        add_warning(WarningCode.PAGE_UNREADABLE, f"第 {page} 页无法读取，已跳过", page=page)
+    
+    def _extract_from_toc_pages(self, doc: fitz.Document, page_offset: int) -> List[ChapterInfo]:
+        """
+        从印刷目录页提取章节，目录中的印刷页码按偏移量换算为物理页码
+        
+        Args:
+            doc: PDF文档对象
+            page_offset: 偏移量（物理页 = 印刷页 + 偏移量）
+            
+        Returns:
+            章节列表，没有找到目录页或目录条目时为空
+        """
+        total_pages = len(doc)
+        entries = []
+        in_toc = False
+        for page_num in range(1, min(TOC_SCAN_PAGES, total_pages) + 1):
+            try:
+                text = doc[page_num - 1].get_text().strip()
+            except Exception as e:
+                self._page_unreadable(page_num, e)
+                continue
+            
+            lines = [line.strip() for line in text.split("\n") if line.strip()]
+            # 目录页通常延续多页，后续页没有标题时按引导符判断
+            if lines and self._match_section_type(lines[0]) == SectionType.TOC:
+                in_toc = True
+            elif in_toc and not re.search(r"\.{4,}|…{2,}", text):
+                if entries:
+                    break
+                in_toc = False
+            if not in_toc:
+                continue
+            
+            for line in lines:
+                match = TOC_ENTRY_PATTERN.match(line)
+                if not match:
+                    continue
+                title = match.group("title").strip(" .…·")
+                if any(pattern.search(title) for pattern in self.chapter_patterns):
+                    entries.append((int(match.group("page")) + page_offset, title))
+        
+        # 只保留换算后落在正文范围内且页码递增的条目，跳过目录页本身
+        chapter_pages = []
+        for start_page, title in entries:
+            if not 1 <= start_page <= total_pages:
+                logger.warning(f"目录条目换算后超出文档范围: {title} - 第 {start_page} 页")
+                continue
+            if chapter_pages and start_page <= chapter_pages[-1][0]:
+                continue
+            chapter_pages.append((start_page, title))
+        
+        chapters = []
+        for i, (start_page, title) in enumerate(chapter_pages):
+            end_page = chapter_pages[i + 1][0] - 1 if i + 1 < len(chapter_pages) else total_pages
+            chapters.append(ChapterInfo(
+                title=title,
+                start_page=start_page,
+                end_page=end_page,
+                page_count=end_page - start_page + 1
+            ))
+        
+        if chapters:
+            logger.info(f"从印刷目录识别到 {len(chapters)} 个章节（偏移量 {page_offset}）")
+        return chapters
+    
     def _extract_from_text_patterns(self, doc: fitz.Document) -> List[ChapterInfo]:
         """从文本模式识别章节"""
         chapters = []
@@ -253,8 +1011,11 @@ class PDFAnalyzer:
         
         # 扫描每一页寻找章节标题
         for page_num in range(len(doc)):
-            page = doc[page_num]
-            text = page.get_text()
+            try:
+                text = doc[page_num].get_text()
+            except Exception as e:
+                self._page_unreadable(page_num + 1, e)
+                continue
             
             # 检查是否匹配章节模式
             for pattern in self.chapter_patterns:
@@ -363,12 +1124,11 @@ class PDFAnalyzer:
             
             # 确保章节至少有一页
             if start_page <= end_page:
-                validated_chapter = ChapterInfo(
-                    title=chapter.title,
-                    start_page=start_page,
-                    end_page=end_page,
-                    page_count=end_page - start_page + 1
-                )
+                validated_chapter = chapter.model_copy(update={
+                    "start_page": start_page,
+                    "end_page": end_page,
+                    "page_count": end_page - start_page + 1
+                })
                 validated_chapters.append(validated_chapter)
         
         # 检查章节覆盖是否完整
@@ -376,22 +1136,18 @@ class PDFAnalyzer:
             # 调整第一个章节从第1页开始
             if validated_chapters[0].start_page > 1:
                 first_chapter = validated_chapters[0]
-                validated_chapters[0] = ChapterInfo(
-                    title=first_chapter.title,
-                    start_page=1,
-                    end_page=first_chapter.end_page,
-                    page_count=first_chapter.end_page - 1 + 1
-                )
+                validated_chapters[0] = first_chapter.model_copy(update={
+                    "start_page": 1,
+                    "page_count": first_chapter.end_page - 1 + 1
+                })
             
             # 调整最后一个章节到最后一页结束
             if validated_chapters[-1].end_page < total_pages:
                 last_chapter = validated_chapters[-1]
-                validated_chapters[-1] = ChapterInfo(
-                    title=last_chapter.title,
-                    start_page=last_chapter.start_page,
-                    end_page=total_pages,
-                    page_count=total_pages - last_chapter.start_page + 1
-                )
+                validated_chapters[-1] = last_chapter.model_copy(update={
+                    "end_page": total_pages,
+                    "page_count": total_pages - last_chapter.start_page + 1
+                })
         
         logger.info(f"章节验证完成: {len(validated_chapters)} 个有效章节")
         return validated_chapters
@@ -427,4 +1183,88 @@ class PDFAnalyzer:
             validated_chapters=validated_chapters,
             issues=issues,
             total_pages_covered=total_pages_covered
-        )
\ No newline at end of file
+        )
+    
+    def find_boundary_issues(self, chapters: List[ChapterInfo], total_pages: int) -> List[str]:
+        """
+        检查用户提交的章节边界是否可以直接拆分
+        
+        Args:
+            chapters: 章节列表（按提交顺序）
+            total_pages: 总页数
+            
+        Returns:
+            问题描述列表，为空表示可以拆分
+        """
+        issues = []
+        
+        for i, chapter in enumerate(chapters):
+            if chapter.end_page > total_pages:
+                issues.append(f"章节 {i+1} 结束页 {chapter.end_page} 超出总页数 {total_pages}")
+        
+        ordered = sorted(enumerate(chapters), key=lambda item: item[1].start_page)
+        for (i, current), (j, following) in zip(ordered, ordered[1:]):
+            if current.end_page >= following.start_page:
+                issues.append(f"章节 {i+1} 和 {j+1} 存在重叠")
+        
+        return issues
+    
+    def auto_fix_boundaries(
+        self,
+        chapters: List[ChapterInfo],
+        total_pages: int,
+        max_gap: int = 1,
+        max_overlap: int = 1
+    ) -> Tuple[List[ChapterInfo], List[BoundaryAdjustment]]:
+        """
+        自动修正章节间的小重叠和间隙
+        
+        不超过max_overlap页的重叠将前一章的结束页吸附到下一章起始页的前一页，
+        不超过max_gap页的间隙并入前一章，超出总页数的结束页截断到最后一页；
+        更大的重叠和间隙保持不变，由边界校验报告
+        
+        Args:
+            chapters: 章节列表
+            total_pages: 总页数
+            max_gap: 允许吸收的最大间隙页数
+            max_overlap: 允许修正的最大重叠页数
+            
+        Returns:
+            修正后的章节列表（按起始页排序）和修正记录（章节序号为提交顺序中的位置）
+        """
+        ordered = sorted(enumerate(chapters), key=lambda item: item[1].start_page)
+        positions = [position for position, _ in ordered]
+        fixed = [chapter for _, chapter in ordered]
+        adjustments: List[BoundaryAdjustment] = []
+        
+        def set_end(index: int, new_end: int, reason: str) -> None:
+            chapter = fixed[index]
+            adjustments.append(BoundaryAdjustment(
+                chapter_index=positions[index] + 1,
+                title=chapter.title,
+                field="end_page",
+                old_value=chapter.end_page,
+                new_value=new_end,
+                reason=reason
+            ))
+            fixed[index] = chapter.model_copy(update={
+                "end_page": new_end,
+                "page_count": new_end - chapter.start_page + 1
+            })
+        
+        for i in range(len(fixed)):
+            if fixed[i].end_page > total_pages:
+                set_end(i, total_pages, "结束页超出总页数，截断到最后一页")
+        
+        for i in range(len(fixed) - 1):
+            current, following = fixed[i], fixed[i + 1]
+            gap = following.start_page - current.end_page - 1
+            
+            if 0 < -gap <= max_overlap and following.start_page > current.start_page:
+                set_end(i, following.start_page - 1, f"与下一章重叠 {-gap} 页，结束页吸附到下一章起始页前一页")
+            elif 0 < gap <= max_gap:
+                set_end(i, following.start_page - 1, f"吸收与下一章之间的 {gap} 页间隙")
+        
+        if adjustments:
+            logger.info(f"自动修正章节边界: {len(adjustments)} 处")
+        return fixed, adjustments
@@ -2,13 +2,140 @@
 PDF拆分服务
 """
 
+import asyncio
+import hashlib
+import shutil
+import string
 import fitz  # PyMuPDF
-from typing import List, Callable, Optional
+from typing import List, Callable, Dict, Optional, Set
 from pathlib import Path
 
 from loguru import logger
 
-from ..models.schemas import ChapterInfo
+from ..models.schemas import (
+    AttachmentMode,
+    BatesConfig,
+    ChapterInfo,
+    ManifestEntry,
+    OutputManifest,
+    PageNumberStamp,
+    PageRange,
+    RedactionSpec,
+    SigningMode,
+    UnreadablePageHandling,
+    WarningCode,
+)
+from ..core.config import settings
+from ..core.diagnostics import add_warning
+from ..core.errors import code_for_exception, details_for_exception, is_engine_crash
+from ..core.document_cache import document_cache
+from ..core.memory import buffer_pool
+from .archive_service import ArchiveBuilder
+from .attachment_service import attachment_service
+from .redaction import apply_redactions
+from .stamping import format_bates, stamp_bates, stamp_page_numbers
+from .pdfa import PDFA_CONFORMANCE, pdfa_converter
+from .ink_saving import convert_to_grayscale, strip_background_images
+from .orientation import correct_orientation
+from .ocr_layer import add_text_layer
+from .signatures import SIGNED_ORIGINAL_FILENAME, remove_signature_fields
+from .signing_service import signing_service
+from .split_checkpoint import SplitCheckpoint
+from .xmp import build_chapter_xmp
+
+
+# 章节输出目录中的校验清单文件名
+MANIFEST_FILENAME = "manifest.json"
+
+# 带新书签的原文件副本的文件名
+BOOKMARKED_COPY_FILENAME = "bookmarked.pdf"
+
+# 拆分时逐章写入的打包文件名
+BUNDLE_FILENAME = "chapters.zip"
+
+# 默认章节文件名模板（不含扩展名）
+DEFAULT_FILENAME_TEMPLATE = "{index:02d}_{title}"
+
+
+def validate_filename_template(template: str) -> None:
+    """
+    校验章节文件名模板
+
+    Args:
+        template: 文件名模板
+
+    Raises:
+        ValueError: 模板包含未知占位符或格式错误
+    """
+    if not template or len(template) > 200:
+        raise ValueError("文件名模板不能为空且不超过200个字符")
+    try:
+        template.format(index=1, title="chapter", start_page=1, end_page=2, book="book", author="author", edition="1")
+    except (KeyError, IndexError, ValueError) as e:
+        raise ValueError(
+            f"文件名模板无效，可用占位符为 {{index}}、{{title}}、{{start_page}}、{{end_page}}、{{book}}、{{author}}、{{edition}}: {e}"
+        )
+
+
+def fill_document_fields(template: str, fields: Dict[str, str]) -> str:
+    """
+    先填入模板中文档级的占位符（书名、作者、版次），章节级的占位符保留给拆分时按章节填写
+
+    Args:
+        template: 已校验的文件名模板
+        fields: 文档级占位符的值
+
+    Returns:
+        只含章节级占位符的模板
+    """
+    parts = []
+    for literal, name, spec, conversion in string.Formatter().parse(template):
+        parts.append(literal.replace("{", "{{").replace("}", "}}"))
+        if name is None:
+            continue
+        if name in fields:
+            value = format(fields[name], spec or "")
+            parts.append(value.replace("{", "{{").replace("}", "}}"))
+        else:
+            parts.append("{" + name + (f"!{conversion}" if conversion else "") + (f":{spec}" if spec else "") + "}")
+    return "".join(parts)
+
+
+def excluded_page_numbers(ranges: List[PageRange], total_pages: int) -> Set[int]:
+    """
+    展开要排除的页范围
+
+    Args:
+        ranges: 页范围列表
+        total_pages: 原文件页数，超出的部分被忽略
+
+    Returns:
+        原文件页码集合
+    """
+    pages = set()
+    for page_range in ranges:
+        pages.update(range(page_range.start, min(page_range.end or page_range.start, total_pages) + 1))
+    return pages
+
+
+def insert_divider_page(doc: fitz.Document, index: int, title: str, rect: fitz.Rect) -> None:
+    """
+    插入居中印有标题的分隔页
+
+    Args:
+        doc: 目标文档
+        index: 插入位置（0开始），等于页数时追加到末尾
+        title: 标题
+        rect: 页面尺寸
+    """
+    page = doc.new_page(index, width=rect.width, height=rect.height)
+    page.insert_textbox(
+        page.rect + (48, page.rect.height / 3, -48, -page.rect.height / 3),
+        title,
+        fontsize=20,
+        fontname="china-s",
+        align=fitz.TEXT_ALIGN_CENTER
+    )
 
 
 class PDFSplitter:
@@ -19,7 +146,36 @@ class PDFSplitter:
         input_path: str, 
         chapters: List[ChapterInfo], 
         output_dir: str,
-        progress_callback: Optional[Callable[[int], None]] = None
+        progress_callback: Optional[Callable[[int], None]] = None,
+        chapter_callback: Optional[Callable[[int, ChapterInfo, Optional[str], Optional[str]], None]] = None,
+        doc_key: Optional[str] = None,
+        filename_template: str = DEFAULT_FILENAME_TEMPLATE,
+        optimize: bool = False,
+        strip_metadata: bool = False,
+        watermark_text: Optional[str] = None,
+        max_output_bytes: Optional[int] = None,
+        attachments: AttachmentMode = AttachmentMode.NONE,
+        redactions: Optional[List[RedactionSpec]] = None,
+        bates: Optional[BatesConfig] = None,
+        page_numbers: Optional[PageNumberStamp] = None,
+        pdfa: bool = False,
+        grayscale: bool = False,
+        strip_backgrounds: bool = False,
+        deskew: bool = False,
+        ocr_text_layer: bool = False,
+        strip_signatures: bool = False,
+        best_effort: bool = False,
+        unreadable_pages: UnreadablePageHandling = UnreadablePageHandling.PLACEHOLDER,
+        signed_original: Optional[str] = None,
+        bookmarked_copy: bool = False,
+        exclude_pages: Optional[List[PageRange]] = None,
+        group_dividers: bool = False,
+        bundle: bool = False,
+        sign: SigningMode = SigningMode.NONE,
+        source_id: Optional[str] = None,
+        task_id: Optional[str] = None,
+        cache_key: Optional[str] = None,
+        checkpoint: Optional[SplitCheckpoint] = None
     ) -> List[str]:
         """
         拆分PDF文件
@@ -29,64 +185,484 @@ class PDFSplitter:
             chapters: 章节列表
             output_dir: 输出目录
             progress_callback: 进度回调函数
+            chapter_callback: 单章完成回调，参数为(序号, 章节, 文件名, 错误信息)
+            doc_key: 文档缓存键（文件内容哈希），为空时不使用缓存
+            filename_template: 章节文件名模板
+            optimize: 是否清理未引用对象并压缩数据流（更小的文件，耗时更长）
+            strip_metadata: 是否清除文档信息和XMP元数据
+            watermark_text: 每页添加的对角水印文字
+            max_output_bytes: 单个章节文件大小上限，超出时删除该文件并记为失败
+            attachments: 携带文档级嵌入附件的方式
+            redactions: 涂黑规则，在章节文档中删除对应内容
+            bates: Bates编号配置，按章节顺序连续编号，失败的章节不占用编号
+            page_numbers: 章节页码配置，每个章节重新编号
+            pdfa: 是否转换为PDF/A-2b
+            grayscale: 是否转换为灰度
+            strip_backgrounds: 是否删除背景图片
+            deskew: 是否纠正扫描页的方向和倾斜
+            ocr_text_layer: 是否为扫描页写入不可见的OCR文字层
+            strip_signatures: 是否删除章节中失效的签名字段
+            best_effort: 是否逐页复制，跳过无法读取的页面而不使章节失败
+            unreadable_pages: 尽力拆分时无法读取页面的处理方式
+            signed_original: 签名原件路径，提供时原样复制到输出目录并记入清单
+            bookmarked_copy: 是否额外输出按章节结构重建书签的原文件副本（同样应用涂黑、清除元数据和水印）
+            exclude_pages: 从每个章节输出中删除的原文件页，在涂黑之后、加盖编号之前删除
+            group_dividers: 是否在分组输出的每个成员章节前插入印有章节标题的分隔页
+            bundle: 是否在每章完成时追加到输出目录中的chapters.zip（内含manifest.json），拆分结束时打包即完成
+            sign: 章节输出的数字签名方式，签名在所有修改之后进行
+            source_id: 源文档ID，提供且不清除元数据时在章节中写入来源XMP
+            task_id: 写入来源XMP的拆分任务ID
+            cache_key: 输出缓存键，全部章节成功时记入清单，供相同请求复用
+            checkpoint: 拆分检查点，已完成的章节直接恢复，新完成的章节随即记录
             
         Returns:
             生成的文件路径列表
         """
+        archive = None
         try:
             logger.info(f"开始拆分PDF: {input_path}")
             
-            # 打开PDF文件
-            doc = fitz.open(input_path)
-            output_path = Path(output_dir)
-            output_path.mkdir(parents=True, exist_ok=True)
-            
-            download_links = []
-            total_chapters = len(chapters)
-            
-            for i, chapter in enumerate(chapters):
-                try:
-                    # 创建新的PDF文档
-                    new_doc = fitz.open()
-                    
-                    # 复制指定页面范围
-                    for page_num in range(chapter.start_page - 1, chapter.end_page):
-                        if page_num < len(doc):
-                            page = doc[page_num]
-                            new_doc.insert_pdf(doc, from_page=page_num, to_page=page_num)
-                    
-                    # 生成文件名
-                    safe_title = self._sanitize_filename(chapter.title)
-                    filename = f"{i+1:02d}_{safe_title}.pdf"
-                    file_path = output_path / filename
+            # 打开PDF文件（与分析共用已解析的文档）
+            with document_cache.open(input_path, doc_key) as doc:
+                output_path = Path(output_dir)
+                output_path.mkdir(parents=True, exist_ok=True)
+                
+                # 之前拆分留下的打包与本次输出不一致
+                (output_path / BUNDLE_FILENAME).unlink(missing_ok=True)
+                archive = ArchiveBuilder(output_path / BUNDLE_FILENAME) if bundle else None
+                
+                download_links = []
+                manifest = OutputManifest()
+                total_chapters = len(chapters)
+                next_bates = bates.start if bates else None
+                excluded = excluded_page_numbers(exclude_pages or [], len(doc))
+                failed = 0
+                
+                for i, chapter in enumerate(chapters):
+                    # 章节之间让出事件循环，请求或任务被取消时在此停止
+                    await asyncio.sleep(0)
                     
-                    # 保存文件
-                    new_doc.save(str(file_path))
-                    new_doc.close()
+                    # 上次中断前已完成的章节从检查点恢复
+                    restored = checkpoint.restore(i + 1, output_path) if checkpoint else None
+                    if restored:
+                        entry, restored_bates = restored
+                        if archive:
+                            archive.add(output_path / entry.filename, entry.filename)
+                        download_links.append(entry.filename)
+                        manifest.files.append(entry)
+                        if bates:
+                            next_bates = restored_bates
+                        if progress_callback:
+                            progress_callback(int((i + 1) / total_chapters * 100))
+                        if chapter_callback:
+                            chapter_callback(i + 1, chapter, entry.filename, None)
+                        logger.info(f"章节从检查点恢复: {entry.filename}")
+                        continue
                     
-                    # 添加到下载链接
-                    download_links.append(filename)
-                    
-                    # 更新进度
-                    progress = int((i + 1) / total_chapters * 100)
-                    if progress_callback:
-                        progress_callback(progress)
-                    
-                    logger.info(f"章节拆分完成: {filename}")
-                    
-                except Exception as e:
-                    logger.error(f"拆分章节失败: {chapter.title} - {str(e)}")
-                    continue
+                    try:
+                        # 创建新的PDF文档
+                        new_doc = fitz.open()
+                        
+                        # 复制指定页面范围，source_pages记录每个输出页对应的原文件页码（分隔页为None）
+                        damaged_pages = []
+                        source_pages: List[Optional[int]] = []
+                        first, last = chapter.start_page - 1, min(chapter.end_page, len(doc)) - 1
+                        if not best_effort:
+                            # 整个范围一次插入，多页引用的同一图片、字体等对象在输出中只复制一份
+                            if first <= last:
+                                new_doc.insert_pdf(doc, from_page=first, to_page=last)
+                            source_pages = list(range(first + 1, last + 2))
+                        else:
+                            # 逐页复制时PyMuPDF按源文档复用对象映射，共享对象同样只复制一份
+                            for page_num in range(first, last + 1):
+                                if not self._copy_page(doc, new_doc, page_num):
+                                    damaged_pages.append(page_num + 1)
+                                    action = "跳过"
+                                    if unreadable_pages == UnreadablePageHandling.PLACEHOLDER:
+                                        self._insert_placeholder(doc, new_doc, page_num)
+                                        action = "替换为占位页"
+                                    add_warning(
+                                        WarningCode.PAGE_UNREADABLE,
+                                        f"章节“{chapter.title}”第 {page_num + 1} 页无法读取，已{action}",
+                                        page=page_num + 1,
+                                        chapter=i + 1
+                                    )
+                                source_pages.extend([page_num + 1] * (len(new_doc) - len(source_pages)))
+                        
+                        if strip_signatures:
+                            remove_signature_fields(new_doc)
+                        if redactions:
+                            apply_redactions(new_doc, chapter, redactions)
+                        excluded_pages = self._remove_excluded_pages(new_doc, source_pages, excluded) if excluded else []
+                        
+                        # 分组输出保留成员章节和节的书签树，开启分隔页时成员章节的书签指向分隔页
+                        if chapter.members:
+                            headings = self._insert_dividers(new_doc, chapter.members, source_pages) if group_dividers else {}
+                            new_doc.set_toc(self._build_toc(chapter.members, self._page_locator(source_pages), headings=headings))
+                        if strip_backgrounds:
+                            strip_background_images(new_doc)
+                        corrections = await correct_orientation(new_doc) if deskew else []
+                        ocr_pages = await add_text_layer(new_doc) if ocr_text_layer else []
+                        if bates:
+                            chapter_next_bates = stamp_bates(new_doc, bates, next_bates)
+                        if page_numbers:
+                            stamp_page_numbers(new_doc, page_numbers)
+                        attachment_service.copy_to_chapter(doc, new_doc, chapter, attachments)
+                        if strip_metadata:
+                            new_doc.set_metadata({})
+                            new_doc.del_xml_metadata()
+                        elif source_id:
+                            new_doc.set_xml_metadata(build_chapter_xmp(source_id, i + 1, chapter, task_id, doc_key))
+                        if watermark_text:
+                            self._add_watermark(new_doc, watermark_text)
+                        conversion_issues = pdfa_converter.prepare(new_doc) if pdfa else []
+                        
+                        # 生成文件名，模板不含序号时重名章节追加序号
+                        filename = self._render_filename(filename_template, i + 1, chapter)
+                        if filename in download_links:
+                            filename = f"{filename[:-4]}_{i+1}.pdf"
+                        file_path = output_path / filename
+                        
+                        # 保存文件；合并内容相同的对象（扫描书中每页重复嵌入的同一图片）并删除排除页面等留下的未引用对象
+                        if optimize:
+                            new_doc.save(str(file_path), garbage=4, deflate=True)
+                        elif settings.DEDUPLICATE_OUTPUT_OBJECTS:
+                            new_doc.save(str(file_path), garbage=4)
+                        else:
+                            new_doc.save(str(file_path))
+                        page_count = len(new_doc)
+                        new_doc.close()
+                        
+                        try:
+                            if grayscale:
+                                await convert_to_grayscale(file_path)
+                            if pdfa:
+                                conversion_issues += await pdfa_converter.convert(file_path)
+                            if sign != SigningMode.NONE:
+                                await signing_service.sign(file_path, sign)
+                        except Exception:
+                            file_path.unlink(missing_ok=True)
+                            raise
+                        
+                        size = file_path.stat().st_size
+                        if max_output_bytes and size > max_output_bytes:
+                            file_path.unlink()
+                            raise ValueError(f"章节文件大小 {size} 字节超过上限 {max_output_bytes} 字节")
+                        
+                        # 添加到下载链接
+                        if archive:
+                            archive.add(file_path, filename)
+                        download_links.append(filename)
+                        manifest.files.append(ManifestEntry(
+                            filename=filename,
+                            title=chapter.title,
+                            start_page=chapter.start_page,
+                            end_page=chapter.end_page,
+                            pages=page_count,
+                            size=size,
+                            sha256=self._file_sha256(file_path),
+                            damaged_pages=damaged_pages,
+                            corrected_pages=[correction.page for correction in corrections],
+                            ocr_pages=ocr_pages,
+                            excluded_pages=excluded_pages
+                        ))
+                        if pdfa:
+                            manifest.files[-1].conformance = PDFA_CONFORMANCE
+                            manifest.files[-1].conversion_issues = conversion_issues
+                            if conversion_issues:
+                                add_warning(
+                                    WarningCode.PDFA_CONVERSION_ISSUES,
+                                    f"章节“{chapter.title}”转换PDF/A时有 {len(conversion_issues)} 项特性被移除或无法转换",
+                                    chapter=i + 1,
+                                    filename=filename,
+                                    issues=conversion_issues
+                                )
+                        if sign != SigningMode.NONE:
+                            manifest.files[-1].signed_by = signing_service.signer_name
+                        if bates:
+                            manifest.files[-1].bates_start = format_bates(bates, next_bates)
+                            manifest.files[-1].bates_end = format_bates(bates, chapter_next_bates - 1)
+                            next_bates = chapter_next_bates
+                        if checkpoint:
+                            checkpoint.save(i + 1, file_path, manifest.files[-1], next_bates)
+                        
+                        # 更新进度
+                        progress = int((i + 1) / total_chapters * 100)
+                        if progress_callback:
+                            progress_callback(progress)
+                        if chapter_callback:
+                            chapter_callback(i + 1, chapter, filename, None)
+                        
+                        logger.info(f"章节拆分完成: {filename}")
+                        
+                    except Exception as e:
+                        logger.error(f"拆分章节失败: {chapter.title} - {str(e)}")
+                        add_warning(
+                            WarningCode.CHAPTER_FAILED,
+                            f"章节“{chapter.title}”拆分失败，已跳过: {str(e)}",
+                            chapter=i + 1,
+                            title=chapter.title,
+                            error=str(e),
+                            error_code=code_for_exception(e).value,
+                            error_details=details_for_exception(e),
+                            engine_crash=is_engine_crash(e)
+                        )
+                        if chapter_callback:
+                            chapter_callback(i + 1, chapter, None, str(e))
+                        failed += 1
+                        continue
+                
+                if signed_original:
+                    download_links.append(self._copy_signed_original(Path(signed_original), output_path, manifest))
+                if bookmarked_copy:
+                    download_links.append(self._write_bookmarked_copy(
+                        input_path,
+                        chapters,
+                        output_path,
+                        manifest,
+                        redactions=redactions,
+                        strip_signatures=strip_signatures,
+                        strip_metadata=strip_metadata,
+                        watermark_text=watermark_text
+                    ))
+                
+                # 部分章节失败的输出不可复用
+                if not failed:
+                    manifest.cache_key = cache_key
             
-            doc.close()
+            # 输出校验清单，供接收方核对传输后的文件
+            self._write_manifest(output_path, manifest)
+            
+            if archive:
+                # 章节之后生成的签名原件和带书签副本最后追加
+                for filename in download_links:
+                    if filename not in archive.names:
+                        archive.add(output_path / filename, filename)
+                archive.add(output_path / MANIFEST_FILENAME, MANIFEST_FILENAME)
+                archive.finish()
             
             logger.info(f"PDF拆分完成: 生成 {len(download_links)} 个文件")
             return download_links
             
         except Exception as e:
             logger.error(f"PDF拆分失败: {str(e)}")
+            if archive:
+                archive.abort()
             raise
     
+    def _copy_signed_original(self, source: Path, output_path: Path, manifest: OutputManifest) -> str:
+        """原样复制签名原件（签名仍然有效），返回输出文件名"""
+        file_path = output_path / SIGNED_ORIGINAL_FILENAME
+        shutil.copyfile(source, file_path)
+        with fitz.open(str(file_path)) as original:
+            page_count = original.page_count
+        manifest.files.append(ManifestEntry(
+            filename=SIGNED_ORIGINAL_FILENAME,
+            title="签名原件",
+            start_page=1,
+            end_page=page_count,
+            pages=page_count,
+            size=file_path.stat().st_size,
+            sha256=self._file_sha256(file_path)
+        ))
+        logger.info(f"已附带签名原件: {file_path}")
+        return SIGNED_ORIGINAL_FILENAME
+    
+    def _write_bookmarked_copy(
+        self,
+        input_path: str,
+        chapters: List[ChapterInfo],
+        output_path: Path,
+        manifest: OutputManifest,
+        redactions: Optional[List[RedactionSpec]] = None,
+        strip_signatures: bool = False,
+        strip_metadata: bool = False,
+        watermark_text: Optional[str] = None
+    ) -> str:
+        """
+        输出原文件的副本，原有书签替换为与章节结构一致的书签树（章节为一级，节和分组的成员章节为下级）
+        
+        Returns:
+            输出文件名
+        """
+        file_path = output_path / BOOKMARKED_COPY_FILENAME
+        with fitz.open(input_path) as copy:
+            page_count = copy.page_count
+            if strip_signatures:
+                remove_signature_fields(copy)
+            if redactions:
+                whole = ChapterInfo(title="", start_page=1, end_page=page_count, page_count=page_count)
+                apply_redactions(copy, whole, redactions)
+            copy.set_toc(self._build_toc(chapters, lambda start, end: start if start <= page_count else None))
+            if strip_metadata:
+                copy.set_metadata({})
+                copy.del_xml_metadata()
+            if watermark_text:
+                self._add_watermark(copy, watermark_text)
+            copy.save(str(file_path), garbage=1)
+        
+        manifest.files.append(ManifestEntry(
+            filename=BOOKMARKED_COPY_FILENAME,
+            title="带书签的原文件",
+            start_page=1,
+            end_page=page_count,
+            pages=page_count,
+            size=file_path.stat().st_size,
+            sha256=self._file_sha256(file_path)
+        ))
+        logger.info(f"已生成带书签的原文件副本: {file_path}")
+        return BOOKMARKED_COPY_FILENAME
+    
+    @staticmethod
+    def _build_toc(
+        chapters: List[ChapterInfo],
+        locate: Callable[[int, int], Optional[int]],
+        level: int = 1,
+        headings: Optional[Dict[int, int]] = None
+    ) -> List[list]:
+        """
+        按章节和节生成书签列表，分组章节的成员章节作为下级书签
+        
+        Args:
+            chapters: 章节列表
+            locate: 返回原文件页范围在目标文件中的第一页，范围内的页面都不在目标文件中时返回None（条目被忽略）
+            level: 章节书签的层级
+            headings: 章节起始页到分隔页页码的映射，有分隔页的章节书签指向分隔页
+        """
+        toc = []
+        headings = headings or {}
+        for chapter in sorted(chapters, key=lambda ch: ch.start_page):
+            page = headings.get(chapter.start_page) or locate(chapter.start_page, chapter.end_page)
+            if page is None:
+                continue
+            toc.append([level, chapter.title, page])
+            toc.extend(PDFSplitter._build_toc(chapter.members, locate, level + 1))
+            for section in chapter.sections:
+                section_page = locate(section.start_page, section.end_page)
+                if chapter.start_page <= section.start_page <= chapter.end_page and section_page is not None:
+                    toc.append([level + 1, section.title, section_page])
+        return toc
+    
+    @staticmethod
+    def _page_locator(source_pages: List[Optional[int]]) -> Callable[[int, int], Optional[int]]:
+        """按输出页对应的原文件页码，返回原文件第start至end页中第一个保留的页面在输出中的页码"""
+        def locate(start: int, end: int) -> Optional[int]:
+            for index, source in enumerate(source_pages):
+                if source is not None and start <= source <= end:
+                    return index + 1
+            return None
+        return locate
+    
+    def _insert_dividers(self, new_doc: fitz.Document, members: List[ChapterInfo], source_pages: List[Optional[int]]) -> Dict[int, int]:
+        """
+        在每个成员章节的第一页之前插入印有章节标题的分隔页，页面全部被排除的成员章节不插入
+        
+        Returns:
+            成员章节起始页到分隔页页码的映射
+        """
+        locate = self._page_locator(source_pages)
+        divided = []
+        # 从后往前插入，前面成员章节的位置不受影响
+        for member in sorted(members, key=lambda ch: ch.start_page, reverse=True):
+            page = locate(member.start_page, member.end_page)
+            if page is None:
+                continue
+            insert_divider_page(new_doc, page - 1, member.title, new_doc[page - 1].rect)
+            source_pages.insert(page - 1, None)
+            divided.append(member)
+        return {member.start_page: locate(member.start_page, member.end_page) - 1 for member in divided}
+    
+    @staticmethod
+    def _remove_excluded_pages(new_doc: fitz.Document, source_pages: List[Optional[int]], excluded: Set[int]) -> List[int]:
+        """删除章节文档中要排除的页面并同步source_pages，返回删除的原文件页码"""
+        indexes = [index for index, page in enumerate(source_pages) if page in excluded]
+        if indexes and len(indexes) == len(new_doc):
+            raise ValueError("章节的所有页面都被排除")
+        removed = [source_pages[index] for index in indexes]
+        for index in reversed(indexes):
+            new_doc.delete_page(index)
+            del source_pages[index]
+        return removed
+    
+    @staticmethod
+    def _copy_page(doc: fitz.Document, new_doc: fitz.Document, page_num: int) -> bool:
+        """复制单页，页面无法解析时撤销已插入的内容并返回False"""
+        pages_before = len(new_doc)
+        try:
+            doc[page_num].get_text()
+            new_doc.insert_pdf(doc, from_page=page_num, to_page=page_num)
+            return True
+        except Exception as e:
+            logger.warning(f"复制第 {page_num + 1} 页失败: {str(e)}")
+            while len(new_doc) > pages_before:
+                new_doc.delete_page(-1)
+            return False
+    
+    @staticmethod
+    def _insert_placeholder(doc: fitz.Document, new_doc: fitz.Document, page_num: int) -> None:
+        """插入与原页面尺寸相同的占位页，无法获取尺寸时使用A4"""
+        try:
+            rect = doc.page_cropbox(page_num)
+        except Exception:
+            rect = fitz.paper_rect("a4")
+        page = new_doc.new_page(width=rect.width, height=rect.height)
+        page.insert_textbox(
+            page.rect + (36, page.rect.height / 2 - 24, -36, 0),
+            f"第 {page_num + 1} 页无法读取\n(page {page_num + 1} unreadable)",
+            fontsize=14,
+            fontname="china-s",
+            color=(0.5, 0.5, 0.5),
+            align=fitz.TEXT_ALIGN_CENTER
+        )
+    
+    @staticmethod
+    def _add_watermark(doc: fitz.Document, text: str) -> None:
+        """在每页中央添加半透明的对角水印"""
+        font = fitz.Font("china-s")
+        for page in doc:
+            rect = page.rect
+            fontsize = max(12, min(rect.width, rect.height) / max(len(text), 1) * 0.9)
+            width = font.text_length(text, fontsize=fontsize)
+            center = fitz.Point(rect.width / 2, rect.height / 2)
+            page.insert_text(
+                fitz.Point(center.x - width / 2, center.y + fontsize / 3),
+                text,
+                fontsize=fontsize,
+                fontname="china-s",
+                color=(0.5, 0.5, 0.5),
+                fill_opacity=0.3,
+                morph=(center, fitz.Matrix(-45)),
+                overlay=True
+            )
+    
+    def _write_manifest(self, output_path: Path, manifest: OutputManifest) -> None:
+        """写入manifest.json"""
+        with open(output_path / MANIFEST_FILENAME, "w", encoding="utf-8") as f:
+            f.write(manifest.model_dump_json(indent=2))
+    
+    @staticmethod
+    def _file_sha256(file_path: Path) -> str:
+        """计算文件SHA-256"""
+        digest = hashlib.sha256()
+        with buffer_pool.buffer() as buf, open(file_path, "rb") as f:
+            view = memoryview(buf)
+            while n := f.readinto(view):
+                digest.update(view[:n])
+        return digest.hexdigest()
+    
+    def _render_filename(self, template: str, index: int, chapter: ChapterInfo) -> str:
+        """按模板生成章节文件名，结果中的路径分隔符等不安全字符会被替换"""
+        name = template.format(
+            index=index,
+            title=self._sanitize_filename(chapter.title),
+            start_page=chapter.start_page,
+            end_page=chapter.end_page
+        )
+        for char in '<>:"/\\|?*':
+            name = name.replace(char, '_')
+        name = name.strip().strip(".") or f"{index:02d}_chapter"
+        return f"{name}.pdf"
+    
     def _sanitize_filename(self, filename: str) -> str:
         """
         清理文件名，移除不安全字符
@@ -114,13 +690,14 @@ class PDFSplitter:
         
         return safe_filename.strip()
     
-    async def merge_pdfs(self, input_paths: List[str], output_path: str) -> bool:
+    async def merge_pdfs(self, input_paths: List[str], output_path: str, dividers: bool = False) -> bool:
         """
         合并PDF文件
         
         Args:
             input_paths: 输入文件路径列表
             output_path: 输出文件路径
+            dividers: 是否在每个文件前插入印有文件名的分隔页
             
         Returns:
             是否成功
@@ -134,6 +711,8 @@ class PDFSplitter:
             for input_path in input_paths:
                 if Path(input_path).exists():
                     doc = fitz.open(input_path)
+                    if dividers and len(doc):
+                        insert_divider_page(merged_doc, len(merged_doc), Path(input_path).stem, doc[0].rect)
                     merged_doc.insert_pdf(doc)
                     doc.close()
                 else:
@@ -184,4 +763,21 @@ class PDFSplitter:
             
         except Exception as e:
             logger.error(f"获取PDF信息失败: {str(e)}")
-            return {}
\ No newline at end of file
+            return {}
+
+def create_splitter() -> PDFSplitter:
+    """
+    按SPLIT_ENGINE创建拆分引擎
+
+    Returns:
+        拆分引擎实例
+    """
+    engine = settings.SPLIT_ENGINE.lower()
+    if engine == "fake":
+        from .fake_splitter import FakeSplitter
+
+        logger.warning("SPLIT_ENGINE=fake：拆分输出为模拟内容，不可用于生产")
+        return FakeSplitter()
+    if engine == "pymupdf":
+        return PDFSplitter()
+    raise ValueError(f"不支持的拆分引擎: {settings.SPLIT_ENGINE}")
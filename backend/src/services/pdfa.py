@@ -0,0 +1,155 @@
+"""
+PDF/A-2b转换
+章节保存后用Ghostscript重写为PDF/A-2b：嵌入全部字体、把色彩空间转换为sRGB并写入输出意图；
+PDF/A不允许的附件和多媒体注释在转换前移除，连同Ghostscript的警告一起报告
+"""
+
+import glob
+from pathlib import Path
+from typing import List, Optional
+
+import fitz
+from loguru import logger
+
+from ..core.config import settings
+from .ghostscript import ghostscript_available, rewrite_pdf
+
+
+# 归档格式标识
+PDFA_CONFORMANCE = "PDF/A-2b"
+
+# PDF/A禁止的注释类型
+FORBIDDEN_ANNOT_TYPES = {"Sound", "Movie", "Screen", "3D", "RichMedia", "FileAttachment"}
+
+# 常见发行版中Ghostscript自带sRGB配置文件的位置
+ICC_PROFILE_CANDIDATES = [
+    "/usr/share/color/icc/ghostscript/srgb.icc",
+    "/usr/share/ghostscript/*/iccprofiles/srgb.icc",
+    "/usr/local/share/ghostscript/*/iccprofiles/srgb.icc",
+]
+
+# 定义输出意图的PostScript，ICC路径在运行时填入
+PDFA_DEFINITION = """%!
+/ICCProfile ({icc}) def
+[/_objdef {{icc_PDFA}} /type /stream /OBJ pdfmark
+[{{icc_PDFA}} <</N 3>> /PUT pdfmark
+[{{icc_PDFA}} ICCProfile (r) file /PUT pdfmark
+[/_objdef {{OutputIntent_PDFA}} /type /dict /OBJ pdfmark
+[{{OutputIntent_PDFA}} <<
+  /Type /OutputIntent
+  /S /GTS_PDFA1
+  /DestOutputProfile {{icc_PDFA}}
+  /OutputConditionIdentifier (sRGB)
+>> /PUT pdfmark
+[{{Catalog}} <</OutputIntents [ {{OutputIntent_PDFA}} ]>> /PUT pdfmark
+"""
+
+
+class PDFAConverter:
+    """PDF/A-2b转换器"""
+
+    def __init__(self):
+        self._definition: Optional[Path] = None
+
+    @property
+    def available(self) -> bool:
+        """是否安装了Ghostscript并找到ICC配置文件"""
+        return ghostscript_available() and self._icc_profile() is not None
+
+    def prepare(self, doc: fitz.Document) -> List[str]:
+        """
+        保存前移除PDF/A不允许的内容
+
+        Args:
+            doc: 章节文档
+
+        Returns:
+            已移除或需要注意的特性
+        """
+        issues = []
+
+        names = doc.embfile_names()
+        for name in names:
+            doc.embfile_del(name)
+        if names:
+            issues.append(f"PDF/A-2b不允许嵌入非PDF/A附件，已移除 {len(names)} 个附件")
+
+        removed = 0
+        for page in doc:
+            for annot in list(page.annots()):
+                if annot.type[1] in FORBIDDEN_ANNOT_TYPES:
+                    page.delete_annot(annot)
+                    removed += 1
+        if removed:
+            issues.append(f"已移除 {removed} 个附件或多媒体注释")
+
+        if doc.xref_get_key(doc.pdf_catalog(), "Names/JavaScript")[0] != "null":
+            issues.append("文档包含JavaScript，转换时移除")
+
+        return issues
+
+    async def convert(self, path: Path) -> List[str]:
+        """
+        把已保存的PDF原地转换为PDF/A-2b
+
+        Args:
+            path: 章节文件路径
+
+        Returns:
+            Ghostscript报告的警告（去重）
+
+        Raises:
+            RuntimeError: Ghostscript不可用、转换失败或超时
+        """
+        if not self.available:
+            raise RuntimeError("服务器未安装Ghostscript或缺少sRGB ICC配置文件，无法转换PDF/A")
+
+        log = await rewrite_pdf(
+            path,
+            [
+                "-dPDFA=2",
+                "-dNOOUTERSAVE",
+                "-sColorConversionStrategy=RGB",
+                "-dPDFACompatibilityPolicy=1",
+                "-dEmbedAllFonts=true",
+                f"--permit-file-read={self._icc_profile()}",
+            ],
+            prologue=[str(self._definition_file())]
+        )
+        return self._warnings(log)
+
+    @staticmethod
+    def _warnings(log: str) -> List[str]:
+        """提取Ghostscript输出中的警告"""
+        warnings = []
+        for line in log.splitlines():
+            line = line.strip(" *\t")
+            if line and ("warning" in line.lower() or "pdfa" in line.lower().replace("/", "")):
+                if line not in warnings:
+                    warnings.append(line)
+        return warnings
+
+    @staticmethod
+    def _icc_profile() -> Optional[str]:
+        if settings.PDFA_ICC_PROFILE:
+            return settings.PDFA_ICC_PROFILE if Path(settings.PDFA_ICC_PROFILE).is_file() else None
+        for pattern in ICC_PROFILE_CANDIDATES:
+            matches = sorted(glob.glob(pattern))
+            if matches:
+                return matches[-1]
+        return None
+
+    def _definition_file(self) -> Path:
+        """生成（并缓存）输出意图定义文件"""
+        if self._definition is None or not self._definition.exists():
+            icc = self._icc_profile().replace("\\", "\\\\").replace("(", "\\(").replace(")", "\\)")
+            path = Path(settings.TEMP_DIR) / "PDFA_def.ps"
+            path.parent.mkdir(parents=True, exist_ok=True)
+            path.write_text(PDFA_DEFINITION.format(icc=icc), encoding="utf-8")
+            self._definition = path
+            logger.info(f"生成PDF/A输出意图定义: {path}")
+        return self._definition
+
+
+# 创建全局PDF/A转换器实例
+pdfa_converter = PDFAConverter()
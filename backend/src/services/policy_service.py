@@ -0,0 +1,88 @@
+"""
+组织级处理策略
+管理员为租户设置清除元数据、水印和输出大小上限等默认规则，合并到每个拆分请求；
+请求中放宽策略（关闭清除元数据、去掉或更换水印、提高大小上限）需要策略指定的角色
+"""
+
+from datetime import datetime
+
+from loguru import logger
+
+from ..models.schemas import ProcessingPolicy, SplitRequest
+from ..core.auth import Principal, get_current_principal, has_role
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant
+
+
+POLICIES_BUCKET = "policies"
+POLICY_KEY = "processing"
+
+
+class PolicyService:
+    """按租户保存的处理策略"""
+
+    async def get(self) -> ProcessingPolicy:
+        """当前租户的策略，未设置时返回不做限制的默认策略"""
+        data = await get_store().aget(POLICIES_BUCKET, POLICY_KEY, get_current_tenant())
+        return ProcessingPolicy(**data) if data else ProcessingPolicy()
+
+    async def set(self, policy: ProcessingPolicy) -> ProcessingPolicy:
+        """
+        替换当前租户的策略
+
+        Args:
+            policy: 新策略
+
+        Returns:
+            保存后的策略
+        """
+        policy = policy.model_copy(update={
+            "watermark_text": policy.watermark_text or None,
+            "updated_at": datetime.now(),
+            "updated_by": get_current_principal().user
+        })
+        await get_store().aput(POLICIES_BUCKET, POLICY_KEY, policy.model_dump(mode="json"), get_current_tenant())
+        logger.info(f"更新处理策略: {get_current_tenant()} - {policy.model_dump(exclude={'updated_at', 'updated_by'})}")
+        return policy
+
+    async def apply(self, request: SplitRequest, principal: Principal = None) -> None:
+        """
+        把策略合并到拆分请求，请求未指定的字段取策略值
+
+        Args:
+            request: 拆分请求（原地修改）
+            principal: 调用方，为空时使用当前调用方
+
+        Raises:
+            PermissionError: 请求放宽了策略且调用方角色不足
+        """
+        policy = await self.get()
+        principal = principal or get_current_principal()
+        violations = []
+
+        if request.strip_metadata is None:
+            request.strip_metadata = policy.strip_metadata
+        elif policy.strip_metadata and not request.strip_metadata:
+            violations.append("关闭元数据清除")
+
+        if request.watermark_text is None:
+            request.watermark_text = policy.watermark_text
+        elif policy.watermark_text and request.watermark_text != policy.watermark_text:
+            violations.append("修改水印")
+
+        if request.max_output_bytes is None:
+            request.max_output_bytes = policy.max_output_bytes
+        elif policy.max_output_bytes and request.max_output_bytes > policy.max_output_bytes:
+            violations.append("提高输出大小上限")
+
+        if violations and not has_role(principal, policy.override_role):
+            raise PermissionError(
+                f"组织策略不允许{'、'.join(violations)}，需要{policy.override_role.value}角色"
+            )
+
+        # 空字符串表示显式不加水印
+        request.watermark_text = request.watermark_text or None
+
+
+# 创建全局处理策略服务实例
+policy_service = PolicyService()
@@ -0,0 +1,130 @@
+"""
+拆分预设服务
+命名保存识别策略、文件名模板、压缩和投递等选项，分析和拆分请求通过preset_id一键套用
+"""
+
+import uuid
+from datetime import datetime
+from typing import List, Optional, Union
+
+from loguru import logger
+
+from ..models.schemas import AnalyzeRequest, SplitPreset, SplitPresetRequest, SplitRequest
+from ..core.auth import get_current_principal
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant
+from .pdf_splitter import validate_filename_template
+from .delivery_service import delivery_service
+from .notification_service import notification_service
+
+
+PRESETS_BUCKET = "presets"
+
+
+class PresetService:
+    """按租户保存的拆分预设"""
+
+    async def create(self, request: SplitPresetRequest) -> SplitPreset:
+        """
+        创建预设
+
+        Args:
+            request: 预设内容
+
+        Returns:
+            创建的预设
+
+        Raises:
+            ValueError: 选项无效或名称重复
+        """
+        await self._validate(request)
+        preset = SplitPreset(
+            preset_id=str(uuid.uuid4()),
+            created_by=get_current_principal().user,
+            **request.model_dump()
+        )
+        await self._save(preset)
+        logger.info(f"创建预设: {preset.preset_id} ({preset.name})")
+        return preset
+
+    async def list(self) -> List[SplitPreset]:
+        """列出当前租户的预设，按名称排序"""
+        presets = []
+        for data in await get_store().avalues(PRESETS_BUCKET, get_current_tenant()):
+            try:
+                presets.append(SplitPreset(**data))
+            except Exception as e:
+                logger.error(f"读取预设失败: {data.get('preset_id')} - {str(e)}")
+        return sorted(presets, key=lambda preset: preset.name)
+
+    async def get(self, preset_id: str) -> Optional[SplitPreset]:
+        """获取预设，不存在时返回None"""
+        try:
+            data = await get_store().aget(PRESETS_BUCKET, preset_id, get_current_tenant())
+        except ValueError:
+            return None
+        return SplitPreset(**data) if data else None
+
+    async def update(self, preset_id: str, request: SplitPresetRequest) -> Optional[SplitPreset]:
+        """
+        整体替换预设内容
+
+        Returns:
+            更新后的预设，不存在时返回None
+
+        Raises:
+            ValueError: 选项无效或名称重复
+        """
+        preset = await self.get(preset_id)
+        if not preset:
+            return None
+
+        await self._validate(request, preset_id)
+        updated = SplitPreset(**{**preset.model_dump(), **request.model_dump(), "updated_at": datetime.now()})
+        await self._save(updated)
+        logger.info(f"更新预设: {preset_id} ({request.name})")
+        return updated
+
+    async def delete(self, preset_id: str) -> bool:
+        """删除预设"""
+        try:
+            deleted = await get_store().adelete(PRESETS_BUCKET, preset_id, get_current_tenant())
+        except ValueError:
+            return False
+        if deleted:
+            logger.info(f"删除预设: {preset_id}")
+        return deleted
+
+    @staticmethod
+    def apply(preset: SplitPreset, request: Union[AnalyzeRequest, SplitRequest]) -> None:
+        """
+        把预设中的选项合并到请求，请求中显式提供的字段保持不变
+
+        Args:
+            preset: 预设
+            request: 分析或拆分请求（原地修改）
+        """
+        options = preset.split if isinstance(request, SplitRequest) else preset.analyze
+        for field in options.model_dump(exclude_none=True):
+            if field not in request.model_fields_set:
+                setattr(request, field, getattr(options, field))
+
+    async def _validate(self, request: SplitPresetRequest, preset_id: Optional[str] = None) -> None:
+        if request.split.filename_template is not None:
+            validate_filename_template(request.split.filename_template)
+        if request.split.delivery:
+            delivery_service.validate(request.split.delivery)
+        if request.split.notifications:
+            notification_service.validate(request.split.notifications)
+
+        for preset in await self.list():
+            if preset.name == request.name and preset.preset_id != preset_id:
+                raise ValueError(f"预设名称已存在: {request.name}")
+
+    @staticmethod
+    async def _save(preset: SplitPreset) -> None:
+        await get_store().aput(PRESETS_BUCKET, preset.preset_id, preset.model_dump(mode="json"), get_current_tenant())
+
+
+# 创建全局预设服务实例
+preset_service = PresetService()
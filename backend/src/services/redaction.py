@@ -0,0 +1,95 @@
+"""
+拆分前涂黑
+按页码、区域或正则匹配的文字在章节文档中真正删除内容（文字、图片像素），而不是只覆盖色块；
+只指定页码的规则整页清空，保留页面尺寸以免页码错位
+"""
+
+import re
+from typing import List
+
+import fitz
+from loguru import logger
+
+from ..models.schemas import ChapterInfo, RedactionSpec
+
+
+def validate_redactions(specs: List[RedactionSpec]) -> None:
+    """
+    校验涂黑规则
+
+    Args:
+        specs: 涂黑规则
+
+    Raises:
+        ValueError: 规则为空、区域格式错误或正则无效
+    """
+    for index, spec in enumerate(specs, start=1):
+        if spec.page is None and spec.rect is None and not spec.pattern:
+            raise ValueError(f"第 {index} 条涂黑规则至少需要指定 page、rect 或 pattern")
+        if spec.rect is not None:
+            if len(spec.rect) != 4:
+                raise ValueError(f"第 {index} 条涂黑规则的 rect 应为 [x0, y0, x1, y1]")
+            x0, y0, x1, y1 = spec.rect
+            if x0 >= x1 or y0 >= y1:
+                raise ValueError(f"第 {index} 条涂黑规则的 rect 宽高必须大于0")
+        if spec.pattern:
+            try:
+                re.compile(spec.pattern)
+            except re.error as e:
+                raise ValueError(f"第 {index} 条涂黑规则的正则无效: {e}")
+
+
+def apply_redactions(doc: fitz.Document, chapter: ChapterInfo, specs: List[RedactionSpec]) -> int:
+    """
+    在章节文档中执行涂黑
+
+    Args:
+        doc: 章节文档，第1页对应原文档的 chapter.start_page
+        chapter: 章节
+        specs: 涂黑规则
+
+    Returns:
+        涂黑的区域数（整页清空计为1）
+    """
+    count = 0
+    for index in range(len(doc)):
+        page_no = chapter.start_page + index
+        page_specs = [spec for spec in specs if spec.page in (None, page_no)]
+        if not page_specs:
+            continue
+
+        # 只指定页码：整页替换为同尺寸空白页
+        if any(spec.rect is None and not spec.pattern for spec in page_specs):
+            rect = doc[index].rect
+            doc.delete_page(index)
+            doc.new_page(index, width=rect.width, height=rect.height)
+            count += 1
+            continue
+
+        page = doc[index]
+        areas = []
+        for spec in page_specs:
+            if spec.rect is not None:
+                areas.append(fitz.Rect(spec.rect))
+            if spec.pattern:
+                areas.extend(_match_areas(page, spec.pattern))
+
+        for area in areas:
+            page.add_redact_annot(area, fill=(0, 0, 0))
+        if areas:
+            page.apply_redactions(images=fitz.PDF_REDACT_IMAGE_PIXELS)
+            count += len(areas)
+
+    if count:
+        logger.info(f"章节涂黑完成: {chapter.title} - {count} 处")
+    return count
+
+
+def _match_areas(page: fitz.Page, pattern: str) -> List[fitz.Rect]:
+    """正则匹配页面文字，返回匹配文字所在的区域（跨行的匹配逐行定位）"""
+    areas = []
+    for match in re.finditer(pattern, page.get_text()):
+        for line in match.group().splitlines():
+            if line.strip():
+                areas.extend(page.search_for(line.strip()))
+    return areas
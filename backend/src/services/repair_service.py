@@ -0,0 +1,72 @@
+"""
+损坏PDF修复
+MuPDF打开时会重建损坏的交叉引用表并恢复可读对象，修复后重新保存为干净的副本；
+MuPDF无法打开时再用Ghostscript重写
+"""
+
+import shutil
+from pathlib import Path
+
+import fitz
+from loguru import logger
+
+from ..models.schemas import RepairReport
+from .ghostscript import ghostscript_available, rewrite_pdf
+
+
+class RepairService:
+    """PDF修复服务"""
+
+    def needs_repair(self, path: Path) -> bool:
+        """打开失败、交叉引用表需要重建或没有可读页面时需要修复"""
+        try:
+            with fitz.open(str(path)) as doc:
+                return doc.is_repaired or not doc.is_pdf or doc.page_count == 0
+        except Exception:
+            return True
+
+    async def repair(self, source: Path, target: Path) -> RepairReport:
+        """
+        生成修复后的副本
+
+        Args:
+            source: 原文件
+            target: 副本路径
+
+        Returns:
+            修复报告
+
+        Raises:
+            ValueError: 文件无法修复
+        """
+        fitz.TOOLS.mupdf_warnings()  # 清空之前的警告
+        try:
+            with fitz.open(str(source)) as doc:
+                damaged = doc.is_repaired
+                if doc.page_count == 0:
+                    raise ValueError("没有可读的页面")
+                doc.save(str(target), garbage=3, clean=True)
+                page_count = doc.page_count
+            method = "mupdf"
+        except Exception as e:
+            logger.warning(f"MuPDF修复失败: {source} - {str(e)}")
+            if not ghostscript_available():
+                raise ValueError(f"文件损坏且无法修复: {e}")
+            damaged = True
+            shutil.copyfile(source, target)
+            try:
+                await rewrite_pdf(target, [])
+                with fitz.open(str(target)) as doc:
+                    page_count = doc.page_count
+            except Exception as gs_error:
+                target.unlink(missing_ok=True)
+                raise ValueError(f"文件损坏且无法修复: {gs_error}")
+            method = "ghostscript"
+
+        warnings = [line for line in fitz.TOOLS.mupdf_warnings().splitlines() if line.strip()]
+        logger.info(f"PDF修复完成: {source} - {method}，{page_count} 页")
+        return RepairReport(damaged=damaged, method=method, page_count=page_count, warnings=warnings)
+
+
+# 创建全局修复服务实例
+repair_service = RepairService()
@@ -0,0 +1,97 @@
+"""
+分级保留策略
+原文件、章节输出、已完成任务和失败任务分别设置保留时长，可按租户覆盖；
+API返回的到期时间和后台清理使用同一套计算规则
+"""
+
+from datetime import datetime, timedelta
+from typing import Optional
+
+from ..core.config import settings
+from ..core.tenancy import get_tenant_retention_hours
+from ..models.schemas import FileInfo, SplitTask, TaskStatus
+from .task_state import FINISHED_STATUSES
+
+
+# 下载统计中原文件使用的名称
+ORIGINAL_DOWNLOAD_NAME = "original.pdf"
+
+
+def _expiry(base: datetime, hours: int) -> Optional[datetime]:
+    """保留时长为0表示不清理"""
+    return base + timedelta(hours=hours) if hours > 0 else None
+
+
+def original_expires_at(info: FileInfo, tenant_id: Optional[str] = None) -> Optional[datetime]:
+    """
+    原文件的到期时间，按上传时间计算
+
+    Args:
+        info: 文件信息
+        tenant_id: 租户ID，为空时使用当前租户
+
+    Returns:
+        到期时间，不清理时为None
+    """
+    return _expiry(info.upload_time, get_tenant_retention_hours("original_retention_hours", tenant_id))
+
+
+def outputs_expires_at(
+    info: FileInfo,
+    generated_at: Optional[datetime],
+    tenant_id: Optional[str] = None
+) -> Optional[datetime]:
+    """
+    章节输出的到期时间
+
+    已下载的输出按最后一次下载时间计算，从未下载的输出按生成时间计算（可设置更短的保留时长）；
+    重新拆分后按新的生成时间计算
+
+    Args:
+        info: 文件信息
+        generated_at: 输出生成时间，没有输出时为None
+        tenant_id: 租户ID，为空时使用当前租户
+
+    Returns:
+        到期时间，没有输出或不清理时为None
+    """
+    if not generated_at:
+        return None
+
+    accessed = [
+        stats.last_accessed for name, stats in info.downloads.items()
+        if name != ORIGINAL_DOWNLOAD_NAME and stats.last_accessed
+    ]
+    hours = get_tenant_retention_hours("output_retention_hours", tenant_id)
+    if not accessed:
+        hours = get_tenant_retention_hours("undownloaded_output_retention_hours", tenant_id) or hours
+    return _expiry(max([generated_at] + accessed), hours)
+
+
+def ephemeral_expires_at(info: FileInfo) -> datetime:
+    """隐私模式文件的最迟删除时间，打包下载一次后会提前删除"""
+    return info.upload_time + timedelta(minutes=settings.EPHEMERAL_TTL_MINUTES)
+
+
+def outputs_downloaded(info: FileInfo) -> bool:
+    """章节输出是否被下载过（只下载原文件不算）"""
+    return any(name != ORIGINAL_DOWNLOAD_NAME for name in info.downloads)
+
+
+def task_expires_at(task: SplitTask) -> Optional[datetime]:
+    """
+    任务记录的到期时间，按完成时间计算，失败和已取消的任务可设置更短的保留时长
+
+    Args:
+        task: 任务
+
+    Returns:
+        到期时间，未结束或不清理时为None
+    """
+    if task.status not in FINISHED_STATUSES or not task.completed_at:
+        return None
+
+    hours = get_tenant_retention_hours("task_retention_hours", task.tenant_id)
+    if task.status != TaskStatus.COMPLETED:
+        hours = get_tenant_retention_hours("failed_task_retention_hours", task.tenant_id) or hours
+    return _expiry(task.completed_at, hours)
@@ -0,0 +1,181 @@
+"""
+示例文件
+按指定页数和章节结构生成PDF：每章首页印有章节标题，节标题均匀分布在章节页中，可选写入书签，
+正文为按种子生成的随机文字。用于端到端测试和演示，不必寻找版权安全的书籍，
+返回的章节结构可作为识别结果的标准答案
+"""
+
+import asyncio
+import random
+from pathlib import Path
+from typing import List, Optional, Tuple
+
+import fitz
+from loguru import logger
+
+from ..core.scratch import scratch_dir
+from ..models.schemas import ChapterInfo, FileInfo, SampleLanguage, SamplePdfRequest, SectionInfo
+
+
+# 标题、正文与页面边缘的距离（pt）
+PAGE_MARGIN = 72
+
+# 正文随机文字的词表
+SAMPLE_WORDS = {
+    SampleLanguage.ZH: ["分析", "方法", "结果", "模型", "数据", "理论", "实验", "结构", "过程", "系统", "研究", "问题"],
+    SampleLanguage.EN: ["analysis", "method", "result", "model", "data", "theory", "experiment", "structure", "process", "system"],
+}
+
+# 正文字体，中文使用内置的简体中文字体
+SAMPLE_FONTS = {SampleLanguage.ZH: "china-s", SampleLanguage.EN: "helv"}
+
+
+class SampleService:
+    """示例文件生成服务"""
+
+    async def create(self, request: SamplePdfRequest, file_service) -> Tuple[FileInfo, List[ChapterInfo], int]:
+        """
+        生成示例文件并保存为新文件
+
+        Args:
+            request: 页数、章节结构和语言
+            file_service: 文件服务
+
+        Returns:
+            (新文件信息, 章节结构, 总页数)
+
+        Raises:
+            ValueError: 章节数或节数多于可用页数
+        """
+        with scratch_dir() as temp_dir:
+            target = temp_dir / "sample.pdf"
+            chapters, pages = await asyncio.to_thread(self.build, request, target)
+            with open(target, "rb") as stream:
+                file_info = await file_service.save_pdf_stream(stream, f"{request.title}.pdf")
+
+        logger.info(f"示例文件已生成: {file_info.file_id} - {pages} 页，{len(chapters)} 章")
+        return file_info, chapters, pages
+
+    def build(self, request: SamplePdfRequest, output_path: Path) -> Tuple[List[ChapterInfo], int]:
+        """
+        生成示例文件并写入output_path，相同请求生成相同内容
+
+        Returns:
+            (章节结构, 总页数)
+        """
+        chapters = self.plan(request)
+        rng = random.Random(request.seed)
+        doc = fitz.open()
+        try:
+            for number in range(1, request.front_matter_pages + 1):
+                page = doc.new_page()
+                if number == 1:
+                    self._heading(page, request.title, request.language, PAGE_MARGIN * 3, fontsize=28)
+                else:
+                    self._body(page, rng, request.language, PAGE_MARGIN)
+
+            toc = []
+            for chapter in chapters:
+                section_starts = {section.start_page: section for section in chapter.sections}
+                for page_num in range(chapter.start_page, chapter.end_page + 1):
+                    page = doc.new_page()
+                    top = PAGE_MARGIN
+                    if page_num == chapter.start_page:
+                        top = self._heading(page, chapter.title, request.language, top, fontsize=20)
+                        toc.append([1, chapter.title, page_num])
+                    if page_num in section_starts:
+                        top = self._heading(page, section_starts[page_num].title, request.language, top, fontsize=14)
+                        toc.append([2, section_starts[page_num].title, page_num])
+                    self._body(page, rng, request.language, top)
+                    page.insert_text((page.rect.width / 2, page.rect.height - PAGE_MARGIN / 2), str(page_num), fontsize=9)
+
+            if request.outline:
+                doc.set_toc(toc)
+            doc.set_metadata({"title": request.title, "creator": "pdf-chapter-splitter sample"})
+            doc.save(str(output_path), garbage=3, deflate=True)
+            return chapters, len(doc)
+        finally:
+            doc.close()
+
+    @staticmethod
+    def plan(request: SamplePdfRequest) -> List[ChapterInfo]:
+        """
+        按请求计算章节和节的页范围
+
+        Raises:
+            ValueError: 章节数或节数多于可用页数
+        """
+        specs = [(spec.title, spec.pages, spec.sections) for spec in request.chapters]
+        if not specs:
+            available = request.pages - request.front_matter_pages
+            if available < request.chapter_count:
+                raise ValueError(f"去掉前置页后剩余 {available} 页，不足以生成 {request.chapter_count} 章")
+            size, extra = divmod(available, request.chapter_count)
+            specs = [
+                (None, size + (1 if index < extra else 0), request.sections_per_chapter)
+                for index in range(request.chapter_count)
+            ]
+
+        chapters = []
+        start = request.front_matter_pages + 1
+        for index, (title, pages, sections) in enumerate(specs, 1):
+            if sections > pages:
+                raise ValueError(f"第 {index} 章只有 {pages} 页，不足以放置 {sections} 个节")
+            end = start + pages - 1
+            chapters.append(ChapterInfo(
+                title=_chapter_heading(request.language, index, title),
+                start_page=start,
+                end_page=end,
+                page_count=pages,
+                sections=[_section(request.language, index, number, start, pages, sections) for number in range(1, sections + 1)]
+            ))
+            start = end + 1
+        return chapters
+
+    @staticmethod
+    def _heading(page: fitz.Page, text: str, language: SampleLanguage, top: float, fontsize: float) -> float:
+        """在top处写入标题，返回标题下方的位置"""
+        page.insert_text((PAGE_MARGIN, top + fontsize), text, fontsize=fontsize, fontname=SAMPLE_FONTS[language])
+        return top + fontsize * 2
+
+    @staticmethod
+    def _body(page: fitz.Page, rng: random.Random, language: SampleLanguage, top: float) -> None:
+        """在top以下写入随机正文"""
+        separator = "" if language == SampleLanguage.ZH else " "
+        text = separator.join(rng.choice(SAMPLE_WORDS[language]) for _ in range(300))
+        page.insert_textbox(
+            fitz.Rect(PAGE_MARGIN, top, page.rect.width - PAGE_MARGIN, page.rect.height - PAGE_MARGIN),
+            text,
+            fontsize=10,
+            fontname=SAMPLE_FONTS[language]
+        )
+
+
+def _chapter_heading(language: SampleLanguage, index: int, title: Optional[str] = None) -> str:
+    """章节标题，编号格式与默认的章节识别规则一致"""
+    if language == SampleLanguage.ZH:
+        return f"第{index}章 {title or f'示例章节{index}'}"
+    return f"Chapter {index} {title or f'Sample Chapter {index}'}"
+
+
+def _section_heading(language: SampleLanguage, chapter: int, number: int) -> str:
+    """节标题"""
+    if language == SampleLanguage.ZH:
+        return f"第{number}节 示例小节{chapter}.{number}"
+    return f"Section {chapter}.{number} Sample Section"
+
+
+def _section(language: SampleLanguage, chapter: int, number: int, chapter_start: int, pages: int, sections: int) -> SectionInfo:
+    """章节中第number个节，节按页数均分"""
+    start = chapter_start + (number - 1) * pages // sections
+    end = chapter_start + number * pages // sections - 1
+    return SectionInfo(
+        title=_section_heading(language, chapter, number),
+        start_page=start,
+        end_page=end,
+        page_count=end - start + 1
+    )
+
+
+# 创建全局示例文件服务实例
+sample_service = SampleService()
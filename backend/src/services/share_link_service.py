@@ -0,0 +1,195 @@
+"""
+分享链接服务
+为文件生成可公开访问的下载链接，可限制授权的章节、有效期和下载次数；
+令牌只保存SHA-256哈希，记录按令牌哈希全局保存并带所属租户，下载时无需API Key
+"""
+
+import hashlib
+import secrets
+import uuid
+from datetime import datetime, timedelta
+from typing import List, Optional, Tuple
+
+from loguru import logger
+
+from ..core.auth import get_current_principal
+from ..core.errors import InvalidRangeError
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant
+from ..models.schemas import OutputManifest, ShareLink, ShareLinkRequest
+
+
+SHARE_LINKS_BUCKET = "share_links"
+TOKEN_PREFIX = "pcs_share_"
+
+
+class StoredShareLink(ShareLink):
+    """落盘的分享链接记录"""
+    tenant_id: str
+    token_hash: str
+
+
+def hash_share_token(token: str) -> str:
+    """计算令牌的哈希，令牌本身是高熵随机串，无需加盐"""
+    return hashlib.sha256(token.encode("utf-8")).hexdigest()
+
+
+class ShareLinkService:
+    """分享链接的签发、查询、吊销和下载计数"""
+
+    async def create(self, file_id: str, request: ShareLinkRequest, manifest: OutputManifest) -> Tuple[ShareLink, str]:
+        """
+        签发分享链接
+
+        Args:
+            file_id: 文件ID
+            request: 授权范围、有效期和下载次数上限
+            manifest: 文件当前的章节输出清单，用于把章节序号确定为文件名
+
+        Returns:
+            (链接信息, 令牌明文)
+
+        Raises:
+            ValueError: 没有授权任何章节
+            InvalidRangeError: 章节序号超出范围
+        """
+        filenames = None
+        chapters = None
+        if request.chapters is not None:
+            chapters = sorted(set(request.chapters))
+            if not chapters:
+                raise ValueError("至少需要授权一个章节")
+            invalid = [index for index in chapters if index < 1 or index > len(manifest.files)]
+            if invalid:
+                raise InvalidRangeError(f"章节序号超出范围(1-{len(manifest.files)}): {invalid}")
+            filenames = [manifest.files[index - 1].filename for index in chapters]
+
+        token = TOKEN_PREFIX + secrets.token_urlsafe(32)
+        record = StoredShareLink(
+            link_id=str(uuid.uuid4()),
+            file_id=file_id,
+            chapters=chapters,
+            filenames=filenames,
+            expires_at=datetime.now() + timedelta(hours=request.expires_in_hours) if request.expires_in_hours else None,
+            max_downloads=request.max_downloads,
+            created_by=get_current_principal().user,
+            tenant_id=get_current_tenant(),
+            token_hash=hash_share_token(token)
+        )
+        await get_store().aput(SHARE_LINKS_BUCKET, record.token_hash, record.model_dump(mode="json"))
+
+        logger.info(f"签发分享链接: {record.tenant_id}/{file_id}/{record.link_id} (章节 {chapters or '全部'})")
+        return self._info(record), token
+
+    async def list(self, file_id: str) -> List[ShareLink]:
+        """列出当前租户中该文件的分享链接，按创建时间排序"""
+        tenant_id = get_current_tenant()
+        links = [
+            self._info(record) for record in await self._records()
+            if record.tenant_id == tenant_id and record.file_id == file_id
+        ]
+        return sorted(links, key=lambda link: link.created_at)
+
+    async def revoke(self, file_id: str, link_id: str) -> Optional[ShareLink]:
+        """
+        吊销分享链接，吊销后立即失效
+
+        Returns:
+            吊销后的链接信息，不存在时返回None
+        """
+        tenant_id = get_current_tenant()
+        record = next(
+            (
+                record for record in await self._records()
+                if record.tenant_id == tenant_id and record.file_id == file_id and record.link_id == link_id
+            ),
+            None
+        )
+        if not record:
+            return None
+
+        if not record.revoked_at:
+            record.revoked_at = datetime.now()
+            await get_store().aput(SHARE_LINKS_BUCKET, record.token_hash, record.model_dump(mode="json"))
+            logger.info(f"吊销分享链接: {tenant_id}/{file_id}/{link_id}")
+        return self._info(record)
+
+    async def resolve(self, token: str) -> Optional[StoredShareLink]:
+        """
+        根据令牌查找仍然有效的链接
+
+        Returns:
+            链接记录；令牌无效、已吊销、已过期或下载次数用尽时返回None
+        """
+        if not token.startswith(TOKEN_PREFIX):
+            return None
+        data = await get_store().aget(SHARE_LINKS_BUCKET, hash_share_token(token))
+        if not data:
+            return None
+        record = StoredShareLink(**data)
+        return record if self._is_active(record) else None
+
+    async def consume(self, token: str) -> Optional[StoredShareLink]:
+        """
+        原子地占用一次下载次数，并发下载不会超过上限
+
+        Returns:
+            更新后的链接记录，链接已失效时返回None
+        """
+        def mutate(data):
+            if not data:
+                return None
+            record = StoredShareLink(**data)
+            if not self._is_active(record):
+                return None
+            record.download_count += 1
+            return record.model_dump(mode="json")
+
+        data = await get_store().aupdate(SHARE_LINKS_BUCKET, hash_share_token(token), mutate)
+        return StoredShareLink(**data) if data else None
+
+    async def release(self, token: str) -> None:
+        """归还一次下载次数，只用于没有发送文件内容的304响应"""
+        def mutate(data):
+            if not data or data.get("download_count", 0) <= 0:
+                return None
+            return {**data, "download_count": data["download_count"] - 1}
+
+        await get_store().aupdate(SHARE_LINKS_BUCKET, hash_share_token(token), mutate)
+
+    @staticmethod
+    def allows(link: ShareLink, filename: str, manifest: Optional[OutputManifest]) -> bool:
+        """
+        链接是否授权下载该章节文件
+
+        文件名必须是当前章节输出清单中的章节，授权全部章节的链接同样不能下载原文件或清单外的文件
+        """
+        if not filename or not manifest or filename not in {entry.filename for entry in manifest.files}:
+            return False
+        return link.filenames is None or filename in link.filenames
+
+    @staticmethod
+    def _is_active(record: ShareLink) -> bool:
+        if record.revoked_at:
+            return False
+        if record.expires_at and record.expires_at <= datetime.now():
+            return False
+        return record.max_downloads is None or record.download_count < record.max_downloads
+
+    @staticmethod
+    async def _records() -> List[StoredShareLink]:
+        records = []
+        for data in await get_store().avalues(SHARE_LINKS_BUCKET):
+            try:
+                records.append(StoredShareLink(**data))
+            except Exception as e:
+                logger.error(f"读取分享链接失败: {data.get('link_id')} - {str(e)}")
+        return records
+
+    @staticmethod
+    def _info(record: StoredShareLink) -> ShareLink:
+        return ShareLink(**record.model_dump(exclude={"tenant_id", "token_hash"}))
+
+
+# 创建全局分享链接服务实例
+share_link_service = ShareLinkService()
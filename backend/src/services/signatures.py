@@ -0,0 +1,80 @@
+"""
+数字签名处理
+签名覆盖整个原文件的字节范围，拆分后的章节无法保留有效签名：
+上传时检测已签名的字段并提示，拆分时按选项拒绝、删除签名字段或附带未修改的签名原件
+"""
+
+from pathlib import Path
+from typing import List
+
+import fitz
+from loguru import logger
+
+from ..models.schemas import ResponseWarning, WarningCode
+
+
+# 附带签名原件时的输出文件名
+SIGNED_ORIGINAL_FILENAME = "signed_original.pdf"
+
+
+def count_signatures(path: Path) -> int:
+    """
+    统计已签名的签名字段数，未签名的空白签名域不计入
+
+    Args:
+        path: PDF文件路径
+
+    Returns:
+        已签名字段数，文件无法打开时为0
+    """
+    try:
+        with fitz.open(str(path)) as doc:
+            if doc.get_sigflags() < 1:
+                return 0
+            count = 0
+            for page in doc:
+                for widget in page.widgets(types=[fitz.PDF_WIDGET_TYPE_SIGNATURE]):
+                    if doc.xref_get_key(widget.xref, "V")[0] != "null":
+                        count += 1
+            return count
+    except Exception as e:
+        logger.warning(f"检测数字签名失败: {path} - {str(e)}")
+        return 0
+
+
+def signature_warnings(count: int) -> List[ResponseWarning]:
+    """上传和拆分响应中提示拆分会使签名失效"""
+    if not count:
+        return []
+    return [ResponseWarning(
+        code=WarningCode.SIGNATURES_INVALIDATED,
+        message=f"文件包含 {count} 个数字签名，拆分后的章节文件中签名将失效；可通过拆分选项signatures选择拒绝拆分、删除签名或附带签名原件",
+        details={"count": count}
+    )]
+
+
+def remove_signature_fields(doc: fitz.Document) -> int:
+    """
+    删除章节文档中的签名字段和签名标志，避免阅读器把失效的签名显示为被篡改
+
+    Args:
+        doc: 章节文档
+
+    Returns:
+        删除的签名字段数
+    """
+    removed = 0
+    for page in doc:
+        for widget in list(page.widgets(types=[fitz.PDF_WIDGET_TYPE_SIGNATURE])):
+            page.delete_widget(widget)
+            removed += 1
+
+    catalog = doc.pdf_catalog()
+    if doc.xref_get_key(catalog, "AcroForm")[0] != "null":
+        doc.xref_set_key(catalog, "AcroForm/SigFlags", "0")
+    if doc.xref_get_key(catalog, "Perms")[0] != "null":
+        doc.xref_set_key(catalog, "Perms", "null")
+
+    if removed:
+        logger.debug(f"删除签名字段: {removed} 个")
+    return removed
@@ -0,0 +1,131 @@
+"""
+章节输出数字签名
+用组织的PKCS#12证书对章节文件做增量签名，证书来自本地文件或AWS Secrets Manager；
+签名必须是最后一步，之后对文件的任何修改都会使签名失效
+"""
+
+import asyncio
+import base64
+from pathlib import Path
+
+import fitz
+from loguru import logger
+
+from ..core.config import settings
+from ..models.schemas import SigningMode
+
+
+# 章节签名字段名
+SIGNATURE_FIELD = "OrganizationSignature"
+
+# 可见签名框尺寸和距页面右下角的边距（pt）
+VISIBLE_BOX_WIDTH = 180
+VISIBLE_BOX_HEIGHT = 50
+VISIBLE_BOX_MARGIN = 36
+
+
+class SigningService:
+    """章节签名服务"""
+
+    def __init__(self):
+        self._signer = None
+
+    @property
+    def configured(self) -> bool:
+        """是否配置了签名证书"""
+        return bool(settings.SIGNING_CERT_PATH or settings.SIGNING_CERT_AWS_SECRET_ID)
+
+    @property
+    def signer_name(self) -> str:
+        """签名证书的主体名称"""
+        return self._get_signer().signing_cert.subject.human_friendly
+
+    async def sign(self, path: Path, mode: SigningMode) -> None:
+        """
+        原地签名已保存的章节文件
+
+        Args:
+            path: 章节文件路径
+            mode: 可见或不可见签名
+
+        Raises:
+            RuntimeError: 未配置证书、缺少pyHanko或证书无法加载
+        """
+        # pyHanko签名为阻塞调用，放入线程池执行
+        await asyncio.get_running_loop().run_in_executor(None, self._sign, path, mode)
+
+    def _sign(self, path: Path, mode: SigningMode) -> None:
+        from pyhanko.pdf_utils.incremental_writer import IncrementalPdfFileWriter
+        from pyhanko.sign import fields, signers
+
+        signer = self._get_signer()
+        output = path.with_name(f".{path.stem}.signed.pdf")
+        with open(path, "rb") as source:
+            writer = IncrementalPdfFileWriter(source)
+            if mode == SigningMode.VISIBLE:
+                page_index, box = self._visible_box(path)
+                fields.append_signature_field(
+                    writer,
+                    fields.SigFieldSpec(sig_field_name=SIGNATURE_FIELD, on_page=page_index, box=box)
+                )
+            metadata = signers.PdfSignatureMetadata(
+                field_name=SIGNATURE_FIELD,
+                reason=settings.SIGNING_REASON or None,
+                location=settings.SIGNING_LOCATION or None
+            )
+            try:
+                with open(output, "wb") as out:
+                    signers.sign_pdf(writer, metadata, signer=signer, output=out)
+            except Exception:
+                output.unlink(missing_ok=True)
+                raise
+        output.replace(path)
+
+    @staticmethod
+    def _visible_box(path: Path):
+        """可见签名放在最后一页右下角，返回(页序号, PDF坐标框)"""
+        with fitz.open(str(path)) as doc:
+            page_index = doc.page_count - 1
+            width = doc[page_index].rect.width
+        x1 = width - VISIBLE_BOX_MARGIN
+        return page_index, (x1 - VISIBLE_BOX_WIDTH, VISIBLE_BOX_MARGIN, x1, VISIBLE_BOX_MARGIN + VISIBLE_BOX_HEIGHT)
+
+    def _get_signer(self):
+        """加载（并缓存）签名证书"""
+        if self._signer is None:
+            if not self.configured:
+                raise RuntimeError("服务器未配置签名证书")
+            try:
+                from pyhanko.sign import signers
+            except ImportError:
+                raise RuntimeError("章节签名需要安装pyHanko")
+
+            passphrase = settings.SIGNING_CERT_PASSWORD.encode("utf-8") or None
+            signer = signers.SimpleSigner.load_pkcs12_data(self._load_pkcs12(), other_certs=None, passphrase=passphrase)
+            if signer is None:
+                raise RuntimeError("签名证书无法加载，请检查PKCS#12文件和密码")
+            self._signer = signer
+            logger.info(f"已加载签名证书: {signer.signing_cert.subject.human_friendly}")
+        return self._signer
+
+    @staticmethod
+    def _load_pkcs12() -> bytes:
+        """从本地文件或AWS Secrets Manager读取PKCS#12数据"""
+        if settings.SIGNING_CERT_PATH:
+            return Path(settings.SIGNING_CERT_PATH).read_bytes()
+
+        try:
+            import boto3
+        except ImportError:
+            raise RuntimeError("从AWS Secrets Manager读取签名证书需要安装boto3")
+
+        client = boto3.client("secretsmanager", region_name=settings.SIGNING_CERT_AWS_REGION or None)
+        secret = client.get_secret_value(SecretId=settings.SIGNING_CERT_AWS_SECRET_ID)
+        if "SecretBinary" in secret:
+            return secret["SecretBinary"]
+        # 文本形式的密钥按Base64保存
+        return base64.b64decode(secret["SecretString"])
+
+
+# 创建全局签名服务实例
+signing_service = SigningService()
@@ -0,0 +1,158 @@
+"""
+拆分检查点
+每个章节完成后把输出文件（硬链接）和清单条目持久化到 TEMP_DIR/checkpoints/{租户}/{输出缓存键}，
+进程崩溃、任务失败或取消后以相同文件和选项重新拆分时，已完成且校验一致的章节直接恢复，从第一个未完成的章节继续
+"""
+
+import errno
+import hashlib
+import json
+import os
+import shutil
+import time
+from pathlib import Path
+from typing import Dict, Optional, Tuple
+
+from loguru import logger
+
+from ..core.config import settings
+from ..models.schemas import ManifestEntry
+
+
+# 检查点所在的子目录（不在任务临时目录中，启动时不会被当作崩溃遗留清理）
+CHECKPOINT_DIRNAME = "checkpoints"
+
+# 记录已完成章节的文件
+STATE_FILENAME = "checkpoint.json"
+
+
+def checkpoint_root() -> Path:
+    """检查点的根目录"""
+    return Path(settings.TEMP_DIR) / CHECKPOINT_DIRNAME
+
+
+class SplitCheckpoint:
+    """一次拆分（按租户和输出缓存键区分）的检查点"""
+
+    def __init__(self, key: str, tenant_id: str):
+        # 缓存键只由文件哈希和选项决定，按租户分目录，不同租户上传同一文件时互不恢复对方的输出
+        self.path = checkpoint_root() / tenant_id / key
+        self._chapters: Dict[str, dict] = {}
+        try:
+            state = json.loads((self.path / STATE_FILENAME).read_text(encoding="utf-8"))
+            self._chapters = state.get("chapters", {})
+        except FileNotFoundError:
+            pass
+        except Exception as e:
+            logger.warning(f"读取拆分检查点失败，重新开始: {self.path} - {str(e)}")
+
+    @property
+    def completed(self) -> int:
+        """检查点中已完成的章节数"""
+        return len(self._chapters)
+
+    def restore(self, index: int, output_path: Path) -> Optional[Tuple[ManifestEntry, Optional[int]]]:
+        """
+        把已完成章节的文件恢复到输出目录
+
+        Args:
+            index: 章节序号（从1开始）
+            output_path: 输出目录
+
+        Returns:
+            (清单条目, 该章节之后的下一个Bates编号)，没有检查点或文件与记录不一致时为None
+        """
+        record = self._chapters.get(str(index))
+        if not record:
+            return None
+        try:
+            entry = ManifestEntry(**record["entry"])
+            saved = self.path / entry.filename
+            if saved.stat().st_size != entry.size or _file_sha256(saved) != entry.sha256:
+                raise ValueError("文件与检查点记录不一致")
+            _link_or_copy(saved, output_path / entry.filename)
+        except Exception as e:
+            logger.warning(f"恢复章节检查点失败，重新拆分: 第 {index} 章 - {str(e)}")
+            self._chapters.pop(str(index), None)
+            return None
+        return entry, record.get("next_bates")
+
+    def save(self, index: int, file_path: Path, entry: ManifestEntry, next_bates: Optional[int] = None) -> None:
+        """
+        记录已完成的章节，写入失败只记录日志，不影响拆分
+
+        Args:
+            index: 章节序号（从1开始）
+            file_path: 章节输出文件
+            entry: 清单条目
+            next_bates: 该章节之后的下一个Bates编号
+        """
+        try:
+            self.path.mkdir(parents=True, exist_ok=True)
+            _link_or_copy(file_path, self.path / entry.filename)
+            self._chapters[str(index)] = {"entry": entry.model_dump(mode="json"), "next_bates": next_bates}
+            partial = self.path / f".{STATE_FILENAME}.part"
+            partial.write_text(json.dumps({"chapters": self._chapters}, ensure_ascii=False), encoding="utf-8")
+            os.replace(partial, self.path / STATE_FILENAME)
+        except Exception as e:
+            logger.warning(f"写入拆分检查点失败: 第 {index} 章 - {str(e)}")
+
+    def clear(self) -> None:
+        """拆分完成后删除检查点"""
+        shutil.rmtree(self.path, ignore_errors=True)
+        self._chapters = {}
+
+
+def cleanup_checkpoints(max_age_hours: Optional[int] = None) -> int:
+    """
+    删除超过保留时间未更新的检查点（对应的任务不再重试）
+
+    Args:
+        max_age_hours: 保留时间（小时），默认为CHECKPOINT_RETENTION_HOURS
+
+    Returns:
+        删除的检查点数量
+    """
+    root = checkpoint_root()
+    if not root.exists():
+        return 0
+
+    cutoff = time.time() - (max_age_hours or settings.CHECKPOINT_RETENTION_HOURS) * 3600
+    removed = 0
+    for tenant_dir in root.iterdir():
+        if not tenant_dir.is_dir():
+            continue
+        for path in tenant_dir.iterdir():
+            if path.is_dir() and path.stat().st_mtime < cutoff:
+                shutil.rmtree(path, ignore_errors=True)
+                removed += 1
+        try:
+            tenant_dir.rmdir()
+        except OSError:
+            pass
+
+    if removed:
+        logger.info(f"清理过期的拆分检查点: {removed} 个")
+    return removed
+
+
+def _link_or_copy(source: Path, target: Path) -> None:
+    """优先硬链接（检查点与任务临时目录同在TEMP_DIR下），跨文件系统时复制"""
+    partial = target.with_name(f".{target.name}.part")
+    partial.unlink(missing_ok=True)
+    try:
+        os.link(source, partial)
+    except OSError as e:
+        if e.errno not in (errno.EXDEV, errno.EPERM, errno.EMLINK):
+            raise
+        shutil.copy2(source, partial)
+    os.replace(partial, target)
+
+
+def _file_sha256(file_path: Path) -> str:
+    """计算文件SHA-256"""
+    digest = hashlib.sha256()
+    with open(file_path, "rb") as f:
+        while chunk := f.read(settings.COPY_BUFFER_SIZE):
+            digest.update(chunk)
+    return digest.hexdigest()
@@ -0,0 +1,93 @@
+"""
+页面盖印
+- Bates编号：按章节顺序在每页加盖连续编号（前缀 + 定长数字），供法律文书按编号引用具体页面
+- 章节页码：拆分后原书的印刷页码不再连续，在每个章节输出上从起始页码重新编号
+"""
+
+import fitz
+
+from ..models.schemas import BatesConfig, PageNumberStamp, StampPosition
+
+
+# 盖印文字与页面边缘的距离（pt）
+STAMP_MARGIN = 18
+
+
+def format_bates(config: BatesConfig, number: int) -> str:
+    """生成编号文字，如 ACME-000042"""
+    return f"{config.prefix}{number:0{config.digits}d}"
+
+
+def validate_page_number_format(template: str) -> None:
+    """
+    校验页码格式
+
+    Raises:
+        ValueError: 格式包含未知占位符或格式错误
+    """
+    try:
+        template.format(page=1, total=1)
+    except (KeyError, IndexError, ValueError) as e:
+        raise ValueError(f"页码格式无效，可用占位符为 {{page}}、{{total}}: {e}")
+
+
+def stamp_bates(doc: fitz.Document, config: BatesConfig, first_number: int) -> int:
+    """
+    在文档每页加盖Bates编号
+
+    Args:
+        doc: 章节文档
+        config: 编号配置
+        first_number: 第1页的编号
+
+    Returns:
+        下一个可用编号
+    """
+    number = first_number
+    for page in doc:
+        _stamp(page, format_bates(config, number), config.position, config.font_size)
+        number += 1
+    return number
+
+
+def stamp_page_numbers(doc: fitz.Document, config: PageNumberStamp) -> None:
+    """
+    在章节文档每页加盖从config.start开始的页码
+
+    Args:
+        doc: 章节文档
+        config: 页码配置
+    """
+    total = config.start + len(doc) - 1
+    for index, page in enumerate(doc):
+        text = config.format.format(page=config.start + index, total=total)
+        _stamp(page, text, config.position, config.font_size)
+
+
+def _stamp(page: fitz.Page, text: str, position: StampPosition, font_size: float) -> None:
+    """在页面指定位置写入一行文字"""
+    fontname = "helv" if text.isascii() else "china-s"
+    width = fitz.Font(fontname).text_length(text, fontsize=font_size)
+    rect = page.rect
+
+    if position.value.endswith("left"):
+        x = STAMP_MARGIN
+    elif position.value.endswith("center"):
+        x = (rect.width - width) / 2
+    else:
+        x = rect.width - STAMP_MARGIN - width
+    if position.value.startswith("top"):
+        y = STAMP_MARGIN + font_size
+    else:
+        y = rect.height - STAMP_MARGIN
+
+    # 旋转过的页面按显示方向定位
+    point = fitz.Point(x, y) * page.derotation_matrix
+    page.insert_text(
+        point,
+        text,
+        fontsize=font_size,
+        fontname=fontname,
+        rotate=page.rotation,
+        overlay=True
+    )
@@ -0,0 +1,299 @@
+"""
+服务状态导出与导入
+把当前租户的文件记录、人工章节编辑、预设、处理策略和已结束的任务打包为可移植的ZIP，
+在另一个实例（如从本地磁盘部署迁移到S3/Postgres部署）导入；可选同时携带原文件和章节输出
+"""
+
+import json
+import shutil
+import zipfile
+from datetime import datetime
+from pathlib import Path, PurePosixPath
+from typing import BinaryIO, List, Optional, Tuple
+
+from loguru import logger
+
+from ..core.config import settings
+from ..core.errors import QuotaExceededError
+from ..core.scratch import scratch_dir
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant, tenant_storage_dir
+from ..models.schemas import (
+    FileInfo,
+    ProcessingPolicy,
+    SavedChapters,
+    SplitPreset,
+    SplitTask,
+    StateImportResponse,
+    TaskEvent
+)
+from .file_service import CHAPTER_EDITS_BUCKET, COMPUTED_FIELDS, FILES_BUCKET, REPAIRED_FILENAME, FileService
+from .policy_service import POLICIES_BUCKET, POLICY_KEY
+from .preset_service import PRESETS_BUCKET
+from .task_service import TASK_EVENTS_BUCKET, TASKS_BUCKET
+from .task_state import FINISHED_STATUSES
+from .xmp import GENERATOR
+
+
+# 状态包中的元数据文件
+STATE_FILENAME = "state.json"
+# 状态包格式版本，不兼容的变更时递增
+STATE_FORMAT_VERSION = 1
+# 文件内容在包内的目录
+FILES_PREFIX = "files"
+# 随文件记录导出的原文件
+SOURCE_FILENAMES = ("original.pdf", REPAIRED_FILENAME)
+
+
+class StateService:
+    """服务状态导出与导入服务，导出和导入会读写整个租户的记录和文件，路由在线程池中调用"""
+
+    def export_state(self) -> dict:
+        """
+        导出当前租户的元数据
+
+        Returns:
+            可JSON序列化的状态
+        """
+        store = get_store()
+        tenant_id = get_current_tenant()
+
+        files = store.values(FILES_BUCKET, tenant_id)
+        chapter_edits = [
+            edits for edits in (store.get(CHAPTER_EDITS_BUCKET, data["file_id"], tenant_id) for data in files)
+            if edits
+        ]
+        # 任务记录是全局的，按所属租户过滤；未结束的任务无法在另一个实例继续执行
+        tasks = [
+            data for data in store.values(TASKS_BUCKET)
+            if data.get("tenant_id") == tenant_id
+            and data.get("status") in {status.value for status in FINISHED_STATUSES}
+        ]
+
+        return {
+            "format_version": STATE_FORMAT_VERSION,
+            "generator": GENERATOR,
+            "exported_at": datetime.now().isoformat(),
+            "tenant_id": tenant_id,
+            "files": files,
+            "chapter_edits": chapter_edits,
+            "presets": store.values(PRESETS_BUCKET, tenant_id),
+            "policy": store.get(POLICIES_BUCKET, POLICY_KEY, tenant_id),
+            "tasks": tasks,
+            "task_events": {
+                data["task_id"]: store.get(TASK_EVENTS_BUCKET, data["task_id"]) or []
+                for data in tasks
+            }
+        }
+
+    def export_archive(self, include_files: bool = False) -> Tuple[List[Tuple[str, bytes]], List[Tuple[Path, str]]]:
+        """
+        生成状态包的内容
+
+        Args:
+            include_files: 是否同时打包原文件和章节输出
+
+        Returns:
+            (内存条目列表, 文件条目列表)，供流式打包
+        """
+        state = self.export_state()
+        entries = [(STATE_FILENAME, json.dumps(state, ensure_ascii=False, indent=2).encode("utf-8"))]
+
+        members: List[Tuple[Path, str]] = []
+        if include_files:
+            base = tenant_storage_dir()
+            for data in state["files"]:
+                file_id = data["file_id"]
+                file_dir = base / file_id
+                for name in SOURCE_FILENAMES:
+                    if (file_dir / name).exists():
+                        members.append((file_dir / name, f"{FILES_PREFIX}/{file_id}/{name}"))
+                chapters_dir = file_dir / "chapters"
+                if chapters_dir.is_dir():
+                    for path in sorted(chapters_dir.iterdir()):
+                        if path.is_file():
+                            members.append((path, f"{FILES_PREFIX}/{file_id}/chapters/{path.name}"))
+
+        logger.info(
+            f"导出服务状态: {state['tenant_id']} - 文件 {len(state['files'])} 个，"
+            f"任务 {len(state['tasks'])} 个，文件内容 {len(members)} 个"
+        )
+        return entries, members
+
+    def import_archive(
+        self,
+        stream: BinaryIO,
+        overwrite: bool = False,
+        max_file_bytes: Optional[int] = None
+    ) -> Tuple[StateImportResponse, List[SplitTask]]:
+        """
+        导入状态包到当前租户
+
+        Args:
+            stream: 上传的状态包
+            overwrite: 是否覆盖已存在的同ID记录
+            max_file_bytes: 剩余存储配额，包中原文件和章节输出的总大小超过时拒绝导入，为空表示不限制
+
+        Returns:
+            (导入结果, 导入的任务)
+
+        Raises:
+            ValueError: 状态包格式无效或记录无法解析
+            QuotaExceededError: 包中文件超过剩余配额
+        """
+        with scratch_dir() as temp_dir:
+            archive_path = temp_dir / "state.zip"
+            FileService.copy_with_limit(stream, archive_path, settings.MAX_ARCHIVE_SIZE)
+            try:
+                archive = zipfile.ZipFile(archive_path)
+            except zipfile.BadZipFile:
+                raise ValueError("状态包格式无效")
+
+            with archive:
+                FileService.validate_archive(archive)
+                if max_file_bytes is not None:
+                    file_bytes = sum(
+                        info.file_size for info in archive.infolist()
+                        if PurePosixPath(info.filename).parts[:1] == (FILES_PREFIX,)
+                    )
+                    if file_bytes > max_file_bytes:
+                        raise QuotaExceededError(f"状态包中的文件共 {file_bytes} 字节，超出剩余存储配额 {max_file_bytes} 字节")
+                state = self._read_state(archive)
+                return self._import_state(archive, state, overwrite)
+
+    @staticmethod
+    def _read_state(archive: zipfile.ZipFile) -> dict:
+        """读取并校验状态包的元数据"""
+        try:
+            state = json.loads(archive.read(STATE_FILENAME))
+        except KeyError:
+            raise ValueError(f"状态包中缺少 {STATE_FILENAME}")
+        except json.JSONDecodeError as e:
+            raise ValueError(f"{STATE_FILENAME} 格式无效: {str(e)}")
+
+        if not isinstance(state, dict) or state.get("format_version") != STATE_FORMAT_VERSION:
+            raise ValueError(f"不支持的状态包版本: {state.get('format_version') if isinstance(state, dict) else None}")
+        return state
+
+    def _import_state(
+        self,
+        archive: zipfile.ZipFile,
+        state: dict,
+        overwrite: bool
+    ) -> Tuple[StateImportResponse, List[SplitTask]]:
+        """先解析全部记录，全部有效后再写入，避免导入一半"""
+        try:
+            files = [FileInfo(**data) for data in state.get("files") or []]
+            chapter_edits = [SavedChapters(**data) for data in state.get("chapter_edits") or []]
+            presets = [SplitPreset(**data) for data in state.get("presets") or []]
+            policy = ProcessingPolicy(**state["policy"]) if state.get("policy") else None
+            tasks = [SplitTask(**data) for data in state.get("tasks") or []]
+            task_events = {
+                task_id: [TaskEvent(**event) for event in events]
+                for task_id, events in (state.get("task_events") or {}).items()
+            }
+        except Exception as e:
+            raise ValueError(f"状态包记录无效: {str(e)}")
+
+        for info in files:
+            if not self._is_safe_id(info.file_id):
+                raise ValueError(f"文件ID非法: {info.file_id}")
+
+        store = get_store()
+        tenant_id = get_current_tenant()
+        base = tenant_storage_dir()
+        result = StateImportResponse()
+
+        imported_files = set()
+        for info in files:
+            if store.get(FILES_BUCKET, info.file_id, tenant_id) and not overwrite:
+                result.skipped += 1
+                continue
+            info.file_path = str(base / info.file_id / "original.pdf")
+            store.put(FILES_BUCKET, info.file_id, info.model_dump(mode="json", exclude=COMPUTED_FIELDS), tenant_id)
+            imported_files.add(info.file_id)
+            result.files += 1
+
+        for edits in chapter_edits:
+            if edits.file_id not in imported_files:
+                result.skipped += 1
+                continue
+            store.put(CHAPTER_EDITS_BUCKET, edits.file_id, edits.model_dump(mode="json"), tenant_id)
+            result.chapter_edits += 1
+
+        for preset in presets:
+            if store.get(PRESETS_BUCKET, preset.preset_id, tenant_id) and not overwrite:
+                result.skipped += 1
+                continue
+            store.put(PRESETS_BUCKET, preset.preset_id, preset.model_dump(mode="json"), tenant_id)
+            result.presets += 1
+
+        if policy:
+            if store.get(POLICIES_BUCKET, POLICY_KEY, tenant_id) and not overwrite:
+                result.skipped += 1
+            else:
+                store.put(POLICIES_BUCKET, POLICY_KEY, policy.model_dump(mode="json"), tenant_id)
+                result.policy = True
+
+        imported_tasks = []
+        for task in tasks:
+            # 任务记录不分租户存储，同ID的任务属于其他租户时即使覆盖也跳过
+            existing = store.get(TASKS_BUCKET, task.task_id)
+            owned = existing is None or existing.get("tenant_id", settings.DEFAULT_TENANT) == tenant_id
+            if task.status not in FINISHED_STATUSES or not owned or (existing and not overwrite):
+                result.skipped += 1
+                continue
+            task.tenant_id = tenant_id
+            store.put(TASKS_BUCKET, task.task_id, task.model_dump(mode="json"))
+            events = task_events.get(task.task_id, [])
+            store.put(TASK_EVENTS_BUCKET, task.task_id, [event.model_dump(mode="json") for event in events])
+            imported_tasks.append(task)
+            result.tasks += 1
+
+        result.file_contents = self._extract_files(archive, imported_files, base)
+        result.message = (
+            f"导入完成: 文件 {result.files} 个，任务 {result.tasks} 个，"
+            f"文件内容 {result.file_contents} 个，跳过 {result.skipped} 条"
+        )
+        logger.info(f"导入服务状态: {tenant_id} - {result.message}")
+        return result, imported_tasks
+
+    def _extract_files(self, archive: zipfile.ZipFile, file_ids: set, base: Path) -> int:
+        """
+        写入本次导入的文件记录对应的原文件和章节输出
+
+        只接受 files/{file_id}/{原文件} 和 files/{file_id}/chapters/{文件名} 两种路径
+        """
+        extracted = 0
+        for info in archive.infolist():
+            if info.is_dir():
+                continue
+            parts = PurePosixPath(info.filename).parts
+            if not parts or parts[0] != FILES_PREFIX:
+                continue
+
+            if len(parts) == 3 and parts[2] in SOURCE_FILENAMES:
+                file_id, relative = parts[1], Path(parts[2])
+            elif len(parts) == 4 and parts[2] == "chapters" and self._is_safe_id(parts[3]):
+                file_id, relative = parts[1], Path("chapters") / parts[3]
+            else:
+                logger.warning(f"忽略状态包中无法识别的条目: {info.filename}")
+                continue
+            if file_id not in file_ids:
+                continue
+
+            target = base / file_id / relative
+            target.parent.mkdir(parents=True, exist_ok=True)
+            with archive.open(info) as src, open(target, "wb") as dest:
+                shutil.copyfileobj(src, dest)
+            extracted += 1
+        return extracted
+
+    @staticmethod
+    def _is_safe_id(value: str) -> bool:
+        """ID或文件名只能是单层的普通名称"""
+        return bool(value) and Path(value).name == value and value not in (".", "..") and "\\" not in value
+
+
+# 创建全局服务状态导出导入服务实例
+state_service = StateService()
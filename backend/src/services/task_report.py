@@ -0,0 +1,265 @@
+"""
+任务报告
+拆分任务完成时把输入、选项、生成的章节文件（含校验和）、警告和各阶段耗时保存为报告快照，
+供存档时下载为HTML或PDF；快照与任务记录一起清理
+"""
+
+import html
+import json
+from datetime import datetime
+from typing import List, Optional, Tuple
+
+import fitz
+from loguru import logger
+
+from ..core.store import get_store
+from ..models.schemas import FileInfo, OutputManifest, SplitTask, TaskEvent, TaskReport
+
+
+TASK_REPORTS_BUCKET = "task_reports"
+
+# 报告中不作为选项展示的任务字段（章节列表单独统计）
+REPORT_OPTION_EXCLUDES = {"chapters"}
+
+# PDF报告的页面尺寸（A4，pt）、边距和字号
+REPORT_PAGE_SIZE = (595, 842)
+REPORT_MARGIN = 50
+REPORT_FONT_SIZE = 9
+REPORT_HEADING_SIZE = 12
+
+# 报告的一节：(标题, 表头或None, 行)
+ReportSection = Tuple[str, Optional[List[str]], List[List[str]]]
+
+
+class TaskReportService:
+    """任务报告的生成、保存和渲染"""
+
+    def build(
+        self,
+        task: SplitTask,
+        events: List[TaskEvent],
+        manifest: Optional[OutputManifest],
+        options: dict,
+        file_info: Optional[FileInfo] = None
+    ) -> TaskReport:
+        """
+        由已完成的任务、事件时间线和输出清单生成报告
+
+        Args:
+            task: 已完成的拆分任务
+            events: 任务事件（按时间排序）
+            manifest: 本次输出的校验清单
+            options: 影响输出的拆分选项
+            file_info: 原文件信息
+
+        Returns:
+            报告快照
+        """
+        started = [event.timestamp for event in events if event.event == "started"]
+        started_at = started[-1] if started else None
+
+        # 章节耗时按相邻两个章节事件的间隔计算，第一个章节从开始处理算起
+        chapter_seconds = {}
+        failed_chapters = []
+        previous = started_at
+        for event in events:
+            if event.event not in ("chapter_done", "chapter_failed"):
+                continue
+            if event.event == "chapter_done" and event.details.get("filename") and previous:
+                chapter_seconds[event.details["filename"]] = round((event.timestamp - previous).total_seconds(), 3)
+            elif event.event == "chapter_failed":
+                failed_chapters.append(f"{event.message}（{event.details.get('error', '')}）")
+            previous = event.timestamp
+
+        produced = set(task.download_links)
+        return TaskReport(
+            task_id=task.task_id,
+            file_id=task.file_id,
+            filename=file_info.filename if file_info else None,
+            file_hash=file_info.file_hash if file_info else None,
+            created_at=task.created_at,
+            started_at=started_at,
+            completed_at=task.completed_at,
+            queued_seconds=self._seconds(task.created_at, started_at),
+            processing_seconds=self._seconds(started_at, task.completed_at),
+            owner=task.owner,
+            preset_id=task.preset_id,
+            options={key: value for key, value in options.items() if key not in REPORT_OPTION_EXCLUDES},
+            chapters_requested=len(task.chapters),
+            files=[entry for entry in manifest.files if entry.filename in produced] if manifest else [],
+            chapter_seconds=chapter_seconds,
+            failed_chapters=failed_chapters,
+            warnings=task.warnings,
+            cache_hit=task.cache_hit
+        )
+
+    @staticmethod
+    def _seconds(start: Optional[datetime], end: Optional[datetime]) -> Optional[float]:
+        """两个时间点之间的秒数"""
+        if not start or not end:
+            return None
+        return round((end - start).total_seconds(), 3)
+
+    async def save(self, report: TaskReport) -> None:
+        """保存报告快照"""
+        try:
+            await get_store().aput(TASK_REPORTS_BUCKET, report.task_id, report.model_dump(mode="json"))
+        except Exception as e:
+            logger.error(f"保存任务报告失败: {report.task_id} - {str(e)}")
+
+    async def get(self, task_id: str) -> Optional[TaskReport]:
+        """读取报告快照，任务完成于报告功能之前时为None"""
+        data = await get_store().aget(TASK_REPORTS_BUCKET, task_id)
+        if not data:
+            return None
+        try:
+            return TaskReport(**data)
+        except Exception as e:
+            logger.error(f"读取任务报告失败: {task_id} - {str(e)}")
+            return None
+
+    async def delete(self, task_id: str) -> None:
+        """删除报告快照"""
+        await get_store().adelete(TASK_REPORTS_BUCKET, task_id)
+
+    def _sections(self, report: TaskReport) -> List[ReportSection]:
+        """报告内容，HTML和PDF共用"""
+        def fmt_time(value: Optional[datetime]) -> str:
+            return value.strftime("%Y-%m-%d %H:%M:%S") if value else "-"
+
+        def fmt_seconds(value: Optional[float]) -> str:
+            return f"{value:.2f} 秒" if value is not None else "-"
+
+        sections: List[ReportSection] = [
+            ("输入", None, [
+                ["任务ID", report.task_id],
+                ["文件ID", report.file_id],
+                ["原文件名", report.filename or "-"],
+                ["文件SHA-256", report.file_hash or "-"],
+                ["创建者", report.owner or "-"],
+                ["预设", report.preset_id or "-"],
+                ["请求章节数", str(report.chapters_requested)],
+            ]),
+            ("耗时", None, [
+                ["创建时间", fmt_time(report.created_at)],
+                ["开始处理", fmt_time(report.started_at)],
+                ["完成时间", fmt_time(report.completed_at)],
+                ["排队", fmt_seconds(report.queued_seconds)],
+                ["处理", fmt_seconds(report.processing_seconds)],
+                ["复用已有输出", "是" if report.cache_hit else "否"],
+            ]),
+            ("选项", None, [
+                [key, json.dumps(value, ensure_ascii=False)] for key, value in sorted(report.options.items())
+            ]),
+            ("生成的文件", ["文件名", "标题", "页码", "页数", "大小（字节）", "耗时", "SHA-256"], [
+                [
+                    entry.filename,
+                    entry.title,
+                    f"{entry.start_page}-{entry.end_page}",
+                    str(entry.pages),
+                    str(entry.size),
+                    fmt_seconds(report.chapter_seconds.get(entry.filename)),
+                    entry.sha256,
+                ]
+                for entry in report.files
+            ]),
+        ]
+        if report.failed_chapters:
+            sections.append(("失败的章节", None, [[message] for message in report.failed_chapters]))
+        if report.warnings:
+            sections.append(("警告", ["代码", "描述"], [[w.code.value, w.message] for w in report.warnings]))
+        return sections
+
+    def render_html(self, report: TaskReport) -> str:
+        """
+        渲染为HTML
+
+        Args:
+            report: 报告快照
+
+        Returns:
+            完整的HTML文档
+        """
+        parts = [
+            "<!DOCTYPE html>",
+            '<html lang="zh-CN"><head><meta charset="utf-8">',
+            f"<title>拆分任务报告 {html.escape(report.task_id)}</title>",
+            "<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse;margin-bottom:1.5em}"
+            "th,td{border:1px solid #ccc;padding:4px 8px;text-align:left;vertical-align:top}"
+            "td.mono{font-family:monospace;word-break:break-all}</style>",
+            "</head><body>",
+            f"<h1>拆分任务报告</h1><p>生成时间: {report.generated_at.strftime('%Y-%m-%d %H:%M:%S')}</p>",
+        ]
+        for title, header, rows in self._sections(report):
+            parts.append(f"<h2>{html.escape(title)}</h2><table>")
+            if header:
+                parts.append("<tr>" + "".join(f"<th>{html.escape(cell)}</th>" for cell in header) + "</tr>")
+            for row in rows:
+                cells = []
+                for i, cell in enumerate(row):
+                    if header is None and i == 0 and len(row) > 1:
+                        cells.append(f"<th>{html.escape(cell)}</th>")
+                    else:
+                        css = ' class="mono"' if header and header[i] == "SHA-256" else ""
+                        cells.append(f"<td{css}>{html.escape(cell)}</td>")
+                parts.append("<tr>" + "".join(cells) + "</tr>")
+            if not rows:
+                parts.append(f'<tr><td colspan="{len(header) if header else 1}">无</td></tr>')
+            parts.append("</table>")
+        parts.append("</body></html>")
+        return "\n".join(parts)
+
+    def render_pdf(self, report: TaskReport) -> bytes:
+        """
+        渲染为PDF，内容与HTML相同，表格的每行按“单元格 | 单元格”排版并自动换行
+
+        Args:
+            report: 报告快照
+
+        Returns:
+            PDF内容
+        """
+        font = fitz.Font("china-s")
+        width = REPORT_PAGE_SIZE[0] - 2 * REPORT_MARGIN
+
+        lines = [("拆分任务报告", 16), (f"生成时间: {report.generated_at.strftime('%Y-%m-%d %H:%M:%S')}", REPORT_FONT_SIZE)]
+        for title, header, rows in self._sections(report):
+            lines.append(("", REPORT_FONT_SIZE))
+            lines.append((title, REPORT_HEADING_SIZE))
+            for row in ([header] if header else []) + (rows or [["无"]]):
+                text = ": ".join(row) if header is None and len(row) == 2 else " | ".join(row)
+                lines.extend((line, REPORT_FONT_SIZE) for line in self._wrap(font, text, width))
+
+        doc = fitz.open()
+        try:
+            page = None
+            y = 0
+            for text, size in lines:
+                height = size * 1.5
+                if page is None or y + height > REPORT_PAGE_SIZE[1] - REPORT_MARGIN:
+                    page = doc.new_page(width=REPORT_PAGE_SIZE[0], height=REPORT_PAGE_SIZE[1])
+                    y = REPORT_MARGIN
+                y += height
+                if text:
+                    page.insert_text((REPORT_MARGIN, y), text, fontsize=size, fontname="china-s")
+            doc.set_metadata({"title": f"拆分任务报告 {report.task_id}"})
+            return doc.tobytes(garbage=3, deflate=True)
+        finally:
+            doc.close()
+
+    @staticmethod
+    def _wrap(font: fitz.Font, text: str, width: float) -> List[str]:
+        """按宽度逐字符换行，续行缩进两格"""
+        lines = []
+        current = ""
+        for char in text:
+            if current and font.text_length(current + char, fontsize=REPORT_FONT_SIZE) > width:
+                lines.append(current)
+                current = "  "
+            current += char
+        lines.append(current)
+        return lines
+
+
+# 创建全局任务报告服务实例
+task_report_service = TaskReportService()
@@ -3,17 +3,113 @@
 """
 
 import asyncio
+import hashlib
+import itertools
 import json
+import shutil
+import time
 from typing import Dict, Optional, List
-from datetime import datetime
-from uuid import uuid4
+from datetime import datetime, timedelta
 from pathlib import Path
+from uuid import uuid4
 
 from loguru import logger
 
-from ..models.schemas import SplitTask, TaskStatus, ChapterInfo
+from ..models.schemas import (
+    SplitTask,
+    TaskStatus,
+    TaskPriority,
+    TaskType,
+    ChapterInfo,
+    TaskEvent,
+    NotificationConfig,
+    AnalyzeRequest,
+    DeliveryConfig,
+    ConnectorExport,
+    AttachmentMode,
+    RedactionSpec,
+    BatesConfig,
+    PageNumberStamp,
+    PageRange,
+    SignatureHandling,
+    SigningMode,
+    UnreadablePageHandling,
+    OutputManifest,
+    ErrorCode,
+    WarningCode
+)
 from ..core.config import settings
-from .pdf_splitter import PDFSplitter
+from ..core.diagnostics import collect_warnings
+from ..core.errors import ConflictError, NotFoundError, code_for_exception, details_for_exception, is_engine_crash
+from ..core.memory import memory_budget, estimate_document_bytes
+from ..core.scratch import scratch_dir, commit_outputs
+from ..core.tenancy import file_storage_dir, get_current_tenant, is_ephemeral_file, use_tenant
+from ..core.auth import get_current_principal, is_admin
+from ..core.store import get_store
+from ..core.leader import leader_election
+from .pdf_splitter import create_splitter, fill_document_fields, BUNDLE_FILENAME, MANIFEST_FILENAME, DEFAULT_FILENAME_TEMPLATE
+from .delivery_service import delivery_service
+from .output_store import output_store
+from .connector_service import connector_service
+from .analysis_service import AnalysisService
+from .document_title import filename_fields
+from .file_service import source_pdf_path
+from .retention import task_expires_at
+from .signatures import count_signatures
+from .split_checkpoint import SplitCheckpoint, cleanup_checkpoints
+from .upload_session_service import upload_session_service
+from .notification_service import notification_service, EVENT_FILE_QUARANTINED, EVENT_TASK_COMPLETED, EVENT_TASK_FAILED
+from .task_report import task_report_service
+from .task_state import FINISHED_STATUSES, can_transition
+from .audit_service import audit_service
+
+
+# 优先级对应的队列排序值，数值越小越先处理
+PRIORITY_RANK = {
+    TaskPriority.HIGH: 0,
+    TaskPriority.NORMAL: 1,
+    TaskPriority.LOW: 2,
+}
+
+# 停止信号排在所有任务之后
+_STOP_RANK = 99
+
+# 过期上传会话的回收间隔（秒）
+UPLOAD_SESSION_CLEANUP_INTERVAL = 300
+
+# 参与输出缓存键的任务字段（影响章节输出内容的选项）
+OUTPUT_CACHE_FIELDS = {
+    "chapters",
+    "filename_template",
+    "optimize",
+    "strip_metadata",
+    "watermark_text",
+    "max_output_bytes",
+    "attachments",
+    "redactions",
+    "bates",
+    "page_numbers",
+    "pdfa",
+    "grayscale",
+    "strip_backgrounds",
+    "deskew",
+    "ocr_text_layer",
+    "best_effort",
+    "unreadable_pages",
+    "bookmarked_copy",
+    "exclude_pages",
+    "group_dividers",
+    "bundle",
+    "signatures",
+    "sign",
+}
+
+# 重试时按原任务沿用的输出选项（与create_split_task的同名参数对应）
+RETRY_OPTION_FIELDS = OUTPUT_CACHE_FIELDS - {"chapters"}
+
+# 存储bucket
+TASKS_BUCKET = "tasks"
+TASK_EVENTS_BUCKET = "task_events"
 
 
 class TaskService:
@@ -21,15 +117,22 @@ class TaskService:
     
     def __init__(self):
         self.tasks: Dict[str, SplitTask] = {}
-        self.pdf_splitter = PDFSplitter()
-        self.upload_dir = Path(settings.UPLOAD_DIR)
+        self.task_events: Dict[str, List[TaskEvent]] = {}
+        self.pdf_splitter = create_splitter()
+        self.analysis_service = AnalysisService()
         self._initialized = False
         
-        # 任务队列和并发控制
-        self._task_queue = asyncio.Queue()
+        # 任务队列和并发控制（按优先级出队，同优先级先进先出）
+        self._task_queue = asyncio.PriorityQueue()
+        self._queue_seq = itertools.count()
         self._processing_tasks: Dict[str, asyncio.Task] = {}
         self._max_concurrent_tasks = settings.MAX_CONCURRENT_TASKS
         self._worker_tasks: List[asyncio.Task] = []
+        self._scheduler_task: Optional[asyncio.Task] = None
+    
+    async def start(self) -> None:
+        """启动时加载任务、恢复中断的任务并启动工作线程，不等到第一个请求"""
+        await self._ensure_initialized()
     
     async def _ensure_initialized(self):
         """确保服务已初始化"""
@@ -44,6 +147,105 @@ class TaskService:
             worker = asyncio.create_task(self._worker(f"worker-{i}"))
             self._worker_tasks.append(worker)
         logger.info(f"启动了 {self._max_concurrent_tasks} 个任务处理工作线程")
+        
+        self._scheduler_task = asyncio.create_task(self._scheduler())
+    
+    async def _scheduler(self):
+        """延迟任务调度器，到期后将任务加入处理队列；多副本部署时只在主节点执行"""
+        logger.info("延迟任务调度器启动")
+        last_cleanup = 0.0
+        last_session_cleanup = 0.0
+        last_checkpoint_cleanup = 0.0
+        last_ephemeral_cleanup = 0.0
+        
+        while True:
+            # 检查点和隐私模式文件在各副本本地的TEMP_DIR中，每个副本各自清理
+            if time.monotonic() - last_checkpoint_cleanup >= 3600:
+                last_checkpoint_cleanup = time.monotonic()
+                try:
+                    await asyncio.to_thread(cleanup_checkpoints)
+                except Exception as e:
+                    logger.error(f"清理拆分检查点时出错: {str(e)}")
+            
+            if time.monotonic() - last_ephemeral_cleanup >= UPLOAD_SESSION_CLEANUP_INTERVAL:
+                last_ephemeral_cleanup = time.monotonic()
+                try:
+                    purged = await self.analysis_service.file_service.purge_expired_ephemeral()
+                    await self.purge_file_tasks(purged)
+                except Exception as e:
+                    logger.error(f"清理隐私模式文件时出错: {str(e)}")
+            
+            if leader_election.is_leader:
+                try:
+                    await self._sync_scheduled_tasks()
+                    await self._dispatch_due_tasks()
+                except Exception as e:
+                    logger.error(f"调度延迟任务时出错: {str(e)}")
+                
+                # 按保留策略每小时清理一次过期的任务、章节输出和原文件
+                if time.monotonic() - last_cleanup >= 3600:
+                    last_cleanup = time.monotonic()
+                    await self.cleanup_completed_tasks()
+                    await self._cleanup_files()
+                
+                # 过期的上传会话每5分钟回收一次，同时检查已停止的副本遗留的排队中和处理中任务
+                if time.monotonic() - last_session_cleanup >= UPLOAD_SESSION_CLEANUP_INTERVAL:
+                    last_session_cleanup = time.monotonic()
+                    try:
+                        await self._recover_interrupted_tasks()
+                    except Exception as e:
+                        logger.error(f"恢复中断的任务时出错: {str(e)}")
+                    try:
+                        await upload_session_service.cleanup_expired()
+                    except Exception as e:
+                        logger.error(f"回收上传会话时出错: {str(e)}")
+            
+            await asyncio.sleep(settings.SCHEDULER_INTERVAL)
+    
+    async def _cleanup_files(self) -> None:
+        """按各租户的保留策略清理过期的章节输出、原文件和审计记录"""
+        file_service = self.analysis_service.file_service
+        for tenant_id in [settings.DEFAULT_TENANT, *settings.TENANTS]:
+            try:
+                with use_tenant(tenant_id):
+                    await file_service.cleanup_outputs()
+                    await file_service.cleanup_originals()
+                await audit_service.cleanup_expired(tenant_id)
+            except Exception as e:
+                logger.error(f"按保留策略清理文件时出错: {tenant_id} - {str(e)}")
+    
+    async def _sync_scheduled_tasks(self) -> None:
+        """从存储中补充其他副本创建的延迟任务，由主节点统一派发"""
+        for data in await get_store().avalues(TASKS_BUCKET, statuses=[TaskStatus.SCHEDULED.value]):
+            if data.get("task_id") in self.tasks:
+                continue
+            try:
+                task = SplitTask(**data)
+                self.tasks[task.task_id] = task
+            except Exception as e:
+                logger.error(f"加载延迟任务失败: {data.get('task_id')} - {str(e)}")
+    
+    async def _dispatch_due_tasks(self) -> int:
+        """
+        将到期的延迟任务加入处理队列
+        
+        Returns:
+            本次派发的任务数量
+        """
+        now = datetime.now()
+        due_tasks = [
+            task for task in self.tasks.values()
+            if task.status == TaskStatus.SCHEDULED and (task.run_at is None or task.run_at <= now)
+        ]
+        
+        for task in due_tasks:
+            if not await self._transition(task, TaskStatus.PENDING, "due", "计划时间已到"):
+                continue
+            if not await self._enqueue(task, "任务已加入处理队列"):
+                continue
+            logger.info(f"延迟任务到期，加入处理队列: {task.task_id}")
+        
+        return len(due_tasks)
     
     async def _worker(self, worker_name: str):
         """任务处理工作线程"""
@@ -52,21 +254,30 @@ class TaskService:
         while True:
             try:
                 # 从队列获取任务
-                task_id = await self._task_queue.get()
+                _, _, task_id = await self._task_queue.get()
                 
                 if task_id is None:  # 停止信号
                     break
                 
                 task = self.tasks.get(task_id)
-                if task and task.status == TaskStatus.PENDING:
+                if task and task.status == TaskStatus.QUEUED:
                     logger.info(f"工作线程 {worker_name} 开始处理任务: {task_id}")
                     
-                    # 创建处理任务
-                    processing_task = asyncio.create_task(self._process_split_task(task))
+                    # 创建处理任务（在任务所属租户的上下文中执行）
+                    with use_tenant(task.tenant_id):
+                        if task.task_type == TaskType.ANALYZE:
+                            processing_task = asyncio.create_task(self._process_analysis_task(task))
+                        else:
+                            processing_task = asyncio.create_task(self._process_split_task(task))
                     self._processing_tasks[task_id] = processing_task
                     
                     try:
                         await processing_task
+                    except asyncio.CancelledError:
+                        # 任务被取消时处理协程随之取消，工作线程继续处理下一个任务
+                        if task.status != TaskStatus.CANCELLED:
+                            raise
+                        logger.info(f"已停止被取消任务的处理: {task_id}")
                     finally:
                         # 清理处理任务
                         if task_id in self._processing_tasks:
@@ -83,49 +294,287 @@ class TaskService:
         """停止所有工作线程"""
         # 发送停止信号
         for _ in self._worker_tasks:
-            await self._task_queue.put(None)
+            await self._task_queue.put((_STOP_RANK, next(self._queue_seq), None))
         
         # 等待所有工作线程完成
         await asyncio.gather(*self._worker_tasks, return_exceptions=True)
         
+        if self._scheduler_task:
+            self._scheduler_task.cancel()
+        
         # 取消所有正在处理的任务
         for task in self._processing_tasks.values():
             task.cancel()
         
         logger.info("所有任务处理工作线程已停止")
     
-    async def create_split_task(self, file_id: str, chapters: List[ChapterInfo]) -> SplitTask:
+    async def create_split_task(
+        self,
+        file_id: str,
+        chapters: List[ChapterInfo],
+        notifications: Optional[List[NotificationConfig]] = None,
+        run_at: Optional[datetime] = None,
+        priority: TaskPriority = TaskPriority.NORMAL,
+        delivery: Optional[DeliveryConfig] = None,
+        export: Optional[ConnectorExport] = None,
+        filename_template: str = DEFAULT_FILENAME_TEMPLATE,
+        optimize: bool = False,
+        preset_id: Optional[str] = None,
+        strip_metadata: bool = False,
+        watermark_text: Optional[str] = None,
+        max_output_bytes: Optional[int] = None,
+        attachments: AttachmentMode = AttachmentMode.NONE,
+        redactions: Optional[List[RedactionSpec]] = None,
+        bates: Optional[BatesConfig] = None,
+        page_numbers: Optional[PageNumberStamp] = None,
+        pdfa: bool = False,
+        grayscale: bool = False,
+        strip_backgrounds: bool = False,
+        deskew: bool = False,
+        ocr_text_layer: bool = False,
+        best_effort: bool = False,
+        unreadable_pages: UnreadablePageHandling = UnreadablePageHandling.PLACEHOLDER,
+        bookmarked_copy: bool = False,
+        exclude_pages: Optional[List[PageRange]] = None,
+        group_dividers: bool = False,
+        bundle: bool = False,
+        signatures: SignatureHandling = SignatureHandling.STRIP,
+        sign: SigningMode = SigningMode.NONE,
+        bypass_cache: bool = False
+    ) -> SplitTask:
         """
         创建拆分任务
         
         Args:
             file_id: 文件ID
             chapters: 章节列表
+            notifications: 请求级通知配置
+            run_at: 计划执行时间，为空或已过期时立即入队
+            priority: 任务优先级
+            delivery: 完成后推送章节文件的目标
+            export: 完成后写回的云盘文件夹
+            filename_template: 章节文件名模板
+            optimize: 是否压缩输出文件
+            preset_id: 应用的预设
+            strip_metadata: 是否清除输出文件的元数据
+            watermark_text: 输出文件的水印文字
+            max_output_bytes: 单个章节文件大小上限
+            attachments: 章节输出携带嵌入附件的方式
+            redactions: 拆分前的涂黑规则
+            bates: 跨章节连续的Bates编号
+            page_numbers: 每个章节重新编号的页码
+            pdfa: 是否转换为PDF/A-2b
+            grayscale: 是否转换为灰度
+            strip_backgrounds: 是否删除背景图片
+            deskew: 是否纠正扫描页的方向和倾斜
+            ocr_text_layer: 是否为扫描页写入不可见的OCR文字层
+            best_effort: 是否跳过无法读取的页面而不使章节失败
+            unreadable_pages: 尽力拆分时无法读取页面的处理方式
+            bookmarked_copy: 是否额外输出按章节结构重建书签的原文件副本
+            exclude_pages: 从所有章节输出中删除的原文件页
+            group_dividers: 是否在分组输出的每个成员章节前插入分隔页
+            bundle: 是否在拆分时逐章写入打包文件
+            signatures: 已签名文件的拆分方式
+            sign: 章节输出的数字签名方式
+            bypass_cache: 是否忽略已有输出强制重新拆分
             
         Returns:
             拆分任务
+            
+        Raises:
+            ConflictError: 文件已被隔离
         """
+        await self._check_quarantine(file_id)
         await self._ensure_initialized()
         task_id = str(uuid4())
+        scheduled = run_at is not None and run_at > datetime.now()
         
         task = SplitTask(
             task_id=task_id,
             file_id=file_id,
             chapters=chapters,
-            status=TaskStatus.PENDING,
-            progress=0
+            status=TaskStatus.SCHEDULED if scheduled else TaskStatus.PENDING,
+            progress=0,
+            notifications=notifications or [],
+            run_at=run_at,
+            priority=priority,
+            delivery=delivery,
+            export=export,
+            filename_template=filename_template,
+            optimize=optimize,
+            strip_metadata=strip_metadata,
+            watermark_text=watermark_text,
+            max_output_bytes=max_output_bytes,
+            attachments=attachments,
+            redactions=redactions or [],
+            bates=bates,
+            page_numbers=page_numbers,
+            pdfa=pdfa,
+            grayscale=grayscale,
+            strip_backgrounds=strip_backgrounds,
+            deskew=deskew,
+            ocr_text_layer=ocr_text_layer,
+            best_effort=best_effort,
+            unreadable_pages=unreadable_pages,
+            bookmarked_copy=bookmarked_copy,
+            exclude_pages=exclude_pages or [],
+            group_dividers=group_dividers,
+            bundle=bundle,
+            signatures=signatures,
+            sign=sign,
+            bypass_cache=bypass_cache,
+            preset_id=preset_id,
+            tenant_id=get_current_tenant(),
+            owner=get_current_principal().user
         )
+        file_hash = await self.analysis_service.file_service.get_file_hash(file_id)
+        if file_hash:
+            task.cache_key = self._output_cache_key(task, file_hash)
         
         # 保存任务
         self.tasks[task_id] = task
         await self._save_task(task)
         
+        if scheduled:
+            await self._ensure_task_events(task_id)
+            self._record_event(task_id, "scheduled", f"任务计划于 {run_at.isoformat()} 执行", progress=0)
+            logger.info(f"创建延迟拆分任务: {task_id} - 文件: {file_id}，计划执行时间: {run_at}")
+            return task
+        
+        # 命中输出缓存且无需投递时立即完成，不必排队
+        output_dir = file_storage_dir(file_id, task.tenant_id) / "chapters"
+        if not bypass_cache and not task.delivery and not task.export and self._cached_outputs(task, output_dir) is not None:
+            await self._process_split_task(task)
+            logger.info(f"拆分任务命中输出缓存: {task_id} - 文件: {file_id}")
+            return task
+        
         # 将任务添加到队列
-        await self._task_queue.put(task_id)
+        await self._enqueue(task, "任务已加入处理队列")
         
         logger.info(f"创建拆分任务: {task_id} - 文件: {file_id}，已加入处理队列")
         return task
     
+    async def create_analysis_task(
+        self,
+        request: AnalyzeRequest,
+        priority: TaskPriority = TaskPriority.NORMAL
+    ) -> SplitTask:
+        """
+        创建异步章节分析任务（用于超大文档）
+        
+        Args:
+            request: 分析请求
+            priority: 任务优先级
+            
+        Returns:
+            分析任务
+        """
+        await self._ensure_initialized()
+        task_id = str(uuid4())
+        
+        task = SplitTask(
+            task_id=task_id,
+            file_id=request.file_id,
+            task_type=TaskType.ANALYZE,
+            status=TaskStatus.PENDING,
+            progress=0,
+            priority=priority,
+            analysis_request=request,
+            tenant_id=get_current_tenant(),
+            owner=get_current_principal().user
+        )
+        
+        self.tasks[task_id] = task
+        await self._save_task(task)
+        
+        await self._enqueue(task, "分析任务已加入处理队列")
+        
+        logger.info(f"创建分析任务: {task_id} - 文件: {request.file_id}，已加入处理队列")
+        return task
+    
+    def _is_visible(self, task: SplitTask) -> bool:
+        """任务对当前调用方是否可见：限于同一租户，非管理员只能看到自己创建的任务"""
+        if task.tenant_id != get_current_tenant():
+            return False
+        principal = get_current_principal()
+        return is_admin(principal) or task.owner is None or task.owner == principal.user
+    
+    async def _get_visible_task(self, task_id: str) -> Optional[SplitTask]:
+        """获取当前调用方可见的任务，不可见的任务视为不存在"""
+        task = await self._read_task(task_id)
+        if task and self._is_visible(task):
+            return task
+        return None
+    
+    async def _read_task(self, task_id: str) -> Optional[SplitTask]:
+        """
+        从存储读取任务的最新状态，多副本部署时其他副本创建或处理的任务同样可见
+        
+        返回的是副本，本副本处理中的任务对象只由处理流程修改；存储不可用时退回本地记录
+        """
+        try:
+            data = await get_store().aget(TASKS_BUCKET, task_id)
+        except Exception as e:
+            logger.error(f"读取任务失败: {task_id} - {str(e)}")
+            return self.tasks.get(task_id)
+        if data is None:
+            return None
+        try:
+            return SplitTask(**data)
+        except Exception as e:
+            logger.error(f"加载任务记录失败: {task_id} - {str(e)}")
+            return None
+    
+    async def _enqueue(self, task: SplitTask, message: str = "") -> bool:
+        """
+        按优先级将任务加入处理队列，待入队的任务先切换为queued
+        
+        Args:
+            task: 待入队或已是queued状态（重启后恢复）的任务
+            message: 入队事件描述
+            
+        Returns:
+            是否已加入队列，任务已被取消时返回False
+        """
+        if task.status == TaskStatus.QUEUED:
+            if not await self._claim_queued(task):
+                return False
+        elif not await self._transition(
+            task, TaskStatus.QUEUED, "queued", message, changes={"worker_node": leader_election.node_id}
+        ):
+            return False
+        rank = PRIORITY_RANK.get(task.priority, PRIORITY_RANK[TaskPriority.NORMAL])
+        await self._task_queue.put((rank, next(self._queue_seq), task.task_id))
+        return True
+    
+    async def _claim_queued(self, task: SplitTask) -> bool:
+        """
+        把已入队的任务转到本副本的队列（重启或其他副本停止后遗留），存储中已被其他副本领取或状态已变化时放弃
+        
+        Args:
+            task: queued状态的任务
+            
+        Returns:
+            是否领取成功
+        """
+        previous = task.worker_node
+        node_id = leader_election.node_id
+        
+        def mutate(current):
+            if current is None or current.get("status") != TaskStatus.QUEUED.value or current.get("worker_node") != previous:
+                return None
+            return {**current, "worker_node": node_id}
+        
+        try:
+            if await get_store().aupdate(TASKS_BUCKET, task.task_id, mutate) is None:
+                return False
+        except Exception as e:
+            logger.error(f"领取排队任务失败: {task.task_id} - {str(e)}")
+            return False
+        
+        task.worker_node = node_id
+        return True
+    
     async def get_task_status(self, task_id: str) -> Optional[SplitTask]:
         """
         获取任务状态
@@ -137,7 +586,34 @@ class TaskService:
             任务信息或None
         """
         await self._ensure_initialized()
-        return self.tasks.get(task_id)
+        task = await self._get_visible_task(task_id)
+        if task:
+            task.expires_at = task_expires_at(task)
+        return task
+    
+    async def get_task_events(self, task_id: str) -> Optional[List[TaskEvent]]:
+        """
+        获取任务事件时间线
+        
+        Args:
+            task_id: 任务ID
+            
+        Returns:
+            按时间排序的事件列表，任务不存在时返回None
+        """
+        await self._ensure_initialized()
+        
+        if not await self._get_visible_task(task_id):
+            return None
+        
+        # 本副本的任务使用内存中的事件（可能尚未写入存储），其他副本的任务从存储读取
+        if task_id in self.tasks:
+            await self._ensure_task_events(task_id)
+            events = self.task_events[task_id]
+        else:
+            events = await self._load_task_events(task_id)
+        
+        return sorted(events, key=lambda e: e.timestamp)
     
     async def list_tasks(self, file_id: Optional[str] = None) -> List[SplitTask]:
         """
@@ -149,16 +625,44 @@ class TaskService:
         Returns:
             任务列表
         """
-        tasks = list(self.tasks.values())
+        await self._ensure_initialized()
+        try:
+            records = await get_store().avalues(TASKS_BUCKET)
+        except Exception as e:
+            logger.error(f"读取任务列表失败: {str(e)}")
+            records = [task.model_dump(mode="json") for task in self.tasks.values()]
+        
+        tasks = []
+        for data in records:
+            try:
+                task = SplitTask(**data)
+            except Exception as e:
+                logger.error(f"加载任务记录失败: {data.get('task_id')} - {str(e)}")
+                continue
+            if self._is_visible(task):
+                tasks.append(task)
         
         if file_id:
             tasks = [task for task in tasks if task.file_id == file_id]
         
         # 按创建时间倒序排列
         tasks.sort(key=lambda x: x.created_at, reverse=True)
+        for task in tasks:
+            task.expires_at = task_expires_at(task)
         
         return tasks
     
+    def add_imported_tasks(self, tasks: List[SplitTask]) -> None:
+        """
+        把从状态包导入（已写入存储）的任务加入内存，无需重启即可查询
+        
+        Args:
+            tasks: 已结束的任务
+        """
+        for task in tasks:
+            self.tasks[task.task_id] = task
+            self.task_events.pop(task.task_id, None)
+    
     async def cancel_task(self, task_id: str) -> bool:
         """
         取消任务
@@ -169,22 +673,65 @@ class TaskService:
         Returns:
             是否成功
         """
-        task = self.tasks.get(task_id)
+        task = await self._get_visible_task(task_id)
         
         if not task:
             return False
         
-        if task.status in [TaskStatus.PENDING, TaskStatus.PROCESSING]:
-            task.status = TaskStatus.FAILED
-            task.error_message = "任务已被取消"
-            task.completed_at = datetime.now()
+        changes = {"error_message": "任务已被取消", "completed_at": datetime.now()}
+        cancelled = await self._transition(task, TaskStatus.CANCELLED, "cancelled", "任务已被取消", changes=changes)
+        if cancelled:
+            # 本副本持有的任务对象同步为已取消，工作线程和处理流程据此停止
+            local = self.tasks.get(task_id)
+            if local is not None and local is not task:
+                local.status = TaskStatus.CANCELLED
+                for field, value in changes.items():
+                    setattr(local, field, value)
             
-            await self._save_task(task)
+            # 停止本实例上正在进行的处理，子进程和大模型调用随之中止
+            processing_task = self._processing_tasks.get(task_id)
+            if processing_task:
+                processing_task.cancel()
             logger.info(f"任务已取消: {task_id}")
             return True
         
         return False
     
+    async def retry_task(self, task_id: str) -> Optional[SplitTask]:
+        """
+        以相同的文件、章节和选项重新创建失败或已取消的拆分任务，已完成的章节从检查点恢复
+        
+        Args:
+            task_id: 任务ID
+            
+        Returns:
+            新任务，原任务不存在时为None
+            
+        Raises:
+            ConflictError: 原任务不是失败或已取消的拆分任务
+        """
+        task = await self._get_visible_task(task_id)
+        if not task:
+            return None
+        if task.task_type != TaskType.SPLIT or task.status not in (TaskStatus.FAILED, TaskStatus.CANCELLED):
+            raise ConflictError("只能重试失败或已取消的拆分任务")
+        
+        retried = await self.create_split_task(
+            task.file_id,
+            task.chapters,
+            notifications=task.notifications,
+            priority=task.priority,
+            delivery=task.delivery,
+            export=task.export,
+            preset_id=task.preset_id,
+            bypass_cache=task.bypass_cache,
+            **{name: getattr(task, name) for name in RETRY_OPTION_FIELDS}
+        )
+        await self._ensure_task_events(task_id)
+        self._record_event(task_id, "retried", f"已重新创建任务 {retried.task_id}", retry_task_id=retried.task_id)
+        logger.info(f"重试拆分任务: {task_id} -> {retried.task_id}")
+        return retried
+    
     async def get_queue_status(self) -> dict:
         """
         获取任务队列状态
@@ -194,24 +741,68 @@ class TaskService:
         """
         await self._ensure_initialized()
         
+        scheduled_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.SCHEDULED)
         pending_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.PENDING)
+        queued_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.QUEUED)
         processing_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.PROCESSING)
         completed_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.COMPLETED)
         failed_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.FAILED)
+        cancelled_count = sum(1 for task in self.tasks.values() if task.status == TaskStatus.CANCELLED)
         
         return {
             "queue_size": self._task_queue.qsize(),
             "active_workers": len([t for t in self._worker_tasks if not t.done()]),
             "processing_tasks": len(self._processing_tasks),
             "task_counts": {
+                "scheduled": scheduled_count,
                 "pending": pending_count,
+                "queued": queued_count,
                 "processing": processing_count,
                 "completed": completed_count,
                 "failed": failed_count,
+                "cancelled": cancelled_count,
                 "total": len(self.tasks)
             }
         }
     
+    async def get_saturation(self) -> dict:
+        """
+        获取队列积压和工作线程占用情况，供就绪检查和自动扩缩容使用
+        
+        Returns:
+            队列长度、忙碌工作线程数、最久排队任务的等待秒数和近期失败率
+        """
+        await self._ensure_initialized()
+        
+        now = datetime.now()
+        queued = [task for task in self.tasks.values() if task.status in (TaskStatus.PENDING, TaskStatus.QUEUED)]
+        # 延迟任务从计划时间开始计算排队时长
+        oldest_age = max(
+            ((now - max(task.created_at, task.run_at or task.created_at)).total_seconds() for task in queued),
+            default=0.0
+        )
+        
+        window_start = now.timestamp() - settings.HEALTH_FAILURE_WINDOW
+        finished = [
+            task for task in self.tasks.values()
+            if task.status in (TaskStatus.COMPLETED, TaskStatus.FAILED)
+            and task.completed_at and task.completed_at.timestamp() >= window_start
+        ]
+        failed = sum(1 for task in finished if task.status == TaskStatus.FAILED)
+        busy_workers = len(self._processing_tasks)
+        
+        return {
+            "queue_length": len(queued),
+            "busy_workers": busy_workers,
+            "total_workers": self._max_concurrent_tasks,
+            "worker_utilization": round(busy_workers / self._max_concurrent_tasks, 3) if self._max_concurrent_tasks else 0.0,
+            "oldest_queued_seconds": round(max(oldest_age, 0.0), 1),
+            "recent_finished": len(finished),
+            "recent_failed": failed,
+            "recent_failure_rate": round(failed / len(finished), 3) if finished else 0.0,
+            "failure_window_seconds": settings.HEALTH_FAILURE_WINDOW
+        }
+    
     async def get_active_tasks(self) -> List[SplitTask]:
         """
         获取活跃任务列表
@@ -223,151 +814,738 @@ class TaskService:
         
         active_tasks = [
             task for task in self.tasks.values() 
-            if task.status in [TaskStatus.PENDING, TaskStatus.PROCESSING]
+            if task.status in [TaskStatus.PENDING, TaskStatus.QUEUED, TaskStatus.PROCESSING]
         ]
         
-        # 按创建时间排序
-        active_tasks.sort(key=lambda x: x.created_at)
+        # 按优先级和创建时间排序
+        active_tasks.sort(key=lambda x: (PRIORITY_RANK.get(x.priority, 1), x.created_at))
         
         return active_tasks
     
-    async def cleanup_completed_tasks(self, max_age_hours: int = 24) -> int:
+    async def cleanup_completed_tasks(self, max_age_hours: Optional[int] = None) -> int:
         """
-        清理已完成的任务
+        清理已结束的任务，失败的拆分任务同时删除未生成校验清单的残留输出
         
         Args:
-            max_age_hours: 最大保留时间（小时）
+            max_age_hours: 统一的最大保留时间（小时），为空时按各租户的分级保留策略
             
         Returns:
             清理的任务数量
         """
         try:
             cleaned_count = 0
-            cutoff_time = datetime.now().timestamp() - (max_age_hours * 3600)
+            now = datetime.now()
             
+            # 以存储为准，多副本部署时包含其他副本创建的任务
             tasks_to_remove = []
             
-            for task_id, task in self.tasks.items():
-                if task.status in [TaskStatus.COMPLETED, TaskStatus.FAILED]:
-                    if task.completed_at and task.completed_at.timestamp() < cutoff_time:
-                        tasks_to_remove.append(task_id)
-            
-            for task_id in tasks_to_remove:
-                del self.tasks[task_id]
-                # 删除任务文件
-                task_file = self.upload_dir / "tasks" / f"{task_id}.json"
-                if task_file.exists():
-                    task_file.unlink()
+            for data in await get_store().avalues(TASKS_BUCKET):
+                try:
+                    task = SplitTask(**data)
+                except Exception as e:
+                    logger.error(f"读取任务失败: {data.get('task_id')} - {str(e)}")
+                    continue
+                if max_age_hours is not None:
+                    finished = task.status in FINISHED_STATUSES and task.completed_at
+                    expires_at = task.completed_at + timedelta(hours=max_age_hours) if finished else None
+                else:
+                    expires_at = task_expires_at(task)
+                if expires_at and expires_at <= now:
+                    tasks_to_remove.append(task)
+            
+            for task in tasks_to_remove:
+                self.tasks.pop(task.task_id, None)
+                self.task_events.pop(task.task_id, None)
+                # 删除任务记录
+                store = get_store()
+                await store.adelete(TASKS_BUCKET, task.task_id)
+                await store.adelete(TASK_EVENTS_BUCKET, task.task_id)
+                await task_report_service.delete(task.task_id)
+                if task.status == TaskStatus.FAILED and task.task_type == TaskType.SPLIT:
+                    self._remove_leftovers(task)
                 cleaned_count += 1
             
-            logger.info(f"清理了 {cleaned_count} 个已完成任务")
+            logger.info(f"清理了 {cleaned_count} 个已结束任务")
             return cleaned_count
             
         except Exception as e:
             logger.error(f"清理任务失败: {str(e)}")
             return 0
     
+    async def purge_file_tasks(self, file_ids: List[str]) -> int:
+        """
+        删除指定文件的全部任务记录、事件和报告，用于隐私模式文件删除后不留下章节标题等内容
+        
+        Args:
+            file_ids: 文件ID列表
+            
+        Returns:
+            删除的任务数量
+        """
+        if not file_ids:
+            return 0
+        
+        file_ids = set(file_ids)
+        store = get_store()
+        removed = 0
+        for data in await store.avalues(TASKS_BUCKET):
+            if data.get("file_id") not in file_ids:
+                continue
+            task_id = data.get("task_id")
+            self.tasks.pop(task_id, None)
+            self.task_events.pop(task_id, None)
+            await store.adelete(TASKS_BUCKET, task_id)
+            await store.adelete(TASK_EVENTS_BUCKET, task_id)
+            await task_report_service.delete(task_id)
+            removed += 1
+        
+        if removed:
+            logger.info(f"删除隐私模式文件的任务记录: {removed} 个")
+        return removed
+    
+    @staticmethod
+    def _remove_leftovers(task: SplitTask) -> None:
+        """删除失败任务写了一半的章节文件，已有校验清单（其他任务的完整输出）时保留"""
+        output_dir = file_storage_dir(task.file_id, task.tenant_id) / "chapters"
+        if output_dir.exists() and not (output_dir / MANIFEST_FILENAME).exists():
+            shutil.rmtree(output_dir, ignore_errors=True)
+            logger.info(f"清理失败任务的残留输出: {task.task_id}")
+    
     async def _process_split_task(self, task: SplitTask) -> None:
         """处理拆分任务"""
         try:
             logger.info(f"开始处理拆分任务: {task.task_id}")
             
-            # 更新任务状态
-            task.status = TaskStatus.PROCESSING
-            task.progress = 0
-            await self._save_task(task)
+            # 更新任务状态，已被其他实例领取或取消时跳过
+            if not await self._transition(
+                task,
+                TaskStatus.PROCESSING,
+                "started",
+                "开始处理拆分任务",
+                changes={"progress": 0, "worker_node": leader_election.node_id}
+            ):
+                logger.info(f"任务已被其他实例处理或已取消，跳过: {task.task_id}")
+                return
+            
+            # 排队期间文件已被隔离
+            await self._check_quarantine(task.file_id)
             
             # 获取文件路径
-            file_path = self.upload_dir / task.file_id / "original.pdf"
+            file_dir = file_storage_dir(task.file_id, task.tenant_id)
+            file_path = source_pdf_path(file_dir)
             
             if not file_path.exists():
-                raise Exception(f"文件不存在: {file_path}")
+                raise NotFoundError(f"文件不存在: {file_path}")
+            
+            # 拆分会使原文件的数字签名失效
+            original_path = file_dir / "original.pdf"
+            signed = count_signatures(original_path) > 0
+            if signed and task.signatures == SignatureHandling.REFUSE:
+                raise ConflictError("文件包含数字签名，按signatures=refuse拒绝拆分")
             
             # 创建输出目录
-            output_dir = self.upload_dir / task.file_id / "chapters"
+            output_dir = file_dir / "chapters"
             output_dir.mkdir(parents=True, exist_ok=True)
             
-            # 执行PDF拆分
-            download_links = await self.pdf_splitter.split_pdf(
-                str(file_path),
-                task.chapters,
-                str(output_dir),
-                progress_callback=lambda progress: self._update_task_progress(task.task_id, progress)
-            )
+            # 相同文件、章节和选项的输出仍完整时直接复用
+            download_links = None if task.bypass_cache else self._cached_outputs(task, output_dir)
+            if download_links is not None:
+                task.cache_hit = True
+                self._record_event(
+                    task.task_id,
+                    "cache_hit",
+                    f"复用相同请求的已有输出 {len(download_links)} 个文件",
+                    files=len(download_links)
+                )
+            else:
+                # 执行PDF拆分，复用分析阶段已解析的文档
+                # 写入任务临时目录，全部成功后再替换到输出目录，失败或崩溃不会留下写了一半的文件
+                file_hash = await self.analysis_service.file_service.get_file_hash(task.file_id)
+                file_info = await self.analysis_service.file_service.get_file_info(task.file_id)
+                filename_template = task.filename_template
+                if file_info:
+                    filename_template = fill_document_fields(filename_template, filename_fields(file_info))
+                checkpoint = SplitCheckpoint(task.cache_key, task.tenant_id) if settings.SPLIT_CHECKPOINTS and task.cache_key else None
+                if checkpoint and checkpoint.completed:
+                    self._record_event(
+                        task.task_id,
+                        "resumed",
+                        f"从检查点继续，{checkpoint.completed} 个章节已完成",
+                        chapters=checkpoint.completed
+                    )
+                with collect_warnings() as split_warnings, scratch_dir(task.task_id) as staging_dir:
+                    async with memory_budget.reserve(estimate_document_bytes(str(file_path)), task.task_id):
+                        download_links = await self.pdf_splitter.split_pdf(
+                            str(file_path),
+                            task.chapters,
+                            str(staging_dir),
+                            progress_callback=lambda progress: self._update_task_progress(task.task_id, progress),
+                            chapter_callback=lambda index, chapter, filename, error: self._record_chapter_event(
+                                task.task_id, index, chapter, filename, error
+                            ),
+                            doc_key=file_hash,
+                            filename_template=filename_template,
+                            optimize=task.optimize,
+                            strip_metadata=task.strip_metadata,
+                            watermark_text=task.watermark_text,
+                            max_output_bytes=task.max_output_bytes,
+                            attachments=task.attachments,
+                            redactions=task.redactions,
+                            bates=task.bates,
+                            page_numbers=task.page_numbers,
+                            pdfa=task.pdfa,
+                            grayscale=task.grayscale,
+                            strip_backgrounds=task.strip_backgrounds,
+                            deskew=task.deskew,
+                            ocr_text_layer=task.ocr_text_layer,
+                            strip_signatures=signed,
+                            best_effort=task.best_effort,
+                            unreadable_pages=task.unreadable_pages,
+                            bookmarked_copy=task.bookmarked_copy,
+                            exclude_pages=task.exclude_pages,
+                            group_dividers=task.group_dividers,
+                            bundle=task.bundle,
+                            signed_original=str(original_path) if signed and task.signatures == SignatureHandling.INCLUDE_ORIGINAL else None,
+                            sign=task.sign,
+                            source_id=task.file_id,
+                            task_id=task.task_id,
+                            cache_key=task.cache_key,
+                            checkpoint=checkpoint
+                        )
+                    if not task.bundle:
+                        (output_dir / BUNDLE_FILENAME).unlink(missing_ok=True)
+                    commit_outputs(staging_dir, output_dir, last=[MANIFEST_FILENAME])
+                    if checkpoint:
+                        checkpoint.clear()
+                task.warnings = split_warnings
+            
+            # 水平扩展模式下上传到共享存储，任何副本都可提供下载；隐私模式的输出只留在本地临时目录
+            if output_store.enabled and not is_ephemeral_file(task.file_id):
+                published = await output_store.publish(task.tenant_id, task.file_id, output_dir, download_links)
+                self._record_event(task.task_id, "published", f"已上传 {published} 个文件到共享存储", files=published)
             
-            # 任务完成
-            task.status = TaskStatus.COMPLETED
-            task.progress = 100
-            task.completed_at = datetime.now()
-            task.download_links = download_links
+            # 推送到用户指定的存储目标（附带校验清单）
+            if task.delivery:
+                files = [output_dir / name for name in download_links]
+                if (output_dir / MANIFEST_FILENAME).exists():
+                    files.append(output_dir / MANIFEST_FILENAME)
+                self._record_event(
+                    task.task_id,
+                    "delivering",
+                    f"开始投递到 {task.delivery.type.value}://{task.delivery.target}",
+                    progress=task.progress
+                )
+                keys = None
+                manifest = self._read_manifest(output_dir)
+                file_info = await self.analysis_service.file_service.get_file_info(task.file_id)
+                if task.delivery.key_template and manifest and file_info:
+                    keys = delivery_service.object_keys(task.delivery, [f.name for f in files], manifest, file_info)
+                delivered = await delivery_service.deliver(task.delivery, files, keys)
+                self._record_event(task.task_id, "delivered", f"已投递 {delivered} 个文件", files=delivered)
             
-            await self._save_task(task)
+            # 写回用户选择的云盘文件夹
+            if task.export:
+                exported = await connector_service.export_files(
+                    task.export.provider,
+                    task.export.folder,
+                    [output_dir / name for name in download_links]
+                )
+                self._record_event(
+                    task.task_id,
+                    "exported",
+                    f"已写回 {task.export.provider.value} {exported} 个文件",
+                    files=exported
+                )
+            
+            # 任务完成，处理期间已被取消时丢弃结果
+            completed = await self._transition(
+                task,
+                TaskStatus.COMPLETED,
+                "completed",
+                f"拆分完成，生成 {len(download_links)} 个文件",
+                changes={
+                    "progress": 100,
+                    "completed_at": datetime.now(),
+                    "download_links": download_links,
+                    "damaged_pages": self._damaged_pages(output_dir)
+                },
+                files=len(download_links)
+            )
+            if not completed:
+                logger.info(f"拆分任务已取消，不记录结果: {task.task_id}")
+                return
+            await self._record_engine_outcome(task)
+            await self._save_task_report(task, output_dir)
+            await notification_service.notify(
+                EVENT_TASK_COMPLETED,
+                {"task_id": task.task_id, "file_id": task.file_id, "files": len(download_links)},
+                task.notifications
+            )
             
             logger.info(f"拆分任务完成: {task.task_id}")
             
         except Exception as e:
             logger.error(f"拆分任务失败: {task.task_id} - {str(e)}")
             
-            # 更新任务状态为失败
-            task.status = TaskStatus.FAILED
-            task.error_message = str(e)
-            task.completed_at = datetime.now()
+            # 更新任务状态为失败，已被取消时保持取消状态
+            failed = await self._transition(
+                task,
+                TaskStatus.FAILED,
+                "failed",
+                str(e),
+                changes={
+                    "error_message": str(e),
+                    "error_code": code_for_exception(e),
+                    "error_details": details_for_exception(e),
+                    "completed_at": datetime.now()
+                }
+            )
+            if not failed:
+                return
+            await self._record_engine_outcome(task, e)
+            await notification_service.notify(
+                EVENT_TASK_FAILED,
+                {"task_id": task.task_id, "file_id": task.file_id, "error": str(e)},
+                task.notifications
+            )
+    
+    async def _check_quarantine(self, file_id: str) -> None:
+        """文件已被隔离时拒绝拆分，不再让同一文件反复使引擎崩溃"""
+        if await self.analysis_service.file_service.check_quarantine(file_id):
+            raise ConflictError("文件多次导致处理引擎崩溃，已被隔离，需管理员解除隔离后才能拆分")
+    
+    async def _record_engine_outcome(self, task: SplitTask, error: Optional[Exception] = None) -> None:
+        """
+        按拆分结果更新文件的连续引擎崩溃次数，文件因此被隔离时记录事件并通知管理员
+        
+        Args:
+            task: 已结束的拆分任务
+            error: 任务失败的原因，成功时为空（此时按章节失败的警告判断）
+        """
+        file_service = self.analysis_service.file_service
+        try:
+            if error is not None:
+                if not is_engine_crash(error):
+                    return
+                reason = str(error)
+            else:
+                crashes = [
+                    warning for warning in task.warnings
+                    if warning.code == WarningCode.CHAPTER_FAILED and warning.details.get("engine_crash")
+                ]
+                if not crashes:
+                    await file_service.clear_engine_failures(task.file_id)
+                    return
+                reason = crashes[-1].details.get("error", crashes[-1].message)
+            
+            if not await file_service.record_engine_failure(task.file_id, reason):
+                return
+            file_info = await file_service.get_file_info(task.file_id)
+            failures = file_info.engine_failures if file_info else settings.QUARANTINE_AFTER_FAILURES
+            self._record_event(
+                task.task_id,
+                "quarantined",
+                f"文件连续 {failures} 次导致处理引擎崩溃，已隔离",
+                file_id=task.file_id,
+                failures=failures
+            )
+            # 只发送到全局渠道（管理员），不发给请求级通知
+            await notification_service.notify(
+                EVENT_FILE_QUARANTINED,
+                {"file_id": task.file_id, "task_id": task.task_id, "failures": failures, "reason": reason}
+            )
+        except Exception as e:
+            logger.error(f"记录引擎崩溃失败: {task.file_id} - {str(e)}")
+    
+    @staticmethod
+    def _output_cache_key(task: SplitTask, file_hash: str) -> str:
+        """由文件内容哈希和影响输出的选项计算缓存键"""
+        options = task.model_dump(mode="json", include=OUTPUT_CACHE_FIELDS)
+        payload = json.dumps({"file": file_hash, "options": options}, sort_keys=True, ensure_ascii=False)
+        return hashlib.sha256(payload.encode("utf-8")).hexdigest()
+    
+    @staticmethod
+    def _cached_outputs(task: SplitTask, output_dir: Path) -> Optional[List[str]]:
+        """
+        查找可复用的已有输出
+        
+        Args:
+            task: 拆分任务
+            output_dir: 章节输出目录
             
-            await self._save_task(task)
+        Returns:
+            清单的缓存键与任务一致且文件齐全（大小一致）时返回文件名列表，否则为None
+        """
+        if not task.cache_key:
+            return None
+        try:
+            manifest = OutputManifest.model_validate_json(
+                (output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8")
+            )
+        except Exception:
+            return None
+        if manifest.cache_key != task.cache_key:
+            return None
+        if task.bundle and not (output_dir / BUNDLE_FILENAME).is_file():
+            return None
+        
+        for entry in manifest.files:
+            path = output_dir / entry.filename
+            if not path.is_file() or path.stat().st_size != entry.size:
+                return None
+        return [entry.filename for entry in manifest.files]
+    
+    @staticmethod
+    def _read_manifest(output_dir: Path) -> Optional[OutputManifest]:
+        """读取输出清单，不存在或无法解析时为None"""
+        try:
+            return OutputManifest.model_validate_json(
+                (output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8")
+            )
+        except Exception:
+            return None
+    
+    def _damaged_pages(self, output_dir: Path) -> List[int]:
+        """从输出清单汇总尽力拆分时无法读取的页码（缓存命中时同样可用）"""
+        manifest = self._read_manifest(output_dir)
+        if not manifest:
+            return []
+        return sorted({page for entry in manifest.files for page in entry.damaged_pages})
+    
+    async def _save_task_report(self, task: SplitTask, output_dir: Path) -> None:
+        """保存任务报告快照；同一文件之后重新拆分会覆盖输出清单，报告需在完成时固定下来"""
+        try:
+            await self._ensure_task_events(task.task_id)
+            report = task_report_service.build(
+                task,
+                sorted(self.task_events[task.task_id], key=lambda e: e.timestamp),
+                self._read_manifest(output_dir),
+                task.model_dump(mode="json", include=OUTPUT_CACHE_FIELDS),
+                await self.analysis_service.file_service.get_file_info(task.file_id)
+            )
+            await task_report_service.save(report)
+        except Exception as e:
+            logger.error(f"生成任务报告失败: {task.task_id} - {str(e)}")
     
     def _update_task_progress(self, task_id: str, progress: int) -> None:
-        """更新任务进度"""
+        """更新处理中任务的进度，任务已结束（如处理期间被取消）时忽略"""
         task = self.tasks.get(task_id)
-        if task:
+        if task and task.status == TaskStatus.PROCESSING:
             task.progress = progress
-            # 异步保存任务状态
-            asyncio.create_task(self._save_task(task))
+            # 异步保存，只修改进度字段，不覆盖其他实例写入的状态
+            asyncio.create_task(self._save_progress(task_id, progress))
     
-    async def _save_task(self, task: SplitTask) -> None:
-        """保存任务到文件"""
+    async def _save_progress(self, task_id: str, progress: int) -> None:
+        """保存任务进度，存储中的任务已不在处理中时放弃；已在其他副本上被取消时停止本副本的处理"""
+        stored_status = []
+        
+        def mutate(current):
+            stored_status.append(current.get("status") if current else None)
+            if current is None or current.get("status") != TaskStatus.PROCESSING.value:
+                return None
+            return {**current, "progress": progress}
+        
         try:
-            tasks_dir = self.upload_dir / "tasks"
-            tasks_dir.mkdir(parents=True, exist_ok=True)
+            await get_store().aupdate(TASKS_BUCKET, task_id, mutate)
+        except Exception as e:
+            logger.error(f"保存任务进度失败: {task_id} - {str(e)}")
+            return
+        
+        task = self.tasks.get(task_id)
+        processing_task = self._processing_tasks.get(task_id)
+        if stored_status and stored_status[-1] == TaskStatus.CANCELLED.value and task and processing_task:
+            task.status = TaskStatus.CANCELLED
+            processing_task.cancel()
+            logger.info(f"任务已在其他副本上取消，停止处理: {task_id}")
+    
+    async def _process_analysis_task(self, task: SplitTask) -> None:
+        """处理异步分析任务"""
+        try:
+            logger.info(f"开始处理分析任务: {task.task_id}")
+            
+            if not await self._transition(
+                task,
+                TaskStatus.PROCESSING,
+                "started",
+                "开始分析章节结构",
+                changes={"progress": 0, "worker_node": leader_election.node_id}
+            ):
+                logger.info(f"任务已被其他实例处理或已取消，跳过: {task.task_id}")
+                return
             
-            task_file = tasks_dir / f"{task.task_id}.json"
+            file_path = source_pdf_path(file_storage_dir(task.file_id, task.tenant_id))
+            if not file_path.exists():
+                raise NotFoundError(f"文件不存在: {file_path}")
             
-            # 转换为字典并处理datetime序列化
-            data = task.model_dump()
-            data['created_at'] = task.created_at.isoformat()
-            if task.completed_at:
-                data['completed_at'] = task.completed_at.isoformat()
+            result = await self.analysis_service.analyze(
+                task.analysis_request,
+                str(file_path),
+                progress_callback=lambda progress: self._update_task_progress(task.task_id, progress)
+            )
+            
+            completed = await self._transition(
+                task,
+                TaskStatus.COMPLETED,
+                "completed",
+                f"分析完成，识别 {len(result.chapters)} 个章节",
+                changes={
+                    "progress": 100,
+                    "completed_at": datetime.now(),
+                    "analysis_result": result,
+                    "warnings": result.warnings
+                },
+                chapters=len(result.chapters)
+            )
+            if not completed:
+                logger.info(f"分析任务已取消，不记录结果: {task.task_id}")
+                return
+            await notification_service.notify(
+                EVENT_TASK_COMPLETED,
+                {"task_id": task.task_id, "file_id": task.file_id, "task_type": task.task_type.value},
+                task.notifications
+            )
             
-            with open(task_file, "w", encoding="utf-8") as f:
-                json.dump(data, f, ensure_ascii=False, indent=2)
+            logger.info(f"分析任务完成: {task.task_id}")
+            
+        except Exception as e:
+            logger.error(f"分析任务失败: {task.task_id} - {str(e)}")
+            
+            failed = await self._transition(
+                task,
+                TaskStatus.FAILED,
+                "failed",
+                str(e),
+                changes={
+                    "error_message": str(e),
+                    "error_code": code_for_exception(e),
+                    "error_details": details_for_exception(e),
+                    "completed_at": datetime.now()
+                }
+            )
+            if not failed:
+                return
+            await notification_service.notify(
+                EVENT_TASK_FAILED,
+                {"task_id": task.task_id, "file_id": task.file_id, "task_type": task.task_type.value, "error": str(e)},
+                task.notifications
+            )
+    
+    def _record_chapter_event(
+        self,
+        task_id: str,
+        index: int,
+        chapter: ChapterInfo,
+        filename: Optional[str],
+        error: Optional[str]
+    ) -> None:
+        """记录单个章节的处理结果"""
+        task = self.tasks.get(task_id)
+        progress = task.progress if task else None
+        
+        if error:
+            self._record_event(
+                task_id,
+                "chapter_failed",
+                f"第 {index} 章拆分失败: {chapter.title}",
+                progress=progress,
+                chapter_index=index,
+                error=error
+            )
+        else:
+            self._record_event(
+                task_id,
+                "chapter_done",
+                f"第 {index} 章完成: {chapter.title}",
+                progress=progress,
+                chapter_index=index,
+                filename=filename
+            )
+    
+    def _record_event(self, task_id: str, event: str, message: str = "", progress: Optional[int] = None, **details) -> None:
+        """
+        追加任务事件并异步持久化，调用方需先通过_ensure_task_events加载已有事件
+        
+        Args:
+            task_id: 任务ID
+            event: 事件类型
+            message: 事件描述
+            progress: 当前进度
+            **details: 事件详情
+        """
+        self.task_events.setdefault(task_id, []).append(
+            TaskEvent(event=event, message=message, progress=progress, details=details)
+        )
+        asyncio.create_task(self._save_task_events(task_id))
+    
+    async def _save_task_events(self, task_id: str) -> None:
+        """保存任务事件"""
+        try:
+            data = [event.model_dump(mode="json") for event in self.task_events.get(task_id, [])]
+            await get_store().aput(TASK_EVENTS_BUCKET, task_id, data)
+                
+        except Exception as e:
+            logger.error(f"保存任务事件失败: {str(e)}")
+    
+    async def _ensure_task_events(self, task_id: str) -> None:
+        """把任务已有的事件加载到内存，之后追加的事件保存时不会覆盖它们"""
+        if task_id not in self.task_events:
+            events = await self._load_task_events(task_id)
+            self.task_events.setdefault(task_id, events)
+    
+    async def _load_task_events(self, task_id: str) -> List[TaskEvent]:
+        """加载任务事件"""
+        try:
+            return [TaskEvent(**item) for item in await get_store().aget(TASK_EVENTS_BUCKET, task_id) or []]
+        except Exception as e:
+            logger.error(f"加载任务事件失败: {task_id} - {str(e)}")
+            return []
+    
+    async def _save_task(self, task: SplitTask) -> None:
+        """保存任务"""
+        try:
+            # 转换为字典并处理datetime序列化
+            data = task.model_dump(mode="json")
+            await get_store().aput(TASKS_BUCKET, task.task_id, data)
                 
         except Exception as e:
             logger.error(f"保存任务失败: {str(e)}")
     
+    async def _transition(
+        self,
+        task: SplitTask,
+        to_status: TaskStatus,
+        event: str,
+        message: str = "",
+        changes: Optional[dict] = None,
+        **details
+    ) -> bool:
+        """
+        按状态机在存储中原子地切换任务状态并记录事件，多副本部署时避免同一任务被重复领取或覆盖
+        
+        Args:
+            task: 任务
+            to_status: 目标状态
+            event: 切换成功时记录的事件类型
+            message: 事件描述
+            changes: 同时修改的其他字段
+            **details: 事件详情
+            
+        Returns:
+            是否切换成功，当前状态（本地或存储中）不允许切换到目标状态时返回False
+        """
+        if not can_transition(task.status, to_status):
+            logger.info(f"忽略不允许的任务状态切换: {task.task_id} {task.status.value} -> {to_status.value}")
+            return False
+        
+        changes = changes or {}
+        updated = task.model_copy(update={"status": to_status, **changes})
+        
+        def mutate(current):
+            if current is not None and not can_transition(TaskStatus(current.get("status")), to_status):
+                return None
+            return updated.model_dump(mode="json")
+        
+        try:
+            if await get_store().aupdate(TASKS_BUCKET, task.task_id, mutate) is None:
+                return False
+        except Exception as e:
+            logger.error(f"切换任务状态失败: {task.task_id} - {str(e)}")
+            return False
+        
+        task.status = to_status
+        for field, value in changes.items():
+            setattr(task, field, value)
+        await self._ensure_task_events(task.task_id)
+        self._record_event(task.task_id, event, message, progress=task.progress, **details)
+        return True
+    
     async def _load_existing_tasks(self) -> None:
         """加载现有任务"""
         try:
-            tasks_dir = self.upload_dir / "tasks"
-            
-            if not tasks_dir.exists():
-                return
-            
-            for task_file in tasks_dir.glob("*.json"):
+            for data in await get_store().avalues(TASKS_BUCKET):
                 try:
-                    with open(task_file, "r", encoding="utf-8") as f:
-                        data = json.load(f)
-                    
                     # 处理datetime反序列化
                     data['created_at'] = datetime.fromisoformat(data['created_at'])
                     if data.get('completed_at'):
                         data['completed_at'] = datetime.fromisoformat(data['completed_at'])
+                    if data.get('run_at'):
+                        data['run_at'] = datetime.fromisoformat(data['run_at'])
                     
                     task = SplitTask(**data)
                     self.tasks[task.task_id] = task
                     
                 except Exception as e:
-                    logger.error(f"加载任务文件失败: {task_file} - {str(e)}")
+                    logger.error(f"加载任务记录失败: {data.get('task_id')} - {str(e)}")
             
             logger.info(f"加载了 {len(self.tasks)} 个现有任务")
             
         except Exception as e:
-            logger.error(f"加载现有任务失败: {str(e)}")
\ No newline at end of file
+            logger.error(f"加载现有任务失败: {str(e)}")
+        
+        await self._recover_tasks(list(self.tasks.values()), requeue=True)
+    
+    async def _recover_interrupted_tasks(self) -> None:
+        """从存储中查找所在副本已停止的任务：处理中的标记为失败，排队中的重新入队，由主节点定期执行"""
+        tasks = []
+        statuses = [TaskStatus.PENDING.value, TaskStatus.QUEUED.value, TaskStatus.PROCESSING.value]
+        for data in await get_store().avalues(TASKS_BUCKET, statuses=statuses):
+            task = self.tasks.get(data.get("task_id"))
+            if task is None or task.status.value != data.get("status"):
+                try:
+                    task = SplitTask(**data)
+                except Exception as e:
+                    logger.error(f"加载未完成任务失败: {data.get('task_id')} - {str(e)}")
+                    continue
+                self.tasks[task.task_id] = task
+            tasks.append(task)
+        await self._recover_tasks(tasks)
+    
+    async def _recover_tasks(self, tasks: List[SplitTask], requeue: bool = False) -> None:
+        """
+        恢复进程崩溃或重启时中断的任务
+        
+        处理中但不在本副本运行、且所在副本已停止（心跳过期）的任务标记为失败，可重试并从拆分检查点继续；
+        待入队和已入队的任务只保存在所在副本的内存队列中，所在副本已停止时重新加入本副本的队列，
+        启动时还包括本副本重启前和未记录副本的任务，由最先领取的副本处理
+        
+        Args:
+            tasks: 待检查的任务
+            requeue: 是否为启动时恢复
+        """
+        recovered = 0
+        for task in tasks:
+            if task.status in (TaskStatus.PENDING, TaskStatus.QUEUED):
+                if task.worker_node and task.worker_node != leader_election.node_id:
+                    orphaned = not await leader_election.is_node_alive(task.worker_node)
+                else:
+                    orphaned = requeue
+                if orphaned and await self._enqueue(task, "任务已重新加入处理队列"):
+                    recovered += 1
+                continue
+            if task.status != TaskStatus.PROCESSING or task.task_id in self._processing_tasks:
+                continue
+            if task.worker_node and task.worker_node != leader_election.node_id and await leader_election.is_node_alive(task.worker_node):
+                continue
+            
+            message = "任务处理中断（所在副本已停止或重启），可重试并从检查点继续"
+            failed = await self._transition(
+                task,
+                TaskStatus.FAILED,
+                "failed",
+                message,
+                changes={
+                    "error_message": message,
+                    "error_code": ErrorCode.INTERNAL,
+                    "completed_at": datetime.now()
+                }
+            )
+            if failed:
+                recovered += 1
+                await notification_service.notify(
+                    EVENT_TASK_FAILED,
+                    {"task_id": task.task_id, "file_id": task.file_id, "error": message},
+                    task.notifications
+                )
+        
+        if recovered:
+            logger.info(f"恢复了 {recovered} 个中断的任务")
\ No newline at end of file
@@ -0,0 +1,39 @@
+"""
+任务状态机
+任务只能沿以下路径切换状态，结束状态不能再改变：
+
+    scheduled（等待计划时间）→ pending（待入队）→ queued（已加入处理队列）→ processing → completed / failed
+    scheduled / pending / queued / processing → cancelled
+
+新任务从scheduled或pending开始；命中输出缓存的任务不排队，从pending直接开始处理；
+处理中的任务被取消后，工作线程的结果被丢弃
+"""
+
+from typing import Dict, FrozenSet
+
+from ..models.schemas import TaskStatus
+
+
+# 每个状态允许切换到的状态
+TASK_TRANSITIONS: Dict[TaskStatus, FrozenSet[TaskStatus]] = {
+    TaskStatus.SCHEDULED: frozenset({TaskStatus.PENDING, TaskStatus.CANCELLED}),
+    TaskStatus.PENDING: frozenset({TaskStatus.QUEUED, TaskStatus.PROCESSING, TaskStatus.CANCELLED}),
+    TaskStatus.QUEUED: frozenset({TaskStatus.PROCESSING, TaskStatus.CANCELLED}),
+    TaskStatus.PROCESSING: frozenset({TaskStatus.COMPLETED, TaskStatus.FAILED, TaskStatus.CANCELLED}),
+    TaskStatus.COMPLETED: frozenset(),
+    TaskStatus.FAILED: frozenset(),
+    TaskStatus.CANCELLED: frozenset(),
+}
+
+# 结束状态，之后不再有进度更新
+FINISHED_STATUSES = frozenset(status for status, targets in TASK_TRANSITIONS.items() if not targets)
+
+
+def can_transition(from_status: TaskStatus, to_status: TaskStatus) -> bool:
+    """是否允许从from_status切换到to_status"""
+    return to_status in TASK_TRANSITIONS.get(from_status, frozenset())
+
+
+def is_finished(status: TaskStatus) -> bool:
+    """是否为结束状态"""
+    return status in FINISHED_STATUSES
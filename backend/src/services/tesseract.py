@@ -0,0 +1,78 @@
+"""
+Tesseract调用
+把渲染后的页面图片通过标准输入交给Tesseract，供扫描页方向检测、纠偏和文字层生成使用
+"""
+
+import asyncio
+import shutil
+from typing import List
+
+from loguru import logger
+
+from ..core.config import settings
+from ..core.errors import ResourceLimitError
+from ..core.limits import engine_limits
+from ..core.sandbox import engine_sandbox, sandbox_available
+from ..models.schemas import ErrorCode
+from .engine_errors import engine_error
+
+
+# 检测和识别时渲染页面的分辨率
+OCR_DPI = 150
+
+
+def tesseract_available() -> bool:
+    """是否安装了Tesseract（且配置的沙箱可用）"""
+    return shutil.which(settings.TESSERACT_PATH) is not None and sandbox_available()
+
+
+async def run_tesseract(image: bytes, options: List[str]) -> bytes:
+    """
+    识别一张图片
+
+    Args:
+        image: 图片内容（PNG）
+        options: Tesseract选项和输出格式
+
+    Returns:
+        标准输出，页面无法识别时为空
+
+    Raises:
+        RuntimeError: 超时
+        EngineError: 缺少语言数据、图片无法读取等可归类的失败
+        ResourceLimitError: 超出子进程的CPU或内存限制
+    """
+    with engine_sandbox() as sandbox, engine_limits() as limits:
+        process = await asyncio.create_subprocess_exec(
+            *limits.command(sandbox.command([settings.TESSERACT_PATH, "stdin", "stdout", *options])),
+            stdin=asyncio.subprocess.PIPE,
+            stdout=asyncio.subprocess.PIPE,
+            stderr=asyncio.subprocess.PIPE,
+            env=sandbox.env,
+            pass_fds=(*sandbox.pass_fds, *limits.pass_fds)
+        )
+        limits.attach(process.pid)
+        try:
+            stdout, stderr = await asyncio.wait_for(process.communicate(image), timeout=settings.TESSERACT_TIMEOUT)
+        except asyncio.TimeoutError:
+            process.kill()
+            await process.wait()
+            raise RuntimeError(f"Tesseract处理超时（{settings.TESSERACT_TIMEOUT}秒）")
+        except asyncio.CancelledError:
+            # 请求或任务被取消时不留下继续运行的子进程
+            process.kill()
+            await process.wait()
+            raise
+        exceeded = limits.exceeded(process.returncode) if process.returncode != 0 else None
+
+    if exceeded:
+        raise ResourceLimitError(f"Tesseract{exceeded}")
+    # 页面文字过少时OSD等以非零状态退出，视为无法识别；缺少语言数据、图片无法读取等归类后报错
+    if process.returncode != 0:
+        output = stderr.decode("utf-8", errors="replace")
+        error = engine_error("Tesseract", process.returncode, output)
+        if error.code != ErrorCode.INTERNAL:
+            raise error
+        logger.debug(f"Tesseract未能识别页面: {output.strip()}")
+        return b""
+    return stdout
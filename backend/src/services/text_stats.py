@@ -0,0 +1,52 @@
+"""
+章节文字统计
+字数：中文和日文每个字计为一个词，其他文字（包括以空格分词的韩文）按单词计
+字符数：不含空白的字符数
+阅读时间：按语言的平均阅读速度估算
+"""
+
+import math
+import re
+from typing import Optional
+
+
+# 汉字和假名（不以空格分词）
+CJK_PATTERN = re.compile(r"[\u3040-\u30ff\u3400-\u4dbf\u4e00-\u9fff]")
+
+WORD_PATTERN = re.compile(r"[^\W_]+(?:['’-][^\W_]+)*")
+
+WHITESPACE_PATTERN = re.compile(r"\s")
+
+# 平均阅读速度（每分钟词数，中文和日文按字计）
+READING_SPEEDS = {
+    "zh": 300,
+    "ja": 400,
+}
+DEFAULT_READING_SPEED = 230
+
+
+def count_words(text: str) -> int:
+    """统计字数"""
+    cjk = len(CJK_PATTERN.findall(text))
+    return cjk + len(WORD_PATTERN.findall(CJK_PATTERN.sub(" ", text)))
+
+
+def count_characters(text: str) -> int:
+    """统计不含空白的字符数"""
+    return len(WHITESPACE_PATTERN.sub("", text))
+
+
+def reading_minutes(words: int, language: Optional[str] = None) -> int:
+    """
+    估算阅读时间
+
+    Args:
+        words: 字数
+        language: 语言（ISO 639-1代码），未知时按默认速度
+
+    Returns:
+        分钟数，有文字时至少为1
+    """
+    if not words:
+        return 0
+    return max(1, math.ceil(words / READING_SPEEDS.get(language or "", DEFAULT_READING_SPEED)))
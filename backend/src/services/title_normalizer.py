@@ -0,0 +1,126 @@
+"""
+章节标题规范化服务
+先用规则清洗目录引导符、页码和常见OCR错误，再可选调用大模型统一风格
+"""
+
+import re
+import unicodedata
+from typing import List, Optional
+
+from loguru import logger
+
+from ..models.schemas import ChapterInfo
+from .llm_service import llm_service
+
+
+# 目录引导符及其后的页码，如 "绪论 ........ 15"、"Introduction … 3"
+DOT_LEADER_PATTERN = re.compile(r"\s*(?:(?:[.·•_\-]\s*){3,}|(?:…\s*)+)\s*\S{0,8}\s*$")
+# 标题末尾孤立的页码（阿拉伯或罗马数字），如 "Preface  xii"
+TRAILING_PAGE_PATTERN = re.compile(r"\s{2,}(?:\d{1,4}|[ivxlcdm]{1,7})\s*$", re.IGNORECASE)
+# 章节号中被OCR误识别为字母的数字，如 "Chapter l" / "Chapter 1O"
+OCR_CHAPTER_NUMBER_PATTERN = re.compile(r"\b(chapter|part|section)\s+([0-9lIoO]{1,3})\b", re.IGNORECASE)
+# 零宽字符和软连字符
+INVISIBLE_CHARS = dict.fromkeys(map(ord, "​‌‍﻿­"), None)
+# 罗马数字
+ROMAN_NUMERAL_PATTERN = re.compile(r"m{0,3}(cm|cd|d?c{0,3})(xc|xl|l?x{0,3})(ix|iv|v?i{0,3})")
+# 其后的单词按罗马数字编号处理，避免把 "mix"、"mi" 等普通单词改成大写
+ROMAN_NUMERAL_CONTEXT = {"chapter", "part", "book"}
+# 英文小词在标题大小写中保持小写
+SMALL_WORDS = {"a", "an", "and", "as", "at", "but", "by", "for", "in", "of", "on", "or", "the", "to", "vs", "via"}
+
+
+class TitleNormalizer:
+    """章节标题规范化器"""
+
+    def normalize(self, title: str) -> str:
+        """
+        按规则规范化单个标题
+
+        Args:
+            title: 原始标题
+
+        Returns:
+            规范化后的标题，清洗后为空时返回原标题
+        """
+        # 兼容字符（如连字 ﬁ）和全角字符统一为标准形式
+        text = unicodedata.normalize("NFKC", title).translate(INVISIBLE_CHARS).strip()
+
+        # 页码判断依赖原始的多空格分隔，需在合并空白前处理
+        text = DOT_LEADER_PATTERN.sub("", text)
+        text = TRAILING_PAGE_PATTERN.sub("", text)
+        text = re.sub(r"\s+", " ", text)
+        text = OCR_CHAPTER_NUMBER_PATTERN.sub(self._fix_chapter_number, text)
+        text = text.strip(" .:：-—")
+
+        if self._is_shouting(text):
+            text = self._title_case(text)
+
+        return text or title.strip()
+
+    async def normalize_chapters(self, chapters: List[ChapterInfo], use_llm: bool = False) -> List[ChapterInfo]:
+        """
+        规范化章节标题，原始标题保存在raw_title中
+
+        Args:
+            chapters: 章节列表
+            use_llm: 是否在规则清洗后调用大模型
+
+        Returns:
+            标题已规范化的章节列表
+        """
+        if not chapters:
+            return chapters
+
+        raw_titles = [chapter.raw_title or chapter.title for chapter in chapters]
+        titles = [self.normalize(title) for title in raw_titles]
+
+        if use_llm:
+            titles = await llm_service.normalize_titles(titles)
+
+        changed = sum(1 for raw, title in zip(raw_titles, titles) if raw != title)
+        logger.info(f"章节标题规范化完成: {changed}/{len(chapters)} 个标题有变化")
+
+        return [
+            chapter.model_copy(update={"title": title, "raw_title": raw})
+            for chapter, title, raw in zip(chapters, titles, raw_titles)
+        ]
+
+    @staticmethod
+    def _fix_chapter_number(match: re.Match) -> str:
+        number = match.group(2)
+        # 只修正混有数字的编号或单独的小写l，避免把罗马数字 "II" 改成 "11"
+        if any(c.isdigit() for c in number) or number == "l":
+            number = number.translate(str.maketrans("lIoO", "1100"))
+        return f"{match.group(1)} {number}"
+
+    @staticmethod
+    def _is_shouting(text: str) -> bool:
+        """是否为全大写的英文标题"""
+        letters = [c for c in text if c.isascii() and c.isalpha()]
+        return len(letters) >= 4 and all(c.isupper() for c in letters)
+
+    @staticmethod
+    def _title_case(text: str) -> str:
+        words = text.lower().split(" ")
+        result = []
+        for i, word in enumerate(words):
+            if i > 0 and word in SMALL_WORDS:
+                result.append(word)
+            elif TitleNormalizer._is_roman_numeral(word, words[i - 1] if i > 0 else None, len(words)):
+                # 罗马数字保持大写
+                result.append(word.upper())
+            else:
+                result.append(word[:1].upper() + word[1:])
+        return " ".join(result)
+
+    @staticmethod
+    def _is_roman_numeral(word: str, previous: Optional[str], word_count: int) -> bool:
+        """只有跟在Chapter/Part/Book之后或单独成为标题的单词才视为罗马数字"""
+        number = word.rstrip(".:,")
+        if not number or not ROMAN_NUMERAL_PATTERN.fullmatch(number):
+            return False
+        return previous in ROMAN_NUMERAL_CONTEXT or word_count == 1
+
+
+# 创建全局服务实例
+title_normalizer = TitleNormalizer()
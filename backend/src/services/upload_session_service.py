@@ -0,0 +1,236 @@
+"""
+分段上传会话
+创建会话 → 上传数据（可按偏移分多次追加） → 携带校验和完成，数据写入会话的临时文件，
+校验通过后原地移动为正式文件，中断或写了一半的上传不会被当作有效文件；未完成的会话过期后由主节点回收
+
+会话记录保存在共享存储中，但临时文件位于处理请求的副本的上传目录，
+多副本部署且上传目录不共享时，同一会话的请求需要由同一副本处理（会话保持）
+"""
+
+import hashlib
+from datetime import datetime, timedelta
+from pathlib import Path
+from typing import AsyncIterator, BinaryIO, Optional
+from uuid import uuid4
+
+from loguru import logger
+
+from ..core.config import settings
+from ..core.memory import buffer_pool
+from ..core.store import get_store
+from ..core.tenancy import get_current_tenant, tenant_storage_dir
+from ..models.schemas import UploadSession, UploadSessionStatus
+
+
+# 存储bucket
+SESSIONS_BUCKET = "upload_sessions"
+
+# 租户存储目录下保存未完成数据的子目录
+PARTS_DIRNAME = "upload_parts"
+
+
+class UploadSessionService:
+    """分段上传会话服务"""
+
+    @staticmethod
+    def part_path(session: UploadSession) -> Path:
+        """会话数据的临时文件"""
+        return tenant_storage_dir(session.tenant_id) / PARTS_DIRNAME / f"{session.session_id}.part"
+
+    async def create(self, filename: str, size: Optional[int] = None) -> UploadSession:
+        """
+        创建上传会话
+
+        Args:
+            filename: 文件名
+            size: 声明的文件大小
+
+        Returns:
+            上传会话
+
+        Raises:
+            ValueError: 文件类型或大小不符合要求
+        """
+        if not filename.lower().endswith(".pdf"):
+            raise ValueError("仅支持PDF文件格式")
+        if size and size > settings.MAX_FILE_SIZE:
+            raise ValueError(f"文件大小超过限制 ({settings.MAX_FILE_SIZE} 字节)")
+
+        now = datetime.now()
+        session = UploadSession(
+            session_id=str(uuid4()),
+            filename=filename,
+            size=size,
+            created_at=now,
+            expires_at=now + timedelta(seconds=settings.UPLOAD_SESSION_TTL),
+            tenant_id=get_current_tenant()
+        )
+        await self._save(session)
+        logger.info(f"创建上传会话: {session.session_id} - {filename}")
+        return session
+
+    async def get(self, session_id: str) -> Optional[UploadSession]:
+        """
+        获取当前租户未过期的上传会话
+
+        Args:
+            session_id: 会话ID
+
+        Returns:
+            上传会话，不存在、属于其他租户或已过期时返回None
+        """
+        data = await get_store().aget(SESSIONS_BUCKET, session_id)
+        if not data:
+            return None
+        session = UploadSession(**data)
+        if session.tenant_id != get_current_tenant() or session.expires_at <= datetime.now():
+            return None
+        return session
+
+    async def write(
+        self,
+        session_id: str,
+        chunks: AsyncIterator[bytes],
+        offset: int = 0
+    ) -> Optional[UploadSession]:
+        """
+        把请求体直接写入会话的临时文件，偏移为0时覆盖之前的数据，等于已接收的字节数时追加
+
+        Args:
+            session_id: 会话ID
+            chunks: 请求体数据块
+            offset: 写入位置
+
+        Returns:
+            更新后的会话，会话不存在时返回None
+
+        Raises:
+            ValueError: 会话已完成、写入位置不连续或数据超过大小上限
+        """
+        session = await self.get(session_id)
+        if not session:
+            return None
+        if session.status == UploadSessionStatus.FINALIZED:
+            raise ValueError("上传会话已完成")
+
+        part_path = self.part_path(session)
+        if offset and (
+            offset != session.received_bytes
+            or not part_path.exists()
+            or part_path.stat().st_size != offset
+        ):
+            raise ValueError(f"写入位置 {offset} 与已接收的 {session.received_bytes} 字节不连续")
+
+        limit = session.size or settings.MAX_FILE_SIZE
+        part_path.parent.mkdir(parents=True, exist_ok=True)
+
+        digest = hashlib.sha256()
+        received = offset
+        try:
+            with open(part_path, "r+b" if offset else "wb") as out:
+                try:
+                    # 追加时已有数据只读取一遍用于计算校验和，不复制
+                    if offset:
+                        self._hash_prefix(out, digest, offset)
+                    async for chunk in chunks:
+                        received += len(chunk)
+                        if received > limit:
+                            raise ValueError(f"上传数据超过限制 ({limit} 字节)")
+                        digest.update(chunk)
+                        out.write(chunk)
+                except BaseException:
+                    # 失败的追加不影响之前已接收的数据
+                    out.truncate(offset)
+                    raise
+        except BaseException:
+            if not offset:
+                part_path.unlink(missing_ok=True)
+            raise
+
+        session.status = UploadSessionStatus.UPLOADED
+        session.received_bytes = received
+        session.sha256 = digest.hexdigest()
+        await self._save(session)
+        logger.info(f"上传会话数据已接收: {session_id} - {received - offset} 字节，共 {received} 字节")
+        return session
+
+    @staticmethod
+    def _hash_prefix(out: BinaryIO, digest, length: int) -> None:
+        """计算临时文件中已有数据的校验和，并定位到末尾"""
+        out.seek(0)
+        with buffer_pool.buffer() as buf:
+            view = memoryview(buf)
+            while n := out.readinto(view):
+                digest.update(view[:n])
+        out.seek(length)
+
+    async def verify(self, session: UploadSession, sha256: str) -> Path:
+        """
+        校验客户端提供的校验和
+
+        Args:
+            session: 已上传数据的会话
+            sha256: 客户端计算的SHA-256
+
+        Returns:
+            会话数据的临时文件
+
+        Raises:
+            ValueError: 尚未上传数据、数据与声明的大小不一致或校验和不一致（数据被丢弃，需要重新上传）
+        """
+        part_path = self.part_path(session)
+        if session.status != UploadSessionStatus.UPLOADED or not part_path.exists():
+            raise ValueError("尚未上传文件数据")
+        if session.size and session.received_bytes != session.size:
+            raise ValueError(f"上传数据 {session.received_bytes} 字节与声明的大小 {session.size} 字节不一致")
+
+        if sha256.lower() != session.sha256:
+            part_path.unlink(missing_ok=True)
+            session.status = UploadSessionStatus.CREATED
+            session.received_bytes = 0
+            session.sha256 = None
+            await self._save(session)
+            raise ValueError("校验和不一致，数据已丢弃，请重新上传")
+        return part_path
+
+    async def complete(self, session: UploadSession, file_id: str) -> None:
+        """记录生成的文件，临时数据已移动为正式文件（去重时已删除），会话保留到过期以便重复完成请求返回同一文件"""
+        session.status = UploadSessionStatus.FINALIZED
+        session.file_id = file_id
+        await self._save(session)
+        self.part_path(session).unlink(missing_ok=True)
+        logger.info(f"上传会话已完成: {session.session_id} -> {file_id}")
+
+    async def cleanup_expired(self) -> int:
+        """
+        删除所有租户已过期的会话和未完成的数据
+
+        Returns:
+            删除的会话数
+        """
+        store = get_store()
+        now = datetime.now()
+        removed = 0
+        for data in await store.avalues(SESSIONS_BUCKET):
+            try:
+                session = UploadSession(**data)
+            except Exception as e:
+                logger.error(f"读取上传会话失败: {data.get('session_id')} - {str(e)}")
+                continue
+            if session.expires_at > now:
+                continue
+            self.part_path(session).unlink(missing_ok=True)
+            await store.adelete(SESSIONS_BUCKET, session.session_id)
+            removed += 1
+
+        if removed:
+            logger.info(f"回收过期上传会话: {removed} 个")
+        return removed
+
+    @staticmethod
+    async def _save(session: UploadSession) -> None:
+        await get_store().aput(SESSIONS_BUCKET, session.session_id, session.model_dump(mode="json"))
+
+
+# 创建全局上传会话服务实例
+upload_session_service = UploadSessionService()
@@ -0,0 +1,377 @@
+"""
+Webhook投递服务
+每次投递持久化保存，失败后按指数退避重试，请求带HMAC签名头，支持管理员手动重新投递
+"""
+
+import asyncio
+import hashlib
+import hmac
+import ipaddress
+import json
+import socket
+import time
+import uuid
+from datetime import datetime, timedelta
+from typing import Any, Dict, List, Optional, Set
+from urllib.parse import urlsplit, urlunsplit
+
+import httpx
+from loguru import logger
+
+from ..models.schemas import WebhookAttempt, WebhookDelivery, WebhookDeliveryStatus
+from ..core.config import settings
+from ..core.tenancy import get_current_tenant, get_tenant_settings
+from ..core.store import get_store
+from ..core.leader import leader_election
+
+
+SIGNATURE_HEADER = "X-Webhook-Signature"
+TIMESTAMP_HEADER = "X-Webhook-Timestamp"
+DELIVERY_ID_HEADER = "X-Webhook-Id"
+
+WEBHOOKS_BUCKET = "webhooks"
+
+
+def sign_payload(secret: str, timestamp: str, body: bytes) -> str:
+    """
+    计算Webhook签名：HMAC-SHA256("{timestamp}.{body}")
+
+    接收方用同一密钥重新计算并比较，同时检查时间戳防止重放
+
+    Args:
+        secret: 签名密钥
+        timestamp: Unix时间戳（秒）
+        body: 请求体
+
+    Returns:
+        签名头的值，格式为 "sha256=<hex>"
+    """
+    digest = hmac.new(secret.encode("utf-8"), timestamp.encode("ascii") + b"." + body, hashlib.sha256)
+    return f"sha256={digest.hexdigest()}"
+
+
+def validate_notification_url(url: str) -> Optional[str]:
+    """
+    校验请求级通知地址，防止调用方借通知请求访问内网服务或云平台元数据接口
+
+    Args:
+        url: Slack/Webhook地址
+
+    Returns:
+        校验通过的公网IP，发送时应连接该IP而不是重新解析域名；允许内网地址时为None
+
+    Raises:
+        ValueError: 不是http(s)地址，或主机解析到内网、本机、链路本地等非公网地址
+    """
+    parts = urlsplit(url)
+    if parts.scheme not in ("http", "https") or not parts.hostname:
+        raise ValueError(f"通知地址只支持http/https: {url}")
+    if settings.NOTIFY_ALLOW_PRIVATE_URLS:
+        return None
+
+    try:
+        addresses = [info[4][0] for info in socket.getaddrinfo(parts.hostname, parts.port or None)]
+    except (socket.gaierror, UnicodeError):
+        raise ValueError(f"通知地址的主机无法解析: {parts.hostname}")
+    for address in addresses:
+        ip = ipaddress.ip_address(address.split("%")[0])
+        if getattr(ip, "ipv4_mapped", None):
+            ip = ip.ipv4_mapped
+        if not ip.is_global:
+            raise ValueError(f"通知地址不能指向内网或本机地址: {parts.hostname}")
+    if not addresses:
+        raise ValueError(f"通知地址的主机无法解析: {parts.hostname}")
+    return addresses[0].split("%")[0]
+
+
+async def post_notification(url: str, pinned: bool = True, **kwargs: Any) -> httpx.Response:
+    """
+    向通知地址发送POST请求
+
+    请求级地址在发送时重新解析和校验，并直接连接校验过的IP，
+    避免创建任务后或校验与连接之间域名改为解析到内网（DNS重绑定）；
+    Host请求头和TLS SNI仍使用原域名，证书按原域名校验
+
+    Args:
+        url: 通知地址
+        pinned: 是否校验并固定连接的IP，管理员配置的全局渠道不需要
+        **kwargs: 传给httpx的其他参数
+
+    Raises:
+        ValueError: 地址校验失败
+    """
+    address = await asyncio.to_thread(validate_notification_url, url) if pinned else None
+    extensions = {}
+    if address:
+        parts = urlsplit(url)
+        userinfo, _, authority = parts.netloc.rpartition("@")
+        host = f"[{address}]" if ":" in address else address
+        netloc = f"{userinfo}@" if userinfo else ""
+        netloc += f"{host}:{parts.port}" if parts.port else host
+        url = urlunsplit((parts.scheme, netloc, parts.path, parts.query, ""))
+        kwargs["headers"] = {**(kwargs.get("headers") or {}), "Host": authority}
+        if parts.scheme == "https":
+            extensions["sni_hostname"] = parts.hostname
+
+    async with httpx.AsyncClient() as client:
+        return await client.post(url, extensions=extensions, **kwargs)
+
+
+def signing_secret(delivery: WebhookDelivery) -> str:
+    """
+    投递使用的签名密钥：全局渠道使用全局密钥，请求级Webhook使用所属租户的密钥，
+    租户不能借请求级Webhook取得全局密钥签名的请求
+
+    Args:
+        delivery: 投递记录
+
+    Returns:
+        签名密钥，为空表示不签名
+    """
+    if delivery.global_channel:
+        return settings.NOTIFY_WEBHOOK_SECRET
+    return get_tenant_settings(delivery.tenant_id).webhook_secret or ""
+
+
+class WebhookService:
+    """Webhook投递服务"""
+
+    def __init__(self):
+        # 只保留待重试的投递，已投递和最终失败的记录从存储读取
+        self.deliveries: Dict[str, WebhookDelivery] = {}
+        self._loaded = False
+        self._in_flight: Set[str] = set()
+        self._retry_task: Optional[asyncio.Task] = None
+
+    async def start(self) -> None:
+        """加载未完成的投递并启动重试循环"""
+        await self._ensure_loaded()
+        if self._retry_task is None:
+            self._retry_task = asyncio.create_task(self._retry_loop())
+            logger.info(f"Webhook重试循环启动，待重试 {len(self.deliveries)} 条")
+
+    async def stop(self) -> None:
+        """停止重试循环"""
+        if self._retry_task:
+            self._retry_task.cancel()
+            self._retry_task = None
+
+    async def deliver(
+        self,
+        event: str,
+        url: str,
+        payload: Dict,
+        headers: Optional[Dict[str, str]] = None,
+        global_channel: bool = False
+    ) -> WebhookDelivery:
+        """
+        创建投递记录并立即发送一次，失败时进入重试队列
+
+        Args:
+            event: 事件类型
+            url: Webhook地址
+            payload: 事件数据
+            headers: 附加请求头
+            global_channel: 是否为全局通知渠道，决定签名密钥
+
+        Returns:
+            投递记录
+        """
+        await self._ensure_loaded()
+        delivery = WebhookDelivery(
+            delivery_id=str(uuid.uuid4()),
+            tenant_id=payload.get("tenant_id") or get_current_tenant(),
+            task_id=payload.get("task_id"),
+            event=event,
+            url=url,
+            headers=headers or {},
+            payload=payload,
+            global_channel=global_channel
+        )
+        self.deliveries[delivery.delivery_id] = delivery
+        await self._attempt(delivery)
+        return delivery
+
+    async def redeliver(self, delivery_id: str) -> Optional[WebhookDelivery]:
+        """
+        手动重新投递，成功后状态变为delivered，失败时保持failed不再自动重试
+
+        Args:
+            delivery_id: 投递标识
+
+        Returns:
+            更新后的投递记录，不存在时返回None
+        """
+        delivery = await self.get_delivery(delivery_id)
+        if delivery is None:
+            return None
+        await self._attempt(delivery, manual=True)
+        return delivery
+
+    async def get_delivery(self, delivery_id: str) -> Optional[WebhookDelivery]:
+        """获取当前租户的投递记录，待重试的以内存为准"""
+        await self._ensure_loaded()
+        delivery = self.deliveries.get(delivery_id)
+        if delivery is None:
+            data = await get_store().aget(WEBHOOKS_BUCKET, delivery_id)
+            delivery = WebhookDelivery(**data) if data else None
+        if delivery is None or delivery.tenant_id != get_current_tenant():
+            return None
+        return delivery
+
+    async def list_deliveries(
+        self,
+        task_id: Optional[str] = None,
+        status: Optional[WebhookDeliveryStatus] = None
+    ) -> List[WebhookDelivery]:
+        """
+        列出当前租户的投递记录
+
+        Args:
+            task_id: 按任务过滤
+            status: 按状态过滤
+
+        Returns:
+            按创建时间排序的投递记录
+        """
+        await self._ensure_loaded()
+        tenant_id = get_current_tenant()
+        records: Dict[str, WebhookDelivery] = {}
+        for data in await get_store().avalues(WEBHOOKS_BUCKET, statuses=[status.value] if status else None):
+            try:
+                delivery = WebhookDelivery(**data)
+            except Exception as e:
+                logger.error(f"读取Webhook投递记录失败: {data.get('delivery_id')} - {str(e)}")
+                continue
+            records[delivery.delivery_id] = delivery
+        # 正在发送的投递尚未保存，以内存为准
+        records.update({key: item for key, item in self.deliveries.items() if status is None or item.status == status})
+        result = [
+            item for item in records.values()
+            if item.tenant_id == tenant_id and (task_id is None or item.task_id == task_id)
+        ]
+        return sorted(result, key=lambda item: item.created_at)
+
+    async def _attempt(self, delivery: WebhookDelivery, manual: bool = False) -> bool:
+        """发送一次并记录结果，同一条记录不会并发发送"""
+        if delivery.delivery_id in self._in_flight:
+            return False
+        self._in_flight.add(delivery.delivery_id)
+
+        attempt = WebhookAttempt(attempt=len(delivery.attempts) + 1)
+        started = time.perf_counter()
+        try:
+            body = json.dumps(
+                {"event": delivery.event, "delivery_id": delivery.delivery_id, "data": delivery.payload},
+                ensure_ascii=False,
+                default=str
+            ).encode("utf-8")
+            headers = {
+                **delivery.headers,
+                "Content-Type": "application/json",
+                DELIVERY_ID_HEADER: delivery.delivery_id,
+            }
+            secret = signing_secret(delivery)
+            if secret:
+                timestamp = str(int(time.time()))
+                headers[TIMESTAMP_HEADER] = timestamp
+                headers[SIGNATURE_HEADER] = sign_payload(secret, timestamp, body)
+
+            response = await post_notification(
+                delivery.url,
+                pinned=not delivery.global_channel,
+                content=body,
+                headers=headers,
+                timeout=settings.NOTIFY_TIMEOUT
+            )
+            attempt.status_code = response.status_code
+            response.raise_for_status()
+            success = True
+        except Exception as e:
+            attempt.error = str(e) or type(e).__name__
+            success = False
+        finally:
+            attempt.duration_ms = int((time.perf_counter() - started) * 1000)
+            self._in_flight.discard(delivery.delivery_id)
+
+        delivery.attempts.append(attempt)
+        if success:
+            delivery.status = WebhookDeliveryStatus.DELIVERED
+            delivery.delivered_at = attempt.timestamp
+            delivery.next_attempt_at = None
+        elif manual or len(delivery.attempts) >= settings.WEBHOOK_MAX_ATTEMPTS:
+            delivery.status = WebhookDeliveryStatus.FAILED
+            delivery.next_attempt_at = None
+            logger.error(f"Webhook投递失败: {delivery.delivery_id} - {delivery.event} - {attempt.error}")
+        else:
+            delay = min(
+                settings.WEBHOOK_RETRY_BASE_DELAY * 2 ** (len(delivery.attempts) - 1),
+                settings.WEBHOOK_RETRY_MAX_DELAY
+            )
+            delivery.status = WebhookDeliveryStatus.PENDING
+            delivery.next_attempt_at = datetime.now() + timedelta(seconds=delay)
+            logger.warning(
+                f"Webhook发送失败，{delay}秒后重试: {delivery.delivery_id} "
+                f"(第{len(delivery.attempts)}次) - {attempt.error}"
+            )
+
+        await self._save(delivery)
+        if delivery.status == WebhookDeliveryStatus.PENDING:
+            self.deliveries[delivery.delivery_id] = delivery
+        else:
+            self.deliveries.pop(delivery.delivery_id, None)
+        return success
+
+    async def _retry_loop(self) -> None:
+        # 多副本部署时只由主节点重试，包括其他副本首次发送失败的投递
+        while True:
+            if not leader_election.is_leader:
+                await asyncio.sleep(settings.SCHEDULER_INTERVAL)
+                continue
+
+            try:
+                await self._sync_pending()
+                now = datetime.now()
+                due = [
+                    item for item in self.deliveries.values()
+                    if item.status == WebhookDeliveryStatus.PENDING
+                    and item.next_attempt_at is not None and item.next_attempt_at <= now
+                ]
+                for delivery in due:
+                    await self._attempt(delivery)
+            except Exception as e:
+                logger.error(f"Webhook重试时出错: {str(e)}")
+
+            await asyncio.sleep(settings.SCHEDULER_INTERVAL)
+
+    async def _ensure_loaded(self) -> None:
+        if self._loaded:
+            return
+        self._loaded = True
+
+        await self._sync_pending()
+
+    async def _sync_pending(self) -> None:
+        """从存储刷新待重试的投递，正在发送的记录以内存为准，其他副本已完成的投递从内存移除"""
+        pending: Dict[str, WebhookDelivery] = {}
+        for data in await get_store().avalues(WEBHOOKS_BUCKET, statuses=[WebhookDeliveryStatus.PENDING.value]):
+            try:
+                delivery = WebhookDelivery(**data)
+                pending[delivery.delivery_id] = delivery
+            except Exception as e:
+                logger.error(f"读取Webhook投递记录失败: {data.get('delivery_id')} - {str(e)}")
+
+        for delivery_id in self._in_flight:
+            if delivery_id in self.deliveries:
+                pending[delivery_id] = self.deliveries[delivery_id]
+        self.deliveries = pending
+
+    async def _save(self, delivery: WebhookDelivery) -> None:
+        try:
+            await get_store().aput(WEBHOOKS_BUCKET, delivery.delivery_id, delivery.model_dump(mode="json"))
+        except Exception as e:
+            logger.error(f"保存Webhook投递记录失败: {delivery.delivery_id} - {str(e)}")
+
+
+# 创建全局Webhook投递服务实例
+webhook_service = WebhookService()
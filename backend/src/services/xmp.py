@@ -0,0 +1,82 @@
+"""
+章节来源XMP
+在每个章节输出中写入结构化的来源信息（源文档、章节序号和标题、页码范围、生成工具、拆分任务），
+供下游数字资产管理系统自动追踪来源
+"""
+
+from typing import Optional
+from uuid import uuid4
+from xml.sax.saxutils import escape
+
+from .. import __version__
+from ..models.schemas import ChapterInfo
+
+
+# 生成工具标识
+GENERATOR = f"pdf-chapter-splitter {__version__}"
+
+# 来源信息的XMP命名空间
+PROVENANCE_NS = "https://github.com/Snoming/pdf-chapter-splitter/ns/provenance/1.0/"
+
+XMP_TEMPLATE = """<?xpacket begin="\ufeff" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"
+    xmlns:stRef="http://ns.adobe.com/xap/1.0/sType/ResourceRef#"
+    xmlns:pcs="{ns}">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">{title}</rdf:li></rdf:Alt></dc:title>
+   <xmp:CreatorTool>{generator}</xmp:CreatorTool>
+   <xmpMM:DocumentID>uuid:{document_id}</xmpMM:DocumentID>
+   <xmpMM:InstanceID>uuid:{document_id}</xmpMM:InstanceID>
+   <xmpMM:DerivedFrom rdf:parseType="Resource">
+    <stRef:documentID>{source_id}</stRef:documentID>
+   </xmpMM:DerivedFrom>
+   <pcs:SourceDocumentID>{source_id}</pcs:SourceDocumentID>
+   <pcs:SourceSHA256>{source_hash}</pcs:SourceSHA256>
+   <pcs:ChapterIndex>{index}</pcs:ChapterIndex>
+   <pcs:ChapterTitle>{title}</pcs:ChapterTitle>
+   <pcs:StartPage>{start_page}</pcs:StartPage>
+   <pcs:EndPage>{end_page}</pcs:EndPage>
+   <pcs:SplitTaskID>{task_id}</pcs:SplitTaskID>
+   <pcs:Generator>{generator}</pcs:Generator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>"""
+
+
+def build_chapter_xmp(
+    source_id: str,
+    index: int,
+    chapter: ChapterInfo,
+    task_id: Optional[str] = None,
+    source_hash: Optional[str] = None
+) -> str:
+    """
+    生成章节的来源XMP
+
+    Args:
+        source_id: 源文档ID
+        index: 章节序号（从1开始）
+        chapter: 章节信息
+        task_id: 拆分任务ID
+        source_hash: 源文档SHA-256
+
+    Returns:
+        XMP数据包
+    """
+    return XMP_TEMPLATE.format(
+        ns=PROVENANCE_NS,
+        title=escape(chapter.title),
+        generator=escape(GENERATOR),
+        document_id=uuid4(),
+        source_id=escape(source_id),
+        source_hash=escape(source_hash or ""),
+        index=index,
+        start_page=chapter.start_page,
+        end_page=chapter.end_page,
+        task_id=escape(task_id or "")
+    )
@@ -0,0 +1,38 @@
+"""
+可嵌入的PDF章节拆分库
+
+不依赖HTTP服务、租户和任务队列，其他Python程序可以直接导入使用::
+
+    import asyncio
+    from src.splitter import open_document, AnalyzeOptions
+
+    async def main():
+        with open_document("book.pdf") as document:
+            result = await document.analyze(AnalyzeOptions(min_chapter_pages=3))
+            files = await document.split(result.chapters, "out/", progress=print)
+
+    asyncio.run(main())
+"""
+
+from .document import (
+    AnalysisResult,
+    AnalyzeOptions,
+    ChapterCallback,
+    Document,
+    ProgressCallback,
+    open_document,
+)
+from ..models.schemas import ChapterInfo, PDFMetadata, SectionHandling, SectionType
+
+__all__ = [
+    "AnalysisResult",
+    "AnalyzeOptions",
+    "ChapterCallback",
+    "ChapterInfo",
+    "Document",
+    "PDFMetadata",
+    "ProgressCallback",
+    "SectionHandling",
+    "SectionType",
+    "open_document",
+]
@@ -0,0 +1,170 @@
+"""
+拆分库的文档接口
+对PDFAnalyzer和PDFSplitter的封装，所有行为通过参数控制，不读取请求上下文
+"""
+
+import uuid
+from dataclasses import dataclass, field
+from pathlib import Path
+from typing import Callable, Dict, List, Optional, Union
+
+import fitz  # PyMuPDF
+
+from ..models.schemas import (
+    BoundaryAdjustment,
+    ChapterInfo,
+    ChapterMerge,
+    PDFMetadata,
+    SectionHandling,
+    SectionType,
+)
+from ..core.document_cache import document_cache
+from ..services.pdf_analyzer import PDFAnalyzer
+from ..services.pdf_splitter import PDFSplitter
+
+
+# 进度回调，参数为0-100的进度
+ProgressCallback = Callable[[int], None]
+
+# 单章完成回调，参数为(序号, 章节, 文件名, 错误信息)
+ChapterCallback = Callable[[int, ChapterInfo, Optional[str], Optional[str]], None]
+
+
+@dataclass
+class AnalyzeOptions:
+    """章节分析选项"""
+    use_llm: bool = False  # 启用时需配置大模型服务
+    chapter_patterns: Optional[List[str]] = None  # 章节标题正则，为空时使用默认规则
+    min_chapter_pages: int = 1  # 少于该页数的章节并入相邻章节
+    auto_fix_boundaries: bool = True  # 修正章节间的小重叠和间隙
+    max_gap: int = 1  # 自动修正时允许吸收的最大间隙页数
+    max_overlap: int = 1  # 自动修正时允许修正的最大重叠页数
+    section_handling: SectionHandling = SectionHandling.INCLUDE  # 非正文区域的处理方式
+    section_overrides: Dict[SectionType, SectionHandling] = field(default_factory=dict)
+
+
+@dataclass
+class AnalysisResult:
+    """章节分析结果"""
+    chapters: List[ChapterInfo]
+    metadata: PDFMetadata
+    merges: List[ChapterMerge] = field(default_factory=list)
+    adjustments: List[BoundaryAdjustment] = field(default_factory=list)
+
+
+class Document:
+    """已打开的PDF文档，分析和拆分共用同一份解析结果"""
+
+    def __init__(self, path: Union[str, Path]):
+        self.path = Path(path)
+        if not self.path.is_file():
+            raise FileNotFoundError(f"PDF文件不存在: {self.path}")
+
+        with fitz.open(str(self.path)) as doc:
+            if not doc.is_pdf:
+                raise ValueError(f"不是有效的PDF文件: {self.path}")
+            self.page_count = len(doc)
+
+        # 文档缓存键，同一文档的分析和拆分只解析一次
+        self._doc_key = f"lib:{uuid.uuid4()}"
+        self._closed = False
+
+    def __enter__(self) -> "Document":
+        return self
+
+    def __exit__(self, *exc_info) -> None:
+        self.close()
+
+    def close(self) -> None:
+        """关闭文档，释放缓存的解析结果"""
+        if not self._closed:
+            document_cache.evict(self._doc_key)
+            self._closed = True
+
+    async def analyze(
+        self,
+        options: Optional[AnalyzeOptions] = None,
+        progress: Optional[ProgressCallback] = None
+    ) -> AnalysisResult:
+        """
+        识别章节结构
+
+        Args:
+            options: 分析选项
+            progress: 进度回调
+
+        Returns:
+            分析结果
+        """
+        self._ensure_open()
+        options = options or AnalyzeOptions()
+        analyzer = PDFAnalyzer(options.chapter_patterns)
+
+        chapters, metadata = await analyzer.analyze_pdf(
+            str(self.path),
+            self.path.stem,
+            use_llm=options.use_llm,
+            progress_callback=progress,
+            doc_key=self._doc_key
+        )
+
+        if options.section_handling != SectionHandling.INCLUDE or options.section_overrides:
+            chapters = analyzer.apply_section_handling(chapters, options.section_handling, options.section_overrides)
+
+        chapters, merges = analyzer.merge_small_chapters(chapters, options.min_chapter_pages)
+
+        adjustments: List[BoundaryAdjustment] = []
+        if options.auto_fix_boundaries:
+            chapters, adjustments = analyzer.auto_fix_boundaries(
+                chapters, self.page_count, options.max_gap, options.max_overlap
+            )
+
+        metadata.chapters = chapters
+        return AnalysisResult(chapters=chapters, metadata=metadata, merges=merges, adjustments=adjustments)
+
+    async def split(
+        self,
+        chapters: List[ChapterInfo],
+        output_dir: Union[str, Path],
+        progress: Optional[ProgressCallback] = None,
+        on_chapter: Optional[ChapterCallback] = None
+    ) -> List[Path]:
+        """
+        按章节拆分，输出目录中同时生成manifest.json
+
+        Args:
+            chapters: 章节列表
+            output_dir: 输出目录
+            progress: 进度回调
+            on_chapter: 单章完成回调
+
+        Returns:
+            生成的章节文件路径
+        """
+        self._ensure_open()
+        filenames = await PDFSplitter().split_pdf(
+            str(self.path),
+            chapters,
+            str(output_dir),
+            progress_callback=progress,
+            chapter_callback=on_chapter,
+            doc_key=self._doc_key
+        )
+        return [Path(output_dir) / name for name in filenames]
+
+    def _ensure_open(self) -> None:
+        if self._closed:
+            raise ValueError("文档已关闭")
+
+
+def open_document(path: Union[str, Path]) -> Document:
+    """
+    打开PDF文档
+
+    Args:
+        path: PDF文件路径
+
+    Returns:
+        文档对象，建议配合with语句使用
+    """
+    return Document(path)
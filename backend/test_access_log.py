@@ -0,0 +1,105 @@
+"""
+访问日志测试，验证每个请求记录方法、路径、状态码、耗时、收发字节数、调用方和请求ID，按级别过滤，且同一份字段写入指标
+"""
+
+import asyncio
+
+from loguru import logger
+
+from src.api.middleware import UNMATCHED_ROUTE, AccessLogMiddleware
+from src.core.config import settings
+from src.core.metrics import metrics
+
+
+async def _echo_app(scope, receive, send):
+    """读取请求体后原样返回，路径为 /missing 时返回404"""
+    body = b""
+    while True:
+        message = await receive()
+        body += message.get("body", b"")
+        if not message.get("more_body"):
+            break
+    status = 404 if scope["path"] == "/missing" else 200
+    await send({"type": "http.response.start", "status": status, "headers": []})
+    await send({"type": "http.response.body", "body": body + b"!"})
+
+
+async def _request(app, method: str, path: str, body: bytes = b"", headers=None) -> dict:
+    scope = {
+        "type": "http", "method": method, "path": path,
+        "headers": [(k.lower().encode("latin-1"), v.encode("latin-1")) for k, v in (headers or {}).items()],
+        "client": ("10.0.0.7", 1234),
+    }
+    chunks = [body[:3], body[3:]]
+    sent = []
+
+    async def receive():
+        chunk = chunks.pop(0) if chunks else b""
+        return {"type": "http.request", "body": chunk, "more_body": bool(chunks)}
+
+    async def send(message):
+        sent.append(message)
+
+    await app(scope, receive, send)
+    return sent[0]
+
+
+def _capture() -> tuple:
+    """收集访问日志记录，返回 (记录列表, sink ID)"""
+    records = []
+    sink_id = logger.add(lambda message: records.append(message.record), filter=lambda record: record["extra"].get("access"))
+    return records, sink_id
+
+
+def test_access_log_fields():
+    """测试访问日志字段和响应中的请求ID"""
+    print("测试访问日志字段...")
+
+    records, sink_id = _capture()
+    try:
+        app = AccessLogMiddleware(_echo_app)
+        start = asyncio.run(_request(app, "POST", "/api/echo", b"hello", {"X-Request-ID": "rid-42", "X-API-Key": "secret-key"}))
+        assert (b"x-request-id", b"rid-42") in start["headers"]
+
+        start = asyncio.run(_request(app, "GET", "/api/echo"))
+        generated = dict(start["headers"])[b"x-request-id"].decode()
+        assert generated and generated != "rid-42", "未携带请求ID时生成新的ID"
+    finally:
+        logger.remove(sink_id)
+
+    extra = records[0]["extra"]
+    assert (extra["method"], extra["path"], extra["status"]) == ("POST", "/api/echo", 200)
+    assert extra["bytes_in"] == 5 and extra["bytes_out"] == 6
+    assert extra["request_id"] == "rid-42" and extra["client"] == "10.0.0.7"
+    # 只记录Key前缀，不泄露完整Key
+    assert extra["user"] == "key:secret***"
+    assert extra["latency_ms"] >= 0 and extra["route"] == UNMATCHED_ROUTE
+    assert records[1]["extra"]["user"] == "anonymous" and records[1]["extra"]["request_id"] == generated
+    print("✓ 访问日志包含方法、路径、状态码、字节数、调用方和请求ID")
+
+
+def test_level_filter_and_metrics():
+    """测试按级别过滤和跳过的路径仍计入指标"""
+    print("\n测试日志级别过滤...")
+
+    original_level = settings.ACCESS_LOG_LEVEL
+    settings.ACCESS_LOG_LEVEL = "WARNING"
+    records, sink_id = _capture()
+    try:
+        app = AccessLogMiddleware(_echo_app)
+        before = metrics.snapshot()["requests"].get(f"GET {UNMATCHED_ROUTE}", {}).get("count", 0)
+
+        async def run():
+            await _request(app, "GET", "/api/echo")
+            await _request(app, "GET", "/missing")
+            await _request(app, "GET", "/health")
+
+        asyncio.run(run())
+        after = metrics.snapshot()["requests"][f"GET {UNMATCHED_ROUTE}"]["count"]
+    finally:
+        logger.remove(sink_id)
+        settings.ACCESS_LOG_LEVEL = original_level
+
+    assert [(record["level"].name, record["extra"]["path"]) for record in records] == [("WARNING", "/missing")]
+    assert after - before == 3, "过滤掉的日志和健康检查同样计入指标"
+    print("✓ 2xx低于WARNING不输出，4xx按WARNING输出，健康检查只计入指标")
@@ -0,0 +1,80 @@
+"""
+章节分析缓存测试，验证相同文件和选项命中缓存、选项或页码偏移变化时重新分析、force_refresh跳过缓存，以及缓存失效和持久化
+"""
+
+import asyncio
+import io
+
+from src.models.schemas import AnalyzeRequest, AnalyzeResponse, ChapterInfo
+from src.services.analysis_cache import AnalysisCache, analysis_cache
+from src.services.analysis_service import AnalysisService
+
+
+def _counting_service() -> tuple:
+    """实际分析只计数并返回固定结果的服务，返回 (服务, 调用次数列表)"""
+    service = AnalysisService()
+    calls = []
+
+    async def run(request, file_path, progress_callback=None, file_hash=None, page_offset=None):
+        calls.append((request.min_pages_per_chapter, page_offset))
+        chapter = ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2)
+        return AnalyzeResponse(success=True, chapters=[chapter], total_pages=2)
+
+    service._run = run
+    return service, calls
+
+
+def test_cache_hits_and_misses(tmp_upload_dir, pdf_bytes):
+    """测试命中缓存和重新分析的条件"""
+    print("测试分析缓存...")
+
+    service, calls = _counting_service()
+
+    async def run():
+        info = await service.file_service.save_pdf_stream(io.BytesIO(pdf_bytes(pages=2)), "book.pdf")
+        request = AnalyzeRequest(file_id=info.file_id)
+        progress = []
+
+        assert not (await service.analyze(request, info.file_path)).cached
+        hit = await service.analyze(request, info.file_path, progress.append)
+        assert hit.cached and hit.chapters[0].title == "第一章"
+        assert progress == [100] and len(calls) == 1
+
+        # 影响结果的选项变化时重新分析，force_refresh不参与缓存键
+        assert not (await service.analyze(AnalyzeRequest(file_id=info.file_id, min_pages_per_chapter=3), info.file_path)).cached
+        assert not (await service.analyze(AnalyzeRequest(file_id=info.file_id, force_refresh=True), info.file_path)).cached
+        assert (await service.analyze(request, info.file_path)).cached
+        assert len(calls) == 3
+
+        # 校准印刷页码后重新分析
+        await service.file_service.set_page_offset(info.file_id, 4)
+        assert not (await service.analyze(request, info.file_path)).cached
+        assert calls[-1] == (1, 4)
+
+    asyncio.run(run())
+    print("✓ 相同文件和选项命中缓存，选项、页码偏移变化或force_refresh时重新分析")
+
+
+def test_invalidate_and_persist(tmp_upload_dir, pdf_bytes):
+    """测试缓存写入文件目录，删除文件时失效"""
+    print("\n测试分析缓存失效...")
+
+    service, calls = _counting_service()
+
+    async def run():
+        info = await service.file_service.save_pdf_stream(io.BytesIO(pdf_bytes(pages=2)), "book.pdf")
+        request = AnalyzeRequest(file_id=info.file_id)
+        await service.analyze(request, info.file_path)
+
+        # 重启后从文件目录读取
+        restarted = AnalysisCache()
+        assert restarted.latest(info.file_id)["total_pages"] == 2
+        assert restarted.latest("00000000-0000-4000-8000-000000000000") is None
+
+        assert analysis_cache.invalidate(info.file_id) == 1
+        assert analysis_cache.latest(info.file_id) is None
+        assert not (await service.analyze(request, info.file_path)).cached
+        assert len(calls) == 2
+
+    asyncio.run(run())
+    print("✓ 分析结果持久化到文件目录，失效后内存和文件中的缓存都被清除")
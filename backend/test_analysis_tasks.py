@@ -0,0 +1,123 @@
+"""
+异步分析任务测试，验证分析任务入队、处理时上报进度并保存结果、文件不存在时失败，以及SSE推送事件、进度和结束消息
+"""
+
+import asyncio
+from uuid import uuid4
+
+from fastapi import HTTPException
+
+from src.api import routes
+from src.core.tenancy import file_storage_dir
+from src.models.schemas import AnalyzeRequest, AnalyzeResponse, ChapterInfo, TaskStatus, TaskType
+from src.services.task_service import TaskService
+
+
+def _replica() -> TaskService:
+    """不启动工作线程和调度器的服务实例"""
+    service = TaskService()
+    service._initialized = True
+    return service
+
+
+def _upload(file_id: str) -> None:
+    """写入上传文件，分析过程由_fake_analysis替代，不读取内容"""
+    file_dir = file_storage_dir(file_id)
+    file_dir.mkdir(parents=True)
+    (file_dir / "original.pdf").write_bytes(b"%PDF-1.4\n")
+
+
+def _fake_analysis(service: TaskService) -> list:
+    """替换章节分析：上报40%进度并返回一个章节，返回分析过程中看到的任务进度"""
+    seen = []
+
+    async def analyze(request, file_path, progress_callback=None):
+        progress_callback(40)
+        seen.extend(task.progress for task in service.tasks.values())
+        return AnalyzeResponse(
+            success=True,
+            chapters=[ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2)],
+            total_pages=2
+        )
+
+    service.analysis_service.analyze = analyze
+    return seen
+
+
+def test_analysis_task_lifecycle(tmp_upload_dir):
+    """测试分析任务入队、处理和保存结果"""
+    print("测试异步分析任务...")
+
+    service = _replica()
+    seen = _fake_analysis(service)
+    file_id = str(uuid4())
+    _upload(file_id)
+
+    async def run():
+        task = await service.create_analysis_task(AnalyzeRequest(file_id=file_id))
+        assert task.task_type == TaskType.ANALYZE
+        assert task.status == TaskStatus.QUEUED
+        assert (await service._task_queue.get())[2] == task.task_id
+
+        await service._process_analysis_task(task)
+        assert task.status == TaskStatus.COMPLETED and task.progress == 100
+        assert task.analysis_result.chapters[0].title == "第一章"
+        assert seen == [40]
+
+        events = await service.get_task_events(task.task_id)
+        assert [event.event for event in events] == ["queued", "started", "completed"]
+        assert events[-1].details == {"chapters": 1}
+
+    asyncio.run(run())
+    print("✓ 分析任务入队后处理，进度和章节结果保存到任务")
+
+
+def test_missing_file_fails(tmp_upload_dir):
+    """测试上传文件不存在时任务失败"""
+    print("\n测试文件不存在...")
+
+    service = _replica()
+    _fake_analysis(service)
+
+    async def run():
+        task = await service.create_analysis_task(AnalyzeRequest(file_id=str(uuid4())))
+        await service._process_analysis_task(task)
+        assert task.status == TaskStatus.FAILED
+        assert "文件不存在" in task.error_message
+        assert (await service.get_task_events(task.task_id))[-1].event == "failed"
+
+    asyncio.run(run())
+    print("✓ 文件不存在时任务失败并记录失败事件")
+
+
+def test_stream_progress(tmp_upload_dir, monkeypatch):
+    """测试SSE依次推送任务事件、进度和结束消息"""
+    print("\n测试SSE任务进度...")
+
+    service = _replica()
+    monkeypatch.setattr(routes, "task_service", service)
+    _fake_analysis(service)
+    file_id = str(uuid4())
+    _upload(file_id)
+
+    async def run():
+        task = await service.create_analysis_task(AnalyzeRequest(file_id=file_id))
+        await service._process_analysis_task(task)
+
+        response = await routes.stream_task_progress(task.task_id)
+        assert response.media_type == "text/event-stream"
+        chunks = [chunk async for chunk in response.body_iterator]
+        assert [chunk.split("\n", 1)[0] for chunk in chunks] == [
+            "event: task_event", "event: task_event", "event: task_event",
+            "event: progress", "event: done",
+        ]
+        assert '"completed"' in chunks[3] and '"progress": 100' in chunks[3]
+
+        try:
+            await routes.stream_task_progress("missing")
+            assert False, "不存在的任务应返回404"
+        except HTTPException as e:
+            assert e.status_code == 404
+
+    asyncio.run(run())
+    print("✓ SSE推送全部事件和最新进度，任务结束后关闭")
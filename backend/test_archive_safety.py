@@ -0,0 +1,102 @@
+"""
+压缩包安全测试，验证批量上传拒绝目录穿越和绝对路径条目、加密条目、压缩炸弹以及超出数量和解压总量的压缩包
+"""
+
+import asyncio
+import io
+import zipfile
+
+from fastapi import HTTPException, UploadFile
+
+from src.core.config import settings
+from src.services.file_service import FileService
+
+
+def _zip(entries: dict, compression: int = zipfile.ZIP_STORED) -> zipfile.ZipFile:
+    buffer = io.BytesIO()
+    with zipfile.ZipFile(buffer, "w", compression) as archive:
+        for name, data in entries.items():
+            archive.writestr(name, data)
+    buffer.seek(0)
+    return zipfile.ZipFile(buffer)
+
+
+def _rejected(action, status: int = 400) -> str:
+    try:
+        action()
+    except HTTPException as e:
+        assert e.status_code == status, e.detail
+        return e.detail
+    assert False, "应拒绝"
+
+
+def test_entry_names():
+    """测试条目路径校验"""
+    print("测试条目路径...")
+
+    assert FileService._safe_entry_name("数学/代数/a.pdf") == "a.pdf"
+    assert FileService._safe_entry_name("语文\\b.pdf") == "b.pdf"
+    for name in (
+        "../evil.pdf",
+        "books/../../evil.pdf",
+        "..\\..\\evil.pdf",
+        "/etc/passwd",
+        "\\\\server\\share\\a.pdf",
+        "C:/Windows/a.pdf",
+        "a\0.pdf",
+    ):
+        assert "路径非法" in _rejected(lambda: FileService._safe_entry_name(name)), name
+    print("✓ 目录穿越、绝对路径、盘符和空字符的条目被拒绝，合法条目只取文件名")
+
+
+def test_archive_limits():
+    """测试加密条目、压缩比、条目数量和解压总量"""
+    print("\n测试压缩包限制...")
+
+    entries = FileService.validate_archive(_zip({"a/": b"", "a/x.pdf": b"%PDF", "y.pdf": b"%PDF"}))
+    assert [name for _, name in entries] == ["x.pdf", "y.pdf"]
+
+    assert "没有文件" in _rejected(lambda: FileService.validate_archive(_zip({"empty/": b""})))
+
+    encrypted = _zip({"a.pdf": b"%PDF"})
+    encrypted.infolist()[0].flag_bits |= 0x1
+    assert "加密" in _rejected(lambda: FileService.validate_archive(encrypted))
+
+    bomb = _zip({"bomb.pdf": b"\0" * (1024 * 1024)}, zipfile.ZIP_DEFLATED)
+    assert "压缩炸弹" in _rejected(lambda: FileService.validate_archive(bomb))
+
+    original = settings.MAX_ARCHIVE_ENTRIES, settings.MAX_ARCHIVE_TOTAL_SIZE
+    try:
+        settings.MAX_ARCHIVE_ENTRIES = 2
+        many = _zip({f"{i}.pdf": b"%PDF" for i in range(3)})
+        assert "数量超过限制" in _rejected(lambda: FileService.validate_archive(many))
+
+        settings.MAX_ARCHIVE_ENTRIES, settings.MAX_ARCHIVE_TOTAL_SIZE = 100, 10
+        large = _zip({"a.pdf": b"%PDF-1.4", "b.pdf": b"%PDF-1.4"})
+        assert "解压后大小超过限制" in _rejected(lambda: FileService.validate_archive(large), 413)
+    finally:
+        settings.MAX_ARCHIVE_ENTRIES, settings.MAX_ARCHIVE_TOTAL_SIZE = original
+    print("✓ 加密条目、压缩比异常、条目过多和解压总量超限的压缩包被拒绝")
+
+
+def test_upload_rejects_traversal(pdf_bytes, tmp_path, tmp_upload_dir, tmp_temp_dir):
+    """测试含目录穿越条目的压缩包整体拒绝，不写入任何文件"""
+    print("\n测试批量上传目录穿越...")
+
+    buffer = io.BytesIO()
+    with zipfile.ZipFile(buffer, "w") as archive:
+        archive.writestr("ok.pdf", pdf_bytes("OK"))
+        archive.writestr("../../escape.pdf", pdf_bytes("Escape"))
+    buffer.seek(0)
+
+    service = FileService()
+    try:
+        asyncio.run(service.save_uploaded_archive(UploadFile(buffer, filename="books.zip")))
+        assert False, "含目录穿越条目的压缩包应被拒绝"
+    except HTTPException as e:
+        assert e.status_code == 400 and "路径非法" in e.detail
+
+    assert not list(tmp_path.rglob("escape.pdf"))
+    assert not list(tmp_upload_dir.rglob("*.pdf")), "拒绝时不保存任何条目"
+    assert not list(tmp_temp_dir.rglob("*.zip")), "临时压缩包被删除"
+    print("✓ 压缩包中任一条目路径非法时整体拒绝，不落盘任何文件")
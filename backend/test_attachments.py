@@ -0,0 +1,75 @@
+"""
+嵌入附件测试，验证附件列出、读取和拆分时携带到章节输出
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import AttachmentMode, ChapterInfo
+from src.services.attachment_service import attachment_service
+from src.services.pdf_splitter import PDFSplitter
+
+
+def _build_pdf(path: Path) -> None:
+    doc = fitz.open()
+    doc.new_page().insert_text((72, 72), "See results.csv for the raw data")
+    doc.new_page().insert_text((72, 72), "Appendix")
+    doc[1].add_file_annot(fitz.Point(100, 100), b"print('hi')", "script.py", desc="源代码")
+    doc.embfile_add("results", b"a,b\n1,2\n", filename="results.csv", desc="实验数据")
+    doc.embfile_add("slides", b"PK-fake", filename="slides.pptx")
+    doc.save(str(path))
+    doc.close()
+
+
+def test_list_and_get():
+    """测试列出文档级附件和附件注释并读取内容"""
+    print("测试列出嵌入附件...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        _build_pdf(source)
+
+        attachments = attachment_service.list(str(source))
+        assert [a.filename for a in attachments] == ["results.csv", "slides.pptx", "script.py"]
+        assert attachments[0].description == "实验数据" and attachments[0].page is None
+        assert attachments[2].page == 2
+
+        info, content = attachment_service.get(str(source), "results")
+        assert content == b"a,b\n1,2\n" and info.filename == "results.csv"
+
+        info, content = attachment_service.get(str(source), attachments[2].name)
+        assert content == b"print('hi')" and info.page == 2
+
+        for name in ("missing", "page9/1", "page1/abc", "../etc"):
+            assert attachment_service.get(str(source), name) is None
+    print("✓ 文档级附件和页面附件注释均可列出和下载")
+
+
+def test_split_carries_attachments():
+    """测试拆分时按方式携带文档级附件"""
+    print("\n测试章节携带附件...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        _build_pdf(source)
+        chapters = [
+            ChapterInfo(title="第1章", start_page=1, end_page=1, page_count=1),
+            ChapterInfo(title="附录", start_page=2, end_page=2, page_count=1),
+        ]
+
+        def split(mode: AttachmentMode):
+            output_dir = Path(tmp) / mode.value
+            links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), attachments=mode))
+            result = []
+            for link in links:
+                with fitz.open(str(output_dir / link)) as doc:
+                    result.append(sorted(doc.embfile_names()))
+            return result
+
+        assert split(AttachmentMode.NONE) == [[], []]
+        assert split(AttachmentMode.ALL) == [["results", "slides"], ["results", "slides"]]
+        assert split(AttachmentMode.REFERENCED) == [["results"], []]
+    print("✓ 按none/all/referenced携带附件")
@@ -0,0 +1,108 @@
+"""
+审计记录测试，验证修改操作（包括被拒绝的请求）写入审计记录、按租户隔离、按调用方过滤和过期清理
+"""
+
+import asyncio
+from datetime import datetime, timedelta
+
+from src.api.middleware import RBACMiddleware, TenantMiddleware, required_role
+from src.core.config import settings
+from src.core.store import get_store
+from src.core.tenancy import use_tenant
+from src.models.schemas import Role
+from src.services.audit_service import AUDIT_BUCKET, ENTRY_ID_TIME_FORMAT, audit_service
+
+
+TEST_TENANTS = {
+    "team-a": {
+        "api_keys": [
+            {"key": "viewer-key", "user": "vivian", "role": "viewer"},
+            {"key": "editor-key", "user": "eddie", "role": "editor"},
+        ]
+    }
+}
+
+
+async def _ok_app(scope, receive, send):
+    await send({"type": "http.response.start", "status": 200, "headers": []})
+    await send({"type": "http.response.body", "body": b"ok"})
+
+
+async def _call(app, method: str, path: str, headers=None) -> int:
+    """调用ASGI应用并返回响应状态码"""
+    scope = {
+        "type": "http",
+        "method": method,
+        "path": path,
+        "headers": [(k.lower().encode("latin-1"), v.encode("latin-1")) for k, v in (headers or {}).items()],
+        "state": {"request_id": "rid-1"},
+    }
+    messages = []
+
+    async def receive():
+        return {"type": "http.request", "body": b"", "more_body": False}
+
+    async def send(message):
+        messages.append(message)
+
+    await app(scope, receive, send)
+    return next(m["status"] for m in messages if m["type"] == "http.response.start")
+
+
+def test_record_requests(tmp_upload_dir, monkeypatch):
+    """测试修改操作和被拒绝的请求写入审计记录，只读请求不记录"""
+    print("测试审计记录...")
+
+    monkeypatch.setattr(settings, "TENANTS", TEST_TENANTS)
+    app = TenantMiddleware(RBACMiddleware(_ok_app))
+    tenant = {"X-Tenant-ID": "team-a"}
+
+    async def run():
+        assert await _call(app, "POST", "/api/split", {**tenant, "X-API-Key": "editor-key"}) == 200
+        assert await _call(app, "DELETE", "/api/files/f1", {**tenant, "X-API-Key": "viewer-key"}) == 403
+        assert await _call(app, "GET", "/api/tasks", {**tenant, "X-API-Key": "viewer-key"}) == 200
+
+        with use_tenant("team-a"):
+            entries = await audit_service.list()
+            assert [(entry.user, entry.method, entry.path, entry.status) for entry in entries] == [
+                ("vivian", "DELETE", "/api/files/f1", 403),
+                ("eddie", "POST", "/api/split", 200),
+            ]
+            assert entries[1].role == Role.EDITOR and entries[1].request_id == "rid-1"
+            assert [entry.path for entry in await audit_service.list(user="eddie")] == ["/api/split"]
+            assert len(await audit_service.list(limit=1)) == 1
+
+        # 其他租户看不到
+        with use_tenant(settings.DEFAULT_TENANT):
+            assert await audit_service.list() == []
+
+    asyncio.run(run())
+    assert required_role("GET", "/api/admin/audit") == Role.ADMIN
+    print("✓ 修改操作记录调用方、角色和结果，只有管理员可以查看")
+
+
+def test_cleanup_expired(tmp_upload_dir, monkeypatch):
+    """测试超过保留天数的审计记录被清理"""
+    print("\n测试清理过期审计记录...")
+
+    monkeypatch.setattr(settings, "AUDIT_RETENTION_DAYS", 30)
+    tenant_id = settings.DEFAULT_TENANT
+
+    async def run():
+        with use_tenant(tenant_id):
+            await audit_service.record("POST", "/api/upload", 200)
+        old = datetime.now() - timedelta(days=31)
+        entry_id = f"{old.strftime(ENTRY_ID_TIME_FORMAT)}-00000000"
+        await get_store().aput(AUDIT_BUCKET, entry_id, {
+            "entry_id": entry_id, "timestamp": old.isoformat(), "method": "POST", "path": "/api/split", "status": 200
+        }, tenant_id)
+
+        assert await audit_service.cleanup_expired(tenant_id) == 1
+        with use_tenant(tenant_id):
+            assert [entry.path for entry in await audit_service.list()] == ["/api/upload"]
+
+        monkeypatch.setattr(settings, "AUDIT_RETENTION_DAYS", 0)
+        assert await audit_service.cleanup_expired(tenant_id) == 0
+
+    asyncio.run(run())
+    print("✓ 过期记录按保留天数清理，设为0时保留全部记录")
@@ -0,0 +1,67 @@
+"""
+基准测试工具测试，验证样本生成可复现、结果统计、基线对比和并发限制
+"""
+
+import fitz
+
+from src.core.scratch import SCRATCH_DIRNAME
+from src.models.schemas import BenchmarkRequest, BenchmarkResult
+from src.services import benchmark
+from src.services.benchmark import BenchmarkSample, BenchmarkService
+
+
+def _result(sample: str, pages_per_second: float) -> BenchmarkResult:
+    return BenchmarkResult(
+        sample=sample, pages=10, chapters=2, iterations=1, seconds=[1.0], median_seconds=1.0,
+        pages_per_second=pages_per_second, output_bytes=1, peak_allocated_bytes=1, retained_bytes=0
+    )
+
+
+def test_compare():
+    """测试与基线对比"""
+    print("测试基线对比...")
+
+    results = [_result("text", 70), _result("images", 95), _result("large", 10)]
+    baseline = [_result("text", 100), _result("images", 100)]
+    regressions = BenchmarkService.compare(results, baseline, 0.2)
+    assert len(regressions) == 1 and regressions[0].startswith("text:") and "30%" in regressions[0]
+    assert BenchmarkService.compare(results, [], 0.2) == []
+    print("✓ 只报告下降超过容差的样本，没有基线的样本不参与对比")
+
+
+def test_run_small_sample(tmp_temp_dir, monkeypatch):
+    """测试用小样本运行"""
+    print("\n测试运行基准...")
+
+    monkeypatch.setattr(benchmark, "BENCHMARK_SAMPLES", {"tiny": BenchmarkSample(pages=6, chapters=3, images=True)})
+    service = BenchmarkService()
+    path = service.sample_path("tiny")
+    with fitz.open(str(path)) as doc:
+        assert doc.page_count == 6 and doc[0].get_images()
+        first = [page.get_text() for page in doc]
+    path.unlink()
+    with fitz.open(str(service.sample_path("tiny"))) as doc:
+        assert [page.get_text() for page in doc] == first
+
+    response = service.run(BenchmarkRequest(iterations=2, baseline=[_result("tiny", 1e9)]))
+    result = response.results[0]
+    assert result.sample == "tiny" and result.chapters == 3 and len(result.seconds) == 2
+    assert result.pages_per_second > 0 and result.output_bytes > 0 and result.peak_allocated_bytes > 0
+    assert response.regressions and "PyMuPDF" in response.engine
+    assert not list(tmp_temp_dir.glob(f"{SCRATCH_DIRNAME}/*"))
+
+    try:
+        service.run(BenchmarkRequest(samples=["missing"]))
+        assert False, "应拒绝未知样本"
+    except ValueError as e:
+        assert "missing" in str(e)
+
+    service._lock.acquire()
+    try:
+        service.run(BenchmarkRequest())
+        assert False, "应拒绝并发运行"
+    except RuntimeError:
+        pass
+    finally:
+        service._lock.release()
+    print("✓ 样本内容可复现，结果包含耗时、输出大小和内存统计")
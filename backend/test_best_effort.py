@@ -0,0 +1,89 @@
+"""
+尽力拆分测试，验证无法读取的页面被跳过或替换为占位页、章节照常生成，以及受影响页码的记录
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.core.diagnostics import collect_warnings
+from src.models.schemas import ChapterInfo, UnreadablePageHandling, WarningCode
+from src.services.pdf_splitter import PDFSplitter
+from src.services.task_service import TaskService
+
+# 模拟扫描损坏的页面（原文件页码）
+UNREADABLE_PAGE = 2
+
+
+def _split(source: Path, output_dir: Path, **options):
+    """拆分时让UNREADABLE_PAGE复制失败，返回(文件名列表, 警告)"""
+    splitter = PDFSplitter()
+    copy_page = PDFSplitter._copy_page
+    splitter._copy_page = lambda doc, new_doc, page_num: page_num + 1 != UNREADABLE_PAGE and copy_page(doc, new_doc, page_num)
+    chapters = [
+        ChapterInfo(title="第1章", start_page=1, end_page=3, page_count=3),
+        ChapterInfo(title="第2章", start_page=4, end_page=4, page_count=1),
+    ]
+
+    async def run():
+        with collect_warnings() as warnings:
+            links = await splitter.split_pdf(str(source), chapters, str(output_dir), **options)
+        return links, warnings
+
+    return asyncio.run(run())
+
+
+def test_placeholder(make_pdf):
+    """测试默认以占位页替换无法读取的页面"""
+    print("测试占位页...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "scan.pdf"
+        make_pdf(source, 4)
+        output_dir = Path(tmp) / "out"
+        links, warnings = _split(source, output_dir, best_effort=True)
+
+        assert len(links) == 2
+        with fitz.open(str(output_dir / links[0])) as chapter:
+            assert chapter.page_count == 3
+            assert "无法读取" in chapter[1].get_text()
+            assert "Page 3" in chapter[2].get_text()
+        assert [w.code for w in warnings] == [WarningCode.PAGE_UNREADABLE]
+        assert warnings[0].details == {"page": UNREADABLE_PAGE, "chapter": 1}
+        assert TaskService._damaged_pages(output_dir) == [UNREADABLE_PAGE]
+    print("✓ 无法读取的页面替换为占位页，章节页数不变")
+
+
+def test_skip(make_pdf):
+    """测试skip模式从章节中省略无法读取的页面"""
+    print("\n测试跳过页面...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "scan.pdf"
+        make_pdf(source, 4)
+        output_dir = Path(tmp) / "out"
+        links, _ = _split(source, output_dir, best_effort=True, unreadable_pages=UnreadablePageHandling.SKIP)
+
+        with fitz.open(str(output_dir / links[0])) as chapter:
+            assert [page.get_text().strip() for page in chapter] == ["Page 1", "Page 3"]
+        assert TaskService._damaged_pages(output_dir) == [UNREADABLE_PAGE]
+    print("✓ skip模式省略无法读取的页面")
+
+
+def test_without_best_effort(make_pdf):
+    """测试未开启尽力拆分时按原方式整段复制"""
+    print("\n测试默认模式...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "scan.pdf"
+        make_pdf(source, 4)
+        output_dir = Path(tmp) / "out"
+        links, warnings = _split(source, output_dir)
+
+        with fitz.open(str(output_dir / links[0])) as chapter:
+            assert chapter.page_count == 3 and "Page 2" in chapter[1].get_text()
+        assert warnings == []
+        assert TaskService._damaged_pages(output_dir) == []
+    print("✓ 默认模式不逐页检查")
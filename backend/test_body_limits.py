@@ -0,0 +1,105 @@
+"""
+请求体大小限制测试，验证按路由选择上限、Content-Length超限和无效时直接拒绝，以及分块读取超限时统一返回413
+"""
+
+import asyncio
+import json
+
+from src.api.middleware import BodySizeLimitMiddleware
+from src.core.config import settings
+
+
+def _scope(path: str, method: str = "POST", content_length: int = None) -> dict:
+    headers = [] if content_length is None else [(b"content-length", str(content_length).encode())]
+    return {"type": "http", "method": method, "path": path, "headers": headers}
+
+
+def _receive(chunks: list):
+    async def receive():
+        body = chunks.pop(0) if chunks else b""
+        return {"type": "http.request", "body": body, "more_body": bool(chunks)}
+    return receive
+
+
+async def _read_body_app(scope, receive, send):
+    """读完请求体后返回200；读取出错时返回500，模拟应用把异常转成其他响应"""
+    try:
+        while True:
+            message = await receive()
+            if not message.get("more_body"):
+                break
+        status = 200
+    except Exception:
+        status = 500
+    await send({"type": "http.response.start", "status": status, "headers": []})
+    await send({"type": "http.response.body", "body": b"ok"})
+
+
+def _call(middleware, scope: dict, chunks: list) -> tuple:
+    sent = []
+
+    async def send(message):
+        sent.append(message)
+
+    asyncio.run(middleware(scope, _receive(chunks), send))
+    body = b"".join(message.get("body", b"") for message in sent if message["type"] == "http.response.body")
+    return sent[0]["status"], body
+
+
+def test_route_limits():
+    """测试按路由选择上限"""
+    print("测试路由上限...")
+
+    middleware = BodySizeLimitMiddleware(_read_body_app)
+    overhead = BodySizeLimitMiddleware.MULTIPART_OVERHEAD
+    assert middleware.limit_for("/api/upload/batch") == settings.MAX_ARCHIVE_SIZE + overhead
+    assert middleware.limit_for("/api/upload/batch/") == settings.MAX_ARCHIVE_SIZE + overhead
+    assert middleware.limit_for("/api/upload") == max(settings.MAX_FILE_SIZE, settings.MAX_ARCHIVE_SIZE) + overhead
+    assert middleware.limit_for("/api/upload/sessions/s1") == settings.MAX_FILE_SIZE + overhead
+    assert middleware.limit_for("/api/upload/sessions/s1/complete") == settings.MAX_JSON_BODY_SIZE
+    assert middleware.limit_for("/api/analyze") == settings.MAX_JSON_BODY_SIZE
+    print("✓ 上传接口使用文件或压缩包上限，其余接口使用JSON上限")
+
+
+def test_content_length():
+    """测试按Content-Length提前拒绝"""
+    print("\n测试Content-Length...")
+
+    calls = []
+
+    async def app(scope, receive, send):
+        calls.append(scope["path"])
+        await _read_body_app(scope, receive, send)
+
+    middleware = BodySizeLimitMiddleware(app)
+    limit = settings.MAX_JSON_BODY_SIZE
+
+    status, body = _call(middleware, _scope("/api/analyze", content_length=limit + 1), [b"x"])
+    assert status == 413 and str(limit) in json.loads(body)["detail"]
+
+    scope = _scope("/api/analyze")
+    scope["headers"] = [(b"content-length", b"abc")]
+    assert _call(middleware, scope, [b"x"])[0] == 400
+    assert calls == [], "超限或无效时不进入应用"
+
+    assert _call(middleware, _scope("/api/analyze", content_length=limit), [b"x"])[0] == 200
+    assert _call(middleware, _scope("/api/files", method="GET", content_length=limit * 10), [])[0] == 200
+    print("✓ Content-Length超限返回413、无效返回400，GET请求不受限制")
+
+
+def test_streamed_body():
+    """测试未声明长度的请求体在读取中超限"""
+    print("\n测试分块请求体...")
+
+    original = settings.MAX_JSON_BODY_SIZE
+    settings.MAX_JSON_BODY_SIZE = 10
+    try:
+        middleware = BodySizeLimitMiddleware(_read_body_app)
+        assert _call(middleware, _scope("/api/analyze"), [b"12345", b"12345"])[0] == 200
+
+        status, body = _call(middleware, _scope("/api/analyze"), [b"12345", b"12345", b"1"])
+        assert status == 413, "应用把读取异常转成的500被替换为413"
+        assert b"ok" not in body
+    finally:
+        settings.MAX_JSON_BODY_SIZE = original
+    print("✓ 分块读取累计超限时返回413，应用的响应被丢弃")
@@ -0,0 +1,121 @@
+"""
+书目元数据测试，验证ISBN/DOI识别和校验、外部服务查询结果的解析（默认关闭）、
+文件名模板中的文档级占位符，以及课程读本封面列出的来源著作
+"""
+
+import asyncio
+import io
+
+import httpx
+
+from src.api import routes
+from src.core.config import settings
+from src.models.schemas import CoursePackRequest, CoursePackItem
+from src.services import metadata_service as metadata_module
+from src.services.coursepack_service import CoursePackService
+from src.services.metadata_service import find_identifiers, metadata_service, normalize_isbn
+from src.services.pdf_splitter import fill_document_fields, validate_filename_template
+
+ISBN_RESPONSE = {
+    "ISBN:9780262035613": {"details": {"title": "Deep Learning", "authors": [{"name": "Ian Goodfellow"}], "edition_name": "1st ed."}}
+}
+DOI_RESPONSE = {
+    "message": {"title": ["Attention Is All You Need"], "author": [{"given": "Ashish", "family": "Vaswani"}]}
+}
+
+
+def _mock_client(requests: list):
+    """记录请求并按地址返回Open Library或Crossref格式的响应"""
+    def handler(request: httpx.Request) -> httpx.Response:
+        requests.append(str(request.url))
+        if "openlibrary" in request.url.host:
+            return httpx.Response(200, json=ISBN_RESPONSE)
+        if request.url.path.endswith("missing"):
+            return httpx.Response(404)
+        return httpx.Response(200, json=DOI_RESPONSE)
+
+    return lambda **kwargs: httpx.AsyncClient(transport=httpx.MockTransport(handler), **kwargs)
+
+
+def test_identifiers():
+    """测试ISBN和DOI识别"""
+    print("测试标识符识别...")
+
+    assert normalize_isbn("978-0-262-03561-3") == "9780262035613"
+    assert normalize_isbn("0-262-03561-8") == "0262035618"
+    assert normalize_isbn("978-0-262-03561-4") is None
+    assert find_identifiers("Copyright 2016\nISBN: 978-0-262-03561-3 (hardcover)") == ("9780262035613", None)
+    # ISBN-10后紧跟年份，校验位错误的号码被跳过
+    assert find_identifiers("ISBN 978-0-262-03561-4\nISBN-10 0262035618 2016") == ("0262035618", None)
+    assert find_identifiers("印刷号 9780262035613") == ("9780262035613", None)
+    assert find_identifiers("https://doi.org/10.48550/arXiv.1706.03762.") == (None, "10.48550/arXiv.1706.03762")
+    assert find_identifiers("共 320 页 定价 59.00 元") == (None, None)
+    print("✓ 识别带前缀和不带前缀的ISBN并校验，DOI去掉末尾标点")
+
+
+def test_lookup():
+    """测试外部书目查询"""
+    print("\n测试书目查询...")
+
+    original_client = metadata_module.httpx.AsyncClient
+    original_enabled = settings.METADATA_LOOKUP_ENABLED
+    requests = []
+    metadata_module.httpx.AsyncClient = _mock_client(requests)
+    try:
+        async def run():
+            settings.METADATA_LOOKUP_ENABLED = False
+            assert await metadata_service.lookup("9780262035613", None) is None
+            assert not requests
+
+            settings.METADATA_LOOKUP_ENABLED = True
+            book = await metadata_service.lookup("9780262035613", "10.1/x")
+            assert (book.title, book.author, book.edition) == ("Deep Learning", "Ian Goodfellow", "1st ed.")
+            assert len(requests) == 1 and "ISBN:9780262035613" in requests[0]
+
+            paper = await metadata_service.lookup(None, "10.48550/arXiv.1706.03762")
+            assert (paper.title, paper.author, paper.edition) == ("Attention Is All You Need", "Ashish Vaswani", None)
+            assert await metadata_service.lookup(None, "10.1/missing") is None
+
+        asyncio.run(run())
+    finally:
+        metadata_module.httpx.AsyncClient = original_client
+        settings.METADATA_LOOKUP_ENABLED = original_enabled
+    print("✓ 默认不发送请求，启用后优先按ISBN查询，查询失败时忽略")
+
+
+def test_upload_and_outputs(pdf_bytes, tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试上传后的元数据、文件名模板和读本封面"""
+    print("\n测试上传和输出...")
+
+    monkeypatch.setattr(settings, "DEDUP_UPLOADS", False)
+    monkeypatch.setattr(settings, "METADATA_LOOKUP_ENABLED", True)
+    monkeypatch.setattr(metadata_module.httpx, "AsyncClient", _mock_client([]))
+
+    async def run():
+        service = routes.file_service
+        book = await service._save_pdf_stream(
+            io.BytesIO(pdf_bytes("DL", "ISBN 978-0-262-03561-3")), "scan_0042.pdf"
+        )
+        assert (book.isbn, book.doi, book.edition) == ("9780262035613", None, "1st ed.")
+        assert book.display_name == "Deep Learning – Ian Goodfellow"
+        summary = routes._file_summary(book)
+        assert summary.isbn == "9780262035613" and summary.edition == "1st ed."
+
+        plain = await service._save_pdf_stream(io.BytesIO(pdf_bytes("x")), "notes.pdf")
+        request = CoursePackRequest(
+            title="读本",
+            items=[CoursePackItem(file_id=book.file_id), CoursePackItem(file_id=plain.file_id), CoursePackItem(file_id=book.file_id)]
+        )
+        parts = await routes._coursepack_parts(request)
+        source = "Deep Learning – Ian Goodfellow (1st ed.)"
+        assert [part.source for part in parts] == [source, None, source]
+        assert CoursePackService._sources_line(parts) == "选自：Deep Learning – Ian Goodfellow (1st ed.)"
+
+    asyncio.run(run())
+
+    template = "{book}_{index:02d}_{title} {{draft}}"
+    validate_filename_template(template)
+    filled = fill_document_fields(template, {"book": "Deep {Learning}", "author": "", "edition": ""})
+    assert filled == "Deep {{Learning}}_{index:02d}_{title} {{draft}}"
+    assert filled.format(index=3, title="CNN") == "Deep {Learning}_03_CNN {draft}"
+    print("✓ 上传时记录ISBN和规范书目信息，文件名模板填入书名，读本封面列出来源著作")
@@ -0,0 +1,92 @@
+"""
+按书签层级拆分测试，验证在不超过max_depth层的每个书签处生成章节，以及与下级书签同页开始的上级书签的处理
+"""
+
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.core.diagnostics import collect_warnings
+from src.models.schemas import SplitRequest, SplitStrategy
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _make_standard(path: Path) -> None:
+    """部分 > 节 > 条款三级书签，第一部分有单独的说明页，第二部分与其第一节同页开始"""
+    doc = fitz.open()
+    for i in range(10):
+        doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+    doc.set_toc([
+        [1, "Part 1", 1],
+        [2, "Section 1.1", 2],
+        [3, "Clause 1.1.1", 2],
+        [3, "Clause 1.1.2", 3],
+        [2, "Section 1.2", 4],
+        [1, "Part 2", 6],
+        [2, "Section 2.1", 6],
+        [3, "Clause 2.1.1", 7],
+        [2, "Section 2.2", 9],
+    ])
+    doc.save(str(path))
+    doc.close()
+
+
+def _ranges(chapters):
+    return [(c.title, c.start_page, c.end_page) for c in chapters]
+
+
+def test_depths():
+    """测试不同层级的拆分点"""
+    print("测试按书签层级拆分...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "standard.pdf"
+        _make_standard(path)
+
+        assert _ranges(analyzer.chapters_from_bookmarks(str(path), 1)) == [
+            ("Part 1", 1, 5), ("Part 2", 6, 10)
+        ]
+
+        with collect_warnings() as warnings:
+            sections = analyzer.chapters_from_bookmarks(str(path), 2)
+        assert _ranges(sections) == [
+            ("Part 1", 1, 1),
+            ("Section 1.1", 2, 3),
+            ("Section 1.2", 4, 5),
+            ("Section 2.1", 6, 8),
+            ("Section 2.2", 9, 10),
+        ]
+        assert warnings == []
+
+        clauses = analyzer.chapters_from_bookmarks(str(path), 3)
+        assert [c.title for c in clauses] == [
+            "Part 1", "Clause 1.1.1", "Clause 1.1.2", "Section 1.2", "Section 2.1", "Clause 2.1.1", "Section 2.2"
+        ]
+        assert _ranges(clauses)[4:6] == [("Section 2.1", 6, 6), ("Clause 2.1.1", 7, 8)]
+    print("✓ 每个不超过max_depth层的书签都是拆分点，与下级同页开始的上级书签由下级拆分")
+
+
+def test_no_bookmarks():
+    """测试没有书签的文件"""
+    print("\n测试没有书签...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "plain.pdf"
+        doc = fitz.open()
+        doc.new_page()
+        doc.save(str(path))
+        doc.close()
+        assert PDFAnalyzer().chapters_from_bookmarks(str(path), 2) == []
+    print("✓ 没有书签时返回空列表")
+
+
+def test_request_defaults():
+    """测试按书签拆分时不需要提交章节"""
+    print("\n测试请求参数...")
+
+    request = SplitRequest(file_id="f", strategy="bookmarks", max_depth=2)
+    assert request.strategy == SplitStrategy.BOOKMARKS and request.chapters == []
+    assert SplitRequest(file_id="f").strategy == SplitStrategy.MANUAL
+    print("✓ strategy默认为manual，bookmarks时chapters可省略")
@@ -0,0 +1,84 @@
+"""
+带书签的原文件副本测试，验证副本的书签与章节结构一致、原有书签被替换，以及涂黑同样应用于副本
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo, RedactionSpec, SectionInfo
+from src.services.pdf_splitter import BOOKMARKED_COPY_FILENAME, MANIFEST_FILENAME, PDFSplitter
+
+
+def _make_pdf(path: Path) -> None:
+    doc = fitz.open()
+    for i in range(6):
+        doc.new_page().insert_text((72, 72), f"Page {i + 1} secret")
+    doc.set_toc([[1, "Old outline", 1]])
+    doc.save(str(path))
+    doc.close()
+
+
+def test_bookmarked_copy():
+    """测试按（人工编辑的）章节结构重建书签"""
+    print("测试带书签的副本...")
+
+    chapters = [
+        ChapterInfo(title="第2章", start_page=4, end_page=6, page_count=3),
+        ChapterInfo(
+            title="第1章",
+            start_page=1,
+            end_page=3,
+            page_count=3,
+            sections=[
+                SectionInfo(title="1.1 概述", start_page=2, end_page=2, page_count=1),
+                SectionInfo(title="超出章节的节", start_page=5, end_page=5, page_count=1),
+            ]
+        ),
+    ]
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        _make_pdf(source)
+        output_dir = Path(tmp) / "out"
+
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), bookmarked_copy=True))
+        assert links[-1] == BOOKMARKED_COPY_FILENAME
+
+        with fitz.open(str(output_dir / BOOKMARKED_COPY_FILENAME)) as copy:
+            assert copy.page_count == 6
+            assert copy.get_toc() == [[1, "第1章", 1], [2, "1.1 概述", 2], [1, "第2章", 4]]
+
+        manifest = json.loads((output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+        entry = manifest["files"][-1]
+        assert entry["filename"] == BOOKMARKED_COPY_FILENAME and entry["pages"] == 6
+
+        # 未开启时不输出副本
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(Path(tmp) / "plain")))
+        assert BOOKMARKED_COPY_FILENAME not in links
+    print("✓ 原有书签被替换为章节和节的书签树")
+
+
+def test_redactions_applied():
+    """测试涂黑规则同样应用于副本"""
+    print("\n测试副本涂黑...")
+
+    chapters = [ChapterInfo(title="全文", start_page=1, end_page=6, page_count=6)]
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        _make_pdf(source)
+        output_dir = Path(tmp) / "out"
+        asyncio.run(PDFSplitter().split_pdf(
+            str(source),
+            chapters,
+            str(output_dir),
+            redactions=[RedactionSpec(pattern="secret")],
+            bookmarked_copy=True
+        ))
+
+        with fitz.open(str(output_dir / BOOKMARKED_COPY_FILENAME)) as copy:
+            assert all("secret" not in page.get_text() for page in copy)
+    print("✓ 副本不泄露涂黑内容")
@@ -0,0 +1,88 @@
+"""
+章节边界校验和自动修正测试，验证重叠和超出总页数的边界被拒绝，auto_fix只修正不超过上限的小重叠和间隙
+"""
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _chapter(title: str, start: int, end: int) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1)
+
+
+def _ranges(chapters):
+    return [(chapter.start_page, chapter.end_page) for chapter in chapters]
+
+
+def test_find_boundary_issues():
+    """测试边界校验"""
+    print("测试章节边界校验...")
+
+    analyzer = PDFAnalyzer()
+    assert analyzer.find_boundary_issues([_chapter("一", 1, 5), _chapter("二", 6, 10)], 10) == []
+    # 间隙不影响拆分，乱序提交按起始页检查
+    assert analyzer.find_boundary_issues([_chapter("二", 8, 10), _chapter("一", 1, 5)], 10) == []
+
+    issues = analyzer.find_boundary_issues([_chapter("一", 1, 6), _chapter("二", 6, 12)], 10)
+    assert issues == ["章节 2 结束页 12 超出总页数 10", "章节 1 和 2 存在重叠"]
+    print("✓ 重叠和超出总页数的章节被报告，间隙和提交顺序不影响校验")
+
+
+def test_auto_fix_small_issues():
+    """测试修正小重叠、小间隙和超出总页数的结束页"""
+    print("\n测试自动修正边界...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [_chapter("三", 9, 14), _chapter("一", 1, 5), _chapter("二", 5, 7)]
+    fixed, adjustments = analyzer.auto_fix_boundaries(chapters, 12)
+
+    assert _ranges(fixed) == [(1, 4), (5, 8), (9, 12)]
+    assert [chapter.page_count for chapter in fixed] == [4, 4, 4]
+    assert [(a.chapter_index, a.title, a.old_value, a.new_value) for a in adjustments] == [
+        (1, "三", 14, 12), (2, "一", 5, 4), (3, "二", 7, 8),
+    ]
+    assert all(a.field == "end_page" for a in adjustments)
+    assert analyzer.find_boundary_issues(fixed, 12) == []
+
+    unchanged, none = analyzer.auto_fix_boundaries([_chapter("一", 1, 5), _chapter("二", 6, 12)], 12)
+    assert _ranges(unchanged) == [(1, 5), (6, 12)] and none == []
+    print("✓ 1页的重叠和间隙吸附到相邻章节，超出的结束页截断，修正记录原值和新值")
+
+
+def test_auto_fix_reports_submitted_index():
+    """测试乱序提交时修正记录的章节序号对应提交顺序"""
+    print("\n测试乱序提交的章节序号...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [_chapter("二", 6, 10), _chapter("三", 11, 20), _chapter("一", 1, 6)]
+    fixed, adjustments = analyzer.auto_fix_boundaries(chapters, 18)
+
+    assert _ranges(fixed) == [(1, 5), (6, 10), (11, 18)]
+    assert [(a.chapter_index, a.title) for a in adjustments] == [(2, "三"), (3, "一")]
+    for adjustment in adjustments:
+        submitted = chapters[adjustment.chapter_index - 1]
+        assert submitted.title == adjustment.title and submitted.end_page == adjustment.old_value
+    print("✓ 章节序号指向提交的章节，而不是按起始页排序后的位置")
+
+
+def test_auto_fix_limits():
+    """测试超过上限的重叠和间隙保持不变，由校验拒绝"""
+    print("\n测试自动修正上限...")
+
+    analyzer = PDFAnalyzer()
+    overlapping = [_chapter("一", 1, 8), _chapter("二", 6, 12)]
+    fixed, adjustments = analyzer.auto_fix_boundaries(overlapping, 12)
+    assert _ranges(fixed) == [(1, 8), (6, 12)] and adjustments == []
+    assert analyzer.find_boundary_issues(fixed, 12) == ["章节 1 和 2 存在重叠"]
+
+    fixed, adjustments = analyzer.auto_fix_boundaries(overlapping, 12, max_overlap=3)
+    assert _ranges(fixed) == [(1, 5), (6, 12)] and adjustments[0].reason.startswith("与下一章重叠 3 页")
+
+    gapped = [_chapter("一", 1, 4), _chapter("二", 8, 12)]
+    assert analyzer.auto_fix_boundaries(gapped, 12)[1] == []
+    assert _ranges(analyzer.auto_fix_boundaries(gapped, 12, max_gap=3)[0]) == [(1, 7), (8, 12)]
+
+    # 起始页相同的章节无法通过调整结束页修正
+    same_start = [_chapter("一", 3, 5), _chapter("二", 3, 8)]
+    assert analyzer.auto_fix_boundaries(same_start, 12, max_overlap=10)[1] == []
+    print("✓ 超过AUTO_FIX_MAX_OVERLAP和AUTO_FIX_MAX_GAP的边界保持原样，仍按边界无效拒绝")
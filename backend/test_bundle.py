@@ -0,0 +1,74 @@
+"""
+拆分打包测试，验证每章完成时追加到chapters.zip、失败时不留下半成品，以及下载时只使用与当前输出一致的打包
+"""
+
+import asyncio
+import os
+import tempfile
+import zipfile
+from pathlib import Path
+
+from src.core.tenancy import file_storage_dir
+from src.models.schemas import ChapterInfo
+from src.services.file_service import FileService
+from src.services.pdf_splitter import BUNDLE_FILENAME, MANIFEST_FILENAME, PDFSplitter
+
+
+FILE_ID = "00000000-0000-4000-8000-000000000001"
+
+def _chapters():
+    return [
+        ChapterInfo(title="第1章", start_page=1, end_page=2, page_count=2),
+        ChapterInfo(title="第2章", start_page=3, end_page=4, page_count=2),
+    ]
+
+
+def test_bundle_split(make_pdf):
+    """测试拆分时生成打包"""
+    print("测试拆分打包...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        make_pdf(source, 4)
+        output_dir = Path(tmp) / "chapters"
+
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), _chapters(), str(output_dir), bundle=True))
+        bundle = output_dir / BUNDLE_FILENAME
+        with zipfile.ZipFile(bundle) as archive:
+            assert archive.namelist() == links + [MANIFEST_FILENAME]
+            assert archive.read(links[0]) == (output_dir / links[0]).read_bytes()
+        assert not list(output_dir.glob("*.part"))
+
+        # 不打包的再次拆分删除旧的打包
+        asyncio.run(PDFSplitter().split_pdf(str(source), _chapters(), str(output_dir)))
+        assert not bundle.exists()
+
+        # 拆分失败时不留下打包和临时文件
+        bad = [ChapterInfo(title="越界", start_page=3, end_page=9, page_count=7)]
+        try:
+            asyncio.run(PDFSplitter().split_pdf(str(source), bad, str(output_dir), bundle=True))
+        except Exception:
+            pass
+        assert not bundle.exists() and not list(output_dir.glob("*.part"))
+    print("✓ 打包包含所有章节和校验清单，失败或不打包时不保留")
+
+
+def test_bundle_path(tmp_upload_dir):
+    """测试下载时打包与输出是否一致"""
+    print("\n测试打包路径...")
+
+    file_service = FileService()
+    chapters_dir = file_storage_dir(FILE_ID) / "chapters"
+    chapters_dir.mkdir(parents=True)
+    manifest = chapters_dir / MANIFEST_FILENAME
+    bundle = chapters_dir / BUNDLE_FILENAME
+
+    assert asyncio.run(file_service.get_bundle_path(FILE_ID)) is None
+    manifest.write_text("{}", encoding="utf-8")
+    bundle.write_bytes(b"PK")
+    assert asyncio.run(file_service.get_bundle_path(FILE_ID)) == bundle
+
+    # 清单比打包新，说明之后有过未打包的拆分
+    os.utime(bundle, (1, 1))
+    assert asyncio.run(file_service.get_bundle_path(FILE_ID)) is None
+    print("✓ 只有晚于校验清单的打包才会被直接下载")
@@ -0,0 +1,57 @@
+"""
+印刷页码校准接口测试，验证偏移量按校准点计算并保存到文件元数据、重新校准覆盖旧值，以及超出总页数和不存在的文件被拒绝
+"""
+
+import asyncio
+import io
+
+from fastapi import HTTPException
+
+from src.api import routes
+from src.models.schemas import CalibrationRequest
+
+
+def test_calibrate(pdf_bytes, tmp_upload_dir, tmp_temp_dir):
+    """测试校准并保存偏移量"""
+    print("测试校准印刷页码...")
+
+    async def run():
+        service = routes.file_service
+        info = await service._save_pdf_stream(io.BytesIO(pdf_bytes(pages=12)), "book.pdf")
+        assert info.page_offset is None
+
+        result = await routes.calibrate_page_offset(info.file_id, CalibrationRequest(printed_page=1, physical_page=3))
+        assert result.page_offset == 2 and result.file_id == info.file_id
+        assert (await service.get_file_info(info.file_id)).page_offset == 2
+
+        # 重新校准覆盖旧值，印刷页码大于物理页码时偏移量为负
+        result = await routes.calibrate_page_offset(info.file_id, CalibrationRequest(printed_page=10, physical_page=8))
+        assert result.page_offset == -2
+        assert (await service.get_file_info(info.file_id)).page_offset == -2
+
+        for file_id, request, status in (
+            (info.file_id, CalibrationRequest(printed_page=1, physical_page=13), 400),
+            ("00000000-0000-4000-8000-000000000000", CalibrationRequest(printed_page=1, physical_page=1), 404),
+        ):
+            try:
+                await routes.calibrate_page_offset(file_id, request)
+                assert False, f"应返回{status}"
+            except HTTPException as e:
+                assert e.status_code == status
+        assert (await service.get_file_info(info.file_id)).page_offset == -2, "被拒绝的校准不修改偏移量"
+
+    asyncio.run(run())
+    print("✓ 偏移量 = 物理页 - 印刷页并保存到文件元数据，无效的校准被拒绝且不影响已有偏移量")
+
+
+def test_physical_page_must_be_positive():
+    """测试物理页码从1开始"""
+    print("\n测试校准请求校验...")
+
+    try:
+        CalibrationRequest(printed_page=1, physical_page=0)
+        assert False, "物理页码必须从1开始"
+    except ValueError:
+        pass
+    assert CalibrationRequest(printed_page=-3, physical_page=1).printed_page == -3
+    print("✓ 物理页码必须大于0，印刷页码可以为任意整数")
@@ -0,0 +1,111 @@
+"""
+章节输出下载测试，验证拆分时写入的校验清单、流式生成的ZIP和tar.gz的内容、批量打包的目录前缀，以及拒绝不是纯文件名的章节名
+"""
+
+import asyncio
+import hashlib
+import io
+import json
+import tarfile
+import zipfile
+from uuid import uuid4
+
+from src.core.tenancy import file_storage_dir
+from src.models.schemas import ArchiveFormat, ChapterInfo
+from src.services.archive_service import archive_service
+from src.services.file_service import FileService
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter
+
+
+CHAPTERS = [
+    ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2),
+    ChapterInfo(title="第二章", start_page=3, end_page=4, page_count=2),
+]
+
+
+def _split(make_pdf) -> tuple:
+    """在上传目录中生成原文件并拆分，返回文件ID、章节目录和章节文件名"""
+    file_id = str(uuid4())
+    file_dir = file_storage_dir(file_id)
+    file_dir.mkdir(parents=True)
+    source = make_pdf(file_dir / "original.pdf", 4)
+    chapters_dir = file_dir / "chapters"
+    links = asyncio.run(PDFSplitter().split_pdf(str(source), CHAPTERS, str(chapters_dir)))
+    return file_id, chapters_dir, links
+
+
+def test_manifest(tmp_upload_dir, make_pdf):
+    """测试校验清单记录每个章节文件的页码、大小和SHA-256"""
+    print("测试校验清单...")
+
+    file_id, chapters_dir, links = _split(make_pdf)
+    manifest = asyncio.run(FileService().get_manifest(file_id))
+
+    assert [entry.filename for entry in manifest.files] == links
+    for entry, chapter in zip(manifest.files, CHAPTERS):
+        data = (chapters_dir / entry.filename).read_bytes()
+        assert entry.title == chapter.title and entry.pages == 2
+        assert (entry.start_page, entry.end_page) == (chapter.start_page, chapter.end_page)
+        assert entry.size == len(data)
+        assert entry.sha256 == hashlib.sha256(data).hexdigest()
+
+    assert asyncio.run(FileService().get_manifest(str(uuid4()))) is None
+    print("✓ 校验清单与章节文件一致")
+
+
+def _stream(file_id: str, archive_format: ArchiveFormat, prefix: str = "") -> tuple:
+    """列出打包成员并流式生成压缩包，返回成员和完整数据"""
+    members = asyncio.run(FileService().list_archive_members(file_id, prefix=prefix))
+    return members, b"".join(archive_service.stream(members, archive_format))
+
+
+def test_zip_archive(tmp_upload_dir, make_pdf):
+    """测试流式生成的ZIP包含全部章节文件和校验清单"""
+    print("\n测试ZIP打包下载...")
+
+    file_id, chapters_dir, links = _split(make_pdf)
+    members, data = _stream(file_id, ArchiveFormat.ZIP)
+    assert [arcname for _, arcname in members] == links + [MANIFEST_FILENAME]
+
+    with zipfile.ZipFile(io.BytesIO(data)) as archive:
+        assert archive.namelist() == links + [MANIFEST_FILENAME]
+        for name in links:
+            assert archive.read(name) == (chapters_dir / name).read_bytes()
+        manifest = json.loads(archive.read(MANIFEST_FILENAME))
+        assert [entry["filename"] for entry in manifest["files"]] == links
+
+    assert asyncio.run(FileService().list_archive_members(str(uuid4()))) == []
+    print("✓ ZIP包含全部章节文件和manifest.json")
+
+
+def test_tar_gz_archive(tmp_upload_dir, make_pdf):
+    """测试流式生成的tar.gz可以读回，批量打包时按文件分目录"""
+    print("\n测试tar.gz打包下载...")
+
+    file_id, chapters_dir, links = _split(make_pdf)
+    _, data = _stream(file_id, ArchiveFormat.TAR_GZ, prefix=f"{file_id}/")
+
+    with tarfile.open(fileobj=io.BytesIO(data), mode="r:gz") as archive:
+        names = [f"{file_id}/{name}" for name in links + [MANIFEST_FILENAME]]
+        assert archive.getnames() == names
+        for name in links:
+            member = archive.getmember(f"{file_id}/{name}")
+            content = archive.extractfile(member).read()
+            assert member.size == len(content)
+            assert content == (chapters_dir / name).read_bytes()
+        manifest = json.loads(archive.extractfile(f"{file_id}/{MANIFEST_FILENAME}").read())
+        assert [entry["filename"] for entry in manifest["files"]] == links
+    print("✓ tar.gz读回的成员名和内容与章节文件一致")
+
+
+def test_invalid_chapter_name(tmp_upload_dir, make_pdf):
+    """测试只接受章节目录中的纯文件名"""
+    print("\n测试章节文件名校验...")
+
+    file_id, chapters_dir, links = _split(make_pdf)
+    service = FileService()
+
+    assert asyncio.run(service.get_download_path(file_id, links[0])) == str(chapters_dir / links[0])
+    for name in ["../original.pdf", f"../chapters/{links[0]}", f"sub/{links[0]}", "missing.pdf"]:
+        assert asyncio.run(service.get_download_path(file_id, name)) is None, name
+    print("✓ 包含路径的章节名和不存在的文件被拒绝")
@@ -0,0 +1,98 @@
+"""
+章节结构对比测试，验证人工编辑的保存、建议差异和两个版本间的章节匹配
+"""
+
+import asyncio
+
+from src.core.tenancy import use_tenant
+from src.models.schemas import ChapterInfo, SavedChapters
+from src.services.chapter_diff import compare_editions, diff_chapters
+from src.services.file_service import FileService
+
+
+def _chapter(title: str, start: int, end: int) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1)
+
+
+def test_diff_chapters():
+    """测试按页码范围、标题和起始页配对"""
+    print("测试章节差异...")
+
+    edits = SavedChapters(file_id="f-1", chapters=[
+        _chapter("前言", 1, 4),
+        _chapter("第一章 绪论", 5, 20),
+        _chapter("第二章 方法", 21, 40),
+        _chapter("附录（人工添加）", 41, 50),
+    ])
+    suggestions = [
+        _chapter("前言", 1, 4),
+        _chapter("第一章  绪论", 5, 18),
+        _chapter("第1.5章 背景", 19, 20),
+        _chapter("第二章 研究方法", 21, 40),
+        _chapter("参考文献", 41, 48),
+    ]
+
+    diff = diff_chapters(edits, suggestions)
+    assert diff.unchanged == 1
+    assert [(c.saved_index, c.suggested_index) for c in diff.renames] == [(3, 4)]
+    assert [(c.saved_index, c.suggested_index) for c in diff.moves] == [(2, 2), (4, 5)]
+    assert diff.moves[0].suggested.end_page == 18
+    assert [c.suggested.title for c in diff.adds] == ["第1.5章 背景"]
+    assert diff.removes == []
+
+    diff = diff_chapters(edits, suggestions[:1])
+    assert [c.saved_index for c in diff.removes] == [2, 3, 4]
+    assert all(c.type == "remove" and c.suggested is None for c in diff.removes)
+    print("✓ 识别新增、移动、删除和改名")
+
+
+def test_compare_editions():
+    """测试新旧版本的标题模糊匹配和页数变化"""
+    print("\n测试版本对比...")
+
+    base = [
+        _chapter("Preface", 1, 4),
+        _chapter("Chapter 1 Introduction", 5, 20),
+        _chapter("Chapter 2 Methods", 21, 40),
+        _chapter("Chapter 3 Legacy Tools", 41, 50),
+    ]
+    target = [
+        _chapter("preface", 1, 6),
+        _chapter("Chapter 1 Introduction to the Field", 7, 25),
+        _chapter("Chapter 2 Methods", 26, 45),
+        _chapter("Chapter 3 Machine Learning", 46, 70),
+    ]
+
+    result = compare_editions("old", base, "new", target)
+    assert [(m.base_index, m.target_index) for m in result.matched] == [(1, 1), (3, 3)]
+    assert result.matched[0].page_delta == 2 and result.matched[1].page_delta == 0
+    assert [(m.base_index, m.target_index) for m in result.renamed] == [(2, 2)]
+    assert 0.6 <= result.renamed[0].similarity < 1 and result.renamed[0].page_delta == 3
+    assert [m.base.title for m in result.removed] == ["Chapter 3 Legacy Tools"]
+    assert [m.target.title for m in result.added] == ["Chapter 3 Machine Learning"]
+
+    strict = compare_editions("old", base, "new", target, similarity_threshold=1.0)
+    assert strict.renamed == [] and len(strict.added) == 2
+    print("✓ 按标题模糊匹配章节并给出页数变化")
+
+
+def test_save_chapter_edits(tmp_upload_dir):
+    """测试人工编辑按租户保存，随文件删除"""
+    print("\n测试保存人工编辑...")
+
+    file_service = FileService()
+
+    async def run():
+        assert await file_service.get_chapter_edits("f-1") is None
+        saved = await file_service.save_chapter_edits("f-1", [_chapter("第一章", 1, 10)])
+        loaded = await file_service.get_chapter_edits("f-1")
+        assert loaded.chapters[0].title == "第一章" and loaded.updated_at == saved.updated_at
+
+        with use_tenant("acme"):
+            assert await file_service.get_chapter_edits("f-1") is None
+
+        assert await file_service.delete_file("f-1") is True
+        assert await file_service.get_chapter_edits("f-1") is None
+
+    asyncio.run(run())
+    print("✓ 人工编辑按租户隔离，删除文件时一并清除")
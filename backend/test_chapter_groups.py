@@ -0,0 +1,84 @@
+"""
+章节分组输出测试，验证连续章节合并为一个输出文件、文件内保留成员章节和节的书签树，以及分组范围校验
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterGroup, ChapterInfo, SectionInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+from src.services.pdf_splitter import BOOKMARKED_COPY_FILENAME, PDFSplitter
+
+
+def _chapter(title: str, start: int, end: int, **kwargs) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1, **kwargs)
+
+
+def _chapters():
+    return [
+        _chapter("前言", 1, 1),
+        _chapter("第1章", 2, 3, sections=[SectionInfo(title="1.1 概述", start_page=3, end_page=3, page_count=1)]),
+        _chapter("第2章", 4, 5),
+        _chapter("第3章", 6, 8, extract=False),
+        _chapter("附录", 9, 10),
+    ]
+
+
+def test_group_chapters():
+    """测试分组合并和范围校验"""
+    print("测试章节分组...")
+
+    analyzer = PDFAnalyzer()
+    grouped = analyzer.group_chapters(_chapters(), [ChapterGroup(title="第一部分", first=2, last=4)])
+    assert [(c.title, c.start_page, c.end_page) for c in grouped] == [
+        ("前言", 1, 1), ("第一部分", 2, 8), ("附录", 9, 10)
+    ]
+    assert [m.title for m in grouped[1].members] == ["第1章", "第2章", "第3章"]
+    assert grouped[1].extract
+
+    for groups, message in [
+        ([ChapterGroup(title="A", first=3, last=2)], "无效"),
+        ([ChapterGroup(title="A", first=4, last=6)], "无效"),
+        ([ChapterGroup(title="A", first=1, last=2), ChapterGroup(title="B", first=2, last=3)], "相同的章节 2"),
+    ]:
+        try:
+            analyzer.group_chapters(_chapters(), groups)
+            assert False, "应拒绝无效分组"
+        except ValueError as e:
+            assert message in str(e)
+    print("✓ 连续章节合并为一个章节，无效或重叠的分组返回错误")
+
+
+def test_grouped_output():
+    """测试分组输出文件内的书签树和带书签副本中的层级"""
+    print("\n测试分组输出书签...")
+
+    chapters = PDFAnalyzer().group_chapters(_chapters(), [ChapterGroup(title="第一部分", first=2, last=4)])
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        doc = fitz.open()
+        for i in range(10):
+            doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+        doc.save(str(source))
+        doc.close()
+
+        output_dir = Path(tmp) / "out"
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), bookmarked_copy=True))
+        assert len(links) == 4
+
+        with fitz.open(str(output_dir / links[1])) as part:
+            assert part.page_count == 7
+            assert part.get_toc() == [[1, "第1章", 1], [2, "1.1 概述", 2], [1, "第2章", 3], [1, "第3章", 5]]
+        with fitz.open(str(output_dir / links[0])) as single:
+            assert single.get_toc() == []
+
+        with fitz.open(str(output_dir / BOOKMARKED_COPY_FILENAME)) as copy:
+            assert copy.get_toc() == [
+                [1, "前言", 1],
+                [1, "第一部分", 2], [2, "第1章", 2], [3, "1.1 概述", 3], [2, "第2章", 4], [2, "第3章", 6],
+                [1, "附录", 9],
+            ]
+    print("✓ 分组文件内成员章节为一级书签、节为二级书签")
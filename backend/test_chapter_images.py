@@ -0,0 +1,62 @@
+"""
+章节图片提取测试，验证按章节页码范围提取、去重、忽略小图和打包
+"""
+
+import io
+import json
+import tempfile
+import zipfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.archive_service import archive_service
+from src.services.image_extractor import IMAGES_INDEX_FILENAME, image_extractor
+
+
+def _png(width: int, height: int, color) -> bytes:
+    pixmap = fitz.Pixmap(fitz.csRGB, fitz.IRect(0, 0, width, height), False)
+    pixmap.set_rect(pixmap.irect, color)
+    return pixmap.tobytes("png")
+
+
+def _build_pdf(path: Path) -> None:
+    figure = _png(120, 80, (200, 30, 30))
+    chart = _png(64, 64, (30, 30, 200))
+    icon = _png(8, 8, (0, 0, 0))
+
+    doc = fitz.open()
+    for _ in range(4):
+        doc.new_page()
+    doc[0].insert_image(fitz.Rect(50, 50, 170, 130), stream=figure)
+    doc[0].insert_image(fitz.Rect(10, 10, 18, 18), stream=icon)
+    # 同一张图片在第2页再次嵌入（不同对象，内容相同）
+    doc[1].insert_image(fitz.Rect(50, 50, 170, 130), stream=figure)
+    doc[1].insert_image(fitz.Rect(200, 200, 264, 264), stream=chart)
+    doc[3].insert_image(fitz.Rect(50, 50, 114, 114), stream=chart)
+    doc.save(str(path))
+    doc.close()
+
+
+def test_extract_chapter_images():
+    """测试章节范围、去重、页码引用和小图过滤"""
+    print("测试章节图片提取...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        _build_pdf(source)
+
+        chapter = ChapterInfo(title="第1章", start_page=1, end_page=3, page_count=3)
+        images, entries = image_extractor.extract(str(source), chapter)
+
+        assert len(images) == 2
+        assert images[0].pages == [1, 2] and (images[0].width, images[0].height) == (120, 80)
+        assert images[1].pages == [2]
+        assert [name for name, _ in entries] == [images[0].filename, images[1].filename, IMAGES_INDEX_FILENAME]
+
+        archive = zipfile.ZipFile(io.BytesIO(b"".join(archive_service.stream_entries(entries))))
+        index = json.loads(archive.read(IMAGES_INDEX_FILENAME))
+        assert [item["filename"] for item in index] == [image.filename for image in images]
+        assert len(archive.read(images[0].filename)) == images[0].size
+    print("✓ 图片按内容去重并记录页码，图标被忽略")
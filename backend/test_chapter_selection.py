@@ -0,0 +1,76 @@
+"""
+选择性章节输出测试，验证按序号标记要输出的章节，以及合并短章节和非正文区域时选择标记的传递
+"""
+
+from src.models.schemas import ChapterInfo, SectionHandling, SectionType, SplitRequest
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _chapter(title: str, start: int, end: int, **kwargs) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1, **kwargs)
+
+
+def test_mark_included():
+    """测试按序号标记输出章节"""
+    print("测试按序号选择章节...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [_chapter(f"第{i}章", i * 10 - 9, i * 10) for i in range(1, 9)]
+
+    marked = analyzer.mark_included(chapters, [7, 3, 3])
+    assert [c.title for c in marked if c.extract] == ["第3章", "第7章"]
+
+    # 未传include时保留请求中逐章的extract
+    manual = chapters[:2] + [chapters[2].model_copy(update={"extract": False})]
+    assert [c.extract for c in analyzer.mark_included(manual, None)] == [True, True, False]
+
+    try:
+        analyzer.mark_included(chapters, [3, 9, 0])
+        assert False, "应拒绝超出范围的序号"
+    except ValueError as e:
+        assert "0, 9" in str(e) and "8" in str(e)
+
+    assert SplitRequest(file_id="f").include is None
+    print("✓ 只有选中的章节extract为true，越界序号返回错误")
+
+
+def test_merge_keeps_selection():
+    """测试短章节合并后仍按选择输出"""
+    print("\n测试合并时的选择标记...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [
+        _chapter("第1章", 1, 10, extract=False),
+        _chapter("插页", 11, 11, extract=True),
+        _chapter("第2章", 12, 20, extract=False),
+    ]
+    merged, merges = analyzer.merge_small_chapters(chapters, 2)
+    assert [(c.title, c.end_page, c.extract) for c in merged] == [("第1章", 11, True), ("第2章", 20, False)]
+    assert merges[0].merged_into == "第1章"
+
+    sections = [
+        _chapter("封面", 1, 1, section_type=SectionType.COVER, extract=False),
+        _chapter("第1章", 2, 10, extract=False),
+        _chapter("附录", 11, 12, section_type=SectionType.APPENDIX, extract=True),
+    ]
+    handled = analyzer.apply_section_handling(sections, SectionHandling.MERGE)
+    assert [(c.start_page, c.end_page, c.extract) for c in handled] == [(1, 12, True)]
+    print("✓ 合并后的章节只要包含选中的部分就会输出")
+
+
+def test_merge_uses_page_range():
+    """测试短章节按页码范围判断，不使用提交的page_count"""
+    print("\n测试按页码范围合并...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [
+        _chapter("第1章", 1, 10),
+        _chapter("插页", 11, 11).model_copy(update={"page_count": 50}),
+        _chapter("第2章", 12, 20).model_copy(update={"page_count": 1}),
+    ]
+    merged, merges = analyzer.merge_small_chapters(chapters, 2)
+    assert [(c.title, c.start_page, c.end_page, c.page_count) for c in merged] == [
+        ("第1章", 1, 11, 11), ("第2章", 12, 20, 9)
+    ]
+    assert [m.title for m in merges] == ["插页"]
+    print("✓ 页数按结束页减起始页计算，与提交的page_count无关")
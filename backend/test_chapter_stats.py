@@ -0,0 +1,71 @@
+"""
+章节文字统计测试，验证字数、字符数和阅读时间的计算，以及分析结果和合并短章节时的统计
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+from src.services.text_stats import count_characters, count_words, reading_minutes
+
+ENGLISH = "The history of the city is closely tied to the river, and it is still the center of trade for the region. "
+
+
+def test_counts():
+    """测试中英文混排的字数和字符数"""
+    print("测试字数统计...")
+
+    assert count_words("拆分 PDF 章节，it's well-formed") == 7
+    assert count_characters("a b\n c\t中") == 4
+    assert count_words("") == 0 and count_characters("  \n") == 0
+    print("✓ 中文按字计、英文按单词计，字符数不含空白")
+
+
+def test_reading_minutes():
+    """测试按语言估算阅读时间"""
+    print("\n测试阅读时间...")
+
+    assert reading_minutes(0) == 0
+    assert reading_minutes(10) == 1
+    assert reading_minutes(460, "en") == 2
+    assert reading_minutes(600, "zh") == 2
+    assert reading_minutes(600) == 3
+    print("✓ 中文按每分钟300字、默认按每分钟230词估算")
+
+
+def test_analysis_stats():
+    """测试分析结果中的章节统计和合并短章节时的累加"""
+    print("\n测试分析统计...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "book.pdf"
+        doc = fitz.open()
+        for repeat in (3, 3, 1):
+            doc.new_page().insert_textbox(fitz.Rect(72, 72, 520, 770), ENGLISH * repeat, fontsize=11)
+        doc.set_toc([[1, "Chapter 1", 1], [1, "Chapter 2", 2], [1, "Epigraph", 3]])
+        doc.save(str(path))
+        doc.close()
+
+        chapters, _ = asyncio.run(analyzer.analyze_pdf(str(path), "book", use_llm=False))
+
+    words = count_words(ENGLISH)
+    assert [c.word_count for c in chapters] == [words * 3, words * 3, words]
+    assert all(c.character_count and c.reading_minutes == 1 for c in chapters)
+
+    merged, _ = analyzer.merge_small_chapters(chapters[1:], 2)
+    assert len(merged) == 1 and merged[0].word_count == words * 4
+    assert merged[0].character_count == chapters[1].character_count + chapters[2].character_count
+
+    # 客户端提交的章节没有统计时合并后仍为空
+    manual = [
+        ChapterInfo(title="A", start_page=1, end_page=2, page_count=2),
+        ChapterInfo(title="B", start_page=3, end_page=3, page_count=1),
+    ]
+    merged, _ = analyzer.merge_small_chapters(manual, 2)
+    assert merged[0].word_count is None and merged[0].reading_minutes is None
+    print("✓ 每个章节附带统计，合并时累加")
@@ -0,0 +1,103 @@
+"""
+响应压缩测试，验证Accept-Encoding协商、JSON响应压缩以及PDF等其他响应原样透传
+"""
+
+import asyncio
+import gzip
+import json
+import zlib
+
+from src.api.middleware import CompressionMiddleware
+from src.core.config import settings
+
+
+def _scope(accept_encoding: str = "gzip") -> dict:
+    return {
+        "type": "http",
+        "method": "GET",
+        "path": "/api/test",
+        "headers": [(b"accept-encoding", accept_encoding.encode("latin-1"))]
+    }
+
+
+def _app(content_type: bytes, body: bytes, chunks: int = 1):
+    async def app(scope, receive, send):
+        await send({
+            "type": "http.response.start",
+            "status": 200,
+            "headers": [(b"content-type", content_type), (b"content-length", str(len(body)).encode())]
+        })
+        size = len(body) // chunks + 1
+        parts = [body[i:i + size] for i in range(0, len(body), size)]
+        for i, part in enumerate(parts):
+            await send({"type": "http.response.body", "body": part, "more_body": i < len(parts) - 1})
+    return app
+
+
+def _request(app, scope) -> tuple:
+    messages = []
+
+    async def send(message):
+        messages.append(message)
+
+    asyncio.run(CompressionMiddleware(app)(scope, None, send))
+    headers = {k.decode(): v.decode() for k, v in messages[0]["headers"]}
+    body = b"".join(m.get("body", b"") for m in messages[1:])
+    return headers, body
+
+
+def test_negotiate():
+    """测试编码协商"""
+    print("测试编码协商...")
+
+    negotiate = CompressionMiddleware.negotiate
+    assert negotiate("gzip, deflate, br") == "gzip"
+    assert negotiate("deflate") == "deflate"
+    assert negotiate("gzip;q=0.5, deflate") == "deflate"
+    assert negotiate("gzip;q=0, *") == "deflate"
+    assert negotiate("br") is None
+    assert negotiate("") is None
+    print("✓ 按权重选择gzip或deflate，不支持时不压缩")
+
+
+def test_json_compressed():
+    """测试大JSON响应被压缩，小响应不压缩"""
+    print("\n测试JSON压缩...")
+
+    payload = json.dumps({"chapters": [{"title": f"第{i}章", "text": "内容" * 50} for i in range(100)]}).encode()
+
+    headers, body = _request(_app(b"application/json", payload, chunks=3), _scope("gzip, deflate"))
+    assert headers["content-encoding"] == "gzip"
+    assert headers["vary"] == "Accept-Encoding"
+    assert int(headers["content-length"]) == len(body) < len(payload)
+    assert gzip.decompress(body) == payload
+
+    headers, body = _request(_app(b"application/json", payload), _scope("deflate"))
+    assert headers["content-encoding"] == "deflate"
+    assert zlib.decompress(body) == payload
+
+    headers, body = _request(_app(b"application/json", b'{"ok": true}'), _scope())
+    assert "content-encoding" not in headers and body == b'{"ok": true}'
+    print("✓ 超过最小大小的JSON响应按协商的编码压缩")
+
+
+def test_passthrough():
+    """测试PDF响应、未声明编码和关闭压缩时原样透传"""
+    print("\n测试原样透传...")
+
+    pdf = b"%PDF-1.7\n" + b"0" * 10000
+    headers, body = _request(_app(b"application/pdf", pdf), _scope())
+    assert "content-encoding" not in headers and body == pdf
+
+    payload = json.dumps({"text": "x" * 5000}).encode()
+    headers, body = _request(_app(b"application/json", payload), _scope(""))
+    assert "content-encoding" not in headers and body == payload
+
+    original = settings.COMPRESS_RESPONSES
+    settings.COMPRESS_RESPONSES = False
+    try:
+        headers, body = _request(_app(b"application/json", payload), _scope())
+        assert "content-encoding" not in headers and body == payload
+    finally:
+        settings.COMPRESS_RESPONSES = original
+    print("✓ 非JSON响应和未协商编码时不压缩")
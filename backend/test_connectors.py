@@ -0,0 +1,210 @@
+"""
+云盘连接器测试，验证授权state的有效期、单次使用和云盘类型校验，令牌加密保存和续期，
+以及Google Drive可续传上传分块发送文件
+"""
+
+import asyncio
+import re
+from urllib.parse import parse_qs, urlsplit
+
+import httpx
+from cryptography.fernet import Fernet
+
+from src.core.config import settings
+from src.core.crypto import decrypt_secret
+from src.core.store import get_store
+from src.core.tenancy import use_tenant
+from src.models.schemas import ConnectorProvider
+from src.services import connector_service as connector_module
+from src.services.connector_service import (
+    CONNECTOR_STATES_BUCKET,
+    CONNECTOR_TOKENS_BUCKET,
+    CONNECTORS_BUCKET,
+    Connector,
+    ConnectorService,
+    GoogleDriveConnector,
+)
+
+
+class FakeConnector(Connector):
+    """不访问网络的云盘，授权码和刷新令牌直接换出固定的令牌"""
+
+    authorize_endpoint = "https://auth.example/authorize"
+    token_endpoint = "https://auth.example/token"
+
+    def __init__(self, provider: ConnectorProvider):
+        self.provider = provider
+        self.refreshed = []
+
+    def client_credentials(self):
+        return "client-id", "client-secret"
+
+    async def exchange_code(self, code):
+        return {"access_token": f"access-{code}", "refresh_token": f"refresh-{code}", "expires_in": 3600}
+
+    async def refresh(self, refresh_token):
+        self.refreshed.append(refresh_token)
+        return {"access_token": f"access-{len(self.refreshed)}", "expires_in": 3600}
+
+
+def _service() -> ConnectorService:
+    service = ConnectorService()
+    service.connectors = {provider: FakeConnector(provider) for provider in ConnectorProvider}
+    return service
+
+
+def _with_key(monkeypatch, coro_factory):
+    """使用临时生成的加密密钥运行"""
+    monkeypatch.setattr(settings, "SECRET_ENCRYPTION_KEY", Fernet.generate_key().decode("ascii"))
+    return asyncio.run(coro_factory())
+
+
+def _state(url: str) -> str:
+    return parse_qs(urlsplit(url).query)["state"][0]
+
+
+async def _rejected(service, provider, code, state) -> bool:
+    try:
+        await service.complete_authorization(provider, code, state)
+    except ValueError:
+        return True
+    return False
+
+
+def test_state_expiry_and_reuse(tmp_upload_dir, monkeypatch):
+    """测试过期和已使用的state被拒绝"""
+    print("测试授权state...")
+
+    async def run():
+        service = _service()
+        store = get_store()
+
+        state = _state(await service.authorization_url(ConnectorProvider.DROPBOX))
+        record = await store.aget(CONNECTOR_STATES_BUCKET, state)
+        assert record["provider"] == "dropbox" and record["tenant_id"] == settings.DEFAULT_TENANT
+
+        # state保存在存储中，其他实例（副本）也能完成回调
+        status = await _service().complete_authorization(ConnectorProvider.DROPBOX, "c1", state)
+        assert status.connected
+        assert await _rejected(service, ConnectorProvider.DROPBOX, "c1", state), "state只能使用一次"
+        assert await store.aget(CONNECTOR_STATES_BUCKET, state) is None
+
+        expired = _state(await service.authorization_url(ConnectorProvider.DROPBOX))
+        await store.aput(CONNECTOR_STATES_BUCKET, expired, {**await store.aget(CONNECTOR_STATES_BUCKET, expired), "expires_at": 0})
+        assert await _rejected(service, ConnectorProvider.DROPBOX, "c2", expired)
+
+        # 发起新授权时清理过期的state
+        await store.aput(CONNECTOR_STATES_BUCKET, "stale-state-0000000000", {"state": "stale-state-0000000000", "expires_at": 0})
+        await service.authorization_url(ConnectorProvider.DROPBOX)
+        assert await store.aget(CONNECTOR_STATES_BUCKET, "stale-state-0000000000") is None
+
+        for state in ("", "../../etc/passwd", "unknown-state-000000000"):
+            assert await _rejected(service, ConnectorProvider.DROPBOX, "c3", state), state
+
+    _with_key(monkeypatch, run)
+    print("✓ state共享于各实例，只能使用一次，过期后被拒绝")
+
+
+def test_provider_mismatch(tmp_upload_dir, monkeypatch):
+    """测试回调的云盘类型必须与发起授权时一致"""
+    print("\n测试云盘类型校验...")
+
+    async def run():
+        service = _service()
+        state = _state(await service.authorization_url(ConnectorProvider.GOOGLE_DRIVE))
+        assert await _rejected(service, ConnectorProvider.DROPBOX, "c1", state)
+        # 类型不符的回调同样作废state，不能再用正确的类型重放
+        assert await _rejected(service, ConnectorProvider.GOOGLE_DRIVE, "c1", state)
+        assert [status.connected for status in await service.list_status()] == [False, False]
+
+    _with_key(monkeypatch, run)
+    print("✓ 云盘类型不符时拒绝回调并作废state")
+
+
+def test_token_encryption_round_trip(tmp_upload_dir, monkeypatch):
+    """测试令牌加密保存、按租户隔离，以及访问令牌过期后用刷新令牌续期"""
+    print("\n测试令牌加密保存...")
+
+    async def run():
+        service = _service()
+        drive = service.connectors[ConnectorProvider.GOOGLE_DRIVE]
+        store = get_store()
+
+        with use_tenant("team-a"):
+            state = _state(await service.authorization_url(ConnectorProvider.GOOGLE_DRIVE))
+        # 回调不携带租户标识，令牌保存到发起授权的租户
+        await service.complete_authorization(ConnectorProvider.GOOGLE_DRIVE, "code-1", state)
+        assert await store.aget(CONNECTORS_BUCKET, "google_drive", settings.DEFAULT_TENANT) is None
+
+        record = await store.aget(CONNECTORS_BUCKET, "google_drive", "team-a")
+        cached = await store.aget(CONNECTOR_TOKENS_BUCKET, "google_drive", "team-a")
+        assert "refresh-code-1" not in str(record) and "access-code-1" not in str(cached)
+        assert decrypt_secret(record["refresh_token"]) == "refresh-code-1"
+        assert decrypt_secret(cached["access_token"]) == "access-code-1"
+
+        with use_tenant("team-a"):
+            assert await service._access_token(ConnectorProvider.GOOGLE_DRIVE) == "access-code-1"
+            assert drive.refreshed == []
+
+            # 访问令牌过期后用解密的刷新令牌续期，新令牌同样加密缓存
+            await store.aput(CONNECTOR_TOKENS_BUCKET, "google_drive", {**cached, "expires_at": 0}, "team-a")
+            assert await service._access_token(ConnectorProvider.GOOGLE_DRIVE) == "access-1"
+            assert drive.refreshed == ["refresh-code-1"]
+            cached = await store.aget(CONNECTOR_TOKENS_BUCKET, "google_drive", "team-a")
+            assert decrypt_secret(cached["access_token"]) == "access-1"
+
+            assert await service.disconnect(ConnectorProvider.GOOGLE_DRIVE)
+            assert not await service.disconnect(ConnectorProvider.GOOGLE_DRIVE)
+            assert await store.aget(CONNECTOR_TOKENS_BUCKET, "google_drive", "team-a") is None
+            try:
+                await service._access_token(ConnectorProvider.GOOGLE_DRIVE)
+                assert False, "断开后不能再获取访问令牌"
+            except ValueError:
+                pass
+
+    _with_key(monkeypatch, run)
+    print("✓ 刷新令牌和访问令牌加密保存，续期使用解密后的刷新令牌，断开后全部删除")
+
+
+def test_drive_resumable_upload(tmp_path, monkeypatch):
+    """测试Google Drive可续传上传分块发送，并从服务端确认的位置继续"""
+    print("\n测试Google Drive可续传上传...")
+
+    received = bytearray()
+    requests = []
+    client_class = httpx.AsyncClient
+
+    def handle(request: httpx.Request) -> httpx.Response:
+        requests.append(request)
+        if request.method == "POST":
+            assert request.url.params["uploadType"] == "resumable"
+            return httpx.Response(200, headers={"Location": "https://upload.example/session-1"})
+
+        start, end, total = map(int, re.match(r"bytes (\d+)-(\d+)/(\d+)", request.headers["Content-Range"]).groups())
+        assert start == len(received) and end - start + 1 == len(request.content)
+        # 第一块只保存一部分，模拟连接中断后服务端确认的范围
+        content = request.content[:100 * 1024] if len(requests) == 2 else request.content
+        received.extend(content)
+        if len(received) < total:
+            return httpx.Response(308, headers={"Range": f"bytes=0-{len(received) - 1}"})
+        return httpx.Response(200, json={"id": "drive-file"})
+
+    def client(*args, **kwargs):
+        return client_class(transport=httpx.MockTransport(handle))
+
+    data = bytes(range(256)) * 2600
+    connector = GoogleDriveConnector()
+    connector.upload_chunk_size = 256 * 1024
+    file_path = tmp_path / "01_第一章.pdf"
+    file_path.write_bytes(data)
+    monkeypatch.setattr(connector_module.httpx, "AsyncClient", client)
+    asyncio.run(connector.upload("token", "folder-1", file_path))
+
+    assert bytes(received) == data
+    init, *chunks = requests
+    assert init.headers["X-Upload-Content-Length"] == str(len(data))
+    assert b"folder-1" in init.content and "01_".encode() in init.content
+    assert all(len(request.content) <= 256 * 1024 for request in chunks)
+    assert chunks[1].headers["Content-Range"].startswith(f"bytes {100 * 1024}-")
+    assert all(request.headers["Authorization"] == "Bearer token" for request in requests)
+    print("✓ 文件分块上传，中断的分块从服务端已保存的位置续传")
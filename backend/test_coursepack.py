@@ -0,0 +1,101 @@
+"""
+课程读本测试，验证多个文件的内容按顺序合并、封面和目录页、目录链接、书签以及分隔页
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+from types import SimpleNamespace
+
+import fitz
+
+from src.models.schemas import CoursePackItem, CoursePackRequest, SectionInfo
+from src.services.coursepack_service import CoursePackPart, CoursePackService
+
+
+def _request(**kwargs) -> CoursePackRequest:
+    return CoursePackRequest(title="Reader", items=[CoursePackItem(file_id="f")], **kwargs)
+
+
+def _parts(tmp: Path, make_pdf):
+    first, second = tmp / "a.pdf", tmp / "b.pdf"
+    make_pdf(first, 5, "A")
+    make_pdf(second, 3, "B")
+    return [
+        CoursePackPart(
+            path=str(second),
+            title="Week 1",
+            start_page=2,
+            end_page=3,
+            sections=[SectionInfo(title="Notes", start_page=3, end_page=3, page_count=1)]
+        ),
+        CoursePackPart(path=str(first), title="Week 2", start_page=4, end_page=5),
+    ]
+
+
+def test_build(make_pdf):
+    """测试封面、目录页、内容顺序和书签"""
+    print("测试生成课程读本...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        output = Path(tmp) / "pack.pdf"
+        pages = CoursePackService().build(_parts(Path(tmp), make_pdf), output, _request(subtitle="Spring"))
+        assert pages == 6
+
+        with fitz.open(str(output)) as pack:
+            texts = [page.get_text() for page in pack]
+            assert "Reader" in texts[0] and "Spring" in texts[0]
+            assert "目录" in texts[1] and "Week 1" in texts[1] and "Week 2" in texts[1]
+            assert [text.strip() for text in texts[2:]] == ["B 2", "B 3", "A 4", "A 5"]
+            assert pack.get_toc() == [[1, "Week 1", 3], [2, "Notes", 4], [1, "Week 2", 5]]
+            assert [link["page"] for link in pack[1].get_links()] == [2, 4]
+            assert pack.metadata["title"] == "Reader"
+    print("✓ 内容按请求顺序合并，目录条目链接到对应页面")
+
+
+def test_dividers_without_front(make_pdf):
+    """测试不生成封面和目录时的分隔页"""
+    print("\n测试分隔页...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        output = Path(tmp) / "pack.pdf"
+        pages = CoursePackService().build(_parts(Path(tmp), make_pdf), output, _request(cover=False, toc=False, dividers=True))
+        assert pages == 6
+
+        with fitz.open(str(output)) as pack:
+            assert [page.get_text().strip() for page in pack] == ["Week 1", "B 2", "B 3", "Week 2", "A 4", "A 5"]
+            assert pack.get_toc() == [[1, "Week 1", 1], [2, "Notes", 3], [1, "Week 2", 4]]
+    print("✓ 每项内容前插入分隔页，书签指向分隔页")
+
+
+def test_invalid_range(make_pdf):
+    """测试超出源文件页数的范围"""
+    print("\n测试页范围校验...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        parts = _parts(Path(tmp), make_pdf)
+        parts[1].end_page = 9
+        try:
+            CoursePackService().build(parts, Path(tmp) / "pack.pdf", _request())
+            assert False, "应拒绝超出页数的范围"
+        except ValueError as e:
+            assert "Week 2" in str(e) and "超出文件页数 5" in str(e)
+    print("✓ 超出页数时返回错误")
+
+
+def test_create_saves_file(make_pdf, tmp_temp_dir):
+    """测试读本保存为新文件"""
+    print("\n测试保存读本...")
+
+    class FakeFileService:
+        saved = None
+
+        async def save_pdf_stream(self, stream, filename):
+            FakeFileService.saved = (filename, stream.read()[:5])
+            return SimpleNamespace(file_id="pack")
+
+    result = asyncio.run(CoursePackService().create(_parts(tmp_temp_dir, make_pdf), _request(), FakeFileService()))
+
+    assert result[0].file_id == "pack" and result[1] == 6
+    assert FakeFileService.saved == ("Reader.pdf", b"%PDF-")
+    print("✓ 以读本标题为文件名保存")
@@ -0,0 +1,73 @@
+"""
+重复上传检测测试，验证内容相同的上传返回已有文件（包括已修复的文件），以及最近分析结果的读取
+"""
+
+import asyncio
+import io
+import time
+
+from src.core.config import settings
+from src.services.analysis_cache import analysis_cache
+from src.services.file_service import FileService
+
+
+def test_duplicate_upload(pdf_bytes, tmp_upload_dir, monkeypatch):
+    """测试相同内容返回已有文件，不同内容或关闭去重时保存新文件"""
+    print("测试重复上传检测...")
+
+    file_service = FileService()
+
+    async def run():
+        first = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Page")), "book.pdf")
+        assert first.deduplicated is False
+        assert "deduplicated" not in first.model_dump()
+
+        again = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Page")), "book-copy.pdf")
+        assert again.deduplicated is True
+        assert again.file_id == first.file_id
+        assert again.filename == "book.pdf"
+        assert len([p for p in tmp_upload_dir.iterdir() if p.is_dir()]) == 1
+
+        other = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Other")), "other.pdf")
+        assert other.file_id != first.file_id
+
+        monkeypatch.setattr(settings, "DEDUP_UPLOADS", False)
+        copy = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Page")), "book.pdf")
+        assert copy.file_id != first.file_id and not copy.deduplicated
+
+    asyncio.run(run())
+    print("✓ 相同内容返回已有文件，不同内容或关闭去重时保存新文件")
+
+
+def test_duplicate_of_repaired_file(tmp_upload_dir, pdf_bytes):
+    """测试已修复文件按上传内容的哈希匹配"""
+    print("\n测试已修复文件的重复上传...")
+
+    file_service = FileService()
+    data = pdf_bytes("Page")
+    damaged = data[:data.rindex(b"startxref")] + b"startxref\n999999\n%%EOF\n"
+
+    async def run():
+        first = await file_service.save_pdf_stream(io.BytesIO(damaged), "broken.pdf")
+        assert first.repaired and first.file_hash != first.original_hash
+
+        again = await file_service.save_pdf_stream(io.BytesIO(damaged), "broken.pdf")
+        assert again.deduplicated and again.file_id == first.file_id
+
+    asyncio.run(run())
+    print("✓ 修复后仍能识别相同的上传内容")
+
+
+def test_latest_analysis(tmp_upload_dir):
+    """测试读取最近一次写入的分析结果"""
+    print("\n测试读取最近分析结果...")
+
+    try:
+        assert analysis_cache.latest("file-1") is None
+        analysis_cache.set("file-1", "older", {"file_id": "file-1", "version": 1})
+        time.sleep(0.01)
+        analysis_cache.set("file-1", "newer", {"file_id": "file-1", "version": 2})
+        assert analysis_cache.latest("file-1")["version"] == 2
+    finally:
+        analysis_cache.invalidate("file-1")
+    print("✓ 返回最近写入的分析结果")
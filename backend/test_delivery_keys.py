@@ -0,0 +1,151 @@
+"""
+S3投递对象键模板测试，验证路径片段转换、模板校验、按书和章节生成的对象键，
+以及清单等其他文件放在章节目录中
+"""
+
+from datetime import datetime
+
+from src.core.config import settings
+from src.core.tenancy import use_tenant
+from src.models.schemas import DeliveryConfig, DeliveryType, FileInfo, ManifestEntry, OutputManifest
+from src.services.delivery_service import S3Target, delivery_service, slugify
+
+TEMPLATE = "books/{title_slug}/{chapter_index:02d}_{chapter_slug}.pdf"
+
+
+def _config(key_template: str = TEMPLATE, type: DeliveryType = DeliveryType.S3) -> DeliveryConfig:
+    return DeliveryConfig(type=type, target="bucket", path="/exports/", credentials_ref="test", key_template=key_template)
+
+
+def _entry(filename: str, title: str) -> ManifestEntry:
+    return ManifestEntry(filename=filename, title=title, start_page=1, end_page=2, pages=2, size=1, sha256="0" * 64)
+
+
+def test_slugify():
+    """测试路径片段转换"""
+    print("测试路径片段...")
+
+    assert slugify("Deep Learning: Foundations & Concepts") == "deep-learning-foundations-concepts"
+    assert slugify("第1章 绪论") == "第1章-绪论"
+    assert slugify("  ?? ") == "untitled" and slugify("", fallback="unknown") == "unknown"
+    print("✓ 小写，标点和空白合并为连字符，保留中文")
+
+
+def test_validate():
+    """测试模板校验"""
+    print("\n测试模板校验...")
+
+    original = settings.DELIVERY_CREDENTIALS
+    settings.DELIVERY_CREDENTIALS = {"test": {"target": "bucket", "known_hosts": "/dev/null"}}
+    try:
+        delivery_service.validate(_config())
+        cases = [
+            (_config(type=DeliveryType.SFTP), "只适用于S3"),
+            (_config("books/{book}/{filename}"), "可用占位符"),
+            (_config("/books/{filename}"), "键无效"),
+            (_config("books/../{filename}"), "键无效"),
+            (_config("books/{title_slug}/"), "键无效"),
+        ]
+        for config, message in cases:
+            try:
+                delivery_service.validate(config)
+                assert False, f"应拒绝: {config.key_template}"
+            except ValueError as e:
+                assert message in str(e), str(e)
+    finally:
+        settings.DELIVERY_CREDENTIALS = original
+    print("✓ 拒绝非S3目标、未知占位符和生成绝对路径、.. 或空文件名的模板")
+
+
+def test_credential_binding():
+    """测试凭据绑定的投递目标"""
+    print("\n测试凭据绑定...")
+
+    original = settings.DELIVERY_CREDENTIALS, settings.DELIVERY_KNOWN_HOSTS
+    settings.DELIVERY_CREDENTIALS = {
+        "s3": {"target": "exports"},
+        "sftp": {"target": "sftp.example.com", "username": "u", "password": "p"},
+        "dav": {"target": "https://dav.example.com/share/books", "tenants": ["default", "team-a"]},
+        "unbound": {"username": "u", "password": "p"},
+    }
+    settings.DELIVERY_KNOWN_HOSTS = ""
+
+    def config(type, target, ref, path=""):
+        return DeliveryConfig(type=type, target=target, path=path, credentials_ref=ref)
+
+    try:
+        delivery_service.validate(config(DeliveryType.S3, "exports", "s3"))
+        delivery_service.validate(config(DeliveryType.WEBDAV, "https://dav.example.com/share/books/2024", "dav"))
+        rejected = [
+            (config(DeliveryType.S3, "other-bucket", "s3"), "只能用于"),
+            (config(DeliveryType.WEBDAV, "https://attacker.example/share/books", "dav"), "只能用于"),
+            (config(DeliveryType.WEBDAV, "http://dav.example.com/share/books", "dav"), "只能用于"),
+            (config(DeliveryType.WEBDAV, "https://dav.example.com/share/booksx", "dav"), "只能用于"),
+            (config(DeliveryType.WEBDAV, "https://dav.example.com/share/books", "dav", "../../admin"), ".."),
+            (config(DeliveryType.SFTP, "attacker.example:22", "sftp"), "只能用于"),
+            (config(DeliveryType.SFTP, "sftp.example.com:2222", "sftp"), "只能用于"),
+            (config(DeliveryType.SFTP, "sftp.example.com", "sftp"), "服务器公钥"),
+            (config(DeliveryType.S3, "anything", "unbound"), "未绑定"),
+        ]
+        for delivery, message in rejected:
+            try:
+                delivery_service.validate(delivery)
+                assert False, f"应拒绝: {delivery.target}"
+            except ValueError as e:
+                assert message in str(e), str(e)
+
+        settings.DELIVERY_KNOWN_HOSTS = "/etc/ssh/ssh_known_hosts"
+        delivery_service.validate(config(DeliveryType.SFTP, "SFTP.example.com:22", "sftp"))
+
+        # 凭据只供绑定的租户使用
+        with use_tenant("team-a"):
+            delivery_service.validate(config(DeliveryType.WEBDAV, "https://dav.example.com/share/books", "dav"))
+            try:
+                delivery_service.validate(config(DeliveryType.S3, "exports", "s3"))
+                assert False, "其他租户不能使用默认租户的凭据"
+            except ValueError as e:
+                assert "未配置投递凭据" in str(e)
+    finally:
+        settings.DELIVERY_CREDENTIALS, settings.DELIVERY_KNOWN_HOSTS = original
+    print("✓ 凭据只能发送到绑定的存储桶、主机或地址前缀，SFTP必须校验服务器公钥，其他租户不可用")
+
+
+def test_object_keys():
+    """测试对象键"""
+    print("\n测试对象键...")
+
+    file_info = FileInfo(
+        file_id="f1",
+        filename="scan_0042.pdf",
+        file_size=1,
+        file_path="/tmp/original.pdf",
+        upload_time=datetime.now(),
+        title="Deep Learning",
+        author="Ian Goodfellow"
+    )
+    manifest = OutputManifest(files=[
+        _entry("01_Introduction.pdf", "Introduction"),
+        _entry("02_Exercises.pdf", "Exercises"),
+        _entry("03_Exercises.pdf", "Exercises"),
+    ])
+    filenames = [entry.filename for entry in manifest.files] + ["manifest.json"]
+    keys = delivery_service.object_keys(_config(), filenames, manifest, file_info)
+    assert keys == {
+        "01_Introduction.pdf": "books/deep-learning/01_introduction.pdf",
+        "02_Exercises.pdf": "books/deep-learning/02_exercises.pdf",
+        "03_Exercises.pdf": "books/deep-learning/03_exercises.pdf",
+        "manifest.json": "books/deep-learning/manifest.json",
+    }
+
+    # 没有识别到书名时使用文件名；章节键相同时追加序号
+    file_info.title = None
+    keys = delivery_service.object_keys(_config("{title_slug}/{author_slug}/{chapter_slug}.pdf"), filenames, manifest, file_info)
+    assert keys["01_Introduction.pdf"] == "scan-0042/ian-goodfellow/introduction.pdf"
+    assert keys["03_Exercises.pdf"] == "scan-0042/ian-goodfellow/exercises-3.pdf"
+    assert keys["manifest.json"] == "scan-0042/ian-goodfellow/manifest.json"
+    assert delivery_service.object_keys(_config(None), filenames, manifest, file_info) == {}
+
+    target = S3Target(_config(), {}, {"01_Introduction.pdf": "books/deep-learning/01_introduction.pdf"})
+    assert target._remote_path("01_Introduction.pdf") == "exports/books/deep-learning/01_introduction.pdf"
+    assert target._remote_path("other.pdf") == "exports/other.pdf"
+    print("✓ 章节按书和序号分目录存放，清单放在章节目录中，键在path之下")
@@ -0,0 +1,98 @@
+"""
+文档标题识别测试，验证从PDF元数据读取标题和作者、元数据无效时按首页文字推断，
+以及上传后文件列表中的显示名称
+"""
+
+import asyncio
+import io
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.api import routes
+from src.core.config import settings
+from src.services.document_title import clean_title, extract_title_author, suggest_display_name
+
+
+def _pdf_bytes(metadata: dict = None, lines=(), blank_pages: int = 0) -> bytes:
+    """lines: (文字, 字号)"""
+    doc = fitz.open()
+    for _ in range(blank_pages):
+        doc.new_page()
+    page = doc.new_page()
+    y = 72
+    for text, size in lines:
+        page.insert_text((72, y), text, fontsize=size)
+        y += size * 2
+    if metadata:
+        doc.set_metadata(metadata)
+    data = doc.tobytes()
+    doc.close()
+    return data
+
+
+def _extract(data: bytes) -> tuple:
+    with tempfile.TemporaryDirectory() as temp:
+        path = Path(temp) / "doc.pdf"
+        path.write_bytes(data)
+        return extract_title_author(str(path))
+
+
+def test_metadata():
+    """测试元数据中的标题和作者"""
+    print("测试元数据...")
+
+    assert _extract(_pdf_bytes({"title": " Deep  Learning ", "author": "Goodfellow"})) == ("Deep Learning", "Goodfellow")
+    assert clean_title("Microsoft Word - 讲义.docx") == "讲义"
+    for junk in ("untitled", "Title.pdf", "12345", "ab"):
+        assert clean_title(junk) is None, junk
+    print("✓ 读取并清理元数据，忽略办公软件前缀、扩展名和无效标题")
+
+
+def test_first_page_fallback():
+    """测试按首页文字推断"""
+    print("\n测试首页文字...")
+
+    data = _pdf_bytes(
+        {"title": "Untitled", "author": "Administrator"},
+        [("Pattern Recognition", 28), ("and Machine Learning", 28), ("by Christopher Bishop", 14), ("Springer", 10)],
+        blank_pages=1
+    )
+    assert _extract(data) == ("Pattern Recognition and Machine Learning", "Christopher Bishop")
+    # 元数据中有效的字段优先
+    data = _pdf_bytes({"author": "Bishop"}, [("Pattern Recognition", 28), ("by Someone Else", 14)])
+    assert _extract(data) == ("Pattern Recognition", "Bishop")
+    assert _extract(_pdf_bytes()) == (None, None)
+    assert _extract(b"not a pdf") == (None, None)
+    print("✓ 跳过空白封面，字号最大的连续行作为标题，by行作为作者")
+
+
+def test_display_name(tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试显示名称"""
+    print("\n测试显示名称...")
+
+    assert suggest_display_name("Deep Learning", "Goodfellow", "a.pdf") == "Deep Learning – Goodfellow"
+    assert suggest_display_name("Deep Learning", None, "a.pdf") == "Deep Learning"
+    assert suggest_display_name(None, "Goodfellow", "3f2a.pdf") == "3f2a"
+
+    monkeypatch.setattr(settings, "DEDUP_UPLOADS", False)
+
+    async def run():
+        service = routes.file_service
+        book = await service._save_pdf_stream(
+            io.BytesIO(_pdf_bytes({"title": "Deep Learning", "author": "Goodfellow"})), "3f2a.pdf"
+        )
+        assert book.title == "Deep Learning" and book.display_name == "Deep Learning – Goodfellow"
+        assert (await routes._upload_response(book, "")).display_name == "Deep Learning – Goodfellow"
+
+        # 早于标题识别上传的文件没有记录显示名称
+        legacy = await service._save_pdf_stream(io.BytesIO(_pdf_bytes()), "notes.pdf")
+        legacy.display_name = None
+        await service._save_file_metadata(legacy)
+
+        names = {f.file_id: f.display_name for f in await routes.list_files()}
+        assert names == {book.file_id: "Deep Learning – Goodfellow", legacy.file_id: "notes"}
+
+    asyncio.run(run())
+    print("✓ 上传时记录标题 – 作者，没有标题的文件显示文件名")
@@ -0,0 +1,68 @@
+"""
+已解析文档缓存测试，验证超出容量时淘汰最久未使用的文档、使用中的文档不被淘汰，以及主动淘汰
+"""
+
+import os
+import shutil
+import tempfile
+from pathlib import Path
+
+from src.core.config import settings
+from src.core.document_cache import DocumentCache
+
+
+def _copies(make_pdf, tmp: str, names):
+    """生成内容相同的PDF，返回路径和单个文档的估算占用"""
+    first = make_pdf(Path(tmp) / f"{names[0]}.pdf", 3)
+    paths = {names[0]: str(first)}
+    for name in names[1:]:
+        paths[name] = str(shutil.copy(first, Path(tmp) / f"{name}.pdf"))
+    return paths, os.path.getsize(first) * settings.DOCUMENT_CACHE_SIZE_FACTOR
+
+
+def test_lru_eviction(make_pdf):
+    """测试超出容量时淘汰最久未使用的文档"""
+    print("测试LRU淘汰...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        paths, size = _copies(make_pdf, tmp, ["a", "b", "c"])
+        cache = DocumentCache(max_bytes=2 * size)
+
+        with cache.open(paths["a"], "a") as doc_a:
+            pass
+        with cache.open(paths["b"], "b") as doc_b:
+            pass
+        # 再次使用a，b成为最久未使用的文档
+        with cache.open(paths["a"], "a") as again:
+            assert again is doc_a
+        with cache.open(paths["c"], "c"):
+            pass
+
+        assert list(cache._entries) == ["a", "c"]
+        assert doc_b.is_closed and not doc_a.is_closed
+        assert cache.stats() == {"documents": 2, "estimated_bytes": 2 * size, "max_bytes": 2 * size}
+    print("✓ 超出容量时淘汰最久未使用的文档并关闭")
+
+
+def test_in_use_not_evicted(make_pdf):
+    """测试使用中的文档不被淘汰，主动淘汰在释放后关闭文档"""
+    print("\n测试使用中的文档...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        paths, size = _copies(make_pdf, tmp, ["a", "b", "c"])
+        cache = DocumentCache(max_bytes=2 * size)
+
+        with cache.open(paths["a"], "a") as doc_a:
+            with cache.open(paths["b"], "b"):
+                pass
+            # a最久未使用但仍在使用，淘汰b
+            with cache.open(paths["c"], "c"):
+                pass
+            assert list(cache._entries) == ["a", "c"]
+
+            cache.evict("a")
+            assert "a" not in cache._entries
+            assert not doc_a.is_closed and doc_a.page_count == 3, "使用中的文档在释放前保持打开"
+        assert doc_a.is_closed
+        assert cache.stats()["documents"] == 1
+    print("✓ 使用中的文档不被淘汰，主动淘汰的文档在释放后关闭")
@@ -0,0 +1,106 @@
+"""
+下载测试，验证章节下载的ETag、Last-Modified、Cache-Control、条件请求返回304以及交给反向代理发送文件（隐私模式的文件除外）
+"""
+
+import asyncio
+import hashlib
+from email.utils import formatdate
+from pathlib import Path
+
+from src.api.routes import _not_modified, download_file
+from src.core.config import settings
+from src.core.tenancy import file_storage_dir
+from src.models.schemas import ManifestEntry, OutputManifest
+from src.services.pdf_splitter import MANIFEST_FILENAME
+
+
+FILE_ID = "00000000-0000-4000-8000-000000000001"
+EPHEMERAL_ID = "tmp-00000000-0000-4000-8000-000000000002"
+
+
+def test_not_modified():
+    """测试条件请求判断"""
+    print("测试条件请求...")
+
+    etag = '"abc"'
+    mtime = 1700000000.5
+    assert _not_modified(etag, mtime, '"abc"', None)
+    assert _not_modified(etag, mtime, 'W/"abc", "def"', None)
+    assert _not_modified(etag, mtime, "*", None)
+    assert not _not_modified(etag, mtime, '"def"', None)
+    # If-None-Match优先于If-Modified-Since
+    assert not _not_modified(etag, mtime, '"def"', formatdate(mtime + 60, usegmt=True))
+
+    assert _not_modified(etag, mtime, None, formatdate(mtime, usegmt=True))
+    assert not _not_modified(etag, mtime, None, formatdate(mtime - 60, usegmt=True))
+    assert not _not_modified(etag, mtime, None, "not a date")
+    assert not _not_modified(etag, mtime, None, None)
+    print("✓ ETag或修改时间匹配时命中缓存")
+
+
+def test_download_headers(tmp_upload_dir):
+    """测试章节下载的缓存响应头和304"""
+    print("\n测试下载缓存响应头...")
+
+    data = b"%PDF-1.7 chapter"
+    sha256 = hashlib.sha256(data).hexdigest()
+    chapters_dir = file_storage_dir(FILE_ID) / "chapters"
+    chapters_dir.mkdir(parents=True)
+    (chapters_dir / "01_a.pdf").write_bytes(data)
+    manifest = OutputManifest(files=[ManifestEntry(
+        filename="01_a.pdf", title="A", start_page=1, end_page=1, pages=1, size=len(data), sha256=sha256
+    )])
+    (chapters_dir / MANIFEST_FILENAME).write_text(manifest.model_dump_json(), encoding="utf-8")
+
+    async def run():
+        response = await download_file(FILE_ID, "01_a.pdf", True, None, None)
+        assert response.status_code == 200
+        assert response.headers["etag"] == f'"{sha256}"'
+        assert "immutable" in response.headers["cache-control"]
+        assert response.headers["last-modified"]
+
+        cached = await download_file(FILE_ID, "01_a.pdf", True, f'"{sha256}"', None)
+        assert cached.status_code == 304
+        assert cached.headers["etag"] == f'"{sha256}"'
+
+        since = response.headers["last-modified"]
+        assert (await download_file(FILE_ID, "01_a.pdf", True, None, since)).status_code == 304
+
+    asyncio.run(run())
+    print("✓ ETag使用清单中的SHA-256，命中时返回304")
+
+
+def test_offloaded_download(tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试交给反向代理发送文件"""
+    print("\n测试反向代理发送文件...")
+
+    chapters_dir = file_storage_dir(FILE_ID) / "chapters"
+    chapters_dir.mkdir(parents=True)
+    (chapters_dir / "01 第一章.pdf").write_bytes(b"%PDF-1.7 chapter")
+    ephemeral_dir = file_storage_dir(EPHEMERAL_ID) / "chapters"
+    ephemeral_dir.mkdir(parents=True)
+    (ephemeral_dir / "01.pdf").write_bytes(b"%PDF-1.7 ephemeral")
+
+    async def run():
+        monkeypatch.setattr(settings, "DOWNLOAD_OFFLOAD", "nginx")
+        response = await download_file(FILE_ID, "01 第一章.pdf", True, None, None)
+        assert response.body == b""
+        assert response.headers["x-accel-redirect"].startswith(
+            f"/protected-uploads/tenants/{settings.DEFAULT_TENANT}/{FILE_ID}/chapters/01%20"
+        )
+        assert response.headers["content-disposition"].startswith("attachment;")
+        assert response.headers["etag"]
+
+        monkeypatch.setattr(settings, "DOWNLOAD_OFFLOAD", "sendfile")
+        response = await download_file(FILE_ID, "01 第一章.pdf", False, None, None)
+        assert Path(response.headers["x-sendfile"]) == (chapters_dir / "01 第一章.pdf").resolve()
+        assert response.headers["content-disposition"].startswith("inline;")
+
+        # 隐私模式的文件不在UPLOAD_DIR下，由应用直接发送
+        monkeypatch.setattr(settings, "DOWNLOAD_OFFLOAD", "nginx")
+        response = await download_file(EPHEMERAL_ID, "01.pdf", True, None, None)
+        assert response.status_code == 200 and "x-accel-redirect" not in response.headers
+        assert Path(response.path) == ephemeral_dir / "01.pdf"
+
+    asyncio.run(run())
+    print("✓ 返回X-Accel-Redirect或X-Sendfile，不发送文件内容；隐私模式的文件由应用发送")
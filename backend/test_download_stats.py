@@ -0,0 +1,93 @@
+"""
+下载统计测试，验证下载次数和最后访问时间的记录、汇总以及按下载情况清理章节输出
+"""
+
+import asyncio
+import io
+import os
+import time
+from datetime import timedelta
+
+from src.core.config import settings
+from src.services.file_service import FileService
+from src.services.pdf_splitter import MANIFEST_FILENAME
+
+
+def _write_outputs(file_service: FileService, file_id: str, age_hours: float = 0) -> None:
+    chapters_dir = file_service.upload_dir / file_id / "chapters"
+    chapters_dir.mkdir(parents=True, exist_ok=True)
+    (chapters_dir / "01_a.pdf").write_bytes(b"%PDF-1.7")
+    manifest_path = chapters_dir / MANIFEST_FILENAME
+    manifest_path.write_text('{"files": []}', encoding="utf-8")
+    generated_at = time.time() - age_hours * 3600
+    os.utime(manifest_path, (generated_at, generated_at))
+
+
+def test_record_download(tmp_upload_dir, pdf_bytes):
+    """测试记录下载次数和汇总"""
+    print("测试下载统计...")
+
+    file_service = FileService()
+
+    async def run():
+        info = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Stats")), "book.pdf")
+        _write_outputs(file_service, info.file_id)
+
+        summary = await file_service.get_download_summary()
+        assert summary["total_downloads"] == 0 and summary["never_downloaded_outputs"] == 1
+
+        # 只下载原文件不算输出被下载
+        await file_service.record_download(info.file_id, ["original.pdf"])
+        assert (await file_service.get_download_summary())["never_downloaded_outputs"] == 1
+
+        await file_service.record_download(info.file_id, ["01_a.pdf"])
+        await file_service.record_download(info.file_id, ["01_a.pdf"])
+        await file_service.record_download("missing", ["01_a.pdf"])
+
+        info = await file_service.get_file_info(info.file_id)
+        assert info.download_count == 3
+        assert info.downloads["01_a.pdf"].count == 2
+        assert info.downloads["original.pdf"].count == 1
+        assert info.last_accessed == info.downloads["01_a.pdf"].last_accessed
+
+        summary = await file_service.get_download_summary()
+        assert summary["total_downloads"] == 3
+        assert summary["downloaded_files"] == 1
+        assert summary["never_downloaded_outputs"] == 0
+        assert summary["last_accessed"] == info.last_accessed
+
+    asyncio.run(run())
+    print("✓ 按文件名记录下载次数和最后访问时间")
+
+
+def test_cleanup_outputs(pdf_bytes, tmp_upload_dir, monkeypatch):
+    """测试按下载情况清理章节输出"""
+    print("\n测试清理章节输出...")
+
+    file_service = FileService()
+
+    async def run():
+        never = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Never")), "never.pdf")
+        used = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Used")), "used.pdf")
+        fresh = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Fresh")), "fresh.pdf")
+        _write_outputs(file_service, never.file_id, age_hours=30)
+        _write_outputs(file_service, used.file_id, age_hours=30)
+        _write_outputs(file_service, fresh.file_id)
+        await file_service.record_download(used.file_id, ["01_a.pdf"])
+
+        # 从未下载的输出使用更短的保留时间
+        monkeypatch.setattr(settings, "OUTPUT_RETENTION_HOURS", 48)
+        monkeypatch.setattr(settings, "UNDOWNLOADED_OUTPUT_RETENTION_HOURS", 24)
+        assert await file_service.cleanup_outputs() == 1
+        assert not (file_service.upload_dir / never.file_id / "chapters").exists()
+        assert (file_service.upload_dir / used.file_id / "chapters").exists()
+        assert (file_service.upload_dir / fresh.file_id / "chapters").exists()
+        # 原文件保留
+        assert await file_service.get_file_path(never.file_id)
+
+        # 过期时间按最后一次下载计算
+        info = await file_service.get_file_info(used.file_id)
+        assert info.outputs_expires_at == info.last_accessed + timedelta(hours=48)
+
+    asyncio.run(run())
+    print("✓ 从未下载的输出优先按生成时间清理，已下载的输出按最后访问时间保留")
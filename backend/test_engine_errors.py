@@ -0,0 +1,77 @@
+"""
+外部引擎错误测试，验证按Ghostscript、Tesseract输出归类错误代码、输出摘录长度，
+以及失败任务的错误代码和诊断信息
+"""
+
+import asyncio
+
+from src.core.errors import code_for_exception, details_for_exception
+from src.core.store import get_store
+from src.core.tenancy import file_storage_dir
+from src.models.schemas import ChapterInfo, ErrorCode, SplitTask, TaskStatus
+from src.services import task_service as task_module
+from src.services.engine_errors import OUTPUT_EXCERPT_CHARS, classify_engine_output, engine_error
+from src.services.task_service import TASKS_BUCKET, TaskService
+
+GS_ENCRYPTED = """GPL Ghostscript 10.02.1 (2023-11-01)
+   **** Error: This file requires a password for access.
+Error: /invalidfileaccess in pdf_process_Encrypt
+"""
+GS_CORRUPT = """   **** Error: Couldn't find trailer dictionary.
+   **** Error: Couldn't find trailer or xref.
+Unrecoverable error, exit code 1
+"""
+
+
+def test_classify():
+    """测试错误归类"""
+    print("测试错误归类...")
+
+    assert classify_engine_output("Ghostscript", GS_ENCRYPTED) == ErrorCode.ENCRYPTED
+    assert classify_engine_output("Ghostscript", GS_CORRUPT) == ErrorCode.CORRUPT
+    assert classify_engine_output("Ghostscript", "Error: /undefinedresource in findresource") == ErrorCode.UNSUPPORTED
+    assert classify_engine_output("Ghostscript", "Unrecoverable error, exit code 1") == ErrorCode.INTERNAL
+    assert classify_engine_output("Tesseract", "Error opening data file chi_sim.traineddata\nFailed loading language 'chi_sim'") == ErrorCode.UNAVAILABLE
+    assert classify_engine_output("Tesseract", GS_ENCRYPTED) == ErrorCode.INTERNAL, "按引擎分别匹配"
+    print("✓ 按引擎输出归为已加密、已损坏、不支持的特性和缺少数据，无法归类时为internal")
+
+
+def test_engine_error():
+    """测试引擎错误"""
+    print("\n测试引擎错误...")
+
+    error = engine_error("Ghostscript", 1, GS_CORRUPT)
+    assert isinstance(error, RuntimeError) and error.code == ErrorCode.CORRUPT and error.status_code == 422
+    assert error.message.startswith("Ghostscript处理失败（文件已损坏）") and "Unrecoverable error" in error.message
+    assert code_for_exception(error) == ErrorCode.CORRUPT
+    assert details_for_exception(error) == {"engine": "Ghostscript", "exit_code": 1, "output": GS_CORRUPT.strip()}
+    assert details_for_exception(ValueError("x")) is None
+
+    long_output = "\n".join(f"line {i}" for i in range(2000))
+    excerpt = engine_error("Ghostscript", 1, long_output).output
+    assert len(excerpt) == OUTPUT_EXCERPT_CHARS + 1 and excerpt.endswith("line 1999")
+    print("✓ 错误信息带归类说明，诊断信息保留退出码和输出末尾摘录")
+
+
+def test_task_error_details(tmp_upload_dir, monkeypatch):
+    """测试失败任务的诊断信息"""
+    print("\n测试任务诊断信息...")
+
+    def encrypted(path):
+        raise engine_error("Ghostscript", 1, GS_ENCRYPTED)
+
+    monkeypatch.setattr(task_module, "count_signatures", encrypted)
+    service = TaskService()
+    task = SplitTask(task_id="t1", file_id="00000000-0000-4000-8000-000000000001", chapters=[ChapterInfo(title="第1章", start_page=1, end_page=1, page_count=1)])
+    service.tasks[task.task_id] = task
+    get_store().put(TASKS_BUCKET, task.task_id, task.model_dump(mode="json"))
+    file_dir = file_storage_dir(task.file_id, task.tenant_id)
+    file_dir.mkdir(parents=True)
+    (file_dir / "original.pdf").write_bytes(b"%PDF-1.7")
+
+    asyncio.run(service._process_split_task(task))
+
+    assert task.status == TaskStatus.FAILED and task.error_code == ErrorCode.ENCRYPTED
+    assert task.error_details["engine"] == "Ghostscript" and task.error_details["exit_code"] == 1
+    assert "requires a password" in task.error_details["output"]
+    print("✓ 失败任务记录归类后的错误代码和引擎诊断信息")
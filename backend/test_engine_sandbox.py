@@ -0,0 +1,110 @@
+"""
+引擎子进程沙箱测试，验证子进程只继承精简的环境变量并使用单独的临时目录、
+bubblewrap和AppArmor命令前缀、只挂载所需的系统目录及挂载顺序、seccomp配置校验，以及沙箱不可用时不运行引擎
+"""
+
+import asyncio
+import json
+import os
+import sys
+
+from src.core.config import settings
+from src.core.sandbox import engine_sandbox, sandbox_available
+from src.services.ghostscript import ghostscript_available
+
+
+def test_environment(tmp_temp_dir, monkeypatch):
+    """测试环境变量和临时目录"""
+    print("测试子进程环境...")
+
+    monkeypatch.setenv("ENGINE_TEST_SECRET", "secret")
+
+    async def run(sandbox):
+        process = await asyncio.create_subprocess_exec(
+            *sandbox.command([sys.executable, "-c", "import json, os; print(json.dumps(dict(os.environ)))"]),
+            stdout=asyncio.subprocess.PIPE,
+            env=sandbox.env,
+            pass_fds=sandbox.pass_fds
+        )
+        stdout, _ = await process.communicate()
+        return json.loads(stdout)
+
+    with engine_sandbox() as sandbox:
+        workdir = sandbox.workdir
+        assert workdir.is_dir()
+        env = asyncio.run(run(sandbox))
+    assert "ENGINE_TEST_SECRET" not in env
+    assert env["HOME"] == env["TMPDIR"] == str(workdir) and env["PATH"] == os.environ["PATH"]
+    assert not workdir.exists(), "退出后删除沙箱目录"
+    print("✓ 凭据等环境变量不传给子进程，HOME和TMPDIR指向单独的目录，结束后删除")
+
+
+def test_bwrap_command(tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试bubblewrap命令"""
+    print("\n测试bubblewrap命令...")
+
+    source = tmp_temp_dir / "chapter.pdf"
+    source.write_bytes(b"%PDF")
+    filter_path = tmp_temp_dir / "engine.bpf"
+    filter_path.write_bytes(b"\0" * 8)
+
+    monkeypatch.setattr(settings, "ENGINE_SANDBOX", "")
+    with engine_sandbox([source]) as sandbox:
+        assert sandbox.command(["gs", "-q"]) == ["gs", "-q"] and sandbox.pass_fds == ()
+
+    monkeypatch.setattr(settings, "ENGINE_SECCOMP_FILTER", str(filter_path))
+    try:
+        with engine_sandbox():
+            assert False, "seccomp过滤器需要bubblewrap"
+    except RuntimeError:
+        pass
+
+    monkeypatch.setattr(settings, "ENGINE_SANDBOX", "bwrap")
+    monkeypatch.setattr(settings, "ENGINE_APPARMOR_PROFILE", "pdf-engine")
+    monkeypatch.setattr(settings, "ENGINE_SANDBOX_BINDS", ["/opt/tessdata", "/usr/share/fonts", "relative/path"])
+    with engine_sandbox([source]) as sandbox:
+        command = sandbox.command(["gs", "-q"])
+        workdir = str(sandbox.workdir.resolve())
+        assert command[:4] == ["aa-exec", "-p", "pdf-engine", "--"]
+        assert command[4] == settings.ENGINE_SANDBOX_PATH and command[-3:] == ["--", "gs", "-q"]
+        assert "--unshare-all" in command and "--die-with-parent" in command
+
+        def position(*args):
+            for i in range(len(command)):
+                if command[i:i + len(args)] == list(args):
+                    return i
+            assert False, f"缺少参数: {args}"
+
+        hidden = position("--tmpfs", str(tmp_temp_dir.resolve()))
+        assert "/" not in command[:command.index("--")], "不挂载整个根文件系统"
+        for path in ("/home", "/root", "/var", "/etc"):
+            assert path not in command, f"{path} 不可见"
+        usr = position("--ro-bind-try", "/usr", "/usr")
+        assert usr < position("--tmpfs", str(tmp_upload_dir.resolve())) < position(
+            "--ro-bind", str(source.resolve()), str(source.resolve())
+        )
+        assert ("--symlink" in command) == any(os.path.islink(path) for path in ("/bin", "/sbin", "/lib", "/lib32", "/lib64"))
+        assert position("--ro-bind-try", "/opt/tessdata", "/opt/tessdata") < hidden
+        assert "/usr/share/fonts" not in command, "系统路径之下的目录随父目录挂载"
+        assert hidden < position("--bind", workdir, workdir)
+        fd = int(command[position("--seccomp") + 1])
+        assert sandbox.pass_fds == (fd,)
+    try:
+        os.fstat(fd)
+        assert False, "退出后关闭过滤器文件"
+    except OSError:
+        pass
+    print("✓ 只挂载系统目录和配置的额外路径，数据目录被隐藏，输入文件只读挂载，工作目录可写，seccomp过滤器和AppArmor配置传给子进程")
+
+
+def test_unavailable():
+    """测试沙箱不可用"""
+    print("\n测试沙箱不可用...")
+
+    original = settings.ENGINE_SANDBOX, settings.ENGINE_SANDBOX_PATH
+    settings.ENGINE_SANDBOX, settings.ENGINE_SANDBOX_PATH = "bwrap", "/nonexistent/bwrap"
+    try:
+        assert not sandbox_available() and not ghostscript_available()
+    finally:
+        settings.ENGINE_SANDBOX, settings.ENGINE_SANDBOX_PATH = original
+    print("✓ 配置的沙箱不可用时不运行引擎，而不是在沙箱外运行")
@@ -0,0 +1,75 @@
+"""
+隐私模式测试，验证临时文件只保存在TEMP_DIR、不写入元数据存储和文件列表、不参与去重，以及超时清理
+"""
+
+import asyncio
+import io
+import json
+from datetime import datetime, timedelta
+from pathlib import Path
+
+from src.core.config import settings
+from src.core.store import get_store
+from src.core.tenancy import EPHEMERAL_DIRNAME, is_ephemeral_file
+from src.models.schemas import ChapterInfo
+from src.services.file_service import FILES_BUCKET, FileService
+
+
+def test_ephemeral_upload(pdf_bytes, tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试隐私模式上传不进入租户存储和元数据存储"""
+    print("测试隐私模式上传...")
+
+    file_service = FileService()
+
+    async def run():
+        stored = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Private")), "book.pdf")
+        private = await file_service._save_pdf_stream(io.BytesIO(pdf_bytes("Private")), "book.pdf", ephemeral=True)
+
+        # 内容相同也不与已有文件去重
+        assert is_ephemeral_file(private.file_id) and not private.deduplicated
+        assert Path(private.file_path).is_relative_to(tmp_temp_dir / EPHEMERAL_DIRNAME)
+        assert not (tmp_upload_dir / private.file_id).exists()
+        assert get_store().get(FILES_BUCKET, private.file_id, "default") is None
+        assert [info.file_id for info in await file_service.list_files()] == [stored.file_id]
+
+        info = await file_service.get_file_info(private.file_id)
+        assert info.filename == "book.pdf"
+        assert info.original_expires_at == info.upload_time + timedelta(minutes=settings.EPHEMERAL_TTL_MINUTES)
+        assert await file_service.get_file_path(private.file_id)
+
+        await file_service.save_chapter_edits(private.file_id, [ChapterInfo(title="第1章", start_page=1, end_page=1, page_count=1)])
+        assert (await file_service.get_chapter_edits(private.file_id)).chapters[0].title == "第1章"
+
+        assert await file_service.delete_file(private.file_id)
+        assert await file_service.get_file_info(private.file_id) is None
+
+        # 全局隐私模式下所有上传都是临时文件
+        monkeypatch.setattr(settings, "EPHEMERAL_MODE", True)
+        forced = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Forced")), "forced.pdf")
+        assert is_ephemeral_file(forced.file_id)
+
+    asyncio.run(run())
+    print("✓ 临时文件只保存在TEMP_DIR，不出现在文件列表")
+
+
+def test_purge_expired(pdf_bytes, tmp_upload_dir, tmp_temp_dir):
+    """测试超时未下载的临时文件被删除"""
+    print("\n测试超时清理...")
+
+    file_service = FileService()
+
+    async def run():
+        old = await file_service._save_pdf_stream(io.BytesIO(pdf_bytes("Old")), "old.pdf", ephemeral=True)
+        fresh = await file_service._save_pdf_stream(io.BytesIO(pdf_bytes("Fresh")), "fresh.pdf", ephemeral=True)
+
+        record_path = Path(old.file_path).parent / f"{FILES_BUCKET}.json"
+        data = json.loads(record_path.read_text(encoding="utf-8"))
+        data["upload_time"] = (datetime.now() - timedelta(minutes=settings.EPHEMERAL_TTL_MINUTES + 1)).isoformat()
+        record_path.write_text(json.dumps(data), encoding="utf-8")
+
+        assert await file_service.purge_expired_ephemeral() == [old.file_id]
+        assert await file_service.get_file_info(old.file_id) is None
+        assert await file_service.get_file_info(fresh.file_id)
+
+    asyncio.run(run())
+    print("✓ 超过EPHEMERAL_TTL_MINUTES的临时文件被删除")
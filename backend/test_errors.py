@@ -0,0 +1,90 @@
+"""
+领域错误测试，验证错误类型到状态码和错误代码的映射、加密文件的识别，以及接口和中间件错误响应中的错误代码
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+from fastapi import HTTPException
+
+from main import domain_error_handler, http_error_handler
+from src.api.middleware import _reject
+from src.core.document_cache import DocumentCache
+from src.core.errors import (
+    ConflictError, DomainError, EncryptedError, InvalidRangeError, NotFoundError, code_for_exception, code_for_status
+)
+from src.models.schemas import ErrorCode
+
+
+def test_mapping():
+    """测试错误类型映射"""
+    print("测试错误映射...")
+
+    assert NotFoundError("任务不存在").status_code == 404
+    assert InvalidRangeError("超出范围").status_code == 400
+    assert EncryptedError("已加密").status_code == 422
+    assert ConflictError("冲突").status_code == 409
+    assert DomainError("未知").status_code == 500
+
+    # 兼容按ValueError处理的调用方
+    assert isinstance(InvalidRangeError("x"), ValueError) and not isinstance(NotFoundError("x"), ValueError)
+
+    assert code_for_exception(NotFoundError("x")) == ErrorCode.NOT_FOUND
+    assert code_for_exception(ValueError("x")) == ErrorCode.INVALID_REQUEST
+    assert code_for_exception(RuntimeError("x")) == ErrorCode.INTERNAL
+
+    assert code_for_status(404) == ErrorCode.NOT_FOUND
+    assert code_for_status(504) == ErrorCode.TIMEOUT
+    assert code_for_status(418) == ErrorCode.INVALID_REQUEST
+    assert code_for_status(502) == ErrorCode.INTERNAL
+    print("✓ 错误类型和状态码都映射到稳定的错误代码")
+
+
+def test_responses():
+    """测试错误响应体"""
+    print("\n测试错误响应...")
+
+    async def run():
+        response = await domain_error_handler(None, InvalidRangeError("章节序号超出范围(1-3): [5]"))
+        assert response.status_code == 400
+        assert json.loads(response.body) == {"detail": "章节序号超出范围(1-3): [5]", "code": "invalid_range"}
+
+        response = await http_error_handler(None, HTTPException(status_code=404, detail="文件不存在"))
+        assert json.loads(response.body) == {"detail": "文件不存在", "code": "not_found"}
+
+        messages = []
+
+        async def send(message):
+            messages.append(message)
+
+        await _reject({"type": "http"}, send, 429, "请求过于频繁")
+        assert messages[0]["status"] == 429
+        assert json.loads(messages[1]["body"])["code"] == "rate_limited"
+
+    asyncio.run(run())
+    print("✓ 领域错误、HTTP错误和中间件拒绝响应都带有错误代码")
+
+
+def test_encrypted_document():
+    """测试打开加密文件"""
+    print("\n测试加密文件...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "locked.pdf"
+        doc = fitz.open()
+        doc.new_page().insert_text((72, 72), "Secret")
+        doc.save(str(path), encryption=fitz.PDF_ENCRYPT_AES_256, user_pw="secret", owner_pw="owner")
+        doc.close()
+
+        cache = DocumentCache(max_bytes=1 << 20)
+        for key in (None, "locked"):
+            try:
+                with cache.open(str(path), key):
+                    pass
+                assert False, "应拒绝加密文件"
+            except EncryptedError as e:
+                assert e.code == ErrorCode.ENCRYPTED
+    print("✓ 需要密码的文件以encrypted错误拒绝")
@@ -0,0 +1,62 @@
+"""
+全局排除页面测试，验证排除的页面从每个章节输出中删除并记录在manifest中，且涂黑仍作用于正确的页面
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo, PageRange, RedactionSpec
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter, excluded_page_numbers
+
+
+def _chapter(title: str, start: int, end: int) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1)
+
+
+def test_page_numbers():
+    """测试页范围展开"""
+    print("测试页范围展开...")
+
+    ranges = [PageRange(start=2), PageRange(start=8, end=20)]
+    assert excluded_page_numbers(ranges, 10) == {2, 8, 9, 10}
+    assert excluded_page_numbers([], 10) == set()
+    try:
+        PageRange(start=5, end=4)
+        assert False, "应拒绝结束页小于起始页"
+    except ValueError:
+        pass
+    print("✓ 单页和范围均可，超出总页数的部分被忽略")
+
+
+def test_excluded_from_outputs(make_pdf):
+    """测试排除的页面从章节中删除，涂黑按原文件页码生效"""
+    print("\n测试排除页面...")
+
+    chapters = [_chapter("第1章", 1, 5), _chapter("第2章", 6, 10), _chapter("答案", 9, 10)]
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        make_pdf(source, 10)
+        output_dir = Path(tmp) / "out"
+
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source),
+            chapters,
+            str(output_dir),
+            redactions=[RedactionSpec(page=4, pattern="Page")],
+            exclude_pages=[PageRange(start=2, end=3), PageRange(start=9, end=10)]
+        ))
+        assert len(links) == 2
+
+        with fitz.open(str(output_dir / links[0])) as first:
+            texts = [page.get_text().strip() for page in first]
+        assert texts[0] == "Page 1" and texts[2] == "Page 5"
+        assert "Page" not in texts[1]
+
+        manifest = json.loads((output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+        assert [entry["excluded_pages"] for entry in manifest["files"]] == [[2, 3], [9, 10]]
+        assert [entry["pages"] for entry in manifest["files"]] == [3, 3]
+    print("✓ 排除的页面被删除并记入manifest，全部页面被排除的章节记为失败")
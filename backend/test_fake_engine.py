@@ -0,0 +1,128 @@
+"""
+模拟拆分引擎测试，验证按配置选择引擎、输出内容确定、按配置使章节和任务失败，以及进度回调
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+from src.core.config import settings
+from src.models.schemas import ChapterInfo
+from src.services.fake_splitter import FakeSplitter
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter, create_splitter
+
+FAKE_SETTINGS = (
+    "SPLIT_ENGINE",
+    "FAKE_ENGINE_CHAPTER_DELAY",
+    "FAKE_ENGINE_CHAPTER_FAILURE_RATE",
+    "FAKE_ENGINE_FAIL_CHAPTERS",
+    "FAKE_ENGINE_TASK_FAILURE_RATE",
+    "FAKE_ENGINE_SEED",
+)
+
+
+def _chapters(count: int) -> list:
+    return [
+        ChapterInfo(title=f"第{i}章", start_page=i * 3 - 2, end_page=i * 3, page_count=3)
+        for i in range(1, count + 1)
+    ]
+
+
+def _configure(**values) -> dict:
+    original = {name: getattr(settings, name) for name in FAKE_SETTINGS}
+    settings.FAKE_ENGINE_CHAPTER_DELAY = 0
+    for name, value in values.items():
+        setattr(settings, name, value)
+    return original
+
+
+def _restore(original: dict) -> None:
+    for name, value in original.items():
+        setattr(settings, name, value)
+
+
+def _split(output_dir: Path, task_id: str, count: int = 4, **kwargs) -> list:
+    return asyncio.run(FakeSplitter().split_pdf("missing.pdf", _chapters(count), str(output_dir), task_id=task_id, **kwargs))
+
+
+def test_engine_selection():
+    """测试按配置选择引擎"""
+    print("测试引擎选择...")
+
+    original = _configure()
+    try:
+        settings.SPLIT_ENGINE = "fake"
+        assert isinstance(create_splitter(), FakeSplitter)
+        settings.SPLIT_ENGINE = "pymupdf"
+        splitter = create_splitter()
+        assert type(splitter) is PDFSplitter
+        settings.SPLIT_ENGINE = "unknown"
+        try:
+            create_splitter()
+            assert False, "应拒绝未知引擎"
+        except ValueError:
+            pass
+    finally:
+        _restore(original)
+    print("✓ SPLIT_ENGINE 选择真实或模拟引擎")
+
+
+def test_deterministic_output():
+    """测试输出内容确定"""
+    print("\n测试确定输出...")
+
+    original = _configure()
+    try:
+        with tempfile.TemporaryDirectory() as tmp:
+            progress = []
+            first = _split(Path(tmp) / "a", "t1", progress_callback=progress.append, bundle=True)
+            second = _split(Path(tmp) / "b", "t1")
+            assert first == second and len(first) == 4 and progress == [25, 50, 75, 100]
+            for name in first:
+                assert (Path(tmp) / "a" / name).read_bytes() == (Path(tmp) / "b" / name).read_bytes()
+
+            manifest = json.loads((Path(tmp) / "a" / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+            assert [entry["pages"] for entry in manifest["files"]] == [3, 3, 3, 3]
+            assert (Path(tmp) / "a" / "chapters.zip").exists()
+    finally:
+        _restore(original)
+    print("✓ 不读取原文件，相同章节生成相同内容，清单与打包格式与真实引擎一致")
+
+
+def test_controlled_failures():
+    """测试按配置失败"""
+    print("\n测试控制失败...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        original = _configure(FAKE_ENGINE_FAIL_CHAPTERS=[2])
+        try:
+            errors = []
+            files = _split(
+                Path(tmp) / "fixed",
+                "t1",
+                chapter_callback=lambda index, chapter, filename, error: errors.append((index, error))
+            )
+            assert len(files) == 3 and [index for index, error in errors if error] == [2]
+        finally:
+            _restore(original)
+
+        original = _configure(FAKE_ENGINE_CHAPTER_FAILURE_RATE=0.5, FAKE_ENGINE_SEED="s")
+        try:
+            runs = [_split(Path(tmp) / f"rate{i}", "t2", count=20) for i in range(2)]
+            assert runs[0] == runs[1] and 0 < len(runs[0]) < 20
+        finally:
+            _restore(original)
+
+        original = _configure(FAKE_ENGINE_TASK_FAILURE_RATE=1.0)
+        try:
+            progress = []
+            try:
+                _split(Path(tmp) / "task", "t3", progress_callback=progress.append)
+                assert False, "任务应失败"
+            except RuntimeError:
+                pass
+            assert progress == [25, 50]
+        finally:
+            _restore(original)
+    print("✓ 指定章节、按比例选中的章节和整个任务按配置失败，相同任务结果相同")
@@ -0,0 +1,60 @@
+"""
+章节图表统计测试，验证分析结果中每个章节的图片数和表格数
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _draw_table(page: fitz.Page, top: float) -> None:
+    """绘制3x3的带边框表格"""
+    for row in range(3):
+        for col in range(3):
+            cell = fitz.Rect(72 + col * 120, top + row * 30, 192 + col * 120, top + row * 30 + 30)
+            page.draw_rect(cell, color=(0, 0, 0), width=1)
+            page.insert_text((cell.x0 + 5, cell.y1 - 10), f"R{row}C{col}", fontsize=10)
+
+
+def _make_book(path: Path) -> None:
+    """第1章两页共用同一张图片，第2章一页含两个表格"""
+    doc = fitz.open()
+    pixmap = fitz.Pixmap(fitz.csRGB, fitz.IRect(0, 0, 40, 40), False)
+    pixmap.clear_with(128)
+
+    first = doc.new_page()
+    first.insert_text((72, 72), "Chapter 1 with a logo")
+    xref = first.insert_image(fitz.Rect(400, 30, 440, 70), pixmap=pixmap)
+    second = doc.new_page()
+    second.insert_text((72, 72), "More text with the same logo")
+    second.insert_image(fitz.Rect(400, 30, 440, 70), xref=xref)
+
+    tables = doc.new_page()
+    tables.insert_text((72, 72), "Chapter 2 tables")
+    _draw_table(tables, 120)
+    _draw_table(tables, 400)
+
+    doc.set_toc([[1, "Chapter 1", 1], [1, "Chapter 2", 3]])
+    doc.save(str(path))
+    doc.close()
+
+
+def test_figure_counts():
+    """测试图片去重计数和表格检测"""
+    print("测试图表统计...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "book.pdf"
+        _make_book(path)
+        chapters, _ = asyncio.run(analyzer.analyze_pdf(str(path), "book", use_llm=False))
+
+    assert [(c.image_count, c.table_count) for c in chapters] == [(1, 0), (0, 2)]
+
+    merged, _ = analyzer.merge_small_chapters(chapters, 2)
+    assert len(merged) == 1 and (merged[0].image_count, merged[0].table_count) == (1, 2)
+    print("✓ 重复出现的图片只计一次，表格按检测结果计数，合并时累加")
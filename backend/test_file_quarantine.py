@@ -0,0 +1,131 @@
+"""
+问题文件隔离测试，验证只有引擎崩溃计入连续失败次数、达到上限后隔离文件并通知管理员、
+隔离后新建和排队中的拆分任务被拒绝、重新上传相同内容的文件同样被隔离、成功拆分后重新计数，以及解除隔离后恢复原状态
+"""
+
+import asyncio
+import io
+
+from src.core.config import settings
+from src.core.errors import ConflictError, ResourceLimitError, is_engine_crash
+from src.core.store import get_store
+from src.models.schemas import ChapterInfo, ErrorCode, FileStatus, ResponseWarning, SplitTask, TaskStatus, WarningCode
+from src.services import task_service as task_module
+from src.services.engine_errors import engine_error
+from src.services.file_service import ENGINE_FAILURES_BUCKET
+from src.services.notification_service import EVENT_FILE_QUARANTINED
+from src.services.task_service import TASKS_BUCKET, TaskService
+
+CHAPTERS = [ChapterInfo(title="第1章", start_page=1, end_page=1, page_count=1)]
+
+
+def test_engine_crash():
+    """测试引擎崩溃的判断"""
+    print("测试引擎崩溃判断...")
+
+    assert is_engine_crash(engine_error("Ghostscript", -11, "Segmentation fault"))
+    assert is_engine_crash(ResourceLimitError("Ghostscript超出CPU时间上限（60秒）"))
+    assert not is_engine_crash(engine_error("Ghostscript", 1, "This file requires a password for access."))
+    assert not is_engine_crash(ValueError("章节的所有页面都被排除"))
+    print("✓ 超出资源限制和无法归类的引擎失败计为崩溃，文件加密、参数错误等不计")
+
+
+def test_quarantine(pdf_bytes, tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试隔离和解除隔离"""
+    print("\n测试文件隔离...")
+
+    def crash(path):
+        raise engine_error("Ghostscript", -11, "Segmentation fault")
+
+    notified = []
+
+    async def notify(event, payload, configs=None):
+        notified.append((event, payload, configs))
+        return 1
+
+    monkeypatch.setattr(settings, "DEDUP_UPLOADS", False)
+    monkeypatch.setattr(settings, "QUARANTINE_AFTER_FAILURES", 2)
+    monkeypatch.setattr(task_module, "count_signatures", crash)
+    monkeypatch.setattr(task_module.notification_service, "notify", notify)
+    service = TaskService()
+    file_service = service.analysis_service.file_service
+
+    async def run_task(task_id, file_id):
+        task = SplitTask(task_id=task_id, file_id=file_id, chapters=CHAPTERS)
+        service.tasks[task_id] = task
+        get_store().put(TASKS_BUCKET, task_id, task.model_dump(mode="json"))
+        await service._process_split_task(task)
+        return task
+
+    async def run():
+        info = await file_service._save_pdf_stream(io.BytesIO(pdf_bytes()), "poison.pdf")
+        file_id = info.file_id
+        await file_service.update_file_status(file_id, FileStatus.ANALYZED)
+
+        await run_task("t1", file_id)
+        info = await file_service.get_file_info(file_id)
+        assert info.engine_failures == 1 and info.status != FileStatus.QUARANTINED
+        assert not [event for event, _, _ in notified if event == EVENT_FILE_QUARANTINED]
+
+        task = await run_task("t2", file_id)
+        info = await file_service.get_file_info(file_id)
+        assert info.status == FileStatus.QUARANTINED and info.quarantine_reason.startswith("Ghostscript处理失败")
+        assert service.task_events["t2"][-1].event == "quarantined"
+        quarantined = [(payload, configs) for event, payload, configs in notified if event == EVENT_FILE_QUARANTINED]
+        assert len(quarantined) == 1
+        payload, configs = quarantined[0]
+        assert payload["file_id"] == file_id and payload["failures"] == 2 and configs is None
+
+        # 隔离后新建、重试和排队中的任务都不再运行引擎
+        try:
+            await service.create_split_task(file_id, CHAPTERS)
+            assert False, "隔离的文件不能拆分"
+        except ConflictError:
+            pass
+        try:
+            await service.retry_task(task.task_id)
+            assert False, "隔离的文件不能重试"
+        except ConflictError:
+            pass
+        queued = await run_task("t3", file_id)
+        assert queued.status == TaskStatus.FAILED and queued.error_code == ErrorCode.CONFLICT
+        assert (await file_service.get_file_info(file_id)).engine_failures == 2
+
+        # 计数按内容哈希记录，重新上传相同的文件不能绕过隔离
+        reupload = await file_service._save_pdf_stream(io.BytesIO(pdf_bytes()), "poison-again.pdf")
+        assert reupload.file_id != file_id
+        try:
+            await service.create_split_task(reupload.file_id, CHAPTERS)
+            assert False, "相同内容的文件同样被隔离"
+        except ConflictError:
+            pass
+        assert (await file_service.get_file_info(reupload.file_id)).status == FileStatus.QUARANTINED
+
+        info = await file_service.release_quarantine(file_id)
+        assert info.status == FileStatus.ANALYZED, "解除隔离后恢复隔离前的状态"
+        assert info.engine_failures == 0 and info.quarantine_reason is None and info.status_before_quarantine is None
+        try:
+            await file_service.release_quarantine(file_id)
+            assert False, "未隔离的文件不能解除隔离"
+        except ConflictError:
+            pass
+
+        # 章节因引擎崩溃失败同样计数，成功拆分后清零
+        crashed = SplitTask(task_id="t4", file_id=file_id, chapters=CHAPTERS, warnings=[ResponseWarning(
+            code=WarningCode.CHAPTER_FAILED,
+            message="章节“第1章”拆分失败，已跳过",
+            details={"error": "Ghostscript超出CPU时间上限（60秒）", "engine_crash": True}
+        )])
+        await service._record_engine_outcome(crashed)
+        assert (await file_service.get_file_info(file_id)).engine_failures == 1
+        await service._record_engine_outcome(SplitTask(task_id="t5", file_id=file_id, chapters=CHAPTERS))
+        assert (await file_service.get_file_info(file_id)).engine_failures == 0
+
+        # 多个任务同时失败时计数不丢失
+        monkeypatch.setattr(settings, "QUARANTINE_AFTER_FAILURES", 0)
+        await asyncio.gather(*(file_service.record_engine_failure(file_id, "crash") for _ in range(5)))
+        key = file_service._engine_failure_key(await file_service.get_file_info(file_id))
+        assert get_store().get(ENGINE_FAILURES_BUCKET, key, settings.DEFAULT_TENANT)["failures"] == 5
+
+    asyncio.run(run())
+    print("✓ 连续崩溃达到上限后隔离并通知管理员，隔离期间拒绝拆分，解除后重新计数")
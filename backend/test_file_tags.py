@@ -0,0 +1,75 @@
+"""
+文件标签测试，验证标签规范化和去重、添加和删除、按标签和目录筛选文件列表，以及标签统计
+"""
+
+import asyncio
+import io
+
+from fastapi import HTTPException
+
+from src.api import routes
+from src.models.schemas import TagsRequest
+from src.services.file_service import normalize_tags
+
+
+def test_normalize():
+    """测试标签规范化"""
+    print("测试标签规范化...")
+
+    assert normalize_tags(["  数学 ", "Physics", "physics", "高等  数学"]) == ["数学", "Physics", "高等 数学"]
+    for tags in (["  "], ["x" * 51]):
+        try:
+            normalize_tags(tags)
+            assert False, "应拒绝无效标签"
+        except ValueError:
+            pass
+    print("✓ 去除多余空白，忽略大小写去重，拒绝空标签和过长标签")
+
+
+def test_tags_and_filters(pdf_bytes, tmp_upload_dir, tmp_temp_dir):
+    """测试添加、删除和筛选"""
+    print("\n测试标签和筛选...")
+
+    async def run():
+        service = routes.file_service
+        algebra = await service._save_pdf_stream(io.BytesIO(pdf_bytes("A")), "a.pdf", collection="数学/代数")
+        geometry = await service._save_pdf_stream(io.BytesIO(pdf_bytes("G")), "g.pdf", collection="数学/几何")
+        novel = await service._save_pdf_stream(io.BytesIO(pdf_bytes("N")), "n.pdf", collection="数学史")
+
+        summary = await routes.add_file_tags(algebra.file_id, TagsRequest(tags=["必读", "Exam"]))
+        assert summary.tags == ["必读", "Exam"] and summary.collection == "数学/代数"
+        assert not hasattr(summary, "file_path")
+        await routes.add_file_tags(algebra.file_id, TagsRequest(tags=["exam", "复习"]))
+        await routes.add_file_tags(geometry.file_id, TagsRequest(tags=["EXAM"]))
+        assert (await service.get_file_info(algebra.file_id)).tags == ["必读", "Exam", "复习"]
+
+        assert {f.file_id for f in await routes.list_files(tag="exam")} == {algebra.file_id, geometry.file_id}
+        assert [f.file_id for f in await routes.list_files(tag="必读", collection="数学")] == [algebra.file_id]
+        # 目录按层级匹配，数学史不属于数学
+        assert {f.file_id for f in await routes.list_files(collection="数学/")} == {algebra.file_id, geometry.file_id}
+        assert [f.file_id for f in await routes.list_files(collection="数学史")] == [novel.file_id]
+        assert len(await routes.list_files()) == 3
+
+        assert [(t.tag, t.files) for t in await routes.list_tags()] == [("Exam", 2), ("复习", 1), ("必读", 1)]
+
+        summary = await routes.remove_file_tag(algebra.file_id, "EXAM")
+        assert summary.tags == ["必读", "复习"]
+        assert (await routes.remove_file_tag(algebra.file_id, "missing")).tags == ["必读", "复习"]
+
+        for call in (
+            routes.add_file_tags("missing", TagsRequest(tags=["x"])),
+            routes.remove_file_tag("missing", "x"),
+        ):
+            try:
+                await call
+                assert False, "文件不存在时应返回404"
+            except HTTPException as e:
+                assert e.status_code == 404
+        try:
+            await routes.add_file_tags(novel.file_id, TagsRequest(tags=[" "]))
+            assert False, "应拒绝空标签"
+        except HTTPException as e:
+            assert e.status_code == 400
+
+    asyncio.run(run())
+    print("✓ 标签忽略大小写合并和删除，文件列表按标签和目录层级筛选，标签按文件数统计")
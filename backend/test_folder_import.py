@@ -0,0 +1,67 @@
+"""
+按目录批量导入测试，验证ZIP条目所在目录记为文件的collection、内容相同的已有文件补记目录，
+以及按目录打包时的包内路径
+"""
+
+import asyncio
+import io
+import zipfile
+
+from fastapi import UploadFile
+
+from src.api import routes
+from src.core.config import settings
+
+
+def _archive(entries: dict) -> UploadFile:
+    buffer = io.BytesIO()
+    with zipfile.ZipFile(buffer, "w") as archive:
+        for name, data in entries.items():
+            archive.writestr(name, data)
+    buffer.seek(0)
+    return UploadFile(buffer, filename="books.zip")
+
+
+def test_folder_import(pdf_bytes, tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试导入时记录目录"""
+    print("测试按目录导入...")
+
+    monkeypatch.setattr(settings, "DEDUP_UPLOADS", True)
+
+    async def run():
+        shared = pdf_bytes("Shared")
+        # 同一内容先单独上传，导入时补记目录
+        existing = await routes.file_service.save_pdf_stream(io.BytesIO(shared), "shared.pdf")
+        assert existing.collection is None
+
+        saved, failed = await routes.file_service.save_uploaded_archive(_archive({
+            "数学/代数/a.pdf": pdf_bytes("Algebra"),
+            "数学/几何/a.pdf": pdf_bytes("Geometry"),
+            "语文\\b.pdf": pdf_bytes("Chinese"),
+            "root.pdf": pdf_bytes("Root"),
+            "共享/shared.pdf": shared,
+        }))
+        assert not failed
+        assert [(info.filename, info.collection) for info in saved] == [
+            ("a.pdf", "数学/代数"),
+            ("a.pdf", "数学/几何"),
+            ("b.pdf", "语文"),
+            ("root.pdf", None),
+            ("shared.pdf", "共享"),
+        ]
+        assert saved[-1].file_id == existing.file_id
+        assert (await routes.file_service.get_file_info(existing.file_id)).collection == "共享"
+        assert (await routes._upload_response(saved[0], "")).collection == "数学/代数"
+        return saved
+
+    saved = asyncio.run(run())
+
+    async def prefixes():
+        used = set()
+        ids = [info.file_id for info in saved[:4]] + [saved[0].file_id, "missing"]
+        return [await routes._folder_prefix(file_id, used) for file_id in ids]
+
+    result = asyncio.run(prefixes())
+    assert result[:4] == ["数学/代数/a/", "数学/几何/a/", "语文/b/", "root/"]
+    assert result[4] == f"数学/代数/a_{saved[0].file_id}/" and result[5] == "missing/"
+    print("✓ 条目目录记为collection，按目录打包时还原层级，重名时追加文件ID")
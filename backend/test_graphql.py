@@ -0,0 +1,80 @@
+"""
+GraphQL接口测试，验证查询、变更权限和WebSocket握手鉴权
+"""
+
+import asyncio
+import json
+from datetime import datetime
+
+from src.api.graphql import schema
+from src.api.middleware import RBACMiddleware
+from src.core.auth import Principal, use_principal
+from src.core.config import settings
+from src.core.tenancy import file_storage_dir
+from src.models.schemas import Role
+
+
+FILE_ID = "00000000-0000-4000-8000-000000000001"
+
+
+def _write_file_metadata(file_id: str, filename: str) -> None:
+    """在当前租户的存储目录中写入文件元数据"""
+    file_dir = file_storage_dir(file_id)
+    file_dir.mkdir(parents=True)
+    with open(file_dir / "metadata.json", "w", encoding="utf-8") as f:
+        json.dump({
+            "file_id": file_id,
+            "filename": filename,
+            "file_size": 1024,
+            "file_path": str(file_dir / "original.pdf"),
+            "upload_time": datetime.now().isoformat()
+        }, f)
+
+
+def test_files_query(tmp_upload_dir):
+    """测试文件查询"""
+    print("测试文件查询...")
+
+    _write_file_metadata(FILE_ID, "book.pdf")
+    result = asyncio.run(schema.execute("{ files { fileId filename outputs { filename } } }"))
+
+    assert result.errors is None, result.errors
+    assert result.data["files"] == [{"fileId": FILE_ID, "filename": "book.pdf", "outputs": []}]
+    print("✓ 返回当前租户的文件")
+
+
+def test_mutation_requires_editor():
+    """测试变更操作需要editor角色"""
+    print("\n测试变更权限...")
+
+    viewer = Principal(user="vivian", role=Role.VIEWER, tenant_id=settings.DEFAULT_TENANT)
+    mutation = 'mutation { split(input: {fileId: "f-1", chapters: [{title: "第1章", startPage: 1, endPage: 2}]}) { message } }'
+
+    async def run():
+        with use_principal(viewer):
+            return await schema.execute(mutation)
+
+    result = asyncio.run(run())
+    assert result.errors and result.errors[0].extensions["status"] == 403
+    print("✓ viewer无法创建拆分任务")
+
+
+def test_websocket_requires_authentication():
+    """测试订阅的WebSocket握手同样需要认证"""
+    print("\n测试WebSocket鉴权...")
+
+    async def app(scope, receive, send):
+        await send({"type": "websocket.accept"})
+
+    messages = []
+
+    async def send(message):
+        messages.append(message)
+
+    async def receive():
+        return {"type": "websocket.connect"}
+
+    scope = {"type": "websocket", "path": "/api/graphql", "headers": [], "state": {"principal": None}}
+    asyncio.run(RBACMiddleware(app)(scope, receive, send))
+    assert messages == [{"type": "websocket.close", "code": 1008, "reason": "未认证或凭据无效"}]
+    print("✓ 未认证的订阅连接被关闭")
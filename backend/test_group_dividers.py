@@ -0,0 +1,81 @@
+"""
+分组分隔页测试，验证分组输出在每个成员章节前插入印有标题的分隔页、书签指向分隔页，以及与排除页面的配合
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterGroup, ChapterInfo, PageRange, SectionInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+from src.services.pdf_splitter import PDFSplitter
+
+
+def _chapter(title: str, start: int, end: int, **kwargs) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1, **kwargs)
+
+
+def _texts(path: Path):
+    with fitz.open(str(path)) as doc:
+        return [page.get_text().strip() for page in doc], doc.get_toc()
+
+
+def test_group_dividers(make_pdf):
+    """测试分隔页的位置和书签"""
+    print("测试分组分隔页...")
+
+    chapters = [
+        _chapter("Reading 1", 1, 2, sections=[SectionInfo(title="Notes", start_page=2, end_page=2, page_count=1)]),
+        _chapter("Reading 2", 3, 4),
+        _chapter("Reading 3", 5, 6),
+    ]
+    grouped = PDFAnalyzer().group_chapters(chapters, [ChapterGroup(title="Week 1", first=1, last=3)])
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "reader.pdf"
+        make_pdf(source, 6)
+
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), grouped, str(Path(tmp) / "out"), group_dividers=True))
+        texts, toc = _texts(Path(tmp) / "out" / links[0])
+        assert texts == [
+            "Reading 1", "Page 1", "Page 2",
+            "Reading 2", "Page 3", "Page 4",
+            "Reading 3", "Page 5", "Page 6",
+        ]
+        assert toc == [[1, "Reading 1", 1], [2, "Notes", 3], [1, "Reading 2", 4], [1, "Reading 3", 7]]
+
+        # 排除第3、4页后第二篇没有页面，不插入分隔页也没有书签；第一篇的节书签随页码前移
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source),
+            grouped,
+            str(Path(tmp) / "excluded"),
+            exclude_pages=[PageRange(start=1), PageRange(start=3, end=4)],
+            group_dividers=True
+        ))
+        texts, toc = _texts(Path(tmp) / "excluded" / links[0])
+        assert texts == ["Reading 1", "Page 2", "Reading 3", "Page 5", "Page 6"]
+        assert toc == [[1, "Reading 1", 1], [2, "Notes", 2], [1, "Reading 3", 3]]
+
+        # 未开启时不插入
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), grouped, str(Path(tmp) / "plain")))
+        texts, toc = _texts(Path(tmp) / "plain" / links[0])
+        assert len(texts) == 6 and toc[2] == [1, "Reading 2", 3]
+    print("✓ 每个成员章节前插入分隔页，书签指向分隔页")
+
+
+def test_merge_dividers(make_pdf):
+    """测试合并文件时的分隔页"""
+    print("\n测试合并文件分隔页...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        first, second = Path(tmp) / "intro.pdf", Path(tmp) / "methods.pdf"
+        make_pdf(first, 1, "Intro")
+        make_pdf(second, 2, "Methods")
+        output = Path(tmp) / "merged.pdf"
+
+        assert asyncio.run(PDFSplitter().merge_pdfs([str(first), str(second)], str(output), dividers=True))
+        texts, _ = _texts(output)
+        assert texts == ["intro", "Intro 1", "methods", "Methods 1", "Methods 2"]
+    print("✓ 每个文件前插入印有文件名的分隔页")
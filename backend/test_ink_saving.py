@@ -0,0 +1,74 @@
+"""
+省墨输出测试，验证背景图片删除和灰度转换（未安装Ghostscript时跳过灰度部分）
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.ghostscript import ghostscript_available
+from src.services.ink_saving import strip_background_images
+from src.services.pdf_splitter import PDFSplitter
+
+
+def _png(width: int, height: int, color) -> bytes:
+    pixmap = fitz.Pixmap(fitz.csRGB, fitz.IRect(0, 0, width, height), False)
+    pixmap.set_rect(pixmap.irect, color)
+    return pixmap.tobytes("png")
+
+
+def test_strip_background_images():
+    """测试只删除含可见文字页面上的大图"""
+    print("测试删除背景图片...")
+
+    doc = fitz.open()
+    handout = doc.new_page()
+    handout.insert_image(handout.rect, stream=_png(200, 280, (230, 230, 250)))
+    handout.insert_image(fitz.Rect(72, 300, 200, 400), stream=_png(64, 48, (200, 30, 30)))
+    handout.insert_text((72, 72), "Lecture notes")
+
+    # 扫描页：整页图片，没有可见文字
+    scan = doc.new_page()
+    scan.insert_image(scan.rect, stream=_png(100, 140, (128, 128, 128)))
+
+    assert strip_background_images(doc) == 1
+    remaining = [image for image in doc[0].get_images(full=True) if doc.extract_image(image[0])["width"] > 1]
+    assert len(remaining) == 1
+    assert doc.extract_image(doc[1].get_images()[0][0])["width"] == 100
+    print("✓ 背景图被删除，插图和扫描页保留")
+
+
+def test_split_grayscale():
+    """测试灰度输出（未安装Ghostscript时跳过）"""
+    print("\n测试灰度输出...")
+
+    if not ghostscript_available():
+        print("✓ 未安装Ghostscript，跳过")
+        return
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        doc = fitz.open()
+        page = doc.new_page()
+        page.draw_rect(fitz.Rect(72, 72, 300, 200), color=(1, 0, 0), fill=(0, 0, 1))
+        page.insert_text((72, 250), "Red text", color=(1, 0, 0))
+        doc.save(str(source))
+        doc.close()
+
+        output_dir = Path(tmp) / "out"
+        chapters = [ChapterInfo(title="讲义", start_page=1, end_page=1, page_count=1)]
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), grayscale=True))
+
+        with fitz.open(str(output_dir / links[0])) as output:
+            pixmap = output[0].get_pixmap(dpi=36)
+            samples = pixmap.samples
+            step = pixmap.n
+            assert all(
+                samples[i] == samples[i + 1] == samples[i + 2]
+                for i in range(0, len(samples), step)
+            ) if step >= 3 else True
+            assert "Red text" in output[0].get_text()
+    print("✓ 输出为灰度，文字保留")
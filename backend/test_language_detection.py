@@ -0,0 +1,80 @@
+"""
+语言识别测试，验证文本语言判断、文档和章节语言标注，以及按语言匹配区域关键词和选择模型
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.core.config import settings
+from src.models.schemas import SectionType
+from src.services.language_detector import detect_language
+from src.services.llm_service import llm_service
+from src.services.pdf_analyzer import PDFAnalyzer
+
+ENGLISH = "The history of the city is closely tied to the river, and it is still the center of trade for the region."
+GERMAN = "Die Geschichte der Stadt ist eng mit dem Fluss verbunden, und sie ist nicht nur für den Handel von Bedeutung."
+CHINESE = "这座城市的历史与河流密切相关，至今仍是该地区的贸易中心，每年吸引大量游客前来参观。"
+JAPANESE = "この都市の歴史は川と深く結びついており、現在も地域の貿易の中心として多くの観光客が訪れています。"
+
+
+def test_detect_language():
+    """测试按书写系统和常见虚词识别语言"""
+    print("测试语言识别...")
+
+    assert detect_language(ENGLISH) == "en"
+    assert detect_language(GERMAN) == "de"
+    assert detect_language(CHINESE) == "zh"
+    assert detect_language(JAPANESE) == "ja"
+    assert detect_language("Привет, как дела? Это простой тест на русском языке.") == "ru"
+    assert detect_language("Chapter 1") is None
+    assert detect_language("12345 67890 " * 10) is None
+    print("✓ 中、日、英、德、俄文识别正确，文字过少时返回空")
+
+
+def test_document_and_chapter_language():
+    """测试分析结果中的文档语言和章节语言"""
+    print("\n测试文档和章节语言...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "book.pdf"
+        doc = fitz.open()
+        texts = [None, ENGLISH, ENGLISH, GERMAN]
+        for text in texts:
+            page = doc.new_page()
+            if text:
+                page.insert_textbox(fitz.Rect(72, 72, 520, 700), text * 3, fontsize=11)
+        doc.set_toc([[1, "Cover", 1], [1, "Chapter 1", 2], [1, "Anhang", 4]])
+        doc.save(str(path))
+        doc.close()
+
+        chapters, metadata = asyncio.run(analyzer.analyze_pdf(str(path), "book", use_llm=False))
+
+    assert metadata.language == "en"
+    assert [c.language for c in chapters] == ["en", "en", "de"]
+    print("✓ 文档语言取主要语言，空白章节沿用文档语言")
+
+
+def test_language_keywords_and_models():
+    """测试区域关键词按语言匹配，大模型按语言选择"""
+    print("\n测试按语言匹配关键词和模型...")
+
+    analyzer = PDFAnalyzer()
+    assert analyzer._match_section_type("Inhaltsverzeichnis", "de") == SectionType.TOC
+    assert analyzer._match_section_type("Index", "de") == SectionType.INDEX
+    assert analyzer._match_section_type("References", "zh") == SectionType.BIBLIOGRAPHY
+    assert analyzer._match_section_type("Anhang A", "fr") is None
+    assert analyzer._match_section_type("Anhang A") == SectionType.APPENDIX
+
+    original = settings.LLM_LANGUAGE_MODELS
+    settings.LLM_LANGUAGE_MODELS = {"en": "english-model"}
+    try:
+        assert llm_service.model_for("en") == "english-model"
+        assert llm_service.model_for("zh") == llm_service.model_name
+        assert llm_service.model_for(None) == llm_service.model_name
+    finally:
+        settings.LLM_LANGUAGE_MODELS = original
+    print("✓ 已知语言只用该语言和英文关键词，未配置的语言使用默认模型")
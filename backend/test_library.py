@@ -0,0 +1,66 @@
+"""
+拆分库测试，验证不启动HTTP服务时的分析和拆分
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz  # PyMuPDF
+
+from src.splitter import AnalyzeOptions, open_document
+
+
+def _make_book(path: Path) -> None:
+    """生成带书签的测试PDF：第1章3页，第2章1页，第3章4页"""
+    doc = fitz.open()
+    for i in range(8):
+        page = doc.new_page()
+        page.insert_text((72, 72), f"Page {i + 1}")
+    doc.set_toc([[1, "第1章 开始", 1], [1, "第2章 插页", 4], [1, "第3章 结束", 5]])
+    doc.save(str(path))
+    doc.close()
+
+
+def test_analyze_and_split():
+    """测试分析、短章节合并和拆分"""
+    print("测试拆分库...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        book = Path(tmp) / "book.pdf"
+        _make_book(book)
+        progress = []
+        finished = []
+
+        async def run():
+            with open_document(book) as document:
+                assert document.page_count == 8
+                result = await document.analyze(AnalyzeOptions(min_chapter_pages=2))
+                files = await document.split(
+                    result.chapters,
+                    Path(tmp) / "out",
+                    progress=progress.append,
+                    on_chapter=lambda index, chapter, filename, error: finished.append(filename)
+                )
+                return result, files
+
+        result, files = asyncio.run(run())
+
+        assert [(ch.start_page, ch.end_page) for ch in result.chapters] == [(1, 4), (5, 8)]
+        assert len(result.merges) == 1
+        assert all(path.exists() for path in files)
+        assert (Path(tmp) / "out" / "manifest.json").exists()
+        assert progress[-1] == 100 and len(finished) == 2
+    print("✓ 分析和拆分无需HTTP服务")
+
+
+def test_rejects_missing_file():
+    """测试打开不存在的文件"""
+    print("\n测试无效输入...")
+
+    try:
+        open_document("/nonexistent/book.pdf")
+        assert False, "应抛出FileNotFoundError"
+    except FileNotFoundError:
+        pass
+    print("✓ 文件不存在时抛出异常")
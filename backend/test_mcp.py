@@ -0,0 +1,64 @@
+"""
+MCP工具接口测试，验证JSON-RPC协议处理和工具权限
+"""
+
+import asyncio
+
+from src.api.mcp import TOOLS, _handle_message, call_tool
+from src.core.auth import Principal, use_principal
+from src.core.config import settings
+from src.models.schemas import Role
+
+
+def test_initialize_and_list_tools():
+    """测试握手和工具清单"""
+    print("测试MCP握手...")
+
+    response = asyncio.run(_handle_message({
+        "jsonrpc": "2.0", "id": 1, "method": "initialize",
+        "params": {"protocolVersion": "2024-11-05", "capabilities": {}}
+    }))
+    assert response["result"]["capabilities"]["tools"] is not None
+    assert response["result"]["serverInfo"]["name"] == "pdf-chapter-splitter"
+
+    # 通知没有响应
+    assert asyncio.run(_handle_message({"jsonrpc": "2.0", "method": "notifications/initialized"})) is None
+
+    response = asyncio.run(_handle_message({"jsonrpc": "2.0", "id": 2, "method": "tools/list"}))
+    names = {tool["name"] for tool in response["result"]["tools"]}
+    assert {"analyze_pdf", "split_pdf", "get_download_links"} <= names
+    assert "file_id" in TOOLS["split_pdf"].describe()["inputSchema"]["properties"]
+    print("✓ 握手和工具清单正确")
+
+
+def test_protocol_errors():
+    """测试协议错误"""
+    print("\n测试协议错误...")
+
+    response = asyncio.run(_handle_message({"jsonrpc": "2.0", "id": 3, "method": "resources/list"}))
+    assert response["error"]["code"] == -32601
+
+    response = asyncio.run(_handle_message({"jsonrpc": "2.0", "id": 4, "method": "tools/call", "params": {"name": "rm_rf"}}))
+    assert response["error"]["code"] == -32602
+
+    response = asyncio.run(_handle_message({"id": 5, "method": "ping"}))
+    assert response["error"]["code"] == -32600
+    print("✓ 未知方法、未知工具和无效请求返回对应错误码")
+
+
+def test_tool_errors_are_results():
+    """测试工具的业务错误以isError结果返回"""
+    print("\n测试工具错误...")
+
+    viewer = Principal(user="agent", role=Role.VIEWER, tenant_id=settings.DEFAULT_TENANT)
+
+    async def run():
+        with use_principal(viewer):
+            denied = await call_tool("split_pdf", {"file_id": "f-1", "chapters": []})
+            invalid = await call_tool("get_task", {})
+        return denied, invalid
+
+    denied, invalid = asyncio.run(run())
+    assert denied["isError"] and "editor" in denied["content"][0]["text"]
+    assert invalid["isError"] and "参数错误" in invalid["content"][0]["text"]
+    print("✓ 权限不足和参数错误返回给Agent")
@@ -0,0 +1,95 @@
+"""
+内存控制测试，验证预算内的文档同时处理、超出预算的文档等待释放后再处理、超过总预算的文档独占执行，以及缓冲区复用
+"""
+
+import asyncio
+
+from src.core.memory import BufferPool, MemoryBudget
+
+
+def test_within_budget():
+    """测试预算内的文档同时处理"""
+    print("测试预算内并发...")
+
+    budget = MemoryBudget(100)
+
+    async def run():
+        async with budget.reserve(40, "a"):
+            async with budget.reserve(60, "b"):
+                assert budget.stats()["used_bytes"] == 100
+                assert budget.stats()["waiting"] == 0
+        assert budget.stats()["used_bytes"] == 0
+
+    asyncio.run(run())
+    print("✓ 预算内的文档无需等待")
+
+
+def test_over_budget_deferred():
+    """测试超出预算的文档等待其他任务释放"""
+    print("\n测试超出预算...")
+
+    budget = MemoryBudget(100)
+    order = []
+
+    async def worker(name: str, nbytes: int, release: asyncio.Event):
+        async with budget.reserve(nbytes, name):
+            order.append(name)
+            await release.wait()
+
+    async def run():
+        first_done, second_done = asyncio.Event(), asyncio.Event()
+        first = asyncio.create_task(worker("first", 60, first_done))
+        await asyncio.sleep(0)
+        second = asyncio.create_task(worker("second", 60, second_done))
+        for _ in range(5):
+            await asyncio.sleep(0)
+
+        assert order == ["first"], "超出预算的文档不应开始处理"
+        assert budget.stats()["used_bytes"] == 60 and budget.stats()["waiting"] == 1
+
+        first_done.set()
+        await first
+        for _ in range(5):
+            await asyncio.sleep(0)
+        assert order == ["first", "second"]
+        assert budget.stats()["used_bytes"] == 60 and budget.stats()["waiting"] == 0
+
+        second_done.set()
+        await second
+        assert budget.stats()["used_bytes"] == 0
+
+    asyncio.run(run())
+    print("✓ 超出预算的文档在其他任务释放后才开始处理")
+
+
+def test_oversized_exclusive():
+    """测试超过总预算的文档独占执行，预算为0时不限制"""
+    print("\n测试超大文档...")
+
+    async def run():
+        budget = MemoryBudget(100)
+        async with budget.reserve(500, "huge"):
+            assert budget.stats()["used_bytes"] == 100
+        assert budget.stats()["used_bytes"] == 0
+
+        unlimited = MemoryBudget(0)
+        async with unlimited.reserve(500, "a"):
+            async with unlimited.reserve(500, "b"):
+                assert unlimited.stats()["used_bytes"] == 0
+
+    asyncio.run(run())
+    print("✓ 超大文档按总预算计占满预算，未配置预算时不限制")
+
+
+def test_buffer_reuse():
+    """测试缓冲区归还后复用，池满时丢弃"""
+    print("\n测试缓冲区复用...")
+
+    pool = BufferPool(buffer_size=16, max_buffers=1)
+    with pool.buffer() as a:
+        with pool.buffer() as b:
+            assert a is not b and len(a) == len(b) == 16
+    with pool.buffer() as c:
+        assert c is a or c is b
+    assert len(pool._buffers) == 1
+    print("✓ 缓冲区归还后复用，池中最多保留max_buffers个")
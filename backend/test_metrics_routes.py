@@ -0,0 +1,181 @@
+"""
+请求指标测试，验证指标按匹配到的路由模板统计，未匹配任何路由的请求归为同一标签，
+/metrics 只允许operator访问，以及 /health/ready 的检查项和不就绪时的503
+"""
+
+import asyncio
+import json
+
+from fastapi import FastAPI
+
+import main
+from src.api.middleware import UNMATCHED_ROUTE, AccessLogMiddleware, required_role
+from src.core.config import settings
+from src.core.metrics import metrics
+from src.models.schemas import Role
+from src.services.task_service import TaskService
+
+
+def _app() -> FastAPI:
+    app = FastAPI()
+
+    @app.get("/api/task/{task_id}")
+    async def get_task(task_id: str):
+        return {"task_id": task_id}
+
+    app.add_middleware(AccessLogMiddleware)
+    return app
+
+
+async def _call(app, path: str, headers=None):
+    scope = {
+        "type": "http", "method": "GET", "path": path, "raw_path": path.encode(),
+        "query_string": b"", "headers": [(k.lower().encode(), v.encode()) for k, v in (headers or {}).items()],
+        "scheme": "http", "http_version": "1.1",
+        "server": ("test", 80), "client": ("127.0.0.1", 1234), "root_path": "",
+    }
+    sent = []
+
+    async def receive():
+        return {"type": "http.request", "body": b"", "more_body": False}
+
+    async def send(message):
+        sent.append(message)
+
+    await app(scope, receive, send)
+    body = b"".join(message.get("body", b"") for message in sent if message["type"] == "http.response.body")
+    return sent[0]["status"], body
+
+
+async def _request(app, path: str) -> int:
+    status, _ = await _call(app, path)
+    return status
+
+
+def _replica() -> TaskService:
+    """不启动工作线程和调度器的服务实例"""
+    service = TaskService()
+    service._initialized = True
+    return service
+
+
+class _BrokenStore:
+    """连接失败的存储"""
+
+    async def aget(self, *args, **kwargs):
+        raise ConnectionError("存储连接失败")
+
+
+def _readiness(task_service=None, store=None):
+    """临时替换就绪检查依赖的任务服务和存储后调用就绪检查"""
+    original_service, original_store = main.task_service, main.get_store
+    main.task_service = task_service or _replica()
+    if store is not None:
+        main.get_store = lambda: store
+    try:
+        response = asyncio.run(main.readiness_check())
+    finally:
+        main.task_service, main.get_store = original_service, original_store
+    return response.status_code, json.loads(response.body)
+
+
+def test_route_template():
+    """测试按路由模板统计"""
+    print("测试路由模板标签...")
+
+    app = _app()
+
+    async def run():
+        assert await _request(app, "/api/task/a1") == 200
+        assert await _request(app, "/api/task/b2") == 200
+        assert await _request(app, "/wp-login.php") == 404
+        assert await _request(app, "/.env") == 404
+
+    before = metrics.snapshot()["requests"]
+    asyncio.run(run())
+    after = metrics.snapshot()["requests"]
+
+    def delta(key):
+        return after.get(key, {}).get("count", 0) - before.get(key, {}).get("count", 0)
+
+    assert delta("GET /api/task/{task_id}") == 2
+    assert delta(f"GET {UNMATCHED_ROUTE}") == 2
+    assert not any(key.endswith(("/a1", "/b2", "/wp-login.php", "/.env")) for key in after)
+    print("✓ 同一路由的不同ID合并统计，未匹配路由的请求不按路径展开")
+
+
+def test_metrics_requires_operator():
+    """测试请求指标只允许operator查看"""
+    print("\n测试指标访问权限...")
+
+    assert required_role("GET", "/metrics") == Role.OPERATOR
+
+    original = settings.TENANTS
+    settings.TENANTS = {
+        settings.DEFAULT_TENANT: {
+            "api_keys": [
+                {"key": "admin-key", "user": "ada", "role": "admin"},
+                {"key": "operator-key", "user": "otto", "role": "operator"},
+            ]
+        }
+    }
+    try:
+        status, _ = asyncio.run(_call(main.app, "/metrics"))
+        assert status == 401
+        status, _ = asyncio.run(_call(main.app, "/metrics", {"X-API-Key": "admin-key"}))
+        assert status == 403, "租户管理员不能查看整个部署的指标"
+        status, body = asyncio.run(_call(main.app, "/metrics", {"X-API-Key": "operator-key"}))
+        assert status == 200
+        assert {"requests", "document_cache", "memory_budget"} <= set(json.loads(body))
+    finally:
+        settings.TENANTS = original
+    print("✓ 未认证返回401，admin返回403，operator可以查看")
+
+
+def test_readiness_fields():
+    """测试就绪检查返回的检查项和队列字段"""
+    print("\n测试就绪检查字段...")
+
+    status, body = _readiness()
+    assert status == 200 and body["status"] == "ready"
+    assert body["checks"] == {"store": "ok", "queue": "ok"}
+    assert {
+        "queue_length", "busy_workers", "total_workers", "worker_utilization",
+        "oldest_queued_seconds", "recent_finished", "recent_failed", "recent_failure_rate",
+    } <= set(body["queue"])
+    assert body["queue"]["queue_length"] == 0 and body["queue"]["busy_workers"] == 0
+    assert {"node_id", "is_leader"} <= set(body["leader"])
+    print("✓ 包含存储和队列检查、队列积压、工作线程占用、失败率和选举状态")
+
+
+def test_readiness_unavailable():
+    """测试存储或任务队列不可用、队列积压时返回503"""
+    print("\n测试不就绪...")
+
+    status, body = _readiness(store=_BrokenStore())
+    assert status == 503 and body["status"] == "not_ready"
+    assert body["checks"]["store"].startswith("error") and body["checks"]["queue"] == "ok"
+
+    broken_queue = _replica()
+
+    async def fail():
+        raise RuntimeError("任务状态读取失败")
+
+    broken_queue.get_saturation = fail
+    status, body = _readiness(task_service=broken_queue)
+    assert status == 503 and body["checks"]["queue"].startswith("error") and body["queue"] is None
+
+    saturated = _replica()
+
+    async def saturation():
+        return {"queue_length": 5}
+
+    saturated.get_saturation = saturation
+    original = settings.READY_MAX_QUEUE_LENGTH
+    settings.READY_MAX_QUEUE_LENGTH = 3
+    try:
+        status, body = _readiness(task_service=saturated)
+    finally:
+        settings.READY_MAX_QUEUE_LENGTH = original
+    assert status == 503 and body["checks"]["queue"] == "saturated"
+    print("✓ 存储不可用、任务队列不可用和排队超限时返回503")
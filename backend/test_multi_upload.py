@@ -0,0 +1,89 @@
+"""
+多文件上传测试，验证一次请求中多个files字段逐个写入、同一数据块中的多个文件按顺序分开、
+单个文件失败不影响其他文件，以及file与files不能混用
+"""
+
+import asyncio
+
+from fastapi import HTTPException
+from starlette.requests import Request
+
+from src.api.routes import upload_file
+from src.core.config import settings
+from src.models.schemas import ErrorCode
+
+BOUNDARY = "----multiboundary"
+
+
+def _body(parts) -> bytes:
+    """parts: (字段名, 值, 文件名或None)"""
+    body = b""
+    for name, value, filename in parts:
+        disposition = f'form-data; name="{name}"' + (f'; filename="{filename}"' if filename else "")
+        body += f"--{BOUNDARY}\r\nContent-Disposition: {disposition}\r\n\r\n".encode() + value + b"\r\n"
+    return body + f"--{BOUNDARY}--\r\n".encode()
+
+
+def _request(body: bytes, chunk_size: int) -> Request:
+    chunks = [body[i:i + chunk_size] for i in range(0, len(body), chunk_size)]
+
+    async def receive():
+        chunk = chunks.pop(0) if chunks else b""
+        return {"type": "http.request", "body": chunk, "more_body": bool(chunks)}
+
+    scope = {
+        "type": "http",
+        "method": "POST",
+        "path": "/api/upload",
+        "headers": [(b"content-type", f"multipart/form-data; boundary={BOUNDARY}".encode())],
+    }
+    return Request(scope, receive)
+
+
+def test_multiple_files(pdf_bytes, tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试一次上传多个文件"""
+    print("测试多文件上传...")
+
+    first, second = pdf_bytes("First"), pdf_bytes("Second")
+    monkeypatch.setattr(settings, "DEDUP_UPLOADS", False)
+    body = _body([
+        ("files", first, "a.pdf"),
+        ("files", b"not a pdf", "bad.pdf"),
+        ("files", first, "notes.txt"),
+        ("files", second, "b.pdf"),
+    ])
+    # 小块时文件头被拆开，整块时多个文件的数据在同一块中
+    for chunk_size in (7, len(body)):
+        results = asyncio.run(upload_file(_request(body, chunk_size), None))
+        assert [(r.filename, r.success) for r in results] == [
+            ("a.pdf", True), ("bad.pdf", False), ("notes.txt", False), ("b.pdf", True)
+        ]
+        assert results[1].code == ErrorCode.INVALID_REQUEST and "文件格式无效" in results[1].error
+        assert "仅支持PDF" in results[2].error and results[0].file.file_id != results[3].file.file_id
+    saved = sorted(path.read_bytes() for path in tmp_upload_dir.rglob("original.pdf"))
+    assert saved == sorted([first, second] * 2)
+    assert not list(tmp_upload_dir.rglob("original.pdf.part"))
+    print("✓ 每个文件单独写入并返回结果，格式无效或类型不符的文件不影响其他文件")
+
+
+def test_rejected_requests(pdf_bytes, tmp_upload_dir, tmp_temp_dir, monkeypatch):
+    """测试无效的多文件请求"""
+    print("\n测试无效请求...")
+
+    data = pdf_bytes("Mixed")
+    monkeypatch.setattr(settings, "DEDUP_UPLOADS", False)
+    monkeypatch.setattr(settings, "MAX_UPLOAD_FILES", 2)
+    cases = [
+        (_body([("files", data, "a.pdf"), ("file", data, "b.pdf")]), "收到 file"),
+        (_body([("file", data, "a.pdf"), ("file", data, "b.pdf")]), "只能上传一个文件"),
+        (_body([("files", data, "a.pdf"), ("files", data, "b.pdf"), ("files", data, "c.pdf")]), "最多上传 2 个文件"),
+        (_body([("files", data, "a.pdf"), ("sha256", b"0" * 64, None)]), "不支持sha256"),
+    ]
+    for body, message in cases:
+        try:
+            asyncio.run(upload_file(_request(body, 64), None))
+            assert False, f"应拒绝: {message}"
+        except HTTPException as e:
+            assert e.status_code == 400 and message in e.detail, e.detail
+        assert not list(tmp_upload_dir.rglob("original.pdf*")), message
+    print("✓ 混用file和files、文件过多或带校验和时返回400且不留下文件")
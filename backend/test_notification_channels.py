@@ -0,0 +1,202 @@
+"""
+通知渠道测试，验证Slack消息内容、邮件收件人和正文、请求级收件人白名单、按订阅事件分发，以及单个渠道失败不影响其他渠道
+"""
+
+import asyncio
+import json
+import socket
+
+import httpx
+
+from src.core.config import settings
+from src.models.schemas import NotificationChannelType, NotificationConfig
+from src.services import webhook_service as webhook_module
+from src.services.notification_service import (
+    EVENT_QUOTA_WARNING,
+    EVENT_TASK_COMPLETED,
+    EVENT_TASK_FAILED,
+    EmailChannel,
+    NotificationChannel,
+    NotificationService,
+    SlackChannel,
+    WebhookChannel,
+)
+
+
+class FakeChannel(NotificationChannel):
+    """记录收到的通知，可设置为发送失败"""
+
+    def __init__(self, events=None, fail: bool = False):
+        super().__init__(events)
+        self.fail = fail
+        self.sent = []
+
+    async def send(self, event, payload):
+        if self.fail:
+            raise RuntimeError("渠道不可用")
+        self.sent.append((event, payload))
+
+
+def test_slack_message():
+    """测试Slack渠道发送摘要文本"""
+    print("测试Slack通知...")
+
+    requests = []
+    client_class = httpx.AsyncClient
+    resolver = socket.getaddrinfo
+
+    def client(*args, **kwargs):
+        def handle(request: httpx.Request) -> httpx.Response:
+            requests.append(request)
+            return httpx.Response(200)
+        return client_class(transport=httpx.MockTransport(handle))
+
+    def resolve(host, port, *args, **kwargs):
+        assert host == "hooks.slack.example"
+        return [(socket.AF_INET, socket.SOCK_STREAM, 6, "", ("93.184.216.34", port or 0))]
+
+    webhook_module.httpx.AsyncClient = client
+    webhook_module.socket.getaddrinfo = resolve
+    try:
+        channel = SlackChannel("https://hooks.slack.example/T1")
+        asyncio.run(channel.send(EVENT_TASK_COMPLETED, {"task_id": "t1", "files": 3}))
+        asyncio.run(channel.send(EVENT_TASK_FAILED, {"task_id": "t2", "error": "页面损坏"}))
+    finally:
+        webhook_module.httpx.AsyncClient = client_class
+        webhook_module.socket.getaddrinfo = resolver
+
+    # 请求级地址连接解析校验过的IP，Host和SNI仍为原域名
+    assert [str(request.url) for request in requests] == ["https://93.184.216.34/T1"] * 2
+    assert all(request.headers["Host"] == "hooks.slack.example" for request in requests)
+    assert all(request.extensions["sni_hostname"] == "hooks.slack.example" for request in requests)
+    texts = [json.loads(request.content)["text"] for request in requests]
+    assert "t1" in texts[0] and "3 个文件" in texts[0]
+    assert "t2" in texts[1] and "页面损坏" in texts[1]
+    print("✓ Slack消息包含任务ID、生成文件数和失败原因")
+
+
+def test_email_message():
+    """测试邮件渠道的收件人和正文，未配置SMTP时发送失败"""
+    print("\n测试邮件通知...")
+
+    original_host, original_from = settings.SMTP_HOST, settings.SMTP_FROM
+    original_deliver = EmailChannel._deliver
+    delivered = []
+    EmailChannel._deliver = staticmethod(delivered.append)
+    try:
+        channel = EmailChannel(["ops@example.com", "dev@example.com"])
+        settings.SMTP_HOST = ""
+        try:
+            asyncio.run(channel.send(EVENT_TASK_COMPLETED, {"task_id": "t1"}))
+            assert False, "未配置SMTP时应拒绝发送"
+        except ValueError:
+            pass
+        assert delivered == []
+
+        settings.SMTP_HOST, settings.SMTP_FROM = "smtp.example.com", "splitter@example.com"
+        asyncio.run(channel.send(EVENT_QUOTA_WARNING, {"message": "存储已用90%"}))
+    finally:
+        EmailChannel._deliver = original_deliver
+        settings.SMTP_HOST, settings.SMTP_FROM = original_host, original_from
+
+    message = delivered[0]
+    assert message["To"] == "ops@example.com, dev@example.com" and message["From"] == "splitter@example.com"
+    assert EVENT_QUOTA_WARNING in message["Subject"]
+    assert "存储已用90%" in message.get_content()
+    print("✓ 邮件发给全部收件人，正文为事件摘要，未配置SMTP时不发送")
+
+
+def test_dispatch_by_event():
+    """测试按订阅事件分发，失败的渠道不影响其他渠道"""
+    print("\n测试通知分发...")
+
+    service = NotificationService()
+    all_events = FakeChannel()
+    failed_only = FakeChannel(events=[EVENT_TASK_FAILED])
+    broken = FakeChannel(fail=True)
+    service.global_channels = [all_events, failed_only, broken]
+
+    assert asyncio.run(service.notify(EVENT_TASK_COMPLETED, {"task_id": "t1"})) == 1
+    assert asyncio.run(service.notify(EVENT_TASK_FAILED, {"task_id": "t2"})) == 2
+    assert asyncio.run(service.notify("task.unknown", {})) == 0
+    assert [event for event, _ in all_events.sent] == [EVENT_TASK_COMPLETED, EVENT_TASK_FAILED]
+    assert [payload["task_id"] for _, payload in failed_only.sent] == ["t2"]
+    print("✓ 只通知订阅了该事件的渠道，单个渠道失败时其余渠道照常发送")
+
+
+def test_build_channel():
+    """测试根据请求级配置创建渠道，无效配置被忽略"""
+    print("\n测试请求级通知配置...")
+
+    original = settings.NOTIFY_ALLOW_PRIVATE_URLS, settings.NOTIFY_EMAIL_ALLOWLIST
+    settings.NOTIFY_ALLOW_PRIVATE_URLS = True
+    settings.NOTIFY_EMAIL_ALLOWLIST = ["example.com"]
+    try:
+        slack = NotificationService.build_channel(NotificationConfig(type=NotificationChannelType.SLACK, url="https://hooks.example/s"))
+        webhook = NotificationService.build_channel(NotificationConfig(
+            type=NotificationChannelType.WEBHOOK, url="https://hooks.example/w",
+            headers={"X-Token": "abc"}, events=[EVENT_TASK_FAILED]
+        ))
+        email = NotificationService.build_channel(NotificationConfig(type=NotificationChannelType.EMAIL, recipients=["a@example.com"]))
+    finally:
+        settings.NOTIFY_ALLOW_PRIVATE_URLS, settings.NOTIFY_EMAIL_ALLOWLIST = original
+
+    assert isinstance(slack, SlackChannel) and slack.events == list(settings.NOTIFY_EVENTS)
+    assert isinstance(webhook, WebhookChannel) and webhook.headers == {"X-Token": "abc"}
+    assert webhook.accepts(EVENT_TASK_FAILED) and not webhook.accepts(EVENT_TASK_COMPLETED)
+    assert not webhook.global_channel, "请求级Webhook不使用全局签名密钥"
+    assert isinstance(email, EmailChannel) and email.recipients == ["a@example.com"]
+
+    for kwargs in ({"type": "slack"}, {"type": "email"}):
+        try:
+            NotificationConfig(**kwargs)
+            assert False, f"缺少地址或收件人时应拒绝: {kwargs}"
+        except ValueError:
+            pass
+
+    service = NotificationService()
+    service.global_channels = []
+    ftp = NotificationConfig(type=NotificationChannelType.WEBHOOK, url="ftp://hooks.example/w")
+    assert asyncio.run(service.notify(EVENT_TASK_COMPLETED, {}, [ftp])) == 0
+    print("✓ Slack、Webhook和邮件渠道按配置创建，未指定事件时订阅全局默认事件，无效配置被忽略")
+
+
+def test_email_recipient_allowlist():
+    """测试请求级邮件收件人只能是允许的地址或域名"""
+    print("\n测试邮件收件人白名单...")
+
+    def email(*recipients):
+        return NotificationConfig(type=NotificationChannelType.EMAIL, recipients=list(recipients))
+
+    original = settings.NOTIFY_EMAIL_ALLOWLIST
+    try:
+        # 未配置白名单时不接受请求级邮件通知
+        settings.NOTIFY_EMAIL_ALLOWLIST = []
+        try:
+            NotificationService.validate([email("a@example.com")])
+            assert False, "未配置白名单时应拒绝"
+        except ValueError:
+            pass
+
+        settings.NOTIFY_EMAIL_ALLOWLIST = ["example.com", "ops@partner.org"]
+        NotificationService.validate([email("a@example.com", "OPS@partner.org")])
+        for recipient in ("a@evil.com", "b@partner.org", "a@sub.example.com", "a@example.com, x@evil.com", "a@example.com\nBcc: x@evil.com"):
+            try:
+                NotificationService.validate([email(recipient)])
+                assert False, f"应拒绝收件人: {recipient!r}"
+            except ValueError:
+                pass
+
+        # 创建任务后收紧白名单，发送时按当前配置重新校验
+        service = NotificationService()
+        service.global_channels = []
+        settings.NOTIFY_EMAIL_ALLOWLIST = ["partner.org"]
+        try:
+            NotificationService.build_channel(email("a@example.com"))
+            assert False, "发送时应按当前白名单拒绝"
+        except ValueError:
+            pass
+        assert asyncio.run(service.notify(EVENT_TASK_COMPLETED, {}, [email("a@example.com")])) == 0
+    finally:
+        settings.NOTIFY_EMAIL_ALLOWLIST = original
+    print("✓ 只向白名单中的地址和域名发送邮件，其他收件人被拒绝")
@@ -0,0 +1,157 @@
+"""
+通知测试，验证请求级通知地址不能指向内网（包括发送时才解析到内网）、配额预警按租户限频，以及任务接口不返回通知配置
+"""
+
+import asyncio
+import socket
+
+import httpx
+
+from src.api import routes
+from src.core.config import settings
+from src.models.schemas import TASK_PRIVATE_FIELDS, NotificationChannelType, NotificationConfig
+from src.services import webhook_service as webhook_module
+from src.services.notification_service import (
+    EVENT_QUOTA_WARNING,
+    EVENT_TASK_COMPLETED,
+    NotificationService,
+    validate_notification_url,
+)
+
+
+def test_notification_url():
+    """测试通知地址校验"""
+    print("测试通知地址校验...")
+
+    validate_notification_url("https://93.184.216.34/hooks/split")
+    rejected = [
+        "ftp://93.184.216.34/hook",
+        "file:///etc/passwd",
+        "http://127.0.0.1:8080/api/admin/config",
+        "http://10.0.0.5/hook",
+        "http://169.254.169.254/latest/meta-data/",
+        "http://[::1]/hook",
+        "http://[::ffff:192.168.1.1]/hook",
+        "http://0.0.0.0/hook",
+    ]
+    for url in rejected:
+        try:
+            validate_notification_url(url)
+            assert False, f"应拒绝: {url}"
+        except ValueError:
+            pass
+
+    original = settings.NOTIFY_ALLOW_PRIVATE_URLS
+    settings.NOTIFY_ALLOW_PRIVATE_URLS = True
+    try:
+        validate_notification_url("http://10.0.0.5/hook")
+        try:
+            validate_notification_url("gopher://10.0.0.5/hook")
+            assert False, "允许内网地址时仍只支持http(s)"
+        except ValueError:
+            pass
+    finally:
+        settings.NOTIFY_ALLOW_PRIVATE_URLS = original
+
+    service = NotificationService()
+    config = NotificationConfig(type=NotificationChannelType.WEBHOOK, url="http://127.0.0.1:6379/")
+    for action in (lambda: service.validate([config]), lambda: service.build_channel(config)):
+        try:
+            action()
+            assert False, "创建任务和发送通知时都应拒绝内网地址"
+        except ValueError:
+            pass
+    print("✓ 只允许http(s)公网地址，内网、本机和元数据地址在创建任务和发送前都被拒绝")
+
+
+def test_rebinding_rejected_at_send_time():
+    """测试创建任务时解析到公网、发送时解析到内网的地址不会被请求"""
+    print("\n测试发送时重新校验地址...")
+
+    resolved = {"hooks.example.com": "93.184.216.34"}
+    requests = []
+    client_class = httpx.AsyncClient
+    resolver = socket.getaddrinfo
+
+    def client(*args, **kwargs):
+        def handle(request: httpx.Request) -> httpx.Response:
+            requests.append(request)
+            return httpx.Response(200)
+        return client_class(transport=httpx.MockTransport(handle))
+
+    def resolve(host, port, *args, **kwargs):
+        return [(socket.AF_INET, socket.SOCK_STREAM, 6, "", (resolved[host], port or 0))]
+
+    config = NotificationConfig(type=NotificationChannelType.SLACK, url="https://hooks.example.com/T1")
+    webhook_module.httpx.AsyncClient = client
+    webhook_module.socket.getaddrinfo = resolve
+    try:
+        service = NotificationService()
+        service.global_channels = []
+        service.validate([config])
+        channel = service.build_channel(config)
+
+        # 校验通过后域名改为解析到云平台元数据地址
+        resolved["hooks.example.com"] = "169.254.169.254"
+        try:
+            asyncio.run(channel.send(EVENT_TASK_COMPLETED, {"task_id": "t1"}))
+            assert False, "发送时解析到内网地址应拒绝"
+        except ValueError as e:
+            assert "内网" in str(e)
+        assert asyncio.run(service.notify(EVENT_TASK_COMPLETED, {"task_id": "t1"}, [config])) == 0
+
+        resolved["hooks.example.com"] = "93.184.216.35"
+        assert asyncio.run(service.notify(EVENT_TASK_COMPLETED, {"task_id": "t1"}, [config])) == 1
+    finally:
+        webhook_module.httpx.AsyncClient = client_class
+        webhook_module.socket.getaddrinfo = resolver
+
+    # 只有最后一次发送发出了请求，连接的是发送时校验过的IP
+    assert [request.url.host for request in requests] == ["93.184.216.35"]
+    assert requests[0].headers["Host"] == "hooks.example.com"
+    print("✓ 发送时重新解析并校验地址，只连接校验过的公网IP")
+
+
+def test_quota_warning_interval():
+    """测试配额预警按租户限频"""
+    print("\n测试配额预警限频...")
+
+    sent = []
+
+    async def notify(event, payload, configs=None):
+        sent.append((event, payload["tenant_id"]))
+        return 1
+
+    service = NotificationService()
+    service.notify = notify
+
+    async def run():
+        assert await service.notify_quota_warning("90%", tenant_id="team-a") == 1
+        assert await service.notify_quota_warning("91%", tenant_id="team-a") == 0
+        assert await service.notify_quota_warning("95%", tenant_id="team-b") == 1
+
+    original = settings.QUOTA_WARNING_INTERVAL
+    settings.QUOTA_WARNING_INTERVAL = 3600
+    try:
+        asyncio.run(run())
+        assert sent == [(EVENT_QUOTA_WARNING, "team-a"), (EVENT_QUOTA_WARNING, "team-b")]
+
+        settings.QUOTA_WARNING_INTERVAL = 0
+        asyncio.run(service.notify_quota_warning("92%", tenant_id="team-a"))
+        assert len(sent) == 3
+    finally:
+        settings.QUOTA_WARNING_INTERVAL = original
+    print("✓ 同一租户在间隔内只预警一次，不同租户互不影响")
+
+
+def test_task_response_excludes_notifications():
+    """测试任务接口不返回通知、投递和导出配置"""
+    print("\n测试任务响应字段...")
+
+    paths = {"/tasks", "/task/{task_id}"}
+    checked = [route for route in routes.router.routes if getattr(route, "path", "") in paths and "GET" in route.methods]
+    assert len(checked) == 2
+    for route in checked:
+        assert route.response_model_exclude == TASK_PRIVATE_FIELDS
+    assert "notifications" in TASK_PRIVATE_FIELDS
+    print("✓ 任务列表和任务详情排除通知地址和请求头")
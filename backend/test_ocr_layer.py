@@ -0,0 +1,78 @@
+"""
+OCR文字层测试，用模拟的Tesseract输出验证扫描页写入不可见文字、已有文字的页面不重复识别
+"""
+
+import asyncio
+
+import fitz
+
+from src.services import ocr_layer
+from src.services.ink_saving import INVISIBLE_TEXT, has_visible_text
+from src.services.ocr_layer import add_text_layer
+
+
+def _scanned_doc() -> fitz.Document:
+    """第1、3页为整页图片的扫描页（第3页已有OCR文字层），第2页为普通文字页"""
+    doc = fitz.open()
+    pixmap = fitz.Pixmap(fitz.csGRAY, fitz.IRect(0, 0, 100, 140), False)
+    pixmap.clear_with(255)
+    doc.new_page().insert_image(fitz.Rect(0, 0, 595, 842), pixmap=pixmap)
+    doc.new_page().insert_text((72, 72), "Text page")
+    scanned = doc.new_page()
+    scanned.insert_image(fitz.Rect(0, 0, 595, 842), pixmap=pixmap)
+    scanned.insert_text((72, 72), "Existing layer", render_mode=INVISIBLE_TEXT)
+    return doc
+
+
+def _text_only_pdf(text: str) -> bytes:
+    """模拟Tesseract textonly_pdf输出：只含不可见文字的单页PDF"""
+    layer = fitz.open()
+    layer.new_page(width=595, height=842).insert_text((72, 100), text, render_mode=INVISIBLE_TEXT)
+    data = layer.tobytes()
+    layer.close()
+    return data
+
+
+def _run(doc: fitz.Document, output: bytes):
+    calls = []
+
+    async def fake_tesseract(image, options):
+        calls.append(options)
+        return output
+
+    original = (ocr_layer.run_tesseract, ocr_layer.tesseract_available)
+    ocr_layer.run_tesseract = fake_tesseract
+    ocr_layer.tesseract_available = lambda: True
+    try:
+        return asyncio.run(add_text_layer(doc)), calls
+    finally:
+        ocr_layer.run_tesseract, ocr_layer.tesseract_available = original
+
+
+def test_text_layer():
+    """测试只为没有文字的扫描页写入不可见文字"""
+    print("测试写入文字层...")
+
+    doc = _scanned_doc()
+    pages, calls = _run(doc, _text_only_pdf("Recognized chapter text"))
+
+    assert pages == [1] and len(calls) == 1
+    assert "textonly_pdf=1" in calls[0] and calls[0][-1] == "pdf"
+    assert "Recognized chapter text" in doc[0].get_text()
+    assert not has_visible_text(doc[0])
+    assert doc[0].search_for("Recognized")
+    assert "Recognized" not in doc[2].get_text()
+    print("✓ 扫描页可搜索，外观不变，已有文字层的页面不重复识别")
+
+
+def test_unrecognized():
+    """测试识别失败或没有文字时不修改页面"""
+    print("\n测试识别失败...")
+
+    doc = _scanned_doc()
+    pages, _ = _run(doc, b"")
+    assert pages == [] and not doc[0].get_text().strip()
+
+    pages, _ = _run(doc, _text_only_pdf(""))
+    assert pages == [] and not doc[0].get_text().strip()
+    print("✓ 没有识别结果时页面保持原样")
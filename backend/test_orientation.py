@@ -0,0 +1,83 @@
+"""
+扫描页方向和倾斜纠正测试，用模拟的Tesseract输出验证方向检测、倾斜估计和页面纠正
+"""
+
+import asyncio
+import math
+
+import fitz
+
+from src.core.config import settings
+from src.services import orientation
+from src.services.orientation import PageCorrection, correct_orientation
+
+HOCR_LINE = "<span class='ocr_line' id='line_1_{0}' title=\"bbox 10 {0}0 400 {0}5; baseline {1} -4; x_size 20\">"
+
+
+def _scanned_doc() -> fitz.Document:
+    """第1页为整页图片的扫描页，第2页为普通文字页"""
+    doc = fitz.open()
+    pixmap = fitz.Pixmap(fitz.csGRAY, fitz.IRect(0, 0, 100, 140), False)
+    pixmap.clear_with(255)
+    doc.new_page().insert_image(fitz.Rect(0, 0, 595, 842), pixmap=pixmap)
+    doc.new_page().insert_text((72, 72), "Text page")
+    return doc
+
+
+def _run(doc: fitz.Document, osd: str, hocr: str):
+    """用给定的OSD和hOCR输出代替Tesseract执行纠正"""
+    calls = []
+
+    async def fake_tesseract(image, options):
+        calls.append(options)
+        return (osd if options == ["--psm", "0"] else hocr).encode()
+
+    original = (orientation.run_tesseract, orientation.tesseract_available)
+    orientation.run_tesseract = fake_tesseract
+    orientation.tesseract_available = lambda: True
+    try:
+        return asyncio.run(correct_orientation(doc)), calls
+    finally:
+        orientation.run_tesseract, orientation.tesseract_available = original
+
+
+def test_rotation():
+    """测试按OSD结果旋转扫描页，文字页不检测"""
+    print("测试方向纠正...")
+
+    doc = _scanned_doc()
+    corrections, calls = _run(doc, "Orientation in degrees: 90\nRotate: 270\nOrientation confidence: 21.3\n", "")
+
+    assert corrections == [PageCorrection(page=1, rotation=90, skew=0.0)]
+    assert doc[0].rotation == 90 and doc[1].rotation == 0
+    assert len(calls) == 2
+    print("✓ 扫描页按检测到的方向旋转")
+
+
+def test_deskew():
+    """测试按文本行基线斜率的中位数纠正倾斜"""
+    print("\n测试倾斜纠正...")
+
+    doc = _scanned_doc()
+    hocr = "".join(HOCR_LINE.format(i, slope) for i, slope in enumerate([0.035, 0.03, 0.04, -0.5], start=1))
+    corrections, _ = _run(doc, "", hocr)
+
+    expected = round(math.degrees(math.atan(0.0375)), 2)
+    assert corrections == [PageCorrection(page=1, rotation=0, skew=expected)]
+    assert len(doc) == 2 and doc[0].rect == fitz.Rect(0, 0, 595, 842)
+    assert "Text page" in doc[1].get_text()
+    print(f"✓ 倾斜 {expected} 度的页面被重新绘制，页数和尺寸不变")
+
+
+def test_thresholds():
+    """测试置信度不足的方向和过小的倾斜不纠正"""
+    print("\n测试纠正阈值...")
+
+    doc = _scanned_doc()
+    osd = f"Orientation in degrees: 180\nOrientation confidence: {settings.ORIENTATION_MIN_CONFIDENCE - 1}\n"
+    hocr = "".join(HOCR_LINE.format(i, 0.001) for i in range(1, 5))
+    corrections, _ = _run(doc, osd, hocr)
+
+    assert corrections == []
+    assert doc[0].rotation == 0
+    print("✓ 低置信度方向和微小倾斜保持原样")
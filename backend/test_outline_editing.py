@@ -0,0 +1,95 @@
+"""
+书签编辑测试，验证书签树的读取、编辑后写入新副本、页码校验以及旧副本的清理
+"""
+
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import OutlineItem
+from src.services.outline_service import OUTLINE_FILENAME_PREFIX, outline_service
+
+
+# 测试文档的书签（共8页）
+OUTLINE = [
+    [1, "Part I", 1],
+    [2, "Chapter 1", 1],
+    [3, "1.1 Broken", 2],
+    [2, "Chapter 2", 4],
+    [1, "Part II", 6],
+]
+
+
+def test_read_tree(make_pdf):
+    """测试扁平书签转换为嵌套树"""
+    print("测试读取书签树...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        make_pdf(source, 8, toc=OUTLINE)
+        items, page_count = outline_service.read(source)
+
+    assert page_count == 8
+    assert [item.title for item in items] == ["Part I", "Part II"]
+    assert [child.title for child in items[0].children] == ["Chapter 1", "Chapter 2"]
+    assert items[0].children[0].children[0] == OutlineItem(title="1.1 Broken", page=2)
+    print("✓ 书签按层级嵌套")
+
+
+def test_write_edits(make_pdf):
+    """测试改名、移动、删除和新增书签后生成新副本"""
+    print("\n测试写入书签...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        make_pdf(source, 8, toc=OUTLINE)
+        output_dir = Path(tmp) / "chapters"
+        items, _ = outline_service.read(source)
+
+        # 改名并修正页码、把第2章移到第二部分、删除第二部分原有位置的空书签、新增无跳转目标的分组
+        part_one, part_two = items
+        chapter_one, chapter_two = part_one.children
+        chapter_one.children[0] = OutlineItem(title="1.1 Fixed", page=3)
+        part_one.children = [chapter_one]
+        part_two.children = [chapter_two.model_copy(update={"page": 6})]
+        edited = [part_one, part_two, OutlineItem(title="Extras", children=[OutlineItem(title="Index", page=8)])]
+
+        filename, bookmarks = outline_service.write(source, output_dir, edited)
+        assert filename.startswith(OUTLINE_FILENAME_PREFIX) and bookmarks == 7
+
+        with fitz.open(str(output_dir / filename)) as copy:
+            toc = copy.get_toc(simple=True)
+        assert [entry[:2] for entry in toc] == [
+            [1, "Part I"], [2, "Chapter 1"], [3, "1.1 Fixed"],
+            [1, "Part II"], [2, "Chapter 2"],
+            [1, "Extras"], [2, "Index"],
+        ]
+        assert toc[2][2] == 3 and toc[4][2] == 6 and toc[5][2] <= 0
+        assert outline_service.read(output_dir / filename)[0] == edited
+
+        # 原文件不变
+        assert outline_service.read(source)[0][0].children[0].children[0].title == "1.1 Broken"
+
+        # 再次编辑生成新文件名并删除上一份副本，删除全部书签也是合法编辑
+        second, bookmarks = outline_service.write(source, output_dir, [])
+        assert second != filename and bookmarks == 0
+        assert sorted(p.name for p in output_dir.iterdir()) == [second]
+    print("✓ 生成新副本，原文件不变，旧副本被删除")
+
+
+def test_invalid_page(make_pdf):
+    """测试指向不存在页面的书签被拒绝"""
+    print("\n测试页码校验...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        make_pdf(source, 8, toc=OUTLINE)
+        output_dir = Path(tmp) / "chapters"
+        try:
+            outline_service.write(source, output_dir, [OutlineItem(title="Beyond", page=9)])
+            assert False, "应拒绝超出页数的书签"
+        except ValueError as e:
+            assert "超出总页数 8" in str(e)
+        assert list(output_dir.iterdir()) == []
+    print("✓ 超出页数时返回错误且不留下临时文件")
@@ -0,0 +1,71 @@
+"""
+输出缓存测试，验证缓存键只随文件和影响输出的选项变化，以及已有输出的复用条件
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo, SplitTask, TaskPriority
+from src.services.pdf_splitter import PDFSplitter
+from src.services.task_service import TaskService
+
+
+CHAPTERS = [
+    ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2),
+    ChapterInfo(title="第二章", start_page=3, end_page=3, page_count=1),
+]
+
+
+def _task(**kwargs) -> SplitTask:
+    return SplitTask(task_id="t", file_id="f", chapters=CHAPTERS, **kwargs)
+
+
+def test_cache_key():
+    """测试缓存键的组成"""
+    print("测试输出缓存键...")
+
+    key = TaskService._output_cache_key(_task(), "hash-a")
+    assert key == TaskService._output_cache_key(_task(task_id="other", priority=TaskPriority.HIGH), "hash-a")
+    assert key != TaskService._output_cache_key(_task(), "hash-b")
+    assert key != TaskService._output_cache_key(_task(watermark_text="内部资料"), "hash-a")
+    assert key != TaskService._output_cache_key(_task(chapters=CHAPTERS[:1]), "hash-a")
+    print("✓ 任务ID和优先级不影响缓存键，文件内容、章节和输出选项会改变缓存键")
+
+
+def test_cached_outputs():
+    """测试只有全部成功且文件完整的输出才可复用"""
+    print("\n测试复用已有输出...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        doc = fitz.open()
+        for i in range(3):
+            doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+        doc.save(str(source))
+        doc.close()
+
+        output_dir = Path(tmp) / "chapters"
+        task = _task()
+        task.cache_key = TaskService._output_cache_key(task, "hash-a")
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source), CHAPTERS, str(output_dir), cache_key=task.cache_key
+        ))
+
+        assert TaskService._cached_outputs(task, output_dir) == links
+        other = _task(optimize=True)
+        other.cache_key = TaskService._output_cache_key(other, "hash-a")
+        assert TaskService._cached_outputs(other, output_dir) is None
+
+        # 输出文件被修改或删除后不再复用
+        with open(output_dir / links[0], "ab") as f:
+            f.write(b"\n")
+        assert TaskService._cached_outputs(task, output_dir) is None
+
+        # 部分章节失败时不记录缓存键
+        failing = CHAPTERS + [ChapterInfo(title="越界", start_page=10, end_page=10, page_count=1)]
+        asyncio.run(PDFSplitter().split_pdf(str(source), failing, str(output_dir), cache_key=task.cache_key))
+        assert TaskService._cached_outputs(task, output_dir) is None
+    print("✓ 输出完整时复用，文件变化或部分失败时重新拆分")
@@ -0,0 +1,170 @@
+"""
+共享输出存储测试，用内存中的假S3客户端验证上传、拉取和流式读取，以及重新拆分和删除后本地副本随之更新
+"""
+
+import asyncio
+import hashlib
+import io
+import json
+import tempfile
+from pathlib import Path
+
+from src.core.config import settings
+from src.services.output_store import VERSION_FILENAME, OutputStore
+from src.services.pdf_splitter import MANIFEST_FILENAME
+
+
+class NotFound(Exception):
+    """模拟botocore的ClientError"""
+
+    def __init__(self):
+        super().__init__("NoSuchKey")
+        self.response = {"Error": {"Code": "NoSuchKey"}}
+
+
+class FakeS3:
+    """实现测试用到的boto3客户端方法"""
+
+    def __init__(self):
+        self.objects = {}
+
+    def upload_file(self, path, bucket, key):
+        self.objects[(bucket, key)] = Path(path).read_bytes()
+
+    def download_file(self, bucket, key, path):
+        if (bucket, key) not in self.objects:
+            raise NotFound()
+        Path(path).write_bytes(self.objects[(bucket, key)])
+
+    def get_object(self, Bucket, Key):
+        if (Bucket, Key) not in self.objects:
+            raise NotFound()
+        data = self.objects[(Bucket, Key)]
+        return {"Body": io.BytesIO(data), "ContentLength": len(data)}
+
+    def head_object(self, Bucket, Key):
+        if (Bucket, Key) not in self.objects:
+            raise NotFound()
+        return {"ETag": f'"{hashlib.md5(self.objects[(Bucket, Key)]).hexdigest()}"'}
+
+    def delete_object(self, Bucket, Key):
+        self.objects.pop((Bucket, Key), None)
+
+    def delete_objects(self, Bucket, Delete):
+        for item in Delete["Objects"]:
+            self.objects.pop((Bucket, item["Key"]), None)
+
+    def get_paginator(self, operation):
+        objects = self.objects
+
+        class Paginator:
+            def paginate(self, Bucket, Prefix):
+                yield {"Contents": [{"Key": key} for bucket, key in objects if bucket == Bucket and key.startswith(Prefix)]}
+
+        return Paginator()
+
+    def generate_presigned_url(self, operation, Params, ExpiresIn):
+        return f"https://s3.example.com/{Params['Bucket']}/{Params['Key']}?expires={ExpiresIn}"
+
+
+def _write_outputs(output_dir: Path) -> None:
+    output_dir.mkdir(parents=True)
+    (output_dir / "01_第1章.pdf").write_bytes(b"%PDF-chapter-1")
+    (output_dir / "02_第2章.pdf").write_bytes(b"%PDF-chapter-2")
+    manifest = {
+        "files": [
+            {"filename": name, "title": name, "start_page": 1, "end_page": 1, "pages": 1, "size": 14, "sha256": "0" * 64}
+            for name in ("01_第1章.pdf", "02_第2章.pdf")
+        ]
+    }
+    (output_dir / MANIFEST_FILENAME).write_text(json.dumps(manifest, ensure_ascii=False), encoding="utf-8")
+
+
+def test_publish_and_fetch():
+    """测试上传后在另一个副本拉取、流式读取和签名URL"""
+    print("测试共享输出存储...")
+
+    original = (settings.OUTPUT_STORE, settings.OUTPUT_S3_BUCKET)
+    settings.OUTPUT_STORE, settings.OUTPUT_S3_BUCKET = "s3", "outputs-bucket"
+    try:
+        store = OutputStore()
+        store._s3 = FakeS3()
+        assert store.enabled
+
+        with tempfile.TemporaryDirectory() as tmp:
+            node_a = Path(tmp) / "a" / "chapters"
+            node_b = Path(tmp) / "b" / "chapters"
+            _write_outputs(node_a)
+
+            async def run():
+                published = await store.publish("acme", "f-1", node_a, ["01_第1章.pdf", "02_第2章.pdf"])
+                assert published == 3
+                assert ("outputs-bucket", "outputs/acme/f-1/manifest.json") in store._s3.objects
+
+                # 另一个副本拉取到本地
+                assert await store.fetch("acme", "f-1", node_b) is True
+                assert (node_b / "02_第2章.pdf").read_bytes() == b"%PDF-chapter-2"
+                assert (node_b / MANIFEST_FILENAME).exists()
+                assert await store.fetch("other", "f-1", Path(tmp) / "c") is False
+
+                chunks, size = await store.open("acme", "f-1", "01_第1章.pdf")
+                assert size == 14 and b"".join([chunk async for chunk in chunks]) == b"%PDF-chapter-1"
+                assert await store.open("acme", "f-1", "missing.pdf") is None
+
+                url = await store.signed_url("acme", "f-1", "01_第1章.pdf")
+                assert url.startswith("https://s3.example.com/outputs-bucket/outputs/acme/f-1/")
+                assert await store.signed_url("acme", "f-1", "missing.pdf") is None
+
+            asyncio.run(run())
+    finally:
+        settings.OUTPUT_STORE, settings.OUTPUT_S3_BUCKET = original
+    print("✓ 章节输出可由任意副本拉取、转发或重定向")
+
+
+def test_version_and_delete():
+    """测试重新拆分后更新本地副本、删除后本地副本失效"""
+    print("\n测试本地副本版本...")
+
+    original = (settings.OUTPUT_STORE, settings.OUTPUT_S3_BUCKET)
+    settings.OUTPUT_STORE, settings.OUTPUT_S3_BUCKET = "s3", "outputs-bucket"
+    try:
+        store = OutputStore()
+        store._s3 = FakeS3()
+
+        with tempfile.TemporaryDirectory() as tmp:
+            node_a = Path(tmp) / "a" / "chapters"
+            node_b = Path(tmp) / "b" / "chapters"
+            _write_outputs(node_a)
+            names = ["01_第1章.pdf", "02_第2章.pdf"]
+
+            async def run():
+                await store.publish("acme", "f-1", node_a, names)
+                version = await store.manifest_version("acme", "f-1")
+                assert version and OutputStore.local_version(node_a) == version, "执行拆分的副本记录上传的版本"
+
+                await store.fetch("acme", "f-1", node_b)
+                assert OutputStore.local_version(node_b) == version
+
+                # 重新拆分后同名章节内容变化，其他副本按新版本覆盖
+                (node_a / "01_第1章.pdf").write_bytes(b"%PDF-chapter-1-v2")
+                manifest = json.loads((node_a / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+                manifest["files"][0]["size"] = 17
+                (node_a / MANIFEST_FILENAME).write_text(json.dumps(manifest, ensure_ascii=False), encoding="utf-8")
+                await store.publish("acme", "f-1", node_a, names)
+                new_version = await store.manifest_version("acme", "f-1")
+                assert new_version != OutputStore.local_version(node_b)
+                await store.fetch("acme", "f-1", node_b)
+                assert (node_b / "01_第1章.pdf").read_bytes() == b"%PDF-chapter-1-v2"
+                assert OutputStore.local_version(node_b) == new_version
+                assert not list(node_b.glob(".*.part"))
+
+                assert await store.delete("acme", "f-1") == 2
+                assert not store._s3.objects
+                assert await store.manifest_version("acme", "f-1") is None
+                assert await store.fetch("acme", "f-1", node_b) is False
+
+            asyncio.run(run())
+            assert (node_b / VERSION_FILENAME).exists()
+    finally:
+        settings.OUTPUT_STORE, settings.OUTPUT_S3_BUCKET = original
+    print("✓ 本地副本按校验清单版本更新，删除后共享存储中不再保留任何章节")
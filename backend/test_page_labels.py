@@ -0,0 +1,90 @@
+"""
+逻辑页码测试，验证读取PDF页码标签、为章节标注起止标签，以及按逻辑页码提交的章节换算为物理页码（包括重复的标签）
+"""
+
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+# 8页：前言 i-iii，第一部分 1-3，第二部分重新从1开始
+LABELS = ["i", "ii", "iii", "1", "2", "3", "1", "2"]
+
+
+def _labelled_pdf(make_pdf, path: Path) -> Path:
+    make_pdf(path, len(LABELS))
+    doc = fitz.open(str(path))
+    doc.set_page_labels([
+        {"startpage": 0, "style": "r", "firstpagenum": 1},
+        {"startpage": 3, "style": "D", "firstpagenum": 1},
+        {"startpage": 6, "style": "D", "firstpagenum": 1},
+    ])
+    doc.saveIncr()
+    doc.close()
+    return path
+
+
+def _chapter(title: str, start_label: str, end_label: str) -> ChapterInfo:
+    """按逻辑页码提交的章节，物理页码待换算"""
+    return ChapterInfo(title=title, start_page=1, end_page=1, page_count=1, start_label=start_label, end_label=end_label)
+
+
+def test_read_labels(make_pdf):
+    """测试读取和标注页码标签"""
+    print("测试读取页码标签...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        labelled = _labelled_pdf(make_pdf, Path(tmp) / "labelled.pdf")
+        plain = make_pdf(Path(tmp) / "plain.pdf", 3)
+
+        labels = analyzer.get_page_labels_from_file(str(labelled))
+        assert labels == LABELS
+        assert analyzer.get_page_labels_from_file(str(plain)) == [], "未定义页码标签时不返回物理页码"
+
+    chapters = [
+        ChapterInfo(title="前言", start_page=1, end_page=3, page_count=3),
+        ChapterInfo(title="第一部分", start_page=4, end_page=6, page_count=3),
+    ]
+    annotated = analyzer._annotate_page_labels(chapters, labels)
+    assert [(c.start_label, c.end_label) for c in annotated] == [("i", "iii"), ("1", "3")]
+    assert analyzer._annotate_page_labels(chapters, []) == chapters
+    print("✓ 按物理页顺序读取页码标签，章节标注起止页的逻辑页码")
+
+
+def test_resolve_logical_pages(make_pdf):
+    """测试逻辑页码换算为物理页码"""
+    print("\n测试逻辑页码换算...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        labelled = str(_labelled_pdf(make_pdf, Path(tmp) / "labelled.pdf"))
+        plain = str(make_pdf(Path(tmp) / "plain.pdf", 3))
+
+        resolved = analyzer.resolve_logical_pages(labelled, [
+            _chapter("前言", "ii", "iii"),
+            _chapter("第一部分", "1", "3"),
+            # 重复的结束标签取起始页之后第一次出现的位置
+            _chapter("跨部分", "3", "2"),
+        ])
+        assert [(c.start_page, c.end_page, c.page_count) for c in resolved] == [(2, 3, 2), (4, 6, 3), (6, 8, 3)]
+        assert (resolved[0].start_label, resolved[0].end_label) == ("ii", "iii")
+
+        # 未定义页码标签的文件按物理页码换算，未提供标签时使用提交的页码
+        plain_resolved = analyzer.resolve_logical_pages(plain, [
+            ChapterInfo(title="全部", start_page=1, end_page=3, page_count=3)
+        ])
+        assert (plain_resolved[0].start_page, plain_resolved[0].end_page) == (1, 3)
+        assert (plain_resolved[0].start_label, plain_resolved[0].end_label) == ("1", "3")
+
+        for chapter in (_chapter("不存在", "iv", "v"), _chapter("倒序", "ii", "i")):
+            try:
+                analyzer.resolve_logical_pages(labelled, [chapter])
+                assert False, f"无效的逻辑页码应被拒绝: {chapter.title}"
+            except ValueError as e:
+                assert chapter.title in str(e)
+    print("✓ 逻辑页码换算为物理页码，重复标签按起始页之后的位置匹配，不存在或倒序的标签被拒绝")
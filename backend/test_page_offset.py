@@ -0,0 +1,68 @@
+"""
+印刷页码偏移测试，验证校准的偏移量作用于印刷目录中的页码和用户输入的印刷页码，且换算后不超出文档范围
+"""
+
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _make_pdf(path: Path) -> None:
+    """12页：封面、目录页，正文印刷页码从第3页开始为1"""
+    doc = fitz.open()
+    doc.new_page().insert_text((72, 72), "A Book")
+    toc = doc.new_page()
+    for i, line in enumerate([
+        "Contents",
+        "Chapter 1 Introduction ........ 1",
+        "Chapter 2 Methods ........ 5",
+        "Chapter 9 Missing ........ 80",
+    ]):
+        toc.insert_text((72, 72 + i * 20), line)
+    for i in range(10):
+        doc.new_page().insert_text((72, 72), f"Body {i + 1}")
+    doc.save(str(path))
+    doc.close()
+
+
+def _chapter(title: str, start: int, end: int) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1)
+
+
+def test_toc_pages():
+    """测试按偏移量换算印刷目录中的页码"""
+    print("测试印刷目录页码换算...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "book.pdf"
+        _make_pdf(path)
+        with fitz.open(str(path)) as doc:
+            chapters = analyzer._extract_from_toc_pages(doc, 2)
+
+    assert [(c.title, c.start_page, c.end_page) for c in chapters] == [
+        ("Chapter 1 Introduction", 3, 6),
+        ("Chapter 2 Methods", 7, 12),
+    ]
+    print("✓ 目录中的印刷页码加上偏移量后作为物理页码，超出文档范围的条目被跳过")
+
+
+def test_apply_offset_bounds():
+    """测试用户输入的印刷页码换算后检查首尾页"""
+    print("\n测试印刷页码范围...")
+
+    analyzer = PDFAnalyzer()
+    chapters = analyzer.apply_page_offset([_chapter("A", 1, 4), _chapter("B", 5, 10)], 2, 12)
+    assert [(c.start_page, c.end_page, c.page_count) for c in chapters] == [(3, 6, 4), (7, 12, 6)]
+
+    for chapter, offset in ((_chapter("前", 1, 2), -1), (_chapter("后", 5, 11), 2)):
+        try:
+            analyzer.apply_page_offset([chapter], offset, 12)
+            assert False, "换算后超出文档范围的章节应被拒绝"
+        except ValueError:
+            pass
+    print("✓ 换算后起始页小于1或结束页超过总页数时拒绝")
@@ -0,0 +1,63 @@
+"""
+PDF/A转换测试，验证转换前移除不允许的内容；安装了Ghostscript时验证实际转换
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter
+from src.services.pdfa import PDFA_CONFORMANCE, pdfa_converter
+
+
+def test_prepare():
+    """测试移除附件和附件注释并报告"""
+    print("测试PDF/A转换前处理...")
+
+    doc = fitz.open()
+    page = doc.new_page()
+    page.insert_text((72, 72), "Chapter 1")
+    page.add_file_annot(fitz.Point(100, 100), b"data", "data.csv")
+    doc.embfile_add("results", b"a,b", filename="results.csv")
+
+    issues = pdfa_converter.prepare(doc)
+    assert doc.embfile_count() == 0
+    assert list(doc[0].annots()) == []
+    assert len(issues) == 2
+
+    assert pdfa_converter.prepare(fitz.open()) == []
+    print("✓ 附件和附件注释被移除并记录")
+
+
+def test_split_to_pdfa():
+    """测试拆分输出转换为PDF/A-2b（未安装Ghostscript时跳过）"""
+    print("\n测试PDF/A拆分...")
+
+    if not pdfa_converter.available:
+        print("✓ 未安装Ghostscript，跳过")
+        return
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        doc = fitz.open()
+        doc.new_page().insert_text((72, 72), "Chapter 1")
+        doc.embfile_add("results", b"a,b", filename="results.csv")
+        doc.save(str(source))
+        doc.close()
+
+        output_dir = Path(tmp) / "out"
+        chapters = [ChapterInfo(title="第1章", start_page=1, end_page=1, page_count=1)]
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), pdfa=True))
+
+        with fitz.open(str(output_dir / links[0])) as output:
+            assert "pdfaid" in (output.get_xml_metadata() or "")
+            assert "OutputIntents" in output.xref_object(output.pdf_catalog())
+
+        entry = json.loads((output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8"))["files"][0]
+        assert entry["conformance"] == PDFA_CONFORMANCE
+        assert any("附件" in issue for issue in entry["conversion_issues"])
+    print("✓ 输出包含PDF/A标识和输出意图")
@@ -0,0 +1,103 @@
+"""
+组织级处理策略测试，验证策略合并、按角色放宽和拆分时的元数据清除、水印与大小上限
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.core.auth import Principal, use_principal
+from src.core.tenancy import use_tenant
+from src.models.schemas import ChapterInfo, ProcessingPolicy, Role, SplitRequest
+from src.services.pdf_splitter import PDFSplitter
+from src.services.policy_service import policy_service
+
+
+ADMIN = Principal(user="ada", role=Role.ADMIN, tenant_id="default")
+EDITOR = Principal(user="eddie", role=Role.EDITOR, tenant_id="default")
+
+
+def _request(**kwargs) -> SplitRequest:
+    chapter = ChapterInfo(title="第1章", start_page=1, end_page=2, page_count=2)
+    return SplitRequest(file_id="f-1", chapters=[chapter], **kwargs)
+
+
+def test_apply_policy(tmp_upload_dir):
+    """测试策略填充默认值、收紧总是允许、放宽需要角色"""
+    print("测试处理策略合并...")
+
+    async def run():
+        request = _request()
+        await policy_service.apply(request, EDITOR)
+        assert request.strip_metadata is False and request.watermark_text is None
+
+        with use_principal(ADMIN):
+            saved = await policy_service.set(ProcessingPolicy(
+                strip_metadata=True, watermark_text="内部资料", max_output_bytes=1000
+            ))
+        assert saved.updated_by == "ada"
+
+        request = _request()
+        await policy_service.apply(request, EDITOR)
+        assert request.strip_metadata is True
+        assert request.watermark_text == "内部资料"
+        assert request.max_output_bytes == 1000
+
+        # 收紧大小上限不需要额外角色
+        request = _request(max_output_bytes=500)
+        await policy_service.apply(request, EDITOR)
+        assert request.max_output_bytes == 500
+
+        for overrides in ({"strip_metadata": False}, {"watermark_text": ""}, {"max_output_bytes": 5000}):
+            try:
+                await policy_service.apply(_request(**overrides), EDITOR)
+                assert False, f"编辑者不应能放宽策略: {overrides}"
+            except PermissionError:
+                pass
+
+        request = _request(watermark_text="")
+        await policy_service.apply(request, ADMIN)
+        assert request.watermark_text is None
+
+        with use_tenant("acme"):
+            assert await policy_service.get() == ProcessingPolicy()
+
+    asyncio.run(run())
+    print("✓ 策略合并到请求，放宽策略需要指定角色")
+
+
+def test_split_with_policy():
+    """测试拆分输出清除元数据、添加水印并执行大小上限"""
+    print("\n测试按策略拆分...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        doc = fitz.open()
+        for i in range(2):
+            doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+        doc.set_metadata({"author": "Alice", "title": "机密"})
+        doc.save(str(source))
+        doc.close()
+
+        chapters = [ChapterInfo(title="第1章", start_page=1, end_page=2, page_count=2)]
+        splitter = PDFSplitter()
+
+        links = asyncio.run(splitter.split_pdf(
+            str(source), chapters, str(Path(tmp) / "out"),
+            strip_metadata=True, watermark_text="内部资料"
+        ))
+        with fitz.open(str(Path(tmp) / "out" / links[0])) as output:
+            assert not output.metadata.get("author")
+            assert "内部资料" in output[0].get_text()
+
+        errors = []
+        links = asyncio.run(splitter.split_pdf(
+            str(source), chapters, str(Path(tmp) / "small"),
+            chapter_callback=lambda index, chapter, filename, error: error and errors.append(error),
+            max_output_bytes=100
+        ))
+        assert links == [] and len(errors) == 1
+        assert not any(path.suffix == ".pdf" for path in (Path(tmp) / "small").iterdir())
+    print("✓ 输出文件无元数据、带水印，超出上限的章节记为失败")
@@ -0,0 +1,98 @@
+"""
+拆分预设测试，验证预设的增删改查、合并规则和文件名模板
+"""
+
+import asyncio
+
+from src.core.tenancy import use_tenant
+from src.models.schemas import (
+    AnalyzeRequest,
+    ChapterInfo,
+    PresetAnalyzeOptions,
+    PresetSplitOptions,
+    SplitPreset,
+    SplitPresetRequest,
+    SplitRequest,
+    TaskPriority,
+)
+from src.services.pdf_splitter import PDFSplitter, validate_filename_template
+from src.services.preset_service import preset_service
+
+
+def _textbook() -> SplitPresetRequest:
+    return SplitPresetRequest(
+        name="教材",
+        analyze=PresetAnalyzeOptions(normalize_titles=True, min_pages_per_chapter=3),
+        split=PresetSplitOptions(filename_template="{title}_p{start_page}", optimize=True, priority=TaskPriority.HIGH)
+    )
+
+
+def test_preset_crud(tmp_upload_dir):
+    """测试创建、更新、重名校验、租户隔离和删除"""
+    print("测试预设增删改查...")
+
+    async def run():
+        preset = await preset_service.create(_textbook())
+        assert (await preset_service.get(preset.preset_id)).split.optimize is True
+
+        try:
+            await preset_service.create(_textbook())
+            assert False, "应拒绝重名预设"
+        except ValueError:
+            pass
+
+        renamed = _textbook()
+        renamed.name = "教材（旧版）"
+        updated = await preset_service.update(preset.preset_id, renamed)
+        assert updated.name == "教材（旧版）" and updated.created_at == preset.created_at
+        assert [item.name for item in await preset_service.list()] == ["教材（旧版）"]
+
+        with use_tenant("acme"):
+            assert await preset_service.list() == []
+            assert await preset_service.get(preset.preset_id) is None
+
+        assert await preset_service.get("../etc") is None
+        assert await preset_service.delete(preset.preset_id) is True
+        assert await preset_service.get(preset.preset_id) is None
+
+    asyncio.run(run())
+    print("✓ 预设按租户保存，名称唯一")
+
+
+def test_apply_preset():
+    """测试预设合并：请求中显式提供的字段优先"""
+    print("\n测试预设合并...")
+
+    preset = SplitPreset(preset_id="p-1", **_textbook().model_dump())
+
+    chapter = ChapterInfo(title="第1章", start_page=1, end_page=3, page_count=3)
+    request = SplitRequest(file_id="f-1", chapters=[chapter], priority=TaskPriority.LOW, preset_id="p-1")
+    preset_service.apply(preset, request)
+    assert request.filename_template == "{title}_p{start_page}"
+    assert request.optimize is True
+    assert request.priority == TaskPriority.LOW
+
+    analyze = AnalyzeRequest(file_id="f-1", preset_id="p-1")
+    preset_service.apply(preset, analyze)
+    assert analyze.normalize_titles is True and analyze.min_pages_per_chapter == 3
+    print("✓ 预设只填充请求未指定的字段")
+
+
+def test_filename_template():
+    """测试文件名模板校验和渲染"""
+    print("\n测试文件名模板...")
+
+    validate_filename_template("{index:03d}-{title}")
+    for template in ("{unknown}", "{index:q}", ""):
+        try:
+            validate_filename_template(template)
+            assert False, f"应拒绝模板: {template!r}"
+        except ValueError:
+            pass
+
+    splitter = PDFSplitter()
+    chapter = ChapterInfo(title="第2章/附录", start_page=10, end_page=20, page_count=11)
+    assert splitter._render_filename("{index:02d}_{title}", 2, chapter) == "02_第2章_附录.pdf"
+    assert splitter._render_filename("../{title}", 2, chapter) == "_第2章_附录.pdf"
+    assert splitter._render_filename("p{start_page}-{end_page}", 2, chapter) == "p10-20.pdf"
+    print("✓ 模板占位符校验，输出文件名不含路径分隔符")
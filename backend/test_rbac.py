@@ -0,0 +1,451 @@
+"""
+访问控制测试，验证角色规则和中间件的鉴权行为，以及OIDC令牌校验和登录流程
+"""
+
+import asyncio
+import time
+from uuid import uuid4
+
+import jwt
+from fastapi import HTTPException
+
+from src.api import routes
+from src.api.middleware import RBACMiddleware, TenantMiddleware, required_role
+from src.core.api_keys import ApiKeyStore, api_key_store
+from src.core.auth import BOOTSTRAP_ADMIN_USER, Principal, authenticate, has_role, use_principal
+from src.core.config import Settings, settings
+from src.core.errors import UnavailableError
+from src.core import oidc as oidc_module
+from src.core.oidc import OIDC_STATES_BUCKET, OIDCError, oidc_provider
+from src.core.store import get_store
+from src.core.tenancy import tenant_storage_dir
+from src.models.schemas import Role
+
+
+TEST_TENANTS = {
+    "team-a": {
+        "api_keys": [
+            {"key": "viewer-key", "user": "vivian", "role": "viewer"},
+            {"key": "editor-key", "user": "eddie", "role": "editor"},
+            {"key": "admin-key", "user": "ada", "role": "admin"},
+        ]
+    }
+}
+
+
+async def _ok_app(scope, receive, send):
+    await send({"type": "http.response.start", "status": 200, "headers": []})
+    await send({"type": "http.response.body", "body": b"ok"})
+
+
+async def _call(app, method: str, path: str, headers=None, state=None) -> int:
+    """调用ASGI应用并返回响应状态码"""
+    scope = {
+        "type": "http",
+        "method": method,
+        "path": path,
+        "headers": [(k.lower().encode("latin-1"), v.encode("latin-1")) for k, v in (headers or {}).items()],
+        "state": dict(state or {}),
+    }
+    messages = []
+
+    async def receive():
+        return {"type": "http.request", "body": b"", "more_body": False}
+
+    async def send(message):
+        messages.append(message)
+
+    await app(scope, receive, send)
+    return next(m["status"] for m in messages if m["type"] == "http.response.start")
+
+
+def test_required_role():
+    """测试路由所需角色"""
+    print("测试路由所需角色...")
+
+    assert required_role("GET", "/api/tasks") == Role.VIEWER
+    assert required_role("GET", "/api/download/abc/archive") == Role.VIEWER
+    assert required_role("POST", "/api/download/batch") == Role.VIEWER
+    assert required_role("POST", "/api/upload") == Role.EDITOR
+    assert required_role("POST", "/api/analyze") == Role.EDITOR
+    assert required_role("POST", "/api/split") == Role.EDITOR
+    assert required_role("DELETE", "/api/files/abc") == Role.EDITOR
+    assert required_role("GET", "/api/admin/stats") == Role.ADMIN
+    assert required_role("GET", "/metrics") == Role.OPERATOR
+    assert required_role("GET", "/api/admin/config") == Role.OPERATOR
+    assert required_role("POST", "/api/admin/benchmark") == Role.OPERATOR
+    assert required_role("GET", "/api/admin/policy") == Role.ADMIN
+    assert required_role("GET", "/api/connectors/dropbox/callback") is None
+    assert required_role("GET", "/health") is None
+    assert required_role("OPTIONS", "/api/split") is None
+    print("✓ 路由角色规则正确")
+
+
+def test_role_hierarchy():
+    """测试角色等级"""
+    print("\n测试角色等级...")
+
+    admin = Principal(user="ada", role=Role.ADMIN, tenant_id="default")
+    viewer = Principal(user="vivian", role=Role.VIEWER, tenant_id="default")
+    operator = Principal(user="otto", role=Role.OPERATOR, tenant_id="default")
+
+    assert has_role(operator, Role.ADMIN)
+    assert not has_role(admin, Role.OPERATOR)
+    assert has_role(admin, Role.EDITOR)
+    assert has_role(admin, Role.VIEWER)
+    assert not has_role(viewer, Role.EDITOR)
+    assert has_role(viewer, Role.VIEWER)
+    print("✓ 高等级角色包含低等级权限")
+
+
+def test_rbac_middleware():
+    """测试RBAC中间件"""
+    print("\n测试RBAC中间件...")
+
+    app = RBACMiddleware(_ok_app)
+    viewer = Principal(user="vivian", role=Role.VIEWER, tenant_id="default")
+    editor = Principal(user="eddie", role=Role.EDITOR, tenant_id="default")
+    admin = Principal(user="ada", role=Role.ADMIN, tenant_id="default")
+    operator = Principal(user="otto", role=Role.OPERATOR, tenant_id="default")
+
+    assert asyncio.run(_call(app, "GET", "/api/tasks", state={"principal": viewer})) == 200
+    assert asyncio.run(_call(app, "POST", "/api/split", state={"principal": viewer})) == 403
+    assert asyncio.run(_call(app, "POST", "/api/split", state={"principal": editor})) == 200
+    assert asyncio.run(_call(app, "GET", "/api/admin/config", state={"principal": editor})) == 403
+    assert asyncio.run(_call(app, "GET", "/api/admin/stats", state={"principal": admin})) == 200
+    assert asyncio.run(_call(app, "GET", "/api/admin/config", state={"principal": admin})) == 403
+    assert asyncio.run(_call(app, "GET", "/metrics", state={"principal": admin})) == 403
+    assert asyncio.run(_call(app, "GET", "/api/admin/config", state={"principal": operator})) == 200
+    assert asyncio.run(_call(app, "GET", "/api/admin/stats", state={"principal": operator})) == 200
+    assert asyncio.run(_call(app, "GET", "/api/tasks", state={"principal": None})) == 401
+    assert asyncio.run(_call(app, "GET", "/health", state={"principal": None})) == 200
+    print("✓ 按角色放行或拒绝请求")
+
+
+def test_authentication_with_tenant_keys():
+    """测试按租户API Key识别调用方"""
+    print("\n测试API Key认证...")
+
+    original = settings.TENANTS
+    settings.TENANTS = TEST_TENANTS
+    try:
+        principal = asyncio.run(authenticate("team-a", "editor-key"))
+        assert principal and principal.user == "eddie" and principal.role == Role.EDITOR
+        assert asyncio.run(authenticate("team-a", "wrong-key")) is None
+        assert asyncio.run(authenticate("team-a", "")) is None
+
+        # 未配置API Key的租户视为匿名调用方，默认只读
+        anonymous = asyncio.run(authenticate(settings.DEFAULT_TENANT, ""))
+        assert anonymous and anonymous.role == Role.VIEWER
+
+        app = TenantMiddleware(RBACMiddleware(_ok_app))
+        assert asyncio.run(_call(app, "GET", "/api/tasks")) == 200
+        assert asyncio.run(_call(app, "POST", "/api/upload")) == 403
+        tenant = {"X-Tenant-ID": "team-a"}
+        assert asyncio.run(_call(app, "GET", "/api/tasks", {**tenant, "X-API-Key": "viewer-key"})) == 200
+        assert asyncio.run(_call(app, "POST", "/api/upload", {**tenant, "X-API-Key": "viewer-key"})) == 403
+        assert asyncio.run(_call(app, "POST", "/api/upload", {**tenant, "X-API-Key": "editor-key"})) == 200
+        assert asyncio.run(_call(app, "GET", "/api/admin/stats", {**tenant, "X-API-Key": "admin-key"})) == 200
+        assert asyncio.run(_call(app, "GET", "/api/tasks", tenant)) == 401
+        assert asyncio.run(_call(app, "GET", "/api/tasks", {"X-Tenant-ID": "unknown"})) == 404
+    finally:
+        settings.TENANTS = original
+    print("✓ 租户API Key映射到用户和角色")
+
+
+def test_anonymous_role_cannot_manage():
+    """测试匿名角色不能配置为admin或operator"""
+    print("\n测试匿名角色限制...")
+
+    assert Settings(ANONYMOUS_ROLE="editor").ANONYMOUS_ROLE == "editor"
+    for role in ("admin", "operator", "root"):
+        try:
+            Settings(ANONYMOUS_ROLE=role)
+        except ValueError as e:
+            assert "ANONYMOUS_ROLE" in str(e)
+        else:
+            raise AssertionError(f"{role} 不应允许作为匿名角色")
+    print("✓ 匿名调用方只能是viewer或editor")
+
+
+def test_bootstrap_admin_key():
+    """测试初始管理员Key"""
+    print("\n测试初始管理员Key...")
+
+    original = settings.BOOTSTRAP_ADMIN_KEY
+    settings.BOOTSTRAP_ADMIN_KEY = "bootstrap-key"
+    try:
+        principal = asyncio.run(authenticate(settings.DEFAULT_TENANT, "bootstrap-key"))
+        assert principal and principal.role == Role.ADMIN and principal.user == BOOTSTRAP_ADMIN_USER
+        # 配置后默认租户不再允许匿名访问，其他租户不接受该Key
+        assert asyncio.run(authenticate(settings.DEFAULT_TENANT, "")) is None
+        assert asyncio.run(authenticate("team-a", "bootstrap-key")) is None
+
+        app = TenantMiddleware(RBACMiddleware(_ok_app))
+        assert asyncio.run(_call(app, "POST", "/api/admin/api-keys", {"X-API-Key": "bootstrap-key"})) == 200
+        assert asyncio.run(_call(app, "POST", "/api/upload")) == 401
+    finally:
+        settings.BOOTSTRAP_ADMIN_KEY = original
+    print("✓ 初始管理员Key可以签发其他Key，配置后默认租户需要认证")
+
+
+def test_issued_api_keys(tmp_upload_dir):
+    """测试签发、轮换和吊销API Key"""
+    print("\n测试签发的API Key...")
+
+    api_key_store._keys.clear()
+    try:
+        tenant_id = settings.DEFAULT_TENANT
+
+        async def run():
+            info, api_key = await api_key_store.create(tenant_id, "reporting", Role.VIEWER, rate_limit_per_minute=5)
+            record = tenant_storage_dir(tenant_id) / "api_keys" / f"{info.key_id}.json"
+            assert api_key not in record.read_text(encoding="utf-8")
+
+            principal = await authenticate(tenant_id, api_key)
+            assert principal and principal.key_id == info.key_id and principal.rate_limit_per_minute == 5
+            # 用户标识为key_id，同名的Key是不同的调用方
+            same_info, same_name = await api_key_store.create(tenant_id, "reporting", Role.VIEWER)
+            assert principal.user == info.key_id and (await authenticate(tenant_id, same_name)).user != principal.user
+            # 签发过Key后不再允许匿名访问
+            assert await authenticate(tenant_id, "") is None
+
+            # 其他副本（另一个实例）同样可以识别
+            other = ApiKeyStore()
+            assert await other.find(tenant_id, api_key) is not None
+
+            _, rotated = await api_key_store.rotate(tenant_id, info.key_id)
+            assert await authenticate(tenant_id, api_key) is None
+            assert await authenticate(tenant_id, rotated) is not None
+            # 其他副本的缓存过期后轮换生效
+            assert await other.find(tenant_id, api_key) is not None
+            other._keys.clear()
+            assert await other.find(tenant_id, api_key) is None and await other.find(tenant_id, rotated) is not None
+
+            await api_key_store.revoke(tenant_id, info.key_id)
+            assert await api_key_store.rotate(tenant_id, info.key_id) is None
+            assert await api_key_store.revoke(tenant_id, "../tasks") is None
+            assert await authenticate(tenant_id, rotated) is None
+            assert [key.revoked_at is not None for key in await other.list(tenant_id)] == [True, False]
+
+            # 全部吊销后恢复匿名访问
+            await api_key_store.revoke(tenant_id, same_info.key_id)
+            assert (await authenticate(tenant_id, "")).user == "anonymous"
+
+        asyncio.run(run())
+    finally:
+        api_key_store._keys.clear()
+    print("✓ Key哈希保存，轮换和吊销后旧Key失效")
+
+
+def test_api_key_management_roles(tmp_upload_dir):
+    """测试不能轮换或吊销高于自身角色的Key"""
+    print("\n测试Key管理的角色限制...")
+
+    api_key_store._keys.clear()
+    try:
+        tenant_id = settings.DEFAULT_TENANT
+        admin = Principal(user="ada", role=Role.ADMIN, tenant_id=tenant_id)
+
+        async def run():
+            operator_info, operator_key = await api_key_store.create(tenant_id, "ops", Role.OPERATOR)
+            editor_info, _ = await api_key_store.create(tenant_id, "ci", Role.EDITOR)
+
+            with use_principal(admin):
+                for call in (routes.rotate_api_key, routes.revoke_api_key):
+                    try:
+                        await call(operator_info.key_id)
+                        assert False, "管理员不应管理运维Key"
+                    except HTTPException as e:
+                        assert e.status_code == 403
+                # 运维Key未被修改，仍然有效
+                assert (await authenticate(tenant_id, operator_key)).role == Role.OPERATOR
+                assert (await api_key_store.get(tenant_id, operator_info.key_id)).revoked_at is None
+
+                rotated = await routes.rotate_api_key(editor_info.key_id)
+                assert rotated.info.key_id == editor_info.key_id and rotated.key
+                assert (await routes.revoke_api_key(editor_info.key_id)).revoked_at is not None
+
+                try:
+                    await routes.revoke_api_key(str(uuid4()))
+                    assert False, "不存在的Key应返回404"
+                except HTTPException as e:
+                    assert e.status_code == 404
+
+            with use_principal(Principal(user="otto", role=Role.OPERATOR, tenant_id=tenant_id)):
+                assert (await routes.revoke_api_key(operator_info.key_id)).revoked_at is not None
+
+        asyncio.run(run())
+    finally:
+        api_key_store._keys.clear()
+    print("✓ 轮换和吊销与签发一样不能超出调用方自身角色")
+
+
+def test_key_store_unavailable():
+    """测试读不到签发的Key时拒绝匿名请求"""
+    print("\n测试Key存储不可用...")
+
+    async def failing_read(tenant_id):
+        raise OSError("store offline")
+
+    api_key_store._keys.clear()
+    api_key_store._read = failing_read
+    try:
+        try:
+            asyncio.run(authenticate(settings.DEFAULT_TENANT, ""))
+            assert False, "存储不可用时不应视为没有Key"
+        except UnavailableError as e:
+            assert e.status_code == 503
+
+        app = TenantMiddleware(RBACMiddleware(_ok_app))
+        assert asyncio.run(_call(app, "GET", "/api/tasks")) == 503
+        assert asyncio.run(_call(app, "POST", "/api/upload", {"X-API-Key": "pcs_guess"})) == 503
+        # 公开路由不需要认证，健康检查仍可访问
+        assert asyncio.run(_call(app, "GET", "/health")) == 200
+    finally:
+        del api_key_store._read
+        api_key_store._keys.clear()
+    print("✓ 存储不可用时需要认证的请求返回503，不退化为匿名访问")
+
+
+def test_oidc_token_mapping():
+    """测试OIDC令牌校验和角色映射"""
+    print("\n测试OIDC令牌...")
+
+    overrides = {
+        "OIDC_ISSUER": "https://sso.example.com",
+        "OIDC_CLIENT_ID": "pdf-splitter",
+        "OIDC_CLIENT_SECRET": "test-secret",
+        "OIDC_ROLES_CLAIM": "realm_access.roles",
+        "OIDC_ROLE_MAPPING": {"pdf-editors": "editor", "pdf-admins": "admin"},
+        "OIDC_DEFAULT_ROLE": "viewer",
+        "OIDC_ALLOW_HS256": True,
+    }
+    original = {name: getattr(settings, name) for name in overrides}
+    for name, value in overrides.items():
+        setattr(settings, name, value)
+
+    def issue(**claims):
+        payload = {
+            "iss": "https://sso.example.com",
+            "aud": "pdf-splitter",
+            "sub": "u-1",
+            "exp": int(time.time()) + 300,
+            **claims
+        }
+        return jwt.encode(payload, "test-secret", algorithm="HS256")
+
+    try:
+        token = issue(preferred_username="alice", realm_access={"roles": ["pdf-editors", "pdf-admins"]})
+        principal = asyncio.run(oidc_provider.authenticate("default", token))
+        assert principal and principal.user == "alice" and principal.role == Role.ADMIN
+
+        principal = asyncio.run(oidc_provider.authenticate("default", issue()))
+        assert principal and principal.user == "u-1" and principal.role == Role.VIEWER
+
+        assert asyncio.run(oidc_provider.authenticate("default", issue(aud="other"))) is None
+        assert asyncio.run(oidc_provider.authenticate("default", issue(exp=int(time.time()) - 600))) is None
+        assert asyncio.run(oidc_provider.authenticate("default", "not-a-token")) is None
+
+        # 未显式开启时不接受客户端密钥签名的令牌
+        settings.OIDC_ALLOW_HS256 = False
+        assert asyncio.run(oidc_provider.authenticate("default", token)) is None
+        settings.OIDC_ALLOW_HS256 = True
+
+        # 启用OIDC后不再允许匿名访问
+        assert asyncio.run(authenticate(settings.DEFAULT_TENANT, "")) is None
+
+        app = TenantMiddleware(RBACMiddleware(_ok_app))
+        bearer = {"Authorization": f"Bearer {token}"}
+        assert asyncio.run(_call(app, "GET", "/api/admin/stats", bearer)) == 200
+        assert asyncio.run(_call(app, "GET", "/api/tasks")) == 401
+    finally:
+        for name, value in original.items():
+            setattr(settings, name, value)
+    print("✓ 令牌声明映射为用户和角色")
+
+
+def test_oidc_login_state(tmp_upload_dir, monkeypatch):
+    """测试OIDC登录的state和nonce"""
+    print("\n测试OIDC登录state...")
+
+    overrides = {
+        "OIDC_ISSUER": "https://sso.example.com",
+        "OIDC_CLIENT_ID": "pdf-splitter",
+        "OIDC_CLIENT_SECRET": "test-secret",
+        "OIDC_ALLOW_HS256": True,
+    }
+    id_tokens = []
+
+    class TokenResponse:
+        def raise_for_status(self):
+            pass
+
+        def json(self):
+            return {"id_token": id_tokens[-1]}
+
+    class FakeClient:
+        def __init__(self, **kwargs):
+            pass
+
+        async def __aenter__(self):
+            return self
+
+        async def __aexit__(self, *args):
+            pass
+
+        async def post(self, url, data, auth):
+            return TokenResponse()
+
+    def issue(nonce):
+        payload = {"iss": "https://sso.example.com", "aud": "pdf-splitter", "sub": "u-1", "exp": int(time.time()) + 300}
+        if nonce:
+            payload["nonce"] = nonce
+        return jwt.encode(payload, "test-secret", algorithm="HS256")
+
+    async def login():
+        url = await oidc_provider.authorization_url()
+        params = dict(item.split("=", 1) for item in url.split("?", 1)[1].split("&"))
+        return params["state"], params["nonce"]
+
+    for name, value in overrides.items():
+        monkeypatch.setattr(settings, name, value)
+    monkeypatch.setattr(oidc_provider, "_discovery", {"authorization_endpoint": "https://sso.example.com/auth", "token_endpoint": "https://sso.example.com/token"})
+    monkeypatch.setattr(oidc_module.httpx, "AsyncClient", FakeClient)
+
+    async def run():
+        state, nonce = await login()
+        # state保存在存储中，回调落在其他副本时同样可以完成登录
+        assert get_store().get(OIDC_STATES_BUCKET, state)["nonce"] == nonce
+        id_tokens.append(issue(nonce))
+        tokens, principal = await oidc_provider.exchange_code("code", state)
+        assert principal.user == "u-1" and get_store().get(OIDC_STATES_BUCKET, state) is None
+        for reused in (state, "../../etc", ""):
+            try:
+                await oidc_provider.exchange_code("code", reused)
+                assert False, "state只能使用一次"
+            except OIDCError:
+                pass
+
+        for bad_nonce in ("other-nonce", None):
+            state, _ = await login()
+            id_tokens.append(issue(bad_nonce))
+            try:
+                await oidc_provider.exchange_code("code", state)
+                assert False, "nonce不一致的ID Token应被拒绝"
+            except OIDCError as e:
+                assert "nonce" in str(e)
+
+    asyncio.run(run())
+    print("✓ state保存在存储中且只能使用一次，ID Token的nonce必须与登录请求一致")
+
+
+def test_upload_dir_not_served():
+    """测试上传目录不作为静态文件开放，绕过鉴权中间件"""
+    print("\n测试上传目录不可直接下载...")
+
+    from main import app
+
+    paths = [getattr(route, "path", "") for route in app.routes]
+    assert not any(path.startswith("/files") for path in paths), "上传目录（含元数据存储）不应挂载为静态文件"
+    print("✓ 上传目录不挂载为静态文件，文件和任务、API Key等记录只能通过鉴权接口访问")
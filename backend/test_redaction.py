@@ -0,0 +1,68 @@
+"""
+拆分前涂黑测试，验证规则校验以及整页、区域和正则涂黑真正删除内容
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo, RedactionSpec
+from src.services.pdf_splitter import PDFSplitter
+from src.services.redaction import validate_redactions
+
+
+def _build_pdf(path: Path) -> None:
+    doc = fitz.open()
+    for i in range(3):
+        page = doc.new_page()
+        page.insert_text((72, 72), f"Page {i + 1} header")
+        page.insert_text((72, 144), f"Contact: agent{i + 1}@example.com")
+        page.insert_text((72, 400), "Internal budget 1,000,000")
+    doc.save(str(path))
+    doc.close()
+
+
+def test_validate_redactions():
+    """测试规则校验"""
+    print("测试涂黑规则校验...")
+
+    validate_redactions([RedactionSpec(page=1), RedactionSpec(rect=[0, 0, 10, 10]), RedactionSpec(pattern=r"\d+")])
+    for spec in (RedactionSpec(), RedactionSpec(rect=[0, 0, 10]), RedactionSpec(rect=[10, 0, 5, 10]), RedactionSpec(pattern="(")):
+        try:
+            validate_redactions([spec])
+            assert False, f"应拒绝规则: {spec}"
+        except ValueError:
+            pass
+    print("✓ 空规则、错误区域和无效正则被拒绝")
+
+
+def test_split_with_redactions():
+    """测试涂黑后的章节中文字被真正删除，原文件不变"""
+    print("\n测试拆分前涂黑...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        _build_pdf(source)
+        chapters = [ChapterInfo(title="第1章", start_page=1, end_page=3, page_count=3)]
+        redactions = [
+            RedactionSpec(page=2),
+            RedactionSpec(rect=[60, 380, 400, 410]),
+            RedactionSpec(page=3, pattern=r"agent\d@example\.com"),
+        ]
+
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source), chapters, str(Path(tmp) / "out"), redactions=redactions
+        ))
+        with fitz.open(str(Path(tmp) / "out" / links[0])) as output:
+            assert len(output) == 3
+            texts = [page.get_text() for page in output]
+            assert "Page 1 header" in texts[0] and "agent1@example.com" in texts[0]
+            assert texts[1].strip() == ""
+            assert "agent3@example.com" not in texts[2] and "Page 3 header" in texts[2]
+            assert all("budget" not in text for text in texts)
+
+        with fitz.open(str(source)) as original:
+            assert "budget" in original[0].get_text()
+    print("✓ 整页、区域和正则涂黑删除了文字")
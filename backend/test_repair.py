@@ -0,0 +1,72 @@
+"""
+损坏PDF修复测试，验证交叉引用表损坏的文件在上传时自动修复，后续流程使用修复副本
+"""
+
+import asyncio
+import io
+import tempfile
+from pathlib import Path
+
+from src.services.file_service import FileService, REPAIRED_FILENAME
+from src.services.repair_service import repair_service
+
+
+def _damage(data: bytes) -> bytes:
+    """破坏交叉引用表位置"""
+    index = data.rindex(b"startxref")
+    return data[:index] + b"startxref\n999999\n%%EOF\n"
+
+
+def test_repair_damaged_file(pdf_bytes):
+    """测试修复交叉引用表损坏的文件"""
+    print("测试修复损坏文件...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        healthy = Path(tmp) / "healthy.pdf"
+        healthy.write_bytes(pdf_bytes(pages=3))
+        damaged = Path(tmp) / "damaged.pdf"
+        damaged.write_bytes(_damage(pdf_bytes(pages=3)))
+
+        assert repair_service.needs_repair(healthy) is False
+        assert repair_service.needs_repair(damaged) is True
+
+        target = Path(tmp) / "repaired.pdf"
+        report = asyncio.run(repair_service.repair(damaged, target))
+        assert report.damaged and report.method == "mupdf" and report.page_count == 3
+        assert repair_service.needs_repair(target) is False
+
+        garbage = Path(tmp) / "garbage.pdf"
+        garbage.write_bytes(b"%PDF-1.7\nnot really a pdf")
+        try:
+            asyncio.run(repair_service.repair(garbage, Path(tmp) / "out.pdf"))
+            assert False, "应拒绝无法修复的文件"
+        except ValueError:
+            pass
+    print("✓ 交叉引用表被重建，页面全部恢复")
+
+
+def test_auto_repair_on_upload(pdf_bytes, tmp_upload_dir):
+    """测试上传时自动修复，文件路径和哈希切换到副本"""
+    print("\n测试上传时自动修复...")
+
+    file_service = FileService()
+
+    async def run():
+        info = await file_service.save_pdf_stream(io.BytesIO(_damage(pdf_bytes(pages=3))), "broken.pdf")
+        assert info.repaired is True
+        path = await file_service.get_file_path(info.file_id)
+        assert path.endswith(REPAIRED_FILENAME)
+        assert info.file_hash == file_service._hash_file(Path(path))
+
+        healthy = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes(pages=3)), "ok.pdf")
+        assert healthy.repaired is False
+        assert (await file_service.get_file_path(healthy.file_id)).endswith("original.pdf")
+
+        # 手动修复未损坏的文件同样生成副本
+        _, report = await file_service.repair_file(healthy.file_id)
+        assert report.damaged is False
+        assert (await file_service.get_file_path(healthy.file_id)).endswith(REPAIRED_FILENAME)
+        assert await file_service.repair_file("missing") is None
+
+    asyncio.run(run())
+    print("✓ 损坏的上传文件自动使用修复副本")
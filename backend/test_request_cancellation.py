@@ -0,0 +1,131 @@
+"""
+请求取消测试，验证客户端断开时取消请求处理、请求体按应用读取速度转交、响应完成后的断开不受影响，
+以及取消时终止外部子进程
+"""
+
+import asyncio
+import os
+import stat
+import tempfile
+from pathlib import Path
+
+from src.api.middleware import CLIENT_CLOSED_REQUEST, AccessLogMiddleware, ClientDisconnectMiddleware
+from src.core.config import settings
+from src.services.tesseract import run_tesseract
+
+
+def _scope() -> dict:
+    return {"type": "http", "method": "POST", "path": "/api/analyze", "headers": []}
+
+
+def _receive(chunks: list, disconnect: asyncio.Event):
+    """依次返回请求体，之后在disconnect被设置时返回断开通知"""
+    async def receive():
+        if chunks:
+            body = chunks.pop(0)
+            return {"type": "http.request", "body": body, "more_body": bool(chunks)}
+        await disconnect.wait()
+        return {"type": "http.disconnect"}
+    return receive
+
+
+async def _noop(message):
+    pass
+
+
+def test_disconnect_cancels_handler():
+    """测试断开时取消处理"""
+    print("测试客户端断开...")
+
+    async def run():
+        state = {"body": b"", "cancelled": False}
+        disconnect = asyncio.Event()
+
+        async def app(scope, receive, send):
+            while True:
+                message = await receive()
+                state["body"] += message.get("body", b"")
+                if not message.get("more_body"):
+                    break
+            try:
+                await asyncio.sleep(30)
+            except asyncio.CancelledError:
+                state["cancelled"] = True
+                raise
+
+        scope = _scope()
+        middleware = AccessLogMiddleware(ClientDisconnectMiddleware(app))
+        call = asyncio.create_task(middleware(scope, _receive([b"a", b"b", b"c"], disconnect), _noop))
+        await asyncio.sleep(0.05)
+        assert not call.done() and state["body"] == b"abc"
+
+        disconnect.set()
+        await asyncio.wait_for(call, 1)
+        assert state["cancelled"] and scope["state"]["client_disconnected"]
+
+    asyncio.run(run())
+    print("✓ 请求体按顺序转交，断开后处理协程被取消")
+
+
+def test_completed_response():
+    """测试响应完成后断开"""
+    print("\n测试响应完成后断开...")
+
+    async def run():
+        sent = []
+
+        async def app(scope, receive, send):
+            await send({"type": "http.response.start", "status": 200, "headers": []})
+            await send({"type": "http.response.body", "body": b"{}"})
+            await asyncio.sleep(0.05)
+
+        async def send(message):
+            sent.append(message)
+
+        disconnect = asyncio.Event()
+        disconnect.set()
+        scope = _scope()
+        await ClientDisconnectMiddleware(app)(scope, _receive([b""], disconnect), send)
+        assert [message["type"] for message in sent] == ["http.response.start", "http.response.body"]
+        assert "client_disconnected" not in scope.get("state", {})
+        assert CLIENT_CLOSED_REQUEST == 499
+
+    asyncio.run(run())
+    print("✓ 响应已完整发送时不取消")
+
+
+def test_subprocess_killed():
+    """测试取消时终止子进程"""
+    print("\n测试终止子进程...")
+
+    original = settings.TESSERACT_PATH
+    with tempfile.TemporaryDirectory() as tmp:
+        pid_file = Path(tmp) / "pid"
+        script = Path(tmp) / "slow-tesseract"
+        script.write_text(f"#!/bin/sh\necho $$ > {pid_file}\nexec sleep 30\n")
+        script.chmod(script.stat().st_mode | stat.S_IEXEC)
+        settings.TESSERACT_PATH = str(script)
+        try:
+            async def run():
+                call = asyncio.create_task(run_tesseract(b"", []))
+                for _ in range(100):
+                    if pid_file.exists() and pid_file.read_text().strip():
+                        break
+                    await asyncio.sleep(0.02)
+                call.cancel()
+                try:
+                    await call
+                    assert False, "应被取消"
+                except asyncio.CancelledError:
+                    pass
+                return int(pid_file.read_text())
+
+            pid = asyncio.run(run())
+            try:
+                os.kill(pid, 0)
+                assert False, "子进程仍在运行"
+            except ProcessLookupError:
+                pass
+        finally:
+            settings.TESSERACT_PATH = original
+    print("✓ 子进程随取消终止")
@@ -0,0 +1,128 @@
+"""
+请求超时测试，验证按路由选择超时、处理超时返回504以及客户端读取请求体无响应时返回408
+"""
+
+import asyncio
+import json
+
+from src.api.middleware import RequestTimeoutMiddleware
+from src.core.config import settings
+
+
+def _scope(method: str, path: str) -> dict:
+    return {"type": "http", "method": method, "path": path, "headers": []}
+
+
+async def _call(middleware, scope, receive) -> list:
+    messages = []
+
+    async def send(message):
+        messages.append(message)
+
+    await middleware(scope, receive, send)
+    return messages
+
+
+def test_route_timeouts():
+    """测试按路由选择超时"""
+    print("测试路由超时...")
+
+    original = (settings.REQUEST_TIMEOUT, settings.UPLOAD_REQUEST_TIMEOUT,
+                settings.DOWNLOAD_REQUEST_TIMEOUT, settings.PROCESSING_REQUEST_TIMEOUT)
+    settings.REQUEST_TIMEOUT = 30
+    settings.UPLOAD_REQUEST_TIMEOUT = 0
+    settings.DOWNLOAD_REQUEST_TIMEOUT = 0
+    settings.PROCESSING_REQUEST_TIMEOUT = 600
+    try:
+        middleware = RequestTimeoutMiddleware(app=None)
+        assert middleware.timeout_for("GET", "/api/tasks") == 30
+        assert middleware.timeout_for("POST", "/api/split") == 30
+        assert middleware.timeout_for("POST", "/api/upload") == 0
+        assert middleware.timeout_for("PUT", "/api/upload/sessions/abc") == 0
+        assert middleware.timeout_for("POST", "/api/upload/sessions/abc/finalize") == 30
+        assert middleware.timeout_for("GET", "/api/download/abc/archive") == 0
+        assert middleware.timeout_for("GET", "/api/task/abc/stream") == 0
+        assert middleware.timeout_for("GET", "/api/files/abc/chapters/2/images") == 0
+        assert middleware.timeout_for("POST", "/api/analyze") == 600
+        assert middleware.timeout_for("GET", "/api/files/abc/chapters") == 30
+    finally:
+        (settings.REQUEST_TIMEOUT, settings.UPLOAD_REQUEST_TIMEOUT,
+         settings.DOWNLOAD_REQUEST_TIMEOUT, settings.PROCESSING_REQUEST_TIMEOUT) = original
+    print("✓ JSON接口使用短超时，上传和下载接口不限制")
+
+
+def test_processing_timeout():
+    """测试处理超时返回504，未超时正常返回"""
+    print("\n测试处理超时...")
+
+    original = settings.REQUEST_TIMEOUT
+    settings.REQUEST_TIMEOUT = 1
+    try:
+        async def run():
+            delay = {"seconds": 5}
+
+            async def app(scope, receive, send):
+                await asyncio.sleep(delay["seconds"])
+                await send({"type": "http.response.start", "status": 200, "headers": []})
+                await send({"type": "http.response.body", "body": b"{}"})
+
+            async def receive():
+                return {"type": "http.request", "body": b"", "more_body": False}
+
+            middleware = RequestTimeoutMiddleware(app)
+            messages = await _call(middleware, _scope("GET", "/api/tasks"), receive)
+            assert messages[0]["status"] == 504
+            assert "超时" in json.loads(messages[1]["body"])["detail"]
+
+            delay["seconds"] = 0
+            messages = await _call(middleware, _scope("GET", "/api/tasks"), receive)
+            assert messages[0]["status"] == 200
+
+        asyncio.run(run())
+    finally:
+        settings.REQUEST_TIMEOUT = original
+    print("✓ 超时返回504")
+
+
+def test_client_idle_timeout():
+    """测试客户端读取请求体无响应时返回408，读完请求体后不再限制"""
+    print("\n测试客户端空闲超时...")
+
+    original = (settings.CLIENT_IDLE_TIMEOUT, settings.UPLOAD_REQUEST_TIMEOUT)
+    settings.CLIENT_IDLE_TIMEOUT = 1
+    settings.UPLOAD_REQUEST_TIMEOUT = 0
+    try:
+        async def run():
+            async def app(scope, receive, send):
+                try:
+                    while (await receive()).get("more_body"):
+                        pass
+                except Exception:
+                    # 模拟框架把读取异常转成400响应
+                    await send({"type": "http.response.start", "status": 400, "headers": []})
+                    await send({"type": "http.response.body", "body": b"{}"})
+                    return
+                await send({"type": "http.response.start", "status": 200, "headers": []})
+                await send({"type": "http.response.body", "body": b"{}"})
+
+            async def stalled():
+                await asyncio.sleep(5)
+
+            messages = await _call(RequestTimeoutMiddleware(app), _scope("POST", "/api/upload"), stalled)
+            assert [m["status"] for m in messages if m["type"] == "http.response.start"] == [408]
+
+            chunks = [
+                {"type": "http.request", "body": b"a", "more_body": True},
+                {"type": "http.request", "body": b"b", "more_body": False},
+            ]
+
+            async def steady():
+                return chunks.pop(0)
+
+            messages = await _call(RequestTimeoutMiddleware(app), _scope("POST", "/api/upload"), steady)
+            assert messages[0]["status"] == 200
+
+        asyncio.run(run())
+    finally:
+        settings.CLIENT_IDLE_TIMEOUT, settings.UPLOAD_REQUEST_TIMEOUT = original
+    print("✓ 请求体读取停滞时返回408")
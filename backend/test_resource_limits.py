@@ -0,0 +1,154 @@
+"""
+任务资源限制测试，验证超出单个任务内存上限时不占用全局预算直接失败、未配置时子进程不受限制、
+子进程超出CPU时间上限时报告超出的限制、子进程加入cgroup后才执行引擎命令，以及cgroup不可用或加入失败时退回rlimit
+"""
+
+import asyncio
+import sys
+import tempfile
+from pathlib import Path
+
+from src.core.config import settings
+from src.core.errors import ResourceLimitError
+from src.core.limits import engine_limits
+from src.core.memory import MemoryBudget
+
+
+def test_memory_budget():
+    """测试单个任务的内存上限"""
+    print("测试任务内存上限...")
+
+    budget = MemoryBudget(100, per_task_bytes=40)
+
+    async def run():
+        async with budget.reserve(40, "small"):
+            assert budget.stats()["used_bytes"] == 40
+        try:
+            async with budget.reserve(41, "large"):
+                assert False, "超出单个任务上限的文档不应开始处理"
+        except ResourceLimitError as e:
+            assert "超出单个任务上限" in e.message and e.status_code == 413
+        assert budget.stats()["used_bytes"] == 0
+
+        # 未设置单个任务上限时仍按总预算独占执行
+        async with MemoryBudget(100).reserve(500, "huge"):
+            pass
+
+    asyncio.run(run())
+    print("✓ 超出上限的任务直接失败，不占用也不等待全局预算")
+
+
+def test_cpu_limit():
+    """测试子进程CPU时间上限"""
+    print("\n测试子进程CPU上限...")
+
+    original = settings.TASK_PROCESS_CPU_SECONDS, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_CGROUP_ROOT
+
+    async def busy_loop():
+        with engine_limits() as limits:
+            process = await asyncio.create_subprocess_exec(
+                *limits.command([sys.executable, "-c", "while True: pass"]), pass_fds=limits.pass_fds
+            )
+            limits.attach(process.pid)
+            await asyncio.wait_for(process.wait(), timeout=20)
+            return limits.exceeded(process.returncode)
+
+    try:
+        settings.TASK_PROCESS_CPU_SECONDS, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_CGROUP_ROOT = 0, 0, ""
+        with engine_limits() as limits:
+            assert not limits.enabled and limits.exceeded(1) is None
+            assert limits.command(["gs", "-q"]) == ["gs", "-q"] and limits.pass_fds == ()
+
+        settings.TASK_PROCESS_CPU_SECONDS = 1
+        assert asyncio.run(busy_loop()) == "超出CPU时间上限（1秒）"
+    finally:
+        settings.TASK_PROCESS_CPU_SECONDS, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_CGROUP_ROOT = original
+    print("✓ 未配置时不设置限制，超出CPU时间的子进程被终止并报告原因")
+
+
+def test_cgroup_attach():
+    """测试子进程加入cgroup"""
+    print("\n测试子进程加入cgroup...")
+
+    original = settings.TASK_CGROUP_ROOT, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_PROCESS_CPU_SECONDS
+    with tempfile.TemporaryDirectory() as tmp:
+        # 用普通目录代替委派的cgroup目录，验证写入顺序
+        settings.TASK_CGROUP_ROOT = tmp
+        settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_PROCESS_CPU_SECONDS = 256 * 1024 * 1024, 0
+
+        async def run():
+            with engine_limits() as limits:
+                assert limits.cgroup is not None and len(limits.pass_fds) == 1
+                script = "import os, sys; print(open(sys.argv[1]).read() == str(os.getpid()))"
+                process = await asyncio.create_subprocess_exec(
+                    *limits.command([sys.executable, "-c", script, str(limits.cgroup / "cgroup.procs")]),
+                    stdout=asyncio.subprocess.PIPE,
+                    pass_fds=limits.pass_fds
+                )
+                await asyncio.sleep(0.2)
+                limits.attach(process.pid)
+                stdout, _ = await asyncio.wait_for(process.communicate(), timeout=20)
+                assert limits.pass_fds == ()
+                return stdout.decode().strip(), (limits.cgroup / "memory.max").read_text()
+
+        try:
+            started, memory_max = asyncio.run(run())
+            assert started == "True", "子进程在父进程写入cgroup.procs之后才执行引擎命令"
+            assert memory_max == str(256 * 1024 * 1024)
+        finally:
+            settings.TASK_CGROUP_ROOT, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_PROCESS_CPU_SECONDS = original
+    print("✓ 父进程写入cgroup.procs后子进程才执行引擎命令，不使用preexec_fn")
+
+
+def test_cgroup_fallback():
+    """测试cgroup不可用"""
+    print("\n测试cgroup回退...")
+
+    original = settings.TASK_CGROUP_ROOT, settings.TASK_PROCESS_MEMORY_BYTES
+    with tempfile.TemporaryDirectory() as tmp:
+        settings.TASK_CGROUP_ROOT = str(Path(tmp) / "missing")
+        settings.TASK_PROCESS_MEMORY_BYTES = 256 * 1024 * 1024
+        try:
+            with engine_limits() as limits:
+                assert limits.cgroup is None and limits.enabled and limits.pass_fds == ()
+                command = limits.command(["gs", "-q"])
+                assert command[-2:] == ["gs", "-q"] and str(256 * 1024 * 1024) in command
+        finally:
+            settings.TASK_CGROUP_ROOT, settings.TASK_PROCESS_MEMORY_BYTES = original
+    print("✓ 无法创建cgroup时只使用rlimit")
+
+
+def test_cgroup_attach_failure():
+    """测试子进程加入cgroup失败"""
+    print("\n测试加入cgroup失败...")
+
+    memory = 1024 * 1024 * 1024
+    original = settings.TASK_CGROUP_ROOT, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_PROCESS_CPU_SECONDS
+    with tempfile.TemporaryDirectory() as tmp:
+        settings.TASK_CGROUP_ROOT = tmp
+        settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_PROCESS_CPU_SECONDS = memory, 0
+
+        async def run(writable: bool):
+            with engine_limits() as limits:
+                if not writable:
+                    # cgroup.procs是目录时写入失败，root运行测试时同样有效
+                    (limits.cgroup / "cgroup.procs").mkdir()
+                script = "import resource; print(resource.getrlimit(resource.RLIMIT_AS)[0])"
+                process = await asyncio.create_subprocess_exec(
+                    *limits.command([sys.executable, "-c", script]),
+                    stdout=asyncio.subprocess.PIPE,
+                    pass_fds=limits.pass_fds
+                )
+                limits.attach(process.pid)
+                stdout, _ = await asyncio.wait_for(process.communicate(), timeout=20)
+                if not writable:
+                    (limits.cgroup / "cgroup.procs").rmdir()
+                return limits.attached, int(stdout)
+
+        try:
+            assert asyncio.run(run(False)) == (False, memory), "加入cgroup失败时仍限制地址空间"
+            attached, limit = asyncio.run(run(True))
+            assert attached and limit != memory, "已加入cgroup时由cgroup限制内存"
+        finally:
+            settings.TASK_CGROUP_ROOT, settings.TASK_PROCESS_MEMORY_BYTES, settings.TASK_PROCESS_CPU_SECONDS = original
+    print("✓ 只有确认加入cgroup后才不设地址空间上限，写入cgroup.procs失败时子进程仍受内存限制")
@@ -0,0 +1,140 @@
+"""
+分级保留策略测试，验证原文件、章节输出和任务的到期时间计算、租户级覆盖以及按策略清理
+"""
+
+import asyncio
+import io
+from datetime import datetime, timedelta
+
+from src.core.config import settings
+from src.core.tenancy import get_tenant_retention_hours, use_tenant
+from src.models.schemas import FileInfo, SplitTask, TaskStatus
+from src.services.file_service import FileService
+from src.services.pdf_splitter import MANIFEST_FILENAME
+from src.services.retention import original_expires_at, task_expires_at
+from src.services.task_service import TaskService
+
+
+RETENTION_SETTINGS = (
+    "ORIGINAL_RETENTION_HOURS",
+    "OUTPUT_RETENTION_HOURS",
+    "UNDOWNLOADED_OUTPUT_RETENTION_HOURS",
+    "TASK_RETENTION_HOURS",
+    "FAILED_TASK_RETENTION_HOURS",
+)
+
+
+def _save_settings() -> dict:
+    return {name: getattr(settings, name) for name in RETENTION_SETTINGS + ("TENANTS",)}
+
+
+def _restore_settings(saved: dict) -> None:
+    for name, value in saved.items():
+        setattr(settings, name, value)
+
+
+def test_tenant_override():
+    """测试租户级保留时长覆盖全局配置"""
+    print("测试租户级保留策略...")
+
+    saved = _save_settings()
+    try:
+        settings.ORIGINAL_RETENTION_HOURS = 168
+        settings.TENANTS = {"acme": {"original_retention_hours": 24}, "keep": {"original_retention_hours": 0}}
+        assert get_tenant_retention_hours("original_retention_hours", "acme") == 24
+        assert get_tenant_retention_hours("original_retention_hours", "keep") == 0
+        assert get_tenant_retention_hours("original_retention_hours", "default") == 168
+
+        info = FileInfo(
+            file_id="f", filename="a.pdf", file_size=1, file_path="f/original.pdf", upload_time=datetime(2026, 1, 1)
+        )
+        with use_tenant("acme"):
+            assert original_expires_at(info) == datetime(2026, 1, 2)
+        with use_tenant("keep"):
+            assert original_expires_at(info) is None
+    finally:
+        _restore_settings(saved)
+    print("✓ 未单独配置的租户使用全局保留时长，0表示不清理")
+
+
+def test_task_expiry():
+    """测试失败任务使用更短的保留时长"""
+    print("\n测试任务到期时间...")
+
+    saved = _save_settings()
+    try:
+        settings.TASK_RETENTION_HOURS = 720
+        settings.FAILED_TASK_RETENTION_HOURS = 24
+        completed_at = datetime(2026, 1, 1)
+
+        done = SplitTask(task_id="t1", file_id="f", status=TaskStatus.COMPLETED, completed_at=completed_at)
+        failed = SplitTask(task_id="t2", file_id="f", status=TaskStatus.FAILED, completed_at=completed_at)
+        pending = SplitTask(task_id="t3", file_id="f")
+        assert task_expires_at(done) == completed_at + timedelta(days=30)
+        assert task_expires_at(failed) == completed_at + timedelta(days=1)
+        assert task_expires_at(pending) is None
+
+        settings.FAILED_TASK_RETENTION_HOURS = 0
+        assert task_expires_at(failed) == completed_at + timedelta(days=30)
+    finally:
+        _restore_settings(saved)
+    print("✓ 失败任务按单独的保留时长到期，未设置时与已完成任务相同")
+
+
+def test_cleanup_originals(pdf_bytes, tmp_upload_dir, monkeypatch):
+    """测试删除过期原文件，保留章节输出"""
+    print("\n测试清理原文件...")
+
+    file_service = FileService()
+
+    async def run():
+        split = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Split")), "split.pdf")
+        plain = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Plain")), "plain.pdf")
+        chapters_dir = file_service.upload_dir / split.file_id / "chapters"
+        chapters_dir.mkdir()
+        (chapters_dir / MANIFEST_FILENAME).write_text('{"files": []}', encoding="utf-8")
+
+        assert (await file_service.get_file_info(split.file_id)).original_expires_at is None
+        assert await file_service.cleanup_originals() == 0
+
+        monkeypatch.setattr(settings, "ORIGINAL_RETENTION_HOURS", 1)
+        info = await file_service.get_file_info(split.file_id)
+        assert info.original_expires_at == info.upload_time + timedelta(hours=1)
+
+        # 上传时间提前到保留时长之前
+        for file_info in (split, plain):
+            file_info.upload_time -= timedelta(hours=2)
+            await file_service._save_file_metadata(file_info)
+        assert await file_service.cleanup_originals() == 2
+        # 有章节输出的文件只删除原文件，没有输出的文件整体删除
+        assert chapters_dir.exists()
+        assert await file_service.get_file_path(split.file_id) is None
+        info = await file_service.get_file_info(split.file_id)
+        assert info and info.original_expires_at is None
+        assert await file_service.get_file_info(plain.file_id) is None
+
+        # 原文件已删除的记录不作为重复上传返回
+        again = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("Split")), "split.pdf")
+        assert again.file_id != split.file_id
+
+    asyncio.run(run())
+    print("✓ 原文件到期后删除，章节输出按各自的保留时长保留")
+
+
+def test_failed_task_leftovers(tmp_upload_dir):
+    """测试删除失败任务的残留输出"""
+    print("\n测试清理失败任务残留...")
+
+    task = SplitTask(task_id="t", file_id="00000000-0000-4000-8000-000000000001", status=TaskStatus.FAILED)
+    output_dir = FileService().upload_dir / task.file_id / "chapters"
+    output_dir.mkdir(parents=True)
+    (output_dir / "01_a.pdf").write_bytes(b"%PDF")
+    TaskService._remove_leftovers(task)
+    assert not output_dir.exists()
+
+    # 已有完整输出时保留
+    output_dir.mkdir(parents=True)
+    (output_dir / MANIFEST_FILENAME).write_text('{"files": []}', encoding="utf-8")
+    TaskService._remove_leftovers(task)
+    assert output_dir.exists()
+    print("✓ 只删除没有校验清单的残留输出")
@@ -0,0 +1,80 @@
+"""
+示例文件测试，验证章节和节的页范围计算、书签和正文标题、前置页、相同请求生成相同内容，以及页数不足时的拒绝
+"""
+
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import SampleChapter, SampleLanguage, SamplePdfRequest
+from src.services.sample_service import sample_service
+
+
+def test_plan():
+    """测试页范围计算"""
+    print("测试页范围计算...")
+
+    chapters = sample_service.plan(SamplePdfRequest(pages=23, chapter_count=4, sections_per_chapter=2, front_matter_pages=2))
+    assert [(c.start_page, c.end_page) for c in chapters] == [(3, 8), (9, 13), (14, 18), (19, 23)]
+    assert [(s.start_page, s.end_page) for s in chapters[0].sections] == [(3, 5), (6, 8)]
+    assert chapters[1].title == "第2章 示例章节2" and chapters[1].sections[1].title == "第2节 示例小节2.2"
+
+    chapters = sample_service.plan(SamplePdfRequest(
+        language=SampleLanguage.EN,
+        chapters=[SampleChapter(title="Intro", pages=2), SampleChapter(pages=3, sections=3)]
+    ))
+    assert [(c.title, c.start_page, c.end_page) for c in chapters] == [
+        ("Chapter 1 Intro", 1, 2), ("Chapter 2 Sample Chapter 2", 3, 5)
+    ]
+    assert [s.start_page for s in chapters[1].sections] == [3, 4, 5]
+
+    for request in (
+        SamplePdfRequest(pages=5, chapter_count=4, front_matter_pages=2),
+        SamplePdfRequest(chapters=[SampleChapter(pages=2, sections=3)]),
+    ):
+        try:
+            sample_service.plan(request)
+            assert False, "页数不足时应拒绝"
+        except ValueError:
+            pass
+    print("✓ 章节均分剩余页数，节在章节内均分，页数不足时拒绝")
+
+
+def test_build():
+    """测试生成文件"""
+    print("\n测试生成文件...")
+
+    request = SamplePdfRequest(pages=12, chapter_count=3, sections_per_chapter=2, front_matter_pages=3)
+    with tempfile.TemporaryDirectory() as tmp:
+        chapters, pages = sample_service.build(request, Path(tmp) / "a.pdf")
+        sample_service.build(request, Path(tmp) / "b.pdf")
+
+        doc = fitz.open(Path(tmp) / "a.pdf")
+        try:
+            assert pages == len(doc) == 12
+            toc = doc.get_toc()
+            assert [(level, page) for level, title, page in toc if level == 1] == [(1, c.start_page) for c in chapters]
+            assert len([entry for entry in toc if entry[0] == 2]) == 6
+            for chapter in chapters:
+                assert chapter.title in doc[chapter.start_page - 1].get_text()
+                assert chapter.sections[1].title in doc[chapter.sections[1].start_page - 1].get_text()
+            assert "第1章" not in doc[1].get_text()
+        finally:
+            doc.close()
+
+        a = fitz.open(Path(tmp) / "a.pdf")
+        b = fitz.open(Path(tmp) / "b.pdf")
+        try:
+            assert all(a[i].get_text() == b[i].get_text() for i in range(len(a)))
+        finally:
+            a.close()
+            b.close()
+
+        sample_service.build(request.model_copy(update={"outline": False}), Path(tmp) / "plain.pdf")
+        doc = fitz.open(Path(tmp) / "plain.pdf")
+        try:
+            assert doc.get_toc() == [] and chapters[0].title in doc[3].get_text()
+        finally:
+            doc.close()
+    print("✓ 每章首页印有标题并写入两级书签，相同请求内容相同，可只保留正文标题")
@@ -0,0 +1,96 @@
+"""
+延迟任务测试，验证指定run_at的任务到期前不入队、到期后由调度器派发、已过期的时间立即入队，以及取消和跨副本同步
+"""
+
+import asyncio
+from datetime import datetime, timedelta
+from uuid import uuid4
+
+from src.core.store import get_store
+from src.models.schemas import ChapterInfo, TaskStatus
+from src.services.task_service import TASKS_BUCKET, TaskService
+
+
+CHAPTERS = [ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2)]
+
+
+def _replica() -> TaskService:
+    """不启动工作线程和调度器的服务实例，由测试直接调用派发"""
+    service = TaskService()
+    service._initialized = True
+    return service
+
+
+def _stored_status(task_id: str) -> str:
+    return get_store().get(TASKS_BUCKET, task_id)["status"]
+
+
+def test_dispatch_when_due(tmp_upload_dir):
+    """测试到期前不入队，到期后派发"""
+    print("测试延迟任务派发...")
+
+    service = _replica()
+
+    async def run():
+        run_at = datetime.now() + timedelta(hours=1)
+        task = await service.create_split_task(str(uuid4()), CHAPTERS, run_at=run_at)
+        assert task.status == TaskStatus.SCHEDULED and task.run_at == run_at
+        assert service._task_queue.empty()
+        assert await service._dispatch_due_tasks() == 0
+        assert _stored_status(task.task_id) == TaskStatus.SCHEDULED.value
+
+        # 计划时间已到
+        task.run_at = datetime.now() - timedelta(seconds=1)
+        assert await service._dispatch_due_tasks() == 1
+        assert task.status == TaskStatus.QUEUED and _stored_status(task.task_id) == TaskStatus.QUEUED.value
+        assert (await service._task_queue.get())[2] == task.task_id
+        assert await service._dispatch_due_tasks() == 0, "已派发的任务不会重复派发"
+
+        await asyncio.sleep(0)
+        events = [event.event for event in await service.get_task_events(task.task_id)]
+        assert events == ["scheduled", "due", "queued"]
+
+    asyncio.run(run())
+    print("✓ 延迟任务到期前保持scheduled，到期后切换为queued并加入队列")
+
+
+def test_past_run_at_and_cancel(tmp_upload_dir):
+    """测试已过期的计划时间立即入队，取消的延迟任务不再派发"""
+    print("\n测试过期时间和取消...")
+
+    service = _replica()
+
+    async def run():
+        past = await service.create_split_task(str(uuid4()), CHAPTERS, run_at=datetime.now() - timedelta(minutes=5))
+        assert past.status == TaskStatus.QUEUED
+        assert (await service._task_queue.get())[2] == past.task_id
+
+        future = await service.create_split_task(str(uuid4()), CHAPTERS, run_at=datetime.now() + timedelta(minutes=5))
+        assert await service.cancel_task(future.task_id)
+        future.run_at = datetime.now() - timedelta(seconds=1)
+        await service._dispatch_due_tasks()
+        assert future.status == TaskStatus.CANCELLED and service._task_queue.empty()
+
+    asyncio.run(run())
+    print("✓ 计划时间已过时直接入队，已取消的延迟任务到期后不会派发")
+
+
+def test_sync_from_other_replica(tmp_upload_dir):
+    """测试主节点派发其他副本创建的延迟任务"""
+    print("\n测试跨副本同步延迟任务...")
+
+    creator, leader = _replica(), _replica()
+
+    async def run():
+        task = await creator.create_split_task(str(uuid4()), CHAPTERS, run_at=datetime.now() + timedelta(seconds=30))
+        assert task.task_id not in leader.tasks
+
+        await leader._sync_scheduled_tasks()
+        assert leader.tasks[task.task_id].status == TaskStatus.SCHEDULED
+        leader.tasks[task.task_id].run_at = datetime.now() - timedelta(seconds=1)
+        assert await leader._dispatch_due_tasks() == 1
+        assert _stored_status(task.task_id) == TaskStatus.QUEUED.value
+        assert (await creator.get_task_status(task.task_id)).status == TaskStatus.QUEUED
+
+    asyncio.run(run())
+    print("✓ 其他副本创建的延迟任务由主节点同步并按时派发")
@@ -0,0 +1,88 @@
+"""
+任务临时目录测试，验证临时目录在结束时删除、输出原子提交且校验清单最后就位，以及启动时只清理崩溃遗留的目录
+"""
+
+import errno
+import os
+import tempfile
+from pathlib import Path
+
+from src.core import scratch
+from src.core.scratch import commit_outputs, scratch_dir, scratch_root, sweep_orphaned_scratch
+
+
+def test_scratch_dir(tmp_temp_dir):
+    """测试临时目录的创建和删除"""
+    print("测试临时目录...")
+
+    with scratch_dir("t1") as path:
+        assert path == scratch_root() / "t1"
+        (path / "01.pdf").write_bytes(b"x")
+    assert not path.exists()
+
+    try:
+        with scratch_dir() as path:
+            (path / "01.pdf").write_bytes(b"x")
+            raise RuntimeError("拆分失败")
+    except RuntimeError:
+        pass
+    assert not path.exists()
+    print("✓ 成功和失败时临时目录都被删除")
+
+
+def test_commit_outputs():
+    """测试提交输出"""
+    print("\n测试提交输出...")
+
+    original = os.replace
+    with tempfile.TemporaryDirectory() as tmp:
+        source, target = Path(tmp) / "source", Path(tmp) / "target"
+        source.mkdir()
+        for name in ("manifest.json", "01.pdf", "02.pdf"):
+            (source / name).write_text(name, encoding="utf-8")
+        (source / scratch.LOCK_FILENAME).touch()
+        target.mkdir()
+        (target / "01.pdf").write_text("旧文件", encoding="utf-8")
+
+        # 模拟跨文件系统：直接重命名临时目录中的文件失败
+        moved = []
+
+        def replace(src, dst):
+            if Path(src).parent == source:
+                raise OSError(errno.EXDEV, "跨文件系统")
+            moved.append(Path(dst).name)
+            original(src, dst)
+
+        scratch.os.replace = replace
+        try:
+            assert commit_outputs(source, target, last=["manifest.json"]) == 3
+        finally:
+            scratch.os.replace = original
+
+        assert moved[-1] == "manifest.json"
+        assert sorted(p.name for p in target.iterdir()) == ["01.pdf", "02.pdf", "manifest.json"]
+        assert (target / "01.pdf").read_text(encoding="utf-8") == "01.pdf"
+    print("✓ 跨文件系统时复制后替换，校验清单最后就位，不留下临时文件")
+
+
+def test_sweep(tmp_temp_dir):
+    """测试清理崩溃遗留的目录"""
+    print("\n测试启动清理...")
+
+    # 崩溃遗留：有锁文件但没有进程持有
+    orphan = scratch_root() / "crashed"
+    orphan.mkdir(parents=True)
+    (orphan / scratch.LOCK_FILENAME).touch()
+    (orphan / "01.pdf").write_bytes(b"x")
+
+    # 刚创建还没有锁文件的目录保留
+    fresh = scratch_root() / "fresh"
+    fresh.mkdir()
+
+    with scratch_dir("running") as running:
+        assert sweep_orphaned_scratch() == 1
+        assert not orphan.exists() and fresh.exists() and running.exists()
+
+    os.utime(fresh, (1, 1))
+    assert sweep_orphaned_scratch() == 1 and not fresh.exists()
+    print("✓ 只删除没有进程持有锁的目录")
@@ -0,0 +1,94 @@
+"""
+区域类型测试，验证按标题识别目录、前言、附录等区域，识别第一章之前的前置页面，以及非正文区域的单独输出、排除和合并
+"""
+
+import fitz
+
+from src.models.schemas import ChapterInfo, SectionHandling, SectionType
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _chapter(title: str, start: int, end: int, section_type: SectionType = SectionType.CHAPTER) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1, section_type=section_type)
+
+
+def _book():
+    """前置区域、两章正文、附录和索引"""
+    return [
+        _chapter("封面", 1, 1, SectionType.COVER),
+        _chapter("前言", 2, 3, SectionType.PREFACE),
+        _chapter("第一章", 4, 10),
+        _chapter("第二章", 11, 20),
+        _chapter("附录A", 21, 24, SectionType.APPENDIX),
+        _chapter("索引", 25, 26, SectionType.INDEX),
+    ]
+
+
+def test_classify_titles():
+    """测试按标题识别区域类型"""
+    print("测试区域类型识别...")
+
+    analyzer = PDFAnalyzer()
+    titles = ["目录", "前言", "第一章 绪论", "附录 A 数据表", "参考文献", "Table of Contents", "Appendix B", "Index", "Indexing Methods"]
+    classified = analyzer._classify_sections([_chapter(title, i + 1, i + 1) for i, title in enumerate(titles)])
+    assert [chapter.section_type for chapter in classified] == [
+        SectionType.TOC, SectionType.PREFACE, SectionType.CHAPTER, SectionType.APPENDIX, SectionType.BIBLIOGRAPHY,
+        SectionType.TOC, SectionType.APPENDIX, SectionType.INDEX, SectionType.CHAPTER,
+    ]
+    print("✓ 按标题开头的关键词识别区域类型，英文关键词需完整单词匹配，其余标题视为正文章节")
+
+
+def test_detect_front_matter(pdf_bytes):
+    """测试识别第一章之前的封面、目录和前言"""
+    print("\n测试识别前置区域...")
+
+    data = pdf_bytes(
+        "A Book",
+        "Contents\nChapter 1 Introduction ........ 1",
+        "Chapter 2 Methods ........ 9\nChapter 3 Results ........ 20",
+        "Preface\n" + "These notes began as lectures. " * 10,
+        "Dedicated to my teachers. " * 10,
+        "Chapter 1 Introduction",
+    )
+    with fitz.open(stream=data, filetype="pdf") as doc:
+        regions = PDFAnalyzer()._detect_front_matter(doc, 6)
+
+    assert [(r.section_type, r.start_page, r.end_page, r.page_count) for r in regions] == [
+        (SectionType.COVER, 1, 1, 1),
+        (SectionType.TOC, 2, 3, 2),
+        (SectionType.PREFACE, 4, 4, 1),
+        (SectionType.FRONT_MATTER, 5, 5, 1),
+    ]
+    assert [r.title for r in regions] == ["封面", "目录", "前言", "前置内容"]
+    print("✓ 第一页文字较少时为封面，没有标题的目录续页并入目录，无法识别的页面为前置内容")
+
+
+def test_section_handling():
+    """测试非正文区域的单独输出、排除和合并"""
+    print("\n测试非正文区域处理...")
+
+    analyzer = PDFAnalyzer()
+
+    def ranges(chapters):
+        return [(chapter.title, chapter.start_page, chapter.end_page) for chapter in chapters]
+
+    assert ranges(analyzer.apply_section_handling(_book(), SectionHandling.INCLUDE)) == ranges(_book())
+    assert ranges(analyzer.apply_section_handling(_book(), SectionHandling.EXCLUDE)) == [
+        ("第一章", 4, 10), ("第二章", 11, 20),
+    ]
+    # 前置内容并入后一章，后置内容并入前一章
+    merged = analyzer.apply_section_handling(_book(), SectionHandling.MERGE)
+    assert ranges(merged) == [("第一章", 1, 10), ("第二章", 11, 26)]
+    assert [chapter.page_count for chapter in merged] == [10, 16]
+
+    # 按类型覆盖默认处理方式
+    handled = analyzer.apply_section_handling(_book(), SectionHandling.EXCLUDE, {
+        SectionType.APPENDIX: SectionHandling.INCLUDE,
+        SectionType.PREFACE: SectionHandling.MERGE,
+    })
+    assert ranges(handled) == [("第一章", 2, 10), ("第二章", 11, 20), ("附录A", 21, 24)]
+
+    # 没有正文章节可并入时保留为独立区域
+    front_only = [_chapter("封面", 1, 1, SectionType.COVER), _chapter("目录", 2, 3, SectionType.TOC)]
+    assert ranges(analyzer.apply_section_handling(front_only, SectionHandling.MERGE)) == ranges(front_only)
+    print("✓ 非正文区域可单独输出、排除或并入相邻章节，并可按区域类型覆盖")
@@ -0,0 +1,178 @@
+"""
+分享链接测试，验证章节授权、有效期、下载次数上限、吊销、公开访问规则，分享下载拒绝原文件并在发送前计数，
+以及下载只能读取章节目录中的文件
+"""
+
+import asyncio
+from datetime import datetime, timedelta
+from uuid import uuid4
+
+from fastapi import HTTPException
+
+from src.api.middleware import required_role
+from src.api.routes import download_shared_file
+from src.core.store import get_store
+from src.core.tenancy import file_storage_dir, use_tenant
+from src.models.schemas import ManifestEntry, OutputManifest, Role, ShareLinkRequest
+from src.services.file_service import FileService
+from src.services.pdf_splitter import MANIFEST_FILENAME
+from src.services.share_link_service import SHARE_LINKS_BUCKET, hash_share_token, share_link_service
+
+
+def _manifest(count: int) -> OutputManifest:
+    return OutputManifest(files=[
+        ManifestEntry(
+            filename=f"{index:02d}_chapter.pdf", title=f"第{index}章", start_page=index, end_page=index,
+            pages=1, size=1, sha256="0" * 64
+        )
+        for index in range(1, count + 1)
+    ])
+
+
+def test_chapter_scope(tmp_upload_dir):
+    """测试只授权部分章节"""
+    print("测试章节授权...")
+
+    async def run():
+        link, token = await share_link_service.create("f1", ShareLinkRequest(chapters=[3, 1, 2, 2]), _manifest(5))
+        assert link.chapters == [1, 2, 3]
+        assert link.filenames == ["01_chapter.pdf", "02_chapter.pdf", "03_chapter.pdf"]
+
+        resolved = await share_link_service.resolve(token)
+        assert resolved and resolved.link_id == link.link_id and resolved.tenant_id == "default"
+        manifest = _manifest(5)
+        assert share_link_service.allows(resolved, "03_chapter.pdf", manifest)
+        assert not share_link_service.allows(resolved, "04_chapter.pdf", manifest)
+        assert not share_link_service.allows(resolved, "original.pdf", manifest)
+
+        # 未指定章节时授权清单中的全部章节，不包括原文件和清单外的文件
+        _, token = await share_link_service.create("f1", ShareLinkRequest(), manifest)
+        full = await share_link_service.resolve(token)
+        assert share_link_service.allows(full, "05_chapter.pdf", manifest)
+        for filename in ("", "original.pdf", "06_chapter.pdf"):
+            assert not share_link_service.allows(full, filename, manifest), filename
+        assert not share_link_service.allows(full, "05_chapter.pdf", None)
+
+        for chapters in ([0], [6], []):
+            try:
+                await share_link_service.create("f1", ShareLinkRequest(chapters=chapters), _manifest(5))
+                assert False, "应拒绝无效的章节序号"
+            except ValueError:
+                pass
+
+        # 令牌只保存哈希
+        assert get_store().get(SHARE_LINKS_BUCKET, token) is None
+        assert get_store().get(SHARE_LINKS_BUCKET, hash_share_token(token))
+        assert await share_link_service.resolve("pcs_share_unknown") is None
+
+    asyncio.run(run())
+    print("✓ 只能下载授权的章节，序号越界时拒绝创建")
+
+
+def test_limits_and_revoke(tmp_upload_dir):
+    """测试下载次数上限、过期和吊销"""
+    print("\n测试有效期与下载次数...")
+
+    async def run():
+        _, token = await share_link_service.create("f1", ShareLinkRequest(max_downloads=2), _manifest(1))
+        assert (await share_link_service.consume(token)).download_count == 1
+        assert (await share_link_service.consume(token)).download_count == 2
+        assert await share_link_service.consume(token) is None
+        assert await share_link_service.resolve(token) is None
+
+        link, token = await share_link_service.create("f1", ShareLinkRequest(expires_in_hours=1), _manifest(1))
+        assert link.expires_at > datetime.now()
+        key = hash_share_token(token)
+        data = get_store().get(SHARE_LINKS_BUCKET, key)
+        data["expires_at"] = (datetime.now() - timedelta(minutes=1)).isoformat()
+        get_store().put(SHARE_LINKS_BUCKET, key, data)
+        assert await share_link_service.resolve(token) is None
+
+        link, token = await share_link_service.create("f1", ShareLinkRequest(), _manifest(1))
+        with use_tenant("acme"):
+            assert await share_link_service.list("f1") == []
+            assert await share_link_service.revoke("f1", link.link_id) is None
+        assert len(await share_link_service.list("f1")) == 3
+        assert (await share_link_service.revoke("f1", link.link_id)).revoked_at
+        assert await share_link_service.resolve(token) is None
+        assert await share_link_service.consume(token) is None
+
+    asyncio.run(run())
+    print("✓ 过期、吊销或次数用尽的链接立即失效")
+
+
+def test_shared_download(tmp_upload_dir):
+    """测试分享下载拒绝空文件名和原文件，发送前占用下载次数"""
+    print("\n测试分享下载...")
+
+    file_id = str(uuid4())
+    manifest = _manifest(2)
+    chapters_dir = file_storage_dir(file_id) / "chapters"
+    chapters_dir.mkdir(parents=True)
+    (chapters_dir / MANIFEST_FILENAME).write_text(manifest.model_dump_json(), encoding="utf-8")
+    (chapters_dir / "01_chapter.pdf").write_bytes(b"%PDF-1.4")
+    (chapters_dir.parent / "original.pdf").write_bytes(b"%PDF-1.4 original")
+
+    async def download(token, filename, if_none_match=None):
+        try:
+            return await download_shared_file(token, filename, True, if_none_match, None)
+        except HTTPException as e:
+            return e
+
+    async def run():
+        _, token = await share_link_service.create(file_id, ShareLinkRequest(max_downloads=3), manifest)
+
+        # 授权全部章节的链接同样不能通过空文件名下载原文件
+        assert (await download(token, "")).status_code == 400
+        assert (await download(token, "original.pdf")).status_code == 403
+        assert (await share_link_service.resolve(token)).download_count == 0
+
+        response = await download(token, "01_chapter.pdf")
+        assert response.status_code == 200 and response.headers["cache-control"] == "private, no-cache"
+        assert (await share_link_service.resolve(token)).download_count == 1
+
+        # 304不发送内容，归还下载次数
+        cached = await download(token, "01_chapter.pdf", response.headers["etag"])
+        assert cached.status_code == 304
+        assert (await share_link_service.resolve(token)).download_count == 1
+
+        # 发送失败的请求同样计数，不能无限重试
+        assert (await download(token, "02_chapter.pdf")).status_code == 404
+        assert (await share_link_service.resolve(token)).download_count == 2
+        assert (await download(token, "01_chapter.pdf")).status_code == 200
+        assert (await download(token, "01_chapter.pdf")).status_code == 404
+
+    asyncio.run(run())
+    print("✓ 空文件名返回400，原文件返回403，下载次数在发送前占用，304归还")
+
+
+def test_public_access_rule():
+    """测试分享下载无需API Key，管理链接需要editor"""
+    print("\n测试访问规则...")
+
+    assert required_role("GET", "/api/shared/pcs_share_abc") is None
+    assert required_role("GET", "/api/shared/pcs_share_abc/download") is None
+    assert required_role("POST", "/api/shared/pcs_share_abc/download") == Role.EDITOR
+    assert required_role("POST", "/api/files/f1/share-links") == Role.EDITOR
+    assert required_role("GET", "/api/files/f1/share-links") == Role.VIEWER
+    print("✓ 分享接口公开，其余接口按角色控制")
+
+
+def test_download_path_confined(tmp_upload_dir):
+    """测试分享和普通下载只返回章节目录中的普通文件"""
+    print("\n测试下载路径限制...")
+
+    file_id = str(uuid4())
+    chapters_dir = file_storage_dir(file_id) / "chapters"
+    (chapters_dir / "subdir").mkdir(parents=True)
+    (chapters_dir / "01_chapter.pdf").write_bytes(b"%PDF-1.4")
+    (chapters_dir.parent / "original.pdf").write_bytes(b"%PDF-1.4")
+    secret = tmp_upload_dir / "secret.txt"
+    secret.write_text("secret")
+    (chapters_dir / "escape.pdf").symlink_to(secret)
+    service = FileService()
+
+    assert asyncio.run(service.get_download_path(file_id, "01_chapter.pdf")) == str(chapters_dir / "01_chapter.pdf")
+    for name in [".", "..", "subdir", "escape.pdf", "../original.pdf", "missing.pdf"]:
+        assert asyncio.run(service.get_download_path(file_id, name)) is None, name
+    print("✓ 拒绝 . 和 ..、目录以及指向章节目录外的符号链接")
@@ -0,0 +1,97 @@
+"""
+共享资源测试，验证多页共享的图片在章节输出中只保留一份，内容相同但重复嵌入的图片在保存时合并
+"""
+
+import asyncio
+import random
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.core.config import settings
+from src.models.schemas import ChapterInfo
+from src.services.pdf_splitter import PDFSplitter
+
+
+def _pixmap() -> fitz.Pixmap:
+    # 随机像素无法压缩，重复的图片会明显增大文件
+    return fitz.Pixmap(fitz.csRGB, 200, 200, random.Random(1).randbytes(200 * 200 * 3), False)
+
+
+def _shared_pdf(path: Path, pages: int) -> None:
+    """所有页面引用同一个图片对象"""
+    doc = fitz.open()
+    xref = 0
+    for i in range(pages):
+        page = doc.new_page()
+        page.insert_text((72, 72), f"Page {i + 1}")
+        xref = page.insert_image(fitz.Rect(72, 100, 272, 300), pixmap=_pixmap(), xref=xref)
+    doc.save(str(path))
+    doc.close()
+
+
+def _duplicated_pdf(path: Path, pages: int) -> None:
+    """每页各自嵌入一份内容相同的图片（逐页从不同文档合并而来）"""
+    doc = fitz.open()
+    for i in range(pages):
+        single = fitz.open()
+        page = single.new_page()
+        page.insert_text((72, 72), f"Page {i + 1}")
+        page.insert_image(fitz.Rect(72, 100, 272, 300), pixmap=_pixmap())
+        doc.insert_pdf(single)
+        single.close()
+    doc.save(str(path))
+    doc.close()
+
+
+def _image_xrefs(path: Path):
+    with fitz.open(str(path)) as doc:
+        return {image[0] for page in doc for image in page.get_images()}
+
+
+def _split(source: Path, output_dir: Path, **kwargs) -> Path:
+    chapters = [ChapterInfo(title="第1章", start_page=1, end_page=4, page_count=4)]
+    links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), **kwargs))
+    return output_dir / links[0]
+
+
+def test_shared_image():
+    """测试共享图片只复制一份"""
+    print("测试共享图片...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "shared.pdf"
+        _shared_pdf(source, 6)
+        assert len(_image_xrefs(source)) == 1
+
+        for best_effort in (False, True):
+            output = _split(source, Path(tmp) / f"out_{best_effort}", best_effort=best_effort)
+            assert len(_image_xrefs(output)) == 1
+            assert output.stat().st_size < 2 * 200 * 200 * 3
+    print("✓ 整段复制和逐页复制时共享图片都只保留一份")
+
+
+def test_duplicated_images():
+    """测试合并内容相同的重复图片"""
+    print("\n测试合并重复图片...")
+
+    original = settings.DEDUPLICATE_OUTPUT_OBJECTS
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "duplicated.pdf"
+        _duplicated_pdf(source, 4)
+        assert len(_image_xrefs(source)) == 4
+
+        try:
+            settings.DEDUPLICATE_OUTPUT_OBJECTS = True
+            merged = _split(source, Path(tmp) / "merged")
+            settings.DEDUPLICATE_OUTPUT_OBJECTS = False
+            plain = _split(source, Path(tmp) / "plain")
+        finally:
+            settings.DEDUPLICATE_OUTPUT_OBJECTS = original
+
+        assert len(_image_xrefs(merged)) == 1 and len(_image_xrefs(plain)) == 4
+        assert merged.stat().st_size * 2 < plain.stat().st_size
+        with fitz.open(str(merged)) as doc:
+            assert [page.get_text().strip() for page in doc] == ["Page 1", "Page 2", "Page 3", "Page 4"]
+    print("✓ 内容相同的图片合并为一个对象，章节文件显著变小")
@@ -0,0 +1,61 @@
+"""
+短章节合并测试，验证少于min_pages页的章节并入前一章、开头的短章节并入后一章、连续的短章节依次合并，以及合并记录
+"""
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_analyzer import PDFAnalyzer
+
+
+def _chapter(title: str, start: int, end: int) -> ChapterInfo:
+    return ChapterInfo(title=title, start_page=start, end_page=end, page_count=end - start + 1)
+
+
+def _ranges(chapters):
+    return [(chapter.title, chapter.start_page, chapter.end_page, chapter.page_count) for chapter in chapters]
+
+
+def test_merge_into_neighbours():
+    """测试短章节并入相邻章节"""
+    print("测试短章节合并...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [
+        _chapter("题记", 1, 1),
+        _chapter("第1章", 2, 10),
+        _chapter("插页", 11, 11),
+        _chapter("图版", 12, 13),
+        _chapter("第2章", 14, 30),
+        _chapter("后记", 31, 32),
+    ]
+    merged, merges = analyzer.merge_small_chapters(chapters, 3)
+
+    assert _ranges(merged) == [("第1章", 1, 13, 13), ("第2章", 14, 32, 19)]
+    assert [(m.title, m.start_page, m.end_page, m.merged_into) for m in merges] == [
+        ("题记", 1, 1, "第1章"),
+        ("插页", 11, 11, "第1章"),
+        ("图版", 12, 13, "第1章"),
+        ("后记", 31, 32, "第2章"),
+    ]
+    print("✓ 开头的短章节并入后一章，其余短章节并入前一章，连续的短章节依次合并")
+
+
+def test_merge_edge_cases():
+    """测试不需要合并和全部过短的情况"""
+    print("\n测试短章节合并的边界情况...")
+
+    analyzer = PDFAnalyzer()
+    chapters = [_chapter("第1章", 1, 1), _chapter("第2章", 2, 3)]
+
+    for min_pages in (0, 1):
+        assert analyzer.merge_small_chapters(chapters, min_pages) == (chapters, [])
+    assert analyzer.merge_small_chapters(chapters[:1], 5) == (chapters[:1], [])
+
+    # 按起始页排序后合并
+    merged, merges = analyzer.merge_small_chapters(list(reversed(chapters)), 2)
+    assert _ranges(merged) == [("第2章", 1, 3, 3)] and merges[0].merged_into == "第2章"
+
+    # 全部过短时保留累积的最后一段
+    merged, merges = analyzer.merge_small_chapters([_chapter("A", 1, 1), _chapter("B", 2, 2), _chapter("C", 3, 3)], 5)
+    assert _ranges(merged) == [("C", 1, 3, 3)]
+    assert [(m.title, m.merged_into) for m in merges] == [("A", "B"), ("B", "C")]
+    print("✓ min_pages不大于1或只有一章时不合并，全部章节过短时合并为一个章节")
@@ -0,0 +1,104 @@
+"""
+数字签名处理测试，验证签名检测、章节中签名字段的删除和签名原件的附带
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import ChapterInfo
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter
+from src.services.signatures import (
+    SIGNED_ORIGINAL_FILENAME,
+    count_signatures,
+    remove_signature_fields,
+    signature_warnings,
+)
+
+
+def _signed_pdf(path: Path, signed: bool = True) -> None:
+    """生成带签名字段的PDF，signed时写入签名值（内容不是真实签名，只用于检测）"""
+    doc = fitz.open()
+    for i in range(3):
+        doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+
+    widget = fitz.Widget()
+    widget.field_type = fitz.PDF_WIDGET_TYPE_SIGNATURE
+    widget.field_name = "Signature1"
+    widget.rect = fitz.Rect(72, 700, 272, 750)
+    doc[0].add_widget(widget)
+
+    if signed:
+        xref = next(doc[0].widgets()).xref
+        doc.xref_set_key(xref, "V", "<< /Type /Sig /Filter /Adobe.PPKLite /ByteRange [0 0 0 0] /Contents <00> >>")
+        doc.xref_set_key(doc.pdf_catalog(), "AcroForm/SigFlags", "3")
+    doc.save(str(path))
+    doc.close()
+
+
+def test_count_signatures():
+    """测试只统计已签名的字段"""
+    print("测试检测数字签名...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        signed = Path(tmp) / "signed.pdf"
+        blank = Path(tmp) / "blank.pdf"
+        _signed_pdf(signed)
+        _signed_pdf(blank, signed=False)
+
+        assert count_signatures(signed) == 1
+        assert count_signatures(blank) == 0
+        assert count_signatures(Path(tmp) / "missing.pdf") == 0
+        assert signature_warnings(1) and not signature_warnings(0)
+    print("✓ 已签名字段被检测到，空白签名域和无效文件不计入")
+
+
+def test_remove_signature_fields():
+    """测试删除签名字段并清除签名标志"""
+    print("\n测试删除签名字段...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        path = Path(tmp) / "signed.pdf"
+        _signed_pdf(path)
+
+        with fitz.open(str(path)) as doc:
+            assert remove_signature_fields(doc) == 1
+            assert not list(doc[0].widgets())
+            assert doc.get_sigflags() < 1
+            assert "Page 1" in doc[0].get_text()
+    print("✓ 签名字段和标志被删除，页面内容保留")
+
+
+def test_split_include_original():
+    """测试拆分时删除章节中的签名并附带未修改的签名原件"""
+    print("\n测试附带签名原件...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "original.pdf"
+        _signed_pdf(source)
+        output_dir = Path(tmp) / "out"
+        chapters = [
+            ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2),
+            ChapterInfo(title="第二章", start_page=3, end_page=3, page_count=1),
+        ]
+
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source),
+            chapters,
+            str(output_dir),
+            strip_signatures=True,
+            signed_original=str(source)
+        ))
+
+        assert links[-1] == SIGNED_ORIGINAL_FILENAME
+        assert (output_dir / SIGNED_ORIGINAL_FILENAME).read_bytes() == source.read_bytes()
+        assert count_signatures(output_dir / links[0]) == 0
+
+        manifest = json.loads((output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+        entry = manifest["files"][-1]
+        assert entry["filename"] == SIGNED_ORIGINAL_FILENAME
+        assert entry["pages"] == 3
+    print("✓ 章节中签名已删除，签名原件原样附带并记入清单")
@@ -0,0 +1,113 @@
+"""
+章节输出签名测试，用临时生成的自签名证书签名章节（未安装pyHanko时跳过签名部分）
+"""
+
+import asyncio
+import datetime
+import importlib.util
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+from cryptography import x509
+from cryptography.hazmat.primitives import hashes
+from cryptography.hazmat.primitives.asymmetric import rsa
+from cryptography.hazmat.primitives.serialization import BestAvailableEncryption, pkcs12
+from cryptography.x509.oid import NameOID
+
+from src.core.config import settings
+from src.models.schemas import ChapterInfo, SigningMode
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter
+from src.services.signatures import count_signatures
+from src.services.signing_service import SigningService, signing_service
+
+
+def _write_pkcs12(path: Path, password: bytes) -> None:
+    """生成自签名证书并保存为PKCS#12"""
+    key = rsa.generate_private_key(public_exponent=65537, key_size=2048)
+    name = x509.Name([x509.NameAttribute(NameOID.COMMON_NAME, "PDF Splitter Test")])
+    now = datetime.datetime.now(datetime.timezone.utc)
+    cert = (
+        x509.CertificateBuilder()
+        .subject_name(name)
+        .issuer_name(name)
+        .public_key(key.public_key())
+        .serial_number(x509.random_serial_number())
+        .not_valid_before(now - datetime.timedelta(days=1))
+        .not_valid_after(now + datetime.timedelta(days=30))
+        .sign(key, hashes.SHA256())
+    )
+    path.write_bytes(pkcs12.serialize_key_and_certificates(
+        b"test", key, cert, None, BestAvailableEncryption(password)
+    ))
+
+
+def test_unconfigured():
+    """测试未配置证书时签名失败"""
+    print("测试未配置证书...")
+
+    original = (settings.SIGNING_CERT_PATH, settings.SIGNING_CERT_AWS_SECRET_ID)
+    settings.SIGNING_CERT_PATH = ""
+    settings.SIGNING_CERT_AWS_SECRET_ID = ""
+    try:
+        service = SigningService()
+        assert not service.configured
+        try:
+            asyncio.run(service.sign(Path("missing.pdf"), SigningMode.INVISIBLE))
+            assert False, "未配置证书时应失败"
+        except RuntimeError:
+            pass
+    finally:
+        settings.SIGNING_CERT_PATH, settings.SIGNING_CERT_AWS_SECRET_ID = original
+    print("✓ 未配置证书时拒绝签名")
+
+
+def test_split_signed():
+    """测试拆分时签名每个章节（未安装pyHanko时跳过）"""
+    print("\n测试签名章节输出...")
+
+    if importlib.util.find_spec("pyhanko") is None:
+        print("✓ 未安装pyHanko，跳过")
+        return
+
+    original = (settings.SIGNING_CERT_PATH, settings.SIGNING_CERT_PASSWORD)
+    with tempfile.TemporaryDirectory() as tmp:
+        cert_path = Path(tmp) / "signing.p12"
+        _write_pkcs12(cert_path, b"secret")
+        settings.SIGNING_CERT_PATH = str(cert_path)
+        settings.SIGNING_CERT_PASSWORD = "secret"
+        signing_service._signer = None
+        try:
+            source = Path(tmp) / "source.pdf"
+            doc = fitz.open()
+            for i in range(2):
+                doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+            doc.save(str(source))
+            doc.close()
+
+            output_dir = Path(tmp) / "out"
+            chapters = [
+                ChapterInfo(title="第一章", start_page=1, end_page=1, page_count=1),
+                ChapterInfo(title="第二章", start_page=2, end_page=2, page_count=1),
+            ]
+            splitter = PDFSplitter()
+            invisible = asyncio.run(splitter.split_pdf(
+                str(source), chapters[:1], str(output_dir / "invisible"), sign=SigningMode.INVISIBLE
+            ))
+            visible = asyncio.run(splitter.split_pdf(
+                str(source), chapters[1:], str(output_dir / "visible"), sign=SigningMode.VISIBLE
+            ))
+
+            assert count_signatures(output_dir / "invisible" / invisible[0]) == 1
+            with fitz.open(str(output_dir / "visible" / visible[0])) as output:
+                widget = next(output[-1].widgets())
+                assert not widget.rect.is_empty
+                assert "Page 2" in output[0].get_text()
+
+            manifest = json.loads((output_dir / "visible" / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+            assert "PDF Splitter Test" in manifest["files"][0]["signed_by"]
+        finally:
+            settings.SIGNING_CERT_PATH, settings.SIGNING_CERT_PASSWORD = original
+            signing_service._signer = None
+    print("✓ 章节输出已签名，可见签名框位于最后一页，证书主体记入清单")
@@ -0,0 +1,205 @@
+"""
+拆分检查点测试，验证中断后重新拆分时已完成的章节从检查点恢复（Bates编号连续、输出与完整拆分一致）、
+检查点文件被改动时重新拆分该章节、检查点按租户隔离，重试失败或已取消的任务，以及启动时恢复中断的任务
+"""
+
+import asyncio
+import os
+from pathlib import Path
+
+from src.core.errors import ConflictError
+from src.core.leader import leader_election
+from src.core.store import get_store
+from src.models.schemas import BatesConfig, ChapterInfo, SplitTask, TaskStatus
+from src.services.pdf_splitter import PDFSplitter
+from src.services.split_checkpoint import SplitCheckpoint, cleanup_checkpoints
+from src.services.task_service import TASKS_BUCKET, TaskService
+
+CHAPTERS = [
+    ChapterInfo(title=f"第{i}章", start_page=i * 2 - 1, end_page=i * 2, page_count=2)
+    for i in range(1, 5)
+]
+
+
+def _split(source: Path, output_dir: Path, checkpoint=None, stop_after=None):
+    """拆分并记录完成的章节，stop_after章完成后模拟进程中断（取消）"""
+    completed = []
+
+    def on_chapter(index, chapter, filename, error):
+        completed.append(index)
+        if index == stop_after:
+            raise asyncio.CancelledError()
+
+    async def run():
+        return await PDFSplitter().split_pdf(
+            str(source),
+            CHAPTERS,
+            str(output_dir),
+            chapter_callback=on_chapter,
+            bates=BatesConfig(prefix="B-", digits=3),
+            checkpoint=checkpoint
+        )
+
+    try:
+        links = asyncio.run(run())
+    except asyncio.CancelledError:
+        links = None
+    return links, completed
+
+
+def test_resume(make_pdf, tmp_path, tmp_temp_dir):
+    """测试从检查点继续"""
+    print("测试从检查点继续...")
+
+    source = tmp_path / "book.pdf"
+    make_pdf(source, 8)
+    full_links, _ = _split(source, tmp_path / "full")
+    full_manifest = (tmp_path / "full" / "manifest.json").read_text(encoding="utf-8")
+
+    links, completed = _split(source, tmp_path / "first", SplitCheckpoint("key", "team-a"), stop_after=2)
+    assert links is None and completed == [1, 2]
+    checkpoint = SplitCheckpoint("key", "team-a")
+    assert checkpoint.completed == 2
+
+    # 新进程以相同请求重新拆分，前两章直接恢复
+    restored = []
+    original_save = checkpoint.save
+    checkpoint.save = lambda index, *args: (restored.append(index), original_save(index, *args))
+    links, completed = _split(source, tmp_path / "second", checkpoint)
+    assert links == full_links and completed == [1, 2, 3, 4]
+    assert restored == [3, 4], "只有未完成的章节重新拆分"
+
+    full = tmp_path / "full"
+    second = tmp_path / "second"
+    for name in full_links:
+        assert (full / name).stat().st_size == (second / name).stat().st_size, name
+    manifest = (second / "manifest.json").read_text(encoding="utf-8")
+    # Bates编号在恢复的章节之后连续
+    for bates in ("B-001", "B-004", "B-005", "B-008"):
+        assert bates in manifest and bates in full_manifest
+    checkpoint.clear()
+    assert SplitCheckpoint("key", "team-a").completed == 0
+    print("✓ 中断前完成的章节从检查点恢复，Bates编号连续，输出与完整拆分一致")
+
+
+def test_tampered_checkpoint(make_pdf, tmp_path, tmp_temp_dir):
+    """测试检查点文件与记录不一致"""
+    print("\n测试检查点校验...")
+
+    source = tmp_path / "book.pdf"
+    make_pdf(source, 8)
+    _split(source, tmp_path / "first", SplitCheckpoint("key", "team-a"), stop_after=2)
+    checkpoint = SplitCheckpoint("key", "team-a")
+    saved = sorted(checkpoint.path.glob("*.pdf"))[0]
+    # 检查点中的文件是硬链接，替换而不是原地修改
+    saved.unlink()
+    saved.write_bytes(b"corrupted")
+
+    assert checkpoint.restore(1, tmp_path) is None
+    assert checkpoint.restore(2, tmp_path) is not None
+    assert checkpoint.completed == 1
+    print("✓ 文件与记录不一致的章节重新拆分")
+
+
+def test_tenant_scope(make_pdf, tmp_path, tmp_temp_dir):
+    """测试检查点按租户隔离"""
+    print("\n测试检查点租户隔离...")
+
+    source = tmp_path / "book.pdf"
+    make_pdf(source, 8)
+    _split(source, tmp_path / "first", SplitCheckpoint("key", "team-a"), stop_after=2)
+    assert SplitCheckpoint("key", "team-a").completed == 2
+    assert SplitCheckpoint("key", "team-b").completed == 0, "其他租户以相同文件和选项拆分时不恢复"
+
+    assert cleanup_checkpoints(max_age_hours=1) == 0
+    stale = SplitCheckpoint("key", "team-a").path
+    os.utime(stale, (0, 0))
+    assert cleanup_checkpoints(max_age_hours=1) == 1
+    assert not stale.parent.exists(), "空的租户目录一并删除"
+    print("✓ 检查点按租户分目录，过期清理后删除空目录")
+
+
+def test_recover_tasks(tmp_upload_dir, monkeypatch):
+    """测试恢复中断的任务"""
+    print("\n测试恢复中断的任务...")
+
+    service = TaskService()
+    enqueued = []
+
+    async def enqueue(task, message=""):
+        enqueued.append(task.task_id)
+        return True
+
+    service._enqueue = enqueue
+    tasks = {
+        "pending": SplitTask(task_id="pending", file_id="f", status=TaskStatus.PENDING),
+        "queued": SplitTask(task_id="queued", file_id="f", status=TaskStatus.QUEUED),
+        "own": SplitTask(task_id="own", file_id="f", status=TaskStatus.PROCESSING, worker_node=leader_election.node_id),
+        "dead": SplitTask(task_id="dead", file_id="f", status=TaskStatus.PROCESSING, worker_node="stopped-node"),
+        "alive": SplitTask(task_id="alive", file_id="f", status=TaskStatus.PROCESSING, worker_node="running-node"),
+    }
+
+    async def is_node_alive(node_id: str) -> bool:
+        return node_id in (leader_election.node_id, "running-node")
+
+    monkeypatch.setattr(leader_election, "is_node_alive", is_node_alive)
+
+    async def run():
+        for task in tasks.values():
+            service.tasks[task.task_id] = task
+            await get_store().aput(TASKS_BUCKET, task.task_id, task.model_dump(mode="json"))
+        await service._recover_tasks(list(tasks.values()), requeue=True)
+
+    asyncio.run(run())
+
+    assert enqueued == ["pending", "queued"]
+    assert tasks["own"].status == TaskStatus.FAILED and tasks["dead"].status == TaskStatus.FAILED
+    assert "检查点" in tasks["dead"].error_message
+    assert tasks["alive"].status == TaskStatus.PROCESSING, "仍在运行的副本上的任务不受影响"
+    print("✓ 待入队和已入队的任务重新排队，本副本重启前和已停止副本上的处理中任务标记为失败")
+
+
+def test_retry_task(tmp_upload_dir):
+    """测试重试任务"""
+    print("\n测试重试任务...")
+
+    service = TaskService()
+    created = []
+
+    async def create_split_task(file_id, chapters, **options):
+        created.append((file_id, chapters, options))
+        return SplitTask(task_id="new", file_id=file_id, chapters=chapters)
+
+    service.create_split_task = create_split_task
+
+    def add(task):
+        service.tasks[task.task_id] = task
+        get_store().put(TASKS_BUCKET, task.task_id, task.model_dump(mode="json"))
+
+    async def run():
+        for status in (TaskStatus.PROCESSING, TaskStatus.COMPLETED):
+            add(SplitTask(task_id="done", file_id="f", chapters=CHAPTERS, status=status))
+            try:
+                await service.retry_task("done")
+                assert False, "只能重试失败或已取消的任务"
+            except ConflictError:
+                pass
+
+        add(SplitTask(
+            task_id="failed",
+            file_id="f",
+            chapters=CHAPTERS,
+            status=TaskStatus.FAILED,
+            bates=BatesConfig(prefix="B-"),
+            filename_template="{title}"
+        ))
+        task = await service.retry_task("failed")
+        assert task.task_id == "new" and await service.retry_task("missing") is None
+        file_id, chapters, options = created[0]
+        assert file_id == "f" and chapters == CHAPTERS
+        assert options["bates"].prefix == "B-" and options["filename_template"] == "{title}"
+        await asyncio.sleep(0)
+        assert service.task_events["failed"][-1].details == {"retry_task_id": "new"}
+
+    asyncio.run(run())
+    print("✓ 以相同章节和选项创建新任务，未结束或已完成的任务不能重试")
@@ -0,0 +1,94 @@
+"""
+页面盖印测试，验证跨章节连续的Bates编号、manifest记录和章节页码重新编号
+"""
+
+import asyncio
+import json
+import tempfile
+from pathlib import Path
+
+import fitz
+
+from src.models.schemas import BatesConfig, ChapterInfo, PageNumberStamp, StampPosition
+from src.services.stamping import format_bates, validate_page_number_format
+from src.services.pdf_splitter import MANIFEST_FILENAME, PDFSplitter
+
+
+def test_format_bates():
+    """测试编号格式"""
+    print("测试编号格式...")
+
+    assert format_bates(BatesConfig(prefix="ACME-"), 42) == "ACME-000042"
+    assert format_bates(BatesConfig(digits=3), 7) == "007"
+    assert format_bates(BatesConfig(digits=2), 1234) == "1234"
+    print("✓ 前缀加定长数字")
+
+
+def test_split_with_bates():
+    """测试编号跨章节连续并记录在manifest中"""
+    print("\n测试跨章节编号...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        doc = fitz.open()
+        for _ in range(5):
+            doc.new_page()
+        doc.save(str(source))
+        doc.close()
+
+        chapters = [
+            ChapterInfo(title="起诉状", start_page=1, end_page=2, page_count=2),
+            ChapterInfo(title="证据", start_page=3, end_page=5, page_count=3),
+        ]
+        config = BatesConfig(prefix="ACME-", start=100, position=StampPosition.TOP_LEFT)
+        output_dir = Path(tmp) / "out"
+        links = asyncio.run(PDFSplitter().split_pdf(str(source), chapters, str(output_dir), bates=config))
+
+        with fitz.open(str(output_dir / links[1])) as output:
+            assert [page.get_text().strip() for page in output] == ["ACME-000102", "ACME-000103", "ACME-000104"]
+            words = output[0].get_text("words")
+            assert words[0][0] < 50 and words[0][1] < 50
+
+        manifest = json.loads((output_dir / MANIFEST_FILENAME).read_text(encoding="utf-8"))
+        assert [(f["bates_start"], f["bates_end"]) for f in manifest["files"]] == [
+            ("ACME-000100", "ACME-000101"),
+            ("ACME-000102", "ACME-000104"),
+        ]
+    print("✓ 编号跨章节连续，起止编号写入manifest")
+
+
+def test_split_with_page_numbers():
+    """测试每个章节从起始页码重新编号"""
+    print("\n测试章节页码...")
+
+    validate_page_number_format("第 {page} 页 / 共 {total} 页")
+    for template in ("{pages}", "{page:q}"):
+        try:
+            validate_page_number_format(template)
+            assert False, f"应拒绝页码格式: {template!r}"
+        except ValueError:
+            pass
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        doc = fitz.open()
+        for _ in range(5):
+            doc.new_page()
+        doc.save(str(source))
+        doc.close()
+
+        chapters = [
+            ChapterInfo(title="第1章", start_page=1, end_page=2, page_count=2),
+            ChapterInfo(title="第2章", start_page=3, end_page=5, page_count=3),
+        ]
+        output_dir = Path(tmp) / "out"
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source), chapters, str(output_dir),
+            page_numbers=PageNumberStamp(format="{page}/{total}")
+        ))
+
+        with fitz.open(str(output_dir / links[1])) as output:
+            assert [page.get_text().strip() for page in output] == ["1/3", "2/3", "3/3"]
+            words = output[0].get_text("words")
+            assert words[0][1] > output[0].rect.height / 2
+    print("✓ 每个章节从1开始编号，默认位于页面底部")
@@ -0,0 +1,160 @@
+"""
+服务状态导出导入测试，验证元数据和文件内容的往返迁移、已存在记录的跳过与覆盖以及无效状态包的拒绝
+"""
+
+import asyncio
+import io
+import json
+import zipfile
+from datetime import datetime
+
+from fastapi import HTTPException
+
+from src.core.config import settings
+from src.core.store import get_store
+from src.core.tenancy import tenant_storage_dir, use_tenant
+from src.models.schemas import SplitPresetRequest, SplitTask, TaskStatus
+from src.services.archive_service import archive_service
+from src.services.file_service import FileService
+from src.services.preset_service import preset_service
+from src.services.state_service import STATE_FILENAME, state_service
+from src.services.task_service import TASKS_BUCKET
+
+
+def _build_archive(include_files: bool) -> io.BytesIO:
+    entries, members = state_service.export_archive(include_files)
+    return io.BytesIO(b"".join(archive_service.stream_entries(entries, members)))
+
+
+def _state_archive(state: dict, extra: dict = None) -> io.BytesIO:
+    buf = io.BytesIO()
+    with zipfile.ZipFile(buf, "w") as archive:
+        archive.writestr(STATE_FILENAME, json.dumps(state))
+        for name, data in (extra or {}).items():
+            archive.writestr(name, data)
+    buf.seek(0)
+    return buf
+
+
+def test_round_trip(tmp_upload_dir, pdf_bytes):
+    """测试导出后导入到另一个租户"""
+    print("测试状态包往返迁移...")
+
+    file_service = FileService()
+
+    async def run():
+        info = await file_service.save_pdf_stream(io.BytesIO(pdf_bytes("State")), "book.pdf")
+        chapters_dir = file_service.upload_dir / info.file_id / "chapters"
+        chapters_dir.mkdir()
+        (chapters_dir / "01_a.pdf").write_bytes(b"%PDF-1.7")
+        await preset_service.create(SplitPresetRequest(name="教材"))
+
+        done = SplitTask(
+            task_id="done", file_id=info.file_id, status=TaskStatus.COMPLETED, completed_at=datetime.now()
+        )
+        running = SplitTask(task_id="running", file_id=info.file_id, status=TaskStatus.PROCESSING)
+        for task in (done, running):
+            get_store().put(TASKS_BUCKET, task.task_id, task.model_dump(mode="json"))
+
+        state = state_service.export_state()
+        assert [data["file_id"] for data in state["files"]] == [info.file_id]
+        # 未结束的任务不导出
+        assert [data["task_id"] for data in state["tasks"]] == ["done"]
+
+        archive = _build_archive(include_files=True)
+        with zipfile.ZipFile(archive) as zf:
+            names = set(zf.namelist())
+        assert f"files/{info.file_id}/original.pdf" in names
+        assert f"files/{info.file_id}/chapters/01_a.pdf" in names
+        archive.seek(0)
+
+        with use_tenant("acme"):
+            result, tasks = state_service.import_archive(archive)
+            assert (result.files, result.presets, result.tasks, result.file_contents) == (1, 1, 1, 2)
+            assert [task.task_id for task in tasks] == ["done"] and tasks[0].tenant_id == "acme"
+
+            imported = await file_service.get_file_info(info.file_id)
+            assert imported.file_path == str(tenant_storage_dir() / info.file_id / "original.pdf")
+            assert (tenant_storage_dir() / info.file_id / "chapters" / "01_a.pdf").exists()
+            assert [preset.name for preset in await preset_service.list()] == ["教材"]
+
+    asyncio.run(run())
+    print("✓ 文件记录、预设、已结束的任务和文件内容导入到目标租户")
+
+
+def test_skip_and_overwrite(tmp_upload_dir):
+    """测试已存在记录默认跳过，指定覆盖时替换"""
+    print("\n测试跳过与覆盖...")
+
+    preset = asyncio.run(preset_service.create(SplitPresetRequest(name="教材")))
+    archive = _build_archive(include_files=False)
+
+    asyncio.run(preset_service.update(preset.preset_id, SplitPresetRequest(name="已修改")))
+    result, _ = state_service.import_archive(archive)
+    assert result.presets == 0 and result.skipped == 1
+    assert asyncio.run(preset_service.get(preset.preset_id)).name == "已修改"
+
+    archive.seek(0)
+    result, _ = state_service.import_archive(archive, overwrite=True)
+    assert result.presets == 1
+    assert asyncio.run(preset_service.get(preset.preset_id)).name == "教材"
+    print("✓ 默认不覆盖已存在的同ID记录")
+
+
+def test_invalid_archive(tmp_upload_dir):
+    """测试拒绝无效的状态包和非法路径"""
+    print("\n测试无效状态包...")
+
+    for archive in (
+        io.BytesIO(b"not a zip"),
+        _state_archive({"format_version": 99}),
+        _state_archive({"format_version": 1, "files": [{"file_id": "../escape"}]}),
+    ):
+        try:
+            state_service.import_archive(archive)
+            assert False, "应拒绝无效的状态包"
+        except ValueError:
+            pass
+
+    # 与批量上传共用压缩包校验，含目录穿越条目的状态包整体拒绝
+    record = {
+        "file_id": "f1", "filename": "a.pdf", "file_size": 1,
+        "file_path": "/elsewhere/original.pdf", "upload_time": datetime.now().isoformat()
+    }
+    try:
+        state_service.import_archive(_state_archive(
+            {"format_version": 1, "files": [record]}, {"files/f1/../../escape.pdf": b"x"}
+        ))
+        assert False, "应拒绝含目录穿越条目的状态包"
+    except HTTPException as e:
+        assert e.status_code == 400
+    assert not (tenant_storage_dir().parent / "escape.pdf").exists()
+
+    # 无法识别的路径被忽略
+    archive = _state_archive(
+        {"format_version": 1, "files": [record]},
+        {"files/f1/extra/a.pdf": b"x", "files/f1/chapters/01.pdf": b"%PDF"}
+    )
+    result, _ = state_service.import_archive(archive)
+    assert result.files == 1 and result.file_contents == 1
+    print("✓ 版本不符、记录无效、ID非法和含目录穿越条目的状态包被拒绝")
+
+
+def test_overwrite_other_tenant_task(tmp_upload_dir):
+    """测试覆盖导入不替换其他租户的同ID任务"""
+    print("\n测试跨租户任务覆盖...")
+
+    theirs = SplitTask(
+        task_id="shared-id", file_id="f1", status=TaskStatus.COMPLETED,
+        completed_at=datetime.now(), tenant_id="acme"
+    )
+    get_store().put(TASKS_BUCKET, theirs.task_id, theirs.model_dump(mode="json"))
+
+    mine = theirs.model_copy(update={"file_id": "f2", "tenant_id": settings.DEFAULT_TENANT})
+    state = {"format_version": 1, "tasks": [mine.model_dump(mode="json")]}
+    result, tasks = state_service.import_archive(_state_archive(state), overwrite=True)
+    assert result.tasks == 0 and result.skipped == 1 and tasks == []
+
+    stored = get_store().get(TASKS_BUCKET, theirs.task_id)
+    assert stored["tenant_id"] == "acme" and stored["file_id"] == "f1"
+    print("✓ 同ID任务属于其他租户时即使指定覆盖也跳过")
@@ -0,0 +1,126 @@
+"""
+存储配额测试，验证上传、批量导入和状态包导入在超出租户配额时被拒绝，而不是写入后才预警，
+以及Key配额不超过租户配额、按该Key上传的文件统计用量
+"""
+
+import asyncio
+import io
+import json
+import zipfile
+
+from fastapi import UploadFile
+
+from src.api import routes
+from src.core.auth import Principal, effective_quota_bytes, use_principal
+from src.core.config import settings
+from src.core.errors import QuotaExceededError
+from src.models.schemas import Role
+from src.services.state_service import state_service
+
+
+def _zip(entries: dict) -> bytes:
+    buf = io.BytesIO()
+    with zipfile.ZipFile(buf, "w") as archive:
+        for name, data in entries.items():
+            archive.writestr(name, data)
+    return buf.getvalue()
+
+
+def test_enforce_quota():
+    """测试写入前按用量和写入大小检查配额"""
+    print("测试配额检查...")
+
+    async def usage():
+        return 900
+
+    original_quota, original_usage = settings.STORAGE_QUOTA_BYTES, routes.file_service.get_storage_usage
+    routes.file_service.get_storage_usage = usage
+    try:
+        settings.STORAGE_QUOTA_BYTES = 0
+        assert asyncio.run(routes._enforce_storage_quota(10 ** 9)) is None
+
+        settings.STORAGE_QUOTA_BYTES = 1000
+        assert asyncio.run(routes._enforce_storage_quota(100)) == 100
+        for incoming in (101, 10 ** 6):
+            try:
+                asyncio.run(routes._enforce_storage_quota(incoming))
+                assert False, "超出配额的写入应被拒绝"
+            except QuotaExceededError as e:
+                assert e.status_code == 507 and "存储配额不足" in e.message
+
+        # 配额已用尽时大小未知的写入同样拒绝
+        settings.STORAGE_QUOTA_BYTES = 900
+        try:
+            asyncio.run(routes._enforce_storage_quota())
+            assert False, "配额已用尽时应拒绝"
+        except QuotaExceededError:
+            pass
+    finally:
+        settings.STORAGE_QUOTA_BYTES, routes.file_service.get_storage_usage = original_quota, original_usage
+    print("✓ 用量加写入大小超过配额或配额已用尽时返回507")
+
+
+def test_key_quota():
+    """测试Key级配额"""
+    print("\n测试Key级配额...")
+
+    principal = Principal(user="k-1", role=Role.EDITOR, tenant_id=settings.DEFAULT_TENANT, key_id="k-1", quota_bytes=500)
+    calls = []
+
+    async def usage(api_key_id=None):
+        calls.append(api_key_id)
+        return 450 if api_key_id else 100
+
+    original_quota, original_usage = settings.STORAGE_QUOTA_BYTES, routes.file_service.get_storage_usage
+    routes.file_service.get_storage_usage = usage
+    try:
+        # Key配额不能超过租户配额
+        settings.STORAGE_QUOTA_BYTES = 300
+        assert effective_quota_bytes(principal) == 300
+        settings.STORAGE_QUOTA_BYTES = 0
+        assert effective_quota_bytes(principal) == 500
+        assert effective_quota_bytes(principal.model_copy(update={"quota_bytes": 0})) == 0
+
+        settings.STORAGE_QUOTA_BYTES = 1000
+        assert effective_quota_bytes(principal) == 500
+        with use_principal(principal):
+            assert asyncio.run(routes._enforce_storage_quota(50)) == 50
+            try:
+                asyncio.run(routes._enforce_storage_quota(51))
+                assert False, "超出Key配额的写入应被拒绝"
+            except QuotaExceededError as e:
+                assert "API Key已使用 450/500" in e.message
+        assert "k-1" in calls, "Key配额按该Key上传的文件统计"
+    finally:
+        settings.STORAGE_QUOTA_BYTES, routes.file_service.get_storage_usage = original_quota, original_usage
+    print("✓ Key配额取Key和租户配额中较小的一个，按该Key上传的文件统计用量")
+
+
+def test_archive_quota():
+    """测试批量上传按解压后的总大小检查剩余配额"""
+    print("\n测试批量上传配额...")
+
+    data = _zip({"a.pdf": b"%PDF-1.4\n" + b"0" * 5000})
+    upload = UploadFile(file=io.BytesIO(data), filename="books.zip")
+    try:
+        asyncio.run(routes.file_service.save_uploaded_archive(upload, max_total_bytes=1000))
+        assert False, "解压后超出剩余配额的压缩包应被拒绝"
+    except QuotaExceededError as e:
+        assert "剩余存储配额" in e.message
+    print("✓ 压缩包解压后超出剩余配额时整体拒绝，不保存任何条目")
+
+
+def test_state_import_quota():
+    """测试状态包中的文件超出剩余配额时拒绝导入"""
+    print("\n测试状态包导入配额...")
+
+    data = _zip({
+        "state.json": json.dumps({"format_version": 1}),
+        "files/f1/original.pdf": b"%PDF-1.4\n" + b"0" * 5000,
+    })
+    try:
+        state_service.import_archive(io.BytesIO(data), max_file_bytes=1000)
+        assert False, "超出剩余配额的状态包应被拒绝"
+    except QuotaExceededError as e:
+        assert "状态包中的文件" in e.message
+    print("✓ 状态包中的原文件和章节输出超出剩余配额时拒绝导入")
@@ -0,0 +1,149 @@
+"""
+流式上传测试，验证multipart请求体边接收边写入最终位置、哈希同时计算、字段顺序不影响结果，
+以及格式错误或不完整的请求不留下文件
+"""
+
+import asyncio
+import hashlib
+from pathlib import Path
+
+from fastapi import HTTPException
+from starlette.requests import Request
+
+from src.api.routes import _form_bool
+from src.core.form_stream import parse_multipart
+from src.core.tenancy import EPHEMERAL_DIRNAME, is_ephemeral_file
+from src.services.file_service import FileService
+
+BOUNDARY = "----testboundary"
+
+
+def _body(parts) -> bytes:
+    """parts: (字段名, 值, 文件名或None)"""
+    body = b""
+    for name, value, filename in parts:
+        disposition = f'form-data; name="{name}"' + (f'; filename="{filename}"' if filename else "")
+        body += f"--{BOUNDARY}\r\nContent-Disposition: {disposition}\r\n".encode()
+        if filename:
+            body += b"Content-Type: application/pdf\r\n"
+        body += b"\r\n" + value + b"\r\n"
+    return body + f"--{BOUNDARY}--\r\n".encode()
+
+
+def _request(body: bytes, chunk_size: int = 7) -> Request:
+    """按小块发送请求体，文件头和分隔符会被拆在多个块中"""
+    chunks = [body[i:i + chunk_size] for i in range(0, len(body), chunk_size)]
+
+    async def receive():
+        chunk = chunks.pop(0) if chunks else b""
+        return {"type": "http.request", "body": chunk, "more_body": bool(chunks)}
+
+    scope = {
+        "type": "http",
+        "method": "POST",
+        "path": "/api/upload",
+        "headers": [(b"content-type", f"multipart/form-data; boundary={BOUNDARY}".encode())],
+    }
+    return Request(scope, receive)
+
+
+async def _upload(file_service: FileService, body: bytes, request: Request = None):
+    """与上传接口相同的流程"""
+    upload = None
+
+    def open_file(name, filename, fields):
+        nonlocal upload
+        upload = file_service.begin_upload(filename, _form_bool(fields.get("ephemeral"), "ephemeral"))
+        return upload.writer
+
+    try:
+        fields = await parse_multipart(request or _request(body), open_file)
+        pending, upload = upload, None
+        return await file_service.finish_upload(pending, fields.get("sha256"), _form_bool(fields.get("ephemeral"), "ephemeral"))
+    finally:
+        file_service.abort_upload(upload)
+
+
+def test_streamed_upload(pdf_bytes, tmp_upload_dir, tmp_temp_dir):
+    """测试流式写入和字段顺序"""
+    print("测试流式上传...")
+
+    data = pdf_bytes("Streaming")
+    checksum = hashlib.sha256(data).hexdigest()
+    file_service = FileService()
+
+    async def run():
+        info = await _upload(file_service, _body([("sha256", checksum.encode(), None), ("file", data, "书.pdf")]))
+        assert info.filename == "书.pdf" and info.file_hash == checksum
+        assert Path(info.file_path).read_bytes() == data
+
+        # 隐私模式字段在文件之后，文件被移动到临时目录
+        private = await _upload(file_service, _body([("file", data, "book.pdf"), ("ephemeral", b"true", None)]))
+        assert is_ephemeral_file(private.file_id)
+        assert Path(private.file_path).is_relative_to(tmp_temp_dir / EPHEMERAL_DIRNAME)
+        assert len([p for p in tmp_upload_dir.rglob("original.pdf")]) == 1
+
+    asyncio.run(run())
+    print("✓ 文件直接写入最终位置，哈希与内容一致，之后出现的隐私模式字段同样生效")
+
+
+def test_rejected_uploads(pdf_bytes, tmp_upload_dir):
+    """测试无效请求不留下文件"""
+    print("\n测试无效上传...")
+
+    data = pdf_bytes("Streaming")
+    file_service = FileService()
+    cases = [
+        (_body([("file", b"not a pdf", "book.pdf")]), "文件格式无效"),
+        (_body([("file", data, "book.pdf")])[:-20], "请求体不完整"),
+        (_body([("file", data, "a.pdf"), ("file", data, "b.pdf")]), "只能上传一个文件"),
+        (_body([("file", data, "book.pdf"), ("sha256", b"0" * 64, None)]), "校验和不一致"),
+        (_body([("file", data, "book.txt")]), "仅支持PDF"),
+        (_body([(f"f{i}", b"1", None) for i in range(40)] + [("file", data, "book.pdf")]), "字段数量超过"),
+        (_body([("file", data, "book.pdf")]).replace(
+            b"Content-Type: application/pdf", b"X-Padding: " + b"a" * 20000
+        ), "头部超过"),
+    ]
+    for body, message in cases:
+        try:
+            asyncio.run(_upload(file_service, body))
+            assert False, f"应拒绝: {message}"
+        except HTTPException as e:
+            assert e.status_code == 400 and message in e.detail, e.detail
+        assert not list(tmp_upload_dir.rglob("original.pdf*")), message
+
+    for value, expected in [(None, False), ("true", True), ("0", False), ("on", True)]:
+        assert _form_bool(value, "ephemeral") is expected
+    try:
+        _form_bool("maybe", "ephemeral")
+        assert False, "应拒绝无效的布尔值"
+    except HTTPException as e:
+        assert e.status_code == 400
+    print("✓ 格式错误、不完整、多个文件、字段或头部过多、校验和不一致时返回400且不留下文件")
+
+
+def test_cancelled_upload(pdf_bytes, tmp_upload_dir):
+    """测试客户端断开导致请求被取消时删除已写入的数据"""
+    print("\n测试取消上传...")
+
+    body = _body([("file", pdf_bytes("Streaming"), "book.pdf")])
+    chunks = [body[:len(body) // 2]]
+
+    async def receive():
+        if chunks:
+            return {"type": "http.request", "body": chunks.pop(0), "more_body": True}
+        raise asyncio.CancelledError()
+
+    scope = {
+        "type": "http",
+        "method": "POST",
+        "path": "/api/upload",
+        "headers": [(b"content-type", f"multipart/form-data; boundary={BOUNDARY}".encode())],
+    }
+    try:
+        asyncio.run(_upload(FileService(), body, Request(scope, receive)))
+        assert False, "应被取消"
+    except asyncio.CancelledError:
+        pass
+    assert not list(tmp_upload_dir.rglob("original.pdf*"))
+    print("✓ 上传中途取消时不留下部分写入的文件")
@@ -0,0 +1,105 @@
+"""
+任务事件时间线测试，验证状态切换和章节完成记录为事件、按时间排序返回、其他副本从存储读取，以及只对可见的调用方返回
+"""
+
+import asyncio
+from datetime import datetime, timedelta
+
+from src.core.auth import Principal, use_principal
+from src.core.config import settings
+from src.models.schemas import Role, SplitTask, TaskEvent, TaskStatus
+from src.services.task_service import TaskService
+
+
+def _replica() -> TaskService:
+    """不启动工作线程和调度器的服务实例"""
+    service = TaskService()
+    service._initialized = True
+    return service
+
+
+def test_event_timeline(tmp_upload_dir):
+    """测试状态切换和章节完成按时间顺序记录"""
+    print("测试任务事件时间线...")
+
+    a, b = _replica(), _replica()
+
+    async def run():
+        task = SplitTask(task_id="t1", file_id="f", chapters=[], status=TaskStatus.PENDING)
+        a.tasks[task.task_id] = task
+        await a._save_task(task)
+
+        assert await a._transition(task, TaskStatus.QUEUED, "queued")
+        assert await a._transition(task, TaskStatus.PROCESSING, "started", changes={"progress": 0})
+        a._record_event("t1", "chapter_done", "第1章完成", progress=50, chapter_index=0)
+        assert await a._transition(task, TaskStatus.COMPLETED, "completed", changes={"progress": 100})
+        await asyncio.sleep(0)
+
+        events = await a.get_task_events("t1")
+        assert [event.event for event in events] == ["queued", "started", "chapter_done", "completed"]
+        assert events[2].progress == 50 and events[2].details == {"chapter_index": 0}
+        assert all(x.timestamp <= y.timestamp for x, y in zip(events, events[1:]))
+
+        # 其他副本从存储读取同一条时间线
+        assert [event.event for event in await b.get_task_events("t1")] == [event.event for event in events]
+        assert await b.get_task_events("missing") is None
+
+    asyncio.run(run())
+    print("✓ 每次状态切换和章节完成都记录为事件，其他副本读取到相同的时间线")
+
+
+def test_events_sorted_and_preserved(tmp_upload_dir):
+    """测试乱序事件按时间返回，新副本追加事件时保留已有事件"""
+    print("\n测试事件排序和保留...")
+
+    a, b = _replica(), _replica()
+
+    async def run():
+        now = datetime.now()
+        task = SplitTask(task_id="t2", file_id="f", chapters=[], status=TaskStatus.QUEUED)
+        a.tasks[task.task_id] = task
+        await a._save_task(task)
+        a.task_events["t2"] = [
+            TaskEvent(event="queued", timestamp=now - timedelta(seconds=5)),
+            TaskEvent(event="created", timestamp=now - timedelta(seconds=10)),
+        ]
+        await a._save_task_events("t2")
+        assert [event.event for event in await a.get_task_events("t2")] == ["created", "queued"]
+
+        # 副本B接手处理，追加的事件不覆盖副本A写入的事件
+        stored = await b._read_task("t2")
+        b.tasks["t2"] = stored
+        assert await b._transition(stored, TaskStatus.PROCESSING, "started")
+        await asyncio.sleep(0)
+        assert [event.event for event in await _replica().get_task_events("t2")] == ["created", "queued", "started"]
+
+    asyncio.run(run())
+    print("✓ 事件按发生时间返回，跨副本追加的事件不会丢失")
+
+
+def test_events_visibility(tmp_upload_dir):
+    """测试其他用户的任务事件不可见"""
+    print("\n测试事件可见性...")
+
+    service = _replica()
+    tenant_id = settings.DEFAULT_TENANT
+    alice = Principal(user="alice", role=Role.EDITOR, tenant_id=tenant_id)
+    bob = Principal(user="bob", role=Role.EDITOR, tenant_id=tenant_id)
+    admin = Principal(user="root", role=Role.ADMIN, tenant_id=tenant_id)
+
+    async def run():
+        task = SplitTask(task_id="t3", file_id="f", chapters=[], status=TaskStatus.PENDING, owner="alice")
+        service.tasks[task.task_id] = task
+        await service._save_task(task)
+        assert await service._transition(task, TaskStatus.QUEUED, "queued")
+        await asyncio.sleep(0)
+
+        with use_principal(alice):
+            assert len(await service.get_task_events("t3")) == 1
+        with use_principal(bob):
+            assert await service.get_task_events("t3") is None
+        with use_principal(admin):
+            assert len(await service.get_task_events("t3")) == 1
+
+    asyncio.run(run())
+    print("✓ 只有任务创建者和管理员可以查看事件")
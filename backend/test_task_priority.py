@@ -0,0 +1,73 @@
+"""
+任务优先级测试，验证队列按 high → normal → low 出队、同一优先级先进先出、停止信号排在所有任务之后，以及活跃任务列表的排序
+"""
+
+import asyncio
+from uuid import uuid4
+
+from src.models.schemas import ChapterInfo, TaskPriority, TaskStatus
+from src.services.task_service import TaskService
+
+
+CHAPTERS = [ChapterInfo(title="第一章", start_page=1, end_page=2, page_count=2)]
+
+
+def _replica() -> TaskService:
+    """不启动工作线程和调度器的服务实例"""
+    service = TaskService()
+    service._initialized = True
+    return service
+
+
+def test_queue_order(tmp_upload_dir):
+    """测试队列按优先级出队，同一优先级按入队顺序"""
+    print("测试优先级出队顺序...")
+
+    service = _replica()
+
+    async def run():
+        created = {}
+        for name, priority in [
+            ("low", TaskPriority.LOW), ("normal-1", TaskPriority.NORMAL),
+            ("high", TaskPriority.HIGH), ("normal-2", TaskPriority.NORMAL),
+        ]:
+            task = await service.create_split_task(str(uuid4()), CHAPTERS, priority=priority)
+            assert task.status == TaskStatus.QUEUED
+            created[task.task_id] = name
+
+        order = []
+        while not service._task_queue.empty():
+            order.append(created[(await service._task_queue.get())[2]])
+        assert order == ["high", "normal-1", "normal-2", "low"]
+
+        active = [created[task.task_id] for task in await service.get_active_tasks()]
+        assert active == ["high", "normal-1", "normal-2", "low"]
+
+    asyncio.run(run())
+    print("✓ 高优先级任务先出队，同一优先级先进先出，活跃任务列表顺序一致")
+
+
+def test_worker_processes_by_priority(tmp_upload_dir):
+    """测试工作线程按优先级处理排队任务，停止信号在队列中的任务之后"""
+    print("\n测试工作线程处理顺序...")
+
+    service = _replica()
+    processed = []
+
+    async def process(task):
+        processed.append(task.priority)
+
+    service._process_split_task = process
+
+    async def run():
+        for priority in [TaskPriority.LOW, TaskPriority.NORMAL, TaskPriority.HIGH]:
+            await service.create_split_task(str(uuid4()), CHAPTERS, priority=priority)
+
+        # 启动工作线程后立即发送停止信号，停止信号排在已入队的任务之后
+        service._worker_tasks.append(asyncio.create_task(service._worker("worker-0")))
+        await service.stop_workers()
+
+    asyncio.run(run())
+
+    assert processed == [TaskPriority.HIGH, TaskPriority.NORMAL, TaskPriority.LOW]
+    print("✓ 工作线程按优先级处理任务，停止前处理完已排队的任务")
@@ -0,0 +1,97 @@
+"""
+多副本任务测试，验证任务状态、进度和列表从共享存储读取，任一副本都能取消任务，以及已停止副本队列中的任务被重新入队
+"""
+
+import asyncio
+
+from src.core.leader import leader_election
+from src.core.store import get_store
+from src.models.schemas import SplitTask, TaskStatus
+from src.services.task_service import TASKS_BUCKET, TaskService
+
+
+def _replica() -> TaskService:
+    """不启动工作线程和调度器的服务实例，模拟另一个副本"""
+    service = TaskService()
+    service._initialized = True
+    return service
+
+
+def _stored(task_id: str) -> dict:
+    return get_store().get(TASKS_BUCKET, task_id)
+
+
+def test_read_through_store(tmp_upload_dir):
+    """测试其他副本创建和处理的任务可查询、可取消"""
+    print("测试跨副本读取任务...")
+
+    a, b = _replica(), _replica()
+
+    async def run():
+        task = SplitTask(task_id="t1", file_id="f", chapters=[], status=TaskStatus.PROCESSING)
+        a.tasks[task.task_id] = task
+        await a._save_task(task)
+        assert "t1" not in b.tasks
+
+        assert (await b.get_task_status("t1")).status == TaskStatus.PROCESSING
+        await a._save_progress("t1", 40)
+        assert (await b.get_task_status("t1")).progress == 40
+        assert [item.task_id for item in await b.list_tasks()] == ["t1"]
+        assert await b.get_task_status("missing") is None
+
+        # 在副本B取消，副本A下次更新进度时停止本地处理
+        a._processing_tasks["t1"] = processing = asyncio.create_task(asyncio.sleep(60))
+        assert await b.cancel_task("t1")
+        assert _stored("t1")["status"] == TaskStatus.CANCELLED.value
+        assert (await a.get_task_status("t1")).status == TaskStatus.CANCELLED
+
+        await a._save_progress("t1", 50)
+        await asyncio.sleep(0)
+        assert processing.cancelled() and task.status == TaskStatus.CANCELLED
+        assert _stored("t1")["progress"] == 40, "已取消的任务不再更新进度"
+
+    asyncio.run(run())
+    print("✓ 任务状态、进度和列表以存储为准，在任一副本取消后处理所在的副本随之停止")
+
+
+def test_recover_orphaned_queue(tmp_upload_dir, monkeypatch):
+    """测试已停止副本队列中的任务转到本副本"""
+    print("\n测试恢复遗留的排队任务...")
+
+    async def is_node_alive(node_id: str) -> bool:
+        return node_id in (leader_election.node_id, "running-node")
+
+    monkeypatch.setattr(leader_election, "is_node_alive", is_node_alive)
+
+    service = _replica()
+    tasks = [
+        SplitTask(task_id="dead-queued", file_id="f", status=TaskStatus.QUEUED, worker_node="stopped-node"),
+        SplitTask(task_id="dead-pending", file_id="f", status=TaskStatus.PENDING, worker_node="stopped-node"),
+        SplitTask(task_id="alive-queued", file_id="f", status=TaskStatus.QUEUED, worker_node="running-node"),
+        SplitTask(task_id="unassigned", file_id="f", status=TaskStatus.PENDING),
+    ]
+
+    def drain() -> set:
+        ids = set()
+        while not service._task_queue.empty():
+            ids.add(service._task_queue.get_nowait()[2])
+        return ids
+
+    async def run():
+        for task in tasks:
+            await get_store().aput(TASKS_BUCKET, task.task_id, task.model_dump(mode="json"))
+
+        await service._recover_interrupted_tasks()
+        assert drain() == {"dead-queued", "dead-pending"}
+        for task_id in ("dead-queued", "dead-pending"):
+            stored = _stored(task_id)
+            assert stored["status"] == TaskStatus.QUEUED.value and stored["worker_node"] == leader_election.node_id
+        assert _stored("alive-queued")["worker_node"] == "running-node"
+        assert _stored("unassigned")["status"] == TaskStatus.PENDING.value, "未记录副本的任务只在启动时恢复"
+
+        # 已转到本副本的任务不会重复入队
+        await service._recover_interrupted_tasks()
+        assert drain() == set()
+
+    asyncio.run(run())
+    print("✓ 所在副本已停止的待入队和已入队任务转到本副本的队列，仍在运行的副本上的任务不受影响")
@@ -0,0 +1,98 @@
+"""
+任务报告测试，验证报告汇总输入、选项、章节校验和、失败章节、警告和耗时，以及HTML和PDF渲染和快照保存
+"""
+
+import asyncio
+from datetime import datetime, timedelta
+
+import fitz
+
+from src.models.schemas import (
+    FileInfo, ManifestEntry, OutputManifest, ResponseWarning, SplitTask, TaskEvent, TaskStatus, WarningCode
+)
+from src.services.task_report import TaskReportService
+
+
+START = datetime(2026, 1, 5, 9, 0, 0)
+
+
+def _entry(index: int) -> ManifestEntry:
+    return ManifestEntry(
+        filename=f"{index:02d}_chapter.pdf", title=f"第{index}章 <附录>", start_page=index, end_page=index,
+        pages=1, size=100, sha256=f"{index}" * 64
+    )
+
+
+def _report():
+    task = SplitTask(
+        task_id="t1",
+        file_id="f1",
+        chapters=[],
+        status=TaskStatus.COMPLETED,
+        created_at=START,
+        completed_at=START + timedelta(seconds=10),
+        download_links=["01_chapter.pdf", "02_chapter.pdf"],
+        owner="alice",
+        warnings=[ResponseWarning(code=list(WarningCode)[0], message="页面无法读取")]
+    )
+    events = [
+        TaskEvent(event="queued", timestamp=START),
+        TaskEvent(event="started", timestamp=START + timedelta(seconds=2)),
+        TaskEvent(event="chapter_done", timestamp=START + timedelta(seconds=5), details={"filename": "01_chapter.pdf"}),
+        TaskEvent(event="chapter_failed", message="第 2 章拆分失败: 第2章", timestamp=START + timedelta(seconds=6), details={"error": "文件过大"}),
+        TaskEvent(event="chapter_done", timestamp=START + timedelta(seconds=9), details={"filename": "02_chapter.pdf"}),
+    ]
+    # 清单中不属于本次任务的文件不进入报告
+    manifest = OutputManifest(files=[_entry(1), _entry(2), _entry(3)])
+    file_info = FileInfo(
+        file_id="f1", filename="book.pdf", file_size=1, file_path="/tmp/book.pdf", upload_time=START, file_hash="a" * 64
+    )
+    return TaskReportService().build(task, events, manifest, {"chapters": [], "optimize": True}, file_info)
+
+
+def test_build():
+    """测试报告内容和耗时"""
+    print("测试生成报告...")
+
+    report = _report()
+    assert report.filename == "book.pdf" and report.file_hash == "a" * 64
+    assert report.queued_seconds == 2 and report.processing_seconds == 8
+    assert report.options == {"optimize": True}
+    assert [entry.filename for entry in report.files] == ["01_chapter.pdf", "02_chapter.pdf"]
+    assert report.chapter_seconds == {"01_chapter.pdf": 3, "02_chapter.pdf": 3}
+    assert report.failed_chapters == ["第 2 章拆分失败: 第2章（文件过大）"]
+    assert len(report.warnings) == 1
+    print("✓ 耗时按事件时间计算，只包含本次生成的文件")
+
+
+def test_render():
+    """测试HTML和PDF渲染"""
+    print("\n测试渲染报告...")
+
+    service = TaskReportService()
+    report = _report()
+
+    page = service.render_html(report)
+    assert "1" * 64 in page and "book.pdf" in page and "页面无法读取" in page
+    assert "&lt;附录&gt;" in page and "<附录>" not in page
+
+    with fitz.open(stream=service.render_pdf(report), filetype="pdf") as doc:
+        text = "".join(page.get_text() for page in doc)
+    assert "拆分任务报告" in text and "book.pdf" in text and "文件过大" in text
+    print("✓ HTML转义标题，PDF包含相同内容")
+
+
+def test_snapshot(tmp_upload_dir):
+    """测试报告快照的保存和删除"""
+    print("\n测试报告快照...")
+
+    service = TaskReportService()
+    async def run():
+        await service.save(_report())
+        loaded = await service.get("t1")
+        assert loaded and loaded.files[1].sha256 == "2" * 64
+        await service.delete("t1")
+        assert await service.get("t1") is None
+
+    asyncio.run(run())
+    print("✓ 快照可读取，随任务记录删除")
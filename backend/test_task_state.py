@@ -0,0 +1,121 @@
+"""
+任务状态机测试，验证允许的状态切换、取消后处理结果被丢弃、结束后不再更新进度，以及以存储中的状态为准
+"""
+
+import asyncio
+from datetime import datetime
+
+from src.core.store import get_store
+from src.models.schemas import SplitTask, TaskStatus
+from src.services.task_service import TASKS_BUCKET, TaskService
+from src.services.task_state import FINISHED_STATUSES, TASK_TRANSITIONS, can_transition
+
+
+def test_transitions():
+    """测试状态切换表"""
+    print("测试状态切换表...")
+
+    assert set(TASK_TRANSITIONS) == set(TaskStatus)
+    assert FINISHED_STATUSES == {TaskStatus.COMPLETED, TaskStatus.FAILED, TaskStatus.CANCELLED}
+    assert can_transition(TaskStatus.SCHEDULED, TaskStatus.PENDING)
+    assert can_transition(TaskStatus.PENDING, TaskStatus.QUEUED)
+    assert can_transition(TaskStatus.QUEUED, TaskStatus.PROCESSING)
+    assert can_transition(TaskStatus.QUEUED, TaskStatus.CANCELLED)
+    assert can_transition(TaskStatus.PROCESSING, TaskStatus.CANCELLED)
+    assert not can_transition(TaskStatus.SCHEDULED, TaskStatus.QUEUED)
+    assert not can_transition(TaskStatus.SCHEDULED, TaskStatus.PROCESSING)
+    assert not can_transition(TaskStatus.QUEUED, TaskStatus.PENDING)
+    assert not can_transition(TaskStatus.PENDING, TaskStatus.COMPLETED)
+    for status in FINISHED_STATUSES:
+        assert not any(can_transition(status, target) for target in TaskStatus)
+    print("✓ 只能按 scheduled → pending → queued → processing → 结束状态 切换，结束状态不能再改变")
+
+
+def _task(service: TaskService, task_id: str, status: TaskStatus) -> SplitTask:
+    task = SplitTask(task_id=task_id, file_id="f", chapters=[], status=status)
+    service.tasks[task_id] = task
+    get_store().put(TASKS_BUCKET, task_id, task.model_dump(mode="json"))
+    return task
+
+
+def _stored(task_id: str) -> dict:
+    return get_store().get(TASKS_BUCKET, task_id)
+
+
+def test_cancel_during_processing(tmp_upload_dir):
+    """测试处理中被取消"""
+    print("\n测试处理中取消...")
+
+    service = TaskService()
+
+    async def run():
+        task = _task(service, "t1", TaskStatus.PENDING)
+        assert await service._transition(task, TaskStatus.PROCESSING, "started", changes={"progress": 0})
+        service._update_task_progress("t1", 40)
+        await asyncio.sleep(0)
+        assert _stored("t1")["progress"] == 40
+
+        assert await service._transition(
+            task, TaskStatus.CANCELLED, "cancelled", changes={"completed_at": datetime.now()}
+        )
+        # 工作线程随后完成，结果被丢弃
+        assert not await service._transition(task, TaskStatus.COMPLETED, "completed", changes={"progress": 100})
+        assert not await service._transition(task, TaskStatus.FAILED, "failed")
+        service._update_task_progress("t1", 80)
+        await asyncio.sleep(0)
+
+        assert task.status == TaskStatus.CANCELLED and task.progress == 40
+        assert _stored("t1")["status"] == "cancelled" and _stored("t1")["progress"] == 40
+        assert [event.event for event in service.task_events["t1"]] == ["started", "cancelled"]
+
+    asyncio.run(run())
+    print("✓ 取消后完成、失败和进度更新都被拒绝，事件只记录实际发生的切换")
+
+
+def test_stored_status_wins(tmp_upload_dir):
+    """测试以存储中的状态为准"""
+    print("\n测试存储中的状态...")
+
+    service = TaskService()
+
+    async def run():
+        task = _task(service, "t2", TaskStatus.PROCESSING)
+        # 另一个实例已取消该任务，本地副本仍为处理中
+        get_store().put(TASKS_BUCKET, "t2", {**_stored("t2"), "status": "cancelled"})
+        assert not await service._transition(task, TaskStatus.COMPLETED, "completed")
+        assert task.status == TaskStatus.PROCESSING and _stored("t2")["status"] == "cancelled"
+
+        await service._save_progress("t2", 90)
+        assert _stored("t2")["progress"] == 0
+
+        scheduled = _task(service, "t3", TaskStatus.SCHEDULED)
+        assert not await service._transition(scheduled, TaskStatus.PROCESSING, "started")
+        assert await service._transition(scheduled, TaskStatus.PENDING, "due")
+
+    asyncio.run(run())
+    print("✓ 存储中已结束的任务不会被本地过期副本覆盖")
+
+
+def test_enqueue(tmp_upload_dir):
+    """测试入队时切换为queued"""
+    print("\n测试入队...")
+
+    service = TaskService()
+
+    async def run():
+        task = _task(service, "t4", TaskStatus.PENDING)
+        assert await service._enqueue(task, "任务已加入处理队列")
+        assert task.status == TaskStatus.QUEUED and _stored("t4")["status"] == "queued"
+        assert service._task_queue.qsize() == 1
+
+        # 重启后恢复的queued任务直接重新入队
+        assert await service._enqueue(task)
+        assert service._task_queue.qsize() == 2
+        assert [event.event for event in service.task_events["t4"]] == ["queued"]
+
+        cancelled = _task(service, "t5", TaskStatus.CANCELLED)
+        assert not await service._enqueue(cancelled)
+        assert service._task_queue.qsize() == 2
+
+    asyncio.run(run())
+    print("✓ 入队时切换为queued并记录事件，已取消的任务不再入队")
@@ -0,0 +1,201 @@
+"""
+多租户测试，验证租户识别、未知租户的拒绝、按租户的配置和限流，以及文件存储和记录的隔离
+"""
+
+import asyncio
+import io
+from pathlib import Path
+
+from src.api.middleware import TenantMiddleware
+from src.core.config import settings
+from src.core.errors import NotFoundError
+from src.core.tenancy import (
+    file_storage_dir,
+    get_current_tenant,
+    get_tenant_quota_bytes,
+    get_tenant_rate_limit,
+    get_tenant_retention_hours,
+    get_tenant_settings,
+    migrate_legacy_storage,
+    tenant_storage_dir,
+    use_tenant,
+)
+from src.services.file_service import FileService
+
+
+TENANTS = {
+    "acme": {"quota_bytes": 1000, "rate_limit_per_minute": 2, "original_retention_hours": 0, "api_keys": ["k-acme"]},
+    "beta": {},
+}
+
+
+def _settings(**overrides) -> dict:
+    saved = {name: getattr(settings, name) for name in overrides}
+    for name, value in overrides.items():
+        setattr(settings, name, value)
+    return saved
+
+
+def _restore(saved: dict) -> None:
+    for name, value in saved.items():
+        setattr(settings, name, value)
+
+
+def _request(middleware, path: str = "/api/files", headers: dict = None) -> tuple:
+    """返回(状态码, 应用看到的租户)"""
+    scope = {
+        "type": "http", "method": "GET", "path": path,
+        "headers": [(k.lower().encode(), v.encode()) for k, v in (headers or {}).items()],
+    }
+    sent = []
+
+    async def receive():
+        return {"type": "http.request", "body": b"", "more_body": False}
+
+    async def send(message):
+        sent.append(message)
+
+    asyncio.run(middleware(scope, receive, send))
+    return sent[0]["status"], scope.get("state", {}).get("seen_tenant")
+
+
+async def _app(scope, receive, send):
+    scope["state"]["seen_tenant"] = get_current_tenant()
+    await send({"type": "http.response.start", "status": 200, "headers": []})
+    await send({"type": "http.response.body", "body": b""})
+
+
+def test_tenant_settings():
+    """测试租户配置覆盖全局配置"""
+    print("测试租户配置...")
+
+    saved = _settings(TENANTS=TENANTS, STORAGE_QUOTA_BYTES=5000, RATE_LIMIT_PER_MINUTE=0, ORIGINAL_RETENTION_HOURS=24)
+    try:
+        assert get_tenant_quota_bytes("acme") == 1000 and get_tenant_quota_bytes("beta") == 5000
+        assert get_tenant_rate_limit("acme") == 2 and get_tenant_rate_limit("beta") == 0
+        assert get_tenant_retention_hours("original_retention_hours", "acme") == 0
+        assert get_tenant_retention_hours("original_retention_hours", "beta") == 24
+        assert [entry.key for entry in get_tenant_settings("acme").api_keys] == ["k-acme"]
+
+        assert tenant_storage_dir(settings.DEFAULT_TENANT) == Path(settings.UPLOAD_DIR) / "tenants" / settings.DEFAULT_TENANT
+        assert tenant_storage_dir("acme") == Path(settings.UPLOAD_DIR) / "tenants" / "acme"
+        with use_tenant("beta"):
+            assert get_current_tenant() == "beta" and tenant_storage_dir() == Path(settings.UPLOAD_DIR) / "tenants" / "beta"
+        assert get_current_tenant() == settings.DEFAULT_TENANT
+    finally:
+        _restore(saved)
+    print("✓ 租户单独配置的配额、限流和保留时长优先，未配置时使用全局配置，默认租户同样有独立目录")
+
+
+def test_resolve_tenant():
+    """测试按请求头和子域名识别租户"""
+    print("\n测试租户识别...")
+
+    saved = _settings(TENANTS=TENANTS, TENANT_SUBDOMAIN_BASE="pdf.example.com", RATE_LIMIT_PER_MINUTE=0)
+    try:
+        middleware = TenantMiddleware(_app)
+        assert _request(middleware) == (200, settings.DEFAULT_TENANT)
+        assert _request(middleware, headers={"X-Tenant-ID": "Beta"}) == (200, "beta")
+        assert _request(middleware, headers={"Host": "beta.pdf.example.com:8000"}) == (200, "beta")
+        # 请求头优先于子域名，多级子域名不识别为租户
+        assert _request(middleware, headers={"X-Tenant-ID": "beta", "Host": "acme.pdf.example.com"}) == (200, "beta")
+        assert _request(middleware, headers={"Host": "a.beta.pdf.example.com"}) == (200, settings.DEFAULT_TENANT)
+
+        for tenant_id in ("unknown", "../acme", "acme/../beta", "ACME!"):
+            assert _request(middleware, headers={"X-Tenant-ID": tenant_id})[0] == 404, tenant_id
+    finally:
+        _restore(saved)
+    print("✓ 请求头优先，其次是子域名；未配置或格式非法的租户返回404，不进入应用")
+
+
+def test_rate_limit_per_tenant():
+    """测试限流按租户计数"""
+    print("\n测试租户限流...")
+
+    saved = _settings(TENANTS={"acme": {"rate_limit_per_minute": 2}, "beta": {}}, RATE_LIMIT_PER_MINUTE=0)
+    try:
+        middleware = TenantMiddleware(_app)
+        acme = {"X-Tenant-ID": "acme"}
+        assert [_request(middleware, headers=acme)[0] for _ in range(3)] == [200, 200, 429]
+        assert _request(middleware, headers={"X-Tenant-ID": "beta"})[0] == 200, "其他租户不受影响"
+        assert _request(middleware, path="/health", headers=acme)[0] == 200, "只对业务接口限流"
+    finally:
+        _restore(saved)
+    print("✓ 超出租户每分钟限额时返回429，其他租户和健康检查不受影响")
+
+
+def test_file_isolation(pdf_bytes, tmp_upload_dir, monkeypatch):
+    """测试文件记录和存储目录按租户隔离"""
+    print("\n测试文件隔离...")
+
+    monkeypatch.setattr(settings, "TENANTS", TENANTS)
+    service = FileService()
+
+    async def run():
+        with use_tenant("acme"):
+            info = await service.save_pdf_stream(io.BytesIO(pdf_bytes("Acme")), "acme.pdf")
+            assert Path(info.file_path).is_relative_to(tmp_upload_dir / "tenants" / "acme")
+            assert await service.get_file_info(info.file_id) is not None
+
+        with use_tenant("beta"):
+            assert await service.get_file_info(info.file_id) is None
+            assert await service.get_file_path(info.file_id) is None
+            assert [f.file_id for f in await service.list_files()] == []
+        assert await service.get_file_info(info.file_id) is None
+
+    asyncio.run(run())
+    print("✓ 文件保存在所属租户的目录下，其他租户无法读取记录和路径")
+
+
+def test_delete_rejects_reserved_names(pdf_bytes, tmp_upload_dir, monkeypatch):
+    """测试删除文件时拒绝非文件ID的名称和没有记录的目录"""
+    print("\n测试删除保留名称...")
+
+    monkeypatch.setattr(settings, "TENANTS", TENANTS)
+    service = FileService()
+
+    async def run():
+        with use_tenant("acme"):
+            info = await service.save_pdf_stream(io.BytesIO(pdf_bytes("Acme")), "acme.pdf")
+
+        for name in ("tenants", "api_keys", "tasks", "share_links", "store.lmdb", "..", f"../tenants/acme/{info.file_id}"):
+            assert await service.delete_file(name) is False, name
+            try:
+                file_storage_dir(name)
+                assert False, name
+            except NotFoundError:
+                pass
+
+        # 格式正确但没有元数据记录的目录不删除
+        orphan = file_storage_dir("00000000-0000-4000-8000-000000000001")
+        orphan.mkdir(parents=True)
+        assert await service.delete_file(orphan.name) is False and orphan.exists()
+
+        with use_tenant("acme"):
+            assert await service.get_file_info(info.file_id) is not None
+            assert await service.delete_file(info.file_id) is True
+            assert not file_storage_dir(info.file_id).exists()
+
+    asyncio.run(run())
+    print("✓ 只删除有元数据记录的文件目录，其他租户和存储目录不受影响")
+
+
+def test_migrate_legacy_storage(tmp_upload_dir):
+    """测试旧版本默认租户数据迁移到默认租户目录"""
+    print("\n测试迁移旧存储布局...")
+
+    base = tmp_upload_dir
+    file_id = "00000000-0000-4000-8000-000000000001"
+    (base / file_id).mkdir()
+    (base / file_id / "metadata.json").write_text("{}", encoding="utf-8")
+    (base / "presets").mkdir()
+    (base / "presets" / "p.json").write_text("{}", encoding="utf-8")
+    (base / "tasks").mkdir()
+
+    assert migrate_legacy_storage() == 2
+    target = tenant_storage_dir(settings.DEFAULT_TENANT)
+    assert (target / file_id / "metadata.json").exists() and (target / "presets" / "p.json").exists()
+    assert not (base / file_id).exists()
+    assert (base / "tasks").exists(), "全局数据留在上传目录根下"
+    assert migrate_legacy_storage() == 0
+    print("✓ 文件目录和租户级数据移到默认租户目录，全局数据不动")
@@ -0,0 +1,96 @@
+"""
+章节标题规范化测试，验证目录引导符和页码的清洗、OCR章节号修正、全大写标题转换时罗马数字的识别，以及章节列表保留原始标题
+"""
+
+import asyncio
+
+from src.models.schemas import ChapterInfo
+from src.services.llm_service import llm_service
+from src.services.title_normalizer import TitleNormalizer
+
+
+def test_cleanup():
+    """测试清洗引导符、页码和不可见字符"""
+    print("测试标题清洗...")
+
+    normalizer = TitleNormalizer()
+    cases = {
+        "绪论 ........ 15": "绪论",
+        "Introduction … 3": "Introduction",
+        "Preface  xii": "Preface",
+        "Chapter l Basics": "Chapter 1 Basics",
+        "Chapter 1O": "Chapter 10",
+        "Chapter II": "Chapter II",
+        "Con\u00adtents\u200b": "Contents",
+        "第一章：": "第一章",
+    }
+    for raw, expected in cases.items():
+        assert normalizer.normalize(raw) == expected, (raw, normalizer.normalize(raw))
+    assert normalizer.normalize("....") == "...."
+    print("✓ 去除引导符和末尾页码，修正混有字母的章节号，保留罗马数字章节号")
+
+
+def test_roman_numerals():
+    """测试全大写标题只把编号位置的罗马数字保持大写"""
+    print("\n测试罗马数字...")
+
+    normalizer = TitleNormalizer()
+    cases = {
+        "CHAPTER IV THE MIX OF MEDIA": "Chapter IV the Mix of Media",
+        "PART II: DESIGN": "Part II: Design",
+        "BOOK XII": "Book XII",
+        "MI AMIGO AND CIVIL LIVES": "Mi Amigo and Civil Lives",
+        "DID I MIX IT": "Did I Mix It",
+        "XIV": "XIV",
+    }
+    for raw, expected in cases.items():
+        assert normalizer.normalize(raw) == expected, (raw, normalizer.normalize(raw))
+    print("✓ 只有跟在Chapter/Part/Book之后或单独成为标题的单词按罗马数字处理")
+
+
+def test_compatibility_characters():
+    """测试兼容字符和全角字符统一为标准形式"""
+    print("\n测试兼容字符...")
+
+    normalizer = TitleNormalizer()
+    assert normalizer.normalize("\ufb01eld Notes") == "field Notes"
+    assert normalizer.normalize("Ｃｈａｐｔｅｒ　３") == "Chapter 3"
+    assert normalizer.normalize("  第二章   方法  ") == "第二章 方法"
+    print("✓ 连字和全角字符转换为标准字符，多余空白合并")
+
+
+def test_normalize_chapters():
+    """测试章节列表规范化保留原始标题，重复规范化以原始标题为准"""
+    print("\n测试章节标题规范化...")
+
+    normalizer = TitleNormalizer()
+    chapters = [
+        ChapterInfo(title="CHAPTER l INTRODUCTION ........ 1", start_page=1, end_page=4, page_count=4),
+        ChapterInfo(title="第二章 方法", start_page=5, end_page=9, page_count=5),
+    ]
+    normalized = asyncio.run(normalizer.normalize_chapters(chapters))
+    assert [(c.title, c.raw_title) for c in normalized] == [
+        ("Chapter 1 Introduction", "CHAPTER l INTRODUCTION ........ 1"),
+        ("第二章 方法", "第二章 方法"),
+    ]
+    again = asyncio.run(normalizer.normalize_chapters(normalized))
+    assert [c.raw_title for c in again] == [c.raw_title for c in normalized]
+    assert asyncio.run(normalizer.normalize_chapters([])) == []
+
+    # 启用大模型时在规则清洗的结果上继续规范化
+    received = []
+
+    async def normalize_titles(titles):
+        received.extend(titles)
+        return [title.upper() for title in titles]
+
+    original = llm_service.normalize_titles
+    llm_service.normalize_titles = normalize_titles
+    try:
+        polished = asyncio.run(normalizer.normalize_chapters(chapters, use_llm=True))
+    finally:
+        llm_service.normalize_titles = original
+    assert received == ["Chapter 1 Introduction", "第二章 方法"]
+    assert [c.title for c in polished] == ["CHAPTER 1 INTRODUCTION", "第二章 方法"]
+    assert polished[0].raw_title == "CHAPTER l INTRODUCTION ........ 1"
+    print("✓ 原始标题保存在raw_title中，重复规范化不会覆盖，大模型只处理规则清洗后的标题")
@@ -0,0 +1,59 @@
+"""
+上传校验和测试，验证客户端提供的SHA-256与写入的数据不一致时拒绝上传且不留下文件
+"""
+
+import asyncio
+import hashlib
+import io
+
+from fastapi import HTTPException, UploadFile
+
+from src.api.routes import _expected_checksum
+from src.services.file_service import FileService
+
+
+def test_expected_checksum():
+    """测试表单字段和请求头的合并与格式校验"""
+    print("测试校验和参数...")
+
+    checksum = "a" * 64
+    assert _expected_checksum(None, None) is None
+    assert _expected_checksum(checksum.upper(), None) == checksum
+    assert _expected_checksum(None, checksum) == checksum
+    assert _expected_checksum(checksum, checksum.upper()) == checksum
+
+    for field, header in [("b" * 64, checksum), ("not-a-hash", None)]:
+        try:
+            _expected_checksum(field, header)
+            assert False, "应拒绝无效的校验和"
+        except HTTPException as e:
+            assert e.status_code == 400
+    print("✓ 大小写不敏感，不一致或格式无效时返回400")
+
+
+def test_upload_checksum(tmp_upload_dir, pdf_bytes):
+    """测试上传时校验SHA-256"""
+    print("\n测试上传校验...")
+
+    data = pdf_bytes("Checksum")
+    file_service = FileService()
+
+    async def run():
+        try:
+            await file_service.save_uploaded_file(
+                UploadFile(file=io.BytesIO(data), filename="book.pdf"),
+                hashlib.sha256(b"other").hexdigest()
+            )
+            assert False, "应拒绝校验和不一致的上传"
+        except HTTPException as e:
+            assert e.status_code == 400
+        assert not [p for p in tmp_upload_dir.iterdir() if p.is_dir()]
+
+        info = await file_service.save_uploaded_file(
+            UploadFile(file=io.BytesIO(data), filename="book.pdf"),
+            hashlib.sha256(data).hexdigest()
+        )
+        assert info.file_hash == hashlib.sha256(data).hexdigest()
+
+    asyncio.run(run())
+    print("✓ 校验和一致时保存，不一致时拒绝且不留下文件")
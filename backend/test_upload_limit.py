@@ -0,0 +1,104 @@
+"""
+并发上传限制测试，验证按调用方和全局的上传名额计数、超限时返回429以及请求结束后释放名额
+"""
+
+import asyncio
+import json
+
+from src.api.middleware import UploadConcurrencyMiddleware
+from src.core.auth import Principal
+from src.core.config import settings
+
+
+def _scope(method: str, path: str, ip: str = "10.0.0.1", principal=None) -> dict:
+    return {
+        "type": "http",
+        "method": method,
+        "path": path,
+        "client": (ip, 12345),
+        "state": {"principal": principal} if principal else {}
+    }
+
+
+def test_upload_routes():
+    """测试只对上传数据的接口计数"""
+    print("测试上传接口识别...")
+
+    middleware = UploadConcurrencyMiddleware(app=None)
+    assert middleware._is_upload("POST", "/api/upload")
+    assert middleware._is_upload("POST", "/api/upload/batch")
+    assert middleware._is_upload("PUT", "/api/upload/sessions/abc")
+    assert not middleware._is_upload("POST", "/api/upload/sessions")
+    assert not middleware._is_upload("POST", "/api/upload/sessions/abc/finalize")
+    assert not middleware._is_upload("GET", "/api/upload/sessions/abc")
+    print("✓ 只有上传数据的接口占用名额")
+
+
+def test_client_key():
+    """测试调用方的识别"""
+    print("\n测试调用方识别...")
+
+    key = Principal(user="svc", role="editor", tenant_id="acme", key_id="k1")
+    user = Principal(user="alice", role="editor", tenant_id="acme")
+    anonymous = Principal(user="anonymous", role="admin", tenant_id="default")
+
+    client = UploadConcurrencyMiddleware._client
+    assert client(_scope("POST", "/api/upload", principal=key)) == "key:acme/k1"
+    assert client(_scope("POST", "/api/upload", principal=user)) == "user:acme/alice"
+    assert client(_scope("POST", "/api/upload", principal=anonymous)) == "ip:10.0.0.1"
+    assert client(_scope("POST", "/api/upload")) == "ip:10.0.0.1"
+    print("✓ 有凭据时按API Key或用户计数，否则按IP计数")
+
+
+def test_concurrency_limit():
+    """测试超出限制时返回429，请求结束后释放名额"""
+    print("\n测试并发上限...")
+
+    original = (settings.MAX_CONCURRENT_UPLOADS, settings.MAX_CONCURRENT_UPLOADS_PER_CLIENT)
+    settings.MAX_CONCURRENT_UPLOADS = 3
+    settings.MAX_CONCURRENT_UPLOADS_PER_CLIENT = 2
+    try:
+        async def run():
+            release = asyncio.Event()
+
+            async def app(scope, receive, send):
+                await release.wait()
+                await send({"type": "http.response.start", "status": 200, "headers": []})
+                await send({"type": "http.response.body", "body": b"{}"})
+
+            middleware = UploadConcurrencyMiddleware(app)
+
+            async def request(ip: str, method: str = "POST", path: str = "/api/upload") -> int:
+                messages = []
+
+                async def send(message):
+                    messages.append(message)
+
+                await middleware(_scope(method, path, ip), None, send)
+                start = messages[0]
+                if start["status"] == 429:
+                    assert json.loads(messages[1]["body"])["detail"]
+                    assert (b"retry-after", b"5") in start["headers"]
+                return start["status"]
+
+            pending = [asyncio.create_task(request("10.0.0.1")) for _ in range(2)]
+            await asyncio.sleep(0)
+            # 同一IP超出限制，其他IP不受影响直到达到全局上限
+            assert await request("10.0.0.1") == 429
+            pending.append(asyncio.create_task(request("10.0.0.2")))
+            await asyncio.sleep(0)
+            assert await request("10.0.0.3") == 429
+            assert middleware._total == 3
+
+            # 非上传接口不占用名额
+            release.set()
+            assert await request("10.0.0.1", "GET", "/api/files") == 200
+            assert await asyncio.gather(*pending) == [200, 200, 200]
+            assert middleware._total == 0 and not middleware._active
+
+            assert await request("10.0.0.1") == 200
+
+        asyncio.run(run())
+    finally:
+        settings.MAX_CONCURRENT_UPLOADS, settings.MAX_CONCURRENT_UPLOADS_PER_CLIENT = original
+    print("✓ 超出每个调用方或全局上限时返回429，完成后释放名额")
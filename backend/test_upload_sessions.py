@@ -0,0 +1,185 @@
+"""
+分段上传会话测试，验证校验和校验、按偏移追加、完成后原地生成正式文件以及过期会话的回收
+"""
+
+import asyncio
+import hashlib
+import os
+from pathlib import Path
+
+from fastapi import HTTPException
+
+from src.api.middleware import BodySizeLimitMiddleware
+from src.core.config import settings
+from src.models.schemas import UploadSessionStatus
+from src.services.file_service import FileService
+from src.services.upload_session_service import upload_session_service
+
+
+async def _chunks(data: bytes, size: int = 1024):
+    """模拟请求体数据流"""
+    for start in range(0, len(data), size):
+        yield data[start:start + size]
+
+
+def test_session_lifecycle(tmp_upload_dir, pdf_bytes):
+    """测试创建、上传、校验和完成"""
+    print("测试上传会话流程...")
+
+    data = pdf_bytes("Session upload")
+    checksum = hashlib.sha256(data).hexdigest()
+    file_service = FileService()
+
+    async def run():
+        try:
+            await upload_session_service.create("notes.txt")
+            assert False, "应拒绝非PDF文件"
+        except ValueError:
+            pass
+
+        session = await upload_session_service.create("book.pdf", size=len(data))
+        assert session.status == UploadSessionStatus.CREATED
+
+        # 与声明大小不一致的数据不能完成
+        session = await upload_session_service.write(session.session_id, _chunks(data[:-10]))
+        assert session.received_bytes == len(data) - 10
+        try:
+            await upload_session_service.verify(session, hashlib.sha256(data[:-10]).hexdigest())
+            assert False, "应拒绝大小不一致的数据"
+        except ValueError:
+            pass
+
+        # 超过声明大小的数据被丢弃
+        try:
+            await upload_session_service.write(session.session_id, _chunks(data + b"extra"))
+            assert False, "应拒绝超过声明大小的数据"
+        except ValueError:
+            pass
+        assert not upload_session_service.part_path(session).exists()
+
+        session = await upload_session_service.write(session.session_id, _chunks(data))
+        assert session.status == UploadSessionStatus.UPLOADED and session.sha256 == checksum
+
+        # 校验和不一致时丢弃数据，需要重新上传
+        try:
+            await upload_session_service.verify(session, "0" * 64)
+            assert False, "应拒绝不一致的校验和"
+        except ValueError:
+            pass
+        session = await upload_session_service.get(session.session_id)
+        assert session.status == UploadSessionStatus.CREATED
+
+        session = await upload_session_service.write(session.session_id, _chunks(data))
+        part_path = await upload_session_service.verify(session, checksum.upper())
+        inode = part_path.stat().st_ino
+        info = await file_service.adopt_pdf(part_path, session.filename, session.received_bytes, session.sha256)
+        await upload_session_service.complete(session, info.file_id)
+
+        session = await upload_session_service.get(session.session_id)
+        assert session.status == UploadSessionStatus.FINALIZED and session.file_id == info.file_id
+        assert not part_path.exists()
+        file_path = await file_service.get_file_path(info.file_id)
+        assert file_path.endswith("original.pdf")
+        # 临时文件原地移动为正式文件，没有复制
+        assert os.stat(file_path).st_ino == inode and info.file_hash == checksum
+        try:
+            await upload_session_service.write(session.session_id, _chunks(data))
+            assert False, "已完成的会话不能再上传"
+        except ValueError:
+            pass
+
+    asyncio.run(run())
+    print("✓ 校验和一致时才生成正式文件，不一致时数据被丢弃")
+
+
+def test_resumed_upload(tmp_upload_dir, pdf_bytes):
+    """测试按偏移分多次上传"""
+    print("\n测试分多次上传...")
+
+    data = pdf_bytes("Resumed upload")
+    half = len(data) // 2
+    file_service = FileService()
+
+    async def run():
+        session = await upload_session_service.create("book.pdf", size=len(data))
+        session = await upload_session_service.write(session.session_id, _chunks(data[:half]))
+        assert session.received_bytes == half
+
+        # 不连续的写入位置被拒绝，已接收的数据不变
+        for offset in (half - 1, half + 1):
+            try:
+                await upload_session_service.write(session.session_id, _chunks(data[half:]), offset)
+                assert False, "应拒绝不连续的写入位置"
+            except ValueError:
+                pass
+        assert upload_session_service.part_path(session).stat().st_size == half
+
+        session = await upload_session_service.write(session.session_id, _chunks(data[half:]), half)
+        assert session.received_bytes == len(data)
+        assert session.sha256 == hashlib.sha256(data).hexdigest()
+
+        part_path = await upload_session_service.verify(session, session.sha256)
+        assert part_path.read_bytes() == data
+        info = await file_service.adopt_pdf(part_path, session.filename, session.received_bytes, session.sha256)
+        with open(await file_service.get_file_path(info.file_id), "rb") as f:
+            assert f.read() == data
+
+    asyncio.run(run())
+    print("✓ 从已接收的位置继续上传，校验和覆盖全部数据")
+
+
+def test_invalid_part_rejected(tmp_upload_dir):
+    """测试原地校验拒绝非PDF数据"""
+    print("\n测试原地校验...")
+
+    data = b"not a pdf" * 100
+    file_service = FileService()
+
+    async def run():
+        session = await upload_session_service.create("fake.pdf")
+        session = await upload_session_service.write(session.session_id, _chunks(data))
+        part_path = await upload_session_service.verify(session, session.sha256)
+        try:
+            await file_service.adopt_pdf(part_path, session.filename, session.received_bytes, session.sha256)
+            assert False, "应拒绝非PDF数据"
+        except HTTPException as e:
+            assert e.status_code == 400
+        assert not part_path.exists()
+        assert not list(Path(settings.UPLOAD_DIR).rglob("original.pdf*"))
+
+    asyncio.run(run())
+    print("✓ 非PDF数据不会生成正式文件")
+
+
+def test_expired_sessions(tmp_upload_dir, monkeypatch):
+    """测试过期会话不可访问并被回收"""
+    print("\n测试过期会话回收...")
+
+    async def run():
+        monkeypatch.setattr(settings, "UPLOAD_SESSION_TTL", -1)
+        expired = await upload_session_service.create("old.pdf")
+        part_path = upload_session_service.part_path(expired)
+        part_path.parent.mkdir(parents=True, exist_ok=True)
+        part_path.write_bytes(b"%PDF-half-written")
+
+        monkeypatch.setattr(settings, "UPLOAD_SESSION_TTL", 3600)
+        active = await upload_session_service.create("new.pdf")
+
+        assert await upload_session_service.get(expired.session_id) is None
+        assert await upload_session_service.cleanup_expired() == 1
+        assert not part_path.exists()
+        assert await upload_session_service.get(active.session_id) is not None
+
+    asyncio.run(run())
+    print("✓ 过期会话及其未完成的数据被删除")
+
+
+def test_body_limit():
+    """测试会话数据上传接口使用文件大小上限"""
+    print("\n测试请求体上限...")
+
+    middleware = BodySizeLimitMiddleware(app=None)
+    assert middleware.limit_for("/api/upload/sessions/abc") > settings.MAX_FILE_SIZE
+    assert middleware.limit_for("/api/upload/sessions") == settings.MAX_JSON_BODY_SIZE
+    assert middleware.limit_for("/api/upload/sessions/abc/finalize") == settings.MAX_JSON_BODY_SIZE
+    print("✓ 只有数据上传接口放宽请求体上限")
@@ -0,0 +1,80 @@
+"""
+响应警告测试，验证警告的收集、稳定代码以及分析和拆分过程中产生的警告
+"""
+
+import asyncio
+import tempfile
+from pathlib import Path
+
+from src.core.diagnostics import add_warning, collect_warnings
+from src.models.schemas import ChapterInfo, WarningCode
+from src.services.pdf_analyzer import PDFAnalyzer
+from src.services.pdf_splitter import PDFSplitter
+from src.services.signatures import signature_warnings
+
+
+def test_collector():
+    """测试只在收集上下文中记录警告"""
+    print("测试警告收集...")
+
+    add_warning(WarningCode.PAGE_UNREADABLE, "忽略", page=1)
+    with collect_warnings() as warnings:
+        add_warning(WarningCode.PAGE_UNREADABLE, "第 3 页无法读取，已跳过", page=3)
+        with collect_warnings() as inner:
+            add_warning(WarningCode.CHAPTER_FAILED, "内层")
+    assert [w.code for w in warnings] == [WarningCode.PAGE_UNREADABLE]
+    assert warnings[0].details == {"page": 3}
+    assert [w.code for w in inner] == [WarningCode.CHAPTER_FAILED]
+
+    signature = signature_warnings(2)[0]
+    assert signature.code.value == "signatures_invalidated" and signature.details == {"count": 2}
+    print("✓ 上下文外的警告被忽略，嵌套上下文互不影响")
+
+
+def test_analysis_warnings(make_pdf):
+    """测试书签页码错乱和未识别到结构时的警告"""
+    print("\n测试分析警告...")
+
+    analyzer = PDFAnalyzer()
+    with tempfile.TemporaryDirectory() as tmp:
+        broken = Path(tmp) / "broken.pdf"
+        make_pdf(broken, 6, toc=[[1, "第1章", 1], [1, "第2章", 5], [1, "第3章", 3]])
+        plain = Path(tmp) / "plain.pdf"
+        make_pdf(plain, 4)
+
+        async def run():
+            with collect_warnings() as warnings:
+                chapters, _ = await analyzer.analyze_pdf(str(broken), "broken", use_llm=False)
+            assert [c.title for c in chapters] == ["第1章", "第3章"]
+            outline = [w for w in warnings if w.code == WarningCode.OUTLINE_INCONSISTENT]
+            assert len(outline) == 1 and outline[0].details == {"title": "第2章", "page": 5}
+
+            with collect_warnings() as warnings:
+                await analyzer.analyze_pdf(str(plain), "plain", use_llm=False)
+            assert [w.code for w in warnings] == [WarningCode.NO_STRUCTURE_DETECTED]
+
+        asyncio.run(run())
+    print("✓ 无效书签被忽略并返回 outline_page_refs_inconsistent")
+
+
+def test_split_warnings(make_pdf):
+    """测试单个章节失败时其余章节照常生成并记录警告"""
+    print("\n测试拆分警告...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "book.pdf"
+        make_pdf(source, 4)
+        chapters = [
+            ChapterInfo(title="第1章", start_page=1, end_page=2, page_count=2),
+            ChapterInfo(title="第2章", start_page=3, end_page=4, page_count=2),
+        ]
+
+        async def run():
+            with collect_warnings() as warnings:
+                links = await PDFSplitter().split_pdf(str(source), chapters, str(Path(tmp) / "out"), max_output_bytes=1)
+            assert links == []
+            assert [w.code for w in warnings] == [WarningCode.CHAPTER_FAILED] * 2
+            assert [w.details["chapter"] for w in warnings] == [1, 2]
+
+        asyncio.run(run())
+    print("✓ 章节失败以 chapter_failed 返回，不只写入日志")
@@ -0,0 +1,131 @@
+"""
+Webhook投递测试，验证签名、失败重试和手动重新投递
+"""
+
+import asyncio
+import hashlib
+import hmac
+import socket
+
+import httpx
+
+from src.core.config import settings
+from src.models.schemas import WebhookDeliveryStatus
+from src.services import webhook_service as webhook_module
+from src.services.webhook_service import WebhookService, sign_payload
+
+
+class FakeReceiver:
+    """按预设状态码依次响应的Webhook接收方"""
+
+    def __init__(self, statuses):
+        self.statuses = list(statuses)
+        self.requests = []
+        # 替换前保存真实的客户端类
+        self._client_class = httpx.AsyncClient
+
+    def client(self, *args, **kwargs):
+        return self._client_class(transport=httpx.MockTransport(self._handle))
+
+    def _handle(self, request: httpx.Request) -> httpx.Response:
+        self.requests.append(request)
+        return httpx.Response(self.statuses.pop(0) if self.statuses else 200)
+
+
+def _resolve_public(host, port, *args, **kwargs):
+    """请求级Webhook发送前会解析域名，测试中固定解析到公网地址"""
+    return [(socket.AF_INET, socket.SOCK_STREAM, 6, "", ("93.184.216.34", port or 0))]
+
+
+def _with_receiver(monkeypatch, receiver, coro_factory):
+    """替换投递服务使用的HTTP客户端和域名解析，测试结束后由monkeypatch恢复"""
+    monkeypatch.setattr(settings, "NOTIFY_WEBHOOK_SECRET", "whsec-test")
+    monkeypatch.setattr(webhook_module.httpx, "AsyncClient", receiver.client)
+    monkeypatch.setattr(webhook_module.socket, "getaddrinfo", _resolve_public)
+    return asyncio.run(coro_factory(WebhookService()))
+
+
+def test_signature():
+    """测试签名格式"""
+    print("测试Webhook签名...")
+
+    body = b'{"event":"task.completed"}'
+    expected = hmac.new(b"whsec-test", b"1700000000." + body, hashlib.sha256).hexdigest()
+    assert sign_payload("whsec-test", "1700000000", body) == f"sha256={expected}"
+    print("✓ 签名为 HMAC-SHA256(timestamp.body)")
+
+
+def test_signed_delivery(tmp_upload_dir, monkeypatch):
+    """测试成功投递带签名头"""
+    print("\n测试签名投递...")
+
+    receiver = FakeReceiver([200])
+
+    async def run(service):
+        delivery = await service.deliver(
+            "task.completed", "https://hooks.example.com/pdf", {"task_id": "t-1"}, global_channel=True
+        )
+        # 已投递的记录不再留在内存中
+        assert delivery.delivery_id not in service.deliveries
+        assert (await service.get_delivery(delivery.delivery_id)).status == WebhookDeliveryStatus.DELIVERED
+        return delivery
+
+    delivery = _with_receiver(monkeypatch, receiver, run)
+    assert delivery.status == WebhookDeliveryStatus.DELIVERED
+
+    request = receiver.requests[0]
+    timestamp = request.headers["X-Webhook-Timestamp"]
+    assert request.headers["X-Webhook-Id"] == delivery.delivery_id
+    assert request.headers["X-Webhook-Signature"] == sign_payload("whsec-test", timestamp, request.content)
+    print("✓ 请求携带投递ID、时间戳和签名")
+
+
+def test_tenant_secret(tmp_upload_dir, monkeypatch):
+    """测试请求级Webhook使用所属租户的密钥，不使用全局密钥"""
+    print("\n测试租户签名密钥...")
+
+    receiver = FakeReceiver([200, 200])
+    monkeypatch.setattr(settings, "TENANTS", {"team-a": {"webhook_secret": "whsec-team-a"}})
+
+    async def run(service):
+        await service.deliver("task.completed", "https://hooks.example.com/a", {"task_id": "t-3", "tenant_id": "team-a"})
+        await service.deliver("task.completed", "https://hooks.example.com/b", {"task_id": "t-4", "tenant_id": "team-b"})
+
+    _with_receiver(monkeypatch, receiver, run)
+
+    signed, unsigned = receiver.requests
+    timestamp = signed.headers["X-Webhook-Timestamp"]
+    assert signed.headers["X-Webhook-Signature"] == sign_payload("whsec-team-a", timestamp, signed.content)
+    assert "X-Webhook-Signature" not in unsigned.headers
+    print("✓ 请求级Webhook按租户密钥签名，租户未配置密钥时不签名，全局密钥只用于全局渠道")
+
+
+def test_retry_backoff_and_redeliver(tmp_upload_dir, monkeypatch):
+    """测试失败后指数退避，以及重试用尽后手动重新投递"""
+    print("\n测试失败重试...")
+
+    receiver = FakeReceiver([500, 502, 200])
+    monkeypatch.setattr(settings, "WEBHOOK_MAX_ATTEMPTS", 2)
+
+    async def run(service):
+        delivery = await service.deliver("task.failed", "https://hooks.example.com/pdf", {"task_id": "t-2"})
+        assert delivery.status == WebhookDeliveryStatus.PENDING
+        delay = (delivery.next_attempt_at - delivery.attempts[0].timestamp).total_seconds()
+        assert abs(delay - settings.WEBHOOK_RETRY_BASE_DELAY) < 1
+
+        await service._attempt(delivery)
+        assert delivery.status == WebhookDeliveryStatus.FAILED
+        assert [item.status_code for item in delivery.attempts] == [500, 502]
+
+        # 重启后从磁盘恢复投递记录
+        reloaded = WebhookService()
+        assert (await reloaded.list_deliveries(task_id="t-2"))[0].status == WebhookDeliveryStatus.FAILED
+        assert await reloaded.list_deliveries(status=WebhookDeliveryStatus.PENDING) == []
+        assert delivery.delivery_id not in reloaded.deliveries
+
+        redelivered = await service.redeliver(delivery.delivery_id)
+        assert redelivered.status == WebhookDeliveryStatus.DELIVERED
+        assert len(redelivered.attempts) == 3
+
+    _with_receiver(monkeypatch, receiver, run)
+    print("✓ 失败按退避重试，重试用尽后可手动重新投递")
@@ -0,0 +1,88 @@
+"""
+章节来源XMP测试，验证写入的来源信息可被解析，以及清除元数据时不写入
+"""
+
+import asyncio
+import tempfile
+import xml.etree.ElementTree as ET
+from pathlib import Path
+
+import fitz
+
+from src import __version__
+from src.models.schemas import ChapterInfo
+from src.services.pdf_splitter import PDFSplitter
+from src.services.xmp import PROVENANCE_NS
+
+
+def _source(path: Path) -> None:
+    doc = fitz.open()
+    for i in range(4):
+        doc.new_page().insert_text((72, 72), f"Page {i + 1}")
+    doc.save(str(path))
+    doc.close()
+
+
+def _provenance(path: Path) -> dict:
+    """读取章节XMP中的来源字段"""
+    with fitz.open(str(path)) as doc:
+        xmp = doc.get_xml_metadata()
+    root = ET.fromstring(xmp[xmp.index("<x:xmpmeta"):xmp.index("</x:xmpmeta>") + len("</x:xmpmeta>")])
+    prefix = f"{{{PROVENANCE_NS}}}"
+    return {
+        element.tag[len(prefix):]: element.text or ""
+        for element in root.iter()
+        if element.tag.startswith(prefix)
+    }
+
+
+def test_chapter_xmp():
+    """测试每个章节写入各自的来源信息"""
+    print("测试写入来源XMP...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        _source(source)
+        chapters = [
+            ChapterInfo(title="Intro & <Overview>", start_page=1, end_page=2, page_count=2),
+            ChapterInfo(title="第二章", start_page=3, end_page=4, page_count=2),
+        ]
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source),
+            chapters,
+            str(Path(tmp) / "out"),
+            doc_key="abc123",
+            source_id="file-1",
+            task_id="task-1"
+        ))
+
+        first = _provenance(Path(tmp) / "out" / links[0])
+        assert first["SourceDocumentID"] == "file-1"
+        assert first["SourceSHA256"] == "abc123"
+        assert first["ChapterIndex"] == "1"
+        assert first["ChapterTitle"] == "Intro & <Overview>"
+        assert (first["StartPage"], first["EndPage"]) == ("1", "2")
+        assert first["SplitTaskID"] == "task-1"
+        assert __version__ in first["Generator"]
+
+        second = _provenance(Path(tmp) / "out" / links[1])
+        assert second["ChapterIndex"] == "2"
+        assert second["ChapterTitle"] == "第二章"
+    print("✓ 来源信息完整，特殊字符已转义")
+
+
+def test_strip_metadata_skips_xmp():
+    """测试清除元数据时不写入来源XMP"""
+    print("\n测试清除元数据...")
+
+    with tempfile.TemporaryDirectory() as tmp:
+        source = Path(tmp) / "source.pdf"
+        _source(source)
+        chapters = [ChapterInfo(title="全文", start_page=1, end_page=4, page_count=4)]
+        links = asyncio.run(PDFSplitter().split_pdf(
+            str(source), chapters, str(Path(tmp) / "out"), strip_metadata=True, source_id="file-1"
+        ))
+
+        with fitz.open(str(Path(tmp) / "out" / links[0])) as doc:
+            assert "SourceDocumentID" not in doc.get_xml_metadata()
+    print("✓ strip_metadata优先，不写入来源信息")
@@ -0,0 +1,23 @@
+/**
+ * /api/* 代理路由
+ * 浏览器只访问同源的 /api，由服务端附加API Key后转发到后端
+ */
+
+import { NextRequest } from 'next/server';
+import { proxyToBackend } from '@/lib/backendProxy';
+
+export const dynamic = 'force-dynamic';
+
+async function handler(request: NextRequest, { params }: { params: { path: string[] } }) {
+  const path = params.path.map(encodeURIComponent).join('/');
+  return proxyToBackend(request, `/api/${path}`);
+}
+
+export {
+  handler as GET,
+  handler as HEAD,
+  handler as POST,
+  handler as PUT,
+  handler as PATCH,
+  handler as DELETE,
+};
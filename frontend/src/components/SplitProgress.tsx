@@ -34,8 +34,8 @@ export function SplitProgress({ task, onComplete }: SplitProgressProps) {
       updateTaskProgress(updatedTask.progress);
       setCurrentTask(updatedTask);
       
-      // 如果任务完成或失败，停止检查
-      if (updatedTask.status === 'completed' || updatedTask.status === 'failed') {
+      // 如果任务完成、失败或已取消，停止检查
+      if (updatedTask.status === 'completed' || updatedTask.status === 'failed' || updatedTask.status === 'cancelled') {
         setIsCheckingStatus(false);
         if (onComplete && updatedTask.status === 'completed') {
           onComplete();
@@ -56,7 +56,7 @@ export function SplitProgress({ task, onComplete }: SplitProgressProps) {
     checkTaskStatus();
     
     // 如果任务还在处理中，定期检查状态
-    if (status === 'pending' || status === 'processing') {
+    if (status === 'pending' || status === 'queued' || status === 'processing') {
       intervalId = setInterval(checkTaskStatus, 2000); // 每2秒检查一次
     }
     
@@ -72,12 +72,16 @@ export function SplitProgress({ task, onComplete }: SplitProgressProps) {
     switch (status) {
       case 'pending':
         return '等待处理...';
+      case 'queued':
+        return '排队中...';
       case 'processing':
         return '正在拆分PDF...';
       case 'completed':
         return '拆分完成！';
       case 'failed':
         return '拆分失败';
+      case 'cancelled':
+        return '任务已取消';
       default:
         return '未知状态';
     }
@@ -87,6 +91,7 @@ export function SplitProgress({ task, onComplete }: SplitProgressProps) {
   const getStatusColor = () => {
     switch (status) {
       case 'pending':
+      case 'queued':
         return 'text-yellow-600';
       case 'processing':
         return 'text-blue-600';
@@ -94,6 +99,8 @@ export function SplitProgress({ task, onComplete }: SplitProgressProps) {
         return 'text-green-600';
       case 'failed':
         return 'text-red-600';
+      case 'cancelled':
+        return 'text-gray-600';
       default:
         return 'text-gray-600';
     }
@@ -141,7 +148,7 @@ export function SplitProgress({ task, onComplete }: SplitProgressProps) {
             <div className="flex items-center gap-2">
               <div className={cn(
                 'w-3 h-3 rounded-full',
-                status === 'pending' ? 'bg-yellow-400' : '',
+                status === 'pending' || status === 'queued' ? 'bg-yellow-400' : '',
                 status === 'processing' ? 'bg-blue-400 animate-pulse' : '',
                 status === 'completed' ? 'bg-green-400' : '',
                 status === 'failed' ? 'bg-red-400' : ''
@@ -6,35 +6,10 @@
 import axios, { AxiosProgressEvent } from 'axios';
 import { FileInfo, ChapterInfo, PDFMetadata, SplitTask } from '@/store/useAppStore';
 
-// API基础配置 - WSL2环境适配
-const getApiBaseUrl = () => {
-  // 优先使用环境变量配置
-  if (process.env.NEXT_PUBLIC_API_URL) {
-    return process.env.NEXT_PUBLIC_API_URL;
-  }
-  
-  // WSL2环境下的地址检测
-  if (typeof window !== 'undefined') {
-    const hostname = window.location.hostname;
-    
-    // 如果是在WSL2环境中运行，尝试不同的地址
-    if (hostname === 'localhost' || hostname === '127.0.0.1') {
-      return 'http://localhost:8080';
-    }
-    
-    // 如果是Docker环境或其他网络环境
-    return `http://${hostname}:8080`;
-  }
-  
-  // 服务端渲染时的默认地址
-  return 'http://localhost:8080';
-};
-
-const API_BASE_URL = getApiBaseUrl();
-
-// 创建axios实例
+// 浏览器只访问同源地址，由Next.js服务端代理（src/app/api）附加API Key后转发到后端，
+// API Key不会打包进前端代码
 const apiClient = axios.create({
-  baseURL: API_BASE_URL,
+  baseURL: '',
   timeout: 30000, // 30秒超时
   headers: {
     'Content-Type': 'application/json',
@@ -0,0 +1,65 @@
+/**
+ * 后端代理
+ * 在Next.js服务端转发浏览器请求到后端，API Key只保存在服务端环境变量中，不会下发到浏览器
+ */
+
+import { NextRequest, NextResponse } from 'next/server';
+
+// 后端地址，容器内通过服务名访问
+const BACKEND_URL = process.env.BACKEND_URL || 'http://localhost:8080';
+
+// 后端配置了API Key时使用的Key（需要editor角色才能上传和拆分），未配置时以匿名身份访问
+const BACKEND_API_KEY = process.env.BACKEND_API_KEY;
+
+// 不转发的逐跳头部，以及由代理自行设置的头部
+const HOP_BY_HOP_HEADERS = [
+  'connection',
+  'keep-alive',
+  'transfer-encoding',
+  'upgrade',
+  'host',
+  'content-length',
+];
+
+/**
+ * 将请求转发到后端同名路径，并以流的形式返回后端响应
+ */
+export async function proxyToBackend(request: NextRequest, path: string): Promise<Response> {
+  const target = new URL(path + request.nextUrl.search, BACKEND_URL);
+
+  const headers = new Headers(request.headers);
+  HOP_BY_HOP_HEADERS.forEach((name) => headers.delete(name));
+  // 浏览器自带的Key一律丢弃，只使用服务端配置的Key
+  headers.delete('x-api-key');
+  if (BACKEND_API_KEY) {
+    headers.set('X-API-Key', BACKEND_API_KEY);
+  }
+
+  const hasBody = request.method !== 'GET' && request.method !== 'HEAD';
+
+  try {
+    const response = await fetch(target, {
+      method: request.method,
+      headers,
+      body: hasBody ? request.body : undefined,
+      redirect: 'manual',
+      cache: 'no-store',
+      // 流式转发上传的文件，避免在前端服务中缓冲整个请求体
+      ...(hasBody ? { duplex: 'half' } : {}),
+    } as RequestInit);
+
+    const responseHeaders = new Headers(response.headers);
+    HOP_BY_HOP_HEADERS.forEach((name) => responseHeaders.delete(name));
+    // fetch已经解压了响应体，不能再声明原来的编码
+    responseHeaders.delete('content-encoding');
+
+    return new Response(response.body, {
+      status: response.status,
+      statusText: response.statusText,
+      headers: responseHeaders,
+    });
+  } catch (error) {
+    console.error('❌ [后端代理错误]', `${request.method} ${target.pathname}`, error);
+    return NextResponse.json({ detail: '无法连接后端服务' }, { status: 502 });
+  }
+}